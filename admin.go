@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// parseAdminEmails turns the comma separated ADMIN_EMAILS value into a set.
+func parseAdminEmails(raw string) map[string]bool {
+	admins := map[string]bool{}
+	for _, email := range strings.Split(raw, ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" {
+			admins[email] = true
+		}
+	}
+	return admins
+}
+
+// requireAdmin authenticates the request and checks the user's email is in
+// ADMIN_EMAILS. If not, the error response has been written and ok is false.
+func (cfg *apiConfig) requireAdmin(w http.ResponseWriter, r *http.Request) (userID uuid.UUID, ok bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return uuid.Nil, false
+	}
+	userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return uuid.Nil, false
+	}
+
+	user, err := cfg.db.WithContext(r.Context()).GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return uuid.Nil, false
+	}
+	if user == nil || !cfg.adminEmails[strings.ToLower(user.Email)] {
+		respondWithError(w, http.StatusForbidden, "Admin access required", nil)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"golang.org/x/sync/errgroup"
+)
+
+// aspectOther is the category of videos matching no configured ratio
+const aspectOther = "other"
+
+// defaultAspectCategories are used unless ASPECT_CATEGORIES is set
+var defaultAspectCategories = []string{"landscape=16:9", "portrait=9:16"}
+
+// defaultAspectTolerancePercent is how far, relative to the target, a
+// ratio may be off and still match it
+const defaultAspectTolerancePercent = 5
+
+// Category names end up in object keys through {aspect} and {folder}
+var aspectNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+type aspectCategory struct {
+	Name  string
+	Ratio float64
+}
+
+// aspectCategories files a video's size under the nearest configured
+// ratio within the tolerance, or under "other".
+type aspectCategories struct {
+	categories []aspectCategory
+	tolerance  float64
+}
+
+// parseAspectCategories reads ASPECT_CATEGORIES entries of the form
+// name=W:H or name=ratio, e.g. square=1:1 or scope=2.39.
+func parseAspectCategories(entries []string, tolerancePercent int) (aspectCategories, error) {
+	if tolerancePercent < 0 || tolerancePercent >= 100 {
+		return aspectCategories{}, fmt.Errorf("tolerance must be between 0 and 99 percent, got %d", tolerancePercent)
+	}
+	a := aspectCategories{tolerance: float64(tolerancePercent) / 100}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		name, rawRatio, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !aspectNameRe.MatchString(name) {
+			return aspectCategories{}, fmt.Errorf("category %q must look like name=16:9 with a lowercase name", entry)
+		}
+		if name == aspectOther || seen[name] {
+			return aspectCategories{}, fmt.Errorf("category name %q is reserved or used twice", name)
+		}
+		ratio, err := parseAspectRatio(strings.TrimSpace(rawRatio))
+		if err != nil {
+			return aspectCategories{}, fmt.Errorf("category %q: %w", name, err)
+		}
+		seen[name] = true
+		a.categories = append(a.categories, aspectCategory{Name: name, Ratio: ratio})
+	}
+	return a, nil
+}
+
+func parseAspectRatio(raw string) (float64, error) {
+	var ratio float64
+	if w, h, ok := strings.Cut(raw, ":"); ok {
+		width, errW := strconv.ParseFloat(w, 64)
+		height, errH := strconv.ParseFloat(h, 64)
+		if errW != nil || errH != nil || height <= 0 {
+			return 0, fmt.Errorf("invalid ratio %q", raw)
+		}
+		ratio = width / height
+	} else {
+		var err error
+		ratio, err = strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ratio %q", raw)
+		}
+	}
+	if ratio <= 0 || math.IsInf(ratio, 0) || math.IsNaN(ratio) {
+		return 0, fmt.Errorf("invalid ratio %q", raw)
+	}
+	return ratio, nil
+}
+
+// classify returns the category of a width x height picture. When the
+// tolerances of several categories overlap the closest one wins.
+func (a aspectCategories) classify(width, height int) string {
+	ratio := float64(width) / float64(height)
+	best, bestOff := aspectOther, math.Inf(1)
+	for _, c := range a.categories {
+		off := math.Abs(ratio-c.Ratio) / c.Ratio
+		if off <= a.tolerance && off < bestOff {
+			best, bestOff = c.Name, off
+		}
+	}
+	return best
+}
+
+// videoAspect is a probed video size and the category it falls in.
+type videoAspect struct {
+	Width    int
+	Height   int
+	Category string
+	// DynamicRange is one of the media.DynamicRange constants
+	DynamicRange string
+	AudioTracks  []media.AudioTrack
+	// Duration is in seconds
+	Duration float64
+}
+
+// dimensions are the values stored with the video's renditions.
+func (v videoAspect) dimensions() database.Dimensions {
+	width, height, category, dynamicRange, duration := v.Width, v.Height, v.Category, v.DynamicRange, v.Duration
+	ratio := float64(width) / float64(height)
+	return database.Dimensions{
+		Width:        &width,
+		Height:       &height,
+		AspectRatio:  &ratio,
+		Aspect:       &category,
+		DynamicRange: &dynamicRange,
+		AudioTracks:  audioTracks(v.AudioTracks),
+		Duration:     &duration,
+	}
+}
+
+// probeAspect measures the first video stream of filePath, a file or URL,
+// categorizes it, tells whether it is HDR, lists its audio tracks and
+// measures its length.
+func (cfg *apiConfig) probeAspect(ctx context.Context, filePath string) (videoAspect, error) {
+	// Each ffprobe run reads a different part of the file, so they don't
+	// wait for each other
+	var (
+		width, height int
+		dynamicRange  string
+		tracks        []media.AudioTrack
+		duration      float64
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		var err error
+		width, height, err = cfg.prober.Size(gctx, filePath)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		dynamicRange, err = cfg.prober.DynamicRange(gctx, filePath)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		tracks, err = cfg.prober.AudioTracks(gctx, filePath)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		duration, err = cfg.prober.Duration(gctx, filePath)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return videoAspect{}, err
+	}
+	return videoAspect{
+		Width:        width,
+		Height:       height,
+		Category:     cfg.aspects.classify(width, height),
+		DynamicRange: dynamicRange,
+		AudioTracks:  tracks,
+		Duration:     duration,
+	}, nil
+}
@@ -1,7 +1,17 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
 )
 
 func (cfg apiConfig) ensureAssetsDir() error {
@@ -10,3 +20,62 @@ func (cfg apiConfig) ensureAssetsDir() error {
 	}
 	return nil
 }
+
+// randomAssetName returns a random file name with the given extension
+// (including the dot) for storing under assetsRoot.
+func randomAssetName(ext string) (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate filename: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes) + ext, nil
+}
+
+// assetContentTypes are the media types of the extensions assets are saved
+// with.
+var assetContentTypes = map[string]string{
+	".jpg": "image/jpeg",
+	".png": "image/png",
+}
+
+// recordAsset notes that the asset name, just saved under assetsRoot,
+// belongs to the video, with the media type of its extension.
+func (cfg *apiConfig) recordAsset(name string, videoID uuid.UUID) error {
+	asset := database.Asset{Name: name, VideoID: &videoID}
+	if contentType, ok := assetContentTypes[path.Ext(name)]; ok {
+		asset.ContentType = &contentType
+	}
+	return cfg.db.CreateAsset(asset)
+}
+
+// getAssetURL is the absolute URL of an asset saved outside a request, by a
+// background job, under EXTERNAL_BASE_URL or the server's local address.
+func (cfg apiConfig) getAssetURL(filename string) string {
+	return cfg.defaultBaseURL + "/assets/" + filename
+}
+
+// requestAssetURL is the absolute URL of an asset under the address the
+// client that sent r reaches the server at.
+func (cfg *apiConfig) requestAssetURL(r *http.Request, filename string) string {
+	return cfg.baseURL(r) + "/assets/" + filename
+}
+
+// assetImageSize reads the width and height of the image asset at
+// assetURL from its header. ok is false if it isn't a JPEG or PNG in
+// ASSETS_ROOT.
+func (cfg *apiConfig) assetImageSize(assetURL string) (width, height int, ok bool) {
+	name := path.Base(assetURL)
+	if !isAssetName(name) {
+		return 0, 0, false
+	}
+	f, err := os.Open(filepath.Join(cfg.assetsRoot, name))
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, false
+	}
+	return config.Width, config.Height, true
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// parseAudioLanguage normalizes the audio_language an upload asked for,
+// an ISO 639-2 code like "eng" as files tag their tracks. "" leaves the
+// file's own default track.
+func parseAudioLanguage(raw string) (string, error) {
+	language := strings.ToLower(strings.TrimSpace(raw))
+	if language == "" {
+		return "", nil
+	}
+	if len(language) != 3 || strings.Trim(language, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return "", fmt.Errorf("audio language %q isn't a three letter ISO 639-2 code", raw)
+	}
+	return language, nil
+}
+
+// audioLanguageMissingError is an upload without a track in the audio
+// language it asked for.
+type audioLanguageMissingError struct {
+	language  string
+	available []string
+}
+
+func (e *audioLanguageMissingError) Error() string {
+	return fmt.Sprintf("no %q audio track, the file has %v", e.language, e.available)
+}
+
+// respondWithAudioLanguageMissing answers 422 with the languages the file
+// has, if err is an audioLanguageMissingError, and reports whether it was.
+func respondWithAudioLanguageMissing(w http.ResponseWriter, err error) bool {
+	var missing *audioLanguageMissingError
+	if !errors.As(err, &missing) {
+		return false
+	}
+	respondWithErrorDetails(w, http.StatusUnprocessableEntity, "No audio track in that language", err, map[string]any{
+		"language":  missing.language,
+		"available": missing.available,
+	})
+	return true
+}
+
+// checkAudioLanguage makes sure the upload at input has a track in
+// language before it is queued, returning an audioLanguageMissingError if
+// it doesn't, so the default asked for isn't dropped silently. A file that
+// can't be probed is left for processing to reject.
+func (cfg *apiConfig) checkAudioLanguage(ctx context.Context, input, language string) error {
+	if language == "" {
+		return nil
+	}
+	tracks, err := cfg.prober.AudioTracks(ctx, input)
+	if err != nil {
+		slog.Warn("Couldn't probe audio tracks", "error", err)
+		return nil
+	}
+	if findAudioTrack(tracks, language) != media.KeepDefaultAudio {
+		return nil
+	}
+	available := []string{}
+	for _, track := range tracks {
+		if track.Language != "" {
+			available = append(available, track.Language)
+		}
+	}
+	return &audioLanguageMissingError{language: language, available: available}
+}
+
+// findAudioTrack returns the Index of the first track in language, or
+// media.KeepDefaultAudio if there is none.
+func findAudioTrack(tracks []media.AudioTrack, language string) int {
+	for _, track := range tracks {
+		if strings.EqualFold(track.Language, language) {
+			return track.Index
+		}
+	}
+	return media.KeepDefaultAudio
+}
+
+// defaultAudioTrack probes which track of the upload at inputPath language
+// picks. A file without one, which the upload check rules out for new
+// jobs, keeps its own default.
+func (cfg *apiConfig) defaultAudioTrack(ctx context.Context, inputPath, language string) (int, error) {
+	if language == "" {
+		return media.KeepDefaultAudio, nil
+	}
+	tracks, err := cfg.prober.AudioTracks(ctx, inputPath)
+	if err != nil {
+		return 0, err
+	}
+	index := findAudioTrack(tracks, language)
+	if index == media.KeepDefaultAudio {
+		slog.WarnContext(ctx, "No audio track in the requested language, keeping the default", "language", language)
+	}
+	return index, nil
+}
+
+// audioTracks converts probed tracks to how they're stored.
+func audioTracks(tracks []media.AudioTrack) database.AudioTracks {
+	stored := make(database.AudioTracks, 0, len(tracks))
+	for _, track := range tracks {
+		stored = append(stored, database.AudioTrack{
+			Index:    track.Index,
+			Language: track.Language,
+			Title:    track.Title,
+			Codec:    track.Codec,
+			Channels: track.Channels,
+			Default:  track.Default,
+		})
+	}
+	return stored
+}
+
+// withDefaultAudio marks the track at index as the only default, as the
+// remux wrote it, unless index is media.KeepDefaultAudio.
+func withDefaultAudio(tracks database.AudioTracks, index int) database.AudioTracks {
+	if index == media.KeepDefaultAudio {
+		return tracks
+	}
+	marked := make(database.AudioTracks, len(tracks))
+	for i, track := range tracks {
+		track.Default = track.Index == index
+		marked[i] = track
+	}
+	return marked
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// auditRecord collects what a handler wants noted about its request beyond
+// what audited sees for itself.
+type auditRecord struct {
+	mu      sync.Mutex
+	action  string
+	videoID *uuid.UUID
+	details map[string]any
+}
+
+type auditRecordKey struct{}
+
+// requestAudit returns the record of an audited request, or nil for routes
+// that aren't audited. Its methods do nothing on nil.
+func requestAudit(r *http.Request) *auditRecord {
+	record, _ := r.Context().Value(auditRecordKey{}).(*auditRecord)
+	return record
+}
+
+// SetAction replaces the route's action, for handlers whose requests mean
+// more than one thing.
+func (a *auditRecord) SetAction(action string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.action = action
+	a.mu.Unlock()
+}
+
+// SetVideo names the video the request acted on when the path doesn't.
+func (a *auditRecord) SetVideo(videoID uuid.UUID) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.videoID = &videoID
+	a.mu.Unlock()
+}
+
+// Set adds a field to the entry's details.
+func (a *auditRecord) Set(key string, value any) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.details[key] = value
+	a.mu.Unlock()
+}
+
+// audited appends an audit log entry with action once next succeeds,
+// naming the authenticated caller, their address and the request ID.
+// Failed requests are left to the access log.
+func (cfg *apiConfig) audited(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Before next, since deleting an account invalidates its token
+		actorID := cfg.requesterID(r)
+		record := &auditRecord{action: action, details: map[string]any{}}
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r.WithContext(context.WithValue(r.Context(), auditRecordKey{}, record)))
+
+		if rec.status >= http.StatusBadRequest {
+			return
+		}
+		record.mu.Lock()
+		defer record.mu.Unlock()
+
+		params := database.CreateAuditEntryParams{
+			Action:    record.action,
+			IP:        cfg.clientIP(r),
+			RequestID: w.Header().Get(requestIDHeader),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Status:    rec.status,
+			VideoID:   record.videoID,
+		}
+		if rec.status == 0 {
+			params.Status = http.StatusOK
+		}
+		if actorID != uuid.Nil {
+			params.ActorID = &actorID
+		}
+		if params.VideoID == nil {
+			if videoID, err := uuid.Parse(r.PathValue("videoID")); err == nil {
+				params.VideoID = &videoID
+			}
+		}
+		details, err := json.Marshal(record.details)
+		if err != nil {
+			requestLogger(r).Error("Couldn't encode audit details", "action", params.Action, "error", err)
+			details = []byte("{}")
+		}
+		params.Details = details
+
+		// Written even if the client has hung up by now
+		if err := cfg.db.WithContext(context.WithoutCancel(r.Context())).CreateAuditEntry(params); err != nil {
+			requestLogger(r).Error("Couldn't write audit log entry", "action", params.Action, "error", err)
+		}
+	}
+}
+
+// statusRecorder remembers the response status for middleware that acts
+// on the outcome.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// clientIP is the caller's address: the connection's peer, or with
+// TRUST_PROXY_HEADERS the address the proxy in front added last to
+// X-Forwarded-For.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxyHeaders {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// parseExternalBaseURL checks EXTERNAL_BASE_URL, the address clients reach
+// the server at, e.g. https://tubely.example.com or
+// https://example.com/tubely, and returns it without a trailing slash.
+func parseExternalBaseURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("EXTERNAL_BASE_URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("EXTERNAL_BASE_URL %q must be an absolute http or https URL", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("EXTERNAL_BASE_URL %q can't have credentials, a query or a fragment", raw)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// baseURL is where the client that sent r reaches the server. In order of
+// preference that is EXTERNAL_BASE_URL, the X-Forwarded-Proto and
+// X-Forwarded-Host the proxy in front added last with TRUST_PROXY_HEADERS,
+// and the request's own Host.
+func (cfg *apiConfig) baseURL(r *http.Request) string {
+	if cfg.externalBaseURL != "" {
+		return cfg.externalBaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if cfg.trustProxyHeaders {
+		if proto := strings.ToLower(lastForwarded(r, "X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwarded := lastForwarded(r, "X-Forwarded-Host"); forwarded != "" {
+			host = forwarded
+		}
+	}
+	// Anything but a plain host and port is a forged or broken header
+	if host == "" || strings.ContainsAny(host, "/\\?#@ ") {
+		return cfg.defaultBaseURL
+	}
+	return scheme + "://" + host
+}
+
+// lastForwarded is the last entry of the comma separated header, the one
+// added by the proxy closest to the server.
+func lastForwarded(r *http.Request, header string) string {
+	values := r.Header.Values(header)
+	if len(values) == 0 {
+		return ""
+	}
+	entries := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(entries[len(entries)-1])
+}
@@ -1,10 +1,50 @@
 package main
 
-import "net/http"
+import (
+	"fmt"
+	"os"
+	"strings"
+)
 
-func noCacheMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Cache-Control", "no-store")
-		next.ServeHTTP(w, r)
-	})
+// Asset types that get their own Cache-Control value
+const (
+	assetTypeImage = "image"
+	assetTypeVideo = "video"
+	assetTypeOther = "other"
+)
+
+// cachePolicy is the Cache-Control value sent for each asset type.
+type cachePolicy map[string]string
+
+func newCachePolicy(image, video, other string) cachePolicy {
+	if image == "" {
+		// Asset names are random per upload, so a name's content never changes
+		image = "public, max-age=86400"
+	}
+	if video == "" {
+		// The stream proxy checks access per request
+		video = "private, no-cache"
+	}
+	if other == "" {
+		other = "no-cache"
+	}
+	return cachePolicy{assetTypeImage: image, assetTypeVideo: video, assetTypeOther: other}
+}
+
+// assetType is the asset type of a media type.
+func assetType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return assetTypeImage
+	case strings.HasPrefix(contentType, "video/"), contentType == "application/vnd.apple.mpegurl":
+		return assetTypeVideo
+	default:
+		return assetTypeOther
+	}
+}
+
+// fileETag is a cheap validator that changes whenever the file is
+// rewritten, without hashing its content.
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
 }
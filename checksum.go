@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// checksumHeader lets clients send the SHA-256 of the file they are
+// uploading, as hex or base64, so corruption in transit is rejected.
+const checksumHeader = "X-Content-SHA256"
+
+var errInvalidChecksum = errors.New("checksum must be a hex or base64 SHA-256 digest")
+
+// parseExpectedChecksum decodes a checksumHeader value. An empty value
+// returns a nil digest.
+func parseExpectedChecksum(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	var digest []byte
+	var err error
+	if len(value) == hex.EncodedLen(sha256.Size) {
+		digest, err = hex.DecodeString(value)
+	} else {
+		digest, err = base64.StdEncoding.DecodeString(value)
+	}
+	if err != nil || len(digest) != sha256.Size {
+		return nil, errInvalidChecksum
+	}
+	return digest, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// defaultCloudFrontLogInterval is how often new CloudFront logs are counted
+const defaultCloudFrontLogInterval = 15 * time.Minute
+
+// maxCloudFrontLogLine bounds one line of a log; real ones are a few
+// hundred bytes
+const maxCloudFrontLogLine = 1 << 20
+
+type cloudFrontLogResult struct {
+	Files  int      `json:"files"`
+	Bytes  int64    `json:"bytes"`
+	Failed []string `json:"failed"`
+}
+
+// startCloudFrontLogIngest counts new CloudFront standard logs every
+// CLOUDFRONT_LOG_INTERVAL until the server shuts down.
+func (cfg *apiConfig) startCloudFrontLogIngest() {
+	if cfg.cloudFrontLogPrefix == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.cloudFrontLogInterval)
+		defer ticker.Stop()
+		for {
+			result, err := cfg.ingestCloudFrontLogs(cfg.lifecycle.ctx)
+			if err != nil {
+				slog.Error("Couldn't ingest CloudFront logs", "error", err)
+			} else if result.Files > 0 {
+				slog.Info("Counted CloudFront log files", "files", result.Files, "bytes", result.Bytes)
+			}
+			select {
+			case <-ticker.C:
+			case <-cfg.lifecycle.drain:
+				return
+			}
+		}
+	}()
+}
+
+// ingestCloudFrontLogs adds the bytes served in every log file under
+// CLOUDFRONT_LOG_PREFIX that wasn't counted yet to the egress of the videos
+// they belong to. Requests for objects no video references are ignored.
+func (cfg *apiConfig) ingestCloudFrontLogs(ctx context.Context) (cloudFrontLogResult, error) {
+	result := cloudFrontLogResult{Failed: []string{}}
+	paginator := s3.NewListObjectsV2Paginator(cfg.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(cfg.cloudFrontLogBucket),
+		Prefix: aws.String(cfg.cloudFrontLogPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return result, fmt.Errorf("couldn't list logs: %w", err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			claimed, err := cfg.db.WithContext(ctx).ClaimCloudFrontLogFile(key)
+			if err != nil {
+				return result, fmt.Errorf("couldn't claim %s: %w", key, err)
+			}
+			if !claimed {
+				continue
+			}
+			bytes, err := cfg.ingestCloudFrontLogFile(ctx, key)
+			if err != nil {
+				slog.Warn("Couldn't ingest CloudFront log", "key", key, "error", err)
+				if err := cfg.db.WithContext(context.WithoutCancel(ctx)).ReleaseCloudFrontLogFile(key); err != nil {
+					slog.Warn("Couldn't release CloudFront log", "key", key, "error", err)
+				}
+				result.Failed = append(result.Failed, key)
+				continue
+			}
+			result.Files++
+			result.Bytes += bytes
+		}
+	}
+	return result, nil
+}
+
+// ingestCloudFrontLogFile counts one log file. It is parsed completely
+// before anything is recorded, so a corrupt file counts nothing.
+func (cfg *apiConfig) ingestCloudFrontLogFile(ctx context.Context, key string) (int64, error) {
+	out, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.cloudFrontLogBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer out.Body.Close()
+
+	var body io.Reader = out.Body
+	if strings.HasSuffix(key, ".gz") {
+		gz, err := gzip.NewReader(out.Body)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	served, err := parseCloudFrontLog(body)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for usage, bytes := range served {
+		owner, err := cfg.db.WithContext(ctx).GetVideoOwnerByObjectKey(usage.objectKey)
+		if err != nil {
+			return total, err
+		}
+		if owner.VideoID == uuid.Nil {
+			continue
+		}
+		err = cfg.db.WithContext(ctx).AddEgress(database.Egress{
+			UserID:  owner.UserID,
+			OrgID:   owner.OrgID,
+			VideoID: owner.VideoID,
+			Day:     usage.day,
+			Source:  database.EgressCloudFront,
+			Bytes:   bytes,
+		})
+		if err != nil {
+			return total, err
+		}
+		total += bytes
+	}
+	return total, nil
+}
+
+type cloudFrontUsage struct {
+	objectKey string
+	day       time.Time
+}
+
+// parseCloudFrontLog sums sc-bytes by object key and day. Columns are
+// located through the #Fields header, falling back to the standard log
+// layout for files without one.
+func parseCloudFrontLog(r io.Reader) (map[cloudFrontUsage]int64, error) {
+	dateCol, bytesCol, stemCol := 0, 3, 7
+	served := map[cloudFrontUsage]int64{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxCloudFrontLogLine)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields, ok := strings.CutPrefix(line, "#Fields:"); ok {
+			for i, name := range strings.Fields(fields) {
+				switch name {
+				case "date":
+					dateCol = i
+				case "sc-bytes":
+					bytesCol = i
+				case "cs-uri-stem":
+					stemCol = i
+				}
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cols := strings.Split(line, "\t")
+		if len(cols) <= max(dateCol, bytesCol, stemCol) {
+			return nil, fmt.Errorf("line has %d fields: %q", len(cols), line)
+		}
+		day, err := time.Parse(time.DateOnly, cols[dateCol])
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", cols[dateCol])
+		}
+		bytes, err := strconv.ParseInt(cols[bytesCol], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sc-bytes %q", cols[bytesCol])
+		}
+		objectKey, err := url.PathUnescape(strings.TrimPrefix(cols[stemCol], "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cs-uri-stem %q", cols[stemCol])
+		}
+		served[cloudFrontUsage{objectKey: objectKey, day: day}] += bytes
+	}
+	return served, scanner.Err()
+}
+
+// handlerAdminIngestCloudFrontLogs counts new CloudFront logs now instead
+// of at the next interval.
+func (cfg *apiConfig) handlerAdminIngestCloudFrontLogs(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	if cfg.cloudFrontLogPrefix == "" {
+		respondWithError(w, http.StatusNotFound, "CloudFront log ingestion is not enabled", nil)
+		return
+	}
+
+	result, err := cfg.ingestCloudFrontLogs(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't ingest CloudFront logs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
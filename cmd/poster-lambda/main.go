@@ -0,0 +1,242 @@
+// Command poster-lambda extracts poster frames for Tubely as an AWS Lambda
+// function, so the API servers don't have to. Build it for the
+// provided.al2023 runtime, ship ffmpeg and ffprobe in a layer, and trigger
+// it with the bucket's ObjectCreated events. Each stream rendition it sees
+// gets a poster written back to the bucket and a result reported to
+// RESULT_QUEUE_URL or RESULT_WEBHOOK_URL, where the server picks it up.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPosterPrefix = "lambda-posters/"
+	// posterTimestamp is where the frame is taken when scene selection is
+	// off or finds nothing, as on the server
+	posterTimestamp = 1.0
+	// presignExpiry only has to outlast ffmpeg reading the video
+	presignExpiry = 15 * time.Minute
+)
+
+// Object tags the server puts on every upload
+const (
+	tagVideoID      = "video-id"
+	tagRendition    = "rendition"
+	renditionStream = "stream"
+)
+
+// s3Event is the payload S3 invokes the function with. Only the fields read
+// here are declared.
+type s3Event struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// posterResult matches the server's posterResult.
+type posterResult struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	PosterKey string    `json:"poster_key,omitempty"`
+	Timestamp float64   `json:"timestamp"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type handler struct {
+	s3Client       *s3.Client
+	ffmpeg         *media.FFmpeg
+	prefix         string
+	sceneSelection bool
+	reporter       reporter
+}
+
+func main() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	runtime := newRuntimeClient(os.Getenv("AWS_LAMBDA_RUNTIME_API"))
+
+	h, err := newHandler(context.Background())
+	if err != nil {
+		runtime.initError(err)
+		os.Exit(1)
+	}
+	runtime.serve(h.handle)
+}
+
+func newHandler(ctx context.Context) (*handler, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	tools, err := media.DetectTools(ctx, media.Config{
+		FFmpegPath:  os.Getenv("FFMPEG_PATH"),
+		FFprobePath: os.Getenv("FFPROBE_PATH"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("media tools check failed: %w", err)
+	}
+
+	h := &handler{
+		s3Client:       s3.NewFromConfig(awsCfg),
+		ffmpeg:         &media.FFmpeg{Tools: tools},
+		prefix:         os.Getenv("POSTER_PREFIX"),
+		sceneSelection: os.Getenv("POSTER_SCENE_SELECTION") != "false",
+	}
+	if h.prefix == "" {
+		h.prefix = defaultPosterPrefix
+	}
+	if !strings.HasSuffix(h.prefix, "/") {
+		h.prefix += "/"
+	}
+
+	queueURL, webhookURL := os.Getenv("RESULT_QUEUE_URL"), os.Getenv("RESULT_WEBHOOK_URL")
+	switch {
+	case queueURL != "":
+		h.reporter = queueReporter{client: sqs.NewFromConfig(awsCfg), queueURL: queueURL}
+	case webhookURL != "":
+		secret := os.Getenv("RESULT_WEBHOOK_SECRET")
+		if secret == "" {
+			return nil, errors.New("RESULT_WEBHOOK_URL requires RESULT_WEBHOOK_SECRET")
+		}
+		h.reporter = webhookReporter{url: webhookURL, secret: secret}
+	default:
+		return nil, errors.New("RESULT_QUEUE_URL or RESULT_WEBHOOK_URL must be set")
+	}
+	return h, nil
+}
+
+// handle processes every stream rendition in an S3 event. An error makes
+// Lambda retry the whole event, so it is only returned when the result
+// couldn't be reported; a failed extraction is reported like a success.
+func (h *handler) handle(ctx context.Context, requestID string, payload []byte) error {
+	var event s3Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		slog.Warn("Ignoring unreadable event", "error", err)
+		return nil
+	}
+	for i, record := range event.Records {
+		if !strings.HasPrefix(record.EventName, "ObjectCreated:") {
+			continue
+		}
+		// Keys arrive form encoded
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			slog.Warn("Ignoring malformed key", "key", record.S3.Object.Key, "error", err)
+			continue
+		}
+		name := requestID
+		if len(event.Records) > 1 {
+			name += "-" + strconv.Itoa(i)
+		}
+		if err := h.handleObject(ctx, record.S3.Bucket.Name, key, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *handler) handleObject(ctx context.Context, bucket, key, name string) error {
+	if strings.HasPrefix(key, h.prefix) {
+		return nil
+	}
+	tagging, err := h.s3Client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't get tags of %s: %w", key, err)
+	}
+	tags := map[string]string{}
+	for _, tag := range tagging.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	videoID, err := uuid.Parse(tags[tagVideoID])
+	if err != nil || tags[tagRendition] != renditionStream {
+		// Previews, originals and clips, or objects Tubely didn't write
+		return nil
+	}
+
+	result := posterResult{VideoID: videoID, Bucket: bucket, Key: key}
+	result.PosterKey, result.Timestamp, err = h.extract(ctx, bucket, key, videoID, name)
+	if err != nil {
+		slog.Error("Poster extraction failed", "key", key, "error", err)
+		result.Error = err.Error()
+	}
+	if err := h.reporter.report(ctx, result); err != nil {
+		return fmt.Errorf("couldn't report poster for %s: %w", key, err)
+	}
+	slog.Info("Reported poster", "video_id", videoID, "key", key, "poster_key", result.PosterKey)
+	return nil
+}
+
+// extract grabs the poster frame of the video at bucket/key the way the
+// server would and uploads it under the prefix.
+func (h *handler) extract(ctx context.Context, bucket, key string, videoID uuid.UUID, name string) (string, float64, error) {
+	presigned, err := s3.NewPresignClient(h.s3Client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(presignExpiry))
+	if err != nil {
+		return "", 0, fmt.Errorf("couldn't presign video: %w", err)
+	}
+
+	timestamp := posterTimestamp
+	if h.sceneSelection {
+		found, ok, err := h.ffmpeg.FindPoster(ctx, presigned.URL)
+		switch {
+		case err != nil:
+			slog.Warn("Poster frame selection failed, using the fixed offset", "error", err)
+		case ok:
+			timestamp = found
+		}
+	}
+
+	posterPath := filepath.Join(os.TempDir(), name+".jpg")
+	defer os.Remove(posterPath)
+	if err := h.ffmpeg.Poster(ctx, presigned.URL, posterPath, timestamp); err != nil {
+		return "", 0, err
+	}
+
+	f, err := os.Open(posterPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	posterKey := h.prefix + videoID.String() + "/" + name + ".jpg"
+	_, err = h.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(posterKey),
+		Body:        f,
+		ContentType: aws.String("image/jpeg"),
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("couldn't upload poster: %w", err)
+	}
+	return posterKey, timestamp, nil
+}
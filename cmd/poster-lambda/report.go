@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+const (
+	webhookAttempts = 5
+	// maxWebhookRetryDelay caps the server's Retry-After, which is meant
+	// for clients that aren't billed by the second
+	maxWebhookRetryDelay = 10 * time.Second
+)
+
+// reporter hands a result to the server.
+type reporter interface {
+	report(ctx context.Context, result posterResult) error
+}
+
+// queueReporter sends results to the queue the server consumes.
+// Results that arrive before the upload is committed are left on the
+// queue by the server until they can be applied.
+type queueReporter struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+func (q queueReporter) report(ctx context.Context, result posterResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// webhookReporter posts results to the server's poster webhook, and retries
+// while the server says the upload is still processing.
+type webhookReporter struct {
+	url    string
+	secret string
+}
+
+func (wh webhookReporter) report(ctx context.Context, result posterResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		retryAfter, err := wh.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if retryAfter < 0 || attempt == webhookAttempts {
+			break
+		}
+		select {
+		case <-time.After(min(retryAfter, maxWebhookRetryDelay)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return lastErr
+}
+
+// post makes one delivery attempt. retryAfter is negative when the error
+// is not worth retrying.
+func (wh webhookReporter) post(ctx context.Context, body []byte) (retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tubely-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Tubely-Signature", sign(wh.secret, timestamp, body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return time.Second, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode/100 == 2:
+		return 0, nil
+	case resp.StatusCode == http.StatusConflict || resp.StatusCode >= 500:
+		retryAfter = time.Second
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return retryAfter, fmt.Errorf("webhook returned %s", resp.Status)
+	default:
+		return -1, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+}
+
+// sign is the server's webhook signature: the hex HMAC-SHA256 of
+// "<timestamp>.<body>".
+func sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
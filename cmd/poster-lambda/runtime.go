@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// runtimeAPIVersion is the version of the Lambda runtime API custom
+// runtimes poll for invocations.
+const runtimeAPIVersion = "2018-06-01"
+
+// runtimeClient speaks the Lambda runtime API, which is all a custom
+// runtime needs: fetch the next event, then post its response or error.
+type runtimeClient struct {
+	base   string
+	client *http.Client
+}
+
+func newRuntimeClient(address string) *runtimeClient {
+	return &runtimeClient{
+		base: "http://" + address + "/" + runtimeAPIVersion + "/runtime",
+		// The next invocation call blocks until there is one
+		client: &http.Client{},
+	}
+}
+
+// serve handles invocations until the process is frozen or killed.
+func (c *runtimeClient) serve(handle func(ctx context.Context, requestID string, payload []byte) error) {
+	for {
+		resp, err := c.client.Get(c.base + "/invocation/next")
+		if err != nil {
+			slog.Error("Couldn't get next invocation", "error", err)
+			os.Exit(1)
+		}
+		payload, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			slog.Error("Couldn't read invocation", "error", err)
+			os.Exit(1)
+		}
+
+		requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		ctx := context.Background()
+		cancel := func() {}
+		if ms, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+			ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(ms))
+		}
+		err = handle(ctx, requestID, payload)
+		cancel()
+
+		if err != nil {
+			slog.Error("Invocation failed", "request_id", requestID, "error", err)
+			c.post("/invocation/"+requestID+"/error", errorPayload(err))
+			continue
+		}
+		c.post("/invocation/"+requestID+"/response", []byte("{}"))
+	}
+}
+
+// initError reports a failure to start, which Lambda shows in place of
+// every invocation's result.
+func (c *runtimeClient) initError(err error) {
+	slog.Error("Initialization failed", "error", err)
+	c.post("/init/error", errorPayload(err))
+}
+
+func (c *runtimeClient) post(path string, body []byte) {
+	resp, err := c.client.Post(c.base+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Couldn't reach the runtime API", "path", path, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		slog.Error("Runtime API rejected the call", "path", path, "status", resp.Status)
+	}
+}
+
+func errorPayload(err error) []byte {
+	payload, _ := json.Marshal(map[string]string{
+		"errorMessage": err.Error(),
+		"errorType":    fmt.Sprintf("%T", err),
+	})
+	return payload
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "Accept-Language", requestIDHeader, checksumHeader, "Range", "If-None-Match", "If-Modified-Since", idempotencyKeyHeader}
+	// corsExposedHeaders are response headers browser code may read
+	corsExposedHeaders = []string{requestIDHeader, "ETag", "Last-Modified", "Content-Range", "Content-Length", "Accept-Ranges", "Retry-After", "Idempotent-Replayed"}
+)
+
+const defaultCORSMaxAge = 10 * time.Minute
+
+// corsConfig holds the CORS policy. With no allowed origins the middleware
+// does nothing and only same-origin pages can call the API.
+type corsConfig struct {
+	// AllowedOrigins are exact origins ("https://app.example.com"),
+	// subdomain wildcards ("https://*.example.com") or "*"
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// validate rejects credentials with an "*" origin, which would let any
+// site make credentialed calls on behalf of the browser's user.
+func (c corsConfig) validate() error {
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return errors.New("CORS_ALLOW_CREDENTIALS can't be combined with CORS_ALLOWED_ORIGINS=*")
+	}
+	return nil
+}
+
+func (c corsConfig) allowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if scheme, host, ok := strings.Cut(allowed, "://*."); ok {
+			if rest, ok := strings.CutPrefix(origin, scheme+"://"); ok && strings.HasSuffix(rest, "."+host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// corsMiddleware adds CORS headers for allowed origins and answers
+// preflight requests itself, since the mux has no OPTIONS routes.
+func corsMiddleware(c corsConfig, next http.Handler) http.Handler {
+	if len(c.AllowedOrigins) == 0 {
+		return next
+	}
+	wildcard := slices.Contains(c.AllowedOrigins, "*")
+	methods := strings.Join(c.AllowedMethods, ", ")
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	exposed := strings.Join(corsExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(c.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin == "" || !c.allowsOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if wildcard {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", exposed)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !slices.Contains(c.AllowedMethods, strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", methods)
+		h.Set("Access-Control-Allow-Headers", headers)
+		h.Set("Access-Control-Max-Age", maxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
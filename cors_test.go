@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSConfigValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		wantErr     bool
+	}{
+		{"wildcard", []string{"*"}, false, false},
+		{"explicit origins with credentials", []string{"https://app.example.com", "https://*.example.com"}, true, false},
+		{"wildcard with credentials", []string{"https://app.example.com", "*"}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := corsConfig{AllowedOrigins: tt.origins, AllowCredentials: tt.credentials}.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewareOrigins(t *testing.T) {
+	tests := []struct {
+		name            string
+		cors            corsConfig
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{
+			name:       "wildcard",
+			cors:       corsConfig{AllowedOrigins: []string{"*"}},
+			origin:     "https://evil.example",
+			wantOrigin: "*",
+		},
+		{
+			name:            "allowed origin with credentials",
+			cors:            corsConfig{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true},
+			origin:          "https://app.example.com",
+			wantOrigin:      "https://app.example.com",
+			wantCredentials: "true",
+		},
+		{
+			name:   "other origin",
+			cors:   corsConfig{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true},
+			origin: "https://example.com.evil.example",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := corsMiddleware(tt.cors, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/videos", nil)
+			r.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin is %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials is %q, want %q", got, tt.wantCredentials)
+			}
+		})
+	}
+}
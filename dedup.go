@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// findDuplicateUpload returns another of the owner's videos whose upload
+// had the same SHA-256 and whose renditions can be shared, or a zero Video.
+// Chapters are embedded in the stream rendition, so both videos must have
+// the same chapter list.
+func (cfg *apiConfig) findDuplicateUpload(ctx context.Context, video database.Video, checksum string) (database.Video, error) {
+	duplicate, err := cfg.db.WithContext(ctx).FindVideoBySHA256(video.UserID, checksum, video.ID)
+	if err != nil || duplicate.VideoURL == nil {
+		return database.Video{}, err
+	}
+
+	ours, err := cfg.db.WithContext(ctx).GetChapters(video.ID)
+	if err != nil {
+		return database.Video{}, err
+	}
+	theirs, err := cfg.db.WithContext(ctx).GetChapters(duplicate.ID)
+	if err != nil {
+		return database.Video{}, err
+	}
+	if !sameChapters(ours, theirs) {
+		return database.Video{}, nil
+	}
+	return duplicate, nil
+}
+
+// shareRenditions points video at the S3 objects of duplicate. The objects
+// are reference counted through the video rows themselves, see
+// markObjectsSuperseded.
+func shareRenditions(video, duplicate database.Video) database.Video {
+	video.VideoURL = duplicate.VideoURL
+	video.PreviewURL = duplicate.PreviewURL
+	video.SDRVideoURL = duplicate.SDRVideoURL
+	video.OriginalURL = duplicate.OriginalURL
+	video.OriginalArchivedAt = duplicate.OriginalArchivedAt
+	video.Dimensions = duplicate.Dimensions
+	// Identical content gets the same moderation decision
+	video.ModerationStatus = duplicate.ModerationStatus
+	video.ModerationLabels = duplicate.ModerationLabels
+	video.ModerationReason = duplicate.ModerationReason
+	if video.ThumbnailURL == nil {
+		video.ThumbnailURL = duplicate.ThumbnailURL
+		video.ThumbnailPlaceholder = duplicate.ThumbnailPlaceholder
+		video.ThumbnailSourceURL = duplicate.ThumbnailSourceURL
+		video.ThumbnailCrop = duplicate.ThumbnailCrop
+		video.PosterTimestamp = duplicate.PosterTimestamp
+	}
+	return video
+}
+
+func sameChapters(a, b []database.Chapter) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Start != b[i].Start || a[i].Title != b[i].Title {
+			return false
+		}
+	}
+	return true
+}
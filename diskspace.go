@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// diskSpaceHeadroom is kept free on top of what an upload needs, so the
+// previews, posters and SQLite writes that follow still fit.
+const diskSpaceHeadroom = 256 << 20
+
+var errDiskUsageUnsupported = errors.New("disk usage not supported on this platform")
+
+// diskNeed is how many bytes a step will write into dir.
+type diskNeed struct {
+	Dir   string
+	Bytes uint64
+}
+
+// checkDiskSpace verifies every filesystem has room for the needs listed,
+// adding up needs for directories that share a filesystem.
+func checkDiskSpace(needs ...diskNeed) error {
+	type filesystem struct {
+		dir       string
+		available uint64
+		needed    uint64
+	}
+	byDevice := map[uint64]*filesystem{}
+	var order []uint64
+	for _, need := range needs {
+		available, device, err := diskUsage(need.Dir)
+		if errors.Is(err, errDiskUsageUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check free space in %s: %w", need.Dir, err)
+		}
+		fs, ok := byDevice[device]
+		if !ok {
+			fs = &filesystem{dir: need.Dir, available: available, needed: diskSpaceHeadroom}
+			byDevice[device] = fs
+			order = append(order, device)
+		}
+		fs.needed += need.Bytes
+	}
+	for _, device := range order {
+		fs := byDevice[device]
+		if fs.available < fs.needed {
+			return &insufficientStorageError{Dir: fs.dir, Available: fs.available, Needed: fs.needed}
+		}
+	}
+	return nil
+}
+
+type insufficientStorageError struct {
+	Dir       string
+	Available uint64
+	Needed    uint64
+}
+
+func (e *insufficientStorageError) Error() string {
+	return fmt.Sprintf("%s has %d bytes free, need %d", e.Dir, e.Available, e.Needed)
+}
+
+// ensureUploadDiskSpace checks that an upload of the request's declared
+// size fits before any of it is written: the multipart parser spools it to
+// the temp dir, it is copied into the staging dir, and faststart writes a
+// second copy next to it unless it streams to S3. It responds with 507 and
+// returns false when it won't fit.
+func (cfg *apiConfig) ensureUploadDiskSpace(w http.ResponseWriter, r *http.Request) bool {
+	size := uint64(max(r.ContentLength, 0))
+	staged := 2 * size
+	if cfg.streamingRemux {
+		staged = size
+	}
+	err := checkDiskSpace(
+		diskNeed{Dir: cfg.tempDir, Bytes: size},
+		diskNeed{Dir: cfg.stagingDir, Bytes: staged},
+	)
+	var insufficient *insufficientStorageError
+	switch {
+	case errors.As(err, &insufficient):
+		respondWithError(w, http.StatusInsufficientStorage, "Not enough disk space to process this upload", err)
+		return false
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check disk space", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// diskUsage isn't implemented on this platform, which disables the free
+// space check.
+func diskUsage(dir string) (available uint64, device uint64, err error) {
+	return 0, 0, errDiskUsageUnsupported
+}
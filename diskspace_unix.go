@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// diskUsage reports the bytes available to unprivileged users on the
+// filesystem holding dir, and an ID identifying that filesystem.
+func diskUsage(dir string) (available uint64, device uint64, err error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, 0, err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(fs.Bavail) * uint64(fs.Bsize), uint64(st.Dev), nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// videoTooLongError is a video longer than its owner may upload.
+type videoTooLongError struct {
+	duration float64
+	limit    time.Duration
+}
+
+func (e *videoTooLongError) Error() string {
+	return fmt.Sprintf("video is %.1fs long, over the %s limit", e.duration, e.limit)
+}
+
+// respondWithVideoTooLong answers 422 with the limit the video broke, if err
+// is a videoTooLongError, and reports whether it was.
+func respondWithVideoTooLong(w http.ResponseWriter, err error) bool {
+	var tooLong *videoTooLongError
+	if !errors.As(err, &tooLong) {
+		return false
+	}
+	respondWithErrorDetails(w, http.StatusUnprocessableEntity, "Video is too long", err, map[string]any{
+		"max_seconds":      tooLong.limit.Seconds(),
+		"duration_seconds": math.Round(tooLong.duration*10) / 10,
+	})
+	return true
+}
+
+// parseDurationTiers reads the VIDEO_DURATION_TIERS entries, each
+// name=duration with 0 for unlimited.
+func parseDurationTiers(entries []string) (map[string]time.Duration, error) {
+	tiers := make(map[string]time.Duration, len(entries))
+	for _, entry := range entries {
+		name, raw, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("tier %q must look like name=duration", entry)
+		}
+		limit, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("tier %q needs a duration such as 10m or 0 for unlimited", name)
+		}
+		tiers[name] = limit
+	}
+	return tiers, nil
+}
+
+// maxVideoDuration returns how long the user's videos may be, 0 meaning
+// unlimited. Users on a tier that is no longer configured get the default.
+func (cfg *apiConfig) maxVideoDuration(ctx context.Context, userID uuid.UUID) (time.Duration, error) {
+	tier, err := cfg.db.WithContext(ctx).GetUserTier(userID)
+	if err != nil {
+		return 0, err
+	}
+	if limit, ok := cfg.durationTiers[tier]; ok {
+		return limit, nil
+	}
+	return cfg.maxDuration, nil
+}
+
+// probeVideoLength probes the duration of the video at input, which the
+// job's priority and estimate go by, and checks it against the owner's
+// limit, returning a videoTooLongError if it is over. A video that can't be
+// probed has no duration and is left for processing to reject.
+func (cfg *apiConfig) probeVideoLength(ctx context.Context, userID uuid.UUID, input string) (*float64, error) {
+	limit, err := cfg.maxVideoDuration(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := cfg.prober.Duration(ctx, input)
+	if err != nil {
+		slog.Warn("Couldn't probe video duration", "error", err)
+		return nil, nil
+	}
+	if limit > 0 && duration > limit.Seconds() {
+		return &duration, &videoTooLongError{duration: duration, limit: limit}
+	}
+	return &duration, nil
+}
+
+type userTierParams struct {
+	// Tier is one of VIDEO_DURATION_TIERS, or null for the defaults
+	Tier *string `json:"tier"`
+}
+
+type userTierResponse struct {
+	UserID uuid.UUID `json:"user_id"`
+	userTierParams
+}
+
+// handlerAdminUserTierSet puts a user on one of the configured tiers.
+func (cfg *apiConfig) handlerAdminUserTierSet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	var params userTierParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	tier := ""
+	if params.Tier != nil {
+		tier = *params.Tier
+		if _, ok := cfg.durationTiers[tier]; !ok {
+			respondWithError(w, http.StatusBadRequest, "Unknown tier", fmt.Errorf("no tier %q", tier))
+			return
+		}
+	}
+
+	user, err := cfg.db.WithContext(r.Context()).GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+	if err := cfg.db.WithContext(r.Context()).SetUserTier(userID, tier); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set tier", err)
+		return
+	}
+	requestAudit(r).Set("tier", params.Tier)
+	respondWithJSON(w, http.StatusOK, userTierResponse{UserID: userID, userTierParams: params})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const usageMonthLayout = "2006-01"
+
+// monthBounds returns the start of t's UTC month and of the next one.
+func monthBounds(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// egressCap returns the user's monthly cap in bytes, 0 meaning unlimited.
+func (cfg *apiConfig) egressCap(ctx context.Context, userID uuid.UUID) (int64, error) {
+	own, err := cfg.db.WithContext(ctx).GetEgressCap(userID)
+	if err != nil {
+		return 0, err
+	}
+	if own != nil {
+		return *own, nil
+	}
+	return cfg.egressMonthlyCap, nil
+}
+
+// orgEgressCap is egressCap for an organization.
+func (cfg *apiConfig) orgEgressCap(org database.Organization) int64 {
+	if org.EgressCapBytes != nil {
+		return *org.EgressCapBytes
+	}
+	return cfg.egressMonthlyCap
+}
+
+// egressCapReached reports whether the video's owner, or its organization,
+// has been served as many bytes this month as their cap allows.
+func (cfg *apiConfig) egressCapReached(ctx context.Context, video database.Video) (bool, error) {
+	start, end := monthBounds(time.Now())
+	if video.OrgID != nil {
+		org, err := cfg.db.WithContext(ctx).GetOrganization(*video.OrgID)
+		if err != nil {
+			return false, err
+		}
+		limit := cfg.orgEgressCap(org)
+		if limit == 0 {
+			return false, nil
+		}
+		used, err := cfg.db.WithContext(ctx).GetOrgEgressTotal(*video.OrgID, start, end)
+		if err != nil {
+			return false, err
+		}
+		return used >= limit, nil
+	}
+
+	limit, err := cfg.egressCap(ctx, video.UserID)
+	if err != nil || limit == 0 {
+		return false, err
+	}
+	used, err := cfg.db.WithContext(ctx).GetUserEgressTotal(video.UserID, start, end)
+	if err != nil {
+		return false, err
+	}
+	return used >= limit, nil
+}
+
+// recordEgress counts bytes served of the video. Losing a count isn't worth
+// failing playback for, so errors are only logged.
+func (cfg *apiConfig) recordEgress(video database.Video, source string, bytes int64) {
+	if bytes <= 0 {
+		return
+	}
+	err := cfg.db.AddEgress(database.Egress{
+		UserID:  video.UserID,
+		OrgID:   video.OrgID,
+		VideoID: video.ID,
+		Day:     time.Now(),
+		Source:  source,
+		Bytes:   bytes,
+	})
+	if err != nil {
+		slog.Warn("Couldn't record egress", "video_id", video.ID, "source", source, "bytes", bytes, "error", err)
+	}
+}
+
+// respondWithEgressCapReached rejects a stream until the next month starts.
+func respondWithEgressCapReached(w http.ResponseWriter) {
+	_, next := monthBounds(time.Now())
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(next).Seconds())+1))
+	respondWithError(w, http.StatusTooManyRequests, "Monthly egress limit reached", nil)
+}
+
+type usageResponse struct {
+	Month       string `json:"month"`
+	EgressBytes int64  `json:"egress_bytes"`
+	// EgressCapBytes is nil when egress is unlimited
+	EgressCapBytes *int64                 `json:"egress_cap_bytes"`
+	Videos         []database.VideoEgress `json:"videos"`
+}
+
+// handlerUsage reports how many bytes of the caller's own videos were served
+// in a month, the current one unless ?month=YYYY-MM is given. Organization
+// videos count towards the organization's usage instead.
+func (cfg *apiConfig) handlerUsage(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	start, end, err := parseUsageMonth(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid month", err)
+		return
+	}
+
+	videos, err := cfg.db.WithContext(r.Context()).GetUserEgress(userID, start, end)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	limit, err := cfg.egressCap(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newUsageResponse(start, videos, limit))
+}
+
+// parseUsageMonth returns the bounds of the ?month=YYYY-MM, by default the
+// current month.
+func parseUsageMonth(r *http.Request) (time.Time, time.Time, error) {
+	month := time.Now()
+	if raw := r.URL.Query().Get("month"); raw != "" {
+		var err error
+		month, err = time.Parse(usageMonthLayout, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	start, end := monthBounds(month)
+	return start, end, nil
+}
+
+func newUsageResponse(start time.Time, videos []database.VideoEgress, limit int64) usageResponse {
+	resp := usageResponse{Month: start.Format(usageMonthLayout), Videos: videos}
+	for _, v := range videos {
+		resp.EgressBytes += v.Bytes
+	}
+	if limit > 0 {
+		resp.EgressCapBytes = &limit
+	}
+	return resp
+}
+
+type egressCapParams struct {
+	// MonthlyBytes is the user's own cap, 0 for unlimited, or null to use
+	// EGRESS_MONTHLY_CAP_MB again
+	MonthlyBytes *int64 `json:"monthly_bytes"`
+}
+
+type egressCapResponse struct {
+	UserID uuid.UUID `json:"user_id"`
+	egressCapParams
+}
+
+// handlerAdminEgressCapSet overrides the default egress cap for one user.
+func (cfg *apiConfig) handlerAdminEgressCapSet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	var params egressCapParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.MonthlyBytes != nil && *params.MonthlyBytes < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid egress cap", fmt.Errorf("%d bytes", *params.MonthlyBytes))
+		return
+	}
+
+	user, err := cfg.db.WithContext(r.Context()).GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+	if err := cfg.db.WithContext(r.Context()).SetEgressCap(userID, params.MonthlyBytes); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set egress cap", err)
+		return
+	}
+	requestAudit(r).Set("monthly_bytes", params.MonthlyBytes)
+	respondWithJSON(w, http.StatusOK, egressCapResponse{UserID: userID, egressCapParams: params})
+}
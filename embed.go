@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// maxEmbedDomains keeps the player's Content-Security-Policy header short.
+const maxEmbedDomains = 50
+
+var embedTemplate = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{if .OEmbedURL}}<link rel="alternate" type="application/json+oembed" href="{{.OEmbedURL}}" title="{{.Title}}">
+{{end}}{{range .Meta}}{{if eq .Attribute "name"}}<meta name="{{.Key}}" content="{{.Content}}">{{else}}<meta property="{{.Key}}" content="{{.Content}}">{{end}}
+{{end}}<style>html,body{margin:0;height:100%;background:#000}video{display:block;width:100%;height:100%;object-fit:contain}</style>
+</head>
+<body>
+<video controls playsinline preload="metadata" src="{{.VideoURL}}"{{if .PosterURL}} poster="{{.PosterURL}}"{{end}}></video>
+</body>
+</html>
+`))
+
+type embedPage struct {
+	Title     string
+	VideoURL  string
+	PosterURL string
+	// OEmbedURL and Meta describe public videos to link previews
+	OEmbedURL string
+	Meta      []socialMetaTag
+}
+
+type embedSettingsParams struct {
+	// AllowedDomains are the sites the player may be embedded on, each
+	// also allowing its subdomains. Empty allows any site.
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// parseEmbedDomain normalizes a host name like "Example.com." to
+// "example.com". Schemes, ports, paths and wildcards aren't allowed, since
+// subdomains are always included.
+func parseEmbedDomain(raw string) (string, error) {
+	domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(raw)), ".")
+	if domain == "" || len(domain) > 253 {
+		return "", fmt.Errorf("domain %q must be a host name", raw)
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") ||
+			strings.Trim(label, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+			return "", fmt.Errorf("domain %q must be a host name like example.com, without a scheme or path", raw)
+		}
+	}
+	return domain, nil
+}
+
+// handlerEmbedSettingsPut sets the sites the video's embed player works on.
+func (cfg *apiConfig) handlerEmbedSettingsPut(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	var params embedSettingsParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if len(params.AllowedDomains) > maxEmbedDomains {
+		respondWithError(w, http.StatusBadRequest, "Too many embed domains", fmt.Errorf("videos have at most %d", maxEmbedDomains))
+		return
+	}
+	var domains database.EmbedDomains
+	for _, raw := range params.AllowedDomains {
+		domain, err := parseEmbedDomain(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid embed domain", err)
+			return
+		}
+		if !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+
+	video.EmbedDomains = domains
+	if err := cfg.db.WithContext(r.Context()).UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+	requestAudit(r).Set("allowed_domains", domains)
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate URL", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+// embeddingSite is the host of the page embedding the player, from the
+// Origin header or else the Referer, or "" if the browser sent neither.
+func embeddingSite(r *http.Request) string {
+	for _, header := range []string{"Origin", "Referer"} {
+		if raw := r.Header.Get(header); raw != "" && raw != "null" {
+			if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+				return strings.ToLower(u.Hostname())
+			}
+		}
+	}
+	return ""
+}
+
+// embedAllowed reports whether the player may be shown on site. Videos
+// without embed domains may be embedded anywhere, otherwise site has to be
+// one of them or their subdomains.
+func embedAllowed(domains database.EmbedDomains, site string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	for _, domain := range domains {
+		if site == domain || strings.HasSuffix(site, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// embedFrameAncestors is the Content-Security-Policy frame-ancestors
+// source list for domains, which browsers enforce even when they send no
+// Referer.
+func embedFrameAncestors(domains database.EmbedDomains) string {
+	if len(domains) == 0 {
+		return "*"
+	}
+	sources := make([]string, 0, 2*len(domains))
+	for _, domain := range domains {
+		sources = append(sources, domain, "*."+domain)
+	}
+	return strings.Join(sources, " ")
+}
+
+// handlerEmbed serves a bare HTML5 player for the video, to put in an
+// iframe. Visibility and playback rules apply as for streaming, and if the
+// owner set embed domains the page has to be embedded on one of them.
+func (cfg *apiConfig) handlerEmbed(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok || !cfg.checkPlaybackRules(w, r, video) {
+		return
+	}
+	if !embedAllowed(video.EmbedDomains, embeddingSite(r)) {
+		respondWithError(w, http.StatusForbidden, "Embedding isn't allowed on this site", nil)
+		return
+	}
+	signed, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if signed.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no uploaded file", nil)
+		return
+	}
+
+	page := embedPage{Title: video.Title, VideoURL: *signed.VideoURL}
+	if video.ThumbnailURL != nil {
+		page.PosterURL = *video.ThumbnailURL
+	}
+	if videoAdvertised(video) {
+		page.OEmbedURL = oembedURL(cfg.baseURL(r), video.ID)
+		page.Meta = cfg.socialMetaTags(r, video)
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Security-Policy", "default-src 'none'; media-src * blob:; img-src * data:; style-src 'unsafe-inline'; frame-ancestors "+embedFrameAncestors(video.EmbedDomains))
+	// The page holds a presigned URL that expires
+	h.Set("Cache-Control", "no-store")
+	h.Set("Vary", "Origin, Referer")
+	annotateLog(w, "video_id", video.ID)
+	if err := embedTemplate.Execute(w, page); err != nil {
+		requestLogger(r).Warn("Couldn't render embed player", "video_id", video.ID, "error", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envBool reads an optional boolean variable, exiting on invalid values.
+func envBool(name string, def bool) bool {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Fatalf("%s must be a boolean: %v", name, err)
+	}
+	return v
+}
+
+// envInt reads an optional integer variable, exiting on invalid values.
+func envInt(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Fatalf("%s must be an integer: %v", name, err)
+	}
+	return v
+}
+
+// envDuration reads an optional Go duration ("90s", "15m"), exiting on
+// invalid values.
+func envDuration(name string, def time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Fatalf("%s must be a duration: %v", name, err)
+	}
+	return v
+}
+
+// envList reads an optional comma separated list, trimming whitespace and
+// dropping empty entries.
+func envList(name string, def []string) []string {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+)
+
+// errorResponse is the body of every JSON error. Code is stable across
+// releases and languages, so clients branch on it rather than on Error,
+// which is translated and may be reworded.
+type errorResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// Details are machine-readable facts about the error, such as the
+	// limit a request broke
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// statusErrorCodes are the codes of messages without one of their own,
+// usually internal failures whose wording is only meant for the logs.
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:                   "BAD_REQUEST",
+	http.StatusUnauthorized:                 "UNAUTHORIZED",
+	http.StatusForbidden:                    "FORBIDDEN",
+	http.StatusNotFound:                     "NOT_FOUND",
+	http.StatusConflict:                     "CONFLICT",
+	http.StatusRequestEntityTooLarge:        "PAYLOAD_TOO_LARGE",
+	http.StatusUnsupportedMediaType:         "UNSUPPORTED_MEDIA_TYPE",
+	http.StatusRequestedRangeNotSatisfiable: "RANGE_NOT_SATISFIABLE",
+	http.StatusTooManyRequests:              "RATE_LIMITED",
+	http.StatusServiceUnavailable:           "UNAVAILABLE",
+	http.StatusInsufficientStorage:          "INSUFFICIENT_STORAGE",
+}
+
+// errorCode returns the code for msg: its catalog code if it has one,
+// otherwise the generic code of the status.
+func errorCode(status int, msg string) string {
+	if code, ok := i18n.CodeForMessage(msg); ok {
+		return code
+	}
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	if status < 500 {
+		return "BAD_REQUEST"
+	}
+	return "INTERNAL_ERROR"
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/xml"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxFeedItems bounds the object lookups behind each feed request. Podcast
+// apps only show the newest episodes anyway.
+const maxFeedItems = 100
+
+// rssFeed is an RSS 2.0 document with the iTunes tags podcast apps read.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	// Self is the feed's own URL, which validators ask for
+	Self          rssAtomLink  `xml:"atom:link"`
+	LastBuildDate string       `xml:"lastBuildDate,omitempty"`
+	Image         *itunesImage `xml:"itunes:image"`
+	Items         []rssItem    `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Description string       `xml:"description,omitempty"`
+	Link        string       `xml:"link"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	// Duration is in whole seconds, left out until the upload is probed
+	Duration string       `xml:"itunes:duration,omitempty"`
+	Image    *itunesImage `xml:"itunes:image"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL string `xml:"url,attr"`
+	// Length is the file size in bytes, 0 when S3 couldn't tell
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// enclosureLength looks up the size of the video's stream rendition.
+func (cfg *apiConfig) enclosureLength(r *http.Request, video database.Video) int64 {
+	bucket, key, err := splitVideoURL(*video.VideoURL)
+	if err != nil {
+		return 0
+	}
+	head, err := cfg.s3Client.HeadObject(r.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		requestLogger(r).Warn("Couldn't size feed enclosure", "video_id", video.ID, "key", key, "error", err)
+		return 0
+	}
+	return aws.ToInt64(head.ContentLength)
+}
+
+// handlerUserFeed serves /feeds/{userID}.xml, an RSS feed of the user's
+// public videos for podcast apps and feed readers. Enclosures point at the
+// stream endpoint, which stays valid after presigned URLs would expire.
+func (cfg *apiConfig) handlerUserFeed(w http.ResponseWriter, r *http.Request) {
+	rawID, ok := strings.CutSuffix(r.PathValue("file"), ".xml")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	userID, err := uuid.Parse(rawID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	user, err := cfg.db.WithContext(r.Context()).GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+	videos, err := cfg.db.WithContext(r.Context()).GetVideos(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	base := cfg.baseURL(r)
+	feedURL := base + "/feeds/" + userID.String() + ".xml"
+	channel := rssChannel{
+		Title:       "Tubely videos",
+		Link:        feedURL,
+		Description: "Public videos published on Tubely",
+		Self:        rssAtomLink{Href: feedURL, Rel: "self", Type: "application/rss+xml"},
+		Items:       []rssItem{},
+	}
+	// Newest first, as GetVideos returns them
+	for _, video := range videos {
+		if !videoAdvertised(video) {
+			continue
+		}
+		if len(channel.Items) == maxFeedItems {
+			break
+		}
+		embedURL := base + "/embed/" + video.ID.String()
+		item := rssItem{
+			Title:       video.Title,
+			Description: video.Description,
+			Link:        embedURL,
+			GUID:        rssGUID{Value: "urn:uuid:" + video.ID.String()},
+			PubDate:     video.CreatedAt.UTC().Format(time.RFC1123Z),
+			Enclosure: rssEnclosure{
+				URL:    base + apiV1 + "/videos/" + video.ID.String() + "/stream",
+				Length: cfg.enclosureLength(r, video),
+				Type:   "video/mp4",
+			},
+		}
+		if video.Duration != nil {
+			item.Duration = strconv.Itoa(int(math.Round(*video.Duration)))
+		}
+		if video.ThumbnailURL != nil {
+			item.Image = &itunesImage{Href: *video.ThumbnailURL}
+			// The channel's artwork is its newest thumbnail
+			if channel.Image == nil {
+				channel.Image = item.Image
+			}
+		}
+		if channel.LastBuildDate == "" {
+			channel.LastBuildDate = item.PubDate
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	dat, err := xml.MarshalIndent(rssFeed{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: channel,
+	}, "", "  ")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't build feed", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	annotateLog(w, "user_id", userID, "feed_items", len(channel.Items))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(dat)
+}
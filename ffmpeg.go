@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// posterTimestamp is where the auto-generated thumbnail is taken from when
+// no better frame is found
+const posterTimestamp = 1.0
+
+// parseTimestamp accepts plain seconds ("90.5") or colon-separated
+// "HH:MM:SS(.ms)" / "MM:SS" timestamps.
+func parseTimestamp(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty timestamp")
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	var total float64
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		total = total*60 + v
+	}
+	return total, nil
+}
+
+// ffmetadataEscaper escapes the characters that are special in ffmetadata
+// values.
+var ffmetadataEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"=", `\=`,
+	";", `\;`,
+	"#", `\#`,
+	"\n", "\\\n",
+)
+
+// writeChapterMetadata writes chapters as an ffmetadata file that ffmpeg can
+// merge into the output with -map_chapters. Each chapter ends where the next
+// one starts, or at the end of the video; chapters starting past the end are
+// dropped.
+func writeChapterMetadata(path string, chapters []database.Chapter, duration float64) error {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for i, chapter := range chapters {
+		if chapter.Start >= duration {
+			break
+		}
+		end := duration
+		if i+1 < len(chapters) {
+			end = math.Min(chapters[i+1].Start, duration)
+		}
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(chapter.Start*1000), int64(end*1000), ffmetadataEscaper.Replace(chapter.Title))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0600)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type auditLogPage struct {
+	Entries []database.AuditEntry `json:"entries"`
+	// NextCursor fetches the next, older page, empty on the last one
+	NextCursor string `json:"next_cursor"`
+}
+
+// handlerAdminAuditLog pages through the audit log, newest first,
+// optionally filtered by actor_id, video_id, action and a since/until
+// window.
+func (cfg *apiConfig) handlerAdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := database.AuditFilter{
+		Action: query.Get("action"),
+		Limit:  defaultAdminListLimit,
+	}
+	if raw := query.Get("actor_id"); raw != "" {
+		actorID, err := uuid.Parse(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+			return
+		}
+		filter.ActorID = actorID
+	}
+	if raw := query.Get("video_id"); raw != "" {
+		videoID, err := uuid.Parse(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+			return
+		}
+		filter.VideoID = videoID
+	}
+	for name, dest := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := query.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid timestamp", err)
+				return
+			}
+			*dest = t
+		}
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		beforeID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || beforeID < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+			return
+		}
+		filter.BeforeID = beforeID
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxAdminListLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	// One extra row tells whether there is another page
+	limit := filter.Limit
+	filter.Limit++
+	entries, err := cfg.db.WithContext(r.Context()).ListAuditEntries(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list audit log", err)
+		return
+	}
+	page := auditLogPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = strconv.FormatInt(page.Entries[limit-1].ID, 10)
+	}
+	respondWithJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAdminListLimit = 50
+	maxAdminListLimit     = 500
+)
+
+// handlerAdminJobsList lists jobs, including their per-stage timings,
+// optionally filtered by video_id, kind and status query parameters.
+func (cfg *apiConfig) handlerAdminJobsList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := database.JobFilter{
+		Kind:   query.Get("kind"),
+		Status: query.Get("status"),
+		Limit:  defaultAdminListLimit,
+	}
+	if raw := query.Get("video_id"); raw != "" {
+		videoID, err := uuid.Parse(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+			return
+		}
+		filter.VideoID = videoID
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxAdminListLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	jobs, err := cfg.db.WithContext(r.Context()).ListJobs(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list jobs", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, jobs)
+}
+
+func (cfg *apiConfig) handlerAdminJobGet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID", err)
+		return
+	}
+
+	job, err := cfg.db.WithContext(r.Context()).GetJob(jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+		return
+	}
+	if job.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Job not found", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// getDeadLetteredJob loads the job in the path for an admin action that
+// only applies to dead-lettered jobs, responding with the error if it
+// can't.
+func (cfg *apiConfig) getDeadLetteredJob(w http.ResponseWriter, r *http.Request) (database.Job, bool) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return database.Job{}, false
+	}
+
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID", err)
+		return database.Job{}, false
+	}
+	job, err := cfg.db.WithContext(r.Context()).GetJob(jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+		return database.Job{}, false
+	}
+	if job.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Job not found", nil)
+		return database.Job{}, false
+	}
+	if job.Status != database.JobStatusDeadLettered {
+		respondWithError(w, http.StatusConflict, "Job is not dead-lettered", nil)
+		return database.Job{}, false
+	}
+	requestAudit(r).SetVideo(job.VideoID)
+	requestAudit(r).Set("kind", job.Kind)
+	return job, true
+}
+
+// handlerAdminJobRetry queues a dead-lettered job again with a fresh set of
+// attempts.
+func (cfg *apiConfig) handlerAdminJobRetry(w http.ResponseWriter, r *http.Request) {
+	job, ok := cfg.getDeadLetteredJob(w, r)
+	if !ok {
+		return
+	}
+
+	job.Status = database.JobStatusQueued
+	job.Attempts = 0
+	job.NextAttemptAt = nil
+	job.Error = nil
+	if err := cfg.db.WithContext(r.Context()).UpdateJob(job); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update job", err)
+		return
+	}
+	switch job.Kind {
+	case jobKindProcessVideo, jobKindImportVideo, jobKindIngestVideo:
+		if err := cfg.db.WithContext(r.Context()).SetVideoProcessingStatus(job.VideoID, database.ProcessingQueued); err != nil {
+			slog.Warn("Couldn't update processing status", "video_id", job.VideoID, "error", err)
+		}
+	}
+	cfg.enqueueJob(job)
+
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// handlerAdminJobDiscard gives up on a dead-lettered job: it's marked failed
+// and the files kept for a retry are deleted.
+func (cfg *apiConfig) handlerAdminJobDiscard(w http.ResponseWriter, r *http.Request) {
+	job, ok := cfg.getDeadLetteredJob(w, r)
+	if !ok {
+		return
+	}
+
+	job.Status = database.JobStatusFailed
+	if err := cfg.db.WithContext(r.Context()).UpdateJob(job); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update job", err)
+		return
+	}
+	cfg.discardJobInputs(job)
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// discardJobInputs deletes what a dead-lettered job kept to run again: the
+// staged upload and checkpointed renditions of a process_video job, or the
+// copy an import_video job works from.
+func (cfg *apiConfig) discardJobInputs(job database.Job) {
+	switch job.Kind {
+	case jobKindProcessVideo:
+		var params processVideoParams
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			slog.Warn("Couldn't read job parameters", "job_id", job.ID, "error", err)
+			return
+		}
+		os.Remove(params.StagingPath)
+		if job.Checkpoint == nil {
+			return
+		}
+		var checkpoint processVideoCheckpoint
+		if err := json.Unmarshal([]byte(*job.Checkpoint), &checkpoint); err != nil {
+			slog.Warn("Couldn't read job checkpoint", "job_id", job.ID, "error", err)
+			return
+		}
+		video, err := cfg.db.GetVideo(job.VideoID)
+		if err != nil {
+			slog.Warn("Couldn't get video", "job_id", job.ID, "video_id", job.VideoID, "error", err)
+			return
+		}
+		cfg.discardNewVideoUploads(video, checkpoint.apply(video))
+	case jobKindImportVideo:
+		var params importVideoJobParams
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			slog.Warn("Couldn't read job parameters", "job_id", job.ID, "error", err)
+			return
+		}
+		cfg.discardUploads("", params.VideoURL)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxModerationReasonLen = 1000
+
+// moderationEventData is the data of the moderation webhook events.
+type moderationEventData struct {
+	Status string  `json:"status"`
+	Reason *string `json:"reason,omitempty"`
+}
+
+// moderationResponse adds the classifier labels, which owners don't see, to
+// a video for admin review.
+type moderationResponse struct {
+	database.Video
+	ModerationLabels []string `json:"moderation_labels"`
+}
+
+func newModerationResponse(video database.Video) moderationResponse {
+	labels := []string{}
+	if video.ModerationLabels != "" {
+		labels = strings.Split(video.ModerationLabels, ",")
+	}
+	return moderationResponse{Video: video, ModerationLabels: labels}
+}
+
+// handlerAdminModerationQueue lists videos awaiting review, oldest first.
+// The status query parameter selects another moderation status instead,
+// e.g. to audit rejections.
+func (cfg *apiConfig) handlerAdminModerationQueue(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status == "" {
+		status = database.ModerationPending
+	}
+	limit := defaultAdminListLimit
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxAdminListLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+	}
+
+	videos, err := cfg.db.WithContext(r.Context()).ListVideosByModerationStatus(status, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	queue := make([]moderationResponse, 0, len(videos))
+	for _, video := range videos {
+		signed, err := cfg.dbVideoToSignedVideo(video)
+		if err != nil {
+			log.Printf("Couldn't sign video %s for review: %v", video.ID, err)
+			signed = video
+		}
+		queue = append(queue, newModerationResponse(signed))
+	}
+
+	respondWithJSON(w, http.StatusOK, queue)
+}
+
+type moderationSetParams struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// handlerAdminModerationSet records an admin's decision on a video, e.g.
+// releasing one the classifier held for review, and notifies the owner
+// through the webhooks. Rejections need a reason, which the owner can see.
+func (cfg *apiConfig) handlerAdminModerationSet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	var params moderationSetParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.Reason = strings.TrimSpace(params.Reason)
+
+	var eventType string
+	switch params.Status {
+	case database.ModerationApproved:
+		eventType = eventModerationApproved
+	case database.ModerationRejected:
+		if params.Reason == "" {
+			respondWithError(w, http.StatusBadRequest, "A reason is required to reject a video", nil)
+			return
+		}
+		eventType = eventModerationRejected
+	default:
+		respondWithError(w, http.StatusBadRequest, "Status must be approved or rejected", nil)
+		return
+	}
+	if len(params.Reason) > maxModerationReasonLen {
+		respondWithError(w, http.StatusBadRequest, "Reason is too long", nil)
+		return
+	}
+
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	video.ModerationStatus = params.Status
+	video.ModerationReason = nil
+	if params.Reason != "" {
+		video.ModerationReason = &params.Reason
+	}
+	if err := cfg.db.WithContext(r.Context()).UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
+		return
+	}
+	audit := requestAudit(r)
+	audit.Set("status", video.ModerationStatus)
+	audit.Set("reason", video.ModerationReason)
+
+	cfg.publishEvent(eventType, video.UserID, video.ID, moderationEventData{
+		Status: video.ModerationStatus,
+		Reason: video.ModerationReason,
+	})
+
+	respondWithJSON(w, http.StatusOK, newModerationResponse(video))
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultOverviewWindow = 24 * time.Hour
+	maxOverviewWindow     = 90 * 24 * time.Hour
+	defaultTopUploaders   = 10
+	maxTopUploaders       = 100
+	// recentFailedJobs is how many failed jobs the overview lists
+	recentFailedJobs = 20
+	// maxRecentServerErrors is how many 5XX responses are remembered
+	maxRecentServerErrors = 50
+)
+
+type overviewResponse struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// Since is the start of the window the rates and uploaders cover
+	Since        time.Time                `json:"since"`
+	Counts       database.SystemCounts    `json:"counts"`
+	Queue        queueOverview            `json:"queue"`
+	Jobs         []jobKindOverview        `json:"jobs"`
+	TopUploaders []database.UploaderStats `json:"top_uploaders"`
+	Errors       errorsOverview           `json:"recent_errors"`
+	// TempJanitor is what this process removed from the temp and staging
+	// directories since it started
+	TempJanitor janitorStats `json:"temp_janitor"`
+}
+
+type queueOverview struct {
+	// Queued, Running and DeadLettered count jobs of every kind in the
+	// database
+	Queued       int `json:"queued"`
+	Running      int `json:"running"`
+	DeadLettered int `json:"dead_lettered"`
+	// Backend is the JOB_QUEUE jobs are handed out through
+	Backend string `json:"backend"`
+	// Buffered are queued job IDs handed to this process's workers but not
+	// picked up yet, out of BufferCapacity; both are 0 with a shared queue
+	Buffered       int            `json:"buffered"`
+	BufferCapacity int            `json:"buffer_capacity"`
+	Transcodes     transcodeStats `json:"transcodes"`
+	// Lanes are the jobs of each priority running in this process, out of
+	// how many may
+	Lanes []laneOverview `json:"lanes"`
+}
+
+type jobKindOverview struct {
+	database.JobKindStats
+	// FailureRate is Failed out of the jobs that finished in the window,
+	// null if none did
+	FailureRate *float64 `json:"failure_rate"`
+}
+
+type errorsOverview struct {
+	FailedJobs []database.Job `json:"failed_jobs"`
+	// ServerErrors are the latest 5XX responses of this process, newest
+	// first. They don't survive a restart.
+	ServerErrors []serverError `json:"server_errors"`
+}
+
+// handlerAdminOverview sums up the state of the system for an ops
+// dashboard: table sizes, the processing queue, job failure rates and top
+// uploaders over the window query parameter, and recent errors.
+func (cfg *apiConfig) handlerAdminOverview(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	window := defaultOverviewWindow
+	if raw := query.Get("window"); raw != "" {
+		var err error
+		window, err = time.ParseDuration(raw)
+		if err != nil || window <= 0 || window > maxOverviewWindow {
+			respondWithError(w, http.StatusBadRequest, "Invalid window", err)
+			return
+		}
+	}
+	top := defaultTopUploaders
+	if raw := query.Get("top"); raw != "" {
+		var err error
+		top, err = strconv.Atoi(raw)
+		if err != nil || top < 1 || top > maxTopUploaders {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	buffered, bufferCapacity := cfg.jobs.buffered()
+	resp := overviewResponse{
+		GeneratedAt: now,
+		Since:       now.Add(-window),
+		Queue: queueOverview{
+			Backend:        cfg.jobQueueKind,
+			Buffered:       buffered,
+			BufferCapacity: bufferCapacity,
+			Transcodes:     transcodes.stats(),
+			Lanes:          cfg.jobLanes.snapshot(),
+		},
+		Jobs:        []jobKindOverview{},
+		TempJanitor: cfg.tempJanitor.snapshot(),
+	}
+
+	var err error
+	resp.Counts, err = cfg.db.WithContext(r.Context()).GetSystemCounts()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count records", err)
+		return
+	}
+	jobStats, err := cfg.db.WithContext(r.Context()).GetJobStats(resp.Since)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job stats", err)
+		return
+	}
+	for _, stats := range jobStats {
+		resp.Queue.Queued += stats.Queued
+		resp.Queue.Running += stats.Running
+		resp.Queue.DeadLettered += stats.DeadLettered
+		kind := jobKindOverview{JobKindStats: stats}
+		if finished := stats.Completed + stats.Failed; finished > 0 {
+			rate := float64(stats.Failed) / float64(finished)
+			kind.FailureRate = &rate
+		}
+		resp.Jobs = append(resp.Jobs, kind)
+	}
+	resp.TopUploaders, err = cfg.db.WithContext(r.Context()).GetTopUploaders(resp.Since, top)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get top uploaders", err)
+		return
+	}
+	resp.Errors.FailedJobs, err = cfg.db.WithContext(r.Context()).ListJobs(database.JobFilter{Status: database.JobStatusFailed, Limit: recentFailedJobs})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list jobs", err)
+		return
+	}
+	resp.Errors.ServerErrors = recentServerErrors.list()
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// serverError is a 5XX response, with the message and error it was
+// answered with.
+type serverError struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	RequestID string    `json:"request_id"`
+}
+
+// serverErrorLog keeps the latest server errors in a ring.
+type serverErrorLog struct {
+	mu      sync.Mutex
+	entries []serverError
+	next    int
+}
+
+var recentServerErrors = &serverErrorLog{entries: make([]serverError, 0, maxRecentServerErrors)}
+
+func (l *serverErrorLog) add(e serverError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, e)
+	} else {
+		l.entries[l.next] = e
+	}
+	l.next = (l.next + 1) % cap(l.entries)
+}
+
+// list returns the entries newest first.
+func (l *serverErrorLog) list() []serverError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]serverError, 0, len(l.entries))
+	for i := 1; i <= len(l.entries); i++ {
+		list = append(list, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return list
+}
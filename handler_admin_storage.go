@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// storageReportTTL is how long a storage report is served before the bucket
+// is listed again. Listing a large bucket takes a while.
+const storageReportTTL = 10 * time.Minute
+
+type storageUsage struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+func (u *storageUsage) add(bytes int64) {
+	u.Objects++
+	u.Bytes += bytes
+}
+
+type bucketUsage struct {
+	Bucket string `json:"bucket"`
+	storageUsage
+	ByStorageClass map[string]storageUsage `json:"by_storage_class"`
+	// ByPrefix groups objects by the first segment of their key
+	ByPrefix map[string]storageUsage `json:"by_prefix"`
+}
+
+type storageReport struct {
+	ComputedAt time.Time   `json:"computed_at"`
+	S3         bucketUsage `json:"s3"`
+	// Assets are the thumbnails and other files in ASSETS_ROOT
+	Assets storageUsage `json:"assets"`
+	// Staging are uploads waiting in STAGING_DIR to be processed
+	Staging storageUsage `json:"staging"`
+}
+
+// storageReportCache holds the latest report. Its lock is held while one
+// is computed, so concurrent requests wait for that one rather than
+// listing the bucket again.
+type storageReportCache struct {
+	mu     sync.Mutex
+	report *storageReport
+}
+
+// handlerAdminStorage reports the bytes stored in S3 and on local disk.
+// Reports are cached for storageReportTTL; refresh=true computes a new one.
+func (cfg *apiConfig) handlerAdminStorage(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	cache := cfg.storageReports
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.report == nil || r.URL.Query().Get("refresh") == "true" || time.Since(cache.report.ComputedAt) > storageReportTTL {
+		report, err := cfg.computeStorageReport(r.Context())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't compute storage usage", err)
+			return
+		}
+		cache.report = &report
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, cache.report)
+}
+
+func (cfg *apiConfig) computeStorageReport(ctx context.Context) (storageReport, error) {
+	report := storageReport{
+		ComputedAt: time.Now().UTC(),
+		S3: bucketUsage{
+			Bucket:         cfg.s3Bucket,
+			ByStorageClass: map[string]storageUsage{},
+			ByPrefix:       map[string]storageUsage{},
+		},
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(cfg.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(cfg.s3Bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return storageReport{}, fmt.Errorf("couldn't list bucket: %w", err)
+		}
+		for _, obj := range page.Contents {
+			size := aws.ToInt64(obj.Size)
+			report.S3.add(size)
+
+			class := string(obj.StorageClass)
+			if class == "" {
+				class = "STANDARD"
+			}
+			usage := report.S3.ByStorageClass[class]
+			usage.add(size)
+			report.S3.ByStorageClass[class] = usage
+
+			prefix, _, _ := strings.Cut(aws.ToString(obj.Key), "/")
+			usage = report.S3.ByPrefix[prefix]
+			usage.add(size)
+			report.S3.ByPrefix[prefix] = usage
+		}
+	}
+
+	var err error
+	if report.Assets, err = dirUsage(cfg.assetsRoot); err != nil {
+		return storageReport{}, fmt.Errorf("couldn't measure assets: %w", err)
+	}
+	if report.Staging, err = dirUsage(cfg.stagingDir); err != nil {
+		return storageReport{}, fmt.Errorf("couldn't measure staging: %w", err)
+	}
+	return report, nil
+}
+
+// dirUsage adds up the regular files under dir, which may not exist.
+func dirUsage(dir string) (storageUsage, error) {
+	var usage storageUsage
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// Removed since the directory was read
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		usage.add(info.Size())
+		return nil
+	})
+	return usage, err
+}
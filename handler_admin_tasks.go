@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+)
+
+func (cfg *apiConfig) handlerAdminArchiveOriginals(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	result, err := cfg.archiveOriginals(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't archive originals", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type webhookDeliveryPage struct {
+	Deliveries []database.WebhookDelivery `json:"deliveries"`
+	// NextCursor fetches the next, older page, empty on the last one
+	NextCursor string `json:"next_cursor"`
+}
+
+// handlerAdminWebhookDeliveries pages through webhook delivery attempts,
+// newest first, optionally filtered by event_id, event_type, url and
+// failed=true.
+func (cfg *apiConfig) handlerAdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := database.WebhookDeliveryFilter{
+		EventType: query.Get("event_type"),
+		URL:       query.Get("url"),
+		Failed:    query.Get("failed") == "true",
+		Limit:     defaultAdminListLimit,
+	}
+	if raw := query.Get("event_id"); raw != "" {
+		eventID, err := uuid.Parse(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid event ID", err)
+			return
+		}
+		filter.EventID = eventID
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		beforeID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || beforeID < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+			return
+		}
+		filter.BeforeID = beforeID
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxAdminListLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	// One extra row tells whether there is another page
+	limit := filter.Limit
+	filter.Limit++
+	deliveries, err := cfg.db.WithContext(r.Context()).ListWebhookDeliveries(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list webhook deliveries", err)
+		return
+	}
+	page := webhookDeliveryPage{Deliveries: deliveries}
+	if len(deliveries) > limit {
+		page.Deliveries = deliveries[:limit]
+		page.NextCursor = strconv.FormatInt(page.Deliveries[limit-1].ID, 10)
+	}
+	respondWithJSON(w, http.StatusOK, page)
+}
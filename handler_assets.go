@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how much of an asset without a recorded type is read to
+// detect one, as much as http.DetectContentType looks at.
+const sniffLen = 512
+
+// handlerAsset serves a file from ASSETS_ROOT. Only plain files directly in
+// it are served, never anything a name with separators, a leading dot or a
+// symlink could reach. The Content-Type is the one recorded when the asset
+// was saved, and browsers are told not to guess another. Range and
+// conditional requests are answered by http.ServeContent. With
+// ASSETS_REQUIRE_AUTH, assets of private or held videos are only served to
+// those who may see one of the videos using them.
+func (cfg *apiConfig) handlerAsset(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !isAssetName(name) {
+		respondWithError(w, http.StatusNotFound, "Asset not found", nil)
+		return
+	}
+	asset, err := cfg.db.WithContext(r.Context()).GetAsset(name)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	restricted := false
+	if cfg.assetsRequireAuth {
+		// Files no video claims can't be checked, so they aren't served
+		if asset == nil || asset.VideoID == nil {
+			respondWithError(w, http.StatusNotFound, "Asset not found", nil)
+			return
+		}
+		// Trims, clips and duplicates share the thumbnail of the video it
+		// was saved for, and may be visible when that one isn't
+		videos, err := cfg.db.WithContext(r.Context()).GetVideosUsingAsset(name)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error", err)
+			return
+		}
+		visible := false
+		restricted = true
+		for _, video := range videos {
+			if cfg.videoVisibleTo(r, video) {
+				visible = true
+				restricted = restricted && videoRestricted(video)
+			}
+		}
+		if !visible {
+			respondWithError(w, http.StatusNotFound, "Asset not found", nil)
+			return
+		}
+	}
+
+	assetPath := filepath.Join(cfg.assetsRoot, name)
+	if info, err := os.Lstat(assetPath); err != nil || !info.Mode().IsRegular() {
+		respondWithError(w, http.StatusNotFound, "Asset not found", nil)
+		return
+	}
+	f, err := os.Open(assetPath)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Asset not found", err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read asset", err)
+		return
+	}
+
+	var contentType string
+	if asset != nil && asset.ContentType != nil {
+		contentType = *asset.ContentType
+	} else {
+		contentType, err = sniffAssetType(f)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't read asset", err)
+			return
+		}
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	h.Set("ETag", fileETag(info))
+	if restricted {
+		// Whether the next requester may see it is checked again
+		h.Set("Cache-Control", "private, no-cache")
+	} else {
+		h.Set("Cache-Control", cfg.cachePolicy[assetType(contentType)])
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// isAssetName reports whether name can only be a file directly in
+// ASSETS_ROOT, and not a hidden one.
+func isAssetName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, "/\\\x00") && filepath.IsLocal(name)
+}
+
+// sniffAssetType detects the type of an asset saved before types were
+// recorded, from its content. Only image and video types are trusted;
+// anything else, such as HTML, is served as an opaque download.
+func sniffAssetType(f *os.File) (string, error) {
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	contentType := http.DetectContentType(buf[:n])
+	if strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/") {
+		return contentType, nil
+	}
+	return "application/octet-stream", nil
+}
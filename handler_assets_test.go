@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// setupSharedThumbnail gives source a thumbnail saved for it and copy the
+// same file under another base URL, as a trim made through another host
+// would have.
+func setupSharedThumbnail(t *testing.T, cfg *apiConfig) (source, copy database.Video, name string) {
+	t.Helper()
+	name = "shared.png"
+	if err := os.WriteFile(filepath.Join(cfg.assetsRoot, name), []byte("png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source = createTestVideo(t, cfg, "talk")
+	copy = createTestVideo(t, cfg, "talk (trimmed)")
+	sourceURL := "http://localhost:8091/assets/" + name
+	copyURL := "https://tubely.example.com/assets/" + name
+	source.ThumbnailURL = &sourceURL
+	copy.ThumbnailURL = &copyURL
+	for _, video := range []database.Video{source, copy} {
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cfg.recordAsset(name, source.ID); err != nil {
+		t.Fatal(err)
+	}
+	return source, copy, name
+}
+
+func assetOwner(t *testing.T, cfg *apiConfig, name string) *uuid.UUID {
+	t.Helper()
+	asset, err := cfg.db.GetAsset(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset == nil {
+		return nil
+	}
+	if asset.VideoID == nil {
+		t.Fatalf("asset %s has no video", name)
+	}
+	return asset.VideoID
+}
+
+func TestDeleteVideoHandsSharedAssetOver(t *testing.T) {
+	cfg, _, _ := newTestConfig(t)
+	source, copy, name := setupSharedThumbnail(t, cfg)
+
+	if err := cfg.db.DeleteVideo(source.ID); err != nil {
+		t.Fatal(err)
+	}
+	if owner := assetOwner(t, cfg, name); owner == nil || *owner != copy.ID {
+		t.Fatalf("asset belongs to %v, want the copy %s", owner, copy.ID)
+	}
+
+	if err := cfg.db.DeleteVideo(copy.ID); err != nil {
+		t.Fatal(err)
+	}
+	if owner := assetOwner(t, cfg, name); owner != nil {
+		t.Errorf("asset still belongs to %s after its last video was deleted", owner)
+	}
+}
+
+func TestDeleteAccountHandsSharedAssetOver(t *testing.T) {
+	cfg, _, _ := newTestConfig(t)
+	source, copy, name := setupSharedThumbnail(t, cfg)
+
+	if _, err := cfg.db.DeleteAccount(source.UserID, database.CreateJobParams{UserID: source.UserID, Kind: jobKindPurgeAccount}); err != nil {
+		t.Fatal(err)
+	}
+	if owner := assetOwner(t, cfg, name); owner == nil || *owner != copy.ID {
+		t.Fatalf("asset belongs to %v, want the copy %s", owner, copy.ID)
+	}
+}
+
+func TestHandlerAssetSharedThumbnail(t *testing.T) {
+	cfg, _, _ := newTestConfig(t)
+	cfg.assetsRequireAuth = true
+	source, copy, name := setupSharedThumbnail(t, cfg)
+
+	get := func() int {
+		r := httptest.NewRequest(http.MethodGet, "/assets/"+name, nil)
+		r.SetPathValue("name", name)
+		w := httptest.NewRecorder()
+		cfg.handlerAsset(w, r)
+		return w.Code
+	}
+	setVisibility := func(video database.Video, visibility string) {
+		video.Visibility = visibility
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The private source doesn't hide the public copy's thumbnail
+	setVisibility(source, database.VisibilityPrivate)
+	if code := get(); code != http.StatusOK {
+		t.Errorf("public copy: got %d, want 200", code)
+	}
+
+	setVisibility(copy, database.VisibilityPrivate)
+	if code := get(); code != http.StatusNotFound {
+		t.Errorf("all private: got %d, want 404", code)
+	}
+
+	// Nor does purging the source from under it
+	setVisibility(copy, database.VisibilityPublic)
+	if err := cfg.db.DeleteVideo(source.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(); code != http.StatusOK {
+		t.Errorf("source deleted: got %d, want 200", code)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxChapters        = 100
+	maxChapterTitleLen = 200
+)
+
+type chapterInput struct {
+	Start string `json:"start"`
+	Title string `json:"title"`
+}
+
+type chaptersParams struct {
+	Chapters []chapterInput `json:"chapters"`
+}
+
+func (cfg *apiConfig) handlerChaptersGet(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !cfg.videoVisibleTo(r, video) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	chapters, err := cfg.db.WithContext(r.Context()).GetChapters(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chapters", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chapters)
+}
+
+func (cfg *apiConfig) handlerChaptersPut(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := chaptersParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if len(params.Chapters) > maxChapters {
+		respondWithError(w, http.StatusBadRequest,
+			fmt.Sprintf("A video can have at most %d chapters", maxChapters), nil)
+		return
+	}
+
+	chapters := make([]database.Chapter, 0, len(params.Chapters))
+	seen := make(map[float64]bool, len(params.Chapters))
+	for i, p := range params.Chapters {
+		start, err := parseTimestamp(p.Start)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid start for chapter %d", i+1), err)
+			return
+		}
+		title := strings.TrimSpace(p.Title)
+		if title == "" || len(title) > maxChapterTitleLen {
+			respondWithError(w, http.StatusBadRequest,
+				fmt.Sprintf("Chapter %d needs a title of at most %d characters", i+1, maxChapterTitleLen), nil)
+			return
+		}
+		if seen[start] {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Duplicate chapter start %s", p.Start), nil)
+			return
+		}
+		seen[start] = true
+		chapters = append(chapters, database.Chapter{VideoID: video.ID, Start: start, Title: title})
+	}
+
+	if err := cfg.db.WithContext(r.Context()).ReplaceChapters(video.ID, chapters); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save chapters", err)
+		return
+	}
+
+	saved, err := cfg.db.WithContext(r.Context()).GetChapters(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chapters", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, saved)
+}
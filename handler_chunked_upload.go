@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+	"github.com/google/uuid"
+)
+
+const (
+	// S3 requires every part except the last to be at least 5MB, and
+	// numbers parts 1 to 10000
+	minChunkBytes = 5 << 20
+	maxChunks     = 10000
+	// maxChunkBytes bounds the temp file a chunk is spooled to
+	maxChunkBytes = 100 << 20
+	// chunkedUploadPrefix holds assembled uploads until their ingest job
+	// copies them into place. It is outside INGEST_PREFIX so the ingest
+	// consumer doesn't pick them up a second time.
+	chunkedUploadPrefix = "chunked-uploads/"
+)
+
+type chunkedUploadParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	// Size is the whole file's, if known, so an upload that is too large is
+	// refused before any of it is sent
+	Size int64 `json:"size,omitempty"`
+}
+
+type chunkedUploadResponse struct {
+	database.ChunkedUpload
+	// Chunks are those received so far, only listed by getChunkedUpload
+	Chunks        []uploadedChunk `json:"chunks,omitempty"`
+	MinChunkBytes int64           `json:"min_chunk_bytes"`
+	MaxChunkBytes int64           `json:"max_chunk_bytes"`
+	MaxChunks     int             `json:"max_chunks"`
+	MaxBytes      int64           `json:"max_bytes"`
+}
+
+func newChunkedUploadResponse(upload database.ChunkedUpload, chunks []uploadedChunk) chunkedUploadResponse {
+	return chunkedUploadResponse{
+		ChunkedUpload: upload,
+		Chunks:        chunks,
+		MinChunkBytes: minChunkBytes,
+		MaxChunkBytes: maxChunkBytes,
+		MaxChunks:     maxChunks,
+		MaxBytes:      maxVideoUploadBytes,
+	}
+}
+
+type uploadedChunk struct {
+	Number int32 `json:"number"`
+	Size   int64 `json:"size"`
+	// ChecksumSHA256 is the base64 SHA-256 digest of the chunk
+	ChecksumSHA256 string `json:"checksum_sha256"`
+}
+
+// handlerChunkedUploadInit starts an upload of the video's file in chunks,
+// backed by an S3 multipart upload. Clients that can't send a large file in
+// one request, or want to resume after a dropped connection, use it instead
+// of handlerUploadVideo.
+func (cfg *apiConfig) handlerChunkedUploadInit(w http.ResponseWriter, r *http.Request) {
+	var params chunkedUploadParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	// getOwnedVideo reads the video from the path
+	r.SetPathValue("videoID", params.VideoID.String())
+	video, userID, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	annotateLog(w, "user_id", userID, "video_id", video.ID)
+	requestAudit(r).SetVideo(video.ID)
+	if params.Size > maxVideoUploadBytes {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large", fmt.Errorf("%d bytes declared", params.Size))
+		return
+	}
+
+	const contentType = "video/mp4"
+	uploadID := uuid.New()
+	key := fmt.Sprintf("%s%s/%s.mp4", chunkedUploadPrefix, userID, uploadID)
+	tags := objectKeyParams{UserID: video.UserID, OrgID: video.OrgID, VideoID: video.ID}.tags(contentType)
+	s3UploadID, abort, err := cfg.startMultipartUpload(r.Context(), key, contentType, tags)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start upload", err)
+		return
+	}
+	upload, err := cfg.db.WithContext(r.Context()).CreateChunkedUpload(uploadID, database.CreateChunkedUploadParams{
+		UserID:     userID,
+		VideoID:    video.ID,
+		ObjectKey:  key,
+		S3UploadID: aws.ToString(s3UploadID),
+	})
+	if err != nil {
+		abort()
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+	requestAudit(r).Set("upload_id", upload.ID)
+
+	respondWithJSON(w, http.StatusCreated, newChunkedUploadResponse(upload, nil))
+}
+
+// handlerChunkedUploadChunk stores the body as chunk {n} of the upload.
+// Sending a chunk again replaces it, so a chunk that failed midway can
+// simply be retried.
+func (cfg *apiConfig) handlerChunkedUploadChunk(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.getOwnedChunkedUpload(w, r)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 1 || n > maxChunks {
+		respondWithError(w, http.StatusBadRequest, "Invalid chunk number", err)
+		return
+	}
+	if upload.Status != database.ChunkedUploadOpen {
+		respondNotOpen(w, upload)
+		return
+	}
+
+	// Spooled first: S3 needs the length and checksum before the part
+	// is sent, and a retry needs the bytes again
+	f, err := os.CreateTemp(cfg.tempDir, "tubely-chunk-*")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create temp file", err)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), http.MaxBytesReader(w, r.Body, maxChunkBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Chunk is too large", err)
+		return
+	}
+	if errors.Is(err, errUploadTooSlow) {
+		respondWithError(w, http.StatusRequestTimeout, "Upload is too slow", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read chunk", err)
+		return
+	}
+	if size == 0 {
+		respondWithError(w, http.StatusBadRequest, "Chunk is empty", nil)
+		return
+	}
+
+	checksum := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	_, _, err = cfg.uploadPartWithRetry(r.Context(), f, upload.ObjectKey, aws.String(upload.S3UploadID), int32(n), 0, size, checksum)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't upload chunk", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, uploadedChunk{Number: int32(n), Size: size, ChecksumSHA256: checksum})
+}
+
+// handlerGetChunkedUpload returns the upload with the chunks received so
+// far, for a client resuming it to see which are missing.
+func (cfg *apiConfig) handlerGetChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.getOwnedChunkedUpload(w, r)
+	if !ok {
+		return
+	}
+	var chunks []uploadedChunk
+	if upload.Status == database.ChunkedUploadOpen {
+		parts, err := cfg.listChunkParts(r.Context(), upload)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't list chunks", err)
+			return
+		}
+		chunks = make([]uploadedChunk, 0, len(parts))
+		for _, part := range parts {
+			chunks = append(chunks, uploadedChunk{
+				Number:         aws.ToInt32(part.PartNumber),
+				Size:           aws.ToInt64(part.Size),
+				ChecksumSHA256: aws.ToString(part.ChecksumSHA256),
+			})
+		}
+	}
+	respondWithJSON(w, http.StatusOK, newChunkedUploadResponse(upload, chunks))
+}
+
+// handlerChunkedUploadComplete assembles chunks 1 to N into one object with
+// CompleteMultipartUpload and queues an ingest_video job that checks it
+// and makes it the video's new upload. If chunks are missing the upload
+// stays open for them.
+func (cfg *apiConfig) handlerChunkedUploadComplete(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.getOwnedChunkedUpload(w, r)
+	if !ok {
+		return
+	}
+	requestAudit(r).SetVideo(upload.VideoID)
+
+	claimed, err := cfg.db.WithContext(r.Context()).ClaimChunkedUpload(upload.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update upload", err)
+		return
+	}
+	if !claimed {
+		respondNotOpen(w, upload)
+		return
+	}
+	release := func() {
+		if err := cfg.db.WithContext(context.WithoutCancel(r.Context())).ReleaseChunkedUpload(upload.ID); err != nil {
+			slog.Error("Couldn't reopen chunked upload", "upload_id", upload.ID, "error", err)
+		}
+	}
+
+	parts, err := cfg.listChunkParts(r.Context(), upload)
+	if err != nil {
+		release()
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list chunks", err)
+		return
+	}
+	if len(parts) == 0 {
+		release()
+		respondWithError(w, http.StatusBadRequest, "Chunks are missing", nil)
+		return
+	}
+	completed := make([]types.CompletedPart, 0, len(parts))
+	var total int64
+	for i, part := range parts {
+		number := aws.ToInt32(part.PartNumber)
+		if number != int32(i+1) {
+			release()
+			respondWithError(w, http.StatusBadRequest, "Chunks are missing", fmt.Errorf("chunk %d follows chunk %d", number, i))
+			return
+		}
+		size := aws.ToInt64(part.Size)
+		if size < minChunkBytes && i < len(parts)-1 {
+			release()
+			respondWithError(w, http.StatusBadRequest, "Chunk is too small", fmt.Errorf("chunk %d has %d bytes", number, size))
+			return
+		}
+		total += size
+		completed = append(completed, types.CompletedPart{
+			ETag:           part.ETag,
+			PartNumber:     part.PartNumber,
+			ChecksumSHA256: part.ChecksumSHA256,
+		})
+	}
+	if total > maxVideoUploadBytes {
+		release()
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large", fmt.Errorf("%d bytes uploaded", total))
+		return
+	}
+
+	if err := cfg.completeMultipartUpload(r.Context(), upload.ObjectKey, aws.String(upload.S3UploadID), completed); err != nil {
+		release()
+		respondWithError(w, http.StatusInternalServerError, "Couldn't assemble upload", err)
+		return
+	}
+	// The parts are gone now, so the upload can't be reopened, and queueing
+	// its object goes ahead even if the client hangs up
+	ctx := context.WithoutCancel(r.Context())
+	job, err := cfg.queueIngestJob(ctx, upload.UserID, upload.VideoID, upload.ObjectKey)
+	if err != nil {
+		cfg.deleteObject(upload.ObjectKey)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue processing", err)
+		return
+	}
+	if err := cfg.db.WithContext(ctx).FinishChunkedUpload(upload.ID, job.ID); err != nil {
+		slog.Warn("Couldn't record chunked upload job", "upload_id", upload.ID, "job_id", job.ID, "error", err)
+	}
+	requestAudit(r).Set("upload_id", upload.ID)
+	requestAudit(r).Set("bytes", total)
+
+	respondWithJSON(w, http.StatusAccepted, newJobResponse(i18n.FromContext(r.Context()), job))
+}
+
+// handlerChunkedUploadAbort cancels an open upload and discards the chunks
+// received so far.
+func (cfg *apiConfig) handlerChunkedUploadAbort(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.getOwnedChunkedUpload(w, r)
+	if !ok {
+		return
+	}
+	requestAudit(r).SetVideo(upload.VideoID)
+	requestAudit(r).Set("upload_id", upload.ID)
+
+	aborted, err := cfg.db.WithContext(r.Context()).AbortChunkedUpload(upload.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update upload", err)
+		return
+	}
+	if !aborted {
+		respondNotOpen(w, upload)
+		return
+	}
+	// The upload stays tracked if this fails, so the cleanup aborts it
+	// later
+	if err := cfg.abortMultipartUpload(r.Context(), upload.ObjectKey, upload.S3UploadID); err != nil {
+		slog.Warn("Couldn't abort multipart upload", "upload_id", upload.ID, "error", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondNotOpen answers a request that needs an open upload, for one that
+// is completing, completed or aborted.
+func respondNotOpen(w http.ResponseWriter, upload database.ChunkedUpload) {
+	if upload.Status == database.ChunkedUploadAborted {
+		respondWithError(w, http.StatusGone, "Upload was aborted", nil)
+		return
+	}
+	respondWithError(w, http.StatusConflict, "Upload is already completed", nil)
+}
+
+// getOwnedChunkedUpload resolves the {uploadID} path value and checks the
+// caller started the upload. If either fails the error response has
+// already been written and ok is false.
+func (cfg *apiConfig) getOwnedChunkedUpload(w http.ResponseWriter, r *http.Request) (upload database.ChunkedUpload, ok bool) {
+	uploadID, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload ID", err)
+		return database.ChunkedUpload{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.ChunkedUpload{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid JWT", err)
+		return database.ChunkedUpload{}, false
+	}
+
+	upload, err = cfg.db.WithContext(r.Context()).GetChunkedUpload(uploadID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return database.ChunkedUpload{}, false
+	}
+	if upload.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Upload not found", nil)
+		return database.ChunkedUpload{}, false
+	}
+	if upload.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized access", nil)
+		return database.ChunkedUpload{}, false
+	}
+	annotateLog(w, "user_id", userID, "video_id", upload.VideoID, "upload_id", upload.ID)
+	return upload, true
+}
+
+// listChunkParts returns the upload's parts in S3, by part number.
+func (cfg *apiConfig) listChunkParts(ctx context.Context, upload database.ChunkedUpload) ([]types.Part, error) {
+	var parts []types.Part
+	paginator := s3.NewListPartsPaginator(cfg.s3Client, &s3.ListPartsInput{
+		Bucket:   aws.String(cfg.s3Bucket),
+		Key:      aws.String(upload.ObjectKey),
+		UploadId: aws.String(upload.S3UploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, page.Parts...)
+	}
+	return parts, nil
+}
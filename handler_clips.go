@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+)
+
+const (
+	jobKindClip = "clip"
+
+	maxClipDuration     = 60.0
+	maxAnimatedDuration = 15.0
+)
+
+var clipContentTypes = map[string]string{
+	"mp4":  "video/mp4",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+}
+
+type clipJobParams struct {
+	Start  float64 `json:"start"`
+	End    float64 `json:"end"`
+	Format string  `json:"format"`
+}
+
+type clipParams struct {
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Format string `json:"format"`
+}
+
+func (cfg *apiConfig) handlerClipCreate(w http.ResponseWriter, r *http.Request) {
+	video, userID, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := clipParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Format == "" {
+		params.Format = "mp4"
+	}
+	if _, ok := clipContentTypes[params.Format]; !ok {
+		respondWithError(w, http.StatusBadRequest, "Format must be mp4, gif or webp", nil)
+		return
+	}
+
+	start, err := parseTimestamp(params.Start)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid start timestamp", err)
+		return
+	}
+	end, err := parseTimestamp(params.End)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid end timestamp", err)
+		return
+	}
+	if end <= start {
+		respondWithError(w, http.StatusBadRequest, "End must be after start", nil)
+		return
+	}
+
+	limit := maxClipDuration
+	if params.Format != "mp4" {
+		limit = maxAnimatedDuration
+	}
+	if end-start > limit {
+		respondWithError(w, http.StatusBadRequest,
+			fmt.Sprintf("Clips in %s format can be at most %.0f seconds", params.Format, limit), nil)
+		return
+	}
+
+	if video.VideoURL == nil || *video.VideoURL == "" {
+		respondWithError(w, http.StatusConflict, "Video has no uploaded file", nil)
+		return
+	}
+
+	length := end - start
+	jobParams, err := json.Marshal(clipJobParams{Start: start, End: end, Format: params.Format})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't encode job", err)
+		return
+	}
+
+	job, err := cfg.db.WithContext(r.Context()).CreateJob(database.CreateJobParams{
+		UserID:      userID,
+		VideoID:     video.ID,
+		Kind:        jobKindClip,
+		Params:      string(jobParams),
+		TraceParent: traceParent(r.Context()),
+		// Clips are short by design
+		Priority:     database.JobPriorityHigh,
+		InputSeconds: &length,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create job", err)
+		return
+	}
+	cfg.enqueueJob(job)
+
+	respondWithJSON(w, http.StatusAccepted, newJobResponse(i18n.FromContext(r.Context()), job))
+}
+
+func (cfg *apiConfig) runClipJob(ctx context.Context, job database.Job) (database.Job, error) {
+	var params clipJobParams
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		return job, permanent(fmt.Errorf("invalid clip parameters: %w", err))
+	}
+	contentType, ok := clipContentTypes[params.Format]
+	if !ok {
+		return job, permanent(fmt.Errorf("unsupported clip format %q", params.Format))
+	}
+
+	video, err := cfg.db.WithContext(ctx).GetVideo(job.VideoID)
+	if err != nil {
+		return job, fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.VideoURL == nil || *video.VideoURL == "" {
+		return job, permanent(fmt.Errorf("video %s has no uploaded file", job.VideoID))
+	}
+	bucket, key, err := splitVideoURL(*video.VideoURL)
+	if err != nil {
+		return job, err
+	}
+
+	sourcePath, err := cfg.downloadObjectToTemp(ctx, bucket, key, "tubely-clip-source-*.mp4")
+	if err != nil {
+		return job, err
+	}
+	defer os.Remove(sourcePath)
+
+	clipPath := sourcePath + "." + params.Format
+	if err := cfg.transcoder.Clip(ctx, sourcePath, clipPath, params.Format, params.Start, params.End); err != nil {
+		return job, err
+	}
+	defer os.Remove(clipPath)
+
+	clipFile, err := os.Open(clipPath)
+	if err != nil {
+		return job, fmt.Errorf("failed to open clip: %w", err)
+	}
+	defer clipFile.Close()
+
+	aspect, err := cfg.probeAspect(ctx, clipPath)
+	if err != nil {
+		return job, err
+	}
+	keyParams := objectKeyParams{
+		UserID:    video.UserID,
+		OrgID:     video.OrgID,
+		VideoID:   video.ID,
+		Aspect:    aspect.Category,
+		Rendition: renditionClip + "-" + job.ID.String(),
+		Folder:    "clips",
+		Ext:       params.Format,
+	}
+	clipKey, err := cfg.keyTemplate.render(keyParams)
+	if err != nil {
+		return job, err
+	}
+
+	resultURL, err := cfg.publishFile(ctx, clipFile, clipKey, contentType, keyParams.tags(contentType))
+	if err != nil {
+		return job, err
+	}
+
+	job.ResultURL = &resultURL
+	job.ResultContentType = &contentType
+	return job, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxCommentLength        = 5000
+	defaultCommentPageLimit = 20
+	maxCommentPageLimit     = 100
+)
+
+type commentParams struct {
+	Body string `json:"body"`
+	// ParentID makes the comment a reply
+	ParentID *uuid.UUID `json:"parent_id,omitempty"`
+}
+
+type commentsPage struct {
+	Comments []database.Comment `json:"comments"`
+	// NextCursor fetches the next page, empty on the last one
+	NextCursor string `json:"next_cursor"`
+}
+
+// handlerCommentCreate adds a comment, or a reply, to a video the caller can
+// see.
+func (cfg *apiConfig) handlerCommentCreate(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	var params commentParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	body := strings.TrimSpace(params.Body)
+	if body == "" {
+		respondWithError(w, http.StatusBadRequest, "Comment body is required", nil)
+		return
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		respondWithError(w, http.StatusBadRequest, "Comment is too long", nil)
+		return
+	}
+	if params.ParentID != nil {
+		parent, err := cfg.db.WithContext(r.Context()).GetComment(*params.ParentID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get comment", err)
+			return
+		}
+		if parent.ID == uuid.Nil || parent.VideoID != video.ID || parent.DeletedAt != nil {
+			respondWithError(w, http.StatusNotFound, "Parent comment not found", nil)
+			return
+		}
+	}
+
+	comment, err := cfg.db.WithContext(r.Context()).CreateComment(video.ID, userID, params.ParentID, body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create comment", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, comment)
+}
+
+// handlerCommentsList pages through a video's top-level comments, or the
+// replies to the parent_id comment.
+func (cfg *apiConfig) handlerCommentsList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	var parentID *uuid.UUID
+	if raw := query.Get("parent_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid comment ID", err)
+			return
+		}
+		parentID = &id
+	}
+	limit := defaultCommentPageLimit
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxCommentPageLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+	}
+	var after *database.CommentCursor
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeCommentCursor(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+			return
+		}
+		after = &cursor
+	}
+
+	// One extra row tells whether there is another page
+	comments, err := cfg.db.WithContext(r.Context()).ListComments(video.ID, parentID, after, limit+1)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve comments", err)
+		return
+	}
+	page := commentsPage{Comments: comments}
+	if len(comments) > limit {
+		page.Comments = comments[:limit]
+		last := page.Comments[limit-1]
+		page.NextCursor = encodeCommentCursor(database.CommentCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// handlerCommentDelete deletes a comment. Besides its author, those who may
+// manage the video may delete any comment on it, as may admins.
+func (cfg *apiConfig) handlerCommentDelete(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+	commentID, err := uuid.Parse(r.PathValue("commentID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid comment ID", err)
+		return
+	}
+
+	comment, err := cfg.db.WithContext(r.Context()).GetComment(commentID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get comment", err)
+		return
+	}
+	if comment.ID == uuid.Nil || comment.VideoID != video.ID || comment.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Comment not found", nil)
+		return
+	}
+	isAuthor := comment.UserID != nil && *comment.UserID == userID
+	canManage, err := cfg.canManageVideo(r.Context(), userID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get comment", err)
+		return
+	}
+	if !isAuthor && !canManage && !cfg.isAdminRequest(r) {
+		respondWithError(w, http.StatusForbidden, "You can't delete this comment", nil)
+		return
+	}
+
+	if err := cfg.db.WithContext(r.Context()).DeleteComment(comment.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete comment", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Cursors are opaque to clients: the last comment's creation time and ID.
+func encodeCommentCursor(cursor database.CommentCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCommentCursor(s string) (database.CommentCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return database.CommentCursor{}, err
+	}
+	createdAt, id, _ := strings.Cut(string(raw), "|")
+	var cursor database.CommentCursor
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return database.CommentCursor{}, err
+	}
+	if cursor.ID, err = uuid.Parse(id); err != nil {
+		return database.CommentCursor{}, err
+	}
+	return cursor, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+const healthCheckTimeout = 3 * time.Second
+
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// dependencyHealth is the result of checking one dependency.
+type dependencyHealth struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type healthResponse struct {
+	Status       string                      `json:"status"`
+	Draining     bool                        `json:"draining,omitempty"`
+	Dependencies map[string]dependencyHealth `json:"dependencies"`
+	// MediaTools are the ffmpeg/ffprobe binaries and versions found at boot
+	MediaTools media.Tools `json:"media_tools"`
+	// Transcodes shows how many ffmpeg runs are in flight or queued
+	Transcodes transcodeStats `json:"transcodes"`
+}
+
+type healthCheck func(ctx context.Context) error
+
+// localHealthChecks are the dependencies on this machine; if one fails the
+// process itself is unhealthy.
+func (cfg *apiConfig) localHealthChecks() map[string]healthCheck {
+	return map[string]healthCheck{
+		"database": func(ctx context.Context) error {
+			return cfg.db.Ping(ctx)
+		},
+		"ffmpeg": func(context.Context) error {
+			return checkExecutable(cfg.mediaTools.FFmpeg.Path)
+		},
+		"ffprobe": func(context.Context) error {
+			return checkExecutable(cfg.mediaTools.FFprobe.Path)
+		},
+		"assets_dir": func(context.Context) error {
+			return checkWritable(cfg.assetsRoot)
+		},
+		"staging_dir": func(context.Context) error {
+			return checkWritable(cfg.stagingDir)
+		},
+		"temp_dir": func(context.Context) error {
+			return checkWritable(cfg.tempDir)
+		},
+	}
+}
+
+// readinessChecks adds the remote dependencies needed to serve traffic.
+func (cfg *apiConfig) readinessChecks() map[string]healthCheck {
+	checks := cfg.localHealthChecks()
+	checks["s3"] = func(ctx context.Context) error {
+		_, err := cfg.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(cfg.s3Bucket)})
+		return err
+	}
+	return checks
+}
+
+// runHealthChecks runs the checks concurrently, each bounded by
+// healthCheckTimeout.
+func runHealthChecks(ctx context.Context, checks map[string]healthCheck) (map[string]dependencyHealth, bool) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]dependencyHealth, len(checks))
+		healthy = true
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			result := dependencyHealth{Status: healthOK, DurationMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = healthUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[name] = result
+			healthy = healthy && err == nil
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results, healthy
+}
+
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".healthcheck-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// handlerHealthz is the liveness probe: it fails only when something local
+// (database file, binaries, directories) is broken.
+func (cfg *apiConfig) handlerHealthz(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithHealth(w, r, cfg.localHealthChecks(), false)
+}
+
+// handlerReadyz is the readiness probe: it also checks S3 and reports
+// unavailable while the server is draining for shutdown.
+func (cfg *apiConfig) handlerReadyz(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithHealth(w, r, cfg.readinessChecks(), cfg.lifecycle.draining.Load())
+}
+
+func (cfg *apiConfig) respondWithHealth(w http.ResponseWriter, r *http.Request, checks map[string]healthCheck, draining bool) {
+	results, healthy := runHealthChecks(r.Context(), checks)
+
+	resp := healthResponse{
+		Status:       healthOK,
+		Draining:     draining,
+		Dependencies: results,
+		MediaTools:   cfg.mediaTools,
+		Transcodes:   transcodes.stats(),
+	}
+	code := http.StatusOK
+	if !healthy || draining {
+		resp.Status = healthUnavailable
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, code, resp)
+}
+
+// checkExecutable reports whether the binary detected at boot is still
+// there, for the health checks.
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&0o111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	return nil
+}
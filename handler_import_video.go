@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/moderation"
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+// jobKindImportVideo finishes a video copied in from another bucket
+const jobKindImportVideo = "import_video"
+
+// importPresignExpiry is how long ffmpeg may keep reading an object through
+// a presigned URL while probing or rendering from it.
+const importPresignExpiry = time.Hour
+
+type importVideoParams struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// Region of the source bucket, defaults to S3_REGION
+	Region string `json:"region,omitempty"`
+	// Credentials is the access used for the copy instead of the server's,
+	// for a source in another account
+	Credentials *importCredentials `json:"credentials,omitempty"`
+}
+
+type importCredentials struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty"`
+}
+
+// importVideoJobParams are the parameters of an import_video job. The
+// object is already in our bucket; credentials are never persisted.
+type importVideoJobParams struct {
+	VideoURL       string   `json:"video_url"`
+	SHA256         string   `json:"sha256"`
+	Aspect         string   `json:"aspect"`
+	SupersededURLs []string `json:"superseded_urls"`
+	// Dimensions are those probed from the source, absent in jobs queued
+	// before they were recorded
+	Dimensions database.Dimensions `json:"dimensions"`
+}
+
+// handlerImportVideo copies an MP4 that is already in S3 into the bucket as
+// the video's stream rendition with a server-side CopyObject, so the file
+// never passes through this server. The poster, preview and moderation run
+// in an import_video job that reads the copy through a presigned URL.
+func (cfg *apiConfig) handlerImportVideo(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	annotateLog(w, "user_id", video.UserID, "video_id", video.ID)
+
+	var params importVideoParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Bucket == "" || params.Key == "" {
+		respondWithError(w, http.StatusBadRequest, "Source bucket and key are required", nil)
+		return
+	}
+	if c := params.Credentials; c != nil && (c.AccessKeyID == "" || c.SecretAccessKey == "") {
+		respondWithError(w, http.StatusBadRequest, "Credentials need an access key ID and secret access key", nil)
+		return
+	}
+	source := cfg.importClient(params)
+
+	head, err := source.HeadObject(r.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(params.Bucket),
+		Key:    aws.String(params.Key),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, "Couldn't read source object", err)
+		return
+	}
+	if aws.ToInt64(head.ContentLength) > maxCopyObjectSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large",
+			fmt.Errorf("%s is over the CopyObject limit", params.Key))
+		return
+	}
+
+	// ffprobe reads just the headers it needs through the URL
+	sourceURL, err := generatePresignedURL(source, params.Bucket, params.Key, importPresignExpiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read source object", err)
+		return
+	}
+	var (
+		aspect   videoAspect
+		duration *float64
+		limitErr error
+	)
+	err = withSpan(r.Context(), "probe source", func(ctx context.Context) error {
+		var err error
+		aspect, err = cfg.probeAspect(ctx, sourceURL)
+		if err == nil {
+			duration, limitErr = cfg.probeVideoLength(ctx, video.UserID, sourceURL)
+		}
+		return err
+	})
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, "Source object is not a video", err)
+		return
+	}
+	if respondWithVideoTooLong(w, limitErr) {
+		return
+	}
+	if limitErr != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", limitErr)
+		return
+	}
+
+	// With a scanner configured the bytes have to be read once after all,
+	// streamed through without touching disk
+	if cfg.scanner != nil {
+		body, err := source.GetObject(r.Context(), &s3.GetObjectInput{
+			Bucket: aws.String(params.Bucket),
+			Key:    aws.String(params.Key),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusUnprocessableEntity, "Couldn't read source object", err)
+			return
+		}
+		clean := cfg.scanUpload(r.Context(), w, body.Body, params.Key)
+		body.Body.Close()
+		if !clean {
+			return
+		}
+	}
+
+	jobParams, err := cfg.copyVideoObject(r.Context(), source, video, aspect, params.Bucket, params.Key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't copy source object", err)
+		return
+	}
+
+	dat, err := json.Marshal(jobParams)
+	if err != nil {
+		cfg.discardUploads("", jobParams.VideoURL)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create job", err)
+		return
+	}
+	job, err := cfg.db.WithContext(r.Context()).CreateJob(database.CreateJobParams{
+		UserID:       video.UserID,
+		VideoID:      video.ID,
+		Kind:         jobKindImportVideo,
+		Params:       string(dat),
+		TraceParent:  traceParent(r.Context()),
+		Priority:     cfg.videoJobPriority(duration),
+		InputSeconds: duration,
+	})
+	if err != nil {
+		cfg.discardUploads("", jobParams.VideoURL)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create job", err)
+		return
+	}
+	cfg.enqueueJob(job)
+	if err := cfg.db.WithContext(context.WithoutCancel(r.Context())).SetVideoProcessingStatus(video.ID, database.ProcessingQueued); err != nil {
+		requestLogger(r).Warn("Couldn't update processing status", "video_id", video.ID, "error", err)
+	}
+	requestLogger(r).Info("Video imported from S3",
+		"user_id", video.UserID, "video_id", video.ID, "job_id", job.ID,
+		"source_bucket", params.Bucket, "source_key", params.Key, "video_url", jobParams.VideoURL)
+
+	respondWithJSON(w, http.StatusAccepted, newJobResponse(i18n.FromContext(r.Context()), job))
+}
+
+// importClient is the S3 client that reads the source: the server's own,
+// adjusted for the source's region and credentials if given.
+func (cfg *apiConfig) importClient(params importVideoParams) *s3.Client {
+	return s3.New(cfg.s3Client.Options(), func(o *s3.Options) {
+		if params.Region != "" {
+			o.Region = params.Region
+		}
+		if c := params.Credentials; c != nil {
+			o.Credentials = aws.NewCredentialsCache(
+				credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, c.SessionToken))
+		}
+	})
+}
+
+// copyVideoObject copies bucket/key into S3_BUCKET under the video's next
+// object key with a server-side CopyObject through source, returning the
+// import_video job parameters for the copy.
+func (cfg *apiConfig) copyVideoObject(ctx context.Context, source *s3.Client, video database.Video, aspect videoAspect, bucket, key string) (importVideoJobParams, error) {
+	keyParams := videoKeyParams(video, aspect.Category)
+	objectKey, err := cfg.keyTemplate.render(keyParams)
+	if err != nil {
+		return importVideoJobParams{}, err
+	}
+	copyInput := &s3.CopyObjectInput{
+		Bucket:            aws.String(cfg.s3Bucket),
+		Key:               aws.String(objectKey),
+		CopySource:        aws.String(url.PathEscape(bucket + "/" + key)),
+		ContentType:       aws.String("video/mp4"),
+		MetadataDirective: types.MetadataDirectiveReplace,
+		Tagging:           aws.String(keyParams.tags("video/mp4").encode()),
+		TaggingDirective:  types.TaggingDirectiveReplace,
+		StorageClass:      cfg.s3StorageClass,
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+	}
+	cfg.s3SSE.applyToCopy(copyInput)
+	var copied *s3.CopyObjectOutput
+	err = withSpan(ctx, "s3 copy", func(ctx context.Context) error {
+		var err error
+		copied, err = source.CopyObject(ctx, copyInput)
+		return err
+	})
+	if err != nil {
+		return importVideoJobParams{}, err
+	}
+
+	params := importVideoJobParams{
+		VideoURL:       fmt.Sprintf("%s,%s", cfg.s3Bucket, objectKey),
+		Aspect:         aspect.Category,
+		SupersededURLs: videoObjectURLs(video.VideoURL, video.PreviewURL, video.SDRVideoURL, video.OriginalURL),
+		Dimensions:     aspect.dimensions(),
+	}
+	if copied.CopyObjectResult != nil {
+		if digest, err := base64.StdEncoding.DecodeString(aws.ToString(copied.CopyObjectResult.ChecksumSHA256)); err == nil && len(digest) > 0 {
+			params.SHA256 = hex.EncodeToString(digest)
+		}
+	}
+	return params, nil
+}
+
+// runImportVideoJob renders the poster and preview of an imported video and
+// moderates it, all from a presigned URL of the copied object, then points
+// the video at it. If the job fails for good the copy is deleted again.
+func (cfg *apiConfig) runImportVideoJob(ctx context.Context, job database.Job) (database.Job, error) {
+	var params importVideoJobParams
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		return job, permanent(fmt.Errorf("invalid import_video parameters: %w", err))
+	}
+
+	if err := cfg.db.WithContext(ctx).SetVideoProcessingStatus(job.VideoID, database.ProcessingInProgress); err != nil {
+		slog.Warn("Couldn't update processing status", "video_id", job.VideoID, "error", err)
+	}
+	timer := newStageTimer()
+	err := cfg.finishImportedVideo(ctx, job, params, timer)
+	job.StageTimings = timer.snapshot()
+	if err != nil {
+		// A job that may run again still needs the copy
+		outcome := cfg.jobFailureOutcome(ctx, job, err)
+		if !outcome.keepsInputs() {
+			cfg.discardUploads("", params.VideoURL)
+		}
+		status := database.ProcessingFailed
+		if outcome.runsAgain() {
+			status = database.ProcessingQueued
+		}
+		if err := cfg.db.WithContext(context.WithoutCancel(ctx)).SetVideoProcessingStatus(job.VideoID, status); err != nil {
+			slog.Warn("Couldn't update processing status", "video_id", job.VideoID, "error", err)
+		}
+	}
+	return job, err
+}
+
+func (cfg *apiConfig) finishImportedVideo(ctx context.Context, job database.Job, params importVideoJobParams, timer *stageTimer) error {
+	video, err := cfg.db.WithContext(ctx).GetVideo(job.VideoID)
+	if err != nil {
+		return fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		return permanent(fmt.Errorf("video %s was deleted", job.VideoID))
+	}
+	before := video
+
+	bucket, key, err := splitVideoURL(params.VideoURL)
+	if err != nil {
+		return err
+	}
+	inputURL, err := generatePresignedURL(cfg.s3Client, bucket, key, importPresignExpiry)
+	if err != nil {
+		return err
+	}
+
+	var (
+		posterName string
+		posterAt   float64
+		verdict    moderation.Verdict
+	)
+	previewFile, err := os.CreateTemp(cfg.tempDir, "tubely-import-preview-*.mp4")
+	if err != nil {
+		return err
+	}
+	previewFile.Close()
+	previewPath := previewFile.Name()
+	defer os.Remove(previewPath)
+
+	g, gctx := errgroup.WithContext(ctx)
+	if video.ThumbnailURL == nil || *video.ThumbnailURL == "" {
+		g.Go(func() error {
+			return timer.track(stagePoster, func() error {
+				var err error
+				posterName, posterAt, err = cfg.generatePoster(gctx, inputURL)
+				return err
+			})
+		})
+	}
+	g.Go(func() error {
+		return timer.track(stagePreview, func() error {
+			if err := cfg.transcoder.Preview(gctx, inputURL, previewPath); err != nil {
+				return fmt.Errorf("preview generation failed: %w", err)
+			}
+			return nil
+		})
+	})
+	if cfg.classifier != nil {
+		g.Go(func() error {
+			return timer.track(stageModerate, func() error {
+				var err error
+				verdict, err = cfg.moderateVideo(gctx, inputURL)
+				if err != nil {
+					return fmt.Errorf("moderation failed: %w", err)
+				}
+				return nil
+			})
+		})
+	}
+	if err := g.Wait(); err != nil {
+		cfg.discardUploads(posterName)
+		return err
+	}
+
+	var previewURL string
+	err = timer.track(stageUpload, func() error {
+		var err error
+		previewURL, err = cfg.publishPreview(ctx, previewPath, video, params.Aspect)
+		return err
+	})
+	if err != nil {
+		cfg.discardUploads(posterName)
+		return fmt.Errorf("failed to upload preview to S3: %w", err)
+	}
+
+	video.VideoURL = &params.VideoURL
+	video.PreviewURL = &previewURL
+	// Imports aren't tonemapped, so an SDR rendition would be the old file's
+	video.SDRVideoURL = nil
+	video.Dimensions = params.Dimensions
+	if params.SHA256 != "" {
+		video.SHA256 = &params.SHA256
+	}
+	if cfg.classifier != nil {
+		video = applyModerationVerdict(video, verdict)
+	}
+	if posterName != "" {
+		if err := cfg.recordAsset(posterName, video.ID); err != nil {
+			cfg.discardUploads(posterName, previewURL)
+			return fmt.Errorf("failed to record poster: %w", err)
+		}
+		thumbnailURL := cfg.getAssetURL(posterName)
+		video.ThumbnailURL = &thumbnailURL
+		video.ThumbnailPlaceholder = cfg.thumbnailPlaceholder(posterName)
+		video.ThumbnailSourceURL = nil
+		video.ThumbnailCrop = nil
+		video.PosterTimestamp = &posterAt
+	}
+	video.ProcessingStatus = database.ProcessingReady
+
+	updated, err := cfg.db.WithContext(ctx).UpdateVideoAsNewVersion(video)
+	if err != nil {
+		// The copy is discarded by the caller
+		assetName, _ := newVideoUploads(before, video)
+		cfg.discardUploads(assetName, previewURL)
+		return fmt.Errorf("failed to update video: %w", err)
+	}
+	video = updated
+	slog.Info("Imported video processed",
+		"job_id", job.ID, "user_id", video.UserID, "video_id", video.ID,
+		"stage_timings_ms", job.StageTimings)
+
+	if video.ModerationStatus == database.ModerationPending {
+		cfg.publishEvent(eventModerationPending, video.UserID, video.ID, moderationEventData{
+			Status: video.ModerationStatus,
+		})
+	}
+	cfg.markObjectsSuperseded(ctx, params.SupersededURLs...)
+	return nil
+}
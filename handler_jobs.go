@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerJobGet(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	job, err := cfg.db.WithContext(r.Context()).GetJob(jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+		return
+	}
+	if job.ID == uuid.Nil || job.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Job not found", nil)
+		return
+	}
+
+	signedJob, err := cfg.jobToSignedJob(job)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate URL", err)
+		return
+	}
+
+	resp := newJobResponse(i18n.FromContext(r.Context()), signedJob)
+	// The job's status is still worth returning without an estimate
+	resp.jobEstimate, err = cfg.estimateJob(r.Context(), job)
+	if err != nil {
+		slog.Warn("Couldn't estimate job", "job_id", job.ID, "error", err)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerJobCancel abandons one of the user's jobs. A queued job is
+// canceled and cleaned up at once; a running one is stopped, killing its
+// ffmpeg processes and aborting its uploads, and cleans up as it exits.
+func (cfg *apiConfig) handlerJobCancel(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	job, err := cfg.db.WithContext(r.Context()).GetJob(jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+		return
+	}
+	if job.ID == uuid.Nil || job.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Job not found", nil)
+		return
+	}
+	requestAudit(r).SetVideo(job.VideoID)
+	requestAudit(r).Set("kind", job.Kind)
+	if !jobCancelable(job.Kind) {
+		respondWithError(w, http.StatusConflict, "Only video processing and clip jobs can be canceled", nil)
+		return
+	}
+
+	code := http.StatusOK
+	switch job.Status {
+	case database.JobStatusQueued, database.JobStatusDeadLettered:
+		// Nothing runs it, so it's cleaned up here unless a worker
+		// claimed it in the meantime
+		ok, err := cfg.db.WithContext(r.Context()).CancelJob(job.ID, job.Status)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't cancel job", err)
+			return
+		}
+		if ok {
+			cfg.finishCanceledJob(job)
+			break
+		}
+		job.Status = database.JobStatusRunning
+		fallthrough
+	case database.JobStatusRunning:
+		ok, err := cfg.db.WithContext(r.Context()).CancelJob(job.ID, database.JobStatusRunning)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't cancel job", err)
+			return
+		}
+		if !ok {
+			respondWithError(w, http.StatusConflict, "Job has already finished", nil)
+			return
+		}
+		// A job running on another worker notices at its next heartbeat
+		cfg.runningJobs.cancel(job.ID)
+		code = http.StatusAccepted
+	default:
+		respondWithError(w, http.StatusConflict, "Job has already finished", nil)
+		return
+	}
+
+	job, err = cfg.db.WithContext(r.Context()).GetJob(job.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+		return
+	}
+	signedJob, err := cfg.jobToSignedJob(job)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate URL", err)
+		return
+	}
+	respondWithJSON(w, code, newJobResponse(i18n.FromContext(r.Context()), signedJob))
+}
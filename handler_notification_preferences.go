@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+)
+
+type notificationPreferencesParams struct {
+	ProcessingFailed    bool `json:"processing_failed"`
+	ProcessingCompleted bool `json:"processing_completed"`
+	// Language of the emails, defaults to the request's Accept-Language
+	Language string `json:"language,omitempty"`
+}
+
+func (cfg *apiConfig) handlerNotificationPreferencesGet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	prefs, err := cfg.db.WithContext(r.Context()).GetNotificationPreferences(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get notification preferences", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, prefs)
+}
+
+// handlerNotificationPreferencesPut replaces which emails the caller gets.
+func (cfg *apiConfig) handlerNotificationPreferencesPut(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	var params notificationPreferencesParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	lang := strings.ToLower(strings.TrimSpace(params.Language))
+	if lang == "" {
+		lang = i18n.FromContext(r.Context())
+	}
+	if !i18n.Supported(lang) {
+		respondWithError(w, http.StatusBadRequest, "Unsupported language", fmt.Errorf("%q", params.Language))
+		return
+	}
+
+	prefs, err := cfg.db.WithContext(r.Context()).SetNotificationPreferences(userID, database.NotificationPreferences{
+		ProcessingFailed:    params.ProcessingFailed,
+		ProcessingCompleted: params.ProcessingCompleted,
+		Language:            lang,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save notification preferences", err)
+		return
+	}
+	requestAudit(r).Set("processing_failed", prefs.ProcessingFailed)
+	requestAudit(r).Set("processing_completed", prefs.ProcessingCompleted)
+	respondWithJSON(w, http.StatusOK, prefs)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type orgParams struct {
+	Name string `json:"name"`
+}
+
+type orgResponse struct {
+	database.Organization
+	// Role is the caller's role
+	Role    string                        `json:"role"`
+	Members []database.OrganizationMember `json:"members"`
+}
+
+type orgMemberParams struct {
+	// Email is only read when adding a member
+	Email string `json:"email,omitempty"`
+	// Role is owner, uploader or viewer
+	Role string `json:"role"`
+}
+
+type orgEgressCapResponse struct {
+	OrgID uuid.UUID `json:"org_id"`
+	egressCapParams
+}
+
+func validOrgRole(role string) bool {
+	switch role {
+	case database.RoleOwner, database.RoleUploader, database.RoleViewer:
+		return true
+	}
+	return false
+}
+
+func (cfg *apiConfig) handlerOrgCreate(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	var params orgParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		respondWithError(w, http.StatusBadRequest, "Organization name is required", nil)
+		return
+	}
+
+	org, err := cfg.db.WithContext(r.Context()).CreateOrganization(name, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create organization", err)
+		return
+	}
+	requestAudit(r).Set("org_id", org.ID)
+	cfg.respondWithOrg(r.Context(), w, org, database.RoleOwner, http.StatusCreated)
+}
+
+// handlerOrgsList lists the organizations the caller is a member of, with
+// their role in each.
+func (cfg *apiConfig) handlerOrgsList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	orgs, err := cfg.db.WithContext(r.Context()).GetUserOrganizations(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve organizations", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, orgs)
+}
+
+func (cfg *apiConfig) handlerOrgGet(w http.ResponseWriter, r *http.Request) {
+	org, _, role, ok := cfg.getOrgMembership(w, r)
+	if !ok {
+		return
+	}
+	cfg.respondWithOrg(r.Context(), w, org, role, http.StatusOK)
+}
+
+// handlerOrgVideos lists the organization's shared library to its members.
+func (cfg *apiConfig) handlerOrgVideos(w http.ResponseWriter, r *http.Request) {
+	org, _, _, ok := cfg.getOrgMembership(w, r)
+	if !ok {
+		return
+	}
+
+	videos, err := cfg.db.WithContext(r.Context()).GetOrgVideos(org.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+	signedVideos := make([]database.Video, 0, len(videos))
+	for _, video := range videos {
+		signed, err := cfg.dbVideoToSignedVideo(video)
+		if err != nil {
+			requestLogger(r).Warn("Skipping video", "video_id", video.ID, "error", err)
+			continue
+		}
+		signedVideos = append(signedVideos, signed)
+	}
+	respondWithJSON(w, http.StatusOK, signedVideos)
+}
+
+// handlerOrgUsage is handlerUsage for the organization's videos.
+func (cfg *apiConfig) handlerOrgUsage(w http.ResponseWriter, r *http.Request) {
+	org, _, _, ok := cfg.getOrgMembership(w, r)
+	if !ok {
+		return
+	}
+	start, end, err := parseUsageMonth(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid month", err)
+		return
+	}
+
+	videos, err := cfg.db.WithContext(r.Context()).GetOrgEgress(org.ID, start, end)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newUsageResponse(start, videos, cfg.orgEgressCap(org)))
+}
+
+// handlerOrgMemberAdd adds an existing user to the organization by email.
+// Only owners manage the membership.
+func (cfg *apiConfig) handlerOrgMemberAdd(w http.ResponseWriter, r *http.Request) {
+	org, ok := cfg.getOrgAsOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var params orgMemberParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !validOrgRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, "Invalid role", nil)
+		return
+	}
+	user, err := cfg.db.WithContext(r.Context()).GetUserByEmail(strings.TrimSpace(params.Email))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+	role, err := cfg.db.WithContext(r.Context()).GetOrgRole(org.ID, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get organization", err)
+		return
+	}
+	if role != "" {
+		respondWithError(w, http.StatusConflict, "User is already a member", nil)
+		return
+	}
+
+	if err := cfg.db.WithContext(r.Context()).SetOrgMember(org.ID, user.ID, params.Role); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add member", err)
+		return
+	}
+	cfg.respondWithUpdatedOrg(r.Context(), w, org.ID, database.RoleOwner, http.StatusCreated)
+}
+
+// handlerOrgMemberUpdate changes a member's role. The last owner can't be
+// demoted.
+func (cfg *apiConfig) handlerOrgMemberUpdate(w http.ResponseWriter, r *http.Request) {
+	org, ok := cfg.getOrgAsOwner(w, r)
+	if !ok {
+		return
+	}
+	memberID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	var params orgMemberParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !validOrgRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, "Invalid role", nil)
+		return
+	}
+	role, err := cfg.db.WithContext(r.Context()).GetOrgRole(org.ID, memberID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get organization", err)
+		return
+	}
+	if role == "" {
+		respondWithError(w, http.StatusNotFound, "Member not found", nil)
+		return
+	}
+	if role == database.RoleOwner && params.Role != database.RoleOwner && org.OwnerCount <= 1 {
+		respondWithError(w, http.StatusConflict, "An organization needs at least one owner", nil)
+		return
+	}
+
+	if err := cfg.db.WithContext(r.Context()).SetOrgMember(org.ID, memberID, params.Role); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update member", err)
+		return
+	}
+	callerRole, err := cfg.db.WithContext(r.Context()).GetOrgRole(org.ID, cfg.requesterID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get organization", err)
+		return
+	}
+	cfg.respondWithUpdatedOrg(r.Context(), w, org.ID, callerRole, http.StatusOK)
+}
+
+// handlerOrgMemberRemove removes a member. Owners may remove anyone and any
+// member may leave, except the last owner. The videos they uploaded stay
+// in the organization.
+func (cfg *apiConfig) handlerOrgMemberRemove(w http.ResponseWriter, r *http.Request) {
+	org, userID, role, ok := cfg.getOrgMembership(w, r)
+	if !ok {
+		return
+	}
+	memberID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	if memberID != userID && role != database.RoleOwner {
+		respondWithError(w, http.StatusForbidden, "Organization owner access required", nil)
+		return
+	}
+
+	memberRole, err := cfg.db.WithContext(r.Context()).GetOrgRole(org.ID, memberID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get organization", err)
+		return
+	}
+	if memberRole == database.RoleOwner && org.OwnerCount <= 1 {
+		respondWithError(w, http.StatusConflict, "An organization needs at least one owner", nil)
+		return
+	}
+
+	removed, err := cfg.db.WithContext(r.Context()).RemoveOrgMember(org.ID, memberID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove member", err)
+		return
+	}
+	if !removed {
+		respondWithError(w, http.StatusNotFound, "Member not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminOrgEgressCapSet is handlerAdminEgressCapSet for an
+// organization.
+func (cfg *apiConfig) handlerAdminOrgEgressCapSet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	orgID, err := uuid.Parse(r.PathValue("orgID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid organization ID", err)
+		return
+	}
+
+	var params egressCapParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.MonthlyBytes != nil && *params.MonthlyBytes < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid egress cap", fmt.Errorf("%d bytes", *params.MonthlyBytes))
+		return
+	}
+
+	org, err := cfg.db.WithContext(r.Context()).GetOrganization(orgID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get organization", err)
+		return
+	}
+	if org.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Organization not found", nil)
+		return
+	}
+	if err := cfg.db.WithContext(r.Context()).SetOrgEgressCap(orgID, params.MonthlyBytes); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set egress cap", err)
+		return
+	}
+	requestAudit(r).Set("monthly_bytes", params.MonthlyBytes)
+	respondWithJSON(w, http.StatusOK, orgEgressCapResponse{OrgID: orgID, egressCapParams: params})
+}
+
+// getOrgMembership resolves the {orgID} path value, authenticates the
+// caller and returns their role. Organizations look missing to those who
+// aren't members. If any step fails the error response has already been
+// written and ok is false.
+func (cfg *apiConfig) getOrgMembership(w http.ResponseWriter, r *http.Request) (org database.Organization, userID uuid.UUID, role string, ok bool) {
+	orgID, err := uuid.Parse(r.PathValue("orgID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid organization ID", err)
+		return database.Organization{}, uuid.Nil, "", false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Organization{}, uuid.Nil, "", false
+	}
+	userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid JWT", err)
+		return database.Organization{}, uuid.Nil, "", false
+	}
+
+	role, err = cfg.db.WithContext(r.Context()).GetOrgRole(orgID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return database.Organization{}, uuid.Nil, "", false
+	}
+	if role == "" {
+		respondWithError(w, http.StatusNotFound, "Organization not found", nil)
+		return database.Organization{}, uuid.Nil, "", false
+	}
+	org, err = cfg.db.WithContext(r.Context()).GetOrganization(orgID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return database.Organization{}, uuid.Nil, "", false
+	}
+	return org, userID, role, true
+}
+
+// getOrgAsOwner is getOrgMembership for routes only owners may use.
+func (cfg *apiConfig) getOrgAsOwner(w http.ResponseWriter, r *http.Request) (database.Organization, bool) {
+	org, _, role, ok := cfg.getOrgMembership(w, r)
+	if !ok {
+		return database.Organization{}, false
+	}
+	if role != database.RoleOwner {
+		respondWithError(w, http.StatusForbidden, "Organization owner access required", nil)
+		return database.Organization{}, false
+	}
+	return org, true
+}
+
+func (cfg *apiConfig) respondWithUpdatedOrg(ctx context.Context, w http.ResponseWriter, orgID uuid.UUID, role string, status int) {
+	org, err := cfg.db.WithContext(ctx).GetOrganization(orgID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get organization", err)
+		return
+	}
+	cfg.respondWithOrg(ctx, w, org, role, status)
+}
+
+// respondWithOrg writes the organization with its members.
+func (cfg *apiConfig) respondWithOrg(ctx context.Context, w http.ResponseWriter, org database.Organization, role string, status int) {
+	members, err := cfg.db.WithContext(ctx).GetOrgMembers(org.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get organization", err)
+		return
+	}
+	respondWithJSON(w, status, orgResponse{Organization: org, Role: role, Members: members})
+}
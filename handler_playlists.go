@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type playlistParams struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Visibility is public, unlisted or private (the default). Sharing a
+	// playlist means making it unlisted or public.
+	Visibility string `json:"visibility"`
+}
+
+type playlistResponse struct {
+	database.Playlist
+	// Videos are those the caller may see, with signed URLs
+	Videos []database.Video `json:"videos"`
+}
+
+type playlistAddParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	// Position is the 0-based index to insert at; the video is appended if
+	// it is omitted
+	Position *int `json:"position,omitempty"`
+}
+
+type playlistOrderParams struct {
+	VideoIDs []uuid.UUID `json:"video_ids"`
+}
+
+// validate trims the params and checks them, returning the error message
+// for the response if they are invalid.
+func (p *playlistParams) validate() string {
+	p.Title = strings.TrimSpace(p.Title)
+	if p.Title == "" {
+		return "Title is required"
+	}
+	if p.Visibility == "" {
+		p.Visibility = database.VisibilityPrivate
+	}
+	if !validVisibility(p.Visibility) {
+		return "Invalid visibility"
+	}
+	return ""
+}
+
+func (cfg *apiConfig) handlerPlaylistCreate(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	var params playlistParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if msg := params.validate(); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	playlist, err := cfg.db.WithContext(r.Context()).CreatePlaylist(database.CreatePlaylistParams{
+		UserID:      userID,
+		Title:       params.Title,
+		Description: params.Description,
+		Visibility:  params.Visibility,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create playlist", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, playlistResponse{Playlist: playlist, Videos: []database.Video{}})
+}
+
+// handlerPlaylistsList lists the caller's playlists without their videos.
+func (cfg *apiConfig) handlerPlaylistsList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	playlists, err := cfg.db.WithContext(r.Context()).GetPlaylists(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlists", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, playlists)
+}
+
+// handlerPlaylistGet returns a playlist to anyone it is visible to. Private
+// playlists look missing to everyone but their owner and admins.
+func (cfg *apiConfig) handlerPlaylistGet(w http.ResponseWriter, r *http.Request) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return
+	}
+	playlist, err := cfg.db.WithContext(r.Context()).GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+	if playlist.ID == uuid.Nil ||
+		(playlist.Visibility == database.VisibilityPrivate && !cfg.isOwnerOrAdmin(r, playlist.UserID)) {
+		respondWithError(w, http.StatusNotFound, "Playlist not found", nil)
+		return
+	}
+	cfg.respondWithPlaylist(w, r, playlist, http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerPlaylistUpdate(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	var params playlistParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if msg := params.validate(); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	playlist.Title = params.Title
+	playlist.Description = params.Description
+	playlist.Visibility = params.Visibility
+	if err := cfg.db.WithContext(r.Context()).UpdatePlaylist(playlist); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update playlist", err)
+		return
+	}
+	cfg.respondWithUpdatedPlaylist(w, r, playlist.ID)
+}
+
+// handlerPlaylistDelete deletes the playlist; its videos are left alone.
+func (cfg *apiConfig) handlerPlaylistDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.db.WithContext(r.Context()).DeletePlaylist(playlist.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete playlist", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaylistVideoAdd adds one of the caller's own videos.
+func (cfg *apiConfig) handlerPlaylistVideoAdd(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	var params playlistAddParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Position != nil && *params.Position < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid position", nil)
+		return
+	}
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	canManage, err := cfg.canManageVideo(r.Context(), playlist.UserID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if !canManage {
+		respondWithError(w, http.StatusForbidden, "You can only add your own videos", nil)
+		return
+	}
+
+	added, err := cfg.db.WithContext(r.Context()).AddPlaylistVideo(playlist.ID, video.ID, params.Position)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add video", err)
+		return
+	}
+	if !added {
+		respondWithError(w, http.StatusConflict, "Video is already in the playlist", nil)
+		return
+	}
+	requestAudit(r).SetVideo(video.ID)
+	cfg.respondWithUpdatedPlaylist(w, r, playlist.ID)
+}
+
+func (cfg *apiConfig) handlerPlaylistVideoRemove(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	removed, err := cfg.db.WithContext(r.Context()).RemovePlaylistVideo(playlist.ID, videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove video", err)
+		return
+	}
+	if !removed {
+		respondWithError(w, http.StatusNotFound, "Video is not in the playlist", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaylistReorder puts the playlist's videos in the given order,
+// which must name each of them once. Videos in the trash aren't listed and
+// keep their place after the others.
+func (cfg *apiConfig) handlerPlaylistReorder(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	var params playlistOrderParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	videos, err := cfg.db.WithContext(r.Context()).GetPlaylistVideos(playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+	remaining := make(map[uuid.UUID]bool, len(videos))
+	for _, v := range videos {
+		remaining[v.ID] = true
+	}
+	valid := len(params.VideoIDs) == len(videos)
+	for _, id := range params.VideoIDs {
+		if !remaining[id] {
+			valid = false
+			break
+		}
+		delete(remaining, id)
+	}
+	if !valid {
+		respondWithError(w, http.StatusBadRequest, "Order must list every video in the playlist once", nil)
+		return
+	}
+
+	if err := cfg.db.WithContext(r.Context()).ReorderPlaylist(playlist.ID, params.VideoIDs); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reorder playlist", err)
+		return
+	}
+	cfg.respondWithUpdatedPlaylist(w, r, playlist.ID)
+}
+
+// getOwnedPlaylist resolves the {playlistID} path value, authenticates the
+// caller and checks they own the playlist. If any step fails the error
+// response has already been written and ok is false.
+func (cfg *apiConfig) getOwnedPlaylist(w http.ResponseWriter, r *http.Request) (database.Playlist, bool) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return database.Playlist{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Playlist{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid JWT", err)
+		return database.Playlist{}, false
+	}
+
+	playlist, err := cfg.db.WithContext(r.Context()).GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return database.Playlist{}, false
+	}
+	if playlist.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Playlist not found", nil)
+		return database.Playlist{}, false
+	}
+	if playlist.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized access", nil)
+		return database.Playlist{}, false
+	}
+	return playlist, true
+}
+
+func (cfg *apiConfig) respondWithUpdatedPlaylist(w http.ResponseWriter, r *http.Request, playlistID uuid.UUID) {
+	playlist, err := cfg.db.WithContext(r.Context()).GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+	cfg.respondWithPlaylist(w, r, playlist, http.StatusOK)
+}
+
+// respondWithPlaylist writes the playlist with the videos the caller may
+// see, signed like everywhere else. VideoCount is set to match them.
+func (cfg *apiConfig) respondWithPlaylist(w http.ResponseWriter, r *http.Request, playlist database.Playlist, status int) {
+	videos, err := cfg.db.WithContext(r.Context()).GetPlaylistVideos(playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+
+	resp := playlistResponse{Playlist: playlist, Videos: make([]database.Video, 0, len(videos))}
+	for _, video := range videos {
+		if !cfg.videoVisibleTo(r, video) {
+			continue
+		}
+		signed, err := cfg.dbVideoToSignedVideo(video)
+		if err != nil {
+			requestLogger(r).Warn("Skipping video", "video_id", video.ID, "error", err)
+			continue
+		}
+		resp.Videos = append(resp.Videos, signed)
+	}
+	resp.VideoCount = len(resp.Videos)
+	respondWithJSON(w, status, resp)
+}
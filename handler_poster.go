@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+)
+
+type posterParams struct {
+	Timestamp string `json:"timestamp"`
+}
+
+func (cfg *apiConfig) handlerPosterSet(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := posterParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	timestamp, err := parseTimestamp(params.Timestamp)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid timestamp", err)
+		return
+	}
+
+	if video.VideoURL == nil || *video.VideoURL == "" {
+		respondWithError(w, http.StatusConflict, "Video has no uploaded file", nil)
+		return
+	}
+	bucket, key, err := splitVideoURL(*video.VideoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Invalid stored video URL", err)
+		return
+	}
+
+	sourcePath, err := cfg.downloadObjectToTemp(cfg.lifecycle.ctx, bucket, key, "tubely-poster-source-*.mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch source video", err)
+		return
+	}
+	defer os.Remove(sourcePath)
+
+	duration, err := cfg.prober.Duration(cfg.lifecycle.ctx, sourcePath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to analyze video", err)
+		return
+	}
+	if timestamp >= duration {
+		respondWithError(w, http.StatusBadRequest, "Timestamp is past the end of the video", nil)
+		return
+	}
+
+	framePath := sourcePath + ".jpg"
+	if err := cfg.transcoder.Poster(cfg.lifecycle.ctx, sourcePath, framePath, timestamp); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to extract frame", err)
+		return
+	}
+	defer os.Remove(framePath)
+
+	frame, err := os.Open(framePath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to open frame", err)
+		return
+	}
+	defer frame.Close()
+
+	// Hand the frame to the same storage path as uploaded thumbnails
+	video, assetName, err := cfg.saveThumbnail(r, video, frame, ".jpg")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save file", err)
+		return
+	}
+	video.PosterTimestamp = &timestamp
+
+	if err := cfg.commitVideoUpdate(video, assetName); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	maxSearchQueryLength   = 256
+	maxSearchTerms         = 16
+	defaultSearchPageLimit = 20
+	maxSearchPageLimit     = 100
+)
+
+type searchResult struct {
+	database.Video
+	// Score orders the results; it only compares within one search
+	Score float64 `json:"score"`
+	// Highlights are HTML with the matched words in <mark> elements
+	Highlights database.SearchHighlights `json:"highlights"`
+}
+
+type searchResponse struct {
+	Results []searchResult `json:"results"`
+	// NextOffset fetches the next page, nil on the last one
+	NextOffset *int `json:"next_offset"`
+}
+
+// handlerSearch finds videos by the words of their title, description and
+// chapters. Public videos are searched, plus the caller's own.
+func (cfg *apiConfig) handlerSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if utf8.RuneCountInString(q) > maxSearchQueryLength {
+		respondWithError(w, http.StatusBadRequest, "Search query is too long", nil)
+		return
+	}
+	terms := parseSearchQuery(q)
+	if len(terms) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Search query is required", nil)
+		return
+	}
+	limit := defaultSearchPageLimit
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxSearchPageLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+	}
+	offset := 0
+	if raw := query.Get("offset"); raw != "" {
+		var err error
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid offset", err)
+			return
+		}
+	}
+
+	// One extra row tells whether there is another page
+	matches, err := cfg.db.WithContext(r.Context()).SearchVideos(terms, cfg.requesterID(r), limit+1, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+	resp := searchResponse{Results: make([]searchResult, 0, min(len(matches), limit))}
+	if len(matches) > limit {
+		matches = matches[:limit]
+		next := offset + limit
+		resp.NextOffset = &next
+	}
+	for _, match := range matches {
+		signed, err := cfg.dbVideoToSignedVideo(match.Video)
+		if err != nil {
+			requestLogger(r).Warn("Skipping search result", "video_id", match.ID, "error", err)
+			continue
+		}
+		resp.Results = append(resp.Results, searchResult{
+			Video: signed,
+			Score: match.Rank,
+			Highlights: database.SearchHighlights{
+				Title:       highlightHTML(match.Highlights.Title),
+				Description: highlightHTML(match.Highlights.Description),
+				Chapters:    highlightHTML(match.Highlights.Chapters),
+			},
+		})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// parseSearchQuery splits q into lowercase words of letters and digits.
+// A word ending in * is a prefix; punctuation inside a word splits it, so
+// "e-mail*" searches for "e" and the prefix "mail".
+func parseSearchQuery(q string) []database.SearchTerm {
+	terms := []database.SearchTerm{}
+	for _, field := range strings.Fields(strings.ToLower(q)) {
+		prefix := strings.HasSuffix(field, "*")
+		words := strings.FieldsFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for i, word := range words {
+			if len(terms) == maxSearchTerms {
+				return terms
+			}
+			terms = append(terms, database.SearchTerm{Text: word, Prefix: prefix && i == len(words)-1})
+		}
+	}
+	return terms
+}
+
+// highlightHTML escapes a highlight and marks its matches.
+func highlightHTML(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, database.HighlightStart, "<mark>")
+	return strings.ReplaceAll(s, database.HighlightEnd, "</mark>")
+}
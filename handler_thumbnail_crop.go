@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// croppedJPEGQuality is the quality JPEG thumbnails are re-encoded with
+const croppedJPEGQuality = 90
+
+type thumbnailCropParams struct {
+	// Crop is the rectangle to keep, in fractions of the uncropped image
+	Crop *cropRect `json:"crop,omitempty"`
+	// FocalPoint keeps the largest area of AspectRatio centered on it as
+	// far as the image allows
+	FocalPoint *focalPoint `json:"focal_point,omitempty"`
+	// AspectRatio is the W:H shape of a focal point crop. Defaults to the
+	// video's own, or 16:9 if it isn't known.
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+}
+
+type cropRect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+type focalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// handlerThumbnailCrop recrops the video's thumbnail. The first crop keeps
+// the uncropped image, and every later one is cut from it again, so crops
+// don't compound and a full-size crop restores the original.
+func (cfg *apiConfig) handlerThumbnailCrop(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	annotateLog(w, "user_id", video.UserID, "video_id", video.ID)
+
+	var params thumbnailCropParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if (params.Crop == nil) == (params.FocalPoint == nil) {
+		respondWithError(w, http.StatusBadRequest, "Provide either a crop or a focal point", nil)
+		return
+	}
+	if video.ThumbnailURL == nil || *video.ThumbnailURL == "" {
+		respondWithError(w, http.StatusConflict, "Video has no thumbnail", nil)
+		return
+	}
+
+	var crop database.ThumbnailCrop
+	if params.Crop != nil {
+		c := *params.Crop
+		if c.X < 0 || c.Y < 0 || c.Width <= 0 || c.Height <= 0 || c.X+c.Width > 1 || c.Y+c.Height > 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid crop", fmt.Errorf("%+v is not inside the image", c))
+			return
+		}
+		crop = database.ThumbnailCrop{X: c.X, Y: c.Y, Width: c.Width, Height: c.Height}
+	}
+	if params.FocalPoint != nil {
+		if p := *params.FocalPoint; p.X < 0 || p.X > 1 || p.Y < 0 || p.Y > 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid focal point", fmt.Errorf("%+v is not inside the image", p))
+			return
+		}
+	}
+	ratio := 16.0 / 9.0
+	if video.AspectRatio != nil {
+		ratio = *video.AspectRatio
+	}
+	if params.AspectRatio != "" {
+		var err error
+		ratio, err = parseAspectRatio(params.AspectRatio)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid aspect ratio", err)
+			return
+		}
+	}
+
+	sourceURL := *video.ThumbnailURL
+	if video.ThumbnailSourceURL != nil {
+		sourceURL = *video.ThumbnailSourceURL
+	}
+	source, format, err := decodeAsset(filepath.Join(cfg.assetsRoot, path.Base(sourceURL)))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read thumbnail", err)
+		return
+	}
+	if params.FocalPoint != nil {
+		crop = fitCropAround(source.Bounds(), *params.FocalPoint, ratio)
+	}
+
+	var buf bytes.Buffer
+	cropped := cropImage(source, crop)
+	ext := ".png"
+	if format == "jpeg" {
+		ext = ".jpg"
+		err = jpeg.Encode(&buf, cropped, &jpeg.Options{Quality: croppedJPEGQuality})
+	} else {
+		err = png.Encode(&buf, cropped)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save file", err)
+		return
+	}
+
+	video, assetName, err := cfg.saveThumbnail(r, video, &buf, ext)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save file", err)
+		return
+	}
+	video.ThumbnailSourceURL = &sourceURL
+	video.ThumbnailCrop = &crop
+
+	if err := cfg.commitVideoUpdate(video, assetName); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate URL", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+func decodeAsset(name string) (image.Image, string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return image.Decode(f)
+}
+
+// fitCropAround returns the largest crop of the given W:H ratio that fits in
+// bounds, centered on focus unless that would run past an edge.
+func fitCropAround(bounds image.Rectangle, focus focalPoint, ratio float64) database.ThumbnailCrop {
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	cropW, cropH := width, width/ratio
+	if cropH > height {
+		cropW, cropH = height*ratio, height
+	}
+	left := math.Max(0, math.Min(focus.X*width-cropW/2, width-cropW))
+	top := math.Max(0, math.Min(focus.Y*height-cropH/2, height-cropH))
+
+	fx, fy := focus.X, focus.Y
+	return database.ThumbnailCrop{
+		X:      left / width,
+		Y:      top / height,
+		Width:  cropW / width,
+		Height: cropH / height,
+		FocusX: &fx,
+		FocusY: &fy,
+	}
+}
+
+// cropImage copies the part of img that crop covers, at least one pixel.
+func cropImage(img image.Image, crop database.ThumbnailCrop) image.Image {
+	b := img.Bounds()
+	width, height := float64(b.Dx()), float64(b.Dy())
+	x0 := b.Min.X + int(math.Round(crop.X*width))
+	y0 := b.Min.Y + int(math.Round(crop.Y*height))
+	x1 := min(b.Max.X, max(x0+1, b.Min.X+int(math.Round((crop.X+crop.Width)*width))))
+	y1 := min(b.Max.Y, max(y0+1, b.Min.Y+int(math.Round((crop.Y+crop.Height)*height))))
+	rect := image.Rect(x0, y0, x1, y1)
+
+	out := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(out, out.Bounds(), img, rect.Min, draw.Src)
+	return out
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+type trimParams struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+func (cfg *apiConfig) handlerTrimVideo(w http.ResponseWriter, r *http.Request) {
+	source, userID, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := trimParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	start, err := parseTimestamp(params.Start)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid start timestamp", err)
+		return
+	}
+	end, err := parseTimestamp(params.End)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid end timestamp", err)
+		return
+	}
+	if end <= start {
+		respondWithError(w, http.StatusBadRequest, "End must be after start", nil)
+		return
+	}
+
+	if source.VideoURL == nil || *source.VideoURL == "" {
+		respondWithError(w, http.StatusConflict, "Video has no uploaded file", nil)
+		return
+	}
+	bucket, key, err := splitVideoURL(*source.VideoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Invalid stored video URL", err)
+		return
+	}
+
+	// Fetch the source file
+	sourcePath, err := cfg.downloadObjectToTemp(cfg.lifecycle.ctx, bucket, key, "tubely-trim-source-*.mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch source video", err)
+		return
+	}
+	defer os.Remove(sourcePath)
+
+	duration, err := cfg.prober.Duration(cfg.lifecycle.ctx, sourcePath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to analyze video", err)
+		return
+	}
+	if end > duration {
+		respondWithError(w, http.StatusBadRequest, "End is past the end of the video", nil)
+		return
+	}
+
+	// Stream copy is only frame-accurate when the cut starts on a keyframe
+	aligned, err := cfg.prober.KeyframeAligned(cfg.lifecycle.ctx, sourcePath, start)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to analyze video", err)
+		return
+	}
+
+	trimmedPath := sourcePath + ".trimmed"
+	if err := cfg.transcoder.Trim(cfg.lifecycle.ctx, sourcePath, trimmedPath, start, end, !aligned); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Video trimming failed", err)
+		return
+	}
+	defer os.Remove(trimmedPath)
+
+	aspect, err := cfg.probeAspect(cfg.lifecycle.ctx, trimmedPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to analyze video", err)
+		return
+	}
+
+	trimmedFile, err := os.Open(trimmedPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to open trimmed video", err)
+		return
+	}
+	defer trimmedFile.Close()
+
+	trimmed, err := cfg.db.WithContext(r.Context()).CreateVideo(database.CreateVideoParams{
+		Title:       source.Title + " (trimmed)",
+		Description: source.Description,
+		UserID:      userID,
+		OrgID:       source.OrgID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
+		return
+	}
+	// The trim is restricted wherever its source is
+	if err := cfg.db.WithContext(r.Context()).CopyPlaybackRules(source.ID, trimmed.ID); err != nil {
+		cfg.db.WithContext(context.WithoutCancel(r.Context())).DeleteVideo(trimmed.ID)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't copy playback rules", err)
+		return
+	}
+
+	videoURL, err := cfg.publishVideoFile(cfg.lifecycle.ctx, trimmedFile, trimmed, aspect.Category)
+	if err != nil {
+		cfg.db.WithContext(context.WithoutCancel(r.Context())).DeleteVideo(trimmed.ID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload to S3", err)
+		return
+	}
+	trimmed.VideoURL = &videoURL
+	trimmed.Dimensions = aspect.dimensions()
+	trimmed.ProcessingStatus = database.ProcessingReady
+	trimmed.ThumbnailURL = source.ThumbnailURL
+	trimmed.ThumbnailPlaceholder = source.ThumbnailPlaceholder
+	trimmed.ThumbnailSourceURL = source.ThumbnailSourceURL
+	trimmed.ThumbnailCrop = source.ThumbnailCrop
+	trimmed.SourceVideoID = &source.ID
+	trimmed.ModerationStatus = source.ModerationStatus
+	trimmed.ModerationLabels = source.ModerationLabels
+	trimmed.ModerationReason = source.ModerationReason
+	trimmed.Visibility = source.Visibility
+	trimmed.AllowDownloads = source.AllowDownloads
+	trimmed.EmbedDomains = source.EmbedDomains
+
+	trimmed, err = cfg.commitTrimmedVideo(r.Context(), trimmed, videoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(trimmed)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, signedVideo)
+}
+
+// commitTrimmedVideo saves the trim's first version, removing the row that
+// was created for it if that fails.
+func (cfg *apiConfig) commitTrimmedVideo(ctx context.Context, trimmed database.Video, videoURL string) (database.Video, error) {
+	committed, err := cfg.commitVideoVersion(trimmed, videoURL)
+	if err != nil {
+		if err := cfg.db.WithContext(context.WithoutCancel(ctx)).DeleteVideo(trimmed.ID); err != nil {
+			slog.Warn("Couldn't delete unfinished trim", "video_id", trimmed.ID, "error", err)
+		}
+		return database.Video{}, err
+	}
+	return committed, nil
+}
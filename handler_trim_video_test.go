@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCommitTrimmedVideoFailure(t *testing.T) {
+	cfg, raw, bucket := newTestConfig(t)
+	trimmed := createTestVideo(t, cfg, "talk (trimmed)")
+
+	// Saving the version fails while the row can still be deleted
+	_, err := raw.Exec(`CREATE TRIGGER fail_versions BEFORE INSERT ON video_versions
+	BEGIN SELECT RAISE(ABORT, 'versions unavailable'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	videoURL := "b,landscape/trimmed.mp4"
+	trimmed.VideoURL = &videoURL
+	if _, err := cfg.commitTrimmedVideo(context.Background(), trimmed, videoURL); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	video, err := cfg.db.GetVideo(trimmed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.ID != uuid.Nil {
+		t.Error("the trimmed video's row was left behind")
+	}
+	if !slices.Contains(bucket.deletedPaths(), "/b/landscape/trimmed.mp4") {
+		t.Errorf("the trimmed rendition wasn't deleted, got %q", bucket.deletedPaths())
+	}
+}
+
+func TestCommitTrimmedVideo(t *testing.T) {
+	cfg, _, _ := newTestConfig(t)
+	trimmed := createTestVideo(t, cfg, "talk (trimmed)")
+
+	videoURL := "b,landscape/trimmed.mp4"
+	trimmed.VideoURL = &videoURL
+	committed, err := cfg.commitTrimmedVideo(context.Background(), trimmed, videoURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed.ID != trimmed.ID || committed.VideoURL == nil || *committed.VideoURL != videoURL {
+		t.Errorf("got %+v", committed)
+	}
+}
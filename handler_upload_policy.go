@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// directUploadExpiry is how long a client has to start a direct upload
+// once it has the policy.
+const directUploadExpiry = time.Hour
+
+// uploadPolicyResponse is a presigned POST: the client sends a
+// multipart/form-data POST to URL with every field, then the file as the
+// last field named "file".
+type uploadPolicyResponse struct {
+	URL       string            `json:"url"`
+	Fields    map[string]string `json:"fields"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	// MaxBytes and ContentType repeat the policy's conditions for clients
+	// that want to check before uploading
+	MaxBytes    int64  `json:"max_bytes"`
+	ContentType string `json:"content_type"`
+}
+
+// handlerUploadPolicy hands out a presigned POST for uploading the caller's
+// video straight to the ingest prefix, where the ingest consumer picks it
+// up. The signed policy carries the server's own limits, a
+// content-length-range up to maxVideoUploadBytes and the MP4 content type,
+// so S3 rejects what the upload endpoint would.
+func (cfg *apiConfig) handlerUploadPolicy(w http.ResponseWriter, r *http.Request) {
+	if !cfg.directUploads {
+		respondWithError(w, http.StatusNotFound, "Direct uploads are not enabled", nil)
+		return
+	}
+	video, userID, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	annotateLog(w, "user_id", userID, "video_id", video.ID)
+
+	const contentType = "video/mp4"
+	key := directUploadKey(cfg.ingestPrefix, userID, video.ID)
+	fields := cfg.s3SSE.postFields()
+	fields["Content-Type"] = contentType
+	conditions := []interface{}{
+		[]interface{}{"content-length-range", 1, maxVideoUploadBytes},
+	}
+	for name, value := range fields {
+		conditions = append(conditions, map[string]string{name: value})
+	}
+
+	expiresAt := time.Now().Add(directUploadExpiry)
+	post, err := s3.NewPresignClient(cfg.s3Client).PresignPostObject(r.Context(),
+		&s3.PutObjectInput{
+			Bucket: aws.String(cfg.s3Bucket),
+			Key:    aws.String(key),
+		},
+		func(o *s3.PresignPostOptions) {
+			o.Expires = directUploadExpiry
+			o.Conditions = conditions
+		},
+	)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload policy", err)
+		return
+	}
+	for name, value := range fields {
+		post.Values[name] = value
+	}
+
+	respondWithJSON(w, http.StatusOK, uploadPolicyResponse{
+		URL:         post.URL,
+		Fields:      post.Values,
+		ExpiresAt:   expiresAt.UTC(),
+		MaxBytes:    maxVideoUploadBytes,
+		ContentType: contentType,
+	})
+}
+
+// directUploadKey is where a direct upload for the video goes, named so
+// ingestObject matches it back to the video.
+func directUploadKey(prefix string, userID, videoID uuid.UUID) string {
+	return fmt.Sprintf("%s%s/%s.mp4", prefix, userID, videoID)
+}
@@ -1,12 +1,11 @@
 package main
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 	"io"
 	"mime"
@@ -40,6 +39,10 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	// Parse multipart form (10MB limit)
 	const maxMemory = 10 << 20 // 10MB
 	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		if errors.Is(err, errUploadTooSlow) {
+			respondWithError(w, http.StatusRequestTimeout, "Upload is too slow", err)
+			return
+		}
 		respondWithError(w, http.StatusBadRequest, "Error parsing form", err)
 		return
 	}
@@ -57,7 +60,7 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	parsedMediaType, _, err := mime.ParseMediaType(mediaTypeWithParams)
 	//ext, err := getImageExtensionFromMIME(mediaType)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid Content-Type header", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid Content-Type", err)
 		return
 	}
 
@@ -76,34 +79,8 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		ext = ".png"
 	}
 
-	// Generate random filename
-	randomBytes := make([]byte, 32)
-	if _, err := rand.Read(randomBytes); err != nil {
-		respondWithError(w, http.StatusInternalServerError,
-			"Failed to generate filename", err)
-		return
-	}
-
-	// Create filename and path
-	filename := base64.RawURLEncoding.EncodeToString(randomBytes) + ext
-	filePath := filepath.Join(cfg.assetsRoot, filename)
-
-	// Create destination file
-	dst, err := os.Create(filePath)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create file", err)
-		return
-	}
-	defer dst.Close()
-
-	// Copy file contents
-	if _, err := io.Copy(dst, file); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to save file", err)
-		return
-	}
-
 	// Get video metadata
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(videoID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			respondWithError(w, http.StatusNotFound, "Video not found", nil)
@@ -120,16 +97,36 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if video.UserID != userUUID {
+	canManage, err := cfg.canManageVideo(r.Context(), userUUID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+	if !canManage {
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized access", nil)
 		return
 	}
+	annotateLog(w, "user_id", userUUID, "video_id", video.ID, "upload_bytes", header.Size)
 
-	// Update database with new URL
-	thumbnailURL := fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, filename)
-	video.ThumbnailURL = &thumbnailURL
+	// Scan before anything is written to the assets directory
+	if !cfg.scanUpload(r.Context(), w, file, header.Filename) {
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save file", err)
+		return
+	}
+
+	// Store the file and point the video at it
+	video, assetName, err := cfg.saveThumbnail(r, video, file, ext)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save file", err)
+		return
+	}
+	// A custom upload replaces any frame picked from the video
+	video.PosterTimestamp = nil
 
-	err = cfg.db.UpdateVideo(video)
+	err = cfg.commitVideoUpdate(video, assetName)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
 		return
@@ -137,3 +134,36 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 
 	respondWithJSON(w, http.StatusOK, video)
 }
+
+// saveThumbnail writes src under assetsRoot with a random name and sets the
+// video's thumbnail URL to it, under the address r was sent to, returning
+// the name. Any crop of the previous thumbnail is dropped. The caller persists the video.
+func (cfg *apiConfig) saveThumbnail(r *http.Request, video database.Video, src io.Reader, ext string) (database.Video, string, error) {
+	filename, err := randomAssetName(ext)
+	if err != nil {
+		return video, "", err
+	}
+	filePath := filepath.Join(cfg.assetsRoot, filename)
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return video, "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(filePath)
+		return video, "", fmt.Errorf("failed to save file: %w", err)
+	}
+	if err := cfg.recordAsset(filename, video.ID); err != nil {
+		os.Remove(filePath)
+		return video, "", fmt.Errorf("failed to record file: %w", err)
+	}
+
+	thumbnailURL := cfg.requestAssetURL(r, filename)
+	video.ThumbnailURL = &thumbnailURL
+	video.ThumbnailPlaceholder = cfg.thumbnailPlaceholder(filename)
+	video.ThumbnailSourceURL = nil
+	video.ThumbnailCrop = nil
+	return video, filename, nil
+}
@@ -4,20 +4,18 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
-	"encoding/base64"
-	"encoding/json"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
 	"io"
-	"math"
 	"mime"
 	"net/http"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -26,88 +24,21 @@ import (
 	"github.com/google/uuid"
 )
 
-// ffprobeOutput struct
-type ffprobeOutput struct {
-	Streams []struct {
-		CodecType string `json:"codec_type"`
-		Width     int    `json:"width"`
-		Height    int    `json:"height"`
-	} `json:"streams"`
-}
-
-// getVideoAspectRatio determines video aspect ratio using ffprobe
-func getVideoAspectRatio(filePath string) (string, error) {
-	cmd := exec.Command("ffprobe", "-v", "error",
-		"-print_format", "json",
-		"-show_streams", filePath)
-
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("ffprobe failed: %w", err)
-	}
-
-	var output ffprobeOutput
-	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
-		return "", fmt.Errorf("failed to parse ffprobe output: %w", err)
-	}
+// presignExpiry is how long presigned GET URLs handed to clients stay valid
+const presignExpiry = 15 * time.Minute
 
-	// Find first video stream
-	var width, height int
-	for _, stream := range output.Streams {
-		if stream.CodecType == "video" {
-			width = stream.Width
-			height = stream.Height
-			break
-		}
-	}
-
-	if width == 0 || height == 0 {
-		return "", fmt.Errorf("no video stream found")
-	}
-
-	// Calculate aspect ratio with tolerance
-	ratio := float64(width) / float64(height)
-	const tolerance = 0.05
-	landscapeTarget := 16.0 / 9.0
-	portraitTarget := 9.0 / 16.0
-
-	switch {
-	case math.Abs(ratio-landscapeTarget) <= landscapeTarget*tolerance:
-		return "landscape", nil
-	case math.Abs(ratio-portraitTarget) <= portraitTarget*tolerance:
-		return "portrait", nil
-	default:
-		return "other", nil
-	}
-}
-
-// processVideoForFastStart processes video for streaming optimization
-func processVideoForFastStart(filePath string) (string, error) {
+// processVideoForFastStart processes video for streaming optimization.
+// If metadataPath is set, chapters from that ffmetadata file are embedded.
+func (cfg *apiConfig) processVideoForFastStart(ctx context.Context, filePath, metadataPath string, defaultAudio int) (string, error) {
 	outputPath := filePath + ".processing"
-
-	cmd := exec.Command("ffmpeg",
-		"-i", filePath, // Input file
-		"-c", "copy", // Copy codec without re-encoding
-		"-movflags", "faststart", // Move metadata to beginning
-		"-f", "mp4", // Force MP4 format
-		outputPath, // Output file
-	)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("ffmpeg failed: %w\nStderr: %s", err, stderr.String())
+	if err := cfg.transcoder.FastStart(ctx, filePath, metadataPath, outputPath, defaultAudio); err != nil {
+		return "", err
 	}
-
 	return outputPath, nil
 }
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
-	// Set 1GB upload limit
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<30)
+	r.Body = http.MaxBytesReader(w, r.Body, maxVideoUploadBytes)
 
 	// Get video ID from URL
 	videoIDString := r.PathValue("videoID")
@@ -131,7 +62,7 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Get video metadata
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(videoID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			respondWithError(w, http.StatusNotFound, "Video not found", nil)
@@ -148,17 +79,52 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if video.UserID != userUUID {
+	canManage, err := cfg.canManageVideo(r.Context(), userUUID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+	if !canManage {
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized access", nil)
 		return
 	}
+	annotateLog(w, "user_id", userUUID, "video_id", video.ID)
+
+	// Refuse uploads that can't fit on disk before spooling any of them
+	if !cfg.ensureUploadDiskSpace(w, r) {
+		return
+	}
 
 	// Parse multipart form
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
+	err = withSpan(r.Context(), "multipart parse", func(context.Context) error {
+		return r.ParseMultipartForm(10 << 20)
+	})
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large", err)
+		return
+	}
+	if errors.Is(err, errUploadTooSlow) {
+		respondWithError(w, http.StatusRequestTimeout, "Upload is too slow", err)
+		return
+	}
+	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Error parsing form", err)
 		return
 	}
 
+	// The form field and the query parameter both land in FormValue
+	profile, ok := cfg.processingProfile(r.FormValue("profile"))
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Unknown processing profile", fmt.Errorf("no profile %q", r.FormValue("profile")))
+		return
+	}
+	audioLanguage, err := parseAudioLanguage(r.FormValue("audio_language"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid audio language", err)
+		return
+	}
+
 	// Get video file from form
 	file, header, err := r.FormFile("video")
 	if err != nil {
@@ -180,95 +146,123 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Create temp file
-	tempFile, err := os.CreateTemp("", "tubely-upload-*.mp4")
+	expectedChecksum, err := parseExpectedChecksum(r.Header.Get(checksumHeader))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid checksum header", err)
+		return
+	}
+
+	// Stage the upload where the processing job can find it after a restart
+	tempFile, err := os.CreateTemp(cfg.stagingDir, "upload-*.mp4")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create temp file", err)
 		return
 	}
-	defer os.Remove(tempFile.Name())
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			os.Remove(tempFile.Name())
+		}
+	}()
 	defer tempFile.Close()
 
-	// Copy to temp file
-	if _, err := io.Copy(tempFile, file); err != nil {
+	// Copy to temp file, hashing the bytes as they arrive
+	hasher := sha256.New()
+	var written int64
+	err = withSpan(r.Context(), "stage upload", func(context.Context) error {
+		var err error
+		written, err = io.Copy(io.MultiWriter(tempFile, hasher), file)
+		return err
+	})
+	annotateLog(w, "upload_bytes", written)
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError,
 			"Failed to save video", err)
 		return
 	}
-
-	// Reset file pointer
-	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
-		respondWithError(w, http.StatusInternalServerError,
-			"Failed to process video", err)
+	digest := hasher.Sum(nil)
+	if expectedChecksum != nil && !bytes.Equal(digest, expectedChecksum) {
+		respondWithError(w, http.StatusBadRequest, "Checksum mismatch",
+			fmt.Errorf("received %x, expected %x", digest, expectedChecksum))
 		return
 	}
 
-	// Get aspect ratio
-	aspect, err := getVideoAspectRatio(tempFile.Name())
-	if err != nil {
+	// Close so ffmpeg sees the fully flushed file
+	if err := tempFile.Close(); err != nil {
 		respondWithError(w, http.StatusInternalServerError,
-			"Failed to analyze video", err)
+			"Failed to save video", err)
 		return
 	}
 
-	// Process video for fast start
-	processedPath, err := processVideoForFastStart(tempFile.Name())
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError,
-			"Video processing failed", err)
+	// Nothing reaches S3 before the scanner has cleared it
+	if !cfg.scanUploadedFile(r.Context(), w, tempFile.Name(), header.Filename) {
+		return
+	}
+	// Nor anything over the owner's duration limit
+	duration, err := cfg.probeVideoLength(r.Context(), video.UserID, tempFile.Name())
+	if respondWithVideoTooLong(w, err) {
 		return
 	}
-	defer os.Remove(processedPath)
-
-	// Open processed file
-	processedFile, err := os.Open(processedPath)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError,
-			"Failed to open processed video", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
 		return
 	}
-	defer processedFile.Close()
-
-	// Reset file pointer
-	if _, err := processedFile.Seek(0, io.SeekStart); err != nil {
-		respondWithError(w, http.StatusInternalServerError,
-			"Failed to read processed video", err)
+	if respondWithAudioLanguageMissing(w, cfg.checkAudioLanguage(r.Context(), tempFile.Name(), audioLanguage)) {
 		return
 	}
 
-	// Generate S3 key with aspect prefix
-	randomBytes := make([]byte, 32)
-	if _, err := rand.Read(randomBytes); err != nil {
-		respondWithError(w, http.StatusInternalServerError,
-			"Failed to generate filename", err)
+	sourceChecksum := hex.EncodeToString(digest)
+	supersededURLs := videoObjectURLs(video.VideoURL, video.PreviewURL, video.SDRVideoURL, video.OriginalURL)
+
+	// A byte-identical upload reuses the renditions already in S3
+	duplicate, err := cfg.findDuplicateUpload(r.Context(), video, sourceChecksum)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
 		return
 	}
-	baseName := base64.RawURLEncoding.EncodeToString(randomBytes)
-	objectKey := fmt.Sprintf("%s/%s.mp4", aspect, baseName)
 
-	// Upload processed file to S3
-	_, err = cfg.s3Client.PutObject(context.Background(), &s3.PutObjectInput{
-		Bucket:      aws.String(cfg.s3Bucket),
-		Key:         aws.String(objectKey),
-		Body:        processedFile,
-		ContentType: aws.String("video/mp4"),
-	})
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError,
-			"Failed to upload to S3", err)
+	if duplicate.ID == uuid.Nil {
+		// Process in the background; the client follows the returned job
+		job, err := cfg.enqueueProcessVideo(r.Context(), video, processVideoParams{
+			StagingPath:    tempFile.Name(),
+			SHA256:         sourceChecksum,
+			SupersededURLs: supersededURLs,
+			Profile:        &profile,
+			AudioLanguage:  audioLanguage,
+		}, duration)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create job", err)
+			return
+		}
+		handedOff = true
+		if err := cfg.db.WithContext(context.WithoutCancel(r.Context())).SetVideoProcessingStatus(video.ID, database.ProcessingQueued); err != nil {
+			requestLogger(r).Warn("Couldn't update processing status", "video_id", video.ID, "error", err)
+		}
+		requestLogger(r).Info("Video upload queued for processing",
+			"user_id", video.UserID, "video_id", video.ID, "job_id", job.ID,
+			"upload_bytes", written, "sha256", sourceChecksum, "profile", profile.Name)
+
+		respondWithJSON(w, http.StatusAccepted, newJobResponse(i18n.FromContext(r.Context()), job))
 		return
 	}
 
-	videoURL := fmt.Sprintf("%s,%s", cfg.s3Bucket, objectKey)
-	video.VideoURL = &videoURL
+	requestLogger(r).Info("Video upload duplicates an existing video, sharing its objects",
+		"user_id", video.UserID, "video_id", video.ID, "duplicate_of", duplicate.ID,
+		"upload_bytes", written, "sha256", sourceChecksum)
+	video = shareRenditions(video, duplicate)
+	video.SHA256 = &sourceChecksum
+	video.ProcessingStatus = database.ProcessingReady
 
 	// Update database
-	err = cfg.db.UpdateVideo(video)
+	video, err = cfg.db.WithContext(r.Context()).UpdateVideoAsNewVersion(video)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
 		return
 	}
 
+	// Only renditions no version references anymore are tagged
+	cfg.markObjectsSuperseded(context.WithoutCancel(r.Context()), supersededURLs...)
+
 	// Convert to signed URL before responding
 	signedVideo, err := cfg.dbVideoToSignedVideo(video)
 	if err != nil {
@@ -279,6 +273,93 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	respondWithJSON(w, http.StatusOK, signedVideo)
 }
 
+// publishVideoFile uploads a processed MP4 as the video's stream rendition
+// under the configured key layout, verifies it and returns the "bucket,key"
+// value stored in the video's VideoURL.
+func (cfg *apiConfig) publishVideoFile(ctx context.Context, f *os.File, video database.Video, aspect string) (string, error) {
+	keyParams := videoKeyParams(video, aspect)
+	objectKey, err := cfg.keyTemplate.render(keyParams)
+	if err != nil {
+		return "", err
+	}
+
+	return cfg.publishFile(ctx, f, objectKey, "video/mp4", keyParams.tags("video/mp4"))
+}
+
+// publishVideoStream is publishVideoFile for a rendition written by write
+// as it is produced.
+func (cfg *apiConfig) publishVideoStream(ctx context.Context, video database.Video, aspect string, write func(io.Writer) error) (string, error) {
+	keyParams := videoKeyParams(video, aspect)
+	objectKey, err := cfg.keyTemplate.render(keyParams)
+	if err != nil {
+		return "", err
+	}
+
+	return cfg.publishStream(ctx, objectKey, "video/mp4", keyParams.tags("video/mp4"), write)
+}
+
+// videoKeyParams are the key template inputs for the stream rendition.
+func videoKeyParams(video database.Video, aspect string) objectKeyParams {
+	return objectKeyParams{
+		UserID:    video.UserID,
+		OrgID:     video.OrgID,
+		VideoID:   video.ID,
+		Aspect:    aspect,
+		Rendition: renditionStream,
+		Folder:    aspect,
+		Ext:       "mp4",
+	}
+}
+
+// previewKeyParams are the key template inputs for the preview rendition.
+func previewKeyParams(video database.Video, aspect string) objectKeyParams {
+	return objectKeyParams{
+		UserID:    video.UserID,
+		OrgID:     video.OrgID,
+		VideoID:   video.ID,
+		Aspect:    aspect,
+		Rendition: renditionPreview,
+		Folder:    "previews",
+		Ext:       "mp4",
+	}
+}
+
+// sdrKeyParams are the key template inputs for the tonemapped rendition of
+// an HDR video.
+func sdrKeyParams(video database.Video, aspect string) objectKeyParams {
+	return objectKeyParams{
+		UserID:    video.UserID,
+		OrgID:     video.OrgID,
+		VideoID:   video.ID,
+		Aspect:    aspect,
+		Rendition: renditionSDR,
+		Folder:    "sdr",
+		Ext:       "mp4",
+	}
+}
+
+// originalKeyParams are the key template inputs for the kept upload.
+func originalKeyParams(video database.Video, aspect string) objectKeyParams {
+	return objectKeyParams{
+		UserID:    video.UserID,
+		OrgID:     video.OrgID,
+		VideoID:   video.ID,
+		Aspect:    aspect,
+		Rendition: renditionOriginal,
+		Folder:    "originals",
+		Ext:       "mp4",
+	}
+}
+
+// splitVideoURL splits a stored "bucket,key" VideoURL into its parts.
+func splitVideoURL(videoURL string) (bucket, key string, err error) {
+	parts := strings.SplitN(videoURL, ",", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid video URL format: %s", videoURL)
+	}
+	return parts[0], parts[1], nil
+}
+
 func generatePresignedURL(s3Client *s3.Client, bucket, key string, expireTime time.Duration) (string, error) {
 	presignClient := s3.NewPresignClient(s3Client)
 
@@ -304,20 +385,35 @@ func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video
 		return video, nil
 	}
 
-	parts := strings.SplitN(*video.VideoURL, ",", 2)
-	if len(parts) != 2 {
-		// Log but don't fail the entire request
-		return video, fmt.Errorf("invalid video URL format: %s", *video.VideoURL)
+	// Presigned URLs work for whoever has them, so videos with playback
+	// rules are always played through the proxy that checks them
+	proxy := cfg.streamProxy
+	if !proxy {
+		var err error
+		proxy, err = cfg.db.HasPlaybackRules(video.ID)
+		if err != nil {
+			return video, err
+		}
 	}
-
-	bucket := parts[0]
-	key := parts[1]
-
-	url, err := generatePresignedURL(cfg.s3Client, bucket, key, 15*time.Minute)
+	url, err := cfg.playbackURL(video, renditionStream, *video.VideoURL, proxy)
 	if err != nil {
 		return video, err
 	}
 
+	if video.PreviewURL != nil && *video.PreviewURL != "" {
+		previewURL, err := cfg.playbackURL(video, renditionPreview, *video.PreviewURL, proxy)
+		if err != nil {
+			return video, err
+		}
+		video.PreviewURL = &previewURL
+	}
+	if video.SDRVideoURL != nil && *video.SDRVideoURL != "" {
+		sdrURL, err := cfg.playbackURL(video, renditionSDR, *video.SDRVideoURL, proxy)
+		if err != nil {
+			return video, err
+		}
+		video.SDRVideoURL = &sdrURL
+	}
 	video.VideoURL = &url
 	return video, nil
 }
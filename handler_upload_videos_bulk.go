@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxVideoUploadBytes is the largest video file accepted
+	maxVideoUploadBytes = 1 << 30
+	// maxBulkUploadFiles is how many videos one bulk request may carry
+	maxBulkUploadFiles = 50
+	// maxBulkUploadBytes bounds a whole bulk request
+	maxBulkUploadBytes = 20 << 30
+	// maxProfileNameBytes bounds how much of the profile part is read
+	maxProfileNameBytes = 256
+)
+
+// bulkUploadEntry is one element of the optional manifest part, applied to
+// the video part in the same position.
+type bulkUploadEntry struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// AudioLanguage is the upload's audio_language
+	AudioLanguage string `json:"audio_language"`
+}
+
+// stagedUpload is a video part written to the staging directory.
+type stagedUpload struct {
+	Filename string
+	Path     string
+	SHA256   string
+}
+
+// handlerUploadVideosBulk creates a video and a process_video job for each
+// "video" part of the request. Every file is staged and scanned before any
+// video is created, so a bad file fails the whole request and nothing is
+// left behind.
+func (cfg *apiConfig) handlerUploadVideosBulk(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkUploadBytes)
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid JWT", err)
+		return
+	}
+	annotateLog(w, "user_id", userID)
+
+	if !cfg.ensureUploadDiskSpace(w, r) {
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error parsing form", err)
+		return
+	}
+
+	var manifest []bulkUploadEntry
+	profileName := r.URL.Query().Get("profile")
+	var staged []stagedUpload
+	handedOff := 0
+	defer func() {
+		for _, upload := range staged[handedOff:] {
+			os.Remove(upload.Path)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large", err)
+			return
+		}
+		if errors.Is(err, errUploadTooSlow) {
+			respondWithError(w, http.StatusRequestTimeout, "Upload is too slow", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Error parsing form", err)
+			return
+		}
+
+		switch part.FormName() {
+		case "manifest":
+			if err := json.NewDecoder(part).Decode(&manifest); err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid manifest", err)
+				return
+			}
+		case "profile":
+			dat, err := io.ReadAll(io.LimitReader(part, maxProfileNameBytes))
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Error parsing form", err)
+				return
+			}
+			profileName = string(dat)
+		case "video":
+			if len(staged) == maxBulkUploadFiles {
+				respondWithError(w, http.StatusBadRequest, "Too many files", fmt.Errorf("at most %d videos per request", maxBulkUploadFiles))
+				return
+			}
+			upload, ok := cfg.stageVideoPart(r.Context(), w, part)
+			if !ok {
+				return
+			}
+			staged = append(staged, upload)
+		}
+		part.Close()
+	}
+
+	if len(staged) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Missing video file", nil)
+		return
+	}
+	if manifest != nil && len(manifest) != len(staged) {
+		respondWithError(w, http.StatusBadRequest, "Manifest must have one entry per video",
+			fmt.Errorf("%d manifest entries for %d videos", len(manifest), len(staged)))
+		return
+	}
+
+	profile, ok := cfg.processingProfile(profileName)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Unknown processing profile", fmt.Errorf("no profile %q", profileName))
+		return
+	}
+	audioLanguages := make([]string, len(staged))
+	for i := range manifest {
+		audioLanguages[i], err = parseAudioLanguage(manifest[i].AudioLanguage)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid audio language", err)
+			return
+		}
+	}
+
+	// Nothing is processed before every file has been cleared
+	for _, upload := range staged {
+		if !cfg.scanUploadedFile(r.Context(), w, upload.Path, upload.Filename) {
+			return
+		}
+	}
+	// and is within the duration limit, with the audio language it asked for
+	durations := make([]*float64, len(staged))
+	for i, upload := range staged {
+		durations[i], err = cfg.probeVideoLength(r.Context(), userID, upload.Path)
+		if respondWithVideoTooLong(w, fmt.Errorf("%s: %w", upload.Filename, err)) {
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error", err)
+			return
+		}
+		err = cfg.checkAudioLanguage(r.Context(), upload.Path, audioLanguages[i])
+		if respondWithAudioLanguageMissing(w, fmt.Errorf("%s: %w", upload.Filename, err)) {
+			return
+		}
+	}
+
+	lang := i18n.FromContext(r.Context())
+	jobs := make([]jobResponse, 0, len(staged))
+	videoIDs := make([]uuid.UUID, 0, len(staged))
+	for i, upload := range staged {
+		params := database.CreateVideoParams{
+			Title:  strings.TrimSuffix(upload.Filename, filepath.Ext(upload.Filename)),
+			UserID: userID,
+		}
+		if manifest != nil {
+			if manifest[i].Title != "" {
+				params.Title = manifest[i].Title
+			}
+			params.Description = manifest[i].Description
+		}
+		video, err := cfg.db.WithContext(r.Context()).CreateVideo(params)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
+			return
+		}
+
+		job, err := cfg.enqueueProcessVideo(r.Context(), video, processVideoParams{
+			StagingPath:   upload.Path,
+			SHA256:        upload.SHA256,
+			Profile:       &profile,
+			AudioLanguage: audioLanguages[i],
+		}, durations[i])
+		if err != nil {
+			cfg.db.WithContext(context.WithoutCancel(r.Context())).DeleteVideo(video.ID)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create job", err)
+			return
+		}
+		handedOff++
+		videoIDs = append(videoIDs, video.ID)
+		if err := cfg.db.WithContext(context.WithoutCancel(r.Context())).SetVideoProcessingStatus(video.ID, database.ProcessingQueued); err != nil {
+			requestLogger(r).Warn("Couldn't update processing status", "video_id", video.ID, "error", err)
+		}
+		requestLogger(r).Info("Video upload queued for processing",
+			"user_id", userID, "video_id", video.ID, "job_id", job.ID, "sha256", upload.SHA256, "profile", profile.Name)
+		jobs = append(jobs, newJobResponse(lang, job))
+	}
+	requestAudit(r).Set("video_ids", videoIDs)
+
+	respondWithJSON(w, http.StatusAccepted, jobs)
+}
+
+// stageVideoPart copies one MP4 part into the staging directory, hashing it
+// on the way. If it fails the error response has been written and ok is
+// false.
+func (cfg *apiConfig) stageVideoPart(ctx context.Context, w http.ResponseWriter, part *multipart.Part) (upload stagedUpload, ok bool) {
+	upload.Filename = part.FileName()
+
+	mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Content-Type", err)
+		return stagedUpload{}, false
+	}
+	if mediaType != "video/mp4" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Only MP4 videos are allowed", fmt.Errorf("%s is %s", upload.Filename, mediaType))
+		return stagedUpload{}, false
+	}
+
+	f, err := os.CreateTemp(cfg.stagingDir, "upload-*.mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create temp file", err)
+		return stagedUpload{}, false
+	}
+	defer f.Close()
+	upload.Path = f.Name()
+
+	hasher := sha256.New()
+	var written int64
+	err = withSpan(ctx, "stage upload", func(context.Context) error {
+		var err error
+		written, err = io.Copy(io.MultiWriter(f, hasher), io.LimitReader(part, maxVideoUploadBytes+1))
+		if err == nil {
+			err = f.Close()
+		}
+		return err
+	})
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		os.Remove(upload.Path)
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large", err)
+		return stagedUpload{}, false
+	case errors.Is(err, errUploadTooSlow):
+		os.Remove(upload.Path)
+		respondWithError(w, http.StatusRequestTimeout, "Upload is too slow", err)
+		return stagedUpload{}, false
+	case err != nil:
+		os.Remove(upload.Path)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save video", err)
+		return stagedUpload{}, false
+	case written > maxVideoUploadBytes:
+		os.Remove(upload.Path)
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large", fmt.Errorf("%s is over %d bytes", upload.Filename, maxVideoUploadBytes))
+		return stagedUpload{}, false
+	}
+
+	upload.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return upload, true
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// exportManifestExpiry is how long the URLs of an export manifest work,
+// long enough to download a large library one file at a time.
+const exportManifestExpiry = 6 * time.Hour
+
+// exportMetadataName is the archive entry describing everything else in it
+const exportMetadataName = "export.json"
+
+// userExport is the metadata of a user's export: their account and every
+// video, including trashed ones, with the archive paths of its files.
+type userExport struct {
+	ExportedAt time.Time     `json:"exported_at"`
+	User       exportUser    `json:"user"`
+	Videos     []videoExport `json:"videos"`
+	// Missing lists files that couldn't be read into the archive, e.g.
+	// originals moved to Glacier
+	Missing []string `json:"missing,omitempty"`
+}
+
+type exportUser struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type videoExport struct {
+	database.Video
+	// Thumbnail is the archive path of the thumbnail, if the video has one
+	Thumbnail string             `json:"thumbnail,omitempty"`
+	Chapters  []database.Chapter `json:"chapters"`
+	Versions  []versionExport    `json:"versions"`
+}
+
+type versionExport struct {
+	database.VideoVersion
+	// Files maps each rendition (stream, preview, original) to its archive
+	// path. Versions sharing an object point at the same path.
+	Files map[string]string `json:"files"`
+}
+
+// exportFile is one file of an export, either an S3 object or an asset
+// under ASSETS_ROOT.
+type exportFile struct {
+	Path      string `json:"path"`
+	URL       string `json:"url"`
+	objectURL string
+	assetName string
+	// video is whose egress streaming the object counts towards
+	video database.Video
+}
+
+// exportManifest is the ?format=manifest response: the metadata plus a
+// presigned URL for each file, for exports too large to stream at once.
+type exportManifest struct {
+	userExport
+	Files     []exportFile `json:"files"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+// handlerUserExport streams an archive of the caller's own data.
+func (cfg *apiConfig) handlerUserExport(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	cfg.respondWithUserExport(w, r, userID)
+}
+
+// handlerAdminUserExport streams the archive of any user, for handling
+// data requests on their behalf.
+func (cfg *apiConfig) handlerAdminUserExport(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	cfg.respondWithUserExport(w, r, userID)
+}
+
+// respondWithUserExport writes the user's export as a ZIP, or as a manifest
+// of presigned URLs with ?format=manifest.
+func (cfg *apiConfig) respondWithUserExport(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "zip" && format != "manifest" {
+		respondWithError(w, http.StatusBadRequest, "Format must be zip or manifest", nil)
+		return
+	}
+
+	user, err := cfg.db.WithContext(r.Context()).GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+	export, files, err := cfg.buildUserExport(r.Context(), *user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't build export", err)
+		return
+	}
+	annotateLog(w, "user_id", userID, "export_files", len(files))
+
+	if format == "manifest" {
+		manifest := exportManifest{
+			userExport: export,
+			Files:      files,
+			ExpiresAt:  time.Now().Add(exportManifestExpiry).UTC(),
+		}
+		for i, file := range manifest.Files {
+			if file.assetName != "" {
+				manifest.Files[i].URL = cfg.requestAssetURL(r, file.assetName)
+				continue
+			}
+			bucket, key, err := splitVideoURL(file.objectURL)
+			if err == nil {
+				manifest.Files[i].URL, err = generatePresignedURL(cfg.s3Client, bucket, key, exportManifestExpiry)
+			}
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't build export", err)
+				return
+			}
+		}
+		respondWithJSON(w, http.StatusOK, manifest)
+		return
+	}
+
+	// The archive goes through the server like the stream proxy, so the
+	// same caps apply; the manifest's presigned URLs aren't counted
+	checked := map[uuid.UUID]bool{}
+	for _, file := range files {
+		if file.objectURL == "" || checked[file.video.ID] {
+			continue
+		}
+		checked[file.video.ID] = true
+		reached, err := cfg.egressCapReached(r.Context(), file.video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check egress", err)
+			return
+		}
+		if reached {
+			respondWithEgressCapReached(w)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tubely-export-%s.zip"`, userID))
+	w.WriteHeader(http.StatusOK)
+
+	// Once streaming has started errors can't be reported; leaving out the
+	// central directory makes the truncated archive fail to open
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		written, err := cfg.writeExportFile(r.Context(), zw, file)
+		if file.objectURL != "" {
+			cfg.recordEgress(file.video, database.EgressProxy, written)
+		}
+		if err == nil {
+			continue
+		}
+		if r.Context().Err() != nil {
+			return
+		}
+		var missing missingExportFileError
+		if !errors.As(err, &missing) {
+			requestLogger(r).Error("Export aborted", "user_id", userID, "path", file.Path, "error", err)
+			return
+		}
+		requestLogger(r).Warn("Leaving file out of export", "user_id", userID, "path", file.Path, "error", err)
+		export.Missing = append(export.Missing, file.Path)
+	}
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: exportMetadataName, Method: zip.Deflate, Modified: export.ExportedAt})
+	if err == nil {
+		enc := json.NewEncoder(entry)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(export)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		requestLogger(r).Error("Export aborted", "user_id", userID, "path", exportMetadataName, "error", err)
+	}
+}
+
+// buildUserExport collects the user's metadata and the files to archive,
+// each object listed once even if several versions or videos share it.
+func (cfg *apiConfig) buildUserExport(ctx context.Context, user database.User) (userExport, []exportFile, error) {
+	videos, err := cfg.db.WithContext(ctx).GetVideos(user.ID)
+	if err != nil {
+		return userExport{}, nil, fmt.Errorf("couldn't get videos: %w", err)
+	}
+	trashed, err := cfg.db.WithContext(ctx).GetTrashedVideos(user.ID)
+	if err != nil {
+		return userExport{}, nil, fmt.Errorf("couldn't get trashed videos: %w", err)
+	}
+
+	export := userExport{
+		ExportedAt: time.Now().UTC(),
+		User:       exportUser{ID: user.ID, Email: user.Email, CreatedAt: user.CreatedAt},
+		Videos:     []videoExport{},
+	}
+	var files []exportFile
+	paths := map[string]string{}
+	addObject := func(video database.Video, objectURL *string, name string) string {
+		if objectURL == nil || *objectURL == "" {
+			return ""
+		}
+		if p, ok := paths[*objectURL]; ok {
+			return p
+		}
+		paths[*objectURL] = name
+		files = append(files, exportFile{Path: name, objectURL: *objectURL, video: video})
+		return name
+	}
+
+	for _, video := range append(videos, trashed...) {
+		chapters, err := cfg.db.WithContext(ctx).GetChapters(video.ID)
+		if err != nil {
+			return userExport{}, nil, fmt.Errorf("couldn't get chapters: %w", err)
+		}
+		versions, err := cfg.db.WithContext(ctx).GetVideoVersions(video.ID)
+		if err != nil {
+			return userExport{}, nil, fmt.Errorf("couldn't get versions: %w", err)
+		}
+
+		dir := "videos/" + video.ID.String()
+		entry := videoExport{Video: video, Chapters: chapters, Versions: []versionExport{}}
+		if video.ThumbnailURL != nil && *video.ThumbnailURL != "" {
+			assetName := path.Base(*video.ThumbnailURL)
+			entry.Thumbnail = dir + "/thumbnail" + path.Ext(assetName)
+			files = append(files, exportFile{Path: entry.Thumbnail, assetName: assetName})
+		}
+		for _, v := range versions {
+			versionDir := fmt.Sprintf("%s/v%d", dir, v.Version)
+			renditions := map[string]string{}
+			for _, r := range []struct {
+				name      string
+				objectURL *string
+			}{
+				{renditionStream, v.VideoURL},
+				{renditionPreview, v.PreviewURL},
+				{renditionSDR, v.SDRVideoURL},
+				{renditionOriginal, v.OriginalURL},
+			} {
+				if p := addObject(video, r.objectURL, versionDir+"/"+r.name+".mp4"); p != "" {
+					renditions[r.name] = p
+				}
+			}
+			v.VideoURL, v.PreviewURL, v.SDRVideoURL, v.OriginalURL = nil, nil, nil, nil
+			entry.Versions = append(entry.Versions, versionExport{VideoVersion: v, Files: renditions})
+		}
+
+		// The archive has the files; S3 references and asset URLs mean
+		// nothing outside this server. Versions are cleared above, and
+		// fields the JSON leaves out are too, in case that changes.
+		entry.VideoURL = nil
+		entry.PreviewURL = nil
+		entry.SDRVideoURL = nil
+		entry.OriginalURL = nil
+		entry.ThumbnailURL = nil
+		entry.ThumbnailSourceURL = nil
+		export.Videos = append(export.Videos, entry)
+	}
+	return export, files, nil
+}
+
+// missingExportFileError is a file that can't be read, as opposed to a
+// failed write to the client.
+type missingExportFileError struct{ err error }
+
+func (e missingExportFileError) Error() string { return e.err.Error() }
+
+// writeExportFile copies file into the archive and returns the bytes read.
+// Videos are stored without compression, which wouldn't shrink them.
+func (cfg *apiConfig) writeExportFile(ctx context.Context, zw *zip.Writer, file exportFile) (int64, error) {
+	var (
+		body     io.ReadCloser
+		modified time.Time
+	)
+	if file.assetName != "" {
+		f, err := os.Open(filepath.Join(cfg.assetsRoot, file.assetName))
+		if err != nil {
+			return 0, missingExportFileError{err}
+		}
+		if info, err := f.Stat(); err == nil {
+			modified = info.ModTime()
+		}
+		body = f
+	} else {
+		bucket, key, err := splitVideoURL(file.objectURL)
+		if err != nil {
+			return 0, missingExportFileError{err}
+		}
+		out, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return 0, missingExportFileError{err}
+		}
+		modified = aws.ToTime(out.LastModified)
+		body = out.Body
+	}
+	defer body.Close()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: file.Path, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(entry, body)
+}
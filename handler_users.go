@@ -6,16 +6,17 @@ import (
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
 )
 
-func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
-	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
-	}
+type createUserParams struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
 
+func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
+	params := createUserParams{}
 	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
@@ -33,7 +34,7 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := cfg.db.CreateUser(database.CreateUserParams{
+	user, err := cfg.db.WithContext(r.Context()).CreateUser(database.CreateUserParams{
 		Email:    params.Email,
 		Password: hashedPassword,
 	})
@@ -41,6 +42,74 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user", err)
 		return
 	}
+	requestAudit(r).Set("user_id", user.ID)
 
 	respondWithJSON(w, http.StatusCreated, user)
 }
+
+// handlerUsersDelete deletes the caller's account. Their sessions and
+// records go at once; the files they stored are deleted afterwards by a
+// purge_account job, which the caller's access token can still poll. The
+// last owner of an organization with other members has to hand it over
+// first.
+func (cfg *apiConfig) handlerUsersDelete(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	user, err := cfg.db.WithContext(r.Context()).GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+
+	orgs, err := cfg.db.WithContext(r.Context()).GetUserOrganizations(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+	for _, org := range orgs {
+		if org.Role == database.RoleOwner && org.OwnerCount == 1 && org.MemberCount > 1 {
+			respondWithError(w, http.StatusConflict, "An organization needs at least one owner", nil)
+			return
+		}
+	}
+
+	files, err := cfg.collectAccountFiles(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+	dat, err := json.Marshal(files)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+	job, err := cfg.db.WithContext(r.Context()).DeleteAccount(userID, database.CreateJobParams{
+		UserID:      userID,
+		Kind:        jobKindPurgeAccount,
+		Params:      string(dat),
+		TraceParent: traceParent(r.Context()),
+		// Nobody waits on a deleted account's files
+		Priority: database.JobPriorityLow,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+	cfg.enqueueJob(job)
+	annotateLog(w, "user_id", userID, "job_id", job.ID)
+	requestLogger(r).Info("Account deleted", "user_id", userID, "job_id", job.ID, "files", files.total())
+
+	respondWithJSON(w, http.StatusAccepted, newJobResponse(i18n.FromContext(r.Context()), job))
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxArchiveVideos bounds how long one archive request holds a connection.
+const maxArchiveVideos = 100
+
+// archiveManifestName is the trailing entry listing videos that couldn't be
+// read into the archive.
+const archiveManifestName = "missing.json"
+
+type videoArchiveParams struct {
+	VideoIDs []uuid.UUID `json:"video_ids"`
+}
+
+// archiveEntry is one video of an archive and the object it's read from.
+type archiveEntry struct {
+	video  database.Video
+	bucket string
+	key    string
+	name   string
+}
+
+// missingArchiveEntry is a video left out of an archive because S3
+// couldn't return its object once streaming had started.
+type missingArchiveEntry struct {
+	VideoID uuid.UUID `json:"video_id"`
+	Name    string    `json:"name"`
+}
+
+// archiveManifest is the content of archiveManifestName.
+type archiveManifest struct {
+	Missing []missingArchiveEntry `json:"missing"`
+}
+
+// handlerVideoArchive streams a ZIP of the chosen videos, each in the
+// quality a download would get, straight from S3 into the response without
+// staging anything on disk.
+func (cfg *apiConfig) handlerVideoArchive(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	var params videoArchiveParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if len(params.VideoIDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No videos to archive", nil)
+		return
+	}
+	if len(params.VideoIDs) > maxArchiveVideos {
+		respondWithError(w, http.StatusBadRequest, "Too many videos to archive", fmt.Errorf("archives hold at most %d videos", maxArchiveVideos))
+		return
+	}
+
+	// Everything is checked up front, since errors can't be reported once
+	// the archive has started
+	entries, ok := cfg.resolveArchiveEntries(r.Context(), w, userID, params.VideoIDs)
+	if !ok {
+		return
+	}
+	annotateLog(w, "archive_videos", len(entries))
+
+	// Videos S3 can't return once streaming has started are left out and
+	// listed in archiveManifestName. Other failures leave out the central
+	// directory, so a truncated archive fails to open rather than look
+	// complete.
+	zw := zip.NewWriter(w)
+	var total int64
+	var manifest archiveManifest
+	for i, entry := range entries {
+		out, err := cfg.s3Client.GetObject(r.Context(), &s3.GetObjectInput{
+			Bucket: aws.String(entry.bucket),
+			Key:    aws.String(entry.key),
+		})
+		if err != nil && i == 0 {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't download video", err)
+			return
+		}
+		if i == 0 {
+			// Only once S3 has answered, so that a failure to read the
+			// first video is still an error response
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Disposition", `attachment; filename="tubely-videos.zip"`)
+			w.WriteHeader(http.StatusOK)
+		}
+		if err != nil {
+			if r.Context().Err() != nil {
+				return
+			}
+			requestLogger(r).Warn("Leaving video out of archive", "video_id", entry.video.ID, "key", entry.key, "error", err)
+			manifest.Missing = append(manifest.Missing, missingArchiveEntry{VideoID: entry.video.ID, Name: entry.name})
+			continue
+		}
+		written, err := writeArchiveEntry(zw, entry, out)
+		total += written
+		cfg.recordEgress(entry.video, database.EgressProxy, written)
+		if err != nil {
+			if r.Context().Err() == nil {
+				requestLogger(r).Error("Archive aborted", "video_id", entry.video.ID, "key", entry.key, "error", err)
+			}
+			return
+		}
+	}
+
+	if len(manifest.Missing) > 0 {
+		if err := writeArchiveManifest(zw, manifest); err != nil {
+			requestLogger(r).Error("Archive aborted", "path", archiveManifestName, "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		requestLogger(r).Error("Couldn't finish archive", "error", err)
+		return
+	}
+	annotateLog(w, "stream_bytes", total, "archive_missing", len(manifest.Missing))
+}
+
+// resolveArchiveEntries looks up the videos, which userID has to be able
+// to manage, and names their entries. Duplicate IDs are archived once, and
+// entries that would share a name get a counter. Videos whose owner is out
+// of egress fail the request as they would on the stream proxy. If any
+// video can't be archived the error response has already been written and
+// ok is false.
+func (cfg *apiConfig) resolveArchiveEntries(ctx context.Context, w http.ResponseWriter, userID uuid.UUID, videoIDs []uuid.UUID) ([]archiveEntry, bool) {
+	var entries []archiveEntry
+	seen := map[uuid.UUID]bool{}
+	names := map[string]bool{}
+	for _, videoID := range videoIDs {
+		if seen[videoID] {
+			continue
+		}
+		seen[videoID] = true
+		details := map[string]any{"video_id": videoID}
+
+		video, err := cfg.db.WithContext(ctx).GetVideo(videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error", err)
+			return nil, false
+		}
+		if video.ID == uuid.Nil {
+			respondWithErrorDetails(w, http.StatusNotFound, "Video not found", nil, details)
+			return nil, false
+		}
+		canManage, err := cfg.canManageVideo(ctx, userID, video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error", err)
+			return nil, false
+		}
+		if !canManage {
+			respondWithErrorDetails(w, http.StatusUnauthorized, "Unauthorized access", nil, details)
+			return nil, false
+		}
+		reached, err := cfg.egressCapReached(ctx, video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check egress", err)
+			return nil, false
+		}
+		if reached {
+			respondWithEgressCapReached(w)
+			return nil, false
+		}
+
+		// The same object a download would redirect to
+		objectURL := video.VideoURL
+		if video.OriginalURL != nil && *video.OriginalURL != "" && video.OriginalArchivedAt == nil {
+			objectURL = video.OriginalURL
+		}
+		if objectURL == nil || *objectURL == "" {
+			respondWithErrorDetails(w, http.StatusNotFound, "Video has no uploaded file", nil, details)
+			return nil, false
+		}
+		bucket, key, err := splitVideoURL(*objectURL)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't download video", err)
+			return nil, false
+		}
+
+		name := uniqueArchiveName(names, downloadFilename(video, path.Ext(key)))
+		entries = append(entries, archiveEntry{video: video, bucket: bucket, key: key, name: name})
+	}
+	return entries, true
+}
+
+// uniqueArchiveName returns name, or name with the lowest counter like
+// "Talk (2).mp4" that isn't taken yet, ignoring case, and records it as
+// taken.
+func uniqueArchiveName(taken map[string]bool, name string) string {
+	ext := path.Ext(name)
+	candidate := name
+	for n := 2; taken[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	taken[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// writeArchiveEntry copies the entry's object into the archive, stored
+// without compression, which wouldn't shrink video. It returns the bytes
+// read from S3.
+func writeArchiveEntry(zw *zip.Writer, entry archiveEntry, out *s3.GetObjectOutput) (int64, error) {
+	defer out.Body.Close()
+	header := &zip.FileHeader{Name: entry.name, Method: zip.Store, Modified: aws.ToTime(out.LastModified)}
+	dest, err := zw.CreateHeader(header)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(dest, out.Body)
+}
+
+// writeArchiveManifest adds archiveManifestName, listing the videos that
+// were left out.
+func writeArchiveManifest(zw *zip.Writer, manifest archiveManifest) error {
+	dest, err := zw.CreateHeader(&zip.FileHeader{Name: archiveManifestName, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(dest)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
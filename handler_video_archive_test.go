@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUniqueArchiveName(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{
+			name:  "distinct names are kept",
+			names: []string{"a.mp4", "b.mp4"},
+			want:  []string{"a.mp4", "b.mp4"},
+		},
+		{
+			name:  "repeats get counters",
+			names: []string{"x.mp4", "x.mp4", "x.mp4"},
+			want:  []string{"x.mp4", "x (2).mp4", "x (3).mp4"},
+		},
+		{
+			name:  "case is ignored",
+			names: []string{"Talk.mp4", "talk.MP4"},
+			want:  []string{"Talk.mp4", "talk (2).MP4"},
+		},
+		{
+			name:  "a real title like a counter is renamed after a generated one",
+			names: []string{"x.mp4", "x.mp4", "x (2).mp4"},
+			want:  []string{"x.mp4", "x (2).mp4", "x (2) (2).mp4"},
+		},
+		{
+			name:  "a generated counter skips a real title",
+			names: []string{"x (2).mp4", "x.mp4", "x.mp4"},
+			want:  []string{"x (2).mp4", "x.mp4", "x (3).mp4"},
+		},
+		{
+			name:  "names without an extension",
+			names: []string{"x", "x"},
+			want:  []string{"x", "x (2)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taken := map[string]bool{}
+			var got []string
+			for _, name := range tt.names {
+				got = append(got, uniqueArchiveName(taken, name))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
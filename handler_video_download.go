@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// maxDownloadFilenameBytes bounds the filenames owners pick
+const maxDownloadFilenameBytes = 255
+
+type downloadSettingsParams struct {
+	AllowDownloads bool `json:"allow_downloads"`
+	// Filename is what downloads are saved as; empty derives one from the
+	// title. The file's extension is added if it has none.
+	Filename string `json:"filename"`
+}
+
+// handlerDownloadSettingsPut lets the owner allow or deny downloads by
+// viewers and choose the filename they get.
+func (cfg *apiConfig) handlerDownloadSettingsPut(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	var params downloadSettingsParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	filename := strings.TrimSpace(params.Filename)
+	if filename != "" && !validDownloadFilename(filename) {
+		respondWithError(w, http.StatusBadRequest, "Invalid filename", fmt.Errorf("%q", filename))
+		return
+	}
+
+	video.AllowDownloads = params.AllowDownloads
+	video.DownloadFilename = nil
+	if filename != "" {
+		video.DownloadFilename = &filename
+	}
+	if err := cfg.db.WithContext(r.Context()).UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate URL", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+// handlerVideoDownload redirects to a presigned URL that saves the file
+// instead of playing it. It serves the original upload if one was kept and
+// isn't archived, otherwise the stream rendition. Only those who may manage
+// the video can download it unless its owner allowed it, and the video's
+// playback rules apply as they do to streaming.
+func (cfg *apiConfig) handlerVideoDownload(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok || !cfg.checkPlaybackRules(w, r, video) {
+		return
+	}
+	if !video.AllowDownloads {
+		canManage, err := cfg.canManageVideo(r.Context(), cfg.requesterID(r), video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+			return
+		}
+		if !canManage {
+			respondWithError(w, http.StatusForbidden, "Downloads are disabled for this video", nil)
+			return
+		}
+	}
+
+	objectURL := video.VideoURL
+	if video.OriginalURL != nil && *video.OriginalURL != "" && video.OriginalArchivedAt == nil {
+		objectURL = video.OriginalURL
+	}
+	if objectURL == nil || *objectURL == "" {
+		respondWithError(w, http.StatusNotFound, "Video has no uploaded file", nil)
+		return
+	}
+	bucket, key, err := splitVideoURL(*objectURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download video", err)
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": downloadFilename(video, path.Ext(key))})
+	req, err := s3.NewPresignClient(cfg.s3Client).PresignGetObject(r.Context(),
+		&s3.GetObjectInput{
+			Bucket:                     aws.String(bucket),
+			Key:                        aws.String(key),
+			ResponseContentDisposition: aws.String(disposition),
+		},
+		s3.WithPresignExpires(presignExpiry),
+	)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download video", err)
+		return
+	}
+	annotateLog(w, "video_id", video.ID, "key", key)
+	http.Redirect(w, r, req.URL, http.StatusFound)
+}
+
+func validDownloadFilename(name string) bool {
+	if len(name) > maxDownloadFilenameBytes || !utf8.ValidString(name) || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsFunc(name, unsafeFilenameRune)
+}
+
+// unsafeFilenameRune reports characters that don't belong in a saved file's
+// name on some platform.
+func unsafeFilenameRune(r rune) bool {
+	return r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r)
+}
+
+// downloadFilename is the owner's chosen name or else the title, with ext
+// added unless it already has an extension.
+func downloadFilename(video database.Video, ext string) string {
+	name := ""
+	if video.DownloadFilename != nil {
+		name = *video.DownloadFilename
+	} else {
+		name = strings.TrimSpace(strings.Map(func(r rune) rune {
+			if unsafeFilenameRune(r) {
+				return '_'
+			}
+			return r
+		}, video.Title))
+		if len(name) > maxDownloadFilenameBytes-len(ext) {
+			name = strings.ToValidUTF8(name[:maxDownloadFilenameBytes-len(ext)], "")
+		}
+	}
+	if name == "" {
+		name = "video"
+	}
+	if ext == "" {
+		ext = ".mp4"
+	}
+	if path.Ext(name) == "" {
+		name += ext
+	}
+	return name
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestValidDownloadFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"talk.mp4", true},
+		{"Über Vorträge.mov", true},
+		{"", true},
+		{".", false},
+		{"..", false},
+		{"a/b.mp4", false},
+		{`a\b.mp4`, false},
+		{"what?.mp4", false},
+		{"tab\there.mp4", false},
+		{"bad\xffutf8.mp4", false},
+		{strings.Repeat("a", maxDownloadFilenameBytes), true},
+		{strings.Repeat("a", maxDownloadFilenameBytes+1), false},
+	}
+	for _, tt := range tests {
+		if got := validDownloadFilename(tt.name); got != tt.want {
+			t.Errorf("validDownloadFilename(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadFilename(t *testing.T) {
+	chosen := "keynote.webm"
+	tests := []struct {
+		name  string
+		video database.Video
+		ext   string
+		want  string
+	}{
+		{
+			name:  "title with the extension",
+			video: titledVideo("My talk", nil),
+			ext:   ".mov",
+			want:  "My talk.mov",
+		},
+		{
+			name:  "mp4 without an extension",
+			video: titledVideo("My talk", nil),
+			want:  "My talk.mp4",
+		},
+		{
+			name:  "unsafe characters in the title",
+			video: titledVideo(` a/b: "c"? `, nil),
+			ext:   ".mp4",
+			want:  "a_b_ _c__.mp4",
+		},
+		{
+			name:  "empty title",
+			video: titledVideo("  ", nil),
+			ext:   ".mp4",
+			want:  "video.mp4",
+		},
+		{
+			name:  "title with its own extension",
+			video: titledVideo("talk.v2", nil),
+			ext:   ".mp4",
+			want:  "talk.v2",
+		},
+		{
+			name:  "chosen name wins",
+			video: titledVideo("My talk", &chosen),
+			ext:   ".mp4",
+			want:  "keynote.webm",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := downloadFilename(tt.video, tt.ext); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("long titles are cut to fit the extension", func(t *testing.T) {
+		title := strings.Repeat("é", maxDownloadFilenameBytes)
+		got := downloadFilename(titledVideo(title, nil), ".mp4")
+		if len(got) > maxDownloadFilenameBytes || !utf8.ValidString(got) || !strings.HasSuffix(got, ".mp4") {
+			t.Errorf("got %d bytes %q", len(got), got)
+		}
+	})
+}
+
+func titledVideo(title string, downloadFilename *string) database.Video {
+	var video database.Video
+	video.Title = title
+	video.DownloadFilename = downloadFilename
+	return video
+}
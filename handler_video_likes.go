@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type likeResponse struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	LikeCount int       `json:"like_count"`
+	// Liked is whether the caller likes the video
+	Liked bool `json:"liked"`
+}
+
+// handlerVideoLikeGet tells the caller whether they like the video.
+func (cfg *apiConfig) handlerVideoLikeGet(w http.ResponseWriter, r *http.Request) {
+	video, userID, ok := cfg.getLikableVideo(w, r)
+	if !ok {
+		return
+	}
+	liked, err := cfg.db.WithContext(r.Context()).HasLikedVideo(video.ID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get like", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, likeResponse{VideoID: video.ID, LikeCount: video.LikeCount, Liked: liked})
+}
+
+// handlerVideoLikePut likes the video. Liking it again changes nothing.
+func (cfg *apiConfig) handlerVideoLikePut(w http.ResponseWriter, r *http.Request) {
+	video, userID, ok := cfg.getLikableVideo(w, r)
+	if !ok {
+		return
+	}
+	count, err := cfg.db.WithContext(r.Context()).LikeVideo(video.ID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't like video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, likeResponse{VideoID: video.ID, LikeCount: count, Liked: true})
+}
+
+// handlerVideoLikeDelete takes back the caller's like, if any.
+func (cfg *apiConfig) handlerVideoLikeDelete(w http.ResponseWriter, r *http.Request) {
+	video, userID, ok := cfg.getLikableVideo(w, r)
+	if !ok {
+		return
+	}
+	count, err := cfg.db.WithContext(r.Context()).UnlikeVideo(video.ID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlike video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, likeResponse{VideoID: video.ID, LikeCount: count, Liked: false})
+}
+
+// getLikableVideo authenticates the caller and resolves a video they can
+// see. If either fails the error response has already been written and ok
+// is false.
+func (cfg *apiConfig) getLikableVideo(w http.ResponseWriter, r *http.Request) (database.Video, uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, uuid.Nil, false
+	}
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return database.Video{}, uuid.Nil, false
+	}
+	return video, userID, true
+}
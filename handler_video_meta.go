@@ -2,19 +2,36 @@ package main
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
-func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Request) {
-	type parameters struct {
-		database.CreateVideoParams
+type createVideoParams struct {
+	database.CreateVideoParams
+	// Visibility is public (the default), unlisted or private
+	Visibility string `json:"visibility"`
+}
+
+// updateVideoParams changes the fields that are set and leaves the rest.
+type updateVideoParams struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Visibility  *string `json:"visibility,omitempty"`
+}
+
+func validVisibility(visibility string) bool {
+	switch visibility {
+	case database.VisibilityPublic, database.VisibilityUnlisted, database.VisibilityPrivate:
+		return true
 	}
+	return false
+}
 
+func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
@@ -27,23 +44,51 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 	}
 
 	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
+	params := createVideoParams{}
 	err = decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
 		return
 	}
 	params.UserID = userID
+	params.Title = strings.TrimSpace(params.Title)
+	if params.Title == "" {
+		respondWithError(w, http.StatusBadRequest, "Title is required", nil)
+		return
+	}
+	if params.Visibility == "" {
+		params.Visibility = database.VisibilityPublic
+	}
+	if !validVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, "Invalid visibility", nil)
+		return
+	}
+	if params.OrgID != nil {
+		role, err := cfg.db.WithContext(r.Context()).GetOrgRole(*params.OrgID, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get organization", err)
+			return
+		}
+		if role != database.RoleOwner && role != database.RoleUploader {
+			respondWithError(w, http.StatusForbidden, "You can't upload to this organization", nil)
+			return
+		}
+	}
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	video, err := cfg.db.WithContext(r.Context()).CreateVideoWithVisibility(params.CreateVideoParams, params.Visibility)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
 	}
+	audit := requestAudit(r)
+	audit.SetVideo(video.ID)
+	audit.Set("visibility", video.Visibility)
 
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
+// handlerVideoMetaDelete moves the video to the trash, where it can be
+// restored until purgeTrash deletes it.
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -63,17 +108,27 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(videoID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	canManage, err := cfg.canManageVideo(r.Context(), userID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if !canManage {
+		respondWithError(w, http.StatusForbidden, "You can't delete this video", nil)
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	// The row and its objects stay until the trash is purged
+	err = cfg.db.WithContext(r.Context()).TrashVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
@@ -82,25 +137,78 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
+// handlerVideoMetaUpdate changes a video's title, description or
+// visibility, whether or not it has media yet.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
 
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+	var params updateVideoParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Title != nil {
+		video.Title = strings.TrimSpace(*params.Title)
+		if video.Title == "" {
+			respondWithError(w, http.StatusBadRequest, "Title is required", nil)
+			return
+		}
+	}
+	if params.Description != nil {
+		video.Description = *params.Description
+	}
+	if params.Visibility != nil {
+		if !validVisibility(*params.Visibility) {
+			respondWithError(w, http.StatusBadRequest, "Invalid visibility", nil)
+			return
+		}
+		if *params.Visibility != video.Visibility {
+			// Visibility changes are filed under their own action, so they
+			// can be found without reading every edit
+			audit := requestAudit(r)
+			audit.SetAction("video.visibility_change")
+			audit.Set("visibility_from", video.Visibility)
+			audit.Set("visibility_to", *params.Visibility)
+		}
+		video.Visibility = *params.Visibility
+	}
+	if err := cfg.db.WithContext(r.Context()).UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
+	fields := []string{}
+	if params.Title != nil {
+		fields = append(fields, "title")
+	}
+	if params.Description != nil {
+		fields = append(fields, "description")
+	}
+	if params.Visibility != nil {
+		fields = append(fields, "visibility")
+	}
+	requestAudit(r).Set("fields", fields)
 
-	video, err := cfg.db.GetVideo(videoID)
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate URL", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
 		return
 	}
 
 	signedVideo, err := cfg.dbVideoToSignedVideo(video)
 	if err != nil {
 		// Return video without URL instead of error
-		log.Printf("Failed to generate URL for video %s: %v", videoID, err)
+		requestLogger(r).Warn("Failed to generate URL for video", "video_id", video.ID, "error", err)
 		video.VideoURL = nil
 		respondWithJSON(w, http.StatusOK, video)
 		return
@@ -121,7 +229,7 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	videos, err := cfg.db.WithContext(r.Context()).GetVideos(userID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError,
 			"Couldn't retrieve videos", err)
@@ -133,7 +241,7 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		signed, err := cfg.dbVideoToSignedVideo(video)
 		if err != nil {
 			// Log but continue processing other videos
-			log.Printf("Skipping video %s: %v", video.ID, err)
+			requestLogger(r).Warn("Skipping video", "video_id", video.ID, "error", err)
 			continue
 		}
 		signedVideos = append(signedVideos, signed)
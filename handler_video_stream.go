@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// streamPath is where the proxy serves a video's renditions.
+func streamPath(videoID uuid.UUID) string {
+	return apiV1 + "/videos/" + videoID.String() + "/stream"
+}
+
+// handlerVideoStream proxies the video (or, with ?rendition=preview or sdr,
+// its preview or SDR rendition) from S3, passing Range requests through so players can seek.
+// Access is checked on every request, so playback can be revoked without
+// waiting for presigned URLs to expire. Bytes served count towards the
+// owner's egress, and once their monthly cap is reached streams are refused.
+// Viewers the video's playback rules refuse get a 403.
+func (cfg *apiConfig) handlerVideoStream(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok || !cfg.checkPlaybackRules(w, r, video) {
+		return
+	}
+
+	objectURL := video.VideoURL
+	switch r.URL.Query().Get("rendition") {
+	case "", renditionStream:
+	case renditionPreview:
+		objectURL = video.PreviewURL
+	case renditionSDR:
+		objectURL = video.SDRVideoURL
+	default:
+		respondWithError(w, http.StatusBadRequest, "Rendition must be stream, preview or sdr", nil)
+		return
+	}
+	if objectURL == nil || *objectURL == "" {
+		respondWithError(w, http.StatusNotFound, "Video has no uploaded file", nil)
+		return
+	}
+	bucket, key, err := splitVideoURL(*objectURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't stream video", err)
+		return
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader != "" && !isSingleByteRange(rangeHeader) {
+		// S3 only serves one range per request; fall back to the whole body
+		rangeHeader = ""
+	}
+
+	// S3 evaluates the validators and answers 304 itself
+	ifNoneMatch, ifModifiedSince := conditionalHeaders(r)
+	w.Header().Set("Cache-Control", cfg.cachePolicy[assetTypeVideo])
+
+	if r.Method == http.MethodHead {
+		head, err := cfg.s3Client.HeadObject(r.Context(), &s3.HeadObjectInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			IfNoneMatch:     ifNoneMatch,
+			IfModifiedSince: ifModifiedSince,
+		})
+		if err != nil {
+			respondWithStreamError(w, r, err)
+			return
+		}
+		setStreamHeaders(w, head.ContentType, head.ContentLength, nil, head.ETag, head.LastModified)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	reached, err := cfg.egressCapReached(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check egress", err)
+		return
+	}
+	if reached {
+		respondWithEgressCapReached(w)
+		return
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		IfNoneMatch:     ifNoneMatch,
+		IfModifiedSince: ifModifiedSince,
+	}
+	if rangeHeader != "" {
+		input.Range = aws.String(rangeHeader)
+	}
+	out, err := cfg.s3Client.GetObject(r.Context(), input)
+	if err != nil {
+		respondWithStreamError(w, r, err)
+		return
+	}
+	defer out.Body.Close()
+
+	setStreamHeaders(w, out.ContentType, out.ContentLength, out.ContentRange, out.ETag, out.LastModified)
+	status := http.StatusOK
+	if out.ContentRange != nil {
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+
+	written, err := io.Copy(w, out.Body)
+	annotateLog(w, "video_id", video.ID, "stream_bytes", written)
+	cfg.recordEgress(video, database.EgressProxy, written)
+	if err != nil && r.Context().Err() == nil {
+		requestLogger(r).Warn("Stream copy failed", "video_id", video.ID, "key", key, "error", err)
+	}
+}
+
+// getVisibleVideo resolves the {videoID} path value to a video the caller
+// may watch. Videos held by moderation look missing to everyone except
+// their owner and admins. If any step fails the error response has already
+// been written and ok is false.
+func (cfg *apiConfig) getVisibleVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil || !cfg.videoVisibleTo(r, video) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+func setStreamHeaders(w http.ResponseWriter, contentType *string, length *int64, contentRange, etag *string, lastModified *time.Time) {
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Content-Type", aws.ToString(contentType))
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "video/mp4")
+	}
+	if length != nil {
+		h.Set("Content-Length", strconv.FormatInt(*length, 10))
+	}
+	if contentRange != nil {
+		h.Set("Content-Range", *contentRange)
+	}
+	if etag != nil {
+		h.Set("ETag", *etag)
+	}
+	if lastModified != nil {
+		h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// conditionalHeaders extracts If-None-Match and If-Modified-Since for
+// forwarding to S3. If-Modified-Since is ignored when If-None-Match is set,
+// as RFC 9110 requires.
+func conditionalHeaders(r *http.Request) (*string, *time.Time) {
+	if etag := r.Header.Get("If-None-Match"); etag != "" {
+		return aws.String(etag), nil
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return nil, &since
+	}
+	return nil, nil
+}
+
+// respondWithStreamError maps S3 errors onto the matching HTTP status.
+func respondWithStreamError(w http.ResponseWriter, r *http.Request, err error) {
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotModified {
+		// The client's copy is current; repeat its validator back
+		if etag := r.Header.Get("If-None-Match"); etag != "" && !strings.Contains(etag, ",") {
+			w.Header().Set("ETag", etag)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidRange":
+			respondWithError(w, http.StatusRequestedRangeNotSatisfiable, "Requested range not satisfiable", err)
+			return
+		case "NoSuchKey", "NotFound":
+			respondWithError(w, http.StatusNotFound, "Video has no uploaded file", err)
+			return
+		}
+	}
+	respondWithError(w, http.StatusInternalServerError, "Couldn't stream video", err)
+}
+
+// isSingleByteRange reports whether header is a single "bytes=" range,
+// the only form S3 accepts.
+func isSingleByteRange(header string) bool {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return false
+	}
+	start, end, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok || (start == "" && end == "") {
+		return false
+	}
+	for _, part := range []string{start, end} {
+		if part == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(part, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// playbackURL is where clients fetch a rendition: the stream proxy when
+// proxy is set, otherwise a presigned S3 URL.
+func (cfg *apiConfig) playbackURL(video database.Video, rendition, objectURL string, proxy bool) (string, error) {
+	if proxy {
+		path := streamPath(video.ID)
+		if rendition != renditionStream {
+			path += "?rendition=" + rendition
+		}
+		return path, nil
+	}
+
+	bucket, key, err := splitVideoURL(objectURL)
+	if err != nil {
+		return "", err
+	}
+	url, err := generatePresignedURL(cfg.s3Client, bucket, key, presignExpiry)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %w", key, err)
+	}
+	return url, nil
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+	"github.com/google/uuid"
+)
+
+// jobKindRekeyVideo copies a transferred video's objects to keys of its new
+// owner
+const jobKindRekeyVideo = "rekey_video"
+
+type videoTransferParams struct {
+	// ToEmail or ToOrgID names the recipient, exactly one of them
+	ToEmail string     `json:"to_email,omitempty"`
+	ToOrgID *uuid.UUID `json:"to_org_id,omitempty"`
+	// Rekey moves the video's S3 objects to the new owner's keys as well
+	Rekey bool `json:"rekey"`
+}
+
+type videoTransfersResponse struct {
+	// Incoming are the pending transfers the caller may accept
+	Incoming []database.VideoTransfer `json:"incoming"`
+	// Outgoing are the pending transfers the caller offered
+	Outgoing []database.VideoTransfer `json:"outgoing"`
+}
+
+type videoTransferResponse struct {
+	database.VideoTransfer
+	// Job is the rekey_video job, once one is queued
+	Job *jobResponse `json:"job,omitempty"`
+}
+
+type videoTransferredEventData struct {
+	FromUserID uuid.UUID  `json:"from_user_id"`
+	ToUserID   *uuid.UUID `json:"to_user_id"`
+	ToOrgID    *uuid.UUID `json:"to_org_id"`
+}
+
+// handlerVideoTransferCreate offers the video to another user or an
+// organization. Nothing changes until the recipient accepts.
+func (cfg *apiConfig) handlerVideoTransferCreate(w http.ResponseWriter, r *http.Request) {
+	video, userID, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	var params videoTransferParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.ToEmail = strings.TrimSpace(params.ToEmail)
+	if (params.ToEmail == "") == (params.ToOrgID == nil) {
+		respondWithError(w, http.StatusBadRequest, "Give either to_email or to_org_id", nil)
+		return
+	}
+
+	transfer := database.CreateVideoTransferParams{
+		VideoID:    video.ID,
+		FromUserID: userID,
+		ToOrgID:    params.ToOrgID,
+		Rekey:      params.Rekey,
+	}
+	if params.ToOrgID != nil {
+		org, err := cfg.db.WithContext(r.Context()).GetOrganization(*params.ToOrgID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get organization", err)
+			return
+		}
+		if org.ID == uuid.Nil {
+			respondWithError(w, http.StatusNotFound, "Organization not found", nil)
+			return
+		}
+		if video.OrgID != nil && *video.OrgID == org.ID {
+			respondWithError(w, http.StatusConflict, "Video already belongs to the recipient", nil)
+			return
+		}
+	} else {
+		user, err := cfg.db.WithContext(r.Context()).GetUserByEmail(params.ToEmail)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+		if user.ID == uuid.Nil {
+			respondWithError(w, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		if video.OrgID == nil && video.UserID == user.ID {
+			respondWithError(w, http.StatusConflict, "Video already belongs to the recipient", nil)
+			return
+		}
+		transfer.ToUserID = &user.ID
+	}
+
+	created, ok, err := cfg.db.WithContext(r.Context()).CreateVideoTransfer(transfer)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create transfer", err)
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusConflict, "Video already has a pending transfer", nil)
+		return
+	}
+	annotateLog(w, "video_id", video.ID, "transfer_id", created.ID)
+	audit := requestAudit(r)
+	audit.Set("transfer_id", created.ID)
+	audit.Set("to_user_id", created.ToUserID)
+	audit.Set("to_org_id", created.ToOrgID)
+	respondWithJSON(w, http.StatusCreated, videoTransferResponse{VideoTransfer: created})
+}
+
+// handlerVideoTransfersList lists the caller's pending transfers in both
+// directions.
+func (cfg *apiConfig) handlerVideoTransfersList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	incoming, err := cfg.db.WithContext(r.Context()).GetIncomingVideoTransfers(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve transfers", err)
+		return
+	}
+	outgoing, err := cfg.db.WithContext(r.Context()).GetOutgoingVideoTransfers(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve transfers", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, videoTransfersResponse{Incoming: incoming, Outgoing: outgoing})
+}
+
+// handlerVideoTransferAccept hands the video over. Transfers to an
+// organization are accepted by one of its owners, who becomes the video's
+// creator within it.
+func (cfg *apiConfig) handlerVideoTransferAccept(w http.ResponseWriter, r *http.Request) {
+	transfer, userID, ok := cfg.getReceivedVideoTransfer(w, r)
+	if !ok {
+		return
+	}
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(transfer.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	// Whoever offered the video may have lost it since, say by leaving its
+	// organization
+	canManage, err := cfg.canManageVideo(r.Context(), transfer.FromUserID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if !canManage {
+		if _, err := cfg.db.WithContext(r.Context()).ResolveVideoTransfer(transfer.ID, database.TransferCancelled); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update transfer", err)
+			return
+		}
+		respondWithError(w, http.StatusConflict, "Transfer is no longer pending", nil)
+		return
+	}
+
+	var rekey *database.CreateJobParams
+	if transfer.Rekey {
+		rekey = &database.CreateJobParams{
+			UserID:      userID,
+			VideoID:     video.ID,
+			Kind:        jobKindRekeyVideo,
+			Params:      "{}",
+			TraceParent: traceParent(r.Context()),
+			// Only copies objects within the bucket
+			Priority: database.JobPriorityHigh,
+		}
+	}
+	accepted, err := cfg.db.WithContext(r.Context()).AcceptVideoTransfer(transfer, userID, rekey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't accept transfer", err)
+		return
+	}
+	if !accepted {
+		respondWithError(w, http.StatusConflict, "Transfer is no longer pending", nil)
+		return
+	}
+
+	transfer, err = cfg.db.WithContext(r.Context()).GetVideoTransfer(transfer.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get transfer", err)
+		return
+	}
+	resp := videoTransferResponse{VideoTransfer: transfer}
+	if transfer.JobID != nil {
+		job, err := cfg.db.WithContext(r.Context()).GetJob(*transfer.JobID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+			return
+		}
+		cfg.enqueueJob(job)
+		jobResp := newJobResponse(i18n.FromContext(r.Context()), job)
+		resp.Job = &jobResp
+	}
+	cfg.publishEvent(eventVideoTransferred, userID, video.ID, videoTransferredEventData{
+		FromUserID: transfer.FromUserID,
+		ToUserID:   transfer.ToUserID,
+		ToOrgID:    transfer.ToOrgID,
+	})
+	annotateLog(w, "video_id", video.ID, "transfer_id", transfer.ID)
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerVideoTransferDecline(w http.ResponseWriter, r *http.Request) {
+	transfer, _, ok := cfg.getReceivedVideoTransfer(w, r)
+	if !ok {
+		return
+	}
+	cfg.resolveVideoTransfer(r.Context(), w, transfer, database.TransferDeclined)
+}
+
+// handlerVideoTransferCancel withdraws a transfer. Anyone who may manage
+// the video can, not only whoever offered it.
+func (cfg *apiConfig) handlerVideoTransferCancel(w http.ResponseWriter, r *http.Request) {
+	transfer, userID, ok := cfg.getVideoTransfer(w, r)
+	if !ok {
+		return
+	}
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(transfer.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	canManage := transfer.FromUserID == userID
+	if !canManage && video.ID != uuid.Nil {
+		canManage, err = cfg.canManageVideo(r.Context(), userID, video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+			return
+		}
+	}
+	if !canManage {
+		respondWithError(w, http.StatusNotFound, "Transfer not found", nil)
+		return
+	}
+	cfg.resolveVideoTransfer(r.Context(), w, transfer, database.TransferCancelled)
+}
+
+func (cfg *apiConfig) resolveVideoTransfer(ctx context.Context, w http.ResponseWriter, transfer database.VideoTransfer, status string) {
+	resolved, err := cfg.db.WithContext(ctx).ResolveVideoTransfer(transfer.ID, status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update transfer", err)
+		return
+	}
+	if !resolved {
+		respondWithError(w, http.StatusConflict, "Transfer is no longer pending", nil)
+		return
+	}
+	transfer, err = cfg.db.WithContext(ctx).GetVideoTransfer(transfer.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get transfer", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, videoTransferResponse{VideoTransfer: transfer})
+}
+
+// getVideoTransfer resolves the {transferID} path value of a pending
+// transfer and authenticates the caller. If any step fails the error
+// response has already been written and ok is false.
+func (cfg *apiConfig) getVideoTransfer(w http.ResponseWriter, r *http.Request) (transfer database.VideoTransfer, userID uuid.UUID, ok bool) {
+	transferID, err := uuid.Parse(r.PathValue("transferID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid transfer ID", err)
+		return database.VideoTransfer{}, uuid.Nil, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.VideoTransfer{}, uuid.Nil, false
+	}
+	userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid JWT", err)
+		return database.VideoTransfer{}, uuid.Nil, false
+	}
+
+	transfer, err = cfg.db.WithContext(r.Context()).GetVideoTransfer(transferID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return database.VideoTransfer{}, uuid.Nil, false
+	}
+	if transfer.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Transfer not found", nil)
+		return database.VideoTransfer{}, uuid.Nil, false
+	}
+	if transfer.Status != database.TransferPending {
+		respondWithError(w, http.StatusConflict, "Transfer is no longer pending", nil)
+		return database.VideoTransfer{}, uuid.Nil, false
+	}
+	requestAudit(r).SetVideo(transfer.VideoID)
+	return transfer, userID, true
+}
+
+// getReceivedVideoTransfer is getVideoTransfer for the recipient: the user
+// it is addressed to, or an owner of the organization. Transfers look
+// missing to everyone else.
+func (cfg *apiConfig) getReceivedVideoTransfer(w http.ResponseWriter, r *http.Request) (database.VideoTransfer, uuid.UUID, bool) {
+	transfer, userID, ok := cfg.getVideoTransfer(w, r)
+	if !ok {
+		return database.VideoTransfer{}, uuid.Nil, false
+	}
+	recipient := transfer.ToUserID != nil && *transfer.ToUserID == userID
+	if transfer.ToOrgID != nil {
+		role, err := cfg.db.WithContext(r.Context()).GetOrgRole(*transfer.ToOrgID, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error", err)
+			return database.VideoTransfer{}, uuid.Nil, false
+		}
+		recipient = role == database.RoleOwner
+	}
+	if !recipient {
+		respondWithError(w, http.StatusNotFound, "Transfer not found", nil)
+		return database.VideoTransfer{}, uuid.Nil, false
+	}
+	return transfer, userID, true
+}
+
+// runRekeyVideoJob copies every object of the video and its versions to
+// the key the template gives its new owner, repoints the records at the
+// copies and deletes the old objects. Objects shared with another video
+// after deduplication are copied but the originals stay for the other
+// video. Archived originals and objects too large for CopyObject keep
+// their key.
+func (cfg *apiConfig) runRekeyVideoJob(ctx context.Context, job database.Job) (database.Job, error) {
+	video, err := cfg.db.WithContext(ctx).GetVideo(job.VideoID)
+	if err != nil {
+		return job, fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		slog.Info("Skipping rekey of deleted video", "job_id", job.ID, "video_id", job.VideoID)
+		return job, nil
+	}
+	versions, err := cfg.db.WithContext(ctx).GetVideoVersions(video.ID)
+	if err != nil {
+		return job, fmt.Errorf("couldn't get versions: %w", err)
+	}
+
+	// Each object with the key parameters of the rendition it holds
+	objects := map[string]objectKeyParams{}
+	add := func(objectURL *string, aspect *string, keyParams func(database.Video, string) objectKeyParams) {
+		if objectURL == nil || *objectURL == "" {
+			return
+		}
+		category := aspectOther
+		if aspect != nil && *aspect != "" {
+			category = *aspect
+		}
+		objects[*objectURL] = keyParams(video, category)
+	}
+	add(video.VideoURL, video.Aspect, videoKeyParams)
+	add(video.PreviewURL, video.Aspect, previewKeyParams)
+	add(video.SDRVideoURL, video.Aspect, sdrKeyParams)
+	add(video.OriginalURL, video.Aspect, originalKeyParams)
+	for _, v := range versions {
+		add(v.VideoURL, v.Aspect, videoKeyParams)
+		add(v.PreviewURL, v.Aspect, previewKeyParams)
+		add(v.SDRVideoURL, v.Aspect, sdrKeyParams)
+		add(v.OriginalURL, v.Aspect, originalKeyParams)
+	}
+
+	moved := map[string]string{}
+	copies := []string{}
+	for objectURL, keyParams := range objects {
+		copyURL, err := cfg.copyObjectForOwner(ctx, objectURL, keyParams)
+		if err != nil {
+			cfg.deleteUnreferencedObjects(context.WithoutCancel(ctx), copies...)
+			return job, err
+		}
+		if copyURL != "" {
+			moved[objectURL] = copyURL
+			copies = append(copies, copyURL)
+		}
+	}
+
+	if err := cfg.db.WithContext(ctx).ReplaceVideoObjectURLs(video.ID, moved); err != nil {
+		cfg.deleteUnreferencedObjects(context.WithoutCancel(ctx), copies...)
+		return job, fmt.Errorf("couldn't update video: %w", err)
+	}
+	old := make([]string, 0, len(moved))
+	for objectURL := range moved {
+		old = append(old, objectURL)
+	}
+	// Copies of objects replaced by an upload in the meantime are unused
+	cfg.deleteUnreferencedObjects(ctx, append(old, copies...)...)
+	slog.Info("Rekeyed transferred video", "job_id", job.ID, "video_id", video.ID, "objects", len(moved), "kept", len(objects)-len(moved))
+	return job, nil
+}
+
+// copyObjectForOwner copies the "bucket,key" object to a key rendered from
+// keyParams, tagged for its owner, returning the copy's reference or "" if
+// the object has to stay where it is.
+func (cfg *apiConfig) copyObjectForOwner(ctx context.Context, objectURL string, keyParams objectKeyParams) (string, error) {
+	bucket, key, err := splitVideoURL(objectURL)
+	if err != nil {
+		return "", err
+	}
+	head, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to head %s: %w", key, err)
+	}
+	if head.StorageClass == types.StorageClassGlacier || aws.ToInt64(head.ContentLength) > maxCopyObjectSize {
+		slog.Info("Keeping object key of transferred video", "key", key, "storage_class", head.StorageClass)
+		return "", nil
+	}
+
+	newKey, err := cfg.keyTemplate.render(keyParams)
+	if err != nil {
+		return "", err
+	}
+	contentType := aws.ToString(head.ContentType)
+	copyInput := &s3.CopyObjectInput{
+		Bucket:            aws.String(cfg.s3Bucket),
+		Key:               aws.String(newKey),
+		CopySource:        aws.String(url.PathEscape(bucket + "/" + key)),
+		MetadataDirective: types.MetadataDirectiveCopy,
+		Tagging:           aws.String(keyParams.tags(contentType).encode()),
+		TaggingDirective:  types.TaggingDirectiveReplace,
+		StorageClass:      head.StorageClass,
+	}
+	cfg.s3SSE.applyToCopy(copyInput)
+	err = withSpan(ctx, "s3 copy", func(ctx context.Context) error {
+		_, err := cfg.s3Client.CopyObject(ctx, copyInput)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to copy %s: %w", key, err)
+	}
+	return fmt.Sprintf("%s,%s", cfg.s3Bucket, newKey), nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// trashPurgeInterval is how often videos past the retention window are
+// removed from the trash.
+const trashPurgeInterval = time.Hour
+
+// handlerVideosTrash lists the caller's trashed videos, most recently
+// deleted first.
+func (cfg *apiConfig) handlerVideosTrash(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	videos, err := cfg.db.WithContext(r.Context()).GetTrashedVideos(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	signedVideos := make([]database.Video, 0, len(videos))
+	for _, video := range videos {
+		signed, err := cfg.dbVideoToSignedVideo(video)
+		if err != nil {
+			requestLogger(r).Warn("Skipping video", "video_id", video.ID, "error", err)
+			continue
+		}
+		signedVideos = append(signedVideos, signed)
+	}
+
+	respondWithJSON(w, http.StatusOK, signedVideos)
+}
+
+// handlerVideoRestore takes one of the caller's videos out of the trash.
+func (cfg *apiConfig) handlerVideoRestore(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.WithContext(r.Context()).GetTrashedVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not in trash", nil)
+		return
+	}
+	canManage, err := cfg.canManageVideo(r.Context(), userID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if !canManage {
+		respondWithError(w, http.StatusNotFound, "Video not in trash", nil)
+		return
+	}
+
+	if err := cfg.db.WithContext(r.Context()).RestoreVideo(videoID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+	video, err = cfg.db.WithContext(r.Context()).GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		requestLogger(r).Warn("Failed to generate URL for video", "video_id", video.ID, "error", err)
+		video.VideoURL = nil
+		respondWithJSON(w, http.StatusOK, video)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+// startTrashPurger purges the trash, and the webhook delivery history, every
+// trashPurgeInterval until the server shuts down.
+func (cfg *apiConfig) startTrashPurger() {
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			cfg.purgeTrash(cfg.lifecycle.ctx)
+			cfg.pruneWebhookDeliveries(cfg.lifecycle.ctx)
+			select {
+			case <-ticker.C:
+			case <-cfg.lifecycle.drain:
+				return
+			}
+		}
+	}()
+}
+
+// purgeTrash deletes videos trashed longer than TRASH_RETENTION_DAYS ago,
+// along with the S3 objects of all their versions and job results and the
+// thumbnails that no other video still points at.
+func (cfg *apiConfig) purgeTrash(ctx context.Context) {
+	videos, err := cfg.db.WithContext(ctx).GetVideosTrashedBefore(time.Now().Add(-cfg.trashRetention))
+	if err != nil {
+		slog.Error("Couldn't list trashed videos", "error", err)
+		return
+	}
+	for _, video := range videos {
+		if ctx.Err() != nil {
+			return
+		}
+		objectURLs := videoObjectURLs(video.VideoURL, video.PreviewURL, video.SDRVideoURL, video.OriginalURL)
+		versions, err := cfg.db.WithContext(ctx).GetVideoVersions(video.ID)
+		if err != nil {
+			slog.Error("Couldn't list versions of video", "video_id", video.ID, "error", err)
+			continue
+		}
+		for _, v := range versions {
+			objectURLs = append(objectURLs, videoObjectURLs(v.VideoURL, v.PreviewURL, v.SDRVideoURL, v.OriginalURL)...)
+		}
+		// Clip and export results go with the jobs that made them
+		jobs, err := cfg.db.WithContext(ctx).ListJobs(database.JobFilter{VideoID: video.ID})
+		if err != nil {
+			slog.Error("Couldn't list jobs of video", "video_id", video.ID, "error", err)
+			continue
+		}
+		for _, job := range jobs {
+			if job.ResultURL != nil && *job.ResultURL != "" {
+				objectURLs = append(objectURLs, *job.ResultURL)
+			}
+		}
+
+		if err := cfg.db.WithContext(ctx).DeleteVideo(video.ID); err != nil {
+			slog.Error("Couldn't purge video", "video_id", video.ID, "error", err)
+			continue
+		}
+		cfg.deleteUnreferencedObjects(ctx, objectURLs...)
+		cfg.deleteUnreferencedAssets(ctx, video.ThumbnailURL, video.ThumbnailSourceURL)
+		slog.Info("Purged video from the trash", "video_id", video.ID)
+	}
+}
+
+// deleteUnreferencedObjects deletes each "bucket,key" object that no video
+// references anymore. Objects that can't be deleted are tagged superseded
+// for the bucket's lifecycle rules instead.
+func (cfg *apiConfig) deleteUnreferencedObjects(ctx context.Context, objectURLs ...string) {
+	seen := map[string]bool{}
+	for _, objectURL := range objectURLs {
+		if seen[objectURL] {
+			continue
+		}
+		seen[objectURL] = true
+		refs, err := cfg.db.WithContext(ctx).CountObjectReferences(objectURL)
+		if err != nil {
+			slog.Warn("Couldn't count object references", "object", objectURL, "error", err)
+			continue
+		}
+		if refs > 0 {
+			continue
+		}
+
+		bucket, key, err := splitVideoURL(objectURL)
+		if err != nil {
+			slog.Warn("Couldn't delete object", "error", err)
+			continue
+		}
+		_, err = cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			slog.Warn("Failed to delete object, marking it superseded", "key", key, "error", err)
+			cfg.markObjectsSuperseded(ctx, objectURL)
+		}
+	}
+}
+
+// deleteUnreferencedAssets removes each thumbnail under ASSETS_ROOT that no
+// video uses anymore. Duplicates and trims share their source's files.
+func (cfg *apiConfig) deleteUnreferencedAssets(ctx context.Context, assetURLs ...*string) {
+	seen := map[string]bool{}
+	for _, assetURL := range assetURLs {
+		if assetURL == nil || *assetURL == "" {
+			continue
+		}
+		name := path.Base(*assetURL)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		cfg.deleteUnreferencedAsset(ctx, name)
+	}
+}
+
+// deleteUnreferencedAsset removes the asset with the name, file and record,
+// unless a video still uses it.
+func (cfg *apiConfig) deleteUnreferencedAsset(ctx context.Context, name string) {
+	if !isAssetName(name) {
+		return
+	}
+	refs, err := cfg.db.WithContext(ctx).CountAssetReferences(name)
+	if err != nil {
+		slog.Warn("Couldn't count asset references", "asset", name, "error", err)
+		return
+	}
+	if refs > 0 {
+		return
+	}
+
+	removeIfExists(filepath.Join(cfg.assetsRoot, name))
+	if err := cfg.db.WithContext(ctx).DeleteAsset(name); err != nil {
+		slog.Warn("Couldn't forget asset", "asset", name, "error", err)
+	}
+}
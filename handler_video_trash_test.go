@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// trashTestVideo is a trashed video with a rendition and a clip job whose
+// result is in S3.
+func trashTestVideo(t *testing.T, cfg *apiConfig) (database.Video, database.Job) {
+	t.Helper()
+	video := createTestVideo(t, cfg, "talk")
+	videoURL := "b,landscape/talk.mp4"
+	video.VideoURL = &videoURL
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		t.Fatal(err)
+	}
+	job, err := cfg.db.CreateJob(database.CreateJobParams{UserID: video.UserID, VideoID: video.ID, Kind: jobKindClip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resultURL := "b,clips/talk-clip.mp4"
+	job.ResultURL = &resultURL
+	job.Status = database.JobStatusCompleted
+	if err := cfg.db.UpdateJob(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.db.TrashVideo(video.ID); err != nil {
+		t.Fatal(err)
+	}
+	return video, job
+}
+
+func TestPurgeTrashDeletesJobResults(t *testing.T) {
+	cfg, _, bucket := newTestConfig(t)
+	cfg.trashRetention = -time.Hour
+	video, _ := trashTestVideo(t, cfg)
+
+	cfg.purgeTrash(context.Background())
+
+	trashed, err := cfg.db.GetTrashedVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trashed.ID != uuid.Nil {
+		t.Fatal("video wasn't purged")
+	}
+	deleted := bucket.deletedPaths()
+	for _, want := range []string{"/b/landscape/talk.mp4", "/b/clips/talk-clip.mp4"} {
+		if !slices.Contains(deleted, want) {
+			t.Errorf("%s wasn't deleted, got %q", want, deleted)
+		}
+	}
+}
+
+func TestDeleteVideoIsAtomic(t *testing.T) {
+	cfg, raw, _ := newTestConfig(t)
+	video, job := trashTestVideo(t, cfg)
+
+	// The last statement fails after the jobs are gone
+	_, err := raw.Exec(`CREATE TRIGGER fail_video_delete BEFORE DELETE ON videos
+	BEGIN SELECT RAISE(ABORT, 'videos unavailable'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.db.DeleteVideo(video.ID); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	kept, err := cfg.db.GetJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept.ID != job.ID {
+		t.Error("the video's jobs were deleted without the video")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+type videoVersionResponse struct {
+	database.VideoVersion
+	// Active is whether the video's renditions are this version's
+	Active bool `json:"active"`
+}
+
+// handlerVideoVersionsList lists every upload of the caller's video,
+// newest first.
+func (cfg *apiConfig) handlerVideoVersionsList(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := cfg.db.WithContext(r.Context()).GetVideoVersions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get versions", err)
+		return
+	}
+
+	resp := make([]videoVersionResponse, 0, len(versions))
+	for _, v := range versions {
+		resp = append(resp, videoVersionResponse{
+			VideoVersion: v,
+			Active:       video.ActiveVersion != nil && *video.ActiveVersion == v.Version,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerVideoVersionActivate rolls the caller's video back (or forward)
+// to one of its earlier uploads without uploading it again.
+func (cfg *apiConfig) handlerVideoVersionActivate(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || number < 1 {
+		respondWithError(w, http.StatusBadRequest, "Invalid version", err)
+		return
+	}
+
+	version, err := cfg.db.WithContext(r.Context()).GetVideoVersion(video.ID, number)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get versions", err)
+		return
+	}
+	if version.Version == 0 {
+		respondWithError(w, http.StatusNotFound, "Version not found", nil)
+		return
+	}
+
+	video, err = cfg.db.WithContext(r.Context()).ActivateVideoVersion(video, version)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
+		return
+	}
+	annotateLog(w, "video_id", video.ID, "active_version", number)
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		requestLogger(r).Warn("Failed to generate URL for video", "video_id", video.ID, "error", err)
+		video.VideoURL = nil
+		respondWithJSON(w, http.StatusOK, video)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxViewSessionIDLength bounds the session IDs players pick
+const maxViewSessionIDLength = 128
+
+type viewBeaconParams struct {
+	// SessionID is picked by the player, e.g. a random UUID per playback,
+	// and sent with every beacon of the session
+	SessionID string `json:"session_id"`
+	// Position is the furthest point playback has reached, in seconds
+	Position float64 `json:"position"`
+	// Duration is the length of the video as the player sees it
+	Duration float64 `json:"duration"`
+}
+
+// handlerVideoView records a beacon from a player. Anyone who can see the
+// video may send them; repeated beacons of a session update its one view.
+func (cfg *apiConfig) handlerVideoView(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	// navigator.sendBeacon can't set a JSON Content-Type, so it isn't checked
+	var params viewBeaconParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.SessionID == "" || len(params.SessionID) > maxViewSessionIDLength {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", nil)
+		return
+	}
+	if !validPlaybackSeconds(params.Position) || !validPlaybackSeconds(params.Duration) {
+		respondWithError(w, http.StatusBadRequest, "Invalid playback position", fmt.Errorf("position %v, duration %v", params.Position, params.Duration))
+		return
+	}
+	completion := 0.0
+	if params.Duration > 0 {
+		completion = min(1, params.Position/params.Duration)
+	}
+
+	err := cfg.db.WithContext(r.Context()).RecordVideoView(database.VideoView{
+		VideoID:    video.ID,
+		SessionID:  params.SessionID,
+		Viewer:     cfg.viewerID(r),
+		Position:   params.Position,
+		Completion: completion,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record view", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validPlaybackSeconds(s float64) bool {
+	return s >= 0 && !math.IsInf(s, 0) && !math.IsNaN(s)
+}
+
+// viewerID tells unique viewers apart: signed-in users by their ID,
+// everyone else by address and user agent. Both are hashed with the JWT
+// secret, so the stored value can't be traced back to either.
+func (cfg *apiConfig) viewerID(r *http.Request) string {
+	var identity string
+	if userID := cfg.requesterID(r); userID != uuid.Nil {
+		identity = "user:" + userID.String()
+	} else {
+		identity = "anonymous:" + cfg.clientIP(r) + "|" + r.UserAgent()
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.jwtSecret))
+	mac.Write([]byte(identity))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+type videoStatsResponse struct {
+	VideoID uuid.UUID `json:"video_id"`
+	database.VideoStats
+}
+
+// handlerVideoStats returns the owner's playback analytics, optionally only
+// for views started since a point in time.
+func (cfg *apiConfig) handlerVideoStats(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid timestamp", err)
+			return
+		}
+	}
+
+	stats, err := cfg.db.WithContext(r.Context()).GetVideoStats(video.ID, since)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video stats", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, videoStatsResponse{VideoID: video.ID, VideoStats: stats})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// fakeS3 answers every request with 204 and remembers the paths of the
+// DELETE requests it got.
+type fakeS3 struct {
+	mu      sync.Mutex
+	deleted []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		f.mu.Lock()
+		f.deleted = append(f.deleted, r.URL.Path)
+		f.mu.Unlock()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeS3) deletedPaths() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.deleted...)
+}
+
+// newTestConfig returns a config backed by a fresh SQLite database and a
+// fake S3 bucket "b", along with a raw connection to the database for
+// setting up what the client can't.
+func newTestConfig(t *testing.T) (*apiConfig, *sql.DB, *fakeS3) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "tubely.db")
+	db, err := database.NewClient(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	raw, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { raw.Close() })
+
+	bucket := &fakeS3{}
+	srv := httptest.NewServer(bucket)
+	t.Cleanup(srv.Close)
+	s3Client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	cfg := &apiConfig{
+		db:         db,
+		s3Client:   s3Client,
+		s3Bucket:   "b",
+		assetsRoot: t.TempDir(),
+		lifecycle:  newLifecycle(),
+	}
+	return cfg, raw, bucket
+}
+
+// createTestVideo adds a user and a video of theirs.
+func createTestVideo(t *testing.T, cfg *apiConfig, title string) database.Video {
+	t.Helper()
+	user, err := cfg.db.CreateUser(database.CreateUserParams{Email: uuid.NewString() + "@example.com", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: title, UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
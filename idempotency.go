@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyKeyTTL is how long a key's response is replayed
+	idempotencyKeyTTL = 24 * time.Hour
+	// idempotencyClaimTimeout is when an unfinished request is assumed to
+	// have died with the server, freeing its key
+	idempotencyClaimTimeout = time.Hour
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotent lets clients safely retry next by sending an Idempotency-Key
+// header. The first request with a key runs normally; if it succeeds its
+// response is stored and replayed to every retry with the same key, so a
+// retried upload doesn't create a second job or S3 object. Failed requests
+// release the key so the retry runs again. Keys are scoped to the
+// authenticated user; requests without a valid token go straight to next,
+// which rejects them.
+func (cfg *apiConfig) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			respondWithError(w, http.StatusBadRequest, "Idempotency-Key is too long", nil)
+			return
+		}
+		userID, ok := cfg.idempotencyUser(r)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		if _, err := cfg.db.WithContext(r.Context()).DeleteIdempotencyKeysBefore(time.Now().Add(-idempotencyKeyTTL)); err != nil {
+			requestLogger(r).Warn("Couldn't expire idempotency keys", "error", err)
+		}
+
+		claimed, err := cfg.claimIdempotencyKey(r.Context(), userID, key, r.URL.Path)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't store idempotency key", err)
+			return
+		}
+		if !claimed {
+			cfg.replayIdempotentResponse(w, r, userID, key)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		if rec.status >= 200 && rec.status < 300 {
+			err = cfg.db.WithContext(context.WithoutCancel(r.Context())).CompleteIdempotencyKey(userID, key, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+		} else {
+			err = cfg.db.WithContext(context.WithoutCancel(r.Context())).ReleaseIdempotencyKey(userID, key)
+		}
+		if err != nil {
+			requestLogger(r).Error("Couldn't record idempotent response", "key", key, "error", err)
+		}
+	}
+}
+
+// claimIdempotencyKey claims key for this request, taking it over from a
+// request that never finished.
+func (cfg *apiConfig) claimIdempotencyKey(ctx context.Context, userID uuid.UUID, key, path string) (bool, error) {
+	claimed, err := cfg.db.WithContext(ctx).ClaimIdempotencyKey(userID, key, path)
+	if err != nil || claimed {
+		return claimed, err
+	}
+	existing, err := cfg.db.WithContext(ctx).GetIdempotencyKey(userID, key)
+	if err != nil {
+		return false, err
+	}
+	if existing.CompletedAt != nil || time.Since(existing.CreatedAt) < idempotencyClaimTimeout {
+		return false, nil
+	}
+	if err := cfg.db.WithContext(ctx).ReleaseIdempotencyKey(userID, key); err != nil {
+		return false, err
+	}
+	return cfg.db.WithContext(ctx).ClaimIdempotencyKey(userID, key, path)
+}
+
+// replayIdempotentResponse answers a retry with the stored response of the
+// first request, or an error if that one is still running or was made to
+// a different endpoint.
+func (cfg *apiConfig) replayIdempotentResponse(w http.ResponseWriter, r *http.Request, userID uuid.UUID, key string) {
+	existing, err := cfg.db.WithContext(r.Context()).GetIdempotencyKey(userID, key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get idempotency key", err)
+		return
+	}
+	switch {
+	case existing.Key == "":
+		// Released between our claim and this lookup; let the client retry
+		respondWithError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress", nil)
+	case existing.RequestPath != r.URL.Path:
+		respondWithError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request", nil)
+	case existing.CompletedAt == nil:
+		w.Header().Set("Retry-After", "5")
+		respondWithError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress", nil)
+	default:
+		annotateLog(w, "idempotent_replay", true)
+		if existing.ContentType != "" {
+			w.Header().Set("Content-Type", existing.ContentType)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(existing.StatusCode)
+		w.Write(existing.ResponseBody)
+	}
+}
+
+// idempotencyUser returns the user a request authenticates as.
+func (cfg *apiConfig) idempotencyUser(r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// idempotencyRecorder passes a response through while keeping a copy.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *idempotencyRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// jobKindIngestVideo processes a video dropped into the ingest prefix
+const jobKindIngestVideo = "ingest_video"
+
+const (
+	defaultIngestPrefix = "ingest/"
+	// ingestWaitSeconds is the SQS long poll, the longest SQS allows
+	ingestWaitSeconds = 20
+	ingestBatchSize   = 10
+	// ingestRetryDelay is the pause after a failed poll
+	ingestRetryDelay = 10 * time.Second
+)
+
+// s3EventNotification is the body S3 sends to the queue for bucket events.
+// Only the fields the consumer reads are declared.
+type s3EventNotification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// snsEnvelope wraps notifications that reach the queue through an SNS
+// topic without raw message delivery.
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// ingestVideoJobParams are the parameters of an ingest_video job.
+type ingestVideoJobParams struct {
+	Key string `json:"key"`
+}
+
+// startIngestConsumer long-polls INGEST_QUEUE_URL for S3 ObjectCreated
+// events until the server shuts down. It does nothing when no queue is
+// configured.
+func (cfg *apiConfig) startIngestConsumer() {
+	if cfg.sqsClient == nil {
+		return
+	}
+	// Stop a long poll in progress as soon as the drain starts, while a
+	// message being handled still gets to finish
+	ctx, cancel := context.WithCancel(cfg.lifecycle.ctx)
+	go func() {
+		<-cfg.lifecycle.drain
+		cancel()
+	}()
+
+	cfg.lifecycle.workers.Add(1)
+	go func() {
+		defer cfg.lifecycle.workers.Done()
+		slog.Info("Consuming ingest events", "queue_url", cfg.ingestQueueURL, "prefix", cfg.ingestPrefix)
+		for ctx.Err() == nil {
+			out, err := cfg.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+				QueueUrl:            aws.String(cfg.ingestQueueURL),
+				MaxNumberOfMessages: ingestBatchSize,
+				WaitTimeSeconds:     ingestWaitSeconds,
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("Couldn't receive ingest events", "error", err)
+					select {
+					case <-time.After(ingestRetryDelay):
+					case <-ctx.Done():
+					}
+				}
+				continue
+			}
+			for _, msg := range out.Messages {
+				cfg.handleIngestMessage(cfg.lifecycle.ctx, msg)
+			}
+		}
+	}()
+}
+
+// handleIngestMessage starts processing for every object the message
+// reports and deletes it from the queue. If that fails the message is left
+// for SQS to deliver again once its visibility timeout expires.
+func (cfg *apiConfig) handleIngestMessage(ctx context.Context, msg sqstypes.Message) {
+	body := aws.ToString(msg.Body)
+	var envelope snsEnvelope
+	if err := json.Unmarshal([]byte(body), &envelope); err == nil && envelope.Type == "Notification" {
+		body = envelope.Message
+	}
+
+	var notification s3EventNotification
+	if err := json.Unmarshal([]byte(body), &notification); err != nil {
+		// Redelivering it won't help
+		slog.Warn("Dropping unreadable ingest event", "message_id", aws.ToString(msg.MessageId), "error", err)
+		cfg.deleteIngestMessage(ctx, msg)
+		return
+	}
+	// S3 puts a single record in each message; s3:TestEvent has none
+	for _, record := range notification.Records {
+		if !strings.HasPrefix(record.EventName, "ObjectCreated:") || record.S3.Bucket.Name != cfg.s3Bucket {
+			continue
+		}
+		// Keys arrive form encoded
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			slog.Warn("Dropping ingest event with malformed key", "key", record.S3.Object.Key, "error", err)
+			continue
+		}
+		err = withSpan(ctx, "ingest object", func(ctx context.Context) error {
+			return cfg.ingestObject(ctx, key)
+		}, attribute.String("s3.key", key))
+		if err != nil {
+			slog.Error("Couldn't ingest object, leaving event for redelivery", "key", key, "error", err)
+			return
+		}
+	}
+	cfg.deleteIngestMessage(ctx, msg)
+}
+
+func (cfg *apiConfig) deleteIngestMessage(ctx context.Context, msg sqstypes.Message) {
+	_, err := cfg.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(cfg.ingestQueueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		slog.Warn("Couldn't delete ingest event", "message_id", aws.ToString(msg.MessageId), "error", err)
+	}
+}
+
+// ingestObject matches an object under INGEST_PREFIX to a video and queues
+// an ingest_video job for it. Keys look like <prefix><userID>/<name>: a
+// name of <videoID>.mp4 fills in that video, anything else becomes a new
+// video titled after the file. Objects that fit neither are skipped with a
+// warning; only errors worth retrying are returned.
+func (cfg *apiConfig) ingestObject(ctx context.Context, key string) error {
+	rest, ok := strings.CutPrefix(key, cfg.ingestPrefix)
+	if !ok || strings.HasSuffix(key, "/") {
+		return nil
+	}
+	owner, name, ok := strings.Cut(rest, "/")
+	userID, err := uuid.Parse(owner)
+	if !ok || err != nil {
+		slog.Warn("Skipping ingest object outside a user folder", "key", key)
+		return nil
+	}
+	user, err := cfg.db.WithContext(ctx).GetUser(userID)
+	if err != nil {
+		return fmt.Errorf("couldn't get user: %w", err)
+	}
+	if user == nil {
+		slog.Warn("Skipping ingest object for unknown user", "key", key, "user_id", userID)
+		return nil
+	}
+
+	base := path.Base(name)
+	title := strings.TrimSuffix(base, path.Ext(base))
+	var video database.Video
+	if videoID, err := uuid.Parse(title); err == nil {
+		video, err = cfg.db.WithContext(ctx).GetVideo(videoID)
+		if err != nil {
+			return fmt.Errorf("couldn't get video: %w", err)
+		}
+		if video.ID == uuid.Nil || video.UserID != userID {
+			slog.Warn("Skipping ingest object for unknown video", "key", key, "video_id", videoID)
+			return nil
+		}
+	} else {
+		video, err = cfg.db.WithContext(ctx).CreateVideo(database.CreateVideoParams{
+			Title:  title,
+			UserID: userID,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't create video: %w", err)
+		}
+	}
+
+	_, err = cfg.queueIngestJob(ctx, userID, video.ID, key)
+	return err
+}
+
+// queueIngestJob queues an ingest_video job that makes the object at key
+// the video's new upload.
+func (cfg *apiConfig) queueIngestJob(ctx context.Context, userID, videoID uuid.UUID, key string) (database.Job, error) {
+	dat, err := json.Marshal(ingestVideoJobParams{Key: key})
+	if err != nil {
+		return database.Job{}, err
+	}
+	job, err := cfg.db.WithContext(ctx).CreateJob(database.CreateJobParams{
+		UserID:      userID,
+		VideoID:     videoID,
+		Kind:        jobKindIngestVideo,
+		Params:      string(dat),
+		TraceParent: traceParent(ctx),
+	})
+	if err != nil {
+		return database.Job{}, fmt.Errorf("couldn't create job: %w", err)
+	}
+	cfg.enqueueJob(job)
+	if err := cfg.db.WithContext(context.WithoutCancel(ctx)).SetVideoProcessingStatus(videoID, database.ProcessingQueued); err != nil {
+		slog.Warn("Couldn't update processing status", "video_id", videoID, "error", err)
+	}
+	slog.Info("Ingesting object", "key", key, "user_id", userID, "video_id", videoID, "job_id", job.ID)
+	return job, nil
+}
+
+// runIngestVideoJob checks and copies an ingest object, or an assembled
+// chunked upload, into place like an import, then finishes it as an
+// import_video job would. The object is deleted once the video points at
+// the copy; if the job fails it stays where it was dropped.
+func (cfg *apiConfig) runIngestVideoJob(ctx context.Context, job database.Job) (database.Job, error) {
+	var params ingestVideoJobParams
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		return job, permanent(fmt.Errorf("invalid ingest_video parameters: %w", err))
+	}
+
+	if err := cfg.db.WithContext(ctx).SetVideoProcessingStatus(job.VideoID, database.ProcessingInProgress); err != nil {
+		slog.Warn("Couldn't update processing status", "video_id", job.VideoID, "error", err)
+	}
+	timer := newStageTimer()
+	copyURL, err := cfg.ingestVideo(ctx, job, params, timer)
+	job.StageTimings = timer.snapshot()
+	if err != nil {
+		// A job that runs again copies the object again, so the copy always
+		// goes
+		cfg.discardUploads("", copyURL)
+		status := database.ProcessingFailed
+		if cfg.jobFailureOutcome(ctx, job, err).runsAgain() {
+			status = database.ProcessingQueued
+		}
+		if err := cfg.db.WithContext(context.WithoutCancel(ctx)).SetVideoProcessingStatus(job.VideoID, status); err != nil {
+			slog.Warn("Couldn't update processing status", "video_id", job.VideoID, "error", err)
+		}
+		return job, err
+	}
+	cfg.deleteObject(params.Key)
+	return job, nil
+}
+
+// ingestVideo returns the "bucket,key" of the copy once it is made, so the
+// caller can discard it if a later step fails.
+func (cfg *apiConfig) ingestVideo(ctx context.Context, job database.Job, params ingestVideoJobParams, timer *stageTimer) (string, error) {
+	video, err := cfg.db.WithContext(ctx).GetVideo(job.VideoID)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		return "", permanent(fmt.Errorf("video %s was deleted", job.VideoID))
+	}
+
+	head, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(params.Key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't read ingest object: %w", err)
+	}
+	if aws.ToInt64(head.ContentLength) > maxCopyObjectSize {
+		return "", permanent(fmt.Errorf("%s is over the CopyObject limit", params.Key))
+	}
+
+	sourceURL, err := generatePresignedURL(cfg.s3Client, cfg.s3Bucket, params.Key, importPresignExpiry)
+	if err != nil {
+		return "", err
+	}
+	var aspect videoAspect
+	err = withSpan(ctx, "probe source", func(ctx context.Context) error {
+		var err error
+		aspect, err = cfg.probeAspect(ctx, sourceURL)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("ingest object is not a video: %w", err)
+	}
+	// Checked before the copy, since nothing probed it on the way in
+	_, err = cfg.probeVideoLength(ctx, video.UserID, sourceURL)
+	var tooLong *videoTooLongError
+	if errors.As(err, &tooLong) {
+		return "", permanent(err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if cfg.scanner != nil {
+		if err := cfg.scanIngestObject(ctx, params.Key); err != nil {
+			return "", err
+		}
+	}
+
+	imported, err := cfg.copyVideoObject(ctx, cfg.s3Client, video, aspect, cfg.s3Bucket, params.Key)
+	if err != nil {
+		return "", fmt.Errorf("couldn't copy ingest object: %w", err)
+	}
+	return imported.VideoURL, cfg.finishImportedVideo(ctx, job, imported, timer)
+}
+
+// scanIngestObject streams the object through the malware scanner. An
+// infected object is deleted so it can't be ingested again.
+func (cfg *apiConfig) scanIngestObject(ctx context.Context, key string) error {
+	body, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't read ingest object: %w", err)
+	}
+	defer body.Body.Close()
+
+	result, err := cfg.scanner.Scan(ctx, body.Body)
+	if err != nil {
+		return fmt.Errorf("couldn't scan file: %w", err)
+	}
+	if result.Infected {
+		slog.Warn("Deleting infected ingest object", "key", key, "signature", result.Signature)
+		cfg.deleteObject(key)
+		return permanent(errors.New("file failed malware scan"))
+	}
+	return nil
+}
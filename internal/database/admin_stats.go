@@ -0,0 +1,126 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SystemCounts are the sizes of the main tables.
+type SystemCounts struct {
+	Users         int `json:"users"`
+	Organizations int `json:"organizations"`
+	Videos        int `json:"videos"`
+	TrashedVideos int `json:"trashed_videos"`
+	// FailedVideos are videos whose latest upload failed to process
+	FailedVideos int `json:"failed_videos"`
+}
+
+func (c Client) GetSystemCounts() (SystemCounts, error) {
+	query := `
+	SELECT
+		(SELECT COUNT(*) FROM users),
+		(SELECT COUNT(*) FROM organizations),
+		(SELECT COUNT(*) FROM videos WHERE deleted_at IS NULL),
+		(SELECT COUNT(*) FROM videos WHERE deleted_at IS NOT NULL),
+		(SELECT COUNT(*) FROM videos WHERE deleted_at IS NULL AND processing_status = ?)
+	`
+	var counts SystemCounts
+	err := c.db.QueryRow(query, ProcessingFailed).Scan(
+		&counts.Users,
+		&counts.Organizations,
+		&counts.Videos,
+		&counts.TrashedVideos,
+		&counts.FailedVideos,
+	)
+	return counts, err
+}
+
+// JobKindStats counts one kind's jobs: those waiting, running and
+// dead-lettered now, and those that finished since the given time.
+type JobKindStats struct {
+	Kind         string `json:"kind"`
+	Queued       int    `json:"queued"`
+	Running      int    `json:"running"`
+	DeadLettered int    `json:"dead_lettered"`
+	Completed    int    `json:"completed"`
+	Failed       int    `json:"failed"`
+}
+
+// GetJobStats returns the stats of every kind with an unfinished or
+// dead-lettered job or a job that finished since since, by kind.
+func (c Client) GetJobStats(since time.Time) ([]JobKindStats, error) {
+	query := `
+	SELECT kind,
+		COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN status = ? AND updated_at >= ? THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN status = ? AND updated_at >= ? THEN 1 ELSE 0 END), 0)
+	FROM jobs
+	WHERE status IN (?, ?, ?) OR updated_at >= ?
+	GROUP BY kind
+	ORDER BY kind
+	`
+	since = since.UTC()
+	rows, err := c.db.Query(query,
+		JobStatusQueued, JobStatusRunning, JobStatusDeadLettered,
+		JobStatusCompleted, since,
+		JobStatusFailed, since,
+		JobStatusQueued, JobStatusRunning, JobStatusDeadLettered, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []JobKindStats{}
+	for rows.Next() {
+		var s JobKindStats
+		if err := rows.Scan(&s.Kind, &s.Queued, &s.Running, &s.DeadLettered, &s.Completed, &s.Failed); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// UploaderStats is a user's upload activity since the given time.
+type UploaderStats struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+	// Uploads counts the versions uploaded, including replacements
+	Uploads int `json:"uploads"`
+	// Videos counts the distinct videos they went to
+	Videos int `json:"videos"`
+}
+
+// GetTopUploaders returns the users who uploaded the most versions since
+// since, most first.
+func (c Client) GetTopUploaders(since time.Time, limit int) ([]UploaderStats, error) {
+	query := `
+	SELECT v.user_id, u.email, COUNT(*), COUNT(DISTINCT v.id)
+	FROM video_versions vv
+	JOIN videos v ON v.id = vv.video_id
+	JOIN users u ON u.id = v.user_id
+	WHERE vv.created_at >= ?
+	GROUP BY v.user_id, u.email
+	ORDER BY COUNT(*) DESC, u.email
+	LIMIT ?
+	`
+	rows, err := c.db.Query(query, since.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploaders := []UploaderStats{}
+	for rows.Next() {
+		var s UploaderStats
+		if err := rows.Scan(&s.UserID, &s.Email, &s.Uploads, &s.Videos); err != nil {
+			return nil, err
+		}
+		uploaders = append(uploaders, s)
+	}
+	return uploaders, rows.Err()
+}
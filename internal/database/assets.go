@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// Asset is a file in ASSETS_ROOT, such as a thumbnail or poster.
+type Asset struct {
+	Name string `json:"name"`
+	// VideoID is the video the asset was saved for
+	VideoID *uuid.UUID `json:"video_id"`
+	// ContentType is the media type the asset was stored as, unknown for
+	// assets saved before it was recorded
+	ContentType *string `json:"content_type"`
+}
+
+// assetUsedBy is the condition for video v using the file of the assets row
+// as its thumbnail or uncropped source, like CountAssetReferences checks.
+const assetUsedBy = `(v.thumbnail_url LIKE '%/assets/' || assets.name OR v.thumbnail_source_url LIKE '%/assets/' || assets.name)`
+
+// assetHeirOrder picks which of the videos still using an asset it is
+// handed to: the oldest one outside the trash.
+const assetHeirOrder = `ORDER BY v.deleted_at IS NOT NULL, v.created_at, v.id LIMIT 1`
+
+// CreateAsset records a file saved under ASSETS_ROOT.
+func (c Client) CreateAsset(asset Asset) error {
+	query := `
+	INSERT INTO assets (name, created_at, video_id, content_type)
+	VALUES (?, CURRENT_TIMESTAMP, ?, ?)
+	ON CONFLICT (name) DO UPDATE SET video_id = excluded.video_id, content_type = excluded.content_type
+	`
+	_, err := c.db.Exec(query, asset.Name, asset.VideoID, asset.ContentType)
+	return err
+}
+
+// GetAsset returns the asset with the name, or nil if none was recorded.
+func (c Client) GetAsset(name string) (*Asset, error) {
+	query := `
+	SELECT name, video_id, content_type
+	FROM assets
+	WHERE name = ?
+	`
+	var asset Asset
+	err := c.db.QueryRow(query, name).Scan(&asset.Name, &asset.VideoID, &asset.ContentType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// DeleteAsset forgets an asset whose file was removed.
+func (c Client) DeleteAsset(name string) error {
+	_, err := c.db.Exec(`DELETE FROM assets WHERE name = ?`, name)
+	return err
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry is one mutating request that succeeded. Entries are never
+// changed or deleted, except by Reset.
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateAuditEntryParams
+}
+
+type CreateAuditEntryParams struct {
+	Action string `json:"action"`
+	// ActorID is nil for anonymous requests such as signing up
+	ActorID   *uuid.UUID `json:"actor_id"`
+	IP        string     `json:"ip"`
+	RequestID string     `json:"request_id"`
+	Method    string     `json:"method"`
+	Path      string     `json:"path"`
+	Status    int        `json:"status"`
+	VideoID   *uuid.UUID `json:"video_id"`
+	// Details is a JSON object with action-specific fields
+	Details json.RawMessage `json:"details"`
+}
+
+// AuditFilter narrows ListAuditEntries; zero values match everything.
+type AuditFilter struct {
+	ActorID uuid.UUID
+	VideoID uuid.UUID
+	// Action matches exactly, or with a trailing "." every action under it
+	Action string
+	Since  time.Time
+	Until  time.Time
+	// BeforeID pages back from the previous page's last ID
+	BeforeID int64
+	Limit    int
+}
+
+const auditEntryColumns = `
+		id,
+		created_at,
+		action,
+		actor_id,
+		ip,
+		request_id,
+		method,
+		path,
+		status,
+		video_id,
+		details`
+
+func scanAuditEntry(row rowScanner) (AuditEntry, error) {
+	var entry AuditEntry
+	var details string
+	err := row.Scan(
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.Action,
+		&entry.ActorID,
+		&entry.IP,
+		&entry.RequestID,
+		&entry.Method,
+		&entry.Path,
+		&entry.Status,
+		&entry.VideoID,
+		&details,
+	)
+	entry.Details = json.RawMessage(details)
+	return entry, err
+}
+
+func (c Client) CreateAuditEntry(params CreateAuditEntryParams) error {
+	details := string(params.Details)
+	if details == "" {
+		details = "{}"
+	}
+	query := `
+	INSERT INTO audit_log (created_at, action, actor_id, ip, request_id, method, path, status, video_id, details)
+	VALUES (CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, params.Action, params.ActorID, params.IP, params.RequestID, params.Method, params.Path, params.Status, params.VideoID, details)
+	return err
+}
+
+// ListAuditEntries returns matching entries, newest first.
+func (c Client) ListAuditEntries(filter AuditFilter) ([]AuditEntry, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.ActorID != uuid.Nil {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.VideoID != uuid.Nil {
+		conditions = append(conditions, "video_id = ?")
+		args = append(args, filter.VideoID)
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, "."); ok {
+		conditions = append(conditions, "substr(action, 1, ?) = ?")
+		args = append(args, len(prefix)+1, prefix+".")
+	} else if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+
+	query := `
+	SELECT` + auditEntryColumns + `
+	FROM audit_log`
+	if len(conditions) > 0 {
+		query += `
+	WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += `
+	ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += `
+	LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+type Chapter struct {
+	VideoID uuid.UUID `json:"video_id"`
+	// Start is the chapter's offset from the beginning of the video in seconds
+	Start float64 `json:"start"`
+	Title string  `json:"title"`
+}
+
+func (c Client) GetChapters(videoID uuid.UUID) ([]Chapter, error) {
+	query := `
+	SELECT video_id, start_seconds, title
+	FROM chapters
+	WHERE video_id = ?
+	ORDER BY start_seconds ASC
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chapters := []Chapter{}
+	for rows.Next() {
+		var chapter Chapter
+		if err := rows.Scan(&chapter.VideoID, &chapter.Start, &chapter.Title); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters, rows.Err()
+}
+
+// ReplaceChapters swaps the video's chapter list for the given one
+// atomically.
+func (c Client) ReplaceChapters(videoID uuid.UUID, chapters []Chapter) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chapters WHERE video_id = ?`, videoID); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO chapters (video_id, start_seconds, title)
+	VALUES (?, ?, ?)
+	`
+	for _, chapter := range chapters {
+		if _, err := tx.Exec(query, videoID, chapter.Start, chapter.Title); err != nil {
+			return err
+		}
+	}
+	if err := indexVideoChapters(tx, videoID, chapters); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Chunked upload statuses. Chunks are accepted while an upload is open;
+// completing claims it so it is assembled and ingested only once. Aborted
+// uploads were cancelled or expired, and their chunks are gone.
+const (
+	ChunkedUploadOpen       = "open"
+	ChunkedUploadCompleting = "completing"
+	ChunkedUploadCompleted  = "completed"
+	ChunkedUploadAborted    = "aborted"
+)
+
+// ChunkedUpload is a video upload sent in chunks, each stored as a part of
+// an S3 multipart upload.
+type ChunkedUpload struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status"`
+	CompletedAt *time.Time `json:"completed_at"`
+	// JobID is the ingest_video job that processes the assembled file
+	JobID *uuid.UUID `json:"job_id"`
+	CreateChunkedUploadParams
+}
+
+type CreateChunkedUploadParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	VideoID uuid.UUID `json:"video_id"`
+	// ObjectKey is where the chunks are assembled
+	ObjectKey  string `json:"-"`
+	S3UploadID string `json:"-"`
+}
+
+const chunkedUploadColumns = `
+		id,
+		created_at,
+		status,
+		completed_at,
+		job_id,
+		user_id,
+		video_id,
+		object_key,
+		s3_upload_id`
+
+func scanChunkedUpload(row rowScanner) (ChunkedUpload, error) {
+	var u ChunkedUpload
+	err := row.Scan(
+		&u.ID,
+		&u.CreatedAt,
+		&u.Status,
+		&u.CompletedAt,
+		&u.JobID,
+		&u.UserID,
+		&u.VideoID,
+		&u.ObjectKey,
+		&u.S3UploadID,
+	)
+	return u, err
+}
+
+// CreateChunkedUpload records an open upload under a new ID that the caller
+// picked, since it is part of the object key.
+func (c Client) CreateChunkedUpload(id uuid.UUID, params CreateChunkedUploadParams) (ChunkedUpload, error) {
+	query := `
+	INSERT INTO chunked_uploads (id, created_at, user_id, video_id, object_key, s3_upload_id, status)
+	VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, params.UserID, params.VideoID, params.ObjectKey, params.S3UploadID, ChunkedUploadOpen)
+	if err != nil {
+		return ChunkedUpload{}, err
+	}
+	return c.GetChunkedUpload(id)
+}
+
+// GetChunkedUpload returns the zero ChunkedUpload if id doesn't exist.
+func (c Client) GetChunkedUpload(id uuid.UUID) (ChunkedUpload, error) {
+	query := `
+	SELECT` + chunkedUploadColumns + `
+	FROM chunked_uploads
+	WHERE id = ?
+	`
+	upload, err := scanChunkedUpload(c.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ChunkedUpload{}, nil
+	}
+	return upload, err
+}
+
+// ClaimChunkedUpload moves an open upload to completing. It returns false
+// if the upload wasn't open anymore.
+func (c Client) ClaimChunkedUpload(id uuid.UUID) (bool, error) {
+	return c.setChunkedUploadStatus(id, ChunkedUploadOpen, ChunkedUploadCompleting)
+}
+
+// ReleaseChunkedUpload reopens an upload whose completion failed.
+func (c Client) ReleaseChunkedUpload(id uuid.UUID) error {
+	_, err := c.setChunkedUploadStatus(id, ChunkedUploadCompleting, ChunkedUploadOpen)
+	return err
+}
+
+// AbortChunkedUpload moves an open upload to aborted. It returns false if
+// the upload wasn't open anymore.
+func (c Client) AbortChunkedUpload(id uuid.UUID) (bool, error) {
+	return c.setChunkedUploadStatus(id, ChunkedUploadOpen, ChunkedUploadAborted)
+}
+
+// AbortChunkedUploadByS3UploadID marks the unfinished upload backed by
+// the S3 multipart upload aborted, once that was aborted.
+func (c Client) AbortChunkedUploadByS3UploadID(s3UploadID string) error {
+	query := `
+	UPDATE chunked_uploads
+	SET status = ?
+	WHERE s3_upload_id = ? AND status IN (?, ?)
+	`
+	_, err := c.db.Exec(query, ChunkedUploadAborted, s3UploadID, ChunkedUploadOpen, ChunkedUploadCompleting)
+	return err
+}
+
+func (c Client) setChunkedUploadStatus(id uuid.UUID, from, to string) (bool, error) {
+	result, err := c.db.Exec(`UPDATE chunked_uploads SET status = ? WHERE id = ? AND status = ?`, to, id, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// FinishChunkedUpload records the job that ingests a completed upload.
+func (c Client) FinishChunkedUpload(id, jobID uuid.UUID) error {
+	query := `
+	UPDATE chunked_uploads
+	SET status = ?, completed_at = CURRENT_TIMESTAMP, job_id = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, ChunkedUploadCompleted, jobID, id)
+	return err
+}
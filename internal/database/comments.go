@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Comment struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	VideoID   uuid.UUID `json:"video_id"`
+	// UserID is nil once the author's account is deleted
+	UserID *uuid.UUID `json:"user_id"`
+	// ParentID is the comment this replies to, nil for top-level comments
+	ParentID *uuid.UUID `json:"parent_id"`
+	// Body is empty once the comment is deleted
+	Body      string     `json:"body"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	// ReplyCount leaves out deleted replies
+	ReplyCount int `json:"reply_count"`
+}
+
+// CommentCursor is the position after which ListComments continues.
+type CommentCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+const commentColumns = `
+		c.id,
+		c.created_at,
+		c.video_id,
+		c.user_id,
+		c.parent_id,
+		c.body,
+		c.deleted_at,
+		(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL)`
+
+func scanComment(row rowScanner) (Comment, error) {
+	var comment Comment
+	err := row.Scan(
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.VideoID,
+		&comment.UserID,
+		&comment.ParentID,
+		&comment.Body,
+		&comment.DeletedAt,
+		&comment.ReplyCount,
+	)
+	return comment, err
+}
+
+func (c Client) CreateComment(videoID, userID uuid.UUID, parentID *uuid.UUID, body string) (Comment, error) {
+	id := uuid.New()
+	// Set here rather than by the database so cursors compare against
+	// values of the same precision and format
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	query := `
+	INSERT INTO comments (id, created_at, video_id, user_id, parent_id, body)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	if _, err := c.db.Exec(query, id, createdAt, videoID, userID, parentID, body); err != nil {
+		return Comment{}, err
+	}
+	return c.GetComment(id)
+}
+
+// GetComment returns the zero Comment if id doesn't exist.
+func (c Client) GetComment(id uuid.UUID) (Comment, error) {
+	query := `
+	SELECT` + commentColumns + `
+	FROM comments c
+	WHERE c.id = ?
+	`
+	comment, err := scanComment(c.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Comment{}, nil
+	}
+	return comment, err
+}
+
+// ListComments returns up to limit comments on the video after the cursor,
+// or from the start if it is nil. With a nil parentID these are the
+// top-level comments, newest first; otherwise the replies to parentID, oldest
+// first so they read as a conversation. Deleted comments are only included
+// while they have replies, to keep those in place.
+func (c Client) ListComments(videoID uuid.UUID, parentID *uuid.UUID, after *CommentCursor, limit int) ([]Comment, error) {
+	query := `
+	SELECT` + commentColumns + `
+	FROM comments c
+	WHERE c.video_id = ?
+		AND (c.deleted_at IS NULL OR EXISTS (
+			SELECT 1 FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL))
+	`
+	args := []any{videoID}
+	order := "DESC"
+	cmp := "<"
+	if parentID == nil {
+		query += ` AND c.parent_id IS NULL`
+	} else {
+		query += ` AND c.parent_id = ?`
+		args = append(args, *parentID)
+		order, cmp = "ASC", ">"
+	}
+	if after != nil {
+		query += ` AND (c.created_at ` + cmp + ` ? OR (c.created_at = ? AND c.id ` + cmp + ` ?))`
+		args = append(args, after.CreatedAt.UTC(), after.CreatedAt.UTC(), after.ID)
+	}
+	query += ` ORDER BY c.created_at ` + order + `, c.id ` + order + ` LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// DeleteComment clears the comment's body and marks it deleted. The row is
+// kept so replies stay in their thread.
+func (c Client) DeleteComment(id uuid.UUID) error {
+	query := `
+	UPDATE comments
+	SET body = '', deleted_at = ?
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	_, err := c.db.Exec(query, time.Now().UTC(), id)
+	return err
+}
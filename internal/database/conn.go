@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// dialect is what differs between the supported databases. Queries are
+// written once, with ? placeholders and SQL both databases accept; each
+// dialect supplies its driver, placeholder syntax and schema migrations.
+type dialect interface {
+	name() string
+	driverName() string
+	// rebind rewrites a query's ? placeholders into the driver's syntax
+	rebind(query string) string
+	// timestampType is the column type for points in time
+	timestampType() string
+	// lockMigrations keeps concurrent migrate runs from interleaving
+	lockMigrations(t *tx) error
+	// prepareUnversioned brings a schema created before migrations were
+	// versioned up to the first migration
+	prepareUnversioned(db *conn) error
+	// searchSource selects the video_search rows matching the one ? argument
+	// as video_id, rank and the title, description and chapters highlights
+	searchSource() string
+	// searchQuery formats terms as searchSource's argument
+	searchQuery(terms []SearchTerm) string
+	// skipLocked ends a SELECT whose rows are about to be claimed, so
+	// concurrent claimers each get different ones
+	skipLocked() string
+}
+
+// conn is a *sql.DB that rebinds every query for its dialect and runs it
+// under ctx.
+type conn struct {
+	db     *sql.DB
+	rebind func(string) string
+	ctx    context.Context
+}
+
+func (c *conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, c.rebind(query), args...)
+}
+
+func (c *conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, c.rebind(query), args...)
+}
+
+func (c *conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, c.rebind(query), args...)
+}
+
+func (c *conn) Begin() (*tx, error) {
+	t, err := c.db.BeginTx(c.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{tx: t, rebind: c.rebind, ctx: c.ctx}, nil
+}
+
+func (c *conn) PingContext(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+func (c *conn) Close() error {
+	return c.db.Close()
+}
+
+// tx is a *sql.Tx that rebinds every query for its dialect. Canceling the
+// context it was begun with rolls it back.
+type tx struct {
+	tx     *sql.Tx
+	rebind func(string) string
+	ctx    context.Context
+}
+
+func (t *tx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.tx.ExecContext(t.ctx, t.rebind(query), args...)
+}
+
+func (t *tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(t.ctx, t.rebind(query), args...)
+}
+
+func (t *tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *tx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// rebindNumbered replaces each ? outside string literals with $1, $2, ...
+func rebindNumbered(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inString = !inString
+		case ch == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
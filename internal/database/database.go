@@ -1,89 +1,71 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-
-	_ "github.com/mattn/go-sqlite3"
+	"strings"
 )
 
 type Client struct {
-	db *sql.DB
+	db      *conn
+	dialect dialect
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+// NewClient opens and migrates the database at dsn. A postgres:// or
+// postgresql:// URL selects PostgreSQL; anything else is a SQLite file path.
+func NewClient(dsn string) (Client, error) {
+	d := dialectFor(dsn)
+	db, err := sql.Open(d.driverName(), dsn)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	c := Client{db: &conn{db: db, rebind: d.rebind, ctx: context.Background()}, dialect: d}
+	err = migrate(c.db, d)
 	if err != nil {
+		db.Close()
 		return Client{}, err
 	}
 	return c, nil
 
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
-	if err != nil {
-		return err
-	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
-	if err != nil {
-		return err
+func dialectFor(dsn string) dialect {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return postgresDialect{}
 	}
+	return sqliteDialect{}
+}
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
-	if err != nil {
-		return err
-	}
-	return nil
+// WithContext returns a copy of c whose queries run under ctx, so they are
+// canceled along with the request or job they belong to. c itself keeps
+// running queries without a deadline.
+func (c Client) WithContext(ctx context.Context) Client {
+	db := *c.db
+	db.ctx = ctx
+	c.db = &db
+	return c
+}
+
+// Dialect names the database in use, "sqlite" or "postgres".
+func (c Client) Dialect() string {
+	return c.dialect.name()
+}
+
+func (c Client) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+func (c Client) Close() error {
+	return c.db.Close()
 }
 
 func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
-		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
-	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
-	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
-		return fmt.Errorf("failed to reset table videos: %w", err)
+	// Children first, so PostgreSQL's foreign keys hold throughout
+	for _, table := range []string{"audit_log", "webhook_deliveries", "idempotency_keys", "comments", "video_likes", "video_search", "playlist_items", "playlists", "video_transfers", "chunked_uploads", "multipart_uploads", "assets", "chapters", "video_views", "jobs", "video_versions", "refresh_tokens", "egress", "egress_caps", "notification_preferences", "cloudfront_log_files", "videos", "organization_members", "organizations", "users"} {
+		if _, err := c.db.Exec("DELETE FROM " + table); err != nil {
+			return fmt.Errorf("failed to reset table %s: %w", table, err)
+		}
 	}
 	return nil
 }
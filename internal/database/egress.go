@@ -0,0 +1,200 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Where served bytes were counted
+const (
+	EgressProxy      = "proxy"
+	EgressCloudFront = "cloudfront"
+)
+
+// egressDayLayout is how days are stored, so ranges compare as text
+const egressDayLayout = "2006-01-02"
+
+// Egress is a number of bytes of a video served on a day.
+type Egress struct {
+	UserID uuid.UUID
+	// OrgID is set for organization videos, whose egress counts against
+	// the organization instead of the user
+	OrgID   *uuid.UUID
+	VideoID uuid.UUID
+	Day     time.Time
+	Source  string
+	Bytes   int64
+}
+
+// VideoEgress totals what was served of one video.
+type VideoEgress struct {
+	VideoID         uuid.UUID `json:"video_id"`
+	Bytes           int64     `json:"bytes"`
+	ProxyBytes      int64     `json:"proxy_bytes"`
+	CloudFrontBytes int64     `json:"cloudfront_bytes"`
+}
+
+// AddEgress adds to the bytes counted for the video's day and source.
+func (c Client) AddEgress(e Egress) error {
+	query := `
+	INSERT INTO egress (user_id, org_id, video_id, day, source, bytes)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (video_id, day, source) DO UPDATE SET
+		bytes = egress.bytes + excluded.bytes
+	`
+	_, err := c.db.Exec(query, e.UserID.String(), e.OrgID, e.VideoID.String(), e.Day.UTC().Format(egressDayLayout), e.Source, e.Bytes)
+	return err
+}
+
+// Egress is counted against a user for their own videos and against an
+// organization for its videos.
+const (
+	userEgressScope = `user_id = ? AND org_id IS NULL`
+	orgEgressScope  = `org_id = ?`
+)
+
+// GetUserEgress returns what was served of each of the user's own videos on
+// the days from start up to but excluding end, most served first.
+func (c Client) GetUserEgress(userID uuid.UUID, start, end time.Time) ([]VideoEgress, error) {
+	return c.getEgress(userEgressScope, userID, start, end)
+}
+
+// GetOrgEgress is GetUserEgress for the organization's videos.
+func (c Client) GetOrgEgress(orgID uuid.UUID, start, end time.Time) ([]VideoEgress, error) {
+	return c.getEgress(orgEgressScope, orgID, start, end)
+}
+
+func (c Client) getEgress(scope string, id uuid.UUID, start, end time.Time) ([]VideoEgress, error) {
+	query := `
+	SELECT video_id, SUM(bytes),
+		SUM(CASE WHEN source = ? THEN bytes ELSE 0 END),
+		SUM(CASE WHEN source = ? THEN bytes ELSE 0 END)
+	FROM egress
+	WHERE ` + scope + ` AND day >= ? AND day < ?
+	GROUP BY video_id
+	ORDER BY SUM(bytes) DESC
+	`
+	rows, err := c.db.Query(query, EgressProxy, EgressCloudFront, id.String(),
+		start.UTC().Format(egressDayLayout), end.UTC().Format(egressDayLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []VideoEgress{}
+	for rows.Next() {
+		var (
+			v  VideoEgress
+			id string
+		)
+		if err := rows.Scan(&id, &v.Bytes, &v.ProxyBytes, &v.CloudFrontBytes); err != nil {
+			return nil, err
+		}
+		if v.VideoID, err = uuid.Parse(id); err != nil {
+			return nil, err
+		}
+		usage = append(usage, v)
+	}
+	return usage, rows.Err()
+}
+
+// GetUserEgressTotal is the sum of GetUserEgress.
+func (c Client) GetUserEgressTotal(userID uuid.UUID, start, end time.Time) (int64, error) {
+	return c.getEgressTotal(userEgressScope, userID, start, end)
+}
+
+// GetOrgEgressTotal is the sum of GetOrgEgress.
+func (c Client) GetOrgEgressTotal(orgID uuid.UUID, start, end time.Time) (int64, error) {
+	return c.getEgressTotal(orgEgressScope, orgID, start, end)
+}
+
+func (c Client) getEgressTotal(scope string, id uuid.UUID, start, end time.Time) (int64, error) {
+	query := `
+	SELECT COALESCE(SUM(bytes), 0)
+	FROM egress
+	WHERE ` + scope + ` AND day >= ? AND day < ?
+	`
+	var total int64
+	err := c.db.QueryRow(query, id.String(),
+		start.UTC().Format(egressDayLayout), end.UTC().Format(egressDayLayout)).Scan(&total)
+	return total, err
+}
+
+// GetEgressCap returns the user's own monthly cap, or nil if they have the
+// default one.
+func (c Client) GetEgressCap(userID uuid.UUID) (*int64, error) {
+	var monthlyBytes int64
+	err := c.db.QueryRow(`SELECT monthly_bytes FROM egress_caps WHERE user_id = ?`, userID.String()).Scan(&monthlyBytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &monthlyBytes, nil
+}
+
+// SetEgressCap gives the user their own monthly cap, or with nil puts them
+// back on the default one.
+func (c Client) SetEgressCap(userID uuid.UUID, monthlyBytes *int64) error {
+	if monthlyBytes == nil {
+		_, err := c.db.Exec(`DELETE FROM egress_caps WHERE user_id = ?`, userID.String())
+		return err
+	}
+	query := `
+	INSERT INTO egress_caps (user_id, monthly_bytes)
+	VALUES (?, ?)
+	ON CONFLICT (user_id) DO UPDATE SET monthly_bytes = excluded.monthly_bytes
+	`
+	_, err := c.db.Exec(query, userID.String(), *monthlyBytes)
+	return err
+}
+
+// ClaimCloudFrontLogFile records the log file as counted. It returns false
+// if it already was, by this or another server.
+func (c Client) ClaimCloudFrontLogFile(key string) (bool, error) {
+	result, err := c.db.Exec(`INSERT INTO cloudfront_log_files (key) VALUES (?) ON CONFLICT DO NOTHING`, key)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseCloudFrontLogFile forgets a claimed log file that couldn't be
+// counted, so the next run tries it again.
+func (c Client) ReleaseCloudFrontLogFile(key string) error {
+	_, err := c.db.Exec(`DELETE FROM cloudfront_log_files WHERE key = ?`, key)
+	return err
+}
+
+// VideoOwner is who a video's egress is counted against.
+type VideoOwner struct {
+	VideoID uuid.UUID
+	UserID  uuid.UUID
+	OrgID   *uuid.UUID
+}
+
+// GetVideoOwnerByObjectKey finds the video whose stream, preview or
+// original is stored under key, trashed or not. It returns the zero
+// VideoOwner if there is none.
+func (c Client) GetVideoOwnerByObjectKey(key string) (VideoOwner, error) {
+	query := `
+	SELECT id, user_id, org_id
+	FROM videos
+	WHERE video_key = ? OR preview_key = ? OR original_key = ?
+	LIMIT 1
+	`
+	var owner VideoOwner
+	err := c.db.QueryRow(query, key, key, key).Scan(&owner.VideoID, &owner.UserID, &owner.OrgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return VideoOwner{}, nil
+	}
+	return owner, err
+}
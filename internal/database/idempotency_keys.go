@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey records a request made with an Idempotency-Key header.
+// CompletedAt is nil while the first request is still running; afterwards
+// the row holds its response for replaying to retries.
+type IdempotencyKey struct {
+	UserID       uuid.UUID
+	Key          string
+	RequestPath  string
+	CreatedAt    time.Time
+	CompletedAt  *time.Time
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+}
+
+// ClaimIdempotencyKey records key as in progress for userID. It returns
+// false without changing anything if the key is already recorded.
+func (c Client) ClaimIdempotencyKey(userID uuid.UUID, key, requestPath string) (bool, error) {
+	query := `
+	INSERT INTO idempotency_keys (user_id, key, request_path, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT DO NOTHING
+	`
+	result, err := c.db.Exec(query, userID.String(), key, requestPath)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// GetIdempotencyKey returns the zero IdempotencyKey if key isn't recorded.
+func (c Client) GetIdempotencyKey(userID uuid.UUID, key string) (IdempotencyKey, error) {
+	query := `
+	SELECT request_path, created_at, completed_at, status_code, content_type, response_body
+	FROM idempotency_keys
+	WHERE user_id = ? AND key = ?
+	`
+	var (
+		record      IdempotencyKey
+		completedAt sql.NullTime
+		statusCode  sql.NullInt64
+		contentType sql.NullString
+	)
+	err := c.db.QueryRow(query, userID.String(), key).Scan(
+		&record.RequestPath,
+		&record.CreatedAt,
+		&completedAt,
+		&statusCode,
+		&contentType,
+		&record.ResponseBody,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return IdempotencyKey{}, nil
+		}
+		return IdempotencyKey{}, err
+	}
+	record.UserID = userID
+	record.Key = key
+	if completedAt.Valid {
+		record.CompletedAt = &completedAt.Time
+	}
+	record.StatusCode = int(statusCode.Int64)
+	record.ContentType = contentType.String
+	return record, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that claimed key.
+func (c Client) CompleteIdempotencyKey(userID uuid.UUID, key string, statusCode int, contentType string, body []byte) error {
+	query := `
+	UPDATE idempotency_keys
+	SET completed_at = CURRENT_TIMESTAMP, status_code = ?, content_type = ?, response_body = ?
+	WHERE user_id = ? AND key = ?
+	`
+	_, err := c.db.Exec(query, statusCode, contentType, body, userID.String(), key)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets key so the request can be retried.
+func (c Client) ReleaseIdempotencyKey(userID uuid.UUID, key string) error {
+	_, err := c.db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND key = ?", userID.String(), key)
+	return err
+}
+
+// DeleteIdempotencyKeysBefore forgets keys first used before cutoff,
+// returning how many were removed.
+func (c Client) DeleteIdempotencyKeysBefore(cutoff time.Time) (int64, error) {
+	result, err := c.db.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,463 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	// JobStatusDeadLettered jobs ran out of retries; an admin can queue
+	// them again or discard them
+	JobStatusDeadLettered = "dead_lettered"
+	// JobStatusCanceled jobs were abandoned by their owner
+	JobStatusCanceled = "canceled"
+)
+
+// Job priorities, highest first. Workers claim queued jobs of a higher
+// priority before older ones of a lower priority.
+const (
+	JobPriorityHigh   = "high"
+	JobPriorityNormal = "normal"
+	JobPriorityLow    = "low"
+)
+
+// JobPriorities lists every priority, highest first.
+var JobPriorities = []string{JobPriorityHigh, JobPriorityNormal, JobPriorityLow}
+
+// jobPriorityRank orders jobs by priority in SQL, like JobPriorities.
+const jobPriorityRank = `CASE priority WHEN 'high' THEN 0 WHEN 'normal' THEN 1 ELSE 2 END`
+
+type Job struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Status    string    `json:"status"`
+	Error     *string   `json:"error"`
+	// ResultURL is the "bucket,key" of the produced asset until it is signed
+	// for a response.
+	ResultURL         *string `json:"result_url"`
+	ResultContentType *string `json:"result_content_type"`
+	// StageTimings records how long each processing stage took
+	StageTimings StageTimings `json:"stage_timings_ms"`
+	// Checkpoint holds kind-specific JSON progress saved so an interrupted
+	// job can resume instead of starting over.
+	Checkpoint *string `json:"-"`
+	// Attempts counts the runs so far, including the current one
+	Attempts int `json:"attempts"`
+	// NextAttemptAt is when a queued job waiting to be retried may run
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	// StartedAt is when the latest attempt started
+	StartedAt *time.Time `json:"started_at"`
+	CreateJobParams
+}
+
+// StageTimings maps a processing stage name to its duration in milliseconds.
+// It is stored as a JSON object in a TEXT column.
+type StageTimings map[string]int64
+
+func (t StageTimings) Value() (driver.Value, error) {
+	if t == nil {
+		return "{}", nil
+	}
+	dat, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(dat), nil
+}
+
+func (t *StageTimings) Scan(src any) error {
+	var dat []byte
+	switch v := src.(type) {
+	case nil:
+		*t = StageTimings{}
+		return nil
+	case string:
+		dat = []byte(v)
+	case []byte:
+		dat = v
+	default:
+		return fmt.Errorf("unsupported stage timings type %T", src)
+	}
+	timings := StageTimings{}
+	if err := json.Unmarshal(dat, &timings); err != nil {
+		return err
+	}
+	*t = timings
+	return nil
+}
+
+// JobFilter narrows ListJobs; zero values match everything.
+type JobFilter struct {
+	UserID  uuid.UUID
+	VideoID uuid.UUID
+	Kind    string
+	Status  string
+	Limit   int
+}
+
+type CreateJobParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	VideoID uuid.UUID `json:"video_id"`
+	Kind    string    `json:"kind"`
+	// Params holds the kind-specific job parameters as JSON.
+	Params string `json:"-"`
+	// TraceParent is the W3C traceparent of the request that created the job
+	TraceParent string `json:"-"`
+	// Priority is one of JobPriorities, JobPriorityNormal if empty
+	Priority string `json:"priority"`
+	// InputSeconds is the length of the media the job works on, if known
+	InputSeconds *float64 `json:"input_seconds,omitempty"`
+}
+
+const jobColumns = `
+		id,
+		created_at,
+		updated_at,
+		user_id,
+		video_id,
+		kind,
+		params,
+		trace_parent,
+		priority,
+		input_seconds,
+		status,
+		error,
+		result_url,
+		result_content_type,
+		stage_timings,
+		checkpoint,
+		attempts,
+		next_attempt_at,
+		started_at`
+
+func scanJob(row rowScanner) (Job, error) {
+	var job Job
+	err := row.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.UserID,
+		&job.VideoID,
+		&job.Kind,
+		&job.Params,
+		&job.TraceParent,
+		&job.Priority,
+		&job.InputSeconds,
+		&job.Status,
+		&job.Error,
+		&job.ResultURL,
+		&job.ResultContentType,
+		&job.StageTimings,
+		&job.Checkpoint,
+		&job.Attempts,
+		&job.NextAttemptAt,
+		&job.StartedAt,
+	)
+	return job, err
+}
+
+func (c Client) CreateJob(params CreateJobParams) (Job, error) {
+	id, err := insertJob(c.db, params)
+	if err != nil {
+		return Job{}, err
+	}
+
+	return c.GetJob(id)
+}
+
+func insertJob(db execer, params CreateJobParams) (uuid.UUID, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO jobs (
+		id,
+		created_at,
+		updated_at,
+		user_id,
+		video_id,
+		kind,
+		params,
+		trace_parent,
+		priority,
+		input_seconds,
+		status
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	priority := params.Priority
+	if priority == "" {
+		priority = JobPriorityNormal
+	}
+	_, err := db.Exec(query, id, params.UserID, params.VideoID, params.Kind, params.Params, params.TraceParent, priority, params.InputSeconds, JobStatusQueued)
+	return id, err
+}
+
+func (c Client) GetJob(id uuid.UUID) (Job, error) {
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs
+	WHERE id = ?
+	`
+
+	job, err := scanJob(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+func (c Client) UpdateJob(job Job) error {
+	query := `
+	UPDATE jobs
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		status = ?,
+		error = ?,
+		result_url = ?,
+		result_content_type = ?,
+		stage_timings = ?,
+		checkpoint = ?,
+		attempts = ?,
+		next_attempt_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(
+		query,
+		job.Status,
+		job.Error,
+		job.ResultURL,
+		job.ResultContentType,
+		job.StageTimings,
+		job.Checkpoint,
+		job.Attempts,
+		job.NextAttemptAt,
+		job.ID,
+	)
+	return err
+}
+
+// ClaimJob marks the queued job id running and counts the attempt. ok is
+// false if the job isn't queued, for example because another worker
+// claimed it first.
+func (c Client) ClaimJob(id uuid.UUID) (job Job, ok bool, err error) {
+	query := `
+	UPDATE jobs
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		started_at = CURRENT_TIMESTAMP,
+		status = ?,
+		attempts = attempts + 1
+	WHERE id = ? AND status = ?
+	`
+	res, err := c.db.Exec(query, JobStatusRunning, id, JobStatusQueued)
+	if err != nil {
+		return Job{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return Job{}, false, err
+	}
+	job, err = c.GetJob(id)
+	return job, err == nil, err
+}
+
+// ClaimNextJob claims the queued job that is due at now with the highest
+// of the given priorities, oldest first, like ClaimJob. ok is false if
+// there is none. On PostgreSQL, jobs other workers are claiming at the
+// same time are skipped rather than waited for.
+func (c Client) ClaimNextJob(now time.Time, priorities []string) (job Job, ok bool, err error) {
+	if len(priorities) == 0 {
+		return Job{}, false, nil
+	}
+	args := []any{JobStatusRunning, JobStatusQueued, now.UTC()}
+	for _, priority := range priorities {
+		args = append(args, priority)
+	}
+	query := `
+	UPDATE jobs
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		started_at = CURRENT_TIMESTAMP,
+		status = ?,
+		attempts = attempts + 1
+	WHERE id = (
+		SELECT id
+		FROM jobs
+		WHERE status = ?
+			AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+			AND priority IN (?` + strings.Repeat(", ?", len(priorities)-1) + `)
+		ORDER BY ` + jobPriorityRank + `, created_at ASC
+		LIMIT 1` + c.dialect.skipLocked() + `
+	)
+	RETURNING id
+	`
+	var id uuid.UUID
+	err = c.db.QueryRow(query, args...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+	job, err = c.GetJob(id)
+	return job, err == nil, err
+}
+
+// TouchJob records that the running job id is still being worked on.
+// running is false once the job is no longer running, for example because
+// it was canceled.
+func (c Client) TouchJob(id uuid.UUID) (running bool, err error) {
+	res, err := c.db.Exec(`UPDATE jobs SET updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?`, id, JobStatusRunning)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CancelJob marks the job id canceled if it is still in status. ok is
+// false if it moved on in the meantime.
+func (c Client) CancelJob(id uuid.UUID, status string) (ok bool, err error) {
+	query := `
+	UPDATE jobs
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		status = ?,
+		next_attempt_at = NULL
+	WHERE id = ? AND status = ?
+	`
+	res, err := c.db.Exec(query, JobStatusCanceled, id, status)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RequeueStaleJobs queues running jobs that haven't been touched since
+// cutoff again, because the worker running them is gone, and returns
+// their IDs.
+func (c Client) RequeueStaleJobs(cutoff time.Time) ([]uuid.UUID, error) {
+	query := `
+	UPDATE jobs
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		status = ?
+	WHERE status = ? AND updated_at < ?
+	RETURNING id
+	`
+	rows, err := c.db.Query(query, JobStatusQueued, JobStatusRunning, cutoff.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListQueuedJobsAhead lists the queued jobs workers would claim before
+// job, in that order, ignoring retry backoffs.
+func (c Client) ListQueuedJobsAhead(job Job) ([]Job, error) {
+	rank := slices.Index(JobPriorities, job.Priority)
+	if rank < 0 {
+		rank = len(JobPriorities) - 1
+	}
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs
+	WHERE status = ?
+		AND id != ?
+		AND (` + jobPriorityRank + ` < ? OR (priority = ? AND created_at < ?))
+	ORDER BY ` + jobPriorityRank + `, created_at ASC
+	`
+	rows, err := c.db.Query(query, JobStatusQueued, job.ID, rank, job.Priority, job.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (c Client) ListJobs(filter JobFilter) ([]Job, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.UserID != uuid.Nil {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.VideoID != uuid.Nil {
+		conditions = append(conditions, "video_id = ?")
+		args = append(args, filter.VideoID)
+	}
+	if filter.Kind != "" {
+		conditions = append(conditions, "kind = ?")
+		args = append(args, filter.Kind)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs`
+	if len(conditions) > 0 {
+		query += `
+	WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += `
+	ORDER BY created_at DESC`
+	if filter.Limit > 0 {
+		query += `
+	LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// migrationFiles holds each dialect's schema history under
+// migrations/<dialect>/, one NNNN_name.up.sql file per version. Applied
+// migrations must never be edited; change the schema by adding a file.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationNameRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.up\.sql$`)
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// loadMigrations reads a dialect's migrations in version order, insisting
+// the versions run 1, 2, 3... without gaps.
+func loadMigrations(dialectName string) ([]migration, error) {
+	dir := path.Join("migrations", dialectName)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, entry := range entries {
+		m := migrationNameRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		dat, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{Version: version, Name: m[2], SQL: string(dat)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d_%s is out of sequence, expected version %d", m.Version, m.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// migrate applies the dialect's pending migrations in a single transaction
+// and records each in schema_migrations, so the schema is either fully
+// upgraded or left as it was.
+func migrate(db *conn, d dialect) error {
+	migrations, err := loadMigrations(d.name())
+	if err != nil {
+		return fmt.Errorf("couldn't load migrations: %w", err)
+	}
+	if err := d.prepareUnversioned(db); err != nil {
+		return fmt.Errorf("couldn't upgrade unversioned schema: %w", err)
+	}
+
+	t, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	// Servers starting together on one database take turns
+	if err := d.lockMigrations(t); err != nil {
+		return fmt.Errorf("couldn't lock migrations: %w", err)
+	}
+	_, err = t.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at ` + d.timestampType() + ` DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(t)
+	if err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].Version; current > latest {
+		return fmt.Errorf("database schema is at version %d, newer than this build's %d", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		// Run as written; the files use each dialect's own syntax
+		if _, err := t.tx.Exec(m.SQL); err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		if _, err := t.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func schemaVersion(q rowQuerier) (int, error) {
+	var version int
+	err := q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// SchemaVersion is the number of the last migration applied.
+func (c Client) SchemaVersion() (int, error) {
+	return schemaVersion(c.db)
+}
@@ -0,0 +1,75 @@
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMPTZ,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	source_video_id TEXT REFERENCES videos(id) ON DELETE SET NULL,
+	preview_url TEXT,
+	poster_timestamp DOUBLE PRECISION,
+	original_url TEXT,
+	original_archived_at TIMESTAMPTZ,
+	sha256 TEXT,
+	moderation_status TEXT NOT NULL DEFAULT '',
+	moderation_labels TEXT NOT NULL DEFAULT '',
+	moderation_reason TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_videos_user_id ON videos(user_id);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	kind TEXT NOT NULL,
+	params TEXT NOT NULL DEFAULT '{}',
+	status TEXT NOT NULL,
+	error TEXT,
+	result_url TEXT,
+	result_content_type TEXT,
+	stage_timings TEXT NOT NULL DEFAULT '{}',
+	checkpoint TEXT,
+	trace_parent TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_video_id ON jobs(video_id);
+
+CREATE TABLE IF NOT EXISTS chapters (
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	start_seconds DOUBLE PRECISION NOT NULL,
+	title TEXT NOT NULL,
+	PRIMARY KEY(video_id, start_seconds)
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	key TEXT NOT NULL,
+	request_path TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMPTZ,
+	status_code INTEGER,
+	content_type TEXT,
+	response_body BYTEA,
+	PRIMARY KEY(user_id, key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
@@ -0,0 +1,2 @@
+-- public, unlisted or private; existing videos stay public
+ALTER TABLE videos ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
@@ -0,0 +1,7 @@
+-- An account purge job outlives the user and videos it cleans up after, so
+-- jobs no longer reference them; deleting a video or account removes its
+-- jobs explicitly
+ALTER TABLE jobs DROP CONSTRAINT IF EXISTS jobs_user_id_fkey;
+ALTER TABLE jobs DROP CONSTRAINT IF EXISTS jobs_video_id_fkey;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id);
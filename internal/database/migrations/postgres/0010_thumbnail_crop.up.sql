@@ -0,0 +1,4 @@
+-- The uncropped image a cropped thumbnail was cut from, and how it was cut
+-- as JSON. Both are NULL for thumbnails that were never cropped.
+ALTER TABLE videos ADD COLUMN thumbnail_source_url TEXT;
+ALTER TABLE videos ADD COLUMN thumbnail_crop TEXT;
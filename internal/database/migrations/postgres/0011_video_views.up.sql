@@ -0,0 +1,14 @@
+-- One row per playback session, updated by the player's beacons with the
+-- furthest position reached. viewer is a keyed hash, never a user ID or IP.
+CREATE TABLE IF NOT EXISTS video_views (
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	session_id TEXT NOT NULL,
+	viewer TEXT NOT NULL,
+	started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	position_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+	completion DOUBLE PRECISION NOT NULL DEFAULT 0,
+	PRIMARY KEY(video_id, session_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_views_started_at ON video_views(video_id, started_at);
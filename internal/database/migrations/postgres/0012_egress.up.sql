@@ -0,0 +1,24 @@
+-- Bytes served per video, owner, UTC day and source. Rows outlive the
+-- video so deleting one doesn't give back what it used of the month.
+CREATE TABLE IF NOT EXISTS egress (
+	user_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	day TEXT NOT NULL,
+	source TEXT NOT NULL,
+	bytes BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY(video_id, day, source)
+);
+
+CREATE INDEX IF NOT EXISTS idx_egress_user_day ON egress(user_id, day);
+
+-- Monthly egress caps that differ from EGRESS_MONTHLY_CAP_MB
+CREATE TABLE IF NOT EXISTS egress_caps (
+	user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	monthly_bytes BIGINT NOT NULL
+);
+
+-- CloudFront log files already counted
+CREATE TABLE IF NOT EXISTS cloudfront_log_files (
+	key TEXT PRIMARY KEY,
+	processed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,15 @@
+-- Threaded comments on videos. Deleted comments keep their row, with the
+-- body cleared, while they have replies.
+CREATE TABLE IF NOT EXISTS comments (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+	parent_id TEXT REFERENCES comments(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_video_id ON comments(video_id, parent_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments(user_id);
@@ -0,0 +1,11 @@
+-- One like per user and video; videos.like_count is their count
+CREATE TABLE IF NOT EXISTS video_likes (
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(video_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_likes_user_id ON video_likes(user_id);
+
+ALTER TABLE videos ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,23 @@
+-- Full-text index of each video's title, description and chapter titles.
+-- The simple configuration doesn't stem, as titles are in any language.
+CREATE TABLE IF NOT EXISTS video_search (
+	video_id TEXT PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL,
+	chapters TEXT NOT NULL,
+	document TSVECTOR GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', title), 'A') ||
+		setweight(to_tsvector('simple', chapters), 'B') ||
+		setweight(to_tsvector('simple', description), 'C')
+	) STORED
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_search_document ON video_search USING GIN (document);
+
+INSERT INTO video_search (video_id, title, description, chapters)
+SELECT
+	videos.id,
+	videos.title,
+	videos.description,
+	COALESCE((SELECT string_agg(chapters.title, ' ' ORDER BY chapters.start_seconds) FROM chapters WHERE chapters.video_id = videos.id), '')
+FROM videos;
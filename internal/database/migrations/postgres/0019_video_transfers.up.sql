@@ -0,0 +1,18 @@
+-- Offers to hand a video to another user or organization. Nothing changes
+-- hands until the recipient accepts; a video has at most one pending offer.
+CREATE TABLE IF NOT EXISTS video_transfers (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL REFERENCES videos(id),
+	from_user_id TEXT NOT NULL,
+	to_user_id TEXT,
+	to_org_id TEXT,
+	rekey BOOLEAN NOT NULL DEFAULT FALSE,
+	status TEXT NOT NULL,
+	resolved_at TIMESTAMPTZ,
+	job_id TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_video_transfers_pending ON video_transfers(video_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_video_transfers_to_user_id ON video_transfers(to_user_id);
+CREATE INDEX IF NOT EXISTS idx_video_transfers_to_org_id ON video_transfers(to_org_id);
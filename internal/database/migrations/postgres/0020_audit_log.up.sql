@@ -0,0 +1,19 @@
+-- Append-only record of mutating requests. There are no foreign keys, so
+-- entries outlive the accounts and videos they mention.
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	action TEXT NOT NULL,
+	actor_id TEXT,
+	ip TEXT NOT NULL DEFAULT '',
+	request_id TEXT NOT NULL DEFAULT '',
+	method TEXT NOT NULL,
+	path TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	video_id TEXT,
+	details TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_video_id ON audit_log(video_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action);
@@ -0,0 +1,9 @@
+-- S3 multipart uploads that were started and not yet completed or
+-- aborted, so abandoned ones can be aborted before their parts pile up.
+CREATE TABLE IF NOT EXISTS multipart_uploads (
+	upload_id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	object_key TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_multipart_uploads_created_at ON multipart_uploads(created_at);
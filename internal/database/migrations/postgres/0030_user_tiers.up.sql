@@ -0,0 +1,6 @@
+-- The VIDEO_DURATION_TIERS tier admins put users on. Users without one get
+-- MAX_VIDEO_DURATION.
+CREATE TABLE IF NOT EXISTS user_tiers (
+	user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	tier TEXT NOT NULL
+);
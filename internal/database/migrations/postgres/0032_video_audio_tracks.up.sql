@@ -0,0 +1,6 @@
+-- The probed audio streams of each rendition as a JSON array, for players
+-- that switch between languages. Uploads from before this migration have
+-- NULLs.
+ALTER TABLE videos ADD COLUMN audio_tracks TEXT;
+
+ALTER TABLE video_versions ADD COLUMN audio_tracks TEXT;
@@ -0,0 +1,13 @@
+-- Owners' rules on where their videos may be played from. A viewer
+-- matching a deny rule is refused, and once a video has allow rules a
+-- viewer has to match one.
+CREATE TABLE IF NOT EXISTS playback_rules (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	action TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	value TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_playback_rules_video_id ON playback_rules(video_id, created_at);
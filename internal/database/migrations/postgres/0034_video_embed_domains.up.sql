@@ -0,0 +1,3 @@
+-- The sites a video's embed player works on, as a JSON array of domains.
+-- NULL lets it be embedded anywhere.
+ALTER TABLE videos ADD COLUMN embed_domains TEXT;
@@ -0,0 +1,79 @@
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT,
+	source_video_id TEXT REFERENCES videos(id),
+	preview_url TEXT,
+	poster_timestamp REAL,
+	original_url TEXT,
+	original_archived_at TIMESTAMP,
+	sha256 TEXT,
+	moderation_status TEXT NOT NULL DEFAULT '',
+	moderation_labels TEXT NOT NULL DEFAULT '',
+	moderation_reason TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	params TEXT NOT NULL DEFAULT '{}',
+	status TEXT NOT NULL,
+	error TEXT,
+	result_url TEXT,
+	result_content_type TEXT,
+	stage_timings TEXT NOT NULL DEFAULT '{}',
+	checkpoint TEXT,
+	trace_parent TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS chapters (
+	video_id TEXT NOT NULL,
+	start_seconds REAL NOT NULL,
+	title TEXT NOT NULL,
+	PRIMARY KEY(video_id, start_seconds),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id TEXT NOT NULL,
+	key TEXT NOT NULL,
+	request_path TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP,
+	status_code INTEGER,
+	content_type TEXT,
+	response_body BLOB,
+	PRIMARY KEY(user_id, key),
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
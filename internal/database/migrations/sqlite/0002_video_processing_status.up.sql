@@ -0,0 +1,12 @@
+-- Where a video's latest upload is in processing: '' before any upload,
+-- then queued, processing, ready or failed
+ALTER TABLE videos ADD COLUMN processing_status TEXT NOT NULL DEFAULT '';
+
+UPDATE videos SET processing_status = 'ready'
+WHERE video_url IS NOT NULL AND video_url != '';
+
+UPDATE videos SET processing_status = 'queued'
+WHERE id IN (SELECT video_id FROM jobs WHERE kind = 'process_video' AND status = 'queued');
+
+UPDATE videos SET processing_status = 'processing'
+WHERE id IN (SELECT video_id FROM jobs WHERE kind = 'process_video' AND status = 'running');
@@ -0,0 +1,24 @@
+-- The bucket and keys of a video's objects as separate columns, split from
+-- the "bucket,key" references kept in video_url, preview_url and
+-- original_url
+ALTER TABLE videos ADD COLUMN storage_bucket TEXT;
+ALTER TABLE videos ADD COLUMN video_key TEXT;
+ALTER TABLE videos ADD COLUMN preview_key TEXT;
+ALTER TABLE videos ADD COLUMN original_key TEXT;
+
+UPDATE videos SET
+	storage_bucket = substr(video_url, 1, instr(video_url, ',') - 1),
+	video_key = substr(video_url, instr(video_url, ',') + 1)
+WHERE instr(video_url, ',') > 0;
+
+UPDATE videos SET
+	storage_bucket = coalesce(storage_bucket, substr(preview_url, 1, instr(preview_url, ',') - 1)),
+	preview_key = substr(preview_url, instr(preview_url, ',') + 1)
+WHERE instr(preview_url, ',') > 0;
+
+UPDATE videos SET
+	storage_bucket = coalesce(storage_bucket, substr(original_url, 1, instr(original_url, ',') - 1)),
+	original_key = substr(original_url, instr(original_url, ',') + 1)
+WHERE instr(original_url, ',') > 0;
+
+CREATE INDEX IF NOT EXISTS idx_videos_video_key ON videos(video_key);
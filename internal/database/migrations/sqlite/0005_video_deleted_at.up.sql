@@ -0,0 +1,4 @@
+-- When the owner moved the video to the trash; NULL for live videos
+ALTER TABLE videos ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_videos_deleted_at ON videos(deleted_at);
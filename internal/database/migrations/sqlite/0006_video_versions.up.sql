@@ -0,0 +1,32 @@
+-- Every upload of a video, so replacing the file keeps the previous ones
+-- and the owner can roll back. active_version is the one the video's
+-- renditions currently point at.
+CREATE TABLE IF NOT EXISTS video_versions (
+	video_id TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	video_url TEXT,
+	preview_url TEXT,
+	original_url TEXT,
+	sha256 TEXT,
+	moderation_status TEXT NOT NULL DEFAULT '',
+	moderation_labels TEXT NOT NULL DEFAULT '',
+	moderation_reason TEXT,
+	PRIMARY KEY(video_id, version),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+ALTER TABLE videos ADD COLUMN active_version INTEGER;
+
+-- Existing uploads become version 1
+INSERT INTO video_versions (
+	video_id, version, created_at, video_url, preview_url, original_url,
+	sha256, moderation_status, moderation_labels, moderation_reason
+)
+SELECT id, 1, updated_at, video_url, preview_url, original_url,
+	sha256, moderation_status, moderation_labels, moderation_reason
+FROM videos
+WHERE video_url IS NOT NULL AND video_url != '';
+
+UPDATE videos SET active_version = 1
+WHERE video_url IS NOT NULL AND video_url != '';
@@ -0,0 +1,33 @@
+-- An account purge job outlives the user and videos it cleans up after, so
+-- jobs no longer reference them; deleting a video or account removes its
+-- jobs explicitly. SQLite can't drop a constraint, so the table is rebuilt.
+CREATE TABLE jobs_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	params TEXT NOT NULL DEFAULT '{}',
+	status TEXT NOT NULL,
+	error TEXT,
+	result_url TEXT,
+	result_content_type TEXT,
+	stage_timings TEXT NOT NULL DEFAULT '{}',
+	checkpoint TEXT,
+	trace_parent TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO jobs_new (
+	id, created_at, updated_at, user_id, video_id, kind, params, status,
+	error, result_url, result_content_type, stage_timings, checkpoint, trace_parent
+)
+SELECT
+	id, created_at, updated_at, user_id, video_id, kind, params, status,
+	error, result_url, result_content_type, stage_timings, checkpoint, trace_parent
+FROM jobs;
+
+DROP TABLE jobs;
+ALTER TABLE jobs_new RENAME TO jobs;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id);
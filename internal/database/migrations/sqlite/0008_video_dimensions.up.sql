@@ -0,0 +1,11 @@
+-- The stream's probed size and the aspect category it was filed under.
+-- Uploads from before this migration have NULLs.
+ALTER TABLE videos ADD COLUMN width INTEGER;
+ALTER TABLE videos ADD COLUMN height INTEGER;
+ALTER TABLE videos ADD COLUMN aspect_ratio REAL;
+ALTER TABLE videos ADD COLUMN aspect TEXT;
+
+ALTER TABLE video_versions ADD COLUMN width INTEGER;
+ALTER TABLE video_versions ADD COLUMN height INTEGER;
+ALTER TABLE video_versions ADD COLUMN aspect_ratio REAL;
+ALTER TABLE video_versions ADD COLUMN aspect TEXT;
@@ -0,0 +1,3 @@
+-- Low-fi stand-ins for the thumbnail that clients can show while it loads
+ALTER TABLE videos ADD COLUMN thumbnail_blurhash TEXT;
+ALTER TABLE videos ADD COLUMN thumbnail_color TEXT;
@@ -0,0 +1,15 @@
+-- One row per playback session, updated by the player's beacons with the
+-- furthest position reached. viewer is a keyed hash, never a user ID or IP.
+CREATE TABLE IF NOT EXISTS video_views (
+	video_id TEXT NOT NULL,
+	session_id TEXT NOT NULL,
+	viewer TEXT NOT NULL,
+	started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	position_seconds REAL NOT NULL DEFAULT 0,
+	completion REAL NOT NULL DEFAULT 0,
+	PRIMARY KEY(video_id, session_id),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_views_started_at ON video_views(video_id, started_at);
@@ -0,0 +1,3 @@
+-- Whether viewers may download a video, and the filename they get
+ALTER TABLE videos ADD COLUMN allow_downloads BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE videos ADD COLUMN download_filename TEXT;
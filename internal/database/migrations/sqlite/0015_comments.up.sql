@@ -0,0 +1,18 @@
+-- Threaded comments on videos. Deleted comments keep their row, with the
+-- body cleared, while they have replies.
+CREATE TABLE IF NOT EXISTS comments (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	video_id TEXT NOT NULL,
+	user_id TEXT,
+	parent_id TEXT,
+	body TEXT NOT NULL,
+	deleted_at TIMESTAMP,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL,
+	FOREIGN KEY(parent_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_video_id ON comments(video_id, parent_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments(user_id);
@@ -0,0 +1,13 @@
+-- One like per user and video; videos.like_count is their count
+CREATE TABLE IF NOT EXISTS video_likes (
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(video_id, user_id),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_likes_user_id ON video_likes(user_id);
+
+ALTER TABLE videos ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,18 @@
+-- Full-text index of each video's title, description and chapter titles.
+-- FTS4 ships with the default go-sqlite3 build, FTS5 needs a build tag.
+CREATE VIRTUAL TABLE IF NOT EXISTS video_search USING fts4(
+	video_id,
+	title,
+	description,
+	chapters,
+	notindexed=video_id,
+	tokenize=unicode61
+);
+
+INSERT INTO video_search (video_id, title, description, chapters)
+SELECT
+	videos.id,
+	videos.title,
+	COALESCE(videos.description, ''),
+	COALESCE((SELECT group_concat(chapters.title, ' ') FROM chapters WHERE chapters.video_id = videos.id), '')
+FROM videos;
@@ -0,0 +1,28 @@
+-- Organizations share a video library between their members. Videos with
+-- an org_id belong to the organization, whichever member uploaded them, and
+-- their egress is counted against it.
+CREATE TABLE IF NOT EXISTS organizations (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	name TEXT NOT NULL,
+	egress_cap_bytes INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+	org_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(org_id, user_id),
+	FOREIGN KEY(org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id);
+
+ALTER TABLE videos ADD COLUMN org_id TEXT REFERENCES organizations(id);
+CREATE INDEX IF NOT EXISTS idx_videos_org_id ON videos(org_id);
+
+ALTER TABLE egress ADD COLUMN org_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_egress_org_id ON egress(org_id, day);
@@ -0,0 +1,4 @@
+-- How often a job has been run, and when a job waiting to be retried may
+-- run again. Jobs out of attempts are parked as dead_lettered.
+ALTER TABLE jobs ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN next_attempt_at TIMESTAMP;
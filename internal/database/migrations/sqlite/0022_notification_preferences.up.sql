@@ -0,0 +1,10 @@
+-- Which emails a user gets about their videos, and in which language.
+-- Users without a row get the defaults.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	user_id TEXT PRIMARY KEY,
+	processing_failed BOOLEAN NOT NULL DEFAULT TRUE,
+	processing_completed BOOLEAN NOT NULL DEFAULT TRUE,
+	language TEXT NOT NULL DEFAULT 'en',
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,16 @@
+-- Uploads sent in chunks, each chunk a part of an S3 multipart upload that
+-- is completed into object_key and ingested once the client is done.
+CREATE TABLE IF NOT EXISTS chunked_uploads (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL REFERENCES users(id),
+	video_id TEXT NOT NULL REFERENCES videos(id),
+	object_key TEXT NOT NULL,
+	s3_upload_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	completed_at TIMESTAMP,
+	job_id TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_chunked_uploads_user_id ON chunked_uploads(user_id);
+CREATE INDEX IF NOT EXISTS idx_chunked_uploads_video_id ON chunked_uploads(video_id);
@@ -0,0 +1,24 @@
+-- What the server knows about each file in ASSETS_ROOT: the video it
+-- belongs to, for access checks, and the type it was stored as. Assets
+-- saved before this table are filled in from the videos that point at
+-- them, without a content type.
+CREATE TABLE IF NOT EXISTS assets (
+	name TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT REFERENCES videos(id),
+	content_type TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_assets_video_id ON assets(video_id);
+
+INSERT INTO assets (name, video_id)
+SELECT substr(thumbnail_url, instr(thumbnail_url, '/assets/') + 8), id
+FROM videos
+WHERE instr(thumbnail_url, '/assets/') > 0
+ON CONFLICT DO NOTHING;
+
+INSERT INTO assets (name, video_id)
+SELECT substr(thumbnail_source_url, instr(thumbnail_source_url, '/assets/') + 8), id
+FROM videos
+WHERE instr(thumbnail_source_url, '/assets/') > 0
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+-- Workers claim the oldest queued job, so find queued jobs by age
+CREATE INDEX IF NOT EXISTS idx_jobs_status_created_at ON jobs(status, created_at);
@@ -0,0 +1,3 @@
+-- The lane a job waits in: workers take high priority jobs first, and
+-- each lane can be limited in how many of its jobs run at once.
+ALTER TABLE jobs ADD COLUMN priority TEXT NOT NULL DEFAULT 'normal';
@@ -0,0 +1,5 @@
+-- When a job's current attempt started and how many seconds of media it
+-- works on, from which completed jobs give processing rates to estimate
+-- queued ones with.
+ALTER TABLE jobs ADD COLUMN started_at TIMESTAMP;
+ALTER TABLE jobs ADD COLUMN input_seconds REAL;
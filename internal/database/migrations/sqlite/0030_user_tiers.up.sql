@@ -0,0 +1,7 @@
+-- The VIDEO_DURATION_TIERS tier admins put users on. Users without one get
+-- MAX_VIDEO_DURATION.
+CREATE TABLE IF NOT EXISTS user_tiers (
+	user_id TEXT PRIMARY KEY,
+	tier TEXT NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,8 @@
+-- Whether the stream is HDR, and the "bucket,key" of the tonemapped SDR
+-- rendition made for players that can't show it. Uploads from before this
+-- migration have NULLs.
+ALTER TABLE videos ADD COLUMN dynamic_range TEXT;
+ALTER TABLE videos ADD COLUMN sdr_video_url TEXT;
+
+ALTER TABLE video_versions ADD COLUMN dynamic_range TEXT;
+ALTER TABLE video_versions ADD COLUMN sdr_video_url TEXT;
@@ -0,0 +1,14 @@
+-- Owners' rules on where their videos may be played from. A viewer
+-- matching a deny rule is refused, and once a video has allow rules a
+-- viewer has to match one.
+CREATE TABLE IF NOT EXISTS playback_rules (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	video_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	value TEXT NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_playback_rules_video_id ON playback_rules(video_id, created_at);
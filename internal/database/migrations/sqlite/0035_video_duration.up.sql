@@ -0,0 +1,6 @@
+-- The probed length of each rendition in seconds, for feeds and players
+-- that show it before loading the file. Uploads from before this migration
+-- have NULLs.
+ALTER TABLE videos ADD COLUMN duration REAL;
+
+ALTER TABLE video_versions ADD COLUMN duration REAL;
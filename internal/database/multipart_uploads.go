@@ -0,0 +1,52 @@
+package database
+
+import "time"
+
+// MultipartUpload is an S3 multipart upload in progress. Its parts are
+// billed until it is completed or aborted.
+type MultipartUpload struct {
+	UploadID  string    `json:"upload_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ObjectKey string    `json:"object_key"`
+}
+
+func (c Client) CreateMultipartUpload(uploadID, objectKey string) error {
+	query := `
+	INSERT INTO multipart_uploads (upload_id, created_at, object_key)
+	VALUES (?, CURRENT_TIMESTAMP, ?)
+	`
+	_, err := c.db.Exec(query, uploadID, objectKey)
+	return err
+}
+
+// DeleteMultipartUpload forgets an upload once it is completed or aborted.
+func (c Client) DeleteMultipartUpload(uploadID string) error {
+	_, err := c.db.Exec(`DELETE FROM multipart_uploads WHERE upload_id = ?`, uploadID)
+	return err
+}
+
+// GetMultipartUploadsBefore returns the uploads started before cutoff,
+// oldest first.
+func (c Client) GetMultipartUploadsBefore(cutoff time.Time) ([]MultipartUpload, error) {
+	query := `
+	SELECT upload_id, created_at, object_key
+	FROM multipart_uploads
+	WHERE created_at < ?
+	ORDER BY created_at ASC
+	`
+	rows, err := c.db.Query(query, cutoff.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []MultipartUpload{}
+	for rows.Next() {
+		var u MultipartUpload
+		if err := rows.Scan(&u.UploadID, &u.CreatedAt, &u.ObjectKey); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
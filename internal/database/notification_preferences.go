@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NotificationPreferences are the emails a user wants about their videos.
+type NotificationPreferences struct {
+	// ProcessingFailed emails when an upload, import or ingest fails for good
+	ProcessingFailed bool `json:"processing_failed"`
+	// ProcessingCompleted emails when a slow one finishes
+	ProcessingCompleted bool `json:"processing_completed"`
+	// Language the emails are written in
+	Language  string     `json:"language"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// DefaultNotificationPreferences are those of users who never changed them.
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{
+		ProcessingFailed:    true,
+		ProcessingCompleted: true,
+		Language:            "en",
+	}
+}
+
+// GetNotificationPreferences returns the user's preferences, or the
+// defaults if they never set any.
+func (c Client) GetNotificationPreferences(userID uuid.UUID) (NotificationPreferences, error) {
+	query := `
+	SELECT processing_failed, processing_completed, language, updated_at
+	FROM notification_preferences
+	WHERE user_id = ?
+	`
+	var prefs NotificationPreferences
+	var updatedAt time.Time
+	err := c.db.QueryRow(query, userID.String()).Scan(
+		&prefs.ProcessingFailed,
+		&prefs.ProcessingCompleted,
+		&prefs.Language,
+		&updatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultNotificationPreferences(), nil
+	}
+	if err != nil {
+		return NotificationPreferences{}, err
+	}
+	prefs.UpdatedAt = &updatedAt
+	return prefs, nil
+}
+
+// SetNotificationPreferences replaces the user's preferences.
+func (c Client) SetNotificationPreferences(userID uuid.UUID, prefs NotificationPreferences) (NotificationPreferences, error) {
+	query := `
+	INSERT INTO notification_preferences (user_id, processing_failed, processing_completed, language, updated_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (user_id) DO UPDATE SET
+		processing_failed = excluded.processing_failed,
+		processing_completed = excluded.processing_completed,
+		language = excluded.language,
+		updated_at = excluded.updated_at
+	`
+	now := time.Now().UTC()
+	_, err := c.db.Exec(query, userID.String(), prefs.ProcessingFailed, prefs.ProcessingCompleted, prefs.Language, now)
+	if err != nil {
+		return NotificationPreferences{}, err
+	}
+	prefs.UpdatedAt = &now
+	return prefs, nil
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization roles. Owners manage the membership; owners and uploaders
+// manage the organization's videos; viewers can only watch them.
+const (
+	RoleOwner    = "owner"
+	RoleUploader = "uploader"
+	RoleViewer   = "viewer"
+)
+
+// Organization shares a video library between its members.
+type Organization struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	// EgressCapBytes is the organization's own monthly cap, nil for the
+	// default one
+	EgressCapBytes *int64 `json:"egress_cap_bytes"`
+	MemberCount    int    `json:"member_count"`
+	OwnerCount     int    `json:"owner_count"`
+}
+
+// UserOrganization is an organization with one member's role in it.
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+type OrganizationMember struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+const organizationColumns = `
+		o.id,
+		o.created_at,
+		o.updated_at,
+		o.name,
+		o.egress_cap_bytes,
+		(SELECT COUNT(*) FROM organization_members m WHERE m.org_id = o.id),
+		(SELECT COUNT(*) FROM organization_members m WHERE m.org_id = o.id AND m.role = '` + RoleOwner + `')`
+
+func organizationScanDest(o *Organization) []any {
+	return []any{
+		&o.ID,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+		&o.Name,
+		&o.EgressCapBytes,
+		&o.MemberCount,
+		&o.OwnerCount,
+	}
+}
+
+// CreateOrganization creates the organization with ownerID as its first
+// owner.
+func (c Client) CreateOrganization(name string, ownerID uuid.UUID) (Organization, error) {
+	t, err := c.db.Begin()
+	if err != nil {
+		return Organization{}, err
+	}
+	defer t.Rollback()
+
+	id := uuid.New()
+	query := `
+	INSERT INTO organizations (id, created_at, updated_at, name)
+	VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?)
+	`
+	if _, err := t.Exec(query, id, name); err != nil {
+		return Organization{}, err
+	}
+	query = `
+	INSERT INTO organization_members (org_id, user_id, role, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	if _, err := t.Exec(query, id, ownerID, RoleOwner); err != nil {
+		return Organization{}, err
+	}
+	if err := t.Commit(); err != nil {
+		return Organization{}, err
+	}
+	return c.GetOrganization(id)
+}
+
+// GetOrganization returns the zero Organization if id doesn't exist.
+func (c Client) GetOrganization(id uuid.UUID) (Organization, error) {
+	query := `
+	SELECT` + organizationColumns + `
+	FROM organizations o
+	WHERE o.id = ?
+	`
+	var o Organization
+	err := c.db.QueryRow(query, id).Scan(organizationScanDest(&o)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Organization{}, nil
+	}
+	return o, err
+}
+
+// GetUserOrganizations returns the organizations the user is a member of,
+// by name.
+func (c Client) GetUserOrganizations(userID uuid.UUID) ([]UserOrganization, error) {
+	query := `
+	SELECT` + organizationColumns + `,
+		um.role
+	FROM organizations o
+	JOIN organization_members um ON um.org_id = o.id
+	WHERE um.user_id = ?
+	ORDER BY o.name, o.id
+	`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []UserOrganization{}
+	for rows.Next() {
+		var o UserOrganization
+		if err := rows.Scan(append(organizationScanDest(&o.Organization), &o.Role)...); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, rows.Err()
+}
+
+// GetOrgRole returns the user's role in the organization, or "" if they
+// aren't a member.
+func (c Client) GetOrgRole(orgID, userID uuid.UUID) (string, error) {
+	var role string
+	err := c.db.QueryRow(`SELECT role FROM organization_members WHERE org_id = ? AND user_id = ?`, orgID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// GetOrgMembers returns the organization's members in the order they
+// joined.
+func (c Client) GetOrgMembers(orgID uuid.UUID) ([]OrganizationMember, error) {
+	query := `
+	SELECT m.user_id, u.email, m.role, m.created_at
+	FROM organization_members m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.org_id = ?
+	ORDER BY m.created_at, u.email
+	`
+	rows, err := c.db.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []OrganizationMember{}
+	for rows.Next() {
+		var m OrganizationMember
+		if err := rows.Scan(&m.UserID, &m.Email, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetOrgMember adds the user to the organization with role, or changes the
+// role of an existing member.
+func (c Client) SetOrgMember(orgID, userID uuid.UUID, role string) error {
+	query := `
+	INSERT INTO organization_members (org_id, user_id, role, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT (org_id, user_id) DO UPDATE SET role = excluded.role
+	`
+	if _, err := c.db.Exec(query, orgID, userID, role); err != nil {
+		return err
+	}
+	return touchOrganization(c.db, orgID)
+}
+
+// RemoveOrgMember returns false if the user wasn't a member. The videos
+// they uploaded stay in the organization.
+func (c Client) RemoveOrgMember(orgID, userID uuid.UUID) (bool, error) {
+	result, err := c.db.Exec(`DELETE FROM organization_members WHERE org_id = ? AND user_id = ?`, orgID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, touchOrganization(c.db, orgID)
+}
+
+// SetOrgEgressCap gives the organization its own monthly cap, or with nil
+// puts it back on the default one.
+func (c Client) SetOrgEgressCap(orgID uuid.UUID, monthlyBytes *int64) error {
+	_, err := c.db.Exec(`UPDATE organizations SET updated_at = CURRENT_TIMESTAMP, egress_cap_bytes = ? WHERE id = ?`, monthlyBytes, orgID)
+	return err
+}
+
+// GetOrgVideos returns the organization's library, newest first, leaving
+// out videos in the trash.
+func (c Client) GetOrgVideos(orgID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE org_id = ?
+		AND deleted_at IS NULL
+	ORDER BY created_at DESC
+	`
+	return c.queryVideos(query, orgID)
+}
+
+func touchOrganization(db execer, orgID uuid.UUID) error {
+	_, err := db.Exec(`UPDATE organizations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, orgID)
+	return err
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PlaybackRuleAllow = "allow"
+	PlaybackRuleDeny  = "deny"
+
+	PlaybackRuleCountry = "country"
+	PlaybackRuleIP      = "ip"
+)
+
+// PlaybackRule allows or denies playback of a video to viewers from a
+// country or IP range.
+type PlaybackRule struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	VideoID   uuid.UUID `json:"video_id"`
+	// Action is allow or deny
+	Action string `json:"action"`
+	// Kind is country, with Value an ISO 3166-1 alpha-2 code like "DE", or
+	// ip, with Value a CIDR range like "203.0.113.0/24"
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+const playbackRuleColumns = `
+		id,
+		created_at,
+		video_id,
+		action,
+		kind,
+		value`
+
+func scanPlaybackRule(row rowScanner) (PlaybackRule, error) {
+	var rule PlaybackRule
+	err := row.Scan(
+		&rule.ID,
+		&rule.CreatedAt,
+		&rule.VideoID,
+		&rule.Action,
+		&rule.Kind,
+		&rule.Value,
+	)
+	return rule, err
+}
+
+func (c Client) CreatePlaybackRule(videoID uuid.UUID, action, kind, value string) (PlaybackRule, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO playback_rules (id, created_at, video_id, action, kind, value)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	if _, err := c.db.Exec(query, id, time.Now().UTC(), videoID, action, kind, value); err != nil {
+		return PlaybackRule{}, err
+	}
+	return c.GetPlaybackRule(id)
+}
+
+// CopyPlaybackRules adds each rule of the video from to the video to, all
+// of them or none.
+func (c Client) CopyPlaybackRules(from, to uuid.UUID) error {
+	rules, err := c.ListPlaybackRules(from)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	t, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	query := `
+	INSERT INTO playback_rules (id, created_at, video_id, action, kind, value)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	for _, rule := range rules {
+		if _, err := t.Exec(query, uuid.New(), time.Now().UTC(), to, rule.Action, rule.Kind, rule.Value); err != nil {
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+// GetPlaybackRule returns the zero PlaybackRule if id doesn't exist.
+func (c Client) GetPlaybackRule(id uuid.UUID) (PlaybackRule, error) {
+	query := `
+	SELECT` + playbackRuleColumns + `
+	FROM playback_rules
+	WHERE id = ?
+	`
+	rule, err := scanPlaybackRule(c.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return PlaybackRule{}, nil
+	}
+	return rule, err
+}
+
+// ListPlaybackRules returns the video's rules, oldest first.
+func (c Client) ListPlaybackRules(videoID uuid.UUID) ([]PlaybackRule, error) {
+	query := `
+	SELECT` + playbackRuleColumns + `
+	FROM playback_rules
+	WHERE video_id = ?
+	ORDER BY created_at ASC, id ASC
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []PlaybackRule{}
+	for rows.Next() {
+		rule, err := scanPlaybackRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// HasPlaybackRules reports whether the video has any rules, without
+// loading them.
+func (c Client) HasPlaybackRules(videoID uuid.UUID) (bool, error) {
+	var one int
+	err := c.db.QueryRow(`SELECT 1 FROM playback_rules WHERE video_id = ? LIMIT 1`, videoID).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c Client) UpdatePlaybackRule(rule PlaybackRule) error {
+	query := `
+	UPDATE playback_rules
+	SET action = ?, kind = ?, value = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, rule.Action, rule.Kind, rule.Value, rule.ID)
+	return err
+}
+
+func (c Client) DeletePlaybackRule(id uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM playback_rules WHERE id = ?`, id)
+	return err
+}
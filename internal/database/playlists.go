@@ -0,0 +1,227 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Playlist is an ordered collection of a user's videos. Its visibility is
+// separate from theirs: each video is still only shown to those who may see
+// it.
+type Playlist struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// VideoCount leaves out videos in the trash
+	VideoCount int `json:"video_count"`
+	CreatePlaylistParams
+}
+
+type CreatePlaylistParams struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
+}
+
+const playlistColumns = `
+		p.id,
+		p.created_at,
+		p.updated_at,
+		p.user_id,
+		p.title,
+		p.description,
+		p.visibility,
+		(SELECT COUNT(*) FROM playlist_items i
+			JOIN videos v ON v.id = i.video_id
+			WHERE i.playlist_id = p.id AND v.deleted_at IS NULL)`
+
+func scanPlaylist(row rowScanner) (Playlist, error) {
+	var p Playlist
+	err := row.Scan(
+		&p.ID,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.UserID,
+		&p.Title,
+		&p.Description,
+		&p.Visibility,
+		&p.VideoCount,
+	)
+	return p, err
+}
+
+func (c Client) CreatePlaylist(params CreatePlaylistParams) (Playlist, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO playlists (id, created_at, updated_at, user_id, title, description, visibility)
+	VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, params.UserID, params.Title, params.Description, params.Visibility)
+	if err != nil {
+		return Playlist{}, err
+	}
+	return c.GetPlaylist(id)
+}
+
+// GetPlaylist returns the zero Playlist if id doesn't exist.
+func (c Client) GetPlaylist(id uuid.UUID) (Playlist, error) {
+	query := `
+	SELECT` + playlistColumns + `
+	FROM playlists p
+	WHERE p.id = ?
+	`
+	p, err := scanPlaylist(c.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Playlist{}, nil
+	}
+	return p, err
+}
+
+// GetPlaylists returns the user's playlists, most recently changed first.
+func (c Client) GetPlaylists(userID uuid.UUID) ([]Playlist, error) {
+	query := `
+	SELECT` + playlistColumns + `
+	FROM playlists p
+	WHERE p.user_id = ?
+	ORDER BY p.updated_at DESC
+	`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		p, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, p)
+	}
+	return playlists, rows.Err()
+}
+
+// UpdatePlaylist saves the playlist's title, description and visibility.
+func (c Client) UpdatePlaylist(p Playlist) error {
+	query := `
+	UPDATE playlists
+	SET updated_at = CURRENT_TIMESTAMP, title = ?, description = ?, visibility = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, p.Title, p.Description, p.Visibility, p.ID)
+	return err
+}
+
+// DeletePlaylist deletes the playlist but none of its videos.
+func (c Client) DeletePlaylist(id uuid.UUID) error {
+	if _, err := c.db.Exec(`DELETE FROM playlist_items WHERE playlist_id = ?`, id); err != nil {
+		return err
+	}
+	_, err := c.db.Exec(`DELETE FROM playlists WHERE id = ?`, id)
+	return err
+}
+
+// GetPlaylistVideos returns the playlist's videos in order, leaving out
+// those in the trash.
+func (c Client) GetPlaylistVideos(playlistID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	JOIN playlist_items ON playlist_items.video_id = videos.id
+	WHERE playlist_items.playlist_id = ?
+		AND videos.deleted_at IS NULL
+	ORDER BY playlist_items.position ASC, playlist_items.added_at ASC
+	`
+	return c.queryVideos(query, playlistID)
+}
+
+// AddPlaylistVideo inserts the video at position, shifting the videos from
+// there on back, or at the end if position is nil. It returns false without
+// changing anything if the video is in the playlist already.
+func (c Client) AddPlaylistVideo(playlistID, videoID uuid.UUID, position *int) (bool, error) {
+	t, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer t.Rollback()
+
+	var exists int
+	err = t.QueryRow(`SELECT COUNT(*) FROM playlist_items WHERE playlist_id = ? AND video_id = ?`, playlistID, videoID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	if exists > 0 {
+		return false, nil
+	}
+
+	var at int
+	if position == nil {
+		err = t.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM playlist_items WHERE playlist_id = ?`, playlistID).Scan(&at)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		at = *position
+		if _, err := t.Exec(`UPDATE playlist_items SET position = position + 1 WHERE playlist_id = ? AND position >= ?`, playlistID, at); err != nil {
+			return false, err
+		}
+	}
+
+	query := `
+	INSERT INTO playlist_items (playlist_id, video_id, position, added_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	if _, err := t.Exec(query, playlistID, videoID, at); err != nil {
+		return false, err
+	}
+	if err := touchPlaylist(t, playlistID); err != nil {
+		return false, err
+	}
+	return true, t.Commit()
+}
+
+// RemovePlaylistVideo returns false if the video wasn't in the playlist.
+func (c Client) RemovePlaylistVideo(playlistID, videoID uuid.UUID) (bool, error) {
+	result, err := c.db.Exec(`DELETE FROM playlist_items WHERE playlist_id = ? AND video_id = ?`, playlistID, videoID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, touchPlaylist(c.db, playlistID)
+}
+
+// ReorderPlaylist moves the given videos to the front in that order. Any
+// others, such as videos in the trash, keep their order behind them.
+func (c Client) ReorderPlaylist(playlistID uuid.UUID, videoIDs []uuid.UUID) error {
+	t, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	if _, err := t.Exec(`UPDATE playlist_items SET position = position + ? WHERE playlist_id = ?`, len(videoIDs), playlistID); err != nil {
+		return err
+	}
+	for i, videoID := range videoIDs {
+		if _, err := t.Exec(`UPDATE playlist_items SET position = ? WHERE playlist_id = ? AND video_id = ?`, i, playlistID, videoID); err != nil {
+			return err
+		}
+	}
+	if err := touchPlaylist(t, playlistID); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func touchPlaylist(db execer, playlistID uuid.UUID) error {
+	_, err := db.Exec(`UPDATE playlists SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, playlistID)
+	return err
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresDialect runs on PostgreSQL through pgx, for production
+// deployments with more than one server or larger libraries.
+type postgresDialect struct{}
+
+func (postgresDialect) name() string       { return "postgres" }
+func (postgresDialect) driverName() string { return "pgx" }
+
+func (postgresDialect) rebind(query string) string { return rebindNumbered(query) }
+
+func (postgresDialect) timestampType() string { return "TIMESTAMPTZ" }
+
+// headlineOptions mark matches like the SQLite snippets do.
+const headlineOptions = `StartSel="` + HighlightStart + `", StopSel="` + HighlightEnd + `", FragmentDelimiter=" … "`
+
+// searchSource ranks with ts_rank, whose default weights favor the title
+// (A) over chapters (B) and the description (C).
+func (postgresDialect) searchSource() string {
+	return `
+	SELECT
+		video_id,
+		ts_rank(document, q) AS rank,
+		ts_headline('simple', title, q, 'HighlightAll=true, ` + headlineOptions + `') AS title_highlight,
+		ts_headline('simple', description, q, 'MaxFragments=2, MaxWords=24, MinWords=8, ` + headlineOptions + `') AS description_highlight,
+		ts_headline('simple', chapters, q, 'MaxFragments=2, MaxWords=16, MinWords=4, ` + headlineOptions + `') AS chapters_highlight
+	FROM video_search, to_tsquery('simple', ?) q
+	WHERE document @@ q`
+}
+
+// searchQuery ANDs the terms, which hold nothing to_tsquery would parse.
+func (postgresDialect) searchQuery(terms []SearchTerm) string {
+	lexemes := make([]string, len(terms))
+	for i, term := range terms {
+		lexemes[i] = term.Text
+		if term.Prefix {
+			lexemes[i] += ":*"
+		}
+	}
+	return strings.Join(lexemes, " & ")
+}
+
+func (postgresDialect) skipLocked() string { return " FOR UPDATE SKIP LOCKED" }
+
+// migrationLockID is an arbitrary key for pg_advisory_xact_lock.
+const migrationLockID = 7_386_412_095
+
+func (postgresDialect) lockMigrations(t *tx) error {
+	_, err := t.Exec(`SELECT pg_advisory_xact_lock(?)`, migrationLockID)
+	return err
+}
+
+// prepareUnversioned has nothing to do: the first migration matches the
+// schema PostgreSQL databases were created with before versioning, and
+// creates nothing that already exists.
+func (postgresDialect) prepareUnversioned(db *conn) error {
+	return nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Matched terms in SearchResult highlights are wrapped in these private use
+// characters, which can't come from user input that is worth searching for.
+// Callers replace them with the markup they need after escaping the text.
+const (
+	HighlightStart = "\ue000"
+	HighlightEnd   = "\ue001"
+)
+
+// SearchTerm is one word of a search. Prefix terms match every word they
+// start.
+type SearchTerm struct {
+	// Text holds only letters and digits
+	Text   string
+	Prefix bool
+}
+
+type SearchResult struct {
+	Video
+	Rank       float64
+	Highlights SearchHighlights
+}
+
+// SearchHighlights are the matching parts of a video's text, with matched
+// terms between HighlightStart and HighlightEnd.
+type SearchHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Chapters    string `json:"chapters"`
+}
+
+// SearchVideos returns the videos matching every term, best matches first:
+// public ones that aren't held by moderation, and userID's own of any
+// visibility. Title matches weigh most, then chapter titles, then the
+// description.
+func (c Client) SearchVideos(terms []SearchTerm, userID uuid.UUID, limit, offset int) ([]SearchResult, error) {
+	query := `
+	SELECT` + videoColumns + `,
+		s.rank,
+		s.title_highlight,
+		s.description_highlight,
+		s.chapters_highlight
+	FROM videos
+	JOIN (` + c.dialect.searchSource() + `) s ON s.video_id = videos.id
+	WHERE videos.deleted_at IS NULL
+		AND ((videos.visibility = ? AND videos.moderation_status NOT IN (?, ?)) OR videos.user_id = ?)
+	ORDER BY s.rank DESC, videos.created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(query, c.dialect.searchQuery(terms),
+		VisibilityPublic, ModerationPending, ModerationRejected, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		dest := append(videoScanDest(&result.Video),
+			&result.Rank,
+			&result.Highlights.Title,
+			&result.Highlights.Description,
+			&result.Highlights.Chapters,
+		)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// indexVideoText updates the indexed title and description after the video
+// is saved. The row is added by CreateVideo, chapters by ReplaceChapters.
+func indexVideoText(db execer, video Video) error {
+	_, err := db.Exec(`UPDATE video_search SET title = ?, description = ? WHERE video_id = ?`,
+		video.Title, video.Description, video.ID)
+	return err
+}
+
+func indexVideoChapters(db execer, videoID uuid.UUID, chapters []Chapter) error {
+	titles := make([]string, len(chapters))
+	for i, chapter := range chapters {
+		titles[i] = chapter.Title
+	}
+	_, err := db.Exec(`UPDATE video_search SET chapters = ? WHERE video_id = ?`, strings.Join(titles, " "), videoID)
+	return err
+}
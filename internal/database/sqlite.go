@@ -0,0 +1,317 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriverName is go-sqlite3 with the functions search needs added to
+// every connection.
+const sqliteDriverName = "sqlite3_tubely"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("tubely_bm25", bm25, true)
+		},
+	})
+}
+
+// sqliteDialect is the default, a single file for local development.
+type sqliteDialect struct{}
+
+func (sqliteDialect) name() string       { return "sqlite" }
+func (sqliteDialect) driverName() string { return sqliteDriverName }
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+func (sqliteDialect) timestampType() string { return "TIMESTAMP" }
+
+// lockMigrations has nothing to do; SQLite allows one writer at a time.
+func (sqliteDialect) lockMigrations(t *tx) error {
+	return nil
+}
+
+// skipLocked has nothing to add; SQLite allows one writer at a time.
+func (sqliteDialect) skipLocked() string { return "" }
+
+// searchSource ranks with bm25 over the FTS4 matchinfo, as FTS4 has no
+// ranking of its own. The weights are per column of video_search.
+func (sqliteDialect) searchSource() string {
+	return `
+	SELECT
+		video_id,
+		tubely_bm25(matchinfo(video_search, 'pcnalx'), 0.0, 4.0, 1.0, 2.0) AS rank,
+		snippet(video_search, '` + HighlightStart + `', '` + HighlightEnd + `', '…', 1, 64) AS title_highlight,
+		snippet(video_search, '` + HighlightStart + `', '` + HighlightEnd + `', '…', 2, 24) AS description_highlight,
+		snippet(video_search, '` + HighlightStart + `', '` + HighlightEnd + `', '…', 3, 16) AS chapters_highlight
+	FROM video_search
+	WHERE video_search MATCH ?`
+}
+
+// searchQuery quotes each term as a phrase, which FTS4 ANDs together.
+func (sqliteDialect) searchQuery(terms []SearchTerm) string {
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + term.Text
+		if term.Prefix {
+			phrases[i] += "*"
+		}
+		phrases[i] += `"`
+	}
+	return strings.Join(phrases, " ")
+}
+
+// bm25 scores a row from its matchinfo(..., 'pcnalx') blob: the phrase and
+// column counts, the row count, the average and this row's tokens per
+// column, then per phrase and column the hits in this row, the hits in all
+// rows and the rows with hits. weights has one entry per column.
+func bm25(matchinfo []byte, weights ...float64) float64 {
+	const k1, b = 1.2, 0.75
+	info := make([]uint32, len(matchinfo)/4)
+	for i := range info {
+		info[i] = binary.NativeEndian.Uint32(matchinfo[i*4:])
+	}
+	if len(info) < 3 {
+		return 0
+	}
+	phrases, cols, rows := int(info[0]), int(info[1]), float64(info[2])
+	if len(info) < 3+2*cols+3*phrases*cols || len(weights) < cols {
+		return 0
+	}
+	avgTokens, tokens, hits := info[3:3+cols], info[3+cols:3+2*cols], info[3+2*cols:]
+
+	score := 0.0
+	for p := range phrases {
+		for c := range cols {
+			x := hits[3*(p*cols+c):]
+			tf, docs := float64(x[0]), float64(x[2])
+			if tf == 0 || weights[c] == 0 || avgTokens[c] == 0 {
+				continue
+			}
+			idf := math.Log(1 + (rows-docs+0.5)/(docs+0.5))
+			norm := 1 - b + b*float64(tokens[c])/float64(avgTokens[c])
+			score += weights[c] * idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+	return score
+}
+
+// prepareUnversioned upgrades databases created before migrations were
+// versioned, when the schema grew by adding any missing columns at startup.
+// Those may be at any point of that history, so they are brought to the
+// shape of the first migration column by column.
+func (sqliteDialect) prepareUnversioned(db *conn) error {
+	var versioned, existing int
+	err := db.QueryRow(`
+	SELECT
+		COUNT(*) FILTER (WHERE name = 'schema_migrations'),
+		COUNT(*) FILTER (WHERE name = 'users')
+	FROM sqlite_master
+	WHERE type = 'table'
+	`).Scan(&versioned, &existing)
+	if err != nil {
+		return err
+	}
+	if versioned > 0 || existing == 0 {
+		return nil
+	}
+	return upgradeUnversionedSQLite(db)
+}
+
+func upgradeUnversionedSQLite(db *conn) error {
+	userTable := `
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		password TEXT NOT NULL,
+		email TEXT UNIQUE NOT NULL
+	);
+	`
+	_, err := db.Exec(userTable)
+	if err != nil {
+		return err
+	}
+	refreshTokenTable := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		revoked_at TIMESTAMP,
+		user_id TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = db.Exec(refreshTokenTable)
+	if err != nil {
+		return err
+	}
+
+	videoTable := `
+	CREATE TABLE IF NOT EXISTS videos (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		title TEXT NOT NULL,
+		description TEXT,
+		thumbnail_url TEXT,
+		video_url TEXT TEXT,
+		user_id INTEGER,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = db.Exec(videoTable)
+	if err != nil {
+		return err
+	}
+
+	err = addSQLiteColumnIfMissing(db, "videos", "source_video_id", "TEXT REFERENCES videos(id)")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "videos", "preview_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "videos", "poster_timestamp", "REAL")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "videos", "original_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "videos", "original_archived_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "videos", "sha256", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "videos", "moderation_status", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "videos", "moderation_labels", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "videos", "moderation_reason", "TEXT")
+	if err != nil {
+		return err
+	}
+
+	jobTable := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		user_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		params TEXT NOT NULL DEFAULT '{}',
+		status TEXT NOT NULL,
+		error TEXT,
+		result_url TEXT,
+		result_content_type TEXT,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = db.Exec(jobTable)
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "jobs", "stage_timings", "TEXT NOT NULL DEFAULT '{}'")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "jobs", "checkpoint", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = addSQLiteColumnIfMissing(db, "jobs", "trace_parent", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	chapterTable := `
+	CREATE TABLE IF NOT EXISTS chapters (
+		video_id TEXT NOT NULL,
+		start_seconds REAL NOT NULL,
+		title TEXT NOT NULL,
+		PRIMARY KEY(video_id, start_seconds),
+		FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+	);
+	`
+	_, err = db.Exec(chapterTable)
+	if err != nil {
+		return err
+	}
+
+	idempotencyKeyTable := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		user_id TEXT NOT NULL,
+		key TEXT NOT NULL,
+		request_path TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP,
+		status_code INTEGER,
+		content_type TEXT,
+		response_body BLOB,
+		PRIMARY KEY(user_id, key),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
+	`
+	_, err = db.Exec(idempotencyKeyTable)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// addSQLiteColumnIfMissing adds a column to a table created by an older
+// version of the schema, since CREATE TABLE IF NOT EXISTS leaves existing
+// tables alone.
+func addSQLiteColumnIfMissing(db *conn, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -145,3 +147,100 @@ func (c Client) DeleteUser(id uuid.UUID) error {
 	_, err := c.db.Exec(query, id.String())
 	return err
 }
+
+// DeleteAccount removes the user and everything they own in one
+// transaction: their sessions, idempotency keys, jobs and videos with
+// their chapters and versions. purge is queued in the same transaction, so
+// the objects left in storage are never forgotten. The videos they uploaded
+// to an organization with another owner are handed to that owner instead;
+// organizations they were the only member of are deleted.
+func (c Client) DeleteAccount(id uuid.UUID, purge CreateJobParams) (Job, error) {
+	t, err := c.db.Begin()
+	if err != nil {
+		return Job{}, err
+	}
+	defer t.Rollback()
+
+	for _, query := range []string{
+		`UPDATE videos SET user_id = (
+			SELECT m.user_id FROM organization_members m
+			WHERE m.org_id = videos.org_id AND m.role = '` + RoleOwner + `' AND m.user_id <> videos.user_id
+			ORDER BY m.created_at, m.user_id
+			LIMIT 1
+		) WHERE user_id = ? AND org_id IN (
+			SELECT org_id FROM organization_members WHERE role = '` + RoleOwner + `' AND user_id <> videos.user_id
+		)`,
+		`DELETE FROM refresh_tokens WHERE user_id = ?`,
+		`DELETE FROM idempotency_keys WHERE user_id = ?`,
+		`DELETE FROM jobs WHERE user_id = ?`,
+		`DELETE FROM egress WHERE user_id = ? AND org_id IS NULL`,
+		`DELETE FROM egress_caps WHERE user_id = ?`,
+		`DELETE FROM notification_preferences WHERE user_id = ?`,
+		`DELETE FROM playlist_items WHERE playlist_id IN (SELECT id FROM playlists WHERE user_id = ?)`,
+		`DELETE FROM playlist_items WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`DELETE FROM playlists WHERE user_id = ?`,
+		`DELETE FROM comments WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`UPDATE videos SET like_count = like_count - 1 WHERE id IN (SELECT video_id FROM video_likes WHERE user_id = ?)`,
+		`DELETE FROM video_likes WHERE user_id = ?`,
+		`DELETE FROM video_likes WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`UPDATE comments SET body = '', deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP), user_id = NULL WHERE user_id = ?`,
+		`DELETE FROM video_transfers WHERE from_user_id = ? OR to_user_id = ?`,
+		`DELETE FROM video_transfers WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`DELETE FROM chunked_uploads WHERE user_id = ? OR video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`DELETE FROM assets WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?) AND NOT EXISTS (
+			SELECT 1 FROM videos v WHERE v.user_id <> ? AND ` + assetUsedBy + `
+		)`,
+		`UPDATE assets SET video_id = (
+			SELECT v.id FROM videos v WHERE v.user_id <> ? AND ` + assetUsedBy + `
+			` + assetHeirOrder + `
+		) WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`DELETE FROM video_search WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`DELETE FROM chapters WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`DELETE FROM playback_rules WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`DELETE FROM video_views WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`DELETE FROM video_versions WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`,
+		`DELETE FROM videos WHERE user_id = ?`,
+		`DELETE FROM organizations WHERE id IN (SELECT org_id FROM organization_members WHERE user_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM organization_members m WHERE m.org_id = organizations.id AND m.user_id <> ?)`,
+		`DELETE FROM organization_members WHERE user_id = ?`,
+		`DELETE FROM users WHERE id = ?`,
+	} {
+		args := slices.Repeat([]any{id.String()}, strings.Count(query, "?"))
+		if _, err := t.Exec(query, args...); err != nil {
+			return Job{}, err
+		}
+	}
+	jobID, err := insertJob(t, purge)
+	if err != nil {
+		return Job{}, err
+	}
+	if err := t.Commit(); err != nil {
+		return Job{}, err
+	}
+	return c.GetJob(jobID)
+}
+
+// GetUserTier returns the tier the user was put on, or "" if none.
+func (c Client) GetUserTier(userID uuid.UUID) (string, error) {
+	var tier string
+	err := c.db.QueryRow(`SELECT tier FROM user_tiers WHERE user_id = ?`, userID.String()).Scan(&tier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return tier, err
+}
+
+// SetUserTier puts the user on tier, or with "" takes them off theirs.
+func (c Client) SetUserTier(userID uuid.UUID, tier string) error {
+	if tier == "" {
+		_, err := c.db.Exec(`DELETE FROM user_tiers WHERE user_id = ?`, userID.String())
+		return err
+	}
+	query := `
+	INSERT INTO user_tiers (user_id, tier)
+	VALUES (?, ?)
+	ON CONFLICT (user_id) DO UPDATE SET tier = excluded.tier
+	`
+	_, err := c.db.Exec(query, userID.String(), tier)
+	return err
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+// LikeVideo records the user's like and returns the video's like count.
+// Liking a video twice counts once.
+func (c Client) LikeVideo(videoID, userID uuid.UUID) (int, error) {
+	return c.setVideoLike(videoID, userID, `
+	INSERT INTO video_likes (video_id, user_id, created_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT (video_id, user_id) DO NOTHING
+	`, 1)
+}
+
+// UnlikeVideo removes the user's like, if any, and returns the video's like
+// count.
+func (c Client) UnlikeVideo(videoID, userID uuid.UUID) (int, error) {
+	return c.setVideoLike(videoID, userID, `DELETE FROM video_likes WHERE video_id = ? AND user_id = ?`, -1)
+}
+
+// setVideoLike runs query and, if it changed a row, moves like_count by
+// delta in the same transaction.
+func (c Client) setVideoLike(videoID, userID uuid.UUID, query string, delta int) (int, error) {
+	t, err := c.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer t.Rollback()
+
+	result, err := t.Exec(query, videoID, userID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		if _, err := t.Exec(`UPDATE videos SET like_count = like_count + ? WHERE id = ?`, delta, videoID); err != nil {
+			return 0, err
+		}
+	}
+	var count int
+	if err := t.QueryRow(`SELECT like_count FROM videos WHERE id = ?`, videoID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, t.Commit()
+}
+
+// HasLikedVideo reports whether the user likes the video.
+func (c Client) HasLikedVideo(videoID, userID uuid.UUID) (bool, error) {
+	var n int
+	err := c.db.QueryRow(`SELECT COUNT(*) FROM video_likes WHERE video_id = ? AND user_id = ?`, videoID, userID).Scan(&n)
+	return n > 0, err
+}
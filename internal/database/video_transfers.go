@@ -0,0 +1,254 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Transfer statuses. Only pending transfers can be accepted, declined or
+// cancelled.
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+)
+
+// VideoTransfer offers a video to a user or an organization, exactly one
+// of ToUserID and ToOrgID being set.
+type VideoTransfer struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Status     string     `json:"status"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	// JobID is the rekey_video job queued on acceptance, if Rekey is set
+	JobID *uuid.UUID `json:"job_id"`
+	CreateVideoTransferParams
+}
+
+type CreateVideoTransferParams struct {
+	VideoID    uuid.UUID  `json:"video_id"`
+	FromUserID uuid.UUID  `json:"from_user_id"`
+	ToUserID   *uuid.UUID `json:"to_user_id"`
+	ToOrgID    *uuid.UUID `json:"to_org_id"`
+	// Rekey copies the video's objects to keys of the new owner once the
+	// transfer is accepted
+	Rekey bool `json:"rekey"`
+}
+
+const videoTransferColumns = `
+		t.id,
+		t.created_at,
+		t.status,
+		t.resolved_at,
+		t.job_id,
+		t.video_id,
+		t.from_user_id,
+		t.to_user_id,
+		t.to_org_id,
+		t.rekey`
+
+func scanVideoTransfer(row rowScanner) (VideoTransfer, error) {
+	var t VideoTransfer
+	err := row.Scan(
+		&t.ID,
+		&t.CreatedAt,
+		&t.Status,
+		&t.ResolvedAt,
+		&t.JobID,
+		&t.VideoID,
+		&t.FromUserID,
+		&t.ToUserID,
+		&t.ToOrgID,
+		&t.Rekey,
+	)
+	return t, err
+}
+
+// CreateVideoTransfer returns false without creating anything if the video
+// already has a pending transfer.
+func (c Client) CreateVideoTransfer(params CreateVideoTransferParams) (VideoTransfer, bool, error) {
+	existing, err := c.GetPendingVideoTransfer(params.VideoID)
+	if err != nil || existing.ID != uuid.Nil {
+		return VideoTransfer{}, false, err
+	}
+
+	id := uuid.New()
+	query := `
+	INSERT INTO video_transfers (id, created_at, video_id, from_user_id, to_user_id, to_org_id, rekey, status)
+	VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = c.db.Exec(query, id, params.VideoID, params.FromUserID, params.ToUserID, params.ToOrgID, params.Rekey, TransferPending)
+	if err != nil {
+		return VideoTransfer{}, false, err
+	}
+	transfer, err := c.GetVideoTransfer(id)
+	return transfer, err == nil, err
+}
+
+// GetVideoTransfer returns the zero VideoTransfer if id doesn't exist.
+func (c Client) GetVideoTransfer(id uuid.UUID) (VideoTransfer, error) {
+	return c.getVideoTransfer(`t.id = ?`, id)
+}
+
+// GetPendingVideoTransfer returns the video's pending transfer, or the zero
+// VideoTransfer if it has none.
+func (c Client) GetPendingVideoTransfer(videoID uuid.UUID) (VideoTransfer, error) {
+	return c.getVideoTransfer(`t.video_id = ? AND t.status = '`+TransferPending+`'`, videoID)
+}
+
+func (c Client) getVideoTransfer(where string, arg any) (VideoTransfer, error) {
+	query := `
+	SELECT` + videoTransferColumns + `
+	FROM video_transfers t
+	WHERE ` + where
+	transfer, err := scanVideoTransfer(c.db.QueryRow(query, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return VideoTransfer{}, nil
+	}
+	return transfer, err
+}
+
+// GetIncomingVideoTransfers returns the pending transfers the user may
+// accept: those to them and to organizations they own. Newest first.
+func (c Client) GetIncomingVideoTransfers(userID uuid.UUID) ([]VideoTransfer, error) {
+	query := `
+	SELECT` + videoTransferColumns + `
+	FROM video_transfers t
+	WHERE t.status = ?
+		AND (t.to_user_id = ? OR t.to_org_id IN (
+			SELECT org_id FROM organization_members WHERE user_id = ? AND role = ?
+		))
+	ORDER BY t.created_at DESC
+	`
+	return c.queryVideoTransfers(query, TransferPending, userID, userID, RoleOwner)
+}
+
+// GetOutgoingVideoTransfers returns the pending transfers the user offered,
+// newest first.
+func (c Client) GetOutgoingVideoTransfers(userID uuid.UUID) ([]VideoTransfer, error) {
+	query := `
+	SELECT` + videoTransferColumns + `
+	FROM video_transfers t
+	WHERE t.status = ? AND t.from_user_id = ?
+	ORDER BY t.created_at DESC
+	`
+	return c.queryVideoTransfers(query, TransferPending, userID)
+}
+
+func (c Client) queryVideoTransfers(query string, args ...any) ([]VideoTransfer, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []VideoTransfer{}
+	for rows.Next() {
+		transfer, err := scanVideoTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+// ResolveVideoTransfer declines or cancels a pending transfer. It returns
+// false if the transfer wasn't pending anymore.
+func (c Client) ResolveVideoTransfer(id uuid.UUID, status string) (bool, error) {
+	return resolveVideoTransfer(c.db, id, status, nil)
+}
+
+func resolveVideoTransfer(db execer, id uuid.UUID, status string, jobID *uuid.UUID) (bool, error) {
+	query := `
+	UPDATE video_transfers
+	SET status = ?, resolved_at = CURRENT_TIMESTAMP, job_id = ?
+	WHERE id = ? AND status = ?
+	`
+	result, err := db.Exec(query, status, jobID, id, TransferPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// AcceptVideoTransfer hands the video to the recipient: to the user, or to
+// the organization with ownerID, the accepting owner, as its creator. rekey
+// is queued in the same transaction if it is non-nil. It returns false
+// without changing anything if the transfer wasn't pending anymore.
+func (c Client) AcceptVideoTransfer(transfer VideoTransfer, ownerID uuid.UUID, rekey *CreateJobParams) (bool, error) {
+	t, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer t.Rollback()
+
+	var jobID *uuid.UUID
+	if rekey != nil {
+		id, err := insertJob(t, *rekey)
+		if err != nil {
+			return false, err
+		}
+		jobID = &id
+	}
+	ok, err := resolveVideoTransfer(t, transfer.ID, TransferAccepted, jobID)
+	if err != nil || !ok {
+		return false, err
+	}
+	query := `
+	UPDATE videos
+	SET updated_at = CURRENT_TIMESTAMP, user_id = ?, org_id = ?
+	WHERE id = ?
+	`
+	if _, err := t.Exec(query, ownerID, transfer.ToOrgID, transfer.VideoID); err != nil {
+		return false, err
+	}
+	return true, t.Commit()
+}
+
+// ReplaceVideoObjectURLs points the video and all of its versions at new
+// copies of their objects, old "bucket,key" reference to new. References
+// that aren't in moved are left alone.
+func (c Client) ReplaceVideoObjectURLs(videoID uuid.UUID, moved map[string]string) error {
+	t, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE id = ?
+	`
+	video, err := scanVideo(t.QueryRow(query, videoID))
+	if err != nil {
+		return err
+	}
+	for _, ref := range []**string{&video.VideoURL, &video.PreviewURL, &video.SDRVideoURL, &video.OriginalURL} {
+		if *ref == nil {
+			continue
+		}
+		if to, ok := moved[**ref]; ok {
+			*ref = &to
+		}
+	}
+	if err := updateVideo(t, video); err != nil {
+		return err
+	}
+
+	for from, to := range moved {
+		for _, column := range []string{"video_url", "preview_url", "sdr_video_url", "original_url"} {
+			query := `UPDATE video_versions SET ` + column + ` = ? WHERE video_id = ? AND ` + column + ` = ?`
+			if _, err := t.Exec(query, to, videoID, from); err != nil {
+				return err
+			}
+		}
+	}
+	return t.Commit()
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoVersion is one upload of a video. Replacing the file adds a version
+// instead of dropping the old renditions, and any version can be made
+// active again.
+type VideoVersion struct {
+	VideoID          uuid.UUID `json:"video_id"`
+	Version          int       `json:"version"`
+	CreatedAt        time.Time `json:"created_at"`
+	VideoURL         *string   `json:"-"`
+	PreviewURL       *string   `json:"-"`
+	SDRVideoURL      *string   `json:"-"`
+	OriginalURL      *string   `json:"-"`
+	SHA256           *string   `json:"sha256"`
+	ModerationStatus string    `json:"moderation_status"`
+	ModerationLabels string    `json:"-"`
+	ModerationReason *string   `json:"moderation_reason"`
+	Dimensions
+}
+
+const videoVersionColumns = `
+		video_id,
+		version,
+		created_at,
+		video_url,
+		preview_url,
+		sdr_video_url,
+		original_url,
+		sha256,
+		moderation_status,
+		moderation_labels,
+		moderation_reason,
+		width,
+		height,
+		aspect_ratio,
+		aspect,
+		dynamic_range,
+		audio_tracks,
+		duration`
+
+func scanVideoVersion(row rowScanner) (VideoVersion, error) {
+	var v VideoVersion
+	err := row.Scan(
+		&v.VideoID,
+		&v.Version,
+		&v.CreatedAt,
+		&v.VideoURL,
+		&v.PreviewURL,
+		&v.SDRVideoURL,
+		&v.OriginalURL,
+		&v.SHA256,
+		&v.ModerationStatus,
+		&v.ModerationLabels,
+		&v.ModerationReason,
+		&v.Width,
+		&v.Height,
+		&v.AspectRatio,
+		&v.Aspect,
+		&v.DynamicRange,
+		&v.AudioTracks,
+		&v.Duration,
+	)
+	return v, err
+}
+
+// GetVideoVersions returns the video's versions, newest first.
+func (c Client) GetVideoVersions(videoID uuid.UUID) ([]VideoVersion, error) {
+	query := `
+	SELECT` + videoVersionColumns + `
+	FROM video_versions
+	WHERE video_id = ?
+	ORDER BY version DESC
+	`
+
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		v, err := scanVideoVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetVideoVersion returns the zero VideoVersion if the video has no such
+// version.
+func (c Client) GetVideoVersion(videoID uuid.UUID, version int) (VideoVersion, error) {
+	query := `
+	SELECT` + videoVersionColumns + `
+	FROM video_versions
+	WHERE video_id = ? AND version = ?
+	`
+
+	v, err := scanVideoVersion(c.db.QueryRow(query, videoID, version))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoVersion{}, nil
+		}
+		return VideoVersion{}, err
+	}
+	return v, nil
+}
+
+// UpdateVideoAsNewVersion saves video and records its renditions as its
+// next version, which becomes the active one. If the latest version already
+// has the same stream rendition, as when a job is resumed after saving, that
+// version is updated instead.
+func (c Client) UpdateVideoAsNewVersion(video Video) (Video, error) {
+	t, err := c.db.Begin()
+	if err != nil {
+		return Video{}, err
+	}
+	defer t.Rollback()
+
+	var latest int
+	var latestURL sql.NullString
+	err = t.QueryRow(`
+	SELECT version, video_url
+	FROM video_versions
+	WHERE video_id = ?
+	ORDER BY version DESC
+	LIMIT 1
+	`, video.ID).Scan(&latest, &latestURL)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Video{}, err
+	}
+
+	version := latest + 1
+	if latestURL.Valid && video.VideoURL != nil && latestURL.String == *video.VideoURL {
+		version = latest
+		if _, err := t.Exec(`DELETE FROM video_versions WHERE video_id = ? AND version = ?`, video.ID, version); err != nil {
+			return Video{}, err
+		}
+	}
+
+	query := `
+	INSERT INTO video_versions (
+		video_id,
+		version,
+		created_at,
+		video_url,
+		preview_url,
+		sdr_video_url,
+		original_url,
+		sha256,
+		moderation_status,
+		moderation_labels,
+		moderation_reason,
+		width,
+		height,
+		aspect_ratio,
+		aspect,
+		dynamic_range,
+		audio_tracks,
+		duration
+	) VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = t.Exec(
+		query,
+		video.ID,
+		version,
+		video.VideoURL,
+		video.PreviewURL,
+		video.SDRVideoURL,
+		video.OriginalURL,
+		video.SHA256,
+		video.ModerationStatus,
+		video.ModerationLabels,
+		video.ModerationReason,
+		video.Width,
+		video.Height,
+		video.AspectRatio,
+		video.Aspect,
+		video.DynamicRange,
+		video.AudioTracks,
+		video.Duration,
+	)
+	if err != nil {
+		return Video{}, err
+	}
+
+	video.ActiveVersion = &version
+	if err := updateVideo(t, video); err != nil {
+		return Video{}, err
+	}
+	if err := t.Commit(); err != nil {
+		return Video{}, err
+	}
+	return video, nil
+}
+
+// ActivateVideoVersion points video back at the renditions of version. The
+// moderation decision of the version being replaced is saved with it first,
+// so a later rollback to it keeps the decision.
+func (c Client) ActivateVideoVersion(video Video, version VideoVersion) (Video, error) {
+	t, err := c.db.Begin()
+	if err != nil {
+		return Video{}, err
+	}
+	defer t.Rollback()
+
+	if video.ActiveVersion != nil {
+		query := `
+		UPDATE video_versions
+		SET moderation_status = ?, moderation_labels = ?, moderation_reason = ?
+		WHERE video_id = ? AND version = ?
+		`
+		_, err := t.Exec(query, video.ModerationStatus, video.ModerationLabels, video.ModerationReason, video.ID, *video.ActiveVersion)
+		if err != nil {
+			return Video{}, err
+		}
+	}
+
+	video.VideoURL = version.VideoURL
+	video.PreviewURL = version.PreviewURL
+	video.SDRVideoURL = version.SDRVideoURL
+	video.OriginalURL = version.OriginalURL
+	// The archive task checks the storage class again
+	video.OriginalArchivedAt = nil
+	video.SHA256 = version.SHA256
+	video.ModerationStatus = version.ModerationStatus
+	video.ModerationLabels = version.ModerationLabels
+	video.ModerationReason = version.ModerationReason
+	video.Dimensions = version.Dimensions
+	video.ProcessingStatus = ProcessingReady
+	video.ActiveVersion = &version.Version
+
+	if err := updateVideo(t, video); err != nil {
+		return Video{}, err
+	}
+	if err := t.Commit(); err != nil {
+		return Video{}, err
+	}
+	return video, nil
+}
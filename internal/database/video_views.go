@@ -0,0 +1,93 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoView is what a player reports about one playback session. Beacons
+// repeat for as long as the session lasts; the session counts as one view.
+type VideoView struct {
+	VideoID   uuid.UUID
+	SessionID string
+	// Viewer identifies whoever is watching without revealing who they are
+	Viewer string
+	// Position is how far into the video playback got, in seconds
+	Position float64
+	// Completion is Position as a fraction of the video's duration
+	Completion float64
+}
+
+// CompletionBucket counts the views whose furthest position fell in
+// [FromPercent, ToPercent) of the video, the last bucket including 100.
+type CompletionBucket struct {
+	FromPercent int `json:"from_percent"`
+	ToPercent   int `json:"to_percent"`
+	Views       int `json:"views"`
+}
+
+// VideoStats aggregates the views of a video.
+type VideoStats struct {
+	Views         int `json:"views"`
+	UniqueViewers int `json:"unique_viewers"`
+	// WatchSeconds adds up how far each view got, so rewatched parts of a
+	// session aren't counted twice
+	WatchSeconds float64            `json:"watch_seconds"`
+	Completion   []CompletionBucket `json:"completion"`
+}
+
+// completionQuartiles are the upper bounds of the completion buckets
+var completionQuartiles = []int{25, 50, 75, 100}
+
+// RecordVideoView adds the session's view or, if it has one already, moves
+// it forward to the furthest position reported so far.
+func (c Client) RecordVideoView(view VideoView) error {
+	query := `
+	INSERT INTO video_views (video_id, session_id, viewer, position_seconds, completion)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (video_id, session_id) DO UPDATE SET
+		updated_at = CURRENT_TIMESTAMP,
+		position_seconds = CASE WHEN excluded.position_seconds > video_views.position_seconds
+			THEN excluded.position_seconds ELSE video_views.position_seconds END,
+		completion = CASE WHEN excluded.completion > video_views.completion
+			THEN excluded.completion ELSE video_views.completion END
+	`
+	_, err := c.db.Exec(query, view.VideoID, view.SessionID, view.Viewer, view.Position, view.Completion)
+	return err
+}
+
+// GetVideoStats aggregates the views of a video that started at or after
+// since; the zero time counts every view.
+func (c Client) GetVideoStats(videoID uuid.UUID, since time.Time) (VideoStats, error) {
+	query := `
+	SELECT COUNT(*), COUNT(DISTINCT viewer), COALESCE(SUM(position_seconds), 0),
+		COALESCE(SUM(CASE WHEN completion < 0.25 THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN completion >= 0.25 AND completion < 0.5 THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN completion >= 0.5 AND completion < 0.75 THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN completion >= 0.75 THEN 1 ELSE 0 END), 0)
+	FROM video_views
+	WHERE video_id = ? AND started_at >= ?
+	`
+	var stats VideoStats
+	buckets := make([]int, len(completionQuartiles))
+	err := c.db.QueryRow(query, videoID, since.UTC()).Scan(
+		&stats.Views,
+		&stats.UniqueViewers,
+		&stats.WatchSeconds,
+		&buckets[0],
+		&buckets[1],
+		&buckets[2],
+		&buckets[3],
+	)
+	if err != nil {
+		return VideoStats{}, err
+	}
+
+	from := 0
+	for i, to := range completionQuartiles {
+		stats.Completion = append(stats.Completion, CompletionBucket{FromPercent: from, ToPercent: to, Views: buckets[i]})
+		from = to
+	}
+	return stats, nil
+}
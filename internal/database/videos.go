@@ -2,40 +2,334 @@ package database
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Processing statuses of a video's latest upload. Videos without an upload
+// have ProcessingNone.
+const (
+	ProcessingNone       = ""
+	ProcessingQueued     = "queued"
+	ProcessingInProgress = "processing"
+	ProcessingReady      = "ready"
+	ProcessingFailed     = "failed"
+)
+
+// Visibilities. Unlisted videos are reachable by ID but not meant to be
+// listed to other users; private ones only by their owner and admins.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// Moderation statuses. Videos uploaded while moderation is disabled have
+// ModerationNone.
+const (
+	ModerationNone     = ""
+	ModerationApproved = "approved"
+	ModerationPending  = "pending_review"
+	ModerationRejected = "rejected"
+)
+
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID              uuid.UUID  `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	ThumbnailURL    *string    `json:"thumbnail_url"`
+	PosterTimestamp *float64   `json:"poster_timestamp"`
+	VideoURL        *string    `json:"video_url"`
+	PreviewURL      *string    `json:"preview_url"`
+	SourceVideoID   *uuid.UUID `json:"source_video_id"`
+	// SHA256 is the hex digest of the uploaded file as received
+	SHA256           *string `json:"sha256"`
+	ProcessingStatus string  `json:"processing_status"`
+	// ActiveVersion is the upload the renditions belong to, see VideoVersion
+	ActiveVersion    *int   `json:"active_version"`
+	Visibility       string `json:"visibility"`
+	ModerationStatus string `json:"moderation_status"`
+	// ModerationReason is the reviewer's explanation of their decision
+	ModerationReason *string `json:"moderation_reason"`
+	// ModerationLabels is the comma separated list of what the classifier
+	// flagged
+	ModerationLabels string `json:"-"`
+	// SDRVideoURL is the tonemapped rendition of an HDR video, if its
+	// profile made one
+	SDRVideoURL *string `json:"sdr_video_url"`
+	// OriginalURL is the "bucket,key" of the untouched upload, if kept
+	OriginalURL        *string    `json:"-"`
+	OriginalArchivedAt *time.Time `json:"-"`
+	// DeletedAt is when the video was moved to the trash
+	DeletedAt *time.Time `json:"deleted_at"`
+	// ThumbnailSourceURL is the uncropped image ThumbnailCrop was cut from
+	ThumbnailSourceURL *string        `json:"-"`
+	ThumbnailCrop      *ThumbnailCrop `json:"thumbnail_crop"`
+	// AllowDownloads lets viewers other than the owner download the file
+	AllowDownloads bool `json:"allow_downloads"`
+	// DownloadFilename is what downloads are saved as, nil for a name
+	// derived from the title
+	DownloadFilename *string `json:"download_filename"`
+	// EmbedDomains are the sites the embed player works on, nil for any
+	EmbedDomains EmbedDomains `json:"embed_domains"`
+	// LikeCount is kept up to date by LikeVideo and UnlikeVideo; UpdateVideo
+	// leaves it alone
+	LikeCount int `json:"like_count"`
+	ThumbnailPlaceholder
+	Dimensions
 	CreateVideoParams
 }
 
+// ThumbnailCrop is the part of the uncropped thumbnail that is shown, in
+// fractions of its width and height. FocusX and FocusY are set when the
+// rectangle was fitted around a focal point. It is stored as JSON in a TEXT
+// column.
+type ThumbnailCrop struct {
+	X      float64  `json:"x"`
+	Y      float64  `json:"y"`
+	Width  float64  `json:"width"`
+	Height float64  `json:"height"`
+	FocusX *float64 `json:"focus_x,omitempty"`
+	FocusY *float64 `json:"focus_y,omitempty"`
+}
+
+func (c ThumbnailCrop) Value() (driver.Value, error) {
+	dat, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(dat), nil
+}
+
+func (c *ThumbnailCrop) Scan(src any) error {
+	var dat []byte
+	switch v := src.(type) {
+	case string:
+		dat = []byte(v)
+	case []byte:
+		dat = v
+	default:
+		return fmt.Errorf("unsupported thumbnail crop type %T", src)
+	}
+	return json.Unmarshal(dat, c)
+}
+
+// ThumbnailPlaceholder lets clients draw something while the thumbnail
+// loads. Both are nil for thumbnails set before they were computed.
+type ThumbnailPlaceholder struct {
+	// BlurHash is the thumbnail encoded with https://blurha.sh
+	BlurHash *string `json:"thumbnail_blurhash"`
+	// Color is the thumbnail's average color as #rrggbb
+	Color *string `json:"thumbnail_color"`
+}
+
+// Dimensions are the stream's size and tracks as probed when it was
+// processed and the aspect category that picked its object key folder.
+// Renditions processed before they were recorded have nils.
+type Dimensions struct {
+	Width  *int `json:"width"`
+	Height *int `json:"height"`
+	// AspectRatio is Width / Height
+	AspectRatio *float64 `json:"aspect_ratio"`
+	Aspect      *string  `json:"aspect"`
+	// DynamicRange is "sdr", "hdr10" or "hlg"
+	DynamicRange *string     `json:"dynamic_range"`
+	AudioTracks  AudioTracks `json:"audio_tracks"`
+	// Duration is in seconds
+	Duration *float64 `json:"duration"`
+}
+
+// AudioTrack is one audio stream of a rendition.
+type AudioTrack struct {
+	// Index counts the audio streams from 0
+	Index int `json:"index"`
+	// Language is an ISO 639-2 code like "eng"
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Codec    string `json:"codec"`
+	Channels int    `json:"channels"`
+	// Default is the track players start with
+	Default bool `json:"default"`
+}
+
+// AudioTracks is stored as JSON in a TEXT column, NULL when the tracks
+// weren't probed.
+type AudioTracks []AudioTrack
+
+func (t AudioTracks) Value() (driver.Value, error) {
+	if t == nil {
+		return nil, nil
+	}
+	dat, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(dat), nil
+}
+
+func (t *AudioTracks) Scan(src any) error {
+	var dat []byte
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case string:
+		dat = []byte(v)
+	case []byte:
+		dat = v
+	default:
+		return fmt.Errorf("unsupported audio tracks type %T", src)
+	}
+	return json.Unmarshal(dat, t)
+}
+
+// EmbedDomains are host names, each also matching its subdomains. It is
+// stored as JSON in a TEXT column, and NULL when nil.
+type EmbedDomains []string
+
+func (d EmbedDomains) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	dat, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(dat), nil
+}
+
+func (d *EmbedDomains) Scan(src any) error {
+	var dat []byte
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case string:
+		dat = []byte(v)
+	case []byte:
+		dat = v
+	default:
+		return fmt.Errorf("unsupported embed domains type %T", src)
+	}
+	return json.Unmarshal(dat, d)
+}
+
 type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	UserID      uuid.UUID `json:"user_id"`
+	// OrgID puts the video in an organization's shared library. UserID is
+	// still the member who created it.
+	OrgID *uuid.UUID `json:"org_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
 		title,
 		description,
 		thumbnail_url,
+		poster_timestamp,
 		video_url,
-		user_id
+		preview_url,
+		user_id,
+		source_video_id,
+		original_url,
+		original_archived_at,
+		sha256,
+		moderation_status,
+		moderation_labels,
+		moderation_reason,
+		processing_status,
+		visibility,
+		deleted_at,
+		active_version,
+		width,
+		height,
+		aspect_ratio,
+		aspect,
+		dynamic_range,
+		audio_tracks,
+		duration,
+		sdr_video_url,
+		thumbnail_blurhash,
+		thumbnail_color,
+		thumbnail_source_url,
+		thumbnail_crop,
+		allow_downloads,
+		download_filename,
+		embed_domains,
+		like_count,
+		org_id`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	err := row.Scan(videoScanDest(&video)...)
+	return video, err
+}
+
+// videoScanDest is where the videoColumns are scanned into, for queries that
+// select more after them.
+func videoScanDest(video *Video) []any {
+	return []any{
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.PosterTimestamp,
+		&video.VideoURL,
+		&video.PreviewURL,
+		&video.UserID,
+		&video.SourceVideoID,
+		&video.OriginalURL,
+		&video.OriginalArchivedAt,
+		&video.SHA256,
+		&video.ModerationStatus,
+		&video.ModerationLabels,
+		&video.ModerationReason,
+		&video.ProcessingStatus,
+		&video.Visibility,
+		&video.DeletedAt,
+		&video.ActiveVersion,
+		&video.Width,
+		&video.Height,
+		&video.AspectRatio,
+		&video.Aspect,
+		&video.DynamicRange,
+		&video.AudioTracks,
+		&video.Duration,
+		&video.SDRVideoURL,
+		&video.BlurHash,
+		&video.Color,
+		&video.ThumbnailSourceURL,
+		&video.ThumbnailCrop,
+		&video.AllowDownloads,
+		&video.DownloadFilename,
+		&video.EmbedDomains,
+		&video.LikeCount,
+		&video.OrgID,
+	}
+}
+
+func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE user_id = ?
+		AND deleted_at IS NULL
 	ORDER BY created_at DESC
 	`
 
@@ -47,17 +341,8 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
@@ -66,7 +351,13 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 	return videos, nil
 }
 
+// CreateVideo creates a public draft: a video without any media yet, whose
+// processing status is ProcessingNone until the first upload.
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
+	return c.CreateVideoWithVisibility(params, VisibilityPublic)
+}
+
+func (c Client) CreateVideoWithVisibility(params CreateVideoParams, visibility string) (Video, error) {
 	id := uuid.New()
 	query := `
 	INSERT INTO videos (
@@ -75,10 +366,17 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		user_id,
+		org_id,
+		visibility
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID, params.OrgID, visibility)
+	if err != nil {
+		return Video{}, err
+	}
+	_, err = c.db.Exec(`INSERT INTO video_search (video_id, title, description, chapters) VALUES (?, ?, ?, '')`,
+		id, params.Title, params.Description)
 	if err != nil {
 		return Video{}, err
 	}
@@ -86,31 +384,16 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 	return c.GetVideo(id)
 }
 
+// GetVideo returns the zero Video if id doesn't exist or is in the trash.
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
+		AND deleted_at IS NULL
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -122,34 +405,396 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 }
 
 func (c Client) UpdateVideo(video Video) error {
+	return updateVideo(c.db, video)
+}
+
+// execer is what updates need from a *conn or *tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func updateVideo(db execer, video Video) error {
 	query := `
 	UPDATE videos
 	SET
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
+		poster_timestamp = ?,
 		video_url = ?,
-		user_id = ?
+		preview_url = ?,
+		user_id = ?,
+		org_id = ?,
+		source_video_id = ?,
+		original_url = ?,
+		original_archived_at = ?,
+		sha256 = ?,
+		moderation_status = ?,
+		moderation_labels = ?,
+		moderation_reason = ?,
+		processing_status = ?,
+		visibility = ?,
+		storage_bucket = ?,
+		video_key = ?,
+		preview_key = ?,
+		original_key = ?,
+		active_version = ?,
+		width = ?,
+		height = ?,
+		aspect_ratio = ?,
+		aspect = ?,
+		dynamic_range = ?,
+		audio_tracks = ?,
+		duration = ?,
+		sdr_video_url = ?,
+		thumbnail_blurhash = ?,
+		thumbnail_color = ?,
+		thumbnail_source_url = ?,
+		thumbnail_crop = ?,
+		allow_downloads = ?,
+		download_filename = ?,
+		embed_domains = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
+	bucket, videoKey := splitObjectRef(video.VideoURL)
+	previewBucket, previewKey := splitObjectRef(video.PreviewURL)
+	originalBucket, originalKey := splitObjectRef(video.OriginalURL)
+	if bucket == nil {
+		bucket = previewBucket
+	}
+	if bucket == nil {
+		bucket = originalBucket
+	}
+
+	_, err := db.Exec(
 		query,
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
+		video.PosterTimestamp,
 		&video.VideoURL,
+		video.PreviewURL,
 		video.UserID,
+		video.OrgID,
+		video.SourceVideoID,
+		video.OriginalURL,
+		video.OriginalArchivedAt,
+		video.SHA256,
+		video.ModerationStatus,
+		video.ModerationLabels,
+		video.ModerationReason,
+		video.ProcessingStatus,
+		video.Visibility,
+		bucket,
+		videoKey,
+		previewKey,
+		originalKey,
+		video.ActiveVersion,
+		video.Width,
+		video.Height,
+		video.AspectRatio,
+		video.Aspect,
+		video.DynamicRange,
+		video.AudioTracks,
+		video.Duration,
+		video.SDRVideoURL,
+		video.BlurHash,
+		video.Color,
+		video.ThumbnailSourceURL,
+		video.ThumbnailCrop,
+		video.AllowDownloads,
+		video.DownloadFilename,
+		video.EmbedDomains,
 		video.ID,
 	)
+	if err != nil {
+		return err
+	}
+	return indexVideoText(db, video)
+}
+
+// SetVideoProcessingStatus updates only the processing status, for the job
+// runner to report progress without rewriting the rest of the video.
+func (c Client) SetVideoProcessingStatus(id uuid.UUID, status string) error {
+	_, err := c.db.Exec(`UPDATE videos SET processing_status = ? WHERE id = ?`, status, id)
 	return err
 }
 
+// splitObjectRef splits a "bucket,key" reference into the structured
+// storage columns, returning nils for anything else.
+func splitObjectRef(ref *string) (bucket, key *string) {
+	if ref == nil {
+		return nil, nil
+	}
+	b, k, ok := strings.Cut(*ref, ",")
+	if !ok {
+		return nil, nil
+	}
+	return &b, &k
+}
+
+// GetVideosWithUnarchivedOriginals returns videos created before cutoff
+// whose original upload hasn't been moved to archival storage yet.
+func (c Client) GetVideosWithUnarchivedOriginals(cutoff time.Time) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE original_url IS NOT NULL
+		AND original_archived_at IS NULL
+		AND created_at < ?
+	ORDER BY created_at ASC
+	`
+
+	rows, err := c.db.Query(query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// ListVideosByModerationStatus returns up to limit videos with the given
+// moderation status, oldest first so reviewers work through the backlog in
+// order.
+func (c Client) ListVideosByModerationStatus(status string, limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE moderation_status = ?
+		AND deleted_at IS NULL
+	ORDER BY created_at ASC
+	LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// DeleteVideo removes the video, its chapters, jobs and versions for good,
+// all at once or not at all.
 func (c Client) DeleteVideo(id uuid.UUID) error {
+	t, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	// Assets other videos still use are handed to one of them instead
+	for _, query := range []string{
+		`DELETE FROM assets WHERE video_id = ? AND NOT EXISTS (
+			SELECT 1 FROM videos v WHERE v.id <> assets.video_id AND ` + assetUsedBy + `
+		)`,
+		`UPDATE assets SET video_id = (
+			SELECT v.id FROM videos v WHERE v.id <> assets.video_id AND ` + assetUsedBy + `
+			` + assetHeirOrder + `
+		) WHERE video_id = ?`,
+	} {
+		if _, err := t.Exec(query, id); err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"chapters", "comments", "video_likes", "video_search", "video_views", "playlist_items", "video_transfers", "chunked_uploads", "playback_rules", "jobs", "video_versions"} {
+		if _, err := t.Exec("DELETE FROM "+table+" WHERE video_id = ?", id); err != nil {
+			return err
+		}
+	}
+
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
+	if _, err := t.Exec(query, id); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// TrashVideo moves the video to the trash. Trashed videos are left out of
+// every lookup except the trash ones until they are restored or purged.
+func (c Client) TrashVideo(id uuid.UUID) error {
+	_, err := c.db.Exec(`UPDATE videos SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
 	return err
 }
+
+// RestoreVideo takes the video out of the trash.
+func (c Client) RestoreVideo(id uuid.UUID) error {
+	_, err := c.db.Exec(`UPDATE videos SET deleted_at = NULL WHERE id = ?`, id)
+	return err
+}
+
+// GetTrashedVideo returns the zero Video if id doesn't exist or isn't in
+// the trash.
+func (c Client) GetTrashedVideo(id uuid.UUID) (Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE id = ?
+		AND deleted_at IS NOT NULL
+	`
+
+	video, err := scanVideo(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Video{}, nil
+		}
+		return Video{}, err
+	}
+	return video, nil
+}
+
+// GetTrashedVideos returns the user's trashed videos, most recently
+// deleted first.
+func (c Client) GetTrashedVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ?
+		AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC
+	`
+	return c.queryVideos(query, userID)
+}
+
+// GetVideosTrashedBefore returns videos moved to the trash before cutoff,
+// oldest first.
+func (c Client) GetVideosTrashedBefore(cutoff time.Time) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at IS NOT NULL
+		AND deleted_at < ?
+	ORDER BY deleted_at ASC
+	`
+	return c.queryVideos(query, cutoff.UTC())
+}
+
+func (c Client) queryVideos(query string, args ...any) ([]Video, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// FindVideoBySHA256 returns the user's most recent video, other than
+// excludeID, whose upload had the given checksum.
+func (c Client) FindVideoBySHA256(userID uuid.UUID, checksum string, excludeID uuid.UUID) (Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ?
+		AND sha256 = ?
+		AND id != ?
+		AND deleted_at IS NULL
+	ORDER BY created_at DESC
+	LIMIT 1
+	`
+
+	video, err := scanVideo(c.db.QueryRow(query, userID, checksum, excludeID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Video{}, nil
+		}
+		return Video{}, err
+	}
+	return video, nil
+}
+
+// CountAssetReferences returns how many videos use the asset with the name
+// as their thumbnail or uncropped thumbnail source, whatever base URL they
+// were saved with.
+func (c Client) CountAssetReferences(name string) (int, error) {
+	query := `
+	SELECT COUNT(*) FROM videos
+	WHERE thumbnail_url LIKE ? OR thumbnail_source_url LIKE ?
+	`
+
+	var count int
+	pattern := "%/assets/" + name
+	err := c.db.QueryRow(query, pattern, pattern).Scan(&count)
+	return count, err
+}
+
+// GetVideosUsingAsset returns the videos outside the trash that use the
+// asset with the name like CountAssetReferences counts them. Trims, clips
+// and duplicates share their source's thumbnail.
+func (c Client) GetVideosUsingAsset(name string) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE (thumbnail_url LIKE ? OR thumbnail_source_url LIKE ?)
+		AND deleted_at IS NULL
+	ORDER BY created_at
+	`
+
+	pattern := "%/assets/" + name
+	rows, err := c.db.Query(query, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// CountObjectReferences returns how many videos and kept versions point at
+// the given "bucket,key" object through any of their renditions.
+func (c Client) CountObjectReferences(objectURL string) (int, error) {
+	query := `
+	SELECT
+		(SELECT COUNT(*) FROM videos
+		WHERE video_url = ? OR preview_url = ? OR original_url = ? OR sdr_video_url = ?)
+		+
+		(SELECT COUNT(*) FROM video_versions
+		WHERE video_url = ? OR preview_url = ? OR original_url = ? OR sdr_video_url = ?)
+	`
+
+	var count int
+	args := make([]any, 8)
+	for i := range args {
+		args[i] = objectURL
+	}
+	err := c.db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
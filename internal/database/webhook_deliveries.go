@@ -0,0 +1,115 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookDelivery is one attempt to post an event to a webhook.
+type WebhookDelivery struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateWebhookDeliveryParams
+}
+
+type CreateWebhookDeliveryParams struct {
+	EventID   uuid.UUID `json:"event_id"`
+	EventType string    `json:"event_type"`
+	URL       string    `json:"url"`
+	Attempt   int       `json:"attempt"`
+	// StatusCode is nil if no response arrived
+	StatusCode *int    `json:"status_code"`
+	Error      *string `json:"error"`
+	DurationMS int64   `json:"duration_ms"`
+}
+
+// WebhookDeliveryFilter narrows ListWebhookDeliveries; zero values match
+// everything.
+type WebhookDeliveryFilter struct {
+	EventID   uuid.UUID
+	EventType string
+	URL       string
+	// Failed only matches attempts that got an error
+	Failed bool
+	// BeforeID pages back from the previous page's last ID
+	BeforeID int64
+	Limit    int
+}
+
+func (c Client) CreateWebhookDelivery(params CreateWebhookDeliveryParams) error {
+	query := `
+	INSERT INTO webhook_deliveries (created_at, event_id, event_type, url, attempt, status_code, error, duration_ms)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, time.Now().UTC(), params.EventID.String(), params.EventType, params.URL,
+		params.Attempt, params.StatusCode, params.Error, params.DurationMS)
+	return err
+}
+
+// ListWebhookDeliveries returns matching attempts, newest first.
+func (c Client) ListWebhookDeliveries(filter WebhookDeliveryFilter) ([]WebhookDelivery, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.EventID != uuid.Nil {
+		conditions = append(conditions, "event_id = ?")
+		args = append(args, filter.EventID.String())
+	}
+	if filter.EventType != "" {
+		conditions = append(conditions, "event_type = ?")
+		args = append(args, filter.EventType)
+	}
+	if filter.URL != "" {
+		conditions = append(conditions, "url = ?")
+		args = append(args, filter.URL)
+	}
+	if filter.Failed {
+		conditions = append(conditions, "error IS NOT NULL")
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+
+	query := `
+	SELECT id, created_at, event_id, event_type, url, attempt, status_code, error, duration_ms
+	FROM webhook_deliveries`
+	if len(conditions) > 0 {
+		query += `
+	WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += `
+	ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += `
+	LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.ID, &d.CreatedAt, &d.EventID, &d.EventType, &d.URL,
+			&d.Attempt, &d.StatusCode, &d.Error, &d.DurationMS)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// DeleteWebhookDeliveriesBefore forgets attempts made before t.
+func (c Client) DeleteWebhookDeliveriesBefore(t time.Time) error {
+	_, err := c.db.Exec(`DELETE FROM webhook_deliveries WHERE created_at < ?`, t.UTC())
+	return err
+}
@@ -0,0 +1,634 @@
+package i18n
+
+// catalogs maps language -> message code -> text. The English catalog must
+// contain every code; other languages may be partial.
+var catalogs = map[string]map[string]string{
+	"en": {
+		"AUTH_TOKEN_MISSING":            "Couldn't find JWT",
+		"AUTH_TOKEN_INVALID":            "Invalid JWT",
+		"AUTH_TOKEN_UNVERIFIED":         "Couldn't validate JWT",
+		"AUTH_REFRESH_MISSING":          "Couldn't find token",
+		"AUTH_REFRESH_INVALID":          "Invalid refresh token",
+		"AUTH_BAD_CREDENTIALS":          "Incorrect email or password",
+		"AUTH_ADMIN_REQUIRED":           "Admin access required",
+		"FORBIDDEN":                     "Unauthorized access",
+		"FORBIDDEN_DELETE":              "You can't delete this video",
+		"INVALID_ID":                    "Invalid ID",
+		"INVALID_VIDEO_ID":              "Invalid video ID",
+		"INVALID_JOB_ID":                "Invalid job ID",
+		"INVALID_USER_ID":               "Invalid user ID",
+		"INVALID_BODY":                  "Couldn't decode parameters",
+		"INVALID_FORM":                  "Error parsing form",
+		"INVALID_CONTENT_TYPE":          "Invalid Content-Type",
+		"INVALID_LIMIT":                 "Invalid limit",
+		"INVALID_TIMESTAMP":             "Invalid timestamp",
+		"INVALID_START":                 "Invalid start timestamp",
+		"INVALID_END":                   "Invalid end timestamp",
+		"RANGE_END_BEFORE_START":        "End must be after start",
+		"RANGE_END_PAST_VIDEO":          "End is past the end of the video",
+		"TIMESTAMP_PAST_VIDEO":          "Timestamp is past the end of the video",
+		"CREDENTIALS_REQUIRED":          "Email and password are required",
+		"VIDEO_NOT_FOUND":               "Video not found",
+		"VIDEO_NOT_IN_TRASH":            "Video not in trash",
+		"INVALID_VERSION":               "Invalid version",
+		"VERSION_NOT_FOUND":             "Version not found",
+		"USER_NOT_FOUND":                "User not found",
+		"INVALID_EXPORT_FORMAT":         "Format must be zip or manifest",
+		"JOB_NOT_FOUND":                 "Job not found",
+		"VIDEO_FILE_MISSING":            "Missing video file",
+		"TOO_MANY_FILES":                "Too many files",
+		"INVALID_MANIFEST":              "Invalid manifest",
+		"MANIFEST_MISMATCH":             "Manifest must have one entry per video",
+		"THUMBNAIL_FILE_MISSING":        "Missing thumbnail file",
+		"FILE_TOO_LARGE":                "File is too large",
+		"UNSUPPORTED_VIDEO_TYPE":        "Only MP4 videos are allowed",
+		"UNSUPPORTED_IMAGE_TYPE":        "Only JPEG and PNG images are allowed",
+		"UNSUPPORTED_CLIP_FORMAT":       "Format must be mp4, gif or webp",
+		"VIDEO_NOT_UPLOADED":            "Video has no uploaded file",
+		"INVALID_RENDITION":             "Rendition must be stream, preview or sdr",
+		"RANGE_NOT_SATISFIABLE":         "Requested range not satisfiable",
+		"STREAM_FAILED":                 "Couldn't stream video",
+		"INVALID_CHECKSUM":              "Invalid checksum header",
+		"CHECKSUM_MISMATCH":             "Checksum mismatch",
+		"IMPORT_SOURCE_REQUIRED":        "Source bucket and key are required",
+		"IMPORT_CREDENTIALS_INCOMPLETE": "Credentials need an access key ID and secret access key",
+		"IMPORT_SOURCE_UNREADABLE":      "Couldn't read source object",
+		"IMPORT_NOT_VIDEO":              "Source object is not a video",
+		"DIRECT_UPLOADS_DISABLED":       "Direct uploads are not enabled",
+		"UNKNOWN_PROCESSING_PROFILE":    "Unknown processing profile",
+		"THUMBNAIL_CROP_REQUIRED":       "Provide either a crop or a focal point",
+		"INVALID_CROP":                  "Invalid crop",
+		"INVALID_FOCAL_POINT":           "Invalid focal point",
+		"INVALID_ASPECT_RATIO":          "Invalid aspect ratio",
+		"THUMBNAIL_MISSING":             "Video has no thumbnail",
+		"INVALID_SESSION_ID":            "Invalid session ID",
+		"INVALID_PLAYBACK_POSITION":     "Invalid playback position",
+		"INVALID_MONTH":                 "Invalid month",
+		"INVALID_EGRESS_CAP":            "Invalid egress cap",
+		"EGRESS_CAP_REACHED":            "Monthly egress limit reached",
+		"CLOUDFRONT_LOGS_DISABLED":      "CloudFront log ingestion is not enabled",
+		"INVALID_FILENAME":              "Invalid filename",
+		"DOWNLOADS_DISABLED":            "Downloads are disabled for this video",
+		"INVALID_PLAYLIST_ID":           "Invalid playlist ID",
+		"PLAYLIST_NOT_FOUND":            "Playlist not found",
+		"TITLE_REQUIRED":                "Title is required",
+		"INVALID_VISIBILITY":            "Invalid visibility",
+		"INVALID_POSITION":              "Invalid position",
+		"PLAYLIST_FOREIGN_VIDEO":        "You can only add your own videos",
+		"PLAYLIST_DUPLICATE_VIDEO":      "Video is already in the playlist",
+		"PLAYLIST_VIDEO_MISSING":        "Video is not in the playlist",
+		"INVALID_PLAYLIST_ORDER":        "Order must list every video in the playlist once",
+		"INVALID_COMMENT_ID":            "Invalid comment ID",
+		"COMMENT_NOT_FOUND":             "Comment not found",
+		"PARENT_COMMENT_NOT_FOUND":      "Parent comment not found",
+		"COMMENT_BODY_REQUIRED":         "Comment body is required",
+		"COMMENT_TOO_LONG":              "Comment is too long",
+		"INVALID_CURSOR":                "Invalid cursor",
+		"FORBIDDEN_DELETE_COMMENT":      "You can't delete this comment",
+		"SEARCH_QUERY_REQUIRED":         "Search query is required",
+		"SEARCH_QUERY_TOO_LONG":         "Search query is too long",
+		"INVALID_OFFSET":                "Invalid offset",
+		"INVALID_ORG_ID":                "Invalid organization ID",
+		"ORG_NOT_FOUND":                 "Organization not found",
+		"ORG_NAME_REQUIRED":             "Organization name is required",
+		"INVALID_ORG_ROLE":              "Invalid role",
+		"ORG_MEMBER_EXISTS":             "User is already a member",
+		"ORG_MEMBER_NOT_FOUND":          "Member not found",
+		"LAST_ORG_OWNER":                "An organization needs at least one owner",
+		"ORG_OWNER_REQUIRED":            "Organization owner access required",
+		"FORBIDDEN_ORG_UPLOAD":          "You can't upload to this organization",
+		"INVALID_TRANSFER_ID":           "Invalid transfer ID",
+		"TRANSFER_NOT_FOUND":            "Transfer not found",
+		"TRANSFER_RECIPIENT_REQUIRED":   "Give either to_email or to_org_id",
+		"TRANSFER_TO_OWNER":             "Video already belongs to the recipient",
+		"TRANSFER_PENDING":              "Video already has a pending transfer",
+		"TRANSFER_NOT_PENDING":          "Transfer is no longer pending",
+		"INVALID_WINDOW":                "Invalid window",
+		"JOB_NOT_DEAD_LETTERED":         "Job is not dead-lettered",
+		"UNSUPPORTED_LANGUAGE":          "Unsupported language",
+		"INVALID_EVENT_ID":              "Invalid event ID",
+		"INVALID_UPLOAD_ID":             "Invalid upload ID",
+		"UPLOAD_NOT_FOUND":              "Upload not found",
+		"INVALID_CHUNK_NUMBER":          "Invalid chunk number",
+		"UPLOAD_COMPLETED":              "Upload is already completed",
+		"CHUNK_TOO_LARGE":               "Chunk is too large",
+		"CHUNK_UNREADABLE":              "Couldn't read chunk",
+		"CHUNK_EMPTY":                   "Chunk is empty",
+		"CHUNKS_MISSING":                "Chunks are missing",
+		"CHUNK_TOO_SMALL":               "Chunk is too small",
+		"UPLOAD_ABORTED":                "Upload was aborted",
+		"UPLOAD_TOO_SLOW":               "Upload is too slow",
+		"ASSET_NOT_FOUND":               "Asset not found",
+		"VIDEO_STILL_PROCESSING":        "Video is still processing",
+		"VIDEO_TOO_LONG":                "Video is too long",
+		"UNKNOWN_TIER":                  "Unknown tier",
+		"INVALID_AUDIO_LANGUAGE":        "Invalid audio language",
+		"AUDIO_LANGUAGE_MISSING":        "No audio track in that language",
+		"INVALID_PLAYBACK_RULE":         "Invalid playback rule",
+		"INVALID_PLAYBACK_RULE_ID":      "Invalid playback rule ID",
+		"PLAYBACK_RULE_NOT_FOUND":       "Playback rule not found",
+		"TOO_MANY_PLAYBACK_RULES":       "Too many playback rules",
+		"COUNTRY_RULES_UNAVAILABLE":     "Country rules need GEO_COUNTRY_HEADER",
+		"PLAYBACK_RESTRICTED":           "Playback isn't allowed from your location",
+		"INVALID_EMBED_DOMAIN":          "Invalid embed domain",
+		"TOO_MANY_EMBED_DOMAINS":        "Too many embed domains",
+		"EMBED_NOT_ALLOWED":             "Embedding isn't allowed on this site",
+		"OEMBED_FORMAT_UNSUPPORTED":     "Only the json oEmbed format is supported",
+		"INVALID_OEMBED_URL":            "Invalid oEmbed URL",
+		"INVALID_OEMBED_SIZE":           "Invalid oEmbed size",
+		"NO_VIDEOS_TO_ARCHIVE":          "No videos to archive",
+		"TOO_MANY_ARCHIVE_VIDEOS":       "Too many videos to archive",
+		"JOB_NOT_CANCELABLE":            "Only video processing and clip jobs can be canceled",
+		"JOB_FINISHED":                  "Job has already finished",
+		"IDEMPOTENCY_KEY_TOO_LONG":      "Idempotency-Key is too long",
+		"IDEMPOTENCY_KEY_IN_PROGRESS":   "A request with this Idempotency-Key is in progress",
+		"IDEMPOTENCY_KEY_REUSED":        "Idempotency-Key was already used for a different request",
+		"SCAN_FAILED":                   "Couldn't scan file",
+		"FILE_INFECTED":                 "File failed malware scan",
+		"INVALID_MODERATION_STATUS":     "Status must be approved or rejected",
+		"MODERATION_REASON_REQUIRED":    "A reason is required to reject a video",
+		"MODERATION_REASON_TOO_LONG":    "Reason is too long",
+		"SHUTTING_DOWN":                 "Server is shutting down",
+		"RESET_DEV_ONLY":                "Reset is only allowed in dev environment",
+		"INSUFFICIENT_STORAGE":          "Not enough disk space to process this upload",
+		"DISK_CHECK_FAILED":             "Couldn't check disk space",
+		"PROCESSING_FAILED":             "Video processing failed",
+		"STATUS_QUEUED":                 "Queued",
+		"STATUS_RUNNING":                "Processing",
+		"STATUS_COMPLETED":              "Ready",
+		"STATUS_FAILED":                 "Failed",
+		"STATUS_DEAD_LETTERED":          "Needs attention",
+		"STATUS_CANCELED":               "Canceled",
+	},
+	"es": {
+		"AUTH_TOKEN_MISSING":            "No se encontró el token de acceso",
+		"AUTH_TOKEN_INVALID":            "Token de acceso no válido",
+		"AUTH_TOKEN_UNVERIFIED":         "No se pudo validar el token de acceso",
+		"AUTH_REFRESH_MISSING":          "No se encontró el token",
+		"AUTH_REFRESH_INVALID":          "Token de actualización no válido",
+		"AUTH_BAD_CREDENTIALS":          "Correo electrónico o contraseña incorrectos",
+		"AUTH_ADMIN_REQUIRED":           "Se requiere acceso de administrador",
+		"FORBIDDEN":                     "Acceso no autorizado",
+		"FORBIDDEN_DELETE":              "No puedes eliminar este video",
+		"INVALID_ID":                    "ID no válido",
+		"INVALID_VIDEO_ID":              "ID de video no válido",
+		"INVALID_JOB_ID":                "ID de tarea no válido",
+		"INVALID_USER_ID":               "ID de usuario no válido",
+		"INVALID_BODY":                  "No se pudieron leer los parámetros",
+		"INVALID_FORM":                  "Error al procesar el formulario",
+		"INVALID_CONTENT_TYPE":          "Content-Type no válido",
+		"INVALID_LIMIT":                 "Límite no válido",
+		"INVALID_TIMESTAMP":             "Marca de tiempo no válida",
+		"INVALID_START":                 "Marca de tiempo inicial no válida",
+		"INVALID_END":                   "Marca de tiempo final no válida",
+		"RANGE_END_BEFORE_START":        "El final debe ser posterior al inicio",
+		"RANGE_END_PAST_VIDEO":          "El final supera la duración del video",
+		"TIMESTAMP_PAST_VIDEO":          "La marca de tiempo supera la duración del video",
+		"CREDENTIALS_REQUIRED":          "Se requieren correo electrónico y contraseña",
+		"VIDEO_NOT_FOUND":               "Video no encontrado",
+		"VIDEO_NOT_IN_TRASH":            "El video no está en la papelera",
+		"INVALID_VERSION":               "Versión no válida",
+		"VERSION_NOT_FOUND":             "Versión no encontrada",
+		"USER_NOT_FOUND":                "Usuario no encontrado",
+		"INVALID_EXPORT_FORMAT":         "El formato debe ser zip o manifest",
+		"JOB_NOT_FOUND":                 "Tarea no encontrada",
+		"VIDEO_FILE_MISSING":            "Falta el archivo de video",
+		"TOO_MANY_FILES":                "Demasiados archivos",
+		"INVALID_MANIFEST":              "Manifiesto no válido",
+		"MANIFEST_MISMATCH":             "El manifiesto debe tener una entrada por video",
+		"THUMBNAIL_FILE_MISSING":        "Falta el archivo de miniatura",
+		"FILE_TOO_LARGE":                "El archivo es demasiado grande",
+		"UNSUPPORTED_VIDEO_TYPE":        "Solo se permiten videos MP4",
+		"UNSUPPORTED_IMAGE_TYPE":        "Solo se permiten imágenes JPEG y PNG",
+		"UNSUPPORTED_CLIP_FORMAT":       "El formato debe ser mp4, gif o webp",
+		"VIDEO_NOT_UPLOADED":            "El video no tiene ningún archivo subido",
+		"INVALID_RENDITION":             "La versión debe ser stream, preview o sdr",
+		"RANGE_NOT_SATISFIABLE":         "El rango solicitado no es válido",
+		"STREAM_FAILED":                 "No se pudo transmitir el video",
+		"INVALID_CHECKSUM":              "Encabezado de suma de verificación no válido",
+		"CHECKSUM_MISMATCH":             "La suma de verificación no coincide",
+		"IMPORT_SOURCE_REQUIRED":        "Se requieren el bucket y la clave de origen",
+		"IMPORT_CREDENTIALS_INCOMPLETE": "Las credenciales necesitan un ID de clave de acceso y una clave de acceso secreta",
+		"IMPORT_SOURCE_UNREADABLE":      "No se pudo leer el objeto de origen",
+		"IMPORT_NOT_VIDEO":              "El objeto de origen no es un video",
+		"DIRECT_UPLOADS_DISABLED":       "Las subidas directas no están habilitadas",
+		"UNKNOWN_PROCESSING_PROFILE":    "Perfil de procesamiento desconocido",
+		"THUMBNAIL_CROP_REQUIRED":       "Indica un recorte o un punto focal",
+		"INVALID_CROP":                  "Recorte no válido",
+		"INVALID_FOCAL_POINT":           "Punto focal no válido",
+		"INVALID_ASPECT_RATIO":          "Relación de aspecto no válida",
+		"THUMBNAIL_MISSING":             "El video no tiene miniatura",
+		"INVALID_SESSION_ID":            "ID de sesión no válido",
+		"INVALID_PLAYBACK_POSITION":     "Posición de reproducción no válida",
+		"INVALID_MONTH":                 "Mes no válido",
+		"INVALID_EGRESS_CAP":            "Límite de transferencia no válido",
+		"EGRESS_CAP_REACHED":            "Se alcanzó el límite mensual de transferencia",
+		"CLOUDFRONT_LOGS_DISABLED":      "La importación de registros de CloudFront no está activada",
+		"INVALID_FILENAME":              "Nombre de archivo no válido",
+		"DOWNLOADS_DISABLED":            "Las descargas están desactivadas para este video",
+		"INVALID_PLAYLIST_ID":           "ID de lista de reproducción no válido",
+		"PLAYLIST_NOT_FOUND":            "Lista de reproducción no encontrada",
+		"TITLE_REQUIRED":                "El título es obligatorio",
+		"INVALID_VISIBILITY":            "Visibilidad no válida",
+		"INVALID_POSITION":              "Posición no válida",
+		"PLAYLIST_FOREIGN_VIDEO":        "Solo puedes añadir tus propios videos",
+		"PLAYLIST_DUPLICATE_VIDEO":      "El video ya está en la lista de reproducción",
+		"PLAYLIST_VIDEO_MISSING":        "El video no está en la lista de reproducción",
+		"INVALID_PLAYLIST_ORDER":        "El orden debe incluir cada video de la lista una vez",
+		"INVALID_COMMENT_ID":            "ID de comentario no válido",
+		"COMMENT_NOT_FOUND":             "Comentario no encontrado",
+		"PARENT_COMMENT_NOT_FOUND":      "Comentario principal no encontrado",
+		"COMMENT_BODY_REQUIRED":         "El comentario no puede estar vacío",
+		"COMMENT_TOO_LONG":              "El comentario es demasiado largo",
+		"INVALID_CURSOR":                "Cursor no válido",
+		"FORBIDDEN_DELETE_COMMENT":      "No puedes eliminar este comentario",
+		"SEARCH_QUERY_REQUIRED":         "La consulta de búsqueda es obligatoria",
+		"SEARCH_QUERY_TOO_LONG":         "La consulta de búsqueda es demasiado larga",
+		"INVALID_OFFSET":                "Desplazamiento no válido",
+		"INVALID_ORG_ID":                "ID de organización no válido",
+		"ORG_NOT_FOUND":                 "Organización no encontrada",
+		"ORG_NAME_REQUIRED":             "El nombre de la organización es obligatorio",
+		"INVALID_ORG_ROLE":              "Rol no válido",
+		"ORG_MEMBER_EXISTS":             "El usuario ya es miembro",
+		"ORG_MEMBER_NOT_FOUND":          "Miembro no encontrado",
+		"LAST_ORG_OWNER":                "Una organización necesita al menos un propietario",
+		"ORG_OWNER_REQUIRED":            "Se requiere ser propietario de la organización",
+		"FORBIDDEN_ORG_UPLOAD":          "No puedes subir videos a esta organización",
+		"INVALID_TRANSFER_ID":           "ID de transferencia no válido",
+		"TRANSFER_NOT_FOUND":            "Transferencia no encontrada",
+		"TRANSFER_RECIPIENT_REQUIRED":   "Indica to_email o to_org_id",
+		"TRANSFER_TO_OWNER":             "El video ya pertenece al destinatario",
+		"TRANSFER_PENDING":              "El video ya tiene una transferencia pendiente",
+		"TRANSFER_NOT_PENDING":          "La transferencia ya no está pendiente",
+		"INVALID_WINDOW":                "Ventana de tiempo no válida",
+		"JOB_NOT_DEAD_LETTERED":         "El trabajo no está en la cola de mensajes fallidos",
+		"UNSUPPORTED_LANGUAGE":          "Idioma no admitido",
+		"INVALID_EVENT_ID":              "ID de evento no válido",
+		"INVALID_UPLOAD_ID":             "ID de subida no válido",
+		"UPLOAD_NOT_FOUND":              "Subida no encontrada",
+		"INVALID_CHUNK_NUMBER":          "Número de fragmento no válido",
+		"UPLOAD_COMPLETED":              "La subida ya está completada",
+		"CHUNK_TOO_LARGE":               "El fragmento es demasiado grande",
+		"CHUNK_UNREADABLE":              "No se pudo leer el fragmento",
+		"CHUNK_EMPTY":                   "El fragmento está vacío",
+		"CHUNKS_MISSING":                "Faltan fragmentos",
+		"CHUNK_TOO_SMALL":               "El fragmento es demasiado pequeño",
+		"UPLOAD_ABORTED":                "La subida fue cancelada",
+		"UPLOAD_TOO_SLOW":               "La subida es demasiado lenta",
+		"ASSET_NOT_FOUND":               "Recurso no encontrado",
+		"VIDEO_STILL_PROCESSING":        "El video aún se está procesando",
+		"VIDEO_TOO_LONG":                "El video es demasiado largo",
+		"UNKNOWN_TIER":                  "Nivel desconocido",
+		"INVALID_AUDIO_LANGUAGE":        "Idioma de audio no válido",
+		"AUDIO_LANGUAGE_MISSING":        "No hay pista de audio en ese idioma",
+		"INVALID_PLAYBACK_RULE":         "Regla de reproducción no válida",
+		"INVALID_PLAYBACK_RULE_ID":      "ID de regla de reproducción no válido",
+		"PLAYBACK_RULE_NOT_FOUND":       "Regla de reproducción no encontrada",
+		"TOO_MANY_PLAYBACK_RULES":       "Demasiadas reglas de reproducción",
+		"COUNTRY_RULES_UNAVAILABLE":     "Las reglas por país requieren GEO_COUNTRY_HEADER",
+		"PLAYBACK_RESTRICTED":           "La reproducción no está permitida desde tu ubicación",
+		"INVALID_EMBED_DOMAIN":          "Dominio de inserción no válido",
+		"TOO_MANY_EMBED_DOMAINS":        "Demasiados dominios de inserción",
+		"EMBED_NOT_ALLOWED":             "No se permite insertar el video en este sitio",
+		"OEMBED_FORMAT_UNSUPPORTED":     "Solo se admite el formato json de oEmbed",
+		"INVALID_OEMBED_URL":            "URL de oEmbed no válida",
+		"INVALID_OEMBED_SIZE":           "Tamaño de oEmbed no válido",
+		"NO_VIDEOS_TO_ARCHIVE":          "No hay vídeos que archivar",
+		"TOO_MANY_ARCHIVE_VIDEOS":       "Demasiados vídeos para archivar",
+		"JOB_NOT_CANCELABLE":            "Solo se pueden cancelar los trabajos de procesamiento de video y de clips",
+		"JOB_FINISHED":                  "El trabajo ya terminó",
+		"IDEMPOTENCY_KEY_TOO_LONG":      "Idempotency-Key es demasiado largo",
+		"IDEMPOTENCY_KEY_IN_PROGRESS":   "Ya hay una solicitud en curso con este Idempotency-Key",
+		"IDEMPOTENCY_KEY_REUSED":        "Este Idempotency-Key ya se usó para otra solicitud",
+		"SCAN_FAILED":                   "No se pudo analizar el archivo",
+		"FILE_INFECTED":                 "El archivo no superó el análisis de malware",
+		"INVALID_MODERATION_STATUS":     "El estado debe ser approved o rejected",
+		"MODERATION_REASON_REQUIRED":    "Se requiere un motivo para rechazar un video",
+		"MODERATION_REASON_TOO_LONG":    "El motivo es demasiado largo",
+		"SHUTTING_DOWN":                 "El servidor se está apagando",
+		"RESET_DEV_ONLY":                "El restablecimiento solo está permitido en desarrollo",
+		"INSUFFICIENT_STORAGE":          "No hay suficiente espacio en disco para procesar esta subida",
+		"DISK_CHECK_FAILED":             "No se pudo comprobar el espacio en disco",
+		"PROCESSING_FAILED":             "Falló el procesamiento del video",
+		"STATUS_QUEUED":                 "En cola",
+		"STATUS_RUNNING":                "Procesando",
+		"STATUS_COMPLETED":              "Listo",
+		"STATUS_FAILED":                 "Fallido",
+		"STATUS_DEAD_LETTERED":          "Requiere atención",
+		"STATUS_CANCELED":               "Cancelado",
+	},
+	"fr": {
+		"AUTH_TOKEN_MISSING":            "Jeton d'accès introuvable",
+		"AUTH_TOKEN_INVALID":            "Jeton d'accès invalide",
+		"AUTH_TOKEN_UNVERIFIED":         "Impossible de valider le jeton d'accès",
+		"AUTH_REFRESH_MISSING":          "Jeton introuvable",
+		"AUTH_REFRESH_INVALID":          "Jeton de rafraîchissement invalide",
+		"AUTH_BAD_CREDENTIALS":          "E-mail ou mot de passe incorrect",
+		"AUTH_ADMIN_REQUIRED":           "Accès administrateur requis",
+		"FORBIDDEN":                     "Accès non autorisé",
+		"FORBIDDEN_DELETE":              "Vous ne pouvez pas supprimer cette vidéo",
+		"INVALID_ID":                    "Identifiant invalide",
+		"INVALID_VIDEO_ID":              "Identifiant de vidéo invalide",
+		"INVALID_JOB_ID":                "Identifiant de tâche invalide",
+		"INVALID_USER_ID":               "Identifiant d'utilisateur invalide",
+		"INVALID_BODY":                  "Impossible de lire les paramètres",
+		"INVALID_FORM":                  "Erreur lors de la lecture du formulaire",
+		"INVALID_CONTENT_TYPE":          "Content-Type invalide",
+		"INVALID_LIMIT":                 "Limite invalide",
+		"INVALID_TIMESTAMP":             "Horodatage invalide",
+		"INVALID_START":                 "Horodatage de début invalide",
+		"INVALID_END":                   "Horodatage de fin invalide",
+		"RANGE_END_BEFORE_START":        "La fin doit être après le début",
+		"RANGE_END_PAST_VIDEO":          "La fin dépasse la durée de la vidéo",
+		"TIMESTAMP_PAST_VIDEO":          "L'horodatage dépasse la durée de la vidéo",
+		"CREDENTIALS_REQUIRED":          "L'e-mail et le mot de passe sont requis",
+		"VIDEO_NOT_FOUND":               "Vidéo introuvable",
+		"VIDEO_NOT_IN_TRASH":            "La vidéo n'est pas dans la corbeille",
+		"INVALID_VERSION":               "Version invalide",
+		"VERSION_NOT_FOUND":             "Version introuvable",
+		"USER_NOT_FOUND":                "Utilisateur introuvable",
+		"INVALID_EXPORT_FORMAT":         "Le format doit être zip ou manifest",
+		"JOB_NOT_FOUND":                 "Tâche introuvable",
+		"VIDEO_FILE_MISSING":            "Fichier vidéo manquant",
+		"TOO_MANY_FILES":                "Trop de fichiers",
+		"INVALID_MANIFEST":              "Manifeste invalide",
+		"MANIFEST_MISMATCH":             "Le manifeste doit contenir une entrée par vidéo",
+		"THUMBNAIL_FILE_MISSING":        "Fichier de miniature manquant",
+		"FILE_TOO_LARGE":                "Le fichier est trop volumineux",
+		"UNSUPPORTED_VIDEO_TYPE":        "Seules les vidéos MP4 sont acceptées",
+		"UNSUPPORTED_IMAGE_TYPE":        "Seules les images JPEG et PNG sont acceptées",
+		"UNSUPPORTED_CLIP_FORMAT":       "Le format doit être mp4, gif ou webp",
+		"VIDEO_NOT_UPLOADED":            "Aucun fichier n'a été envoyé pour cette vidéo",
+		"INVALID_RENDITION":             "Le rendu doit être stream, preview ou sdr",
+		"RANGE_NOT_SATISFIABLE":         "La plage demandée est invalide",
+		"STREAM_FAILED":                 "Impossible de diffuser la vidéo",
+		"INVALID_CHECKSUM":              "En-tête de somme de contrôle invalide",
+		"CHECKSUM_MISMATCH":             "La somme de contrôle ne correspond pas",
+		"IMPORT_SOURCE_REQUIRED":        "Le bucket et la clé source sont requis",
+		"IMPORT_CREDENTIALS_INCOMPLETE": "Les identifiants doivent comporter un ID de clé d'accès et une clé d'accès secrète",
+		"IMPORT_SOURCE_UNREADABLE":      "Impossible de lire l'objet source",
+		"IMPORT_NOT_VIDEO":              "L'objet source n'est pas une vidéo",
+		"DIRECT_UPLOADS_DISABLED":       "Les envois directs ne sont pas activés",
+		"UNKNOWN_PROCESSING_PROFILE":    "Profil de traitement inconnu",
+		"THUMBNAIL_CROP_REQUIRED":       "Indiquez un recadrage ou un point focal",
+		"INVALID_CROP":                  "Recadrage invalide",
+		"INVALID_FOCAL_POINT":           "Point focal invalide",
+		"INVALID_ASPECT_RATIO":          "Format d'image invalide",
+		"THUMBNAIL_MISSING":             "La vidéo n'a pas de miniature",
+		"INVALID_SESSION_ID":            "ID de session invalide",
+		"INVALID_PLAYBACK_POSITION":     "Position de lecture invalide",
+		"INVALID_MONTH":                 "Mois invalide",
+		"INVALID_EGRESS_CAP":            "Limite de transfert invalide",
+		"EGRESS_CAP_REACHED":            "Limite mensuelle de transfert atteinte",
+		"CLOUDFRONT_LOGS_DISABLED":      "L'import des journaux CloudFront n'est pas activé",
+		"INVALID_FILENAME":              "Nom de fichier invalide",
+		"DOWNLOADS_DISABLED":            "Les téléchargements sont désactivés pour cette vidéo",
+		"INVALID_PLAYLIST_ID":           "ID de playlist invalide",
+		"PLAYLIST_NOT_FOUND":            "Playlist introuvable",
+		"TITLE_REQUIRED":                "Le titre est obligatoire",
+		"INVALID_VISIBILITY":            "Visibilité invalide",
+		"INVALID_POSITION":              "Position invalide",
+		"PLAYLIST_FOREIGN_VIDEO":        "Vous ne pouvez ajouter que vos propres vidéos",
+		"PLAYLIST_DUPLICATE_VIDEO":      "La vidéo est déjà dans la playlist",
+		"PLAYLIST_VIDEO_MISSING":        "La vidéo n'est pas dans la playlist",
+		"INVALID_PLAYLIST_ORDER":        "L'ordre doit contenir chaque vidéo de la playlist une fois",
+		"INVALID_COMMENT_ID":            "ID de commentaire invalide",
+		"COMMENT_NOT_FOUND":             "Commentaire introuvable",
+		"PARENT_COMMENT_NOT_FOUND":      "Commentaire parent introuvable",
+		"COMMENT_BODY_REQUIRED":         "Le commentaire ne peut pas être vide",
+		"COMMENT_TOO_LONG":              "Le commentaire est trop long",
+		"INVALID_CURSOR":                "Curseur invalide",
+		"FORBIDDEN_DELETE_COMMENT":      "Vous ne pouvez pas supprimer ce commentaire",
+		"SEARCH_QUERY_REQUIRED":         "La requête de recherche est obligatoire",
+		"SEARCH_QUERY_TOO_LONG":         "La requête de recherche est trop longue",
+		"INVALID_OFFSET":                "Décalage invalide",
+		"INVALID_ORG_ID":                "ID d'organisation invalide",
+		"ORG_NOT_FOUND":                 "Organisation introuvable",
+		"ORG_NAME_REQUIRED":             "Le nom de l'organisation est obligatoire",
+		"INVALID_ORG_ROLE":              "Rôle invalide",
+		"ORG_MEMBER_EXISTS":             "L'utilisateur est déjà membre",
+		"ORG_MEMBER_NOT_FOUND":          "Membre introuvable",
+		"LAST_ORG_OWNER":                "Une organisation doit avoir au moins un propriétaire",
+		"ORG_OWNER_REQUIRED":            "Accès propriétaire de l'organisation requis",
+		"FORBIDDEN_ORG_UPLOAD":          "Vous ne pouvez pas publier dans cette organisation",
+		"INVALID_TRANSFER_ID":           "ID de transfert invalide",
+		"TRANSFER_NOT_FOUND":            "Transfert introuvable",
+		"TRANSFER_RECIPIENT_REQUIRED":   "Indiquez to_email ou to_org_id",
+		"TRANSFER_TO_OWNER":             "La vidéo appartient déjà au destinataire",
+		"TRANSFER_PENDING":              "La vidéo a déjà un transfert en attente",
+		"TRANSFER_NOT_PENDING":          "Le transfert n'est plus en attente",
+		"INVALID_WINDOW":                "Fenêtre de temps invalide",
+		"JOB_NOT_DEAD_LETTERED":         "La tâche n'est pas dans la file des échecs",
+		"UNSUPPORTED_LANGUAGE":          "Langue non prise en charge",
+		"INVALID_EVENT_ID":              "ID d'événement invalide",
+		"INVALID_UPLOAD_ID":             "Identifiant d'envoi invalide",
+		"UPLOAD_NOT_FOUND":              "Envoi introuvable",
+		"INVALID_CHUNK_NUMBER":          "Numéro de morceau invalide",
+		"UPLOAD_COMPLETED":              "L'envoi est déjà terminé",
+		"CHUNK_TOO_LARGE":               "Le morceau est trop volumineux",
+		"CHUNK_UNREADABLE":              "Impossible de lire le morceau",
+		"CHUNK_EMPTY":                   "Le morceau est vide",
+		"CHUNKS_MISSING":                "Des morceaux sont manquants",
+		"CHUNK_TOO_SMALL":               "Le morceau est trop petit",
+		"UPLOAD_ABORTED":                "L'envoi a été annulé",
+		"UPLOAD_TOO_SLOW":               "L'envoi est trop lent",
+		"ASSET_NOT_FOUND":               "Ressource introuvable",
+		"VIDEO_STILL_PROCESSING":        "La vidéo est encore en cours de traitement",
+		"VIDEO_TOO_LONG":                "La vidéo est trop longue",
+		"UNKNOWN_TIER":                  "Niveau inconnu",
+		"INVALID_AUDIO_LANGUAGE":        "Langue audio invalide",
+		"AUDIO_LANGUAGE_MISSING":        "Aucune piste audio dans cette langue",
+		"INVALID_PLAYBACK_RULE":         "Règle de lecture invalide",
+		"INVALID_PLAYBACK_RULE_ID":      "ID de règle de lecture invalide",
+		"PLAYBACK_RULE_NOT_FOUND":       "Règle de lecture introuvable",
+		"TOO_MANY_PLAYBACK_RULES":       "Trop de règles de lecture",
+		"COUNTRY_RULES_UNAVAILABLE":     "Les règles par pays nécessitent GEO_COUNTRY_HEADER",
+		"PLAYBACK_RESTRICTED":           "La lecture n'est pas autorisée depuis votre emplacement",
+		"INVALID_EMBED_DOMAIN":          "Domaine d'intégration invalide",
+		"TOO_MANY_EMBED_DOMAINS":        "Trop de domaines d'intégration",
+		"EMBED_NOT_ALLOWED":             "L'intégration n'est pas autorisée sur ce site",
+		"OEMBED_FORMAT_UNSUPPORTED":     "Seul le format json d'oEmbed est pris en charge",
+		"INVALID_OEMBED_URL":            "URL oEmbed invalide",
+		"INVALID_OEMBED_SIZE":           "Taille oEmbed invalide",
+		"NO_VIDEOS_TO_ARCHIVE":          "Aucune vidéo à archiver",
+		"TOO_MANY_ARCHIVE_VIDEOS":       "Trop de vidéos à archiver",
+		"JOB_NOT_CANCELABLE":            "Seules les tâches de traitement vidéo et d'extraits peuvent être annulées",
+		"JOB_FINISHED":                  "La tâche est déjà terminée",
+		"IDEMPOTENCY_KEY_TOO_LONG":      "Idempotency-Key est trop long",
+		"IDEMPOTENCY_KEY_IN_PROGRESS":   "Une requête avec cet Idempotency-Key est en cours",
+		"IDEMPOTENCY_KEY_REUSED":        "Cet Idempotency-Key a déjà été utilisé pour une autre requête",
+		"SCAN_FAILED":                   "Impossible d'analyser le fichier",
+		"FILE_INFECTED":                 "Le fichier a échoué à l'analyse antivirus",
+		"INVALID_MODERATION_STATUS":     "Le statut doit être approved ou rejected",
+		"MODERATION_REASON_REQUIRED":    "Un motif est requis pour rejeter une vidéo",
+		"MODERATION_REASON_TOO_LONG":    "Le motif est trop long",
+		"SHUTTING_DOWN":                 "Le serveur est en cours d'arrêt",
+		"RESET_DEV_ONLY":                "La réinitialisation n'est autorisée qu'en développement",
+		"INSUFFICIENT_STORAGE":          "Espace disque insuffisant pour traiter cet envoi",
+		"DISK_CHECK_FAILED":             "Impossible de vérifier l'espace disque",
+		"PROCESSING_FAILED":             "Le traitement de la vidéo a échoué",
+		"STATUS_QUEUED":                 "En attente",
+		"STATUS_RUNNING":                "En cours de traitement",
+		"STATUS_COMPLETED":              "Prêt",
+		"STATUS_FAILED":                 "Échec",
+		"STATUS_DEAD_LETTERED":          "Nécessite une intervention",
+		"STATUS_CANCELED":               "Annulé",
+	},
+	"de": {
+		"AUTH_TOKEN_MISSING":            "Zugriffstoken nicht gefunden",
+		"AUTH_TOKEN_INVALID":            "Ungültiges Zugriffstoken",
+		"AUTH_TOKEN_UNVERIFIED":         "Zugriffstoken konnte nicht überprüft werden",
+		"AUTH_REFRESH_MISSING":          "Token nicht gefunden",
+		"AUTH_REFRESH_INVALID":          "Ungültiges Aktualisierungstoken",
+		"AUTH_BAD_CREDENTIALS":          "E-Mail oder Passwort falsch",
+		"AUTH_ADMIN_REQUIRED":           "Administratorzugriff erforderlich",
+		"FORBIDDEN":                     "Zugriff verweigert",
+		"FORBIDDEN_DELETE":              "Du kannst dieses Video nicht löschen",
+		"INVALID_ID":                    "Ungültige ID",
+		"INVALID_VIDEO_ID":              "Ungültige Video-ID",
+		"INVALID_JOB_ID":                "Ungültige Auftrags-ID",
+		"INVALID_USER_ID":               "Ungültige Benutzer-ID",
+		"INVALID_BODY":                  "Parameter konnten nicht gelesen werden",
+		"INVALID_FORM":                  "Fehler beim Lesen des Formulars",
+		"INVALID_CONTENT_TYPE":          "Ungültiger Content-Type",
+		"INVALID_LIMIT":                 "Ungültiges Limit",
+		"INVALID_TIMESTAMP":             "Ungültiger Zeitstempel",
+		"INVALID_START":                 "Ungültiger Startzeitpunkt",
+		"INVALID_END":                   "Ungültiger Endzeitpunkt",
+		"RANGE_END_BEFORE_START":        "Das Ende muss nach dem Start liegen",
+		"RANGE_END_PAST_VIDEO":          "Das Ende liegt hinter dem Ende des Videos",
+		"TIMESTAMP_PAST_VIDEO":          "Der Zeitstempel liegt hinter dem Ende des Videos",
+		"CREDENTIALS_REQUIRED":          "E-Mail und Passwort sind erforderlich",
+		"VIDEO_NOT_FOUND":               "Video nicht gefunden",
+		"VIDEO_NOT_IN_TRASH":            "Video ist nicht im Papierkorb",
+		"INVALID_VERSION":               "Ungültige Version",
+		"VERSION_NOT_FOUND":             "Version nicht gefunden",
+		"USER_NOT_FOUND":                "Benutzer nicht gefunden",
+		"INVALID_EXPORT_FORMAT":         "Das Format muss zip oder manifest sein",
+		"JOB_NOT_FOUND":                 "Auftrag nicht gefunden",
+		"VIDEO_FILE_MISSING":            "Videodatei fehlt",
+		"TOO_MANY_FILES":                "Zu viele Dateien",
+		"INVALID_MANIFEST":              "Ungültiges Manifest",
+		"MANIFEST_MISMATCH":             "Das Manifest muss einen Eintrag pro Video enthalten",
+		"THUMBNAIL_FILE_MISSING":        "Vorschaubild fehlt",
+		"FILE_TOO_LARGE":                "Die Datei ist zu groß",
+		"UNSUPPORTED_VIDEO_TYPE":        "Nur MP4-Videos sind erlaubt",
+		"UNSUPPORTED_IMAGE_TYPE":        "Nur JPEG- und PNG-Bilder sind erlaubt",
+		"UNSUPPORTED_CLIP_FORMAT":       "Das Format muss mp4, gif oder webp sein",
+		"VIDEO_NOT_UPLOADED":            "Für dieses Video wurde keine Datei hochgeladen",
+		"INVALID_RENDITION":             "Die Variante muss stream, preview oder sdr sein",
+		"RANGE_NOT_SATISFIABLE":         "Der angeforderte Bereich ist ungültig",
+		"STREAM_FAILED":                 "Video konnte nicht gestreamt werden",
+		"INVALID_CHECKSUM":              "Ungültiger Prüfsummen-Header",
+		"CHECKSUM_MISMATCH":             "Prüfsumme stimmt nicht überein",
+		"IMPORT_SOURCE_REQUIRED":        "Quell-Bucket und Schlüssel sind erforderlich",
+		"IMPORT_CREDENTIALS_INCOMPLETE": "Die Zugangsdaten benötigen eine Zugriffsschlüssel-ID und einen geheimen Zugriffsschlüssel",
+		"IMPORT_SOURCE_UNREADABLE":      "Quellobjekt konnte nicht gelesen werden",
+		"IMPORT_NOT_VIDEO":              "Das Quellobjekt ist kein Video",
+		"DIRECT_UPLOADS_DISABLED":       "Direkte Uploads sind nicht aktiviert",
+		"UNKNOWN_PROCESSING_PROFILE":    "Unbekanntes Verarbeitungsprofil",
+		"THUMBNAIL_CROP_REQUIRED":       "Gib entweder einen Zuschnitt oder einen Fokuspunkt an",
+		"INVALID_CROP":                  "Ungültiger Zuschnitt",
+		"INVALID_FOCAL_POINT":           "Ungültiger Fokuspunkt",
+		"INVALID_ASPECT_RATIO":          "Ungültiges Seitenverhältnis",
+		"THUMBNAIL_MISSING":             "Das Video hat kein Vorschaubild",
+		"INVALID_SESSION_ID":            "Ungültige Sitzungs-ID",
+		"INVALID_PLAYBACK_POSITION":     "Ungültige Wiedergabeposition",
+		"INVALID_MONTH":                 "Ungültiger Monat",
+		"INVALID_EGRESS_CAP":            "Ungültiges Transferlimit",
+		"EGRESS_CAP_REACHED":            "Monatliches Transferlimit erreicht",
+		"CLOUDFRONT_LOGS_DISABLED":      "Der Import von CloudFront-Logs ist nicht aktiviert",
+		"INVALID_FILENAME":              "Ungültiger Dateiname",
+		"DOWNLOADS_DISABLED":            "Downloads sind für dieses Video deaktiviert",
+		"INVALID_PLAYLIST_ID":           "Ungültige Playlist-ID",
+		"PLAYLIST_NOT_FOUND":            "Playlist nicht gefunden",
+		"TITLE_REQUIRED":                "Ein Titel ist erforderlich",
+		"INVALID_VISIBILITY":            "Ungültige Sichtbarkeit",
+		"INVALID_POSITION":              "Ungültige Position",
+		"PLAYLIST_FOREIGN_VIDEO":        "Du kannst nur deine eigenen Videos hinzufügen",
+		"PLAYLIST_DUPLICATE_VIDEO":      "Das Video ist bereits in der Playlist",
+		"PLAYLIST_VIDEO_MISSING":        "Das Video ist nicht in der Playlist",
+		"INVALID_PLAYLIST_ORDER":        "Die Reihenfolge muss jedes Video der Playlist genau einmal enthalten",
+		"INVALID_COMMENT_ID":            "Ungültige Kommentar-ID",
+		"COMMENT_NOT_FOUND":             "Kommentar nicht gefunden",
+		"PARENT_COMMENT_NOT_FOUND":      "Übergeordneter Kommentar nicht gefunden",
+		"COMMENT_BODY_REQUIRED":         "Der Kommentar darf nicht leer sein",
+		"COMMENT_TOO_LONG":              "Der Kommentar ist zu lang",
+		"INVALID_CURSOR":                "Ungültiger Cursor",
+		"FORBIDDEN_DELETE_COMMENT":      "Du kannst diesen Kommentar nicht löschen",
+		"SEARCH_QUERY_REQUIRED":         "Eine Suchanfrage ist erforderlich",
+		"SEARCH_QUERY_TOO_LONG":         "Die Suchanfrage ist zu lang",
+		"INVALID_OFFSET":                "Ungültiger Offset",
+		"INVALID_ORG_ID":                "Ungültige Organisations-ID",
+		"ORG_NOT_FOUND":                 "Organisation nicht gefunden",
+		"ORG_NAME_REQUIRED":             "Ein Organisationsname ist erforderlich",
+		"INVALID_ORG_ROLE":              "Ungültige Rolle",
+		"ORG_MEMBER_EXISTS":             "Der Benutzer ist bereits Mitglied",
+		"ORG_MEMBER_NOT_FOUND":          "Mitglied nicht gefunden",
+		"LAST_ORG_OWNER":                "Eine Organisation braucht mindestens einen Eigentümer",
+		"ORG_OWNER_REQUIRED":            "Eigentümerzugriff auf die Organisation erforderlich",
+		"FORBIDDEN_ORG_UPLOAD":          "Du kannst nicht in diese Organisation hochladen",
+		"INVALID_TRANSFER_ID":           "Ungültige Übertragungs-ID",
+		"TRANSFER_NOT_FOUND":            "Übertragung nicht gefunden",
+		"TRANSFER_RECIPIENT_REQUIRED":   "Gib entweder to_email oder to_org_id an",
+		"TRANSFER_TO_OWNER":             "Das Video gehört bereits dem Empfänger",
+		"TRANSFER_PENDING":              "Für das Video steht bereits eine Übertragung aus",
+		"TRANSFER_NOT_PENDING":          "Die Übertragung steht nicht mehr aus",
+		"INVALID_WINDOW":                "Ungültiges Zeitfenster",
+		"JOB_NOT_DEAD_LETTERED":         "Der Auftrag wartet nicht auf einen Eingriff",
+		"UNSUPPORTED_LANGUAGE":          "Nicht unterstützte Sprache",
+		"INVALID_EVENT_ID":              "Ungültige Ereignis-ID",
+		"INVALID_UPLOAD_ID":             "Ungültige Upload-ID",
+		"UPLOAD_NOT_FOUND":              "Upload nicht gefunden",
+		"INVALID_CHUNK_NUMBER":          "Ungültige Teilnummer",
+		"UPLOAD_COMPLETED":              "Der Upload ist bereits abgeschlossen",
+		"CHUNK_TOO_LARGE":               "Der Teil ist zu groß",
+		"CHUNK_UNREADABLE":              "Der Teil konnte nicht gelesen werden",
+		"CHUNK_EMPTY":                   "Der Teil ist leer",
+		"CHUNKS_MISSING":                "Es fehlen Teile",
+		"CHUNK_TOO_SMALL":               "Der Teil ist zu klein",
+		"UPLOAD_ABORTED":                "Der Upload wurde abgebrochen",
+		"UPLOAD_TOO_SLOW":               "Der Upload ist zu langsam",
+		"ASSET_NOT_FOUND":               "Asset nicht gefunden",
+		"VIDEO_STILL_PROCESSING":        "Das Video wird noch verarbeitet",
+		"VIDEO_TOO_LONG":                "Das Video ist zu lang",
+		"UNKNOWN_TIER":                  "Unbekannte Stufe",
+		"INVALID_AUDIO_LANGUAGE":        "Ungültige Audiosprache",
+		"AUDIO_LANGUAGE_MISSING":        "Keine Audiospur in dieser Sprache",
+		"INVALID_PLAYBACK_RULE":         "Ungültige Wiedergaberegel",
+		"INVALID_PLAYBACK_RULE_ID":      "Ungültige Wiedergaberegel-ID",
+		"PLAYBACK_RULE_NOT_FOUND":       "Wiedergaberegel nicht gefunden",
+		"TOO_MANY_PLAYBACK_RULES":       "Zu viele Wiedergaberegeln",
+		"COUNTRY_RULES_UNAVAILABLE":     "Länderregeln erfordern GEO_COUNTRY_HEADER",
+		"PLAYBACK_RESTRICTED":           "Die Wiedergabe ist von deinem Standort aus nicht erlaubt",
+		"INVALID_EMBED_DOMAIN":          "Ungültige Einbettungsdomain",
+		"TOO_MANY_EMBED_DOMAINS":        "Zu viele Einbettungsdomains",
+		"EMBED_NOT_ALLOWED":             "Das Einbetten ist auf dieser Website nicht erlaubt",
+		"OEMBED_FORMAT_UNSUPPORTED":     "Nur das oEmbed-Format json wird unterstützt",
+		"INVALID_OEMBED_URL":            "Ungültige oEmbed-URL",
+		"INVALID_OEMBED_SIZE":           "Ungültige oEmbed-Größe",
+		"NO_VIDEOS_TO_ARCHIVE":          "Keine Videos zum Archivieren",
+		"TOO_MANY_ARCHIVE_VIDEOS":       "Zu viele Videos zum Archivieren",
+		"JOB_NOT_CANCELABLE":            "Nur Videoverarbeitungs- und Clip-Aufträge können abgebrochen werden",
+		"JOB_FINISHED":                  "Der Auftrag ist bereits abgeschlossen",
+		"IDEMPOTENCY_KEY_TOO_LONG":      "Idempotency-Key ist zu lang",
+		"IDEMPOTENCY_KEY_IN_PROGRESS":   "Eine Anfrage mit diesem Idempotency-Key läuft bereits",
+		"IDEMPOTENCY_KEY_REUSED":        "Dieser Idempotency-Key wurde bereits für eine andere Anfrage verwendet",
+		"SCAN_FAILED":                   "Datei konnte nicht geprüft werden",
+		"FILE_INFECTED":                 "Datei hat die Malware-Prüfung nicht bestanden",
+		"INVALID_MODERATION_STATUS":     "Status muss approved oder rejected sein",
+		"MODERATION_REASON_REQUIRED":    "Zum Ablehnen eines Videos ist eine Begründung erforderlich",
+		"MODERATION_REASON_TOO_LONG":    "Die Begründung ist zu lang",
+		"SHUTTING_DOWN":                 "Der Server wird heruntergefahren",
+		"RESET_DEV_ONLY":                "Zurücksetzen ist nur in der Entwicklungsumgebung erlaubt",
+		"INSUFFICIENT_STORAGE":          "Nicht genügend Speicherplatz, um diesen Upload zu verarbeiten",
+		"DISK_CHECK_FAILED":             "Speicherplatz konnte nicht geprüft werden",
+		"PROCESSING_FAILED":             "Die Videoverarbeitung ist fehlgeschlagen",
+		"STATUS_QUEUED":                 "In der Warteschlange",
+		"STATUS_RUNNING":                "Wird verarbeitet",
+		"STATUS_COMPLETED":              "Fertig",
+		"STATUS_FAILED":                 "Fehlgeschlagen",
+		"STATUS_DEAD_LETTERED":          "Erfordert Eingriff",
+		"STATUS_CANCELED":               "Abgebrochen",
+	},
+}
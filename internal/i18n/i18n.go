@@ -0,0 +1,115 @@
+// Package i18n translates user-facing messages, keyed by a stable message
+// code, and negotiates the response language from Accept-Language.
+package i18n
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is used when nothing in Accept-Language is supported, and
+// for any message missing from another language's catalog.
+const DefaultLanguage = "en"
+
+type contextKey struct{}
+
+// codesByEnglish lets callers that only have the English text find its code.
+var codesByEnglish = func() map[string]string {
+	m := make(map[string]string, len(catalogs[DefaultLanguage]))
+	for code, text := range catalogs[DefaultLanguage] {
+		m[text] = code
+	}
+	return m
+}()
+
+// Text returns the message for code in lang, falling back to English. ok is
+// false if the code is unknown.
+func Text(lang, code string) (text string, ok bool) {
+	if text, ok := catalogs[lang][code]; ok {
+		return text, true
+	}
+	text, ok = catalogs[DefaultLanguage][code]
+	return text, ok
+}
+
+// Supported reports whether lang has a catalog.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// CodeForMessage returns the code of an English catalog message.
+func CodeForMessage(english string) (string, bool) {
+	code, ok := codesByEnglish[english]
+	return code, ok
+}
+
+// Translate returns the lang version of an English catalog message, or the
+// message unchanged if it isn't in the catalog.
+func Translate(lang, english string) string {
+	code, ok := CodeForMessage(english)
+	if !ok {
+		return english
+	}
+	text, _ := Text(lang, code)
+	return text
+}
+
+// Negotiate picks the best supported language from an Accept-Language
+// header value, honoring q-values and matching "es-MX" to "es".
+func Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{tag, q})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, c := range candidates {
+		if c.lang == "*" {
+			return DefaultLanguage
+		}
+		if _, ok := catalogs[c.lang]; ok {
+			return c.lang
+		}
+		base, _, _ := strings.Cut(c.lang, "-")
+		if _, ok := catalogs[base]; ok {
+			return base
+		}
+	}
+	return DefaultLanguage
+}
+
+// WithLanguage stores the negotiated language on a request context.
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, contextKey{}, lang)
+}
+
+// FromContext returns the language stored by WithLanguage, or the default.
+func FromContext(ctx context.Context) string {
+	if lang, ok := ctx.Value(contextKey{}).(string); ok {
+		return lang
+	}
+	return DefaultLanguage
+}
@@ -0,0 +1,181 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Supported VIDEO_ENCODER values
+const (
+	EncoderCPU          = "cpu"
+	EncoderNVENC        = "nvenc"
+	EncoderVAAPI        = "vaapi"
+	EncoderVideoToolbox = "videotoolbox"
+	EncoderAuto         = "auto"
+)
+
+const defaultVAAPIDevice = "/dev/dri/renderD128"
+
+// autoEncoderOrder is the order hardware encoders are tried in with
+// EncoderAuto.
+var autoEncoderOrder = []string{EncoderNVENC, EncoderVAAPI, EncoderVideoToolbox}
+
+// Encoder is the H.264 encoder used wherever video is re-encoded (trims,
+// MP4 clips and previews).
+type Encoder struct {
+	Kind   string `json:"kind"`
+	Codec  string `json:"codec"`
+	Device string `json:"device,omitempty"`
+}
+
+// CPUEncoder is libx264, which every ffmpeg build the pipeline supports has.
+var CPUEncoder = Encoder{Kind: EncoderCPU, Codec: "libx264"}
+
+// inputArgs are the flags that have to come before the first -i.
+func (e Encoder) inputArgs() []string {
+	if e.Kind == EncoderVAAPI {
+		return []string{"-vaapi_device", e.Device}
+	}
+	return nil
+}
+
+// filter appends the upload to GPU memory VAAPI needs to the end of the
+// filter chain vf, which may be empty.
+func (e Encoder) filter(vf string) string {
+	if e.Kind != EncoderVAAPI {
+		return vf
+	}
+	if vf == "" {
+		return "format=nv12,hwupload"
+	}
+	return vf + ",format=nv12,hwupload"
+}
+
+// filterArgs returns the -vf flag for vf, or nothing if there is no filter.
+func (e Encoder) filterArgs(vf string) []string {
+	if vf = e.filter(vf); vf == "" {
+		return nil
+	}
+	return []string{"-vf", vf}
+}
+
+// codecArgs selects the encoder at a quality roughly equivalent to x264's
+// crf; lower is better.
+func (e Encoder) codecArgs(crf int) []string {
+	switch e.Kind {
+	case EncoderNVENC:
+		return []string{"-c:v", e.Codec, "-preset", "p4", "-rc", "vbr", "-cq", strconv.Itoa(crf), "-b:v", "0"}
+	case EncoderVAAPI:
+		return []string{"-c:v", e.Codec, "-qp", strconv.Itoa(crf)}
+	case EncoderVideoToolbox:
+		// VideoToolbox's -q:v runs from 1 to 100 with higher being better
+		return []string{"-c:v", e.Codec, "-q:v", strconv.Itoa(max(1, 100-2*crf))}
+	default:
+		return []string{"-c:v", e.Codec, "-preset", "veryfast", "-crf", strconv.Itoa(crf)}
+	}
+}
+
+// NewEncoder returns the encoder of a kind other than EncoderAuto, without
+// checking that it works.
+func NewEncoder(kind, vaapiDevice string) (Encoder, error) {
+	switch kind {
+	case EncoderCPU:
+		return CPUEncoder, nil
+	case EncoderNVENC:
+		return Encoder{Kind: kind, Codec: "h264_nvenc"}, nil
+	case EncoderVAAPI:
+		if vaapiDevice == "" {
+			vaapiDevice = defaultVAAPIDevice
+		}
+		return Encoder{Kind: kind, Codec: "h264_vaapi", Device: vaapiDevice}, nil
+	case EncoderVideoToolbox:
+		return Encoder{Kind: kind, Codec: "h264_videotoolbox"}, nil
+	default:
+		return Encoder{}, fmt.Errorf("unknown video encoder %q", kind)
+	}
+}
+
+// DetectEncoder resolves VIDEO_ENCODER to an encoder that actually works
+// on this host. A hardware encoder that fails its test encode falls back to
+// the CPU rather than failing every upload later.
+func (f *FFmpeg) DetectEncoder(ctx context.Context, kind, vaapiDevice string) (Encoder, error) {
+	switch kind {
+	case "", EncoderCPU:
+		return CPUEncoder, nil
+	case EncoderAuto:
+		for _, candidate := range autoEncoderOrder {
+			enc, _ := NewEncoder(candidate, vaapiDevice)
+			if err := f.probeEncoder(ctx, enc); err != nil {
+				slog.Debug("Hardware encoder unavailable", "encoder", enc.Codec, "error", err)
+				continue
+			}
+			return enc, nil
+		}
+		return CPUEncoder, nil
+	}
+
+	enc, err := NewEncoder(kind, vaapiDevice)
+	if err != nil {
+		return Encoder{}, err
+	}
+	if err := f.probeEncoder(ctx, enc); err != nil {
+		slog.Warn("Hardware encoder unavailable, falling back to CPU", "encoder", enc.Codec, "error", err)
+		return CPUEncoder, nil
+	}
+	return enc, nil
+}
+
+// probeEncoder encodes a single synthetic frame, which catches both ffmpeg
+// builds without the encoder and hosts without the hardware.
+func (f *FFmpeg) probeEncoder(ctx context.Context, enc Encoder) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	args := append(enc.inputArgs(),
+		"-hide_banner",
+		"-f", "lavfi",
+		"-i", "color=black:size=256x256:duration=0.1")
+	args = append(args, enc.filterArgs("")...)
+	args = append(args, enc.codecArgs(23)...)
+	args = append(args, "-frames:v", "1", "-f", "null", "-")
+
+	cmd := f.ffmpegCommand(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// runEncode runs the ffmpeg command build returns for the configured
+// encoder, retrying once on the CPU if a hardware encode fails, e.g.
+// because the GPU ran out of sessions or rejected the input format.
+func (f *FFmpeg) runEncode(ctx context.Context, op string, build func(enc Encoder) []string) error {
+	enc := f.Tools.VideoEncoder
+	err := f.runFFmpeg(ctx, op, build(enc)...)
+	if err == nil || enc.Kind == EncoderCPU || ctx.Err() != nil {
+		return err
+	}
+	slog.WarnContext(ctx, "Hardware encode failed, retrying on CPU", "op", op, "encoder", enc.Codec, "error", err)
+	return f.runFFmpeg(ctx, op, build(CPUEncoder)...)
+}
+
+// runEncodeKeepingColor is runEncode for re-encodes whose output replaces
+// input, passing build the flags that keep an HDR input's color. Only
+// libx264 encodes 10 bit H.264 on every platform, so HDR input is always
+// encoded on the CPU.
+func (f *FFmpeg) runEncodeKeepingColor(ctx context.Context, op, input string, build func(enc Encoder, color []string) []string) error {
+	stream, err := f.videoStream(ctx, "ffprobe dynamic range", input)
+	if err != nil {
+		return err
+	}
+	if stream.dynamicRange() == DynamicRangeSDR {
+		return f.runEncode(ctx, op, func(enc Encoder) []string { return build(enc, nil) })
+	}
+	return f.runFFmpeg(ctx, op, build(CPUEncoder, stream.hdrArgs())...)
+}
@@ -0,0 +1,353 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+const previewDuration = 6.0
+
+const (
+	// posterScanDuration is how much of the start of a video is searched
+	// for a representative poster frame
+	posterScanDuration = 60.0
+	// posterScanFPS is how many frames per second of it are compared
+	posterScanFPS = 2
+	// posterMinLuma is the average brightness (0-255) a candidate needs,
+	// which rules out black frames and fades
+	posterMinLuma = 28
+)
+
+var ptsTimeRe = regexp.MustCompile(`pts_time:(\S+)`)
+
+// FFmpeg is the Prober and Transcoder that runs the ffmpeg and ffprobe
+// binaries.
+type FFmpeg struct {
+	Tools Tools
+	// Acquire, if set, is called before every ffmpeg run and blocks until
+	// the run may start. It returns the func that ends the run's turn.
+	Acquire func(ctx context.Context) (release func(), err error)
+	// RunCommand, if set, runs every ffmpeg and ffprobe command instead of
+	// cmd.Run, e.g. to trace it. op names the operation, like
+	// "ffmpeg poster".
+	RunCommand func(ctx context.Context, op string, cmd *exec.Cmd) error
+}
+
+var (
+	_ Prober     = (*FFmpeg)(nil)
+	_ Transcoder = (*FFmpeg)(nil)
+)
+
+// ffmpegCommand builds an ffmpeg invocation with the configured binary and
+// global flags.
+func (f *FFmpeg) ffmpegCommand(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, f.Tools.FFmpeg.Path, append(slices.Clone(f.Tools.FFmpeg.Args), args...)...)
+}
+
+// ffprobeCommand builds an ffprobe invocation with the configured binary.
+func (f *FFmpeg) ffprobeCommand(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, f.Tools.FFprobe.Path, args...)
+}
+
+func (f *FFmpeg) run(ctx context.Context, op string, cmd *exec.Cmd) error {
+	if f.RunCommand != nil {
+		return f.RunCommand(ctx, op, cmd)
+	}
+	return cmd.Run()
+}
+
+// runFFmpeg runs ffmpeg with args once Acquire lets it and includes its
+// stderr in the error.
+func (f *FFmpeg) runFFmpeg(ctx context.Context, op string, args ...string) error {
+	return f.runFFmpegTo(ctx, op, nil, args...)
+}
+
+// runFFmpegTo is runFFmpeg for commands that write their output to stdout.
+func (f *FFmpeg) runFFmpegTo(ctx context.Context, op string, stdout io.Writer, args ...string) error {
+	_, err := f.runFFmpegLog(ctx, op, stdout, args...)
+	return err
+}
+
+// runFFmpegLog is runFFmpegTo that also returns the stderr of a successful
+// run, where filters like loudnorm print what they measured.
+func (f *FFmpeg) runFFmpegLog(ctx context.Context, op string, stdout io.Writer, args ...string) ([]byte, error) {
+	if f.Acquire != nil {
+		release, err := f.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	cmd := f.ffmpegCommand(ctx, args...)
+	cmd.Stdout = stdout
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := f.run(ctx, op, cmd); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w\nStderr: %s", err, stderr.String())
+	}
+	return stderr.Bytes(), nil
+}
+
+func (f *FFmpeg) FastStart(ctx context.Context, input, metadataPath, output string, defaultAudio int) error {
+	args := append(remuxArgs(input, metadataPath, defaultAudio),
+		"-movflags", "faststart", // Move metadata to beginning
+		"-f", "mp4", // Force MP4 format
+		output, // Output file
+	)
+	return f.runFFmpeg(ctx, "ffmpeg faststart", args...)
+}
+
+func (f *FFmpeg) StreamFastStart(ctx context.Context, input, metadataPath string, defaultAudio int, w io.Writer) error {
+	args := append(remuxArgs(input, metadataPath, defaultAudio),
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4",
+		"pipe:1",
+	)
+	return f.runFFmpegTo(ctx, "ffmpeg faststart stream", w, args...)
+}
+
+func (f *FFmpeg) Normalize(ctx context.Context, input, metadataPath, output string, limits Limits, defaultAudio int) error {
+	return f.runEncodeKeepingColor(ctx, "ffmpeg normalize", input, func(enc Encoder, color []string) []string {
+		args := append(enc.inputArgs(), "-i", input)
+		if metadataPath != "" {
+			args = append(args,
+				"-i", metadataPath,
+				"-map_metadata", "1",
+				"-map_chapters", "1",
+			)
+		}
+		args = append(args, streamMapArgs(defaultAudio)...)
+		args = append(args, normalizeVideoArgs(enc, color, limits)...)
+		return append(args,
+			// ffmpeg rotates decoded frames itself, so the output must not
+			// tell players to turn them again
+			"-metadata:s:v:0", "rotate=0",
+			"-c:a", "copy",
+			"-movflags", "faststart",
+			"-f", "mp4",
+			"-y", output)
+	})
+}
+
+// normalizeVideoArgs are Normalize's video filter and codec flags, which
+// ChooseQuality's samples are encoded with too.
+func normalizeVideoArgs(enc Encoder, color []string, limits Limits) []string {
+	vf := ""
+	if limits.MaxResolution > 0 {
+		// Scale down whichever side is shorter, keeping the other even
+		n := strconv.Itoa(limits.MaxResolution)
+		vf = "scale='if(gte(iw,ih),-2,min(" + n + ",iw))':'if(gte(iw,ih),min(" + n + ",ih),-2)'"
+	}
+	crf := limits.CRF
+	if crf == 0 {
+		crf = 20
+	}
+	args := enc.filterArgs(vf)
+	args = append(args, enc.codecArgs(crf)...)
+	args = append(args, color...)
+	if limits.MaxBitrate > 0 {
+		args = append(args,
+			"-maxrate", strconv.FormatInt(limits.MaxBitrate, 10),
+			"-bufsize", strconv.FormatInt(2*limits.MaxBitrate, 10),
+		)
+	}
+	return args
+}
+
+// remuxArgs are the input and codec flags shared by both remux variants.
+func remuxArgs(input, metadataPath string, defaultAudio int) []string {
+	args := []string{"-i", input} // Input file
+	if metadataPath != "" {
+		args = append(args,
+			"-i", metadataPath, // Chapter metadata
+			"-map_metadata", "1",
+			"-map_chapters", "1",
+		)
+	}
+	args = append(args, streamMapArgs(defaultAudio)...)
+	return append(args, "-c", "copy") // Copy codec without re-encoding
+}
+
+// streamMapArgs select the first video stream and every audio stream of
+// the first input, where ffmpeg on its own would keep one audio stream.
+// Unless defaultAudio is KeepDefaultAudio, that audio stream becomes the
+// only default one.
+func streamMapArgs(defaultAudio int) []string {
+	args := []string{"-map", "0:v:0", "-map", "0:a?"}
+	if defaultAudio != KeepDefaultAudio {
+		// The later, more specific flag wins for its stream
+		args = append(args,
+			"-disposition:a", "0",
+			"-disposition:a:"+strconv.Itoa(defaultAudio), "default")
+	}
+	return args
+}
+
+func (f *FFmpeg) Trim(ctx context.Context, input, output string, start, end float64, reencode bool) error {
+	if !reencode {
+		return f.runFFmpeg(ctx, "ffmpeg trim",
+			"-ss", formatSeconds(start),
+			"-i", input,
+			"-t", formatSeconds(end-start),
+			"-map", "0:v:0", "-map", "0:a?",
+			"-c", "copy", "-avoid_negative_ts", "make_zero",
+			"-movflags", "faststart",
+			"-f", "mp4",
+			"-y", output)
+	}
+
+	return f.runEncodeKeepingColor(ctx, "ffmpeg trim", input, func(enc Encoder, color []string) []string {
+		args := append(enc.inputArgs(),
+			"-ss", formatSeconds(start),
+			"-i", input,
+			"-t", formatSeconds(end-start))
+		args = append(args, enc.filterArgs("")...)
+		args = append(args, streamMapArgs(KeepDefaultAudio)...)
+		args = append(args, enc.codecArgs(20)...)
+		args = append(args, color...)
+		return append(args,
+			"-c:a", "aac",
+			"-movflags", "faststart",
+			"-f", "mp4",
+			"-y", output)
+	})
+}
+
+func (f *FFmpeg) Clip(ctx context.Context, input, output, format string, start, end float64) error {
+	if format == "mp4" {
+		return f.runEncode(ctx, "ffmpeg clip", func(enc Encoder) []string {
+			args := append(enc.inputArgs(),
+				"-ss", formatSeconds(start),
+				"-t", formatSeconds(end-start),
+				"-i", input)
+			args = append(args, enc.filterArgs("scale=-2:'min(720,ih)'")...)
+			args = append(args, enc.codecArgs(23)...)
+			return append(args,
+				"-c:a", "aac",
+				"-movflags", "faststart",
+				"-f", "mp4",
+				"-y", output)
+		})
+	}
+
+	args := []string{
+		"-ss", formatSeconds(start),
+		"-t", formatSeconds(end - start),
+		"-i", input,
+	}
+	switch format {
+	case "gif":
+		args = append(args,
+			"-vf", "fps=12,scale=480:-1:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+			"-loop", "0",
+			"-f", "gif")
+	case "webp":
+		args = append(args,
+			"-vf", "fps=12,scale=480:-1:flags=lanczos",
+			"-c:v", "libwebp", "-quality", "70",
+			"-loop", "0",
+			"-an",
+			"-f", "webp")
+	default:
+		return fmt.Errorf("unsupported clip format %q", format)
+	}
+	args = append(args, "-y", output)
+
+	return f.runFFmpeg(ctx, "ffmpeg clip", args...)
+}
+
+func (f *FFmpeg) Poster(ctx context.Context, input, output string, timestamp float64) error {
+	return f.runFFmpeg(ctx, "ffmpeg poster",
+		"-ss", formatSeconds(timestamp),
+		"-i", input,
+		"-frames:v", "1",
+		"-vf", "scale='min(1280,iw)':-2",
+		"-q:v", "3",
+		"-f", "image2",
+		"-y", output)
+}
+
+// FindPoster uses ffmpeg's thumbnail filter on a downscaled sample of the
+// first posterScanDuration seconds.
+func (f *FFmpeg) FindPoster(ctx context.Context, input string) (timestamp float64, ok bool, err error) {
+	// The print target is escaped twice, once as an option value and once
+	// inside the filtergraph
+	filter := fmt.Sprintf("fps=%d,scale=160:-2,signalstats,"+
+		"metadata=mode=select:key=lavfi.signalstats.YAVG:value=%d:function=greater,"+
+		`thumbnail=n=%d,metadata=mode=print:file=pipe\\:1`,
+		posterScanFPS, posterMinLuma, int(posterScanDuration)*posterScanFPS)
+
+	var stdout bytes.Buffer
+	err = f.runFFmpegTo(ctx, "ffmpeg poster scan", &stdout,
+		"-t", formatSeconds(posterScanDuration),
+		"-i", input,
+		"-vf", filter,
+		"-frames:v", "1",
+		"-an",
+		"-f", "null", "-")
+	if err != nil {
+		return 0, false, err
+	}
+
+	m := ptsTimeRe.FindSubmatch(stdout.Bytes())
+	if m == nil {
+		return 0, false, nil
+	}
+	timestamp, err = strconv.ParseFloat(string(m[1]), 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid frame time %q: %w", m[1], err)
+	}
+	return timestamp, true, nil
+}
+
+// tonemapFilter converts PQ or HLG to linear light, maps it down to SDR
+// with the Hable curve and converts the result to BT.709. zscale needs an
+// ffmpeg built with libzimg.
+const tonemapFilter = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709," +
+	"tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+func (f *FFmpeg) Tonemap(ctx context.Context, input, output string, defaultAudio int) error {
+	return f.runEncode(ctx, "ffmpeg tonemap", func(enc Encoder) []string {
+		args := append(enc.inputArgs(), "-i", input)
+		args = append(args, enc.filterArgs(tonemapFilter)...)
+		args = append(args, streamMapArgs(defaultAudio)...)
+		args = append(args, enc.codecArgs(20)...)
+		return append(args,
+			"-color_primaries", "bt709",
+			"-color_trc", "bt709",
+			"-colorspace", "bt709",
+			"-metadata:s:v:0", "rotate=0",
+			"-c:a", "copy",
+			"-movflags", "faststart",
+			"-f", "mp4",
+			"-y", output)
+	})
+}
+
+func (f *FFmpeg) Preview(ctx context.Context, input, output string) error {
+	return f.runEncode(ctx, "ffmpeg preview", func(enc Encoder) []string {
+		args := append(enc.inputArgs(),
+			"-t", formatSeconds(previewDuration),
+			"-i", input)
+		args = append(args, enc.filterArgs("scale=-2:'min(360,ih)'")...)
+		args = append(args, enc.codecArgs(28)...)
+		return append(args,
+			"-an",
+			"-movflags", "faststart",
+			"-f", "mp4",
+			"-y", output)
+	})
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
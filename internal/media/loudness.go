@@ -0,0 +1,96 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// loudnormMeasurement is what loudnorm prints after a measuring pass.
+type loudnormMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// silent reports whether the track had nothing loud enough to measure,
+// which loudnorm can't bring to a target.
+func (m loudnormMeasurement) silent() bool {
+	i, err := strconv.ParseFloat(m.InputI, 64)
+	return err != nil || math.IsInf(i, 0) || i < -70
+}
+
+// loudnormFilter is the loudnorm filter for target, applying the
+// measurement in its second pass if one is given.
+func loudnormFilter(target LoudnessTarget, measured *loudnormMeasurement) string {
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", target.Integrated, target.TruePeak, target.Range)
+	if measured == nil {
+		return filter + ":print_format=json"
+	}
+	return filter + fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true:print_format=none",
+		measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+}
+
+// measureLoudness runs loudnorm's first pass over one audio track.
+func (f *FFmpeg) measureLoudness(ctx context.Context, input string, track int, target LoudnessTarget) (loudnormMeasurement, error) {
+	stderr, err := f.runFFmpegLog(ctx, "ffmpeg loudness scan", nil,
+		"-hide_banner", "-nostats",
+		"-i", input,
+		"-map", "0:a:"+strconv.Itoa(track),
+		"-af", loudnormFilter(target, nil),
+		"-f", "null", "-")
+	if err != nil {
+		return loudnormMeasurement{}, err
+	}
+	// The JSON is the last thing loudnorm prints
+	start := bytes.LastIndexByte(stderr, '{')
+	end := bytes.LastIndexByte(stderr, '}')
+	if start < 0 || end < start {
+		return loudnormMeasurement{}, fmt.Errorf("no loudness measurement for audio track %d", track)
+	}
+	var measured loudnormMeasurement
+	if err := json.Unmarshal(stderr[start:end+1], &measured); err != nil {
+		return loudnormMeasurement{}, fmt.Errorf("invalid loudness measurement: %w", err)
+	}
+	return measured, nil
+}
+
+// NormalizeLoudness uses loudnorm in two passes: one measuring each track,
+// and a linear one applying the measurement, which keeps the dynamics
+// where the target allows. Silent tracks are copied as they are.
+func (f *FFmpeg) NormalizeLoudness(ctx context.Context, input, output string, target LoudnessTarget) error {
+	tracks, err := f.AudioTracks(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-i", input}
+	args = append(args, streamMapArgs(KeepDefaultAudio)...)
+	args = append(args, "-c", "copy")
+	for _, track := range tracks {
+		measured, err := f.measureLoudness(ctx, input, track.Index, target)
+		if err != nil {
+			return err
+		}
+		if measured.silent() {
+			continue
+		}
+		n := strconv.Itoa(track.Index)
+		// loudnorm resamples to 192 kHz internally
+		args = append(args,
+			"-filter:a:"+n, loudnormFilter(target, &measured),
+			"-c:a:"+n, "aac",
+			"-b:a:"+n, strconv.Itoa(64*max(track.Channels, 1))+"k",
+			"-ar:a:"+n, "48000")
+	}
+	args = append(args,
+		"-movflags", "faststart",
+		"-f", "mp4",
+		"-y", output)
+	return f.runFFmpeg(ctx, "ffmpeg loudness", args...)
+}
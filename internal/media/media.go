@@ -0,0 +1,140 @@
+// Package media inspects and transcodes videos. FFmpeg implements it with
+// the ffmpeg and ffprobe binaries; other backends only have to satisfy
+// Prober and Transcoder.
+package media
+
+import (
+	"context"
+	"io"
+)
+
+// Prober reads properties of a video. Inputs are file paths or URLs the
+// backend can fetch, such as presigned S3 URLs.
+type Prober interface {
+	// Duration is the container duration in seconds.
+	Duration(ctx context.Context, input string) (float64, error)
+	// Size is the width and height of the first video stream as it is
+	// displayed, swapped if its rotation metadata turns it a quarter.
+	Size(ctx context.Context, input string) (width, height int, err error)
+	// Rotation is how many degrees clockwise the first video stream's
+	// metadata tells players to turn it: 0, 90, 180 or 270.
+	Rotation(ctx context.Context, input string) (int, error)
+	// DynamicRange is DynamicRangeHDR10 or DynamicRangeHLG if the first
+	// video stream has that transfer function, otherwise DynamicRangeSDR.
+	DynamicRange(ctx context.Context, input string) (string, error)
+	// AudioTracks lists the audio streams in order, which may be none.
+	AudioTracks(ctx context.Context, input string) ([]AudioTrack, error)
+	// Bitrate is the bit rate of the first video stream in bits per
+	// second, or of the whole file if the container doesn't say. It is 0
+	// if neither is known.
+	Bitrate(ctx context.Context, input string) (int64, error)
+	// KeyframeAligned reports whether a keyframe falls on timestamp, so a
+	// stream copy can start there cleanly.
+	KeyframeAligned(ctx context.Context, input string, timestamp float64) (bool, error)
+}
+
+// Dynamic ranges a Prober reports
+const (
+	DynamicRangeSDR = "sdr"
+	// DynamicRangeHDR10 is the PQ transfer function (SMPTE ST 2084), which
+	// HDR10, HDR10+ and Dolby Vision profile 8 all use
+	DynamicRangeHDR10 = "hdr10"
+	// DynamicRangeHLG is hybrid log-gamma (ARIB STD-B67)
+	DynamicRangeHLG = "hlg"
+)
+
+// AudioTrack is one audio stream of a video.
+type AudioTrack struct {
+	// Index counts the audio streams from 0
+	Index int
+	// Language is the ISO 639-2 code the file tags it with, like "eng", or
+	// empty if it has none
+	Language string
+	Title    string
+	Codec    string
+	Channels int
+	// Default is the track players pick unless told otherwise
+	Default bool
+}
+
+// KeepDefaultAudio leaves the input's default audio track as it is.
+const KeepDefaultAudio = -1
+
+// LoudnessTarget is what NormalizeLoudness brings every audio track to.
+type LoudnessTarget struct {
+	// Integrated is the loudness in LUFS, -23 for EBU R128
+	Integrated float64
+	// TruePeak is the ceiling in dBTP
+	TruePeak float64
+	// Range is the loudness range in LU
+	Range float64
+}
+
+// Limits caps the video a Normalize writes. Zero fields don't limit.
+type Limits struct {
+	// MaxResolution is the most pixels the shorter side of the frame may
+	// have, like 1080 for 1080p in either orientation
+	MaxResolution int
+	// MaxBitrate is the peak video bit rate in bits per second
+	MaxBitrate int64
+	// CRF is the quality the video is encoded at, on x264's constant rate
+	// factor scale that the hardware encoders map to their own. 0 is the
+	// default of 20.
+	CRF int
+}
+
+// QualityTarget is what ChooseQuality searches for.
+type QualityTarget struct {
+	// VMAF is the lowest acceptable score against the source, from 0 to
+	// 100, with around 93 hard to tell apart from it
+	VMAF float64
+	// MinCRF and MaxCRF bound the search. MinCRF is also the answer when
+	// even it misses VMAF.
+	MinCRF, MaxCRF int
+}
+
+// Transcoder writes new files from a video. Outputs are local paths and are
+// overwritten.
+type Transcoder interface {
+	// FastStart remuxes input to an MP4 with the moov box first, without
+	// re-encoding. If metadataPath is set, chapters from that ffmetadata
+	// file are embedded. Every audio track is kept, and defaultAudio, the
+	// Index of one of them or KeepDefaultAudio, says which players pick.
+	FastStart(ctx context.Context, input, metadataPath, output string, defaultAudio int) error
+	// StreamFastStart is FastStart to a fragmented MP4 written to w, which
+	// never has to be seekable.
+	StreamFastStart(ctx context.Context, input, metadataPath string, defaultAudio int, w io.Writer) error
+	// Normalize is FastStart re-encoding the video upright, with any
+	// rotation metadata applied to the pixels, to fit limits. The audio is
+	// copied. HDR input stays HDR.
+	Normalize(ctx context.Context, input, metadataPath, output string, limits Limits, defaultAudio int) error
+	// Trim writes the [start, end) range of input as an MP4. It
+	// stream-copies unless reencode is set, which is needed when start
+	// isn't on a keyframe. A re-encode of HDR input stays HDR. Every audio
+	// track is kept.
+	Trim(ctx context.Context, input, output string, start, end float64, reencode bool) error
+	// Clip renders the [start, end) range of input scaled down for
+	// sharing, as "mp4", "gif" or "webp".
+	Clip(ctx context.Context, input, output, format string, start, end float64) error
+	// Poster grabs the frame at timestamp as a JPEG at most 1280 pixels
+	// wide.
+	Poster(ctx context.Context, input, output string, timestamp float64) error
+	// FindPoster picks the most representative frame that isn't nearly
+	// black from the start of the video. ok is false if none qualifies.
+	FindPoster(ctx context.Context, input string) (timestamp float64, ok bool, err error)
+	// NormalizeLoudness measures each audio track of input and writes it to
+	// output re-encoded as AAC at target, with everything else copied. The
+	// output is faststart.
+	NormalizeLoudness(ctx context.Context, input, output string, target LoudnessTarget) error
+	// ChooseQuality encodes samples from through input as Normalize
+	// would with limits and finds the highest CRF, so the smallest file,
+	// whose VMAF still reaches target, along with that score. input must be
+	// a local file.
+	ChooseQuality(ctx context.Context, input string, limits Limits, target QualityTarget) (crf int, vmaf float64, err error)
+	// Tonemap renders HDR input as an SDR MP4 in BT.709 for players and
+	// displays that can't show HDR. The audio is copied like FastStart's.
+	Tonemap(ctx context.Context, input, output string, defaultAudio int) error
+	// Preview renders a short, silent, low resolution MP4 teaser from the
+	// start of the video.
+	Preview(ctx context.Context, input, output string) error
+}
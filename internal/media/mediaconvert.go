@@ -0,0 +1,447 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const (
+	mediaConvertAPIVersion          = "2017-08-29"
+	defaultMediaConvertPollInterval = 5 * time.Second
+	// mediaConvertCleanupTimeout bounds the requests that clean up after a
+	// job, which still run when the caller has given up on it
+	mediaConvertCleanupTimeout = 10 * time.Second
+)
+
+// ObjectStore moves files between this host and the bucket MediaConvert
+// reads its inputs from and writes its outputs to.
+type ObjectStore interface {
+	Upload(ctx context.Context, key, path string) error
+	Download(ctx context.Context, key, path string) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Inspector reads the properties a job has to be built from.
+type Inspector interface {
+	Inspect(ctx context.Context, input string) (StreamInfo, error)
+}
+
+// MediaConvertConfig is the account side of MediaConvert jobs.
+type MediaConvertConfig struct {
+	// Endpoint defaults to the regional endpoint,
+	// https://mediaconvert.<region>.amazonaws.com
+	Endpoint string
+	Region   string
+	// Role is the ARN of the IAM role MediaConvert assumes to read and
+	// write Bucket
+	Role string
+	// Queue is the queue ARN jobs are submitted to; empty uses the
+	// account's default queue
+	Queue string
+	// Bucket and Prefix are where inputs are staged and outputs written.
+	// Everything under Prefix is scratch space that is deleted after
+	// each job.
+	Bucket       string
+	Prefix       string
+	PollInterval time.Duration
+	Credentials  aws.CredentialsProvider
+	HTTPClient   *http.Client
+}
+
+// MediaConvert is a Transcoder that runs the re-encoding operations
+// (previews, re-encoded trims and MP4 clips) as AWS Elemental MediaConvert
+// jobs and leaves everything else, such as remuxes and frame grabs, to the
+// embedded local Transcoder. Inputs that aren't local files, like the
+// presigned URLs of imports, are transcoded locally too, since MediaConvert
+// can only read them from the bucket.
+//
+// It calls the MediaConvert REST API directly with SigV4 signed requests
+// and polls each job until it finishes.
+type MediaConvert struct {
+	Transcoder
+	config    MediaConvertConfig
+	inspector Inspector
+	store     ObjectStore
+	signer    *v4.Signer
+}
+
+var _ Transcoder = (*MediaConvert)(nil)
+
+func NewMediaConvert(config MediaConvertConfig, local Transcoder, inspector Inspector, store ObjectStore) (*MediaConvert, error) {
+	if config.Role == "" {
+		return nil, errors.New("a role ARN is required")
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("a bucket is required")
+	}
+	if config.Region == "" {
+		return nil, errors.New("a region is required")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://mediaconvert.%s.amazonaws.com", config.Region)
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	if config.Prefix != "" && !strings.HasSuffix(config.Prefix, "/") {
+		config.Prefix += "/"
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultMediaConvertPollInterval
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &MediaConvert{
+		Transcoder: local,
+		config:     config,
+		inspector:  inspector,
+		store:      store,
+		signer:     v4.NewSigner(),
+	}, nil
+}
+
+func (m *MediaConvert) Preview(ctx context.Context, input, output string) error {
+	if !isLocalInput(input) {
+		return m.Transcoder.Preview(ctx, input, output)
+	}
+	return m.transcode(ctx, input, output, func(info StreamInfo) mcOutput {
+		return mcOutput{
+			clip:       &mcClip{end: min(previewDuration, info.Duration)},
+			maxHeight:  360,
+			quality:    5,
+			maxBitrate: 1_000_000,
+			dropAudio:  true,
+		}
+	})
+}
+
+func (m *MediaConvert) Trim(ctx context.Context, input, output string, start, end float64, reencode bool) error {
+	// Stream copies are a quick local remux, not worth a job
+	if !reencode || !isLocalInput(input) {
+		return m.Transcoder.Trim(ctx, input, output, start, end, reencode)
+	}
+	info, err := m.inspector.Inspect(ctx, input)
+	if err != nil {
+		return err
+	}
+	if info.DynamicRange != DynamicRangeSDR || info.AudioTracks > 1 {
+		// Jobs write 8 bit H.264 with one audio track, which would lose the
+		// HDR and other tracks a local trim keeps
+		return m.Transcoder.Trim(ctx, input, output, start, end, reencode)
+	}
+	return m.transcodeInspected(ctx, input, output, info, mcOutput{
+		clip:         &mcClip{start: start, end: min(end, info.Duration)},
+		quality:      9,
+		maxBitrate:   20_000_000,
+		audioBitrate: 192_000,
+	})
+}
+
+func (m *MediaConvert) Clip(ctx context.Context, input, output, format string, start, end float64) error {
+	// GIF and WebP aren't MediaConvert output formats
+	if format != "mp4" || !isLocalInput(input) {
+		return m.Transcoder.Clip(ctx, input, output, format, start, end)
+	}
+	return m.transcode(ctx, input, output, func(info StreamInfo) mcOutput {
+		return mcOutput{
+			clip:         &mcClip{start: start, end: min(end, info.Duration)},
+			maxHeight:    720,
+			quality:      7,
+			maxBitrate:   5_000_000,
+			audioBitrate: 128_000,
+		}
+	})
+}
+
+// isLocalInput reports whether input is a file path rather than a URL.
+func isLocalInput(input string) bool {
+	return !strings.Contains(input, "://")
+}
+
+// mcClip is the [start, end) range of the input a job encodes.
+type mcClip struct {
+	start, end float64
+}
+
+// mcOutput describes the single MP4 rendition a job writes.
+type mcOutput struct {
+	clip *mcClip
+	// maxHeight scales the video down to at most that many lines; 0 keeps
+	// the input's size
+	maxHeight int
+	// quality is the QVBR level from 1 to 10, higher being better
+	quality      int
+	maxBitrate   int
+	dropAudio    bool
+	audioBitrate int
+}
+
+// transcode stages input in the bucket, runs the job build describes for
+// it and downloads the result to output. Staged objects are deleted
+// whether or not the job succeeds.
+func (m *MediaConvert) transcode(ctx context.Context, input, output string, build func(info StreamInfo) mcOutput) error {
+	info, err := m.inspector.Inspect(ctx, input)
+	if err != nil {
+		return err
+	}
+	return m.transcodeInspected(ctx, input, output, info, build(info))
+}
+
+// transcodeInspected is transcode for an input already inspected.
+func (m *MediaConvert) transcodeInspected(ctx context.Context, input, output string, info StreamInfo, spec mcOutput) error {
+	token := make([]byte, 16)
+	rand.Read(token)
+	dir := m.config.Prefix + hex.EncodeToString(token) + "/"
+	inputKey := dir + "input" + strings.ToLower(filepath.Ext(input))
+	outputKey := dir + "output.mp4"
+	defer m.cleanup(inputKey, outputKey)
+
+	if err := m.store.Upload(ctx, inputKey, input); err != nil {
+		return fmt.Errorf("failed to stage input: %w", err)
+	}
+
+	job := m.jobRequest(m.s3URL(inputKey), m.s3URL(strings.TrimSuffix(outputKey, ".mp4")), info, spec)
+	if err := m.runJob(ctx, job); err != nil {
+		return err
+	}
+
+	if err := m.store.Download(ctx, outputKey, output); err != nil {
+		return fmt.Errorf("failed to fetch output: %w", err)
+	}
+	return nil
+}
+
+func (m *MediaConvert) s3URL(key string) string {
+	return "s3://" + m.config.Bucket + "/" + key
+}
+
+func (m *MediaConvert) cleanup(keys ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mediaConvertCleanupTimeout)
+	defer cancel()
+	for _, key := range keys {
+		if err := m.store.Delete(ctx, key); err != nil {
+			slog.Warn("Failed to delete MediaConvert scratch object", "key", key, "error", err)
+		}
+	}
+}
+
+// jobRequest builds the CreateJob body. The REST API's JSON uses
+// lowerCamelCase names, unlike the job JSON the console exports.
+func (m *MediaConvert) jobRequest(inputURL, destination string, info StreamInfo, spec mcOutput) map[string]any {
+	in := map[string]any{
+		"fileInput":      inputURL,
+		"timecodeSource": "ZEROBASED",
+		// Inspect reports the rotated size the outputs are scaled from
+		"videoSelector": map[string]any{"rotate": "AUTO"},
+	}
+	if info.HasAudio && !spec.dropAudio {
+		in["audioSelectors"] = map[string]any{
+			"Audio Selector 1": map[string]any{"defaultSelection": "DEFAULT"},
+		}
+	}
+	if spec.clip != nil {
+		clipping := map[string]any{"endTimecode": timecode(spec.clip.end, info.FrameRate)}
+		if spec.clip.start > 0 {
+			clipping["startTimecode"] = timecode(spec.clip.start, info.FrameRate)
+		}
+		in["inputClippings"] = []any{clipping}
+	}
+
+	video := map[string]any{
+		"codecSettings": map[string]any{
+			"codec": "H_264",
+			"h264Settings": map[string]any{
+				"rateControlMode":    "QVBR",
+				"qvbrSettings":       map[string]any{"qvbrQualityLevel": spec.quality},
+				"maxBitrate":         spec.maxBitrate,
+				"sceneChangeDetect":  "TRANSITION_DETECTION",
+				"codecProfile":       "HIGH",
+				"qualityTuningLevel": "SINGLE_PASS_HQ",
+			},
+		},
+	}
+	if spec.maxHeight > 0 && info.Height > spec.maxHeight {
+		// Both dimensions are set so the aspect ratio is kept; H.264 needs
+		// them even
+		video["height"] = spec.maxHeight
+		video["width"] = 2 * int(math.Round(float64(info.Width)*float64(spec.maxHeight)/float64(info.Height)/2))
+	}
+
+	out := map[string]any{
+		"extension": "mp4",
+		"containerSettings": map[string]any{
+			"container":   "MP4",
+			"mp4Settings": map[string]any{"moovPlacement": "PROGRESSIVE_DOWNLOAD"},
+		},
+		"videoDescription": video,
+	}
+	if in["audioSelectors"] != nil {
+		out["audioDescriptions"] = []any{map[string]any{
+			"audioSourceName": "Audio Selector 1",
+			"codecSettings": map[string]any{
+				"codec": "AAC",
+				"aacSettings": map[string]any{
+					"bitrate":    spec.audioBitrate,
+					"codingMode": "CODING_MODE_2_0",
+					"sampleRate": 48000,
+				},
+			},
+		}}
+	}
+
+	job := map[string]any{
+		"role": m.config.Role,
+		"settings": map[string]any{
+			"inputs": []any{in},
+			"outputGroups": []any{map[string]any{
+				"name": "File Group",
+				"outputGroupSettings": map[string]any{
+					"type":              "FILE_GROUP_SETTINGS",
+					"fileGroupSettings": map[string]any{"destination": destination},
+				},
+				"outputs": []any{out},
+			}},
+		},
+	}
+	if m.config.Queue != "" {
+		job["queue"] = m.config.Queue
+	}
+	return job
+}
+
+// timecode converts seconds to the zero based HH:MM:SS:FF timecode input
+// clippings are given in, rounding to the nearest frame. Fractional rates
+// such as 29.97 count frames at their nominal rate, without drop frames.
+func timecode(seconds, frameRate float64) string {
+	nominal := int(math.Round(frameRate))
+	frames := int(math.Round(seconds * frameRate))
+	ff := frames % nominal
+	total := frames / nominal
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", total/3600, total/60%60, total%60, ff)
+}
+
+type mcJob struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	ErrorCode    int    `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// runJob submits job and polls it until it completes. If ctx ends first,
+// the job is canceled so it stops billing.
+func (m *MediaConvert) runJob(ctx context.Context, job map[string]any) error {
+	var created struct {
+		Job mcJob `json:"job"`
+	}
+	if err := m.call(ctx, http.MethodPost, "/jobs", job, &created); err != nil {
+		return fmt.Errorf("failed to create MediaConvert job: %w", err)
+	}
+	id := created.Job.ID
+	slog.DebugContext(ctx, "Submitted MediaConvert job", "job", id)
+
+	ticker := time.NewTicker(m.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			m.cancelJob(id)
+			return ctx.Err()
+		}
+
+		var current struct {
+			Job mcJob `json:"job"`
+		}
+		if err := m.call(ctx, http.MethodGet, "/jobs/"+id, nil, &current); err != nil {
+			if ctx.Err() != nil {
+				m.cancelJob(id)
+				return ctx.Err()
+			}
+			// A failed poll doesn't mean the job failed; try again next tick
+			slog.WarnContext(ctx, "Failed to poll MediaConvert job", "job", id, "error", err)
+			continue
+		}
+		switch current.Job.Status {
+		case "COMPLETE":
+			return nil
+		case "ERROR":
+			return fmt.Errorf("MediaConvert job %s failed with code %d: %s", id, current.Job.ErrorCode, current.Job.ErrorMessage)
+		case "CANCELED":
+			return fmt.Errorf("MediaConvert job %s was canceled", id)
+		}
+	}
+}
+
+func (m *MediaConvert) cancelJob(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mediaConvertCleanupTimeout)
+	defer cancel()
+	if err := m.call(ctx, http.MethodDelete, "/jobs/"+id, nil, nil); err != nil {
+		slog.Warn("Failed to cancel MediaConvert job", "job", id, "error", err)
+	}
+}
+
+// call sends a signed request to the MediaConvert API and decodes the
+// JSON reply into out, if set.
+func (m *MediaConvert) call(ctx context.Context, method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	url := m.config.Endpoint + "/" + mediaConvertAPIVersion + path
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	creds, err := m.config.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get AWS credentials: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	if err := m.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "mediaconvert", m.config.Region, time.Now()); err != nil {
+		return fmt.Errorf("couldn't sign request: %w", err)
+	}
+
+	resp, err := m.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(reply, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, reply)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("couldn't decode %s %s reply: %w", method, path, err)
+	}
+	return nil
+}
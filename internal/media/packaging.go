@@ -0,0 +1,22 @@
+package media
+
+import "context"
+
+// Packager is the last step before the stream rendition is uploaded: it
+// may rewrite the processed MP4, for instance to encrypt it, before it is
+// stored in its place. It only produces a single file, so segmented output
+// such as DASH or HLS manifests can't be expressed through it.
+type Packager interface {
+	// Package writes the packaged rendition and returns its path, which
+	// is input itself if there was nothing to do. Any other file is the
+	// caller's to remove. contentID identifies the video.
+	Package(ctx context.Context, contentID, input string) (string, error)
+}
+
+// Passthrough is the default Packager. It stores the processed MP4 as it
+// is.
+type Passthrough struct{}
+
+func (Passthrough) Package(_ context.Context, _, input string) (string, error) {
+	return input, nil
+}
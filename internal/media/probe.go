@@ -0,0 +1,341 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// keyframeTolerance is how close (in seconds) a cut point must be to a
+// keyframe for a stream copy to start cleanly.
+const keyframeTolerance = 0.05
+
+type ffprobeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []ffprobeStream `json:"streams"`
+}
+
+type ffprobeStream struct {
+	CodecType  string `json:"codec_type"`
+	CodecName  string `json:"codec_name"`
+	Channels   int    `json:"channels"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	RFrameRate string `json:"r_frame_rate"`
+	BitRate    string `json:"bit_rate"`
+	// Color describes the transfer function that tells HDR from SDR
+	ColorTransfer  string `json:"color_transfer"`
+	ColorPrimaries string `json:"color_primaries"`
+	ColorSpace     string `json:"color_space"`
+	// Older ffmpeg reports rotation as a tag, newer as a display matrix
+	Tags struct {
+		Rotate   string `json:"rotate"`
+		Language string `json:"language"`
+		Title    string `json:"title"`
+	} `json:"tags"`
+	Disposition struct {
+		Default int `json:"default"`
+	} `json:"disposition"`
+	SideDataList []struct {
+		SideDataType string  `json:"side_data_type"`
+		Rotation     float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// rotation is how far players turn the stream clockwise: 0, 90, 180 or
+// 270 degrees.
+func (s ffprobeStream) rotation() int {
+	var clockwise float64
+	found := false
+	for _, side := range s.SideDataList {
+		if side.SideDataType == "Display Matrix" {
+			// The matrix's angle is counterclockwise
+			clockwise, found = -side.Rotation, true
+			break
+		}
+	}
+	if !found && s.Tags.Rotate != "" {
+		clockwise, _ = strconv.ParseFloat(s.Tags.Rotate, 64)
+	}
+	quarter := int(math.Round(clockwise/90)) % 4
+	if quarter < 0 {
+		quarter += 4
+	}
+	return quarter * 90
+}
+
+// displaySize is the stream's size as players show it, which a quarter
+// turn swaps.
+func (s ffprobeStream) displaySize() (width, height int) {
+	if s.rotation()%180 != 0 {
+		return s.Height, s.Width
+	}
+	return s.Width, s.Height
+}
+
+// dynamicRange tells HDR10 and HLG streams, by their transfer function,
+// from SDR ones.
+func (s ffprobeStream) dynamicRange() string {
+	switch s.ColorTransfer {
+	case "smpte2084":
+		return DynamicRangeHDR10
+	case "arib-std-b67":
+		return DynamicRangeHLG
+	default:
+		return DynamicRangeSDR
+	}
+}
+
+// hdrArgs keep an HDR stream's color through a re-encode: 10 bit H.264
+// tagged with the stream's primaries, transfer and matrix, BT.2020 where
+// it doesn't say.
+func (s ffprobeStream) hdrArgs() []string {
+	primaries, matrix := s.ColorPrimaries, s.ColorSpace
+	if primaries == "" || primaries == "unknown" {
+		primaries = "bt2020"
+	}
+	if matrix == "" || matrix == "unknown" {
+		matrix = "bt2020nc"
+	}
+	return []string{
+		"-pix_fmt", "yuv420p10le",
+		"-profile:v", "high10",
+		"-color_primaries", primaries,
+		"-color_trc", s.ColorTransfer,
+		"-colorspace", matrix,
+	}
+}
+
+// probe runs ffprobe with args and decodes its JSON output.
+func (f *FFmpeg) probe(ctx context.Context, op string, args ...string) (ffprobeOutput, error) {
+	cmd := f.ffprobeCommand(ctx, append([]string{"-v", "error", "-print_format", "json"}, args...)...)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := f.run(ctx, op, cmd); err != nil {
+		return ffprobeOutput{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var output ffprobeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return ffprobeOutput{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	return output, nil
+}
+
+func (f *FFmpeg) Duration(ctx context.Context, input string) (float64, error) {
+	output, err := f.probe(ctx, "ffprobe duration", "-show_format", input)
+	if err != nil {
+		return 0, err
+	}
+	duration, err := strconv.ParseFloat(output.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", output.Format.Duration, err)
+	}
+	return duration, nil
+}
+
+func (f *FFmpeg) Size(ctx context.Context, input string) (width, height int, err error) {
+	output, err := f.probe(ctx, "ffprobe aspect ratio", "-show_streams", input)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Find first video stream
+	for _, stream := range output.Streams {
+		if stream.CodecType == "video" {
+			width, height = stream.displaySize()
+			break
+		}
+	}
+
+	if width == 0 || height == 0 {
+		return 0, 0, fmt.Errorf("no video stream found")
+	}
+	return width, height, nil
+}
+
+func (f *FFmpeg) Rotation(ctx context.Context, input string) (int, error) {
+	output, err := f.probe(ctx, "ffprobe rotation", "-show_streams", input)
+	if err != nil {
+		return 0, err
+	}
+	for _, stream := range output.Streams {
+		if stream.CodecType == "video" {
+			return stream.rotation(), nil
+		}
+	}
+	return 0, fmt.Errorf("no video stream found")
+}
+
+// videoStream probes the first video stream of input.
+func (f *FFmpeg) videoStream(ctx context.Context, op, input string) (ffprobeStream, error) {
+	output, err := f.probe(ctx, op, "-show_streams", "-select_streams", "v:0", input)
+	if err != nil {
+		return ffprobeStream{}, err
+	}
+	if len(output.Streams) == 0 {
+		return ffprobeStream{}, fmt.Errorf("no video stream found")
+	}
+	return output.Streams[0], nil
+}
+
+func (f *FFmpeg) DynamicRange(ctx context.Context, input string) (string, error) {
+	stream, err := f.videoStream(ctx, "ffprobe dynamic range", input)
+	if err != nil {
+		return "", err
+	}
+	return stream.dynamicRange(), nil
+}
+
+func (f *FFmpeg) AudioTracks(ctx context.Context, input string) ([]AudioTrack, error) {
+	output, err := f.probe(ctx, "ffprobe audio tracks", "-show_streams", "-select_streams", "a", input)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]AudioTrack, 0, len(output.Streams))
+	for i, stream := range output.Streams {
+		language := stream.Tags.Language
+		if language == "und" {
+			language = ""
+		}
+		tracks = append(tracks, AudioTrack{
+			Index:    i,
+			Language: language,
+			Title:    stream.Tags.Title,
+			Codec:    stream.CodecName,
+			Channels: stream.Channels,
+			Default:  stream.Disposition.Default != 0,
+		})
+	}
+	return tracks, nil
+}
+
+func (f *FFmpeg) Bitrate(ctx context.Context, input string) (int64, error) {
+	output, err := f.probe(ctx, "ffprobe bitrate", "-show_format", "-show_streams", input)
+	if err != nil {
+		return 0, err
+	}
+	rate := output.Format.BitRate
+	for _, stream := range output.Streams {
+		if stream.CodecType == "video" {
+			// Containers like Matroska only know the overall rate
+			if stream.BitRate != "" {
+				rate = stream.BitRate
+			}
+			break
+		}
+	}
+	if rate == "" {
+		return 0, nil
+	}
+	bitrate, err := strconv.ParseInt(rate, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bit rate %q: %w", rate, err)
+	}
+	return bitrate, nil
+}
+
+// StreamInfo is what a remote transcoder needs to know about an input
+// before it submits a job.
+type StreamInfo struct {
+	Duration  float64
+	Width     int
+	Height    int
+	FrameRate float64
+	HasAudio  bool
+	// AudioTracks is the number of audio streams
+	AudioTracks int
+	// DynamicRange is one of the DynamicRange constants
+	DynamicRange string
+}
+
+// Inspect reads everything in StreamInfo with a single ffprobe run. The
+// video fields come from the first video stream, its size as displayed.
+func (f *FFmpeg) Inspect(ctx context.Context, input string) (StreamInfo, error) {
+	output, err := f.probe(ctx, "ffprobe inspect", "-show_format", "-show_streams", input)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	var info StreamInfo
+	info.Duration, err = strconv.ParseFloat(output.Format.Duration, 64)
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("invalid duration %q: %w", output.Format.Duration, err)
+	}
+	for _, stream := range output.Streams {
+		switch stream.CodecType {
+		case "audio":
+			info.HasAudio = true
+			info.AudioTracks++
+		case "video":
+			if info.Width == 0 {
+				info.Width, info.Height = stream.displaySize()
+				info.FrameRate = parseFrameRate(stream.RFrameRate)
+				info.DynamicRange = stream.dynamicRange()
+			}
+		}
+	}
+	if info.Width == 0 || info.Height == 0 {
+		return StreamInfo{}, fmt.Errorf("no video stream found")
+	}
+	if info.FrameRate <= 0 {
+		return StreamInfo{}, fmt.Errorf("unknown frame rate")
+	}
+	return info, nil
+}
+
+// parseFrameRate parses ffprobe's rational frame rates, like "30000/1001".
+// It returns 0 if rate isn't one.
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// KeyframeAligned looks for the first video keyframe at or before
+// timestamp.
+func (f *FFmpeg) KeyframeAligned(ctx context.Context, input string, timestamp float64) (bool, error) {
+	if timestamp == 0 {
+		return true, nil
+	}
+
+	cmd := f.ffprobeCommand(ctx, "-v", "error",
+		"-select_streams", "v:0",
+		"-skip_frame", "nokey",
+		"-read_intervals", fmt.Sprintf("%f%%+#1", timestamp),
+		"-show_entries", "frame=pts_time",
+		"-of", "csv=p=0",
+		input)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := f.run(ctx, "ffprobe keyframes", cmd); err != nil {
+		return false, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	line, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), "\n")
+	keyframe, err := strconv.ParseFloat(strings.TrimSpace(line), 64)
+	if err != nil {
+		return false, fmt.Errorf("no keyframe found near %.3fs", timestamp)
+	}
+	return math.Abs(keyframe-timestamp) <= keyframeTolerance, nil
+}
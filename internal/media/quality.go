@@ -0,0 +1,129 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// qualitySamples is how many windows, spread through the video,
+	// ChooseQuality encodes at each CRF it tries
+	qualitySamples = 3
+	// qualitySampleSeconds is how long each window is
+	qualitySampleSeconds = 4.0
+)
+
+// vmafScorePattern finds the pooled score libvmaf prints when it's done.
+var vmafScorePattern = regexp.MustCompile(`VMAF score: ([0-9.]+)`)
+
+// vmafFilter scores the first input, an encoded sample, against the
+// second, the same window of the source. The sample is scaled back to the
+// source's size since a capped Normalize may have scaled it down, and both
+// are compared as 8-bit so HDR sources can be scored too.
+const vmafFilter = "[0:v][1:v]scale2ref=flags=bicubic[dist][ref];" +
+	"[dist]setpts=PTS-STARTPTS,format=yuv420p[d];" +
+	"[ref]setpts=PTS-STARTPTS,format=yuv420p[r];" +
+	"[d][r]libvmaf"
+
+// qualityWindow is a [start, start+length) range ChooseQuality samples.
+type qualityWindow struct {
+	start, length float64
+}
+
+// qualityWindows spreads qualitySamples windows evenly through a video of
+// duration seconds. A video too short for them is sampled whole.
+func qualityWindows(duration float64) []qualityWindow {
+	if duration < 2*qualitySamples*qualitySampleSeconds {
+		return []qualityWindow{{start: 0, length: duration}}
+	}
+	windows := make([]qualityWindow, qualitySamples)
+	for i := range windows {
+		center := duration * float64(i+1) / float64(qualitySamples+1)
+		windows[i] = qualityWindow{start: center - qualitySampleSeconds/2, length: qualitySampleSeconds}
+	}
+	return windows
+}
+
+// ChooseQuality binary searches the CRF range, since VMAF falls as CRF
+// rises, encoding the windows at each CRF it tries and averaging their
+// scores. The ffmpeg binary needs libvmaf.
+func (f *FFmpeg) ChooseQuality(ctx context.Context, input string, limits Limits, target QualityTarget) (int, float64, error) {
+	if target.MinCRF <= 0 || target.MaxCRF < target.MinCRF {
+		return 0, 0, fmt.Errorf("invalid CRF range %d-%d", target.MinCRF, target.MaxCRF)
+	}
+	duration, err := f.Duration(ctx, input)
+	if err != nil {
+		return 0, 0, err
+	}
+	windows := qualityWindows(duration)
+
+	scores := map[int]float64{}
+	best := target.MinCRF
+	lo, hi := target.MinCRF, target.MaxCRF
+	for lo <= hi {
+		crf := (lo + hi) / 2
+		limits.CRF = crf
+		score, err := f.sampleVMAF(ctx, input, windows, limits)
+		if err != nil {
+			return 0, 0, err
+		}
+		scores[crf] = score
+		if score >= target.VMAF {
+			best, lo = crf, crf+1
+		} else {
+			hi = crf - 1
+		}
+	}
+	// When every CRF missed, the search ended having tried MinCRF
+	return best, scores[best], nil
+}
+
+// sampleVMAF is the mean VMAF of windows of input encoded with limits.
+func (f *FFmpeg) sampleVMAF(ctx context.Context, input string, windows []qualityWindow, limits Limits) (float64, error) {
+	sample := input + ".vmaf-sample.mp4"
+	defer os.Remove(sample)
+
+	var total float64
+	for _, window := range windows {
+		start := strconv.FormatFloat(window.start, 'f', 3, 64)
+		length := strconv.FormatFloat(window.length, 'f', 3, 64)
+		err := f.runEncodeKeepingColor(ctx, "ffmpeg quality sample", input, func(enc Encoder, color []string) []string {
+			args := append(enc.inputArgs(),
+				"-ss", start,
+				"-t", length,
+				"-i", input,
+				"-map", "0:v:0",
+				"-an")
+			args = append(args, normalizeVideoArgs(enc, color, limits)...)
+			return append(args, "-f", "mp4", "-y", sample)
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		stderr, err := f.runFFmpegLog(ctx, "ffmpeg vmaf", nil,
+			"-hide_banner", "-nostats",
+			"-i", sample,
+			"-ss", start,
+			"-t", length,
+			"-i", input,
+			"-lavfi", vmafFilter,
+			"-f", "null", "-")
+		if err != nil {
+			return 0, err
+		}
+		matches := vmafScorePattern.FindAllSubmatch(stderr, -1)
+		if len(matches) == 0 {
+			return 0, fmt.Errorf("no VMAF score for CRF %d, is ffmpeg built with libvmaf?", limits.CRF)
+		}
+		score, err := strconv.ParseFloat(string(matches[len(matches)-1][1]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid VMAF score: %w", err)
+		}
+		total += score
+	}
+	return total / float64(len(windows)), nil
+}
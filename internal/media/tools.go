@@ -0,0 +1,116 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Oldest ffmpeg/ffprobe release the flags used here are known to work with
+const (
+	minToolMajor = 4
+	minToolMinor = 4
+)
+
+// Tool is a resolved ffmpeg or ffprobe binary.
+type Tool struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	// Args are operator supplied flags placed before every other argument
+	Args []string `json:"args,omitempty"`
+}
+
+// Tools are the binaries FFmpeg shells out to and the encoder it uses.
+type Tools struct {
+	FFmpeg       Tool    `json:"ffmpeg"`
+	FFprobe      Tool    `json:"ffprobe"`
+	VideoEncoder Encoder `json:"video_encoder"`
+}
+
+var toolVersionRe = regexp.MustCompile(`version\s+n?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Config is where to find the binaries; empty paths are looked up on PATH.
+type Config struct {
+	FFmpegPath  string
+	FFprobePath string
+	// FFmpegArgs are extra global flags for every ffmpeg run, e.g.
+	// "-threads 2 -loglevel error"
+	FFmpegArgs []string
+}
+
+// DetectTools resolves ffmpeg and ffprobe and checks they are recent
+// enough, so a missing or outdated install fails at startup instead of in
+// the middle of processing an upload. The encoder is the CPU one.
+func DetectTools(ctx context.Context, config Config) (Tools, error) {
+	ffmpeg, err := detectTool(ctx, "ffmpeg", config.FFmpegPath)
+	if err != nil {
+		return Tools{}, err
+	}
+	ffmpeg.Args = config.FFmpegArgs
+	ffprobe, err := detectTool(ctx, "ffprobe", config.FFprobePath)
+	if err != nil {
+		return Tools{}, err
+	}
+	return Tools{FFmpeg: ffmpeg, FFprobe: ffprobe, VideoEncoder: CPUEncoder}, nil
+}
+
+func detectTool(ctx context.Context, name, configuredPath string) (Tool, error) {
+	path := configuredPath
+	if path == "" {
+		path = name
+	}
+	path, err := exec.LookPath(path)
+	if err != nil {
+		if configuredPath != "" {
+			return Tool{}, fmt.Errorf("%s not found at %s: %w", name, configuredPath, err)
+		}
+		return Tool{}, fmt.Errorf("%s not found on PATH: %w", name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "-version")
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return Tool{}, fmt.Errorf("%s -version failed: %w", path, err)
+	}
+
+	firstLine, _, _ := strings.Cut(stdout.String(), "\n")
+	version, err := checkToolVersion(name, firstLine)
+	if err != nil {
+		return Tool{}, err
+	}
+	return Tool{Path: path, Version: version}, nil
+}
+
+// checkToolVersion parses a "-version" banner such as
+// "ffmpeg version 6.1.1-3ubuntu5 Copyright ..." and enforces the minimum
+// release. Git snapshot builds ("version N-113442-g...") carry no release
+// number and are accepted as is.
+func checkToolVersion(name, banner string) (string, error) {
+	m := toolVersionRe.FindStringSubmatch(banner)
+	if m == nil {
+		fields := strings.Fields(banner)
+		if len(fields) >= 3 && fields[1] == "version" {
+			return fields[2], nil
+		}
+		return "unknown", nil
+	}
+
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	version := m[1] + "." + m[2]
+	if m[3] != "" {
+		version += "." + m[3]
+	}
+	if major < minToolMajor || (major == minToolMajor && minor < minToolMinor) {
+		return version, fmt.Errorf("%s %s is too old, need at least %d.%d", name, version, minToolMajor, minToolMinor)
+	}
+	return version, nil
+}
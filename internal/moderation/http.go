@@ -0,0 +1,52 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPClassifier posts each frame as image/jpeg to a locally hosted model
+// and expects a JSON reply of the form {"flagged": true, "labels": ["..."]}.
+type HTTPClassifier struct {
+	endpoint string
+	client   *http.Client
+}
+
+func NewHTTPClassifier(endpoint string, client *http.Client) *HTTPClassifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPClassifier{endpoint: endpoint, client: client}
+}
+
+func (c *HTTPClassifier) Classify(ctx context.Context, frame []byte) (Verdict, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(frame))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("classifier request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return Verdict{}, fmt.Errorf("classifier returned %s: %s", resp.Status, body)
+	}
+
+	var reply struct {
+		Flagged bool     `json:"flagged"`
+		Labels  []string `json:"labels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return Verdict{}, fmt.Errorf("couldn't decode classifier reply: %w", err)
+	}
+	return Verdict{Flagged: reply.Flagged, Labels: reply.Labels}, nil
+}
@@ -0,0 +1,36 @@
+// Package moderation classifies video frames for content that needs review
+// before it is shown publicly.
+package moderation
+
+import (
+	"context"
+)
+
+// Classifier inspects a single JPEG frame.
+type Classifier interface {
+	Classify(ctx context.Context, frame []byte) (Verdict, error)
+}
+
+// Verdict is a classifier's decision on one or more frames.
+type Verdict struct {
+	Flagged bool
+	// Labels names what was detected, e.g. "Explicit Nudity"
+	Labels []string
+}
+
+// Merge combines the verdicts of several frames: the result is flagged if
+// any frame was, with the distinct labels in first-seen order.
+func Merge(verdicts ...Verdict) Verdict {
+	var merged Verdict
+	seen := map[string]bool{}
+	for _, v := range verdicts {
+		merged.Flagged = merged.Flagged || v.Flagged
+		for _, label := range v.Labels {
+			if !seen[label] {
+				seen[label] = true
+				merged.Labels = append(merged.Labels, label)
+			}
+		}
+	}
+	return merged
+}
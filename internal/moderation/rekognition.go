@@ -0,0 +1,43 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+)
+
+// Rekognition classifies frames with Amazon Rekognition's
+// DetectModerationLabels. Any label at or above minConfidence flags the
+// frame.
+type Rekognition struct {
+	client        *rekognition.Client
+	minConfidence float32
+}
+
+func NewRekognition(client *rekognition.Client, minConfidence float32) *Rekognition {
+	return &Rekognition{client: client, minConfidence: minConfidence}
+}
+
+func (r *Rekognition) Classify(ctx context.Context, frame []byte) (Verdict, error) {
+	out, err := r.client.DetectModerationLabels(ctx, &rekognition.DetectModerationLabelsInput{
+		Image:         &types.Image{Bytes: frame},
+		MinConfidence: aws.Float32(r.minConfidence),
+	})
+	if err != nil {
+		return Verdict{}, fmt.Errorf("rekognition: %w", err)
+	}
+
+	var verdict Verdict
+	for _, label := range out.ModerationLabels {
+		name := aws.ToString(label.Name)
+		if name == "" {
+			continue
+		}
+		verdict.Flagged = true
+		verdict.Labels = append(verdict.Labels, name)
+	}
+	return verdict, nil
+}
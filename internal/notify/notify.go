@@ -0,0 +1,18 @@
+// Package notify delivers messages to users outside of the API, such as
+// emails about their uploads.
+package notify
+
+import "context"
+
+// Notifier sends a message to one recipient.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Message is a plain text message.
+type Message struct {
+	// To is the recipient's address
+	To      string
+	Subject string
+	Body    string
+}
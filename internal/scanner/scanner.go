@@ -0,0 +1,21 @@
+// Package scanner checks uploaded files for malware before they are stored.
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// Scanner inspects the contents of a file.
+type Scanner interface {
+	// Scan reads r to the end and reports whether it is infected. An error
+	// means the file couldn't be scanned, not that it is unsafe.
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Result is the verdict for a scanned file.
+type Result struct {
+	Infected bool
+	// Signature names the detected malware when Infected is set
+	Signature string
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// errJobCanceled is the cause of a running job's context once its owner
+// cancels it.
+var errJobCanceled = errors.New("job canceled")
+
+// jobCancelable reports whether owners may cancel jobs of kind. The rest
+// either can't be stopped halfway or belong to an account that is gone.
+func jobCancelable(kind string) bool {
+	switch kind {
+	case jobKindProcessVideo, jobKindImportVideo, jobKindIngestVideo, jobKindClip:
+		return true
+	default:
+		return false
+	}
+}
+
+// runningJobs holds the context cancel funcs of the jobs running in this
+// process, so a cancellation can stop them at once.
+type runningJobs struct {
+	mu      sync.Mutex
+	cancels map[uuid.UUID]context.CancelCauseFunc
+}
+
+func newRunningJobs() *runningJobs {
+	return &runningJobs{cancels: map[uuid.UUID]context.CancelCauseFunc{}}
+}
+
+func (r *runningJobs) add(id uuid.UUID, cancel context.CancelCauseFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[id] = cancel
+}
+
+func (r *runningJobs) remove(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cancels, id)
+}
+
+// cancel stops the job if it runs in this process and reports whether it
+// did.
+func (r *runningJobs) cancel(id uuid.UUID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancel, ok := r.cancels[id]
+	if ok {
+		cancel(errJobCanceled)
+	}
+	return ok
+}
+
+// jobCanceled reports whether the job whose runner failed was canceled,
+// either through ctx or, on another process, only in the database so far.
+func (cfg *apiConfig) jobCanceled(ctx context.Context, id uuid.UUID) bool {
+	if errors.Is(context.Cause(ctx), errJobCanceled) {
+		return true
+	}
+	job, err := cfg.db.WithContext(context.WithoutCancel(ctx)).GetJob(id)
+	return err == nil && job.Status == database.JobStatusCanceled
+}
+
+// finishCanceledJob cleans up after a canceled job: what it kept to run
+// again and what it already produced are deleted, and the video is left
+// as it was before the upload.
+func (cfg *apiConfig) finishCanceledJob(job database.Job) {
+	slog.Info("Job canceled",
+		"job_id", job.ID, "kind", job.Kind, "user_id", job.UserID, "video_id", job.VideoID,
+		"attempts", job.Attempts)
+	job.Status = database.JobStatusCanceled
+	job.NextAttemptAt = nil
+	if err := cfg.db.UpdateJob(job); err != nil {
+		slog.Warn("Couldn't save canceled job", "job_id", job.ID, "error", err)
+	}
+	cfg.discardJobInputs(job)
+
+	switch job.Kind {
+	case jobKindProcessVideo, jobKindImportVideo, jobKindIngestVideo:
+	default:
+		return
+	}
+	video, err := cfg.db.GetVideo(job.VideoID)
+	if err != nil || video.ID == uuid.Nil {
+		return
+	}
+	status := database.ProcessingNone
+	if video.VideoURL != nil {
+		// An earlier upload is still in place
+		status = database.ProcessingReady
+	}
+	if err := cfg.db.SetVideoProcessingStatus(video.ID, status); err != nil {
+		slog.Warn("Couldn't update processing status", "video_id", video.ID, "error", err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	// jobThroughputTTL is how long processing rates are used before the
+	// completed jobs are read again
+	jobThroughputTTL = time.Minute
+	// jobThroughputSample is how many of the latest completed jobs the
+	// rates are taken from
+	jobThroughputSample = 200
+)
+
+// jobThroughput is how long completed jobs of one kind, or one processing
+// profile, took.
+type jobThroughput struct {
+	// perInputSecond is the running time per second of media, over the
+	// jobs that recorded their input length
+	perInputSecond float64
+	inputJobs      int
+	// mean is the running time of an average job, for jobs whose length
+	// isn't known
+	mean time.Duration
+	jobs int
+}
+
+// jobThroughputCache holds the latest rates by jobEstimateKeys. Like
+// storageReportCache its lock is held while they're computed.
+type jobThroughputCache struct {
+	mu         sync.Mutex
+	computedAt time.Time
+	rates      map[string]jobThroughput
+}
+
+// jobEstimate is where a queued or running job stands.
+type jobEstimate struct {
+	// QueuePosition is 1 for the next queued job to be claimed
+	QueuePosition *int       `json:"queue_position,omitempty"`
+	CompletionAt  *time.Time `json:"estimated_completion_at,omitempty"`
+}
+
+// jobEstimateKeys are the keys under which job's rates are looked up, most
+// specific first: process_video jobs are also told apart by profile, since
+// a profile with more steps takes longer.
+func (cfg *apiConfig) jobEstimateKeys(job database.Job) []string {
+	keys := []string{job.Kind}
+	if job.Kind == jobKindProcessVideo {
+		var params processVideoParams
+		if err := json.Unmarshal([]byte(job.Params), &params); err == nil {
+			profile := cfg.defaultProfile
+			if params.Profile != nil {
+				profile = params.Profile.Name
+			}
+			keys = append([]string{job.Kind + "/" + profile}, keys...)
+		}
+	}
+	return keys
+}
+
+// jobThroughputs returns the processing rates of recently completed jobs,
+// computing them again once they're older than jobThroughputTTL.
+func (cfg *apiConfig) jobThroughputs(ctx context.Context) (map[string]jobThroughput, error) {
+	cache := cfg.jobRates
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.rates != nil && time.Since(cache.computedAt) < jobThroughputTTL {
+		return cache.rates, nil
+	}
+
+	completed, err := cfg.db.WithContext(ctx).ListJobs(database.JobFilter{Status: database.JobStatusCompleted, Limit: jobThroughputSample})
+	if err != nil {
+		return nil, err
+	}
+	type totals struct {
+		input, inputTime, time time.Duration
+		inputJobs, jobs        int
+	}
+	sums := map[string]*totals{}
+	for _, job := range completed {
+		if job.StartedAt == nil || job.UpdatedAt.Before(*job.StartedAt) {
+			continue
+		}
+		took := job.UpdatedAt.Sub(*job.StartedAt)
+		for _, key := range cfg.jobEstimateKeys(job) {
+			t := sums[key]
+			if t == nil {
+				t = &totals{}
+				sums[key] = t
+			}
+			t.time += took
+			t.jobs++
+			if job.InputSeconds != nil && *job.InputSeconds > 0 {
+				t.input += time.Duration(*job.InputSeconds * float64(time.Second))
+				t.inputTime += took
+				t.inputJobs++
+			}
+		}
+	}
+
+	rates := map[string]jobThroughput{}
+	for key, t := range sums {
+		rate := jobThroughput{mean: t.time / time.Duration(t.jobs), jobs: t.jobs, inputJobs: t.inputJobs}
+		if t.input > 0 {
+			rate.perInputSecond = t.inputTime.Seconds() / t.input.Seconds()
+		}
+		rates[key] = rate
+	}
+	cache.rates, cache.computedAt = rates, time.Now()
+	return rates, nil
+}
+
+// estimateJobDuration is how long job should run by the rates of its kind.
+// Jobs of a kind that hasn't completed recently can't be estimated.
+func (cfg *apiConfig) estimateJobDuration(rates map[string]jobThroughput, job database.Job) (time.Duration, bool) {
+	for _, key := range cfg.jobEstimateKeys(job) {
+		rate, ok := rates[key]
+		if !ok {
+			continue
+		}
+		if job.InputSeconds != nil && rate.inputJobs > 0 {
+			return time.Duration(rate.perInputSecond * *job.InputSeconds * float64(time.Second)), true
+		}
+		return rate.mean, true
+	}
+	return 0, false
+}
+
+// estimateJob finds a queued job's place in the queue and when a queued or
+// running job should complete. A queued job waits for the jobs ahead of it
+// and what the running ones have left, spread over the workers, before
+// running itself. Jobs ahead that can't be estimated are left out, so the
+// estimate errs early.
+func (cfg *apiConfig) estimateJob(ctx context.Context, job database.Job) (jobEstimate, error) {
+	var estimate jobEstimate
+	if job.Status != database.JobStatusQueued && job.Status != database.JobStatusRunning {
+		return estimate, nil
+	}
+	rates, err := cfg.jobThroughputs(ctx)
+	if err != nil {
+		return estimate, err
+	}
+	took, known := cfg.estimateJobDuration(rates, job)
+	now := time.Now().UTC()
+
+	if job.Status == database.JobStatusRunning {
+		if known && job.StartedAt != nil {
+			at := job.StartedAt.Add(took)
+			if at.Before(now) {
+				// One that overran is expected to finish any moment
+				at = now
+			}
+			estimate.CompletionAt = &at
+		}
+		return estimate, nil
+	}
+
+	ahead, err := cfg.db.WithContext(ctx).ListQueuedJobsAhead(job)
+	if err != nil {
+		return estimate, err
+	}
+	position := len(ahead) + 1
+	estimate.QueuePosition = &position
+	if !known {
+		return estimate, nil
+	}
+
+	running, err := cfg.db.WithContext(ctx).ListJobs(database.JobFilter{Status: database.JobStatusRunning})
+	if err != nil {
+		return estimate, err
+	}
+	var work time.Duration
+	for _, other := range running {
+		if d, ok := cfg.estimateJobDuration(rates, other); ok && other.StartedAt != nil {
+			work += max(d-now.Sub(*other.StartedAt), 0)
+		}
+	}
+	for _, other := range ahead {
+		if d, ok := cfg.estimateJobDuration(rates, other); ok {
+			work += d
+		}
+	}
+	// Workers elsewhere only show through the jobs they're running
+	workers := max(cfg.jobWorkers, len(running), 1)
+	start := now.Add(work / time.Duration(workers))
+	if job.NextAttemptAt != nil && job.NextAttemptAt.After(start) {
+		start = *job.NextAttemptAt
+	}
+	at := start.Add(took)
+	estimate.CompletionAt = &at
+	return estimate, nil
+}
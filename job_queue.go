@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Supported JOB_QUEUE values
+const (
+	jobQueueMemory   = "memory"
+	jobQueueDatabase = "database"
+	jobQueueSQS      = "sqs"
+)
+
+const (
+	defaultJobPollInterval = time.Second
+	// jobHeartbeatInterval is how often a worker touches the job it runs,
+	// well within JOB_STALE_AFTER
+	jobHeartbeatInterval = 30 * time.Second
+	defaultJobStaleAfter = 5 * time.Minute
+	// maxSQSDelay is the longest DelaySeconds SQS accepts
+	maxSQSDelay = 15 * time.Minute
+	// sqsLaneWaitSeconds is the long poll on each of several priority
+	// queues
+	sqsLaneWaitSeconds = 1
+	// jobLaneFullDelay is how long a job delivered to a worker without
+	// room for its priority waits before it is offered again
+	jobLaneFullDelay = 5 * time.Second
+)
+
+// jobQueue hands persisted jobs to workers. The jobs table stays the
+// record of every job's state; a queue only decides which worker runs a
+// queued job next, so delivering a job twice is harmless.
+type jobQueue interface {
+	// push makes the queued job id with the given priority available to
+	// workers after delay.
+	push(id uuid.UUID, priority string, delay time.Duration)
+	// claim blocks until it has claimed a due job of one of priorities for
+	// the calling worker, preferring the first, and returns false once ctx
+	// ends.
+	claim(ctx context.Context, priorities []string) (database.Job, bool)
+	// shared reports whether workers in other processes take jobs from
+	// the queue too.
+	shared() bool
+	// buffered is how many job IDs are waiting in this process, out of
+	// how many fit; both are 0 for queues outside the process.
+	buffered() (n, capacity int)
+}
+
+// memoryJobQueue holds a channel of job IDs per priority for this
+// process's workers. Jobs that don't fit stay queued in the database until
+// the next start.
+type memoryJobQueue struct {
+	cfg   *apiConfig
+	lanes map[string]chan uuid.UUID
+}
+
+func newMemoryJobQueue(cfg *apiConfig) *memoryJobQueue {
+	q := &memoryJobQueue{cfg: cfg, lanes: map[string]chan uuid.UUID{}}
+	for _, priority := range database.JobPriorities {
+		q.lanes[priority] = make(chan uuid.UUID, jobQueueCapacity)
+	}
+	return q
+}
+
+func (q *memoryJobQueue) push(id uuid.UUID, priority string, delay time.Duration) {
+	if delay > 0 {
+		time.AfterFunc(delay, func() { q.push(id, priority, 0) })
+		return
+	}
+	lane, ok := q.lanes[priority]
+	if !ok {
+		lane = q.lanes[database.JobPriorityNormal]
+	}
+	select {
+	case lane <- id:
+	default:
+		slog.Warn("Job queue full, job left queued", "job_id", id)
+	}
+}
+
+func (q *memoryJobQueue) claim(ctx context.Context, priorities []string) (database.Job, bool) {
+	for {
+		id, ok := q.next(ctx, priorities)
+		if !ok {
+			return database.Job{}, false
+		}
+		if job, ok := q.cfg.claimJob(q, id, priorities); ok {
+			return job, true
+		}
+	}
+}
+
+// next takes the first ID waiting in the highest of priorities, or waits
+// for one in any of them.
+func (q *memoryJobQueue) next(ctx context.Context, priorities []string) (uuid.UUID, bool) {
+	for _, priority := range priorities {
+		select {
+		case id := <-q.lanes[priority]:
+			return id, true
+		default:
+		}
+	}
+	// Lanes that are left out stay nil and never receive
+	var high, normal, low chan uuid.UUID
+	for _, priority := range priorities {
+		switch priority {
+		case database.JobPriorityHigh:
+			high = q.lanes[priority]
+		case database.JobPriorityNormal:
+			normal = q.lanes[priority]
+		case database.JobPriorityLow:
+			low = q.lanes[priority]
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return uuid.Nil, false
+	case id := <-high:
+		return id, true
+	case id := <-normal:
+		return id, true
+	case id := <-low:
+		return id, true
+	}
+}
+
+func (q *memoryJobQueue) shared() bool { return false }
+
+func (q *memoryJobQueue) buffered() (n, capacity int) {
+	for _, lane := range q.lanes {
+		n += len(lane)
+		capacity += cap(lane)
+	}
+	return n, capacity
+}
+
+// databaseJobQueue has workers claim the oldest due row of the jobs table
+// directly, polling when there is none. Pushing is a no-op since the row
+// is the queue entry.
+type databaseJobQueue struct {
+	db           database.Client
+	pollInterval time.Duration
+}
+
+func (q *databaseJobQueue) push(uuid.UUID, string, time.Duration) {}
+
+func (q *databaseJobQueue) claim(ctx context.Context, priorities []string) (database.Job, bool) {
+	for ctx.Err() == nil {
+		job, ok, err := q.db.WithContext(ctx).ClaimNextJob(time.Now(), priorities)
+		if err != nil {
+			slog.Error("Couldn't claim a job", "error", err)
+		} else if ok {
+			return job, true
+		}
+		select {
+		case <-time.After(q.pollInterval):
+		case <-ctx.Done():
+		}
+	}
+	return database.Job{}, false
+}
+
+func (q *databaseJobQueue) shared() bool { return true }
+
+func (q *databaseJobQueue) buffered() (int, int) { return 0, 0 }
+
+// sqsJobQueue sends job IDs through an SQS queue per priority, though
+// priorities may share one. A message is deleted as soon as it is
+// received: a worker that dies mid-job leaves the job running in the
+// database, where the stale job check finds it.
+type sqsJobQueue struct {
+	cfg       *apiConfig
+	client    *sqs.Client
+	queueURLs map[string]string
+}
+
+func (q *sqsJobQueue) push(id uuid.UUID, priority string, delay time.Duration) {
+	queueURL, ok := q.queueURLs[priority]
+	if !ok {
+		queueURL = q.queueURLs[database.JobPriorityNormal]
+	}
+	// Waits past the SQS maximum are resumed by claim
+	_, err := q.client.SendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:     aws.String(queueURL),
+		MessageBody:  aws.String(id.String()),
+		DelaySeconds: int32(min(delay, maxSQSDelay).Seconds()),
+	})
+	if err != nil {
+		slog.Error("Couldn't send job to the queue, it stays queued until the next start", "job_id", id, "error", err)
+	}
+}
+
+func (q *sqsJobQueue) claim(ctx context.Context, priorities []string) (database.Job, bool) {
+	var queueURLs []string
+	for _, priority := range priorities {
+		if queueURL := q.queueURLs[priority]; !slices.Contains(queueURLs, queueURL) {
+			queueURLs = append(queueURLs, queueURL)
+		}
+	}
+	// A single queue is long-polled; several are polled in turn, briefly
+	// each, so higher priorities are checked first without stalling the
+	// others
+	wait := int32(ingestWaitSeconds)
+	if len(queueURLs) > 1 {
+		wait = sqsLaneWaitSeconds
+	}
+	for ctx.Err() == nil {
+		for _, queueURL := range queueURLs {
+			if job, ok := q.receive(ctx, queueURL, wait, priorities); ok {
+				return job, true
+			}
+		}
+	}
+	return database.Job{}, false
+}
+
+func (q *sqsJobQueue) receive(ctx context.Context, queueURL string, wait int32, priorities []string) (database.Job, bool) {
+	out, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueURL),
+		MaxNumberOfMessages: 1,
+		WaitTimeSeconds:     wait,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Couldn't receive jobs", "queue_url", queueURL, "error", err)
+			select {
+			case <-time.After(ingestRetryDelay):
+			case <-ctx.Done():
+			}
+		}
+		return database.Job{}, false
+	}
+	for _, msg := range out.Messages {
+		_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(queueURL),
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+		if err != nil {
+			slog.Warn("Couldn't delete job message", "message_id", aws.ToString(msg.MessageId), "error", err)
+		}
+		id, err := uuid.Parse(aws.ToString(msg.Body))
+		if err != nil {
+			slog.Warn("Dropping unreadable job message", "message_id", aws.ToString(msg.MessageId), "error", err)
+			continue
+		}
+		if job, ok := q.cfg.claimJob(q, id, priorities); ok {
+			return job, true
+		}
+	}
+	return database.Job{}, false
+}
+
+func (q *sqsJobQueue) shared() bool { return true }
+
+func (q *sqsJobQueue) buffered() (int, int) { return 0, 0 }
+
+// claimJob claims the job a queue delivered by ID. Jobs that are no longer
+// queued are skipped, jobs whose backoff isn't over yet go back to the
+// queue for the rest of it, and so do jobs of a priority the worker has no
+// room for, which only a queue shared between priorities delivers.
+func (cfg *apiConfig) claimJob(queue jobQueue, id uuid.UUID, priorities []string) (database.Job, bool) {
+	job, err := cfg.db.GetJob(id)
+	if err != nil || job.ID == uuid.Nil {
+		slog.Warn("Couldn't load job", "job_id", id, "error", err)
+		return database.Job{}, false
+	}
+	if job.Status != database.JobStatusQueued {
+		return database.Job{}, false
+	}
+	if job.NextAttemptAt != nil {
+		// Requeued by a restart before its backoff ran out
+		if wait := time.Until(*job.NextAttemptAt); wait > 0 {
+			queue.push(id, job.Priority, wait)
+			return database.Job{}, false
+		}
+	}
+	if !slices.Contains(priorities, job.Priority) {
+		queue.push(id, job.Priority, jobLaneFullDelay)
+		return database.Job{}, false
+	}
+
+	job, ok, err := cfg.db.ClaimJob(id)
+	if err != nil {
+		slog.Warn("Couldn't mark job running", "job_id", id, "error", err)
+		return database.Job{}, false
+	}
+	return job, ok
+}
+
+// startStaleJobCheck periodically queues running jobs again whose worker
+// stopped touching them, for example because its host went away. It only
+// runs with a shared queue; a single process requeues its running jobs on
+// start instead.
+func (cfg *apiConfig) startStaleJobCheck() {
+	if !cfg.jobs.shared() {
+		return
+	}
+	cfg.lifecycle.workers.Add(1)
+	go func() {
+		defer cfg.lifecycle.workers.Done()
+		ticker := time.NewTicker(cfg.jobStaleAfter / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-cfg.lifecycle.drain:
+				return
+			}
+			ids, err := cfg.db.RequeueStaleJobs(time.Now().Add(-cfg.jobStaleAfter))
+			if err != nil {
+				slog.Error("Couldn't requeue stale jobs", "error", err)
+				continue
+			}
+			for _, id := range ids {
+				slog.Warn("Requeued job whose worker went away", "job_id", id)
+				job, err := cfg.db.GetJob(id)
+				if err != nil {
+					slog.Error("Couldn't load requeued job", "job_id", id, "error", err)
+					continue
+				}
+				cfg.enqueueJob(job)
+			}
+		}
+	}()
+}
+
+// heartbeatJob touches the running job every jobHeartbeatInterval until
+// the returned func is called, so the stale job check leaves it alone. A
+// job canceled on another process is stopped through cancel.
+func (cfg *apiConfig) heartbeatJob(id uuid.UUID, cancel context.CancelCauseFunc) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			running, err := cfg.db.TouchJob(id)
+			if err != nil {
+				slog.Warn("Couldn't touch running job", "job_id", id, "error", err)
+				continue
+			}
+			if !running && cfg.jobCanceled(context.Background(), id) {
+				cancel(errJobCanceled)
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// jobLanes limits how many jobs of each priority this process runs at
+// once, so long transcodes can't take every worker.
+type jobLanes struct {
+	// claiming lets one worker claim at a time, so no lane goes over its
+	// limit between checking it and counting the claimed job
+	claiming sync.Mutex
+
+	mu      sync.Mutex
+	limits  map[string]int
+	running map[string]int
+	// freed is closed and replaced whenever a job finishes
+	freed chan struct{}
+}
+
+func newJobLanes(limits map[string]int) *jobLanes {
+	return &jobLanes{limits: limits, running: map[string]int{}, freed: make(chan struct{})}
+}
+
+// open lists the priorities with room for another job, highest first, and
+// a channel that is closed once a job finishes.
+func (l *jobLanes) open() ([]string, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var open []string
+	for _, priority := range database.JobPriorities {
+		if l.running[priority] < l.limits[priority] {
+			open = append(open, priority)
+		}
+	}
+	return open, l.freed
+}
+
+func (l *jobLanes) acquire(priority string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running[priority]++
+}
+
+func (l *jobLanes) release(priority string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running[priority]--
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+// laneOverview is one priority's jobs running in this process.
+type laneOverview struct {
+	Priority string `json:"priority"`
+	Running  int    `json:"running"`
+	Limit    int    `json:"limit"`
+}
+
+func (l *jobLanes) snapshot() []laneOverview {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lanes := make([]laneOverview, 0, len(database.JobPriorities))
+	for _, priority := range database.JobPriorities {
+		lanes = append(lanes, laneOverview{Priority: priority, Running: l.running[priority], Limit: l.limits[priority]})
+	}
+	return lanes
+}
+
+// claimNextJob waits until the queue hands over a job of a priority with
+// room, and counts it as running. Once a job finishes, the wait starts
+// over with the priorities that have room then.
+func (cfg *apiConfig) claimNextJob(ctx context.Context) (database.Job, bool) {
+	lanes := cfg.jobLanes
+	lanes.claiming.Lock()
+	defer lanes.claiming.Unlock()
+	for ctx.Err() == nil {
+		priorities, freed := lanes.open()
+		claimCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-freed:
+				cancel()
+			case <-claimCtx.Done():
+			}
+		}()
+		var (
+			job database.Job
+			ok  bool
+		)
+		if len(priorities) > 0 {
+			job, ok = cfg.jobs.claim(claimCtx, priorities)
+		} else {
+			<-claimCtx.Done()
+		}
+		cancel()
+		if ok {
+			lanes.acquire(job.Priority)
+			return job, true
+		}
+	}
+	return database.Job{}, false
+}
+
+// videoJobPriority is the priority of a job processing a video of the
+// probed duration: short videos go ahead of the rest and long ones after.
+// Videos that couldn't be probed get the normal priority.
+func (cfg *apiConfig) videoJobPriority(duration *float64) string {
+	if duration == nil {
+		return database.JobPriorityNormal
+	}
+	switch length := time.Duration(*duration * float64(time.Second)); {
+	case length <= cfg.shortVideoMax:
+		return database.JobPriorityHigh
+	case length >= cfg.longVideoMin:
+		return database.JobPriorityLow
+	default:
+		return database.JobPriorityNormal
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultJobWorkers = 2
+	jobQueueCapacity  = 256
+
+	defaultJobMaxAttempts    = 3
+	defaultJobRetryBaseDelay = 30 * time.Second
+	defaultJobRetryMaxDelay  = 10 * time.Minute
+
+	defaultShortVideoMax = 2 * time.Minute
+	defaultLongVideoMin  = 20 * time.Minute
+)
+
+// jobKindProcessVideo processes an uploaded video file
+const jobKindProcessVideo = "process_video"
+
+// jobRunner performs the work for one kind of job. It returns the job with
+// any result fields filled in.
+type jobRunner func(ctx context.Context, job database.Job) (database.Job, error)
+
+func (cfg *apiConfig) jobRunners() map[string]jobRunner {
+	return map[string]jobRunner{
+		jobKindClip:         cfg.runClipJob,
+		jobKindImportVideo:  cfg.runImportVideoJob,
+		jobKindIngestVideo:  cfg.runIngestVideoJob,
+		jobKindProcessVideo: cfg.runProcessVideoJob,
+		jobKindPurgeAccount: cfg.runPurgeAccountJob,
+		jobKindRekeyVideo:   cfg.runRekeyVideoJob,
+	}
+}
+
+// startJobWorkers launches the goroutines that take jobs from the queue.
+// They exit once shutdown begins, leaving unstarted jobs queued in the
+// database.
+func (cfg *apiConfig) startJobWorkers() {
+	ctx, cancel := context.WithCancel(cfg.lifecycle.ctx)
+	go func() {
+		<-cfg.lifecycle.drain
+		cancel()
+	}()
+
+	runners := cfg.jobRunners()
+	for i := 0; i < cfg.jobWorkers; i++ {
+		cfg.lifecycle.workers.Add(1)
+		go func() {
+			defer cfg.lifecycle.workers.Done()
+			for {
+				job, ok := cfg.claimNextJob(ctx)
+				if !ok {
+					return
+				}
+				cfg.runJob(runners, job)
+				cfg.jobLanes.release(job.Priority)
+			}
+		}()
+	}
+}
+
+// enqueueJob hands a persisted job to the workers. If the queue can't take
+// it the job stays in the queued state in the database.
+func (cfg *apiConfig) enqueueJob(job database.Job) {
+	cfg.jobs.push(job.ID, job.Priority, 0)
+}
+
+// runJob runs a job the queue claimed for this worker, which already marked
+// it running.
+func (cfg *apiConfig) runJob(runners map[string]jobRunner, job database.Job) {
+	runner, ok := runners[job.Kind]
+	if !ok {
+		cfg.failJob(job, fmt.Errorf("unknown job kind %q", job.Kind))
+		return
+	}
+
+	// Continue the trace of the request that queued the job
+	ctx, span := tracer.Start(contextWithTraceParent(cfg.lifecycle.ctx, job.TraceParent), "job "+job.Kind,
+		trace.WithAttributes(
+			attribute.String("job.id", job.ID.String()),
+			attribute.String("video.id", job.VideoID.String()),
+		))
+	defer span.End()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	cfg.runningJobs.add(job.ID, cancel)
+	defer cfg.runningJobs.remove(job.ID)
+	defer cfg.heartbeatJob(job.ID, cancel)()
+
+	result, err := runner(ctx, job)
+	recordSpanError(span, err)
+	if err == nil {
+		// A cancellation that arrives too late loses to the finished job
+		cfg.completeJob(result)
+		return
+	}
+	outcome := cfg.jobFailureOutcome(ctx, result, err)
+	if outcome != failureCanceled && cfg.jobCanceled(ctx, job.ID) {
+		outcome = failureCanceled
+	}
+	switch outcome {
+	case failureCanceled:
+		cfg.finishCanceledJob(result)
+	case failureInterrupted:
+		// Interrupted by shutdown, run it again on the next start or, with
+		// a shared queue, on another worker
+		result.Status = database.JobStatusQueued
+		if err := cfg.db.WithContext(context.WithoutCancel(ctx)).UpdateJob(result); err != nil {
+			slog.Error("Couldn't requeue interrupted job", "job_id", job.ID, "error", err)
+			return
+		}
+		if cfg.jobs.shared() {
+			cfg.enqueueJob(result)
+		}
+	case failureRetry:
+		cfg.retryJob(result, err)
+	case failureDeadLetter:
+		cfg.deadLetterJob(result, err)
+	default:
+		cfg.failJob(result, err)
+	}
+}
+
+// jobRetryPolicy is how often a failed job is run again and how long it
+// waits in between: baseDelay after the first attempt, doubling each time
+// up to maxDelay.
+type jobRetryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// backoff is the wait before the attempt after the given one.
+func (p jobRetryPolicy) backoff(attempts int) time.Duration {
+	delay := p.baseDelay
+	for i := 1; i < attempts && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.maxDelay)
+}
+
+// permanentError marks a job failure that running the job again can't fix,
+// such as bad parameters or a deleted video. The job fails without retries.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// failureOutcome is what becomes of a job whose runner returned an error.
+type failureOutcome int
+
+const (
+	// failureInterrupted jobs were stopped by shutdown and run on the next
+	// start
+	failureInterrupted failureOutcome = iota
+	// failureCanceled jobs were stopped by their owner and are cleaned up
+	// by finishCanceledJob
+	failureCanceled
+	// failureRetry jobs run again once their backoff is over
+	failureRetry
+	// failureDeadLetter jobs are out of attempts and wait for an admin to
+	// retry or discard them
+	failureDeadLetter
+	// failureFinal jobs failed for good
+	failureFinal
+)
+
+// runsAgain reports whether the job will run again without an admin.
+func (o failureOutcome) runsAgain() bool {
+	return o == failureInterrupted || o == failureRetry
+}
+
+// keepsInputs reports whether the job may still run again, so runners must
+// keep the files it works from.
+func (o failureOutcome) keepsInputs() bool {
+	return o != failureFinal && o != failureCanceled
+}
+
+// jobFailureOutcome decides the fate of a job that failed with err on its
+// job.Attempts-th attempt. Runners call it to know what to clean up.
+func (cfg *apiConfig) jobFailureOutcome(ctx context.Context, job database.Job, err error) failureOutcome {
+	var perm permanentError
+	switch {
+	case errors.Is(context.Cause(ctx), errJobCanceled):
+		return failureCanceled
+	case cfg.lifecycle.ctx.Err() != nil:
+		return failureInterrupted
+	case errors.As(err, &perm):
+		return failureFinal
+	case job.Attempts < cfg.jobRetries.maxAttempts:
+		return failureRetry
+	default:
+		return failureDeadLetter
+	}
+}
+
+// retryJob queues a failed job again and hands it to the workers once its
+// backoff is over. The error of the failed attempt stays on the job.
+func (cfg *apiConfig) retryJob(job database.Job, jobErr error) {
+	delay := cfg.jobRetries.backoff(job.Attempts)
+	slog.Warn("Job failed, retrying",
+		"job_id", job.ID, "kind", job.Kind, "video_id", job.VideoID,
+		"attempt", job.Attempts, "retry_in", delay, "error", jobErr)
+	msg := jobErr.Error()
+	next := time.Now().UTC().Add(delay)
+	job.Status = database.JobStatusQueued
+	job.Error = &msg
+	job.NextAttemptAt = &next
+	if err := cfg.db.UpdateJob(job); err != nil {
+		slog.Error("Couldn't requeue failed job", "job_id", job.ID, "error", err)
+		return
+	}
+	cfg.jobs.push(job.ID, job.Priority, delay)
+}
+
+// deadLetterJob parks a job that is out of attempts. Its inputs are kept so
+// an admin can retry it.
+func (cfg *apiConfig) deadLetterJob(job database.Job, jobErr error) {
+	slog.Error("Job dead-lettered",
+		"job_id", job.ID, "kind", job.Kind, "user_id", job.UserID, "video_id", job.VideoID,
+		"attempts", job.Attempts, "error", jobErr)
+	msg := jobErr.Error()
+	job.Status = database.JobStatusDeadLettered
+	job.Error = &msg
+	job.NextAttemptAt = nil
+	if err := cfg.db.UpdateJob(job); err != nil {
+		slog.Error("Couldn't dead-letter job", "job_id", job.ID, "error", err)
+		return
+	}
+	cfg.notifyJobFinished(job)
+}
+
+func (cfg *apiConfig) completeJob(job database.Job) {
+	job.Status = database.JobStatusCompleted
+	job.Error = nil
+	job.NextAttemptAt = nil
+	if err := cfg.db.UpdateJob(job); err != nil {
+		slog.Error("Couldn't mark job completed", "job_id", job.ID, "error", err)
+		// Nothing records the result, so don't keep it
+		if job.ResultURL != nil {
+			cfg.discardUploads("", *job.ResultURL)
+		}
+		return
+	}
+	cfg.notifyJobFinished(job)
+}
+
+func (cfg *apiConfig) failJob(job database.Job, jobErr error) {
+	slog.Error("Job failed",
+		"job_id", job.ID, "kind", job.Kind, "user_id", job.UserID, "video_id", job.VideoID,
+		"error", jobErr)
+	msg := jobErr.Error()
+	job.Status = database.JobStatusFailed
+	job.Error = &msg
+	job.NextAttemptAt = nil
+	if err := cfg.db.UpdateJob(job); err != nil {
+		slog.Error("Couldn't mark job failed", "job_id", job.ID, "error", err)
+		return
+	}
+	cfg.notifyJobFinished(job)
+}
+
+// jobToSignedJob replaces the stored "bucket,key" result with a presigned URL.
+func (cfg *apiConfig) jobToSignedJob(job database.Job) (database.Job, error) {
+	if job.ResultURL == nil || *job.ResultURL == "" {
+		job.ResultURL = nil
+		return job, nil
+	}
+
+	bucket, key, err := splitVideoURL(*job.ResultURL)
+	if err != nil {
+		return job, err
+	}
+	url, err := generatePresignedURL(cfg.s3Client, bucket, key, presignExpiry)
+	if err != nil {
+		return job, err
+	}
+	job.ResultURL = &url
+	return job, nil
+}
+
+// jobResponse is a job as returned to its owner, with a localized status.
+type jobResponse struct {
+	database.Job
+	StatusText string `json:"status_text"`
+	// Progress is set for purge_account jobs
+	Progress *jobProgress `json:"progress,omitempty"`
+	// jobEstimate is only set for the job status endpoint
+	jobEstimate
+}
+
+func newJobResponse(lang string, job database.Job) jobResponse {
+	resp := jobResponse{Job: job, StatusText: jobStatusText(lang, job.Status)}
+	if job.Kind == jobKindPurgeAccount {
+		resp.Progress = purgeProgress(job)
+	}
+	return resp
+}
@@ -2,22 +2,33 @@ package main
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
 )
 
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
+	respondWithErrorDetails(w, code, msg, err, nil)
+}
+
+// respondWithErrorDetails is respondWithError with details for clients to
+// act on.
+func respondWithErrorDetails(w http.ResponseWriter, code int, msg string, err error, details map[string]any) {
+	attrs := []any{"status", code, "message", msg}
 	if err != nil {
-		log.Println(err)
+		attrs = append(attrs, "error", err)
 	}
 	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
-	}
-	type errorResponse struct {
-		Error string `json:"error"`
+		responseLogger(w).Error("Responding with 5XX error", attrs...)
+		noteServerError(w, msg, err)
+	} else if err != nil {
+		responseLogger(w).Info("Responding with error", attrs...)
 	}
 	respondWithJSON(w, code, errorResponse{
-		Error: msg,
+		Error:     i18n.Translate(responseLanguage(w), msg),
+		Code:      errorCode(code, msg),
+		RequestID: w.Header().Get(requestIDHeader),
+		Details:   details,
 	})
 }
 
@@ -25,7 +36,7 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		responseLogger(w).Error("Error marshalling JSON", "error", err)
 		w.WriteHeader(500)
 		return
 	}
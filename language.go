@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+)
+
+// languageResponseWriter carries the negotiated response language so
+// respondWithError can localize messages without every handler passing the
+// request along.
+type languageResponseWriter struct {
+	http.ResponseWriter
+	lang string
+}
+
+func (w *languageResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// languageMiddleware negotiates a language from Accept-Language and makes it
+// available on both the response writer and the request context.
+func languageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", lang)
+		next.ServeHTTP(&languageResponseWriter{ResponseWriter: w, lang: lang},
+			r.WithContext(i18n.WithLanguage(r.Context(), lang)))
+	})
+}
+
+// responseLanguage returns the language negotiated for w, or English if the
+// request didn't pass through languageMiddleware.
+func responseLanguage(w http.ResponseWriter) string {
+	for w != nil {
+		if lw, ok := w.(*languageResponseWriter); ok {
+			return lw.lang
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return i18n.DefaultLanguage
+}
+
+// jobStatusText returns the localized, human readable form of a job status.
+func jobStatusText(lang, status string) string {
+	text, ok := i18n.Text(lang, "STATUS_"+strings.ToUpper(status))
+	if !ok {
+		return status
+	}
+	return text
+}
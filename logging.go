@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// Longer or non-printable incoming IDs are replaced with a fresh one
+	maxRequestIDLen = 128
+)
+
+// newLogger builds the process-wide logger from LOG_FORMAT ("text" or
+// "json") and LOG_LEVEL ("debug", "info", "warn" or "error").
+func newLogger(format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, err
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected text or json", format)
+	}
+}
+
+// requestLogWriter records the response status and size for the access log
+// and carries the request's logger, so respondWithError can log with the
+// request ID without being handed the request.
+type requestLogWriter struct {
+	http.ResponseWriter
+	logger *slog.Logger
+	status int
+	bytes  int64
+
+	mu    sync.Mutex
+	attrs []any
+	// serverError is what a 5XX response was answered with, for the admin
+	// overview
+	serverError *serverError
+}
+
+func (w *requestLogWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *requestLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *requestLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type requestLoggerKey struct{}
+
+// requestIDMiddleware tags every request with an ID, reusing a sane
+// incoming X-Request-ID, echoes it in the response and writes one access
+// log line per request.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		lw := &requestLogWriter{ResponseWriter: w, logger: logger}
+		start := time.Now()
+
+		next.ServeHTTP(lw, r.WithContext(context.WithValue(r.Context(), requestLoggerKey{}, logger)))
+
+		status := lw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		lw.mu.Lock()
+		attrs := append([]any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"response_bytes", lw.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+		}, lw.attrs...)
+		serverErr := lw.serverError
+		lw.mu.Unlock()
+		logger.Info("request", attrs...)
+
+		if status > 499 {
+			if serverErr == nil {
+				serverErr = &serverError{}
+			}
+			serverErr.Time = start.UTC()
+			serverErr.Method = r.Method
+			serverErr.Path = r.URL.Path
+			serverErr.Status = status
+			serverErr.RequestID = id
+			recentServerErrors.add(*serverErr)
+		}
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// findRequestLogWriter unwraps w down to the writer installed by
+// requestIDMiddleware.
+func findRequestLogWriter(w http.ResponseWriter) *requestLogWriter {
+	for w != nil {
+		if lw, ok := w.(*requestLogWriter); ok {
+			return lw
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+	return nil
+}
+
+// responseLogger returns the logger of the request w answers, or the default
+// logger outside requestIDMiddleware.
+func responseLogger(w http.ResponseWriter) *slog.Logger {
+	if lw := findRequestLogWriter(w); lw != nil {
+		return lw.logger
+	}
+	return slog.Default()
+}
+
+// requestLogger is responseLogger for code that only has the request.
+func requestLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(requestLoggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// noteServerError remembers the message and error of a 5XX response until
+// requestIDMiddleware files it with the request.
+func noteServerError(w http.ResponseWriter, msg string, err error) {
+	lw := findRequestLogWriter(w)
+	if lw == nil {
+		return
+	}
+	e := &serverError{Message: msg}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	lw.mu.Lock()
+	lw.serverError = e
+	lw.mu.Unlock()
+}
+
+// annotateLog adds key/value attributes such as user_id or video_id to the
+// request's access log line.
+func annotateLog(w http.ResponseWriter, attrs ...any) {
+	if lw := findRequestLogWriter(w); lw != nil {
+		lw.mu.Lock()
+		lw.attrs = append(lw.attrs, attrs...)
+		lw.mu.Unlock()
+	}
+}
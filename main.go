@@ -2,15 +2,32 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/moderation"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/scanner"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type apiConfig struct {
@@ -23,21 +40,148 @@ type apiConfig struct {
 	s3Bucket         string
 	s3Region         string
 	s3CfDistribution string
-	port             string
+	// externalBaseURL is EXTERNAL_BASE_URL, preferred over the address a
+	// request came in on
+	externalBaseURL string
+	// defaultBaseURL is used for assets created outside a request
+	defaultBaseURL   string
+	jobs             jobQueue
+	adminEmails      map[string]bool
+	keyTemplate      keyTemplate
+	s3SSE            sseConfig
+	s3StorageClass   types.StorageClass
+	keepOriginals    bool
+	archiveAfter     time.Duration
+	trashRetention   time.Duration
+	scanner          scanner.Scanner
+	classifier       moderation.Classifier
+	moderationFrames int
+	webhooks         []webhookEndpoint
+	lifecycle        *lifecycle
+	shutdownGrace    time.Duration
+	stagingDir       string
+	streamingRemux   bool
+	// videoLimits are the resolution and bit rate uploads are re-encoded
+	// down to when they're over
+	videoLimits media.Limits
+	// bakeRotation re-encodes rotated uploads so they're upright without
+	// the metadata
+	bakeRotation bool
+	// loudnessTarget is what the loudnorm profile step normalizes audio to
+	loudnessTarget media.LoudnessTarget
+	// qualityTarget is what the per-title profile step searches for
+	qualityTarget  media.QualityTarget
+	streamProxy    bool
+	cachePolicy    cachePolicy
+	openAPISpec    []byte
+	tempDir        string
+	mediaTools     media.Tools
+	prober         media.Prober
+	transcoder     media.Transcoder
+	packager       media.Packager
+	sqsClient      *sqs.Client
+	ingestQueueURL string
+	ingestPrefix   string
+	directUploads  bool
+	// assetsRequireAuth limits assets of private and held videos to those
+	// who may see the video
+	assetsRequireAuth bool
+	// uploadLimits cut off upload requests whose client is too slow
+	uploadLimits uploadLimits
+	// tempMaxAge is how old leftover temp files must be before
+	// sweepTempFiles removes them
+	tempMaxAge  time.Duration
+	tempJanitor *tempJanitor
+	// multipartUploadTTL is how long multipart uploads may stay incomplete
+	// before they are aborted
+	multipartUploadTTL time.Duration
+	// posterSceneSelection searches for a representative poster frame
+	// instead of always taking the fixed offset
+	posterSceneSelection bool
+	// posterMode is posterModeLambda when posters of uploads come from the
+	// poster Lambda instead of the pipeline
+	posterMode string
+	// posterQueueURL and posterWebhookSecret are where poster Lambda
+	// results arrive; either may be empty
+	posterQueueURL      string
+	posterWebhookSecret string
+	// aspects files probed video sizes under the {aspect} key categories
+	aspects aspectCategories
+	// processingProfiles are the pipeline variants an upload can ask for
+	processingProfiles map[string]processingProfile
+	defaultProfile     string
+	// maxDuration is how long videos of users on no tier may be, 0 for
+	// unlimited
+	maxDuration   time.Duration
+	durationTiers map[string]time.Duration
+	// egressMonthlyCap is the default bytes a user's videos may be served
+	// per month, 0 for unlimited
+	egressMonthlyCap int64
+	// CloudFront standard logs counted towards egress, if the prefix is set
+	cloudFrontLogBucket   string
+	cloudFrontLogPrefix   string
+	cloudFrontLogInterval time.Duration
+	// trustProxyHeaders takes client addresses from X-Forwarded-For
+	trustProxyHeaders bool
+	storageReports    *storageReportCache
+	// geoCountryHeader is where the proxy in front puts the viewer's
+	// country, for playback rules
+	geoCountryHeader string
+	// jobRates are the recent processing rates queued jobs are estimated by
+	jobRates *jobThroughputCache
+	// jobRetries is how failed jobs are retried before they're dead-lettered
+	jobRetries jobRetryPolicy
+	// jobWorkers is how many jobs this process runs at once
+	jobWorkers int
+	// jobStaleAfter is how long a running job may go untouched before a
+	// shared queue hands it to another worker
+	jobStaleAfter time.Duration
+	// jobQueueKind is the JOB_QUEUE backend behind jobs
+	jobQueueKind string
+	// jobLanes caps the jobs of each priority running in this process
+	jobLanes *jobLanes
+	// runningJobs lets cancellations stop jobs running in this process
+	runningJobs *runningJobs
+	// Videos up to shortVideoMax long are processed at high priority, and
+	// those of longVideoMin or more at low priority
+	shortVideoMax time.Duration
+	longVideoMin  time.Duration
+	// notifier emails owners about their uploads if set
+	notifier             notify.Notifier
+	emailTemplates       map[string]map[string]emailTemplate
+	notifyCompletedAfter time.Duration
 }
 
 func main() {
+	worker := flag.Bool("worker", false, "only run jobs from the shared JOB_QUEUE, without the API")
+	flag.Parse()
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
-	if pathToDB == "" {
-		log.Fatal("DB_URL must be set")
+	// Optional: LOG_FORMAT=json for structured output, LOG_LEVEL to filter
+	logger, err := newLogger(os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Fatalf("Invalid logging config: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	// DATABASE_URL selects PostgreSQL; local development uses the SQLite file at DB_PATH
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = os.Getenv("DB_PATH")
+	}
+	if dsn == "" {
+		log.Fatal("DB_PATH or DATABASE_URL must be set")
 	}
 
-	db, err := database.NewClient(pathToDB)
+	db, err := database.NewClient(dsn)
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
+	schemaVersion, err := db.SchemaVersion()
+	if err != nil {
+		log.Fatalf("Couldn't read schema version: %v", err)
+	}
+	slog.Info("Connected to database", "dialect", db.Dialect(), "schema_version", schemaVersion)
 
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
@@ -79,10 +223,396 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	// Optional: terminate TLS here instead of at a proxy, with a
+	// certificate and key or with certificates from Let's Encrypt
+	tlsCfg := tlsConfig{
+		CertFile:         os.Getenv("TLS_CERT_FILE"),
+		KeyFile:          os.Getenv("TLS_KEY_FILE"),
+		AutocertDomains:  envList("TLS_AUTOCERT_DOMAINS", nil),
+		AutocertEmail:    os.Getenv("TLS_AUTOCERT_EMAIL"),
+		AutocertCacheDir: os.Getenv("TLS_AUTOCERT_CACHE"),
+		RedirectPort:     os.Getenv("HTTP_REDIRECT_PORT"),
+		HTTP2:            envBool("HTTP2", true),
+		HSTS: hstsPolicy{
+			MaxAge:            envDuration("HSTS_MAX_AGE", 0),
+			IncludeSubdomains: envBool("HSTS_INCLUDE_SUBDOMAINS", false),
+			Preload:           envBool("HSTS_PRELOAD", false),
+		},
+	}
+	if tlsCfg.AutocertCacheDir == "" {
+		tlsCfg.AutocertCacheDir = defaultAutocertCacheDir
+	}
+	if err := tlsCfg.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional: the address clients reach the server at, for the asset
+	// URLs it hands out, e.g. https://tubely.example.com behind a proxy
+	var externalBaseURL string
+	if raw := os.Getenv("EXTERNAL_BASE_URL"); raw != "" {
+		externalBaseURL, err = parseExternalBaseURL(raw)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	defaultBaseURL := externalBaseURL
+	if defaultBaseURL == "" {
+		scheme := "http"
+		if tlsCfg.enabled() {
+			scheme = "https"
+		}
+		defaultBaseURL = scheme + "://localhost:" + port
+	}
+
+	// Optional: comma separated emails of users allowed to use /admin endpoints
+	adminEmails := parseAdminEmails(os.Getenv("ADMIN_EMAILS"))
+
+	// Optional: layout of S3 object keys, see object_keys.go for variables
+	keyTemplate, err := parseKeyTemplate(os.Getenv("S3_KEY_TEMPLATE"))
+	if err != nil {
+		log.Fatalf("Invalid S3_KEY_TEMPLATE: %v", err)
+	}
+
+	// Optional: server-side encryption for uploaded objects
+	s3SSE, err := parseSSEConfig(os.Getenv("S3_SSE"), os.Getenv("S3_SSE_KMS_KEY_ID"))
+	if err != nil {
+		log.Fatalf("Invalid S3 encryption config: %v", err)
+	}
+
+	// Optional: storage class for uploads and archival of original uploads
+	s3StorageClass, err := parseStorageClass(os.Getenv("S3_STORAGE_CLASS"))
+	if err != nil {
+		log.Fatalf("Invalid S3_STORAGE_CLASS: %v", err)
+	}
+	keepOriginals := envBool("S3_KEEP_ORIGINALS", false)
+	archiveAfterDays := envInt("S3_ARCHIVE_AFTER_DAYS", 30)
+	trashRetentionDays := envInt("TRASH_RETENTION_DAYS", 30)
+	if trashRetentionDays < 0 {
+		log.Fatal("TRASH_RETENTION_DAYS must not be negative")
+	}
+
+	// Optional: the shorter side in pixels and the video bit rate above
+	// which uploads are re-encoded down to them; 0 leaves them as they are
+	maxResolution := envInt("MAX_VIDEO_RESOLUTION", 0)
+	maxBitrateKbps := envInt("MAX_VIDEO_BITRATE_KBPS", 0)
+	if maxResolution < 0 || maxBitrateKbps < 0 {
+		log.Fatal("MAX_VIDEO_RESOLUTION and MAX_VIDEO_BITRATE_KBPS must not be negative")
+	}
+
+	// Optional: the integrated loudness the loudnorm profile step targets,
+	// -23 LUFS for EBU R128 or around -14 to match streaming services
+	loudnessLUFS := envInt("LOUDNESS_TARGET_LUFS", -23)
+	if loudnessLUFS < -70 || loudnessLUFS > -5 {
+		log.Fatal("LOUDNESS_TARGET_LUFS must be between -70 and -5")
+	}
+
+	// Optional: the VMAF score the per-title profile step keeps its
+	// encodes at, 93 being hard to tell from the upload
+	perTitleVMAF := envInt("PER_TITLE_VMAF", 93)
+	if perTitleVMAF < 1 || perTitleVMAF > 100 {
+		log.Fatal("PER_TITLE_VMAF must be between 1 and 100")
+	}
+
+	// Optional: aspect ratio categories as name=W:H, and how far off a
+	// video may be to still match one
+	aspects, err := parseAspectCategories(
+		envList("ASPECT_CATEGORIES", defaultAspectCategories),
+		envInt("ASPECT_TOLERANCE_PERCENT", defaultAspectTolerancePercent),
+	)
+	if err != nil {
+		log.Fatalf("Invalid ASPECT_CATEGORIES: %v", err)
+	}
+
+	// Optional: extra processing profiles as name=step+step and the one
+	// used when an upload doesn't pick any
+	processingProfiles, err := parseProcessingProfiles(envList("PROCESSING_PROFILES", nil))
+	if err != nil {
+		log.Fatalf("Invalid PROCESSING_PROFILES: %v", err)
+	}
+	defaultProfile := os.Getenv("DEFAULT_PROCESSING_PROFILE")
+	if defaultProfile == "" {
+		defaultProfile = defaultProcessingProfile
+	}
+	if _, ok := processingProfiles[defaultProfile]; !ok {
+		log.Fatalf("DEFAULT_PROCESSING_PROFILE %q is not a known profile", defaultProfile)
+	}
+
+	// Optional: the longest video a user may upload, 0 for unlimited, and
+	// tiers as name=duration admins can put users on instead
+	maxDuration := envDuration("MAX_VIDEO_DURATION", 0)
+	if maxDuration < 0 {
+		log.Fatal("MAX_VIDEO_DURATION must not be negative")
+	}
+	durationTiers, err := parseDurationTiers(envList("VIDEO_DURATION_TIERS", nil))
+	if err != nil {
+		log.Fatalf("Invalid VIDEO_DURATION_TIERS: %v", err)
+	}
+
+	// Optional: monthly egress cap per user, overridable per user by
+	// admins; 0 means unlimited
+	egressCapMB := envInt("EGRESS_MONTHLY_CAP_MB", 0)
+	if egressCapMB < 0 {
+		log.Fatal("EGRESS_MONTHLY_CAP_MB must not be negative")
+	}
+	// Optional: where CloudFront writes standard logs, to count the bytes
+	// it serves as well
+	cloudFrontLogBucket := os.Getenv("CLOUDFRONT_LOG_BUCKET")
+	if cloudFrontLogBucket == "" {
+		cloudFrontLogBucket = s3Bucket
+	}
+	cloudFrontLogInterval := envDuration("CLOUDFRONT_LOG_INTERVAL", defaultCloudFrontLogInterval)
+	if cloudFrontLogInterval <= 0 {
+		log.Fatal("CLOUDFRONT_LOG_INTERVAL must be positive")
+	}
+
+	// Optional: clamd address for scanning uploads before they are stored
+	uploadScanner, err := newScanner(os.Getenv("CLAMD_ADDRESS"), envDuration("CLAMD_TIMEOUT", defaultScanTimeout))
+	if err != nil {
+		log.Fatalf("Invalid CLAMD_ADDRESS: %v", err)
+	}
+
+	// Fail fast if ffmpeg/ffprobe are missing or too old. Optional:
+	// FFMPEG_PATH/FFPROBE_PATH for custom builds, FFMPEG_GLOBAL_ARGS for
+	// flags added to every ffmpeg run
+	tools, err := media.DetectTools(context.Background(), media.Config{
+		FFmpegPath:  os.Getenv("FFMPEG_PATH"),
+		FFprobePath: os.Getenv("FFPROBE_PATH"),
+		FFmpegArgs:  strings.Fields(os.Getenv("FFMPEG_GLOBAL_ARGS")),
+	})
+	if err != nil {
+		log.Fatalf("Media tools check failed: %v", err)
+	}
+	slog.Info("Using media tools",
+		"ffmpeg_version", tools.FFmpeg.Version, "ffmpeg_path", tools.FFmpeg.Path,
+		"ffprobe_version", tools.FFprobe.Version, "ffprobe_path", tools.FFprobe.Path)
+	ffmpeg := &media.FFmpeg{Tools: tools, RunCommand: runCommand}
+
+	// Optional: hardware H.264 encoder (nvenc, vaapi, videotoolbox or auto),
+	// falling back to libx264 when it isn't usable on this host
+	ffmpeg.Tools.VideoEncoder, err = ffmpeg.DetectEncoder(context.Background(), os.Getenv("VIDEO_ENCODER"), os.Getenv("VAAPI_DEVICE"))
+	if err != nil {
+		log.Fatalf("Invalid VIDEO_ENCODER: %v", err)
+	}
+	slog.Info("Encoding video", "encoder", ffmpeg.Tools.VideoEncoder.Codec)
+
+	// Optional: how many ffmpeg processes may run at once; the rest wait
+	maxTranscodes := envInt("MAX_CONCURRENT_TRANSCODES", runtime.NumCPU())
+	if maxTranscodes < 1 {
+		log.Fatal("MAX_CONCURRENT_TRANSCODES must be at least 1")
+	}
+	transcodes = newTranscodeLimiter(maxTranscodes)
+	ffmpeg.Acquire = transcodes.acquire
+
+	// Optional: how often a failing job runs before it's dead-lettered (1
+	// disables retries), and the backoff between attempts
+	jobRetries := jobRetryPolicy{
+		maxAttempts: envInt("JOB_MAX_ATTEMPTS", defaultJobMaxAttempts),
+		baseDelay:   envDuration("JOB_RETRY_BASE_DELAY", defaultJobRetryBaseDelay),
+		maxDelay:    envDuration("JOB_RETRY_MAX_DELAY", defaultJobRetryMaxDelay),
+	}
+	if jobRetries.maxAttempts < 1 {
+		log.Fatal("JOB_MAX_ATTEMPTS must be at least 1")
+	}
+	if jobRetries.baseDelay <= 0 || jobRetries.maxDelay < jobRetries.baseDelay {
+		log.Fatal("JOB_RETRY_MAX_DELAY must be at least JOB_RETRY_BASE_DELAY, which must be positive")
+	}
+
+	// Optional: email owners when processing fails, or completes after
+	// NOTIFY_COMPLETED_AFTER, through an SMTP server
+	notifier, err := newNotifier(
+		os.Getenv("NOTIFIER"),
+		os.Getenv("SMTP_ADDR"),
+		os.Getenv("SMTP_FROM"),
+		os.Getenv("SMTP_USERNAME"),
+		os.Getenv("SMTP_PASSWORD"),
+		envDuration("SMTP_TIMEOUT", defaultSMTPTimeout),
+	)
+	if err != nil {
+		log.Fatalf("Invalid notifier config: %v", err)
+	}
+	emailTemplates, err := loadEmailTemplates(os.Getenv("NOTIFY_TEMPLATE_DIR"))
+	if err != nil {
+		log.Fatalf("Couldn't load email templates: %v", err)
+	}
+
+	// Optional: endpoints that receive events, each with its own signing
+	// secret or WEBHOOK_SECRET
+	webhooks := parseWebhookEndpoints(os.Getenv("WEBHOOK_URLS"), os.Getenv("WEBHOOK_SECRET"))
+
+	// Optional: OTLP trace export, configured through the standard OTEL_*
+	// variables
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		log.Fatalf("Couldn't set up tracing: %v", err)
+	}
+
 	awsCfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
 	if err != nil {
 		log.Fatalf("Failed to load AWS config: %v", err)
 	}
+	otelaws.AppendMiddlewares(&awsCfg.APIOptions)
+
+	// Optional: the S3 client's connection pool, timeouts and retries
+	s3Client, err := newS3Client(awsCfg, s3ClientConfig{
+		maxIdleConns:    envInt("S3_MAX_IDLE_CONNS", defaultS3MaxIdleConns),
+		dialTimeout:     envDuration("S3_DIAL_TIMEOUT", defaultS3DialTimeout),
+		tlsTimeout:      envDuration("S3_TLS_HANDSHAKE_TIMEOUT", defaultS3TLSTimeout),
+		responseTimeout: envDuration("S3_RESPONSE_TIMEOUT", defaultS3ResponseTimeout),
+		requestTimeout:  envDuration("S3_REQUEST_TIMEOUT", 0),
+		retryMode:       os.Getenv("S3_RETRY_MODE"),
+		maxAttempts:     envInt("S3_MAX_ATTEMPTS", defaultS3MaxAttempts),
+		maxBackoff:      envDuration("S3_MAX_BACKOFF", defaultS3MaxBackoff),
+	})
+	if err != nil {
+		log.Fatalf("Invalid S3 client config: %v", err)
+	}
+
+	// Optional: classify sampled frames and hold flagged videos for review
+	classifier, err := newClassifier(
+		os.Getenv("MODERATION_CLASSIFIER"),
+		os.Getenv("MODERATION_ENDPOINT"),
+		envInt("MODERATION_MIN_CONFIDENCE", 80),
+		awsCfg,
+	)
+	if err != nil {
+		log.Fatalf("Invalid moderation config: %v", err)
+	}
+	moderationFrames := envInt("MODERATION_FRAMES", defaultModerationFrames)
+	if moderationFrames < 1 {
+		log.Fatal("MODERATION_FRAMES must be at least 1")
+	}
+
+	// Optional: SQS queue receiving the bucket's ObjectCreated events for
+	// objects dropped under INGEST_PREFIX
+	ingestQueueURL := os.Getenv("INGEST_QUEUE_URL")
+	ingestPrefix := os.Getenv("INGEST_PREFIX")
+	if ingestPrefix == "" {
+		ingestPrefix = defaultIngestPrefix
+	}
+	if !strings.HasSuffix(ingestPrefix, "/") {
+		ingestPrefix += "/"
+	}
+	// Optional: POSTER_MODE=lambda leaves poster extraction for uploads to
+	// a Lambda triggered by the bucket, which reports back on
+	// POSTER_QUEUE_URL or to the webhook signed with POSTER_WEBHOOK_SECRET
+	posterMode := os.Getenv("POSTER_MODE")
+	if posterMode == "" {
+		posterMode = posterModeLocal
+	}
+	posterQueueURL := os.Getenv("POSTER_QUEUE_URL")
+	posterWebhookSecret := os.Getenv("POSTER_WEBHOOK_SECRET")
+	switch posterMode {
+	case posterModeLocal:
+	case posterModeLambda:
+		if posterQueueURL == "" && posterWebhookSecret == "" {
+			log.Fatal("POSTER_MODE=lambda requires POSTER_QUEUE_URL or POSTER_WEBHOOK_SECRET")
+		}
+	default:
+		log.Fatalf("Invalid POSTER_MODE %q, expected local or lambda", posterMode)
+	}
+	// Optional: JOB_QUEUE=database or sqs shares jobs between this server
+	// and processes started with -worker, claiming rows of the jobs table
+	// or receiving from JOB_QUEUE_URL
+	jobQueueKind := os.Getenv("JOB_QUEUE")
+	if jobQueueKind == "" {
+		jobQueueKind = jobQueueMemory
+	}
+	jobQueueURL := os.Getenv("JOB_QUEUE_URL")
+	switch jobQueueKind {
+	case jobQueueMemory:
+		if *worker {
+			log.Fatal("-worker requires JOB_QUEUE=database or JOB_QUEUE=sqs")
+		}
+	case jobQueueDatabase:
+	case jobQueueSQS:
+		if jobQueueURL == "" {
+			log.Fatal("JOB_QUEUE=sqs requires JOB_QUEUE_URL")
+		}
+	default:
+		log.Fatalf("Invalid JOB_QUEUE %q, expected memory, database or sqs", jobQueueKind)
+	}
+	// Optional: how many jobs run at once in this process; an API server
+	// with a shared queue may leave them all to workers with 0
+	jobWorkers := envInt("JOB_WORKERS", defaultJobWorkers)
+	if jobWorkers < 0 || jobWorkers == 0 && (jobQueueKind == jobQueueMemory || *worker) {
+		log.Fatal("JOB_WORKERS must be at least 1, or 0 on an API server with a shared JOB_QUEUE")
+	}
+	// Optional: how many jobs of each priority may run at once in this
+	// process; by default long videos leave a worker for everything else
+	laneLimits := map[string]int{
+		database.JobPriorityHigh:   envInt("JOB_CONCURRENCY_HIGH", jobWorkers),
+		database.JobPriorityNormal: envInt("JOB_CONCURRENCY_NORMAL", jobWorkers),
+		database.JobPriorityLow:    envInt("JOB_CONCURRENCY_LOW", max(jobWorkers-1, 1)),
+	}
+	for priority, limit := range laneLimits {
+		if limit < 1 && jobWorkers > 0 {
+			log.Fatalf("JOB_CONCURRENCY_%s must be at least 1", strings.ToUpper(priority))
+		}
+	}
+	// Optional: the durations below and above which uploads and imports
+	// are processed ahead of or after the rest
+	shortVideoMax := envDuration("JOB_PRIORITY_SHORT_VIDEO", defaultShortVideoMax)
+	longVideoMin := envDuration("JOB_PRIORITY_LONG_VIDEO", defaultLongVideoMin)
+	if longVideoMin <= shortVideoMax {
+		log.Fatal("JOB_PRIORITY_LONG_VIDEO must be longer than JOB_PRIORITY_SHORT_VIDEO")
+	}
+	// Optional: how long a running job may go without a heartbeat before
+	// a shared queue runs it elsewhere
+	jobStaleAfter := envDuration("JOB_STALE_AFTER", defaultJobStaleAfter)
+	if jobStaleAfter < 2*jobHeartbeatInterval {
+		log.Fatalf("JOB_STALE_AFTER must be at least %s", 2*jobHeartbeatInterval)
+	}
+	var sqsClient *sqs.Client
+	if ingestQueueURL != "" || posterQueueURL != "" || jobQueueKind == jobQueueSQS {
+		sqsClient = sqs.NewFromConfig(awsCfg)
+	}
+	// Optional: hand out presigned POSTs that upload into the ingest prefix
+	directUploads := envBool("DIRECT_UPLOADS", false)
+	if directUploads && ingestQueueURL == "" {
+		log.Fatal("DIRECT_UPLOADS requires INGEST_QUEUE_URL")
+	}
+	// Optional: how long chunked and other multipart uploads may stay
+	// incomplete before their parts are discarded
+	multipartUploadTTL := envDuration("MULTIPART_UPLOAD_TTL", defaultMultipartUploadTTL)
+	if multipartUploadTTL <= 0 {
+		log.Fatal("MULTIPART_UPLOAD_TTL must be positive")
+	}
+	// Optional: how long an upload request may take in all and wait for
+	// more bytes, and the bytes per second it must keep up (0 disables
+	// each)
+	limits := uploadLimits{
+		Timeout:     envDuration("UPLOAD_TIMEOUT", defaultUploadTimeout),
+		IdleTimeout: envDuration("UPLOAD_IDLE_TIMEOUT", defaultUploadIdleTimeout),
+		MinRate:     int64(envInt("UPLOAD_MIN_RATE", defaultUploadMinRate)),
+	}
+	if limits.Timeout < 0 || limits.IdleTimeout < 0 || limits.MinRate < 0 {
+		log.Fatal("UPLOAD_TIMEOUT, UPLOAD_IDLE_TIMEOUT and UPLOAD_MIN_RATE can't be negative")
+	}
+	// Optional: how old files in TEMP_DIR and STAGING_DIR must be before
+	// they count as left over by a crash and are removed
+	tempMaxAge := envDuration("TEMP_MAX_AGE", defaultTempMaxAge)
+	if tempMaxAge <= 0 {
+		log.Fatal("TEMP_MAX_AGE must be positive")
+	}
+
+	// Optional: scratch space for downloads, frames and multipart
+	// spooling, which net/http always puts in os.TempDir
+	tempDir := os.Getenv("TEMP_DIR")
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	} else {
+		if err := os.MkdirAll(tempDir, 0o755); err != nil {
+			log.Fatalf("Couldn't create TEMP_DIR: %v", err)
+		}
+		os.Setenv("TMPDIR", tempDir)
+	}
+
+	// Optional: where uploads wait for processing; keep it on persistent
+	// storage so queued jobs survive a reboot
+	stagingDir := os.Getenv("STAGING_DIR")
+	if stagingDir == "" {
+		stagingDir = filepath.Join(tempDir, "tubely-staging")
+	}
 
 	cfg := apiConfig{
 		db:               db,
@@ -90,45 +620,243 @@ func main() {
 		platform:         platform,
 		filepathRoot:     filepathRoot,
 		assetsRoot:       assetsRoot,
-		s3Client:         s3.NewFromConfig(awsCfg),
+		s3Client:         s3Client,
 		s3Bucket:         s3Bucket,
 		s3Region:         s3Region,
 		s3CfDistribution: s3CfDistribution,
-		port:             port,
+		externalBaseURL:  externalBaseURL,
+		defaultBaseURL:   defaultBaseURL,
+		adminEmails:      adminEmails,
+		keyTemplate:      keyTemplate,
+		s3SSE:            s3SSE,
+		s3StorageClass:   s3StorageClass,
+		keepOriginals:    keepOriginals,
+		archiveAfter:     time.Duration(archiveAfterDays) * 24 * time.Hour,
+		trashRetention:   time.Duration(trashRetentionDays) * 24 * time.Hour,
+		scanner:          uploadScanner,
+		classifier:       classifier,
+		moderationFrames: moderationFrames,
+		webhooks:         webhooks,
+		lifecycle:        newLifecycle(),
+		shutdownGrace:    envDuration("SHUTDOWN_GRACE_PERIOD", defaultShutdownGracePeriod),
+		stagingDir:       stagingDir,
+		streamingRemux:   envBool("STREAMING_REMUX", false),
+		videoLimits:      media.Limits{MaxResolution: maxResolution, MaxBitrate: int64(maxBitrateKbps) * 1000},
+		// Optional: for players that ignore rotation metadata
+		bakeRotation: envBool("BAKE_ROTATION", false),
+		// The true peak R128 recommends, and a loudness range that leaves
+		// most speech and music to loudnorm's linear mode
+		loudnessTarget: media.LoudnessTarget{Integrated: float64(loudnessLUFS), TruePeak: -1, Range: 11},
+		streamProxy:    envBool("STREAM_PROXY", false),
+		// Never better than the fixed CRF Normalize uses, which would make
+		// renditions bigger, and never past where x264 falls apart
+		qualityTarget: media.QualityTarget{VMAF: float64(perTitleVMAF), MinCRF: 20, MaxCRF: 34},
+		cachePolicy: newCachePolicy(
+			os.Getenv("CACHE_CONTROL_IMAGES"),
+			os.Getenv("CACHE_CONTROL_VIDEOS"),
+			os.Getenv("CACHE_CONTROL_OTHER"),
+		),
+		tempDir:        tempDir,
+		mediaTools:     ffmpeg.Tools,
+		prober:         ffmpeg,
+		transcoder:     ffmpeg,
+		packager:       media.Passthrough{},
+		sqsClient:      sqsClient,
+		ingestQueueURL: ingestQueueURL,
+		ingestPrefix:   ingestPrefix,
+		directUploads:  directUploads,
+		// Optional: check access to thumbnails like to the videos they
+		// belong to, instead of serving every asset to anyone with its URL
+		assetsRequireAuth: envBool("ASSETS_REQUIRE_AUTH", false),
+
+		multipartUploadTTL: multipartUploadTTL,
+		uploadLimits:       limits,
+		tempMaxAge:         tempMaxAge,
+		tempJanitor:        &tempJanitor{},
+
+		aspects:              aspects,
+		posterSceneSelection: envBool("POSTER_SCENE_SELECTION", true),
+		posterMode:           posterMode,
+		posterQueueURL:       posterQueueURL,
+		posterWebhookSecret:  posterWebhookSecret,
+		processingProfiles:   processingProfiles,
+		defaultProfile:       defaultProfile,
+		maxDuration:          maxDuration,
+		durationTiers:        durationTiers,
+
+		egressMonthlyCap:      int64(egressCapMB) << 20,
+		cloudFrontLogBucket:   cloudFrontLogBucket,
+		cloudFrontLogPrefix:   os.Getenv("CLOUDFRONT_LOG_PREFIX"),
+		cloudFrontLogInterval: cloudFrontLogInterval,
+
+		// Optional: behind a load balancer or CDN, take the client address
+		// for the audit log and view counting from X-Forwarded-For
+		trustProxyHeaders: envBool("TRUST_PROXY_HEADERS", false),
+		storageReports:    &storageReportCache{},
+		jobRates:          &jobThroughputCache{},
+		jobRetries:        jobRetries,
+		jobWorkers:        jobWorkers,
+		jobStaleAfter:     jobStaleAfter,
+		jobQueueKind:      jobQueueKind,
+		jobLanes:          newJobLanes(laneLimits),
+		runningJobs:       newRunningJobs(),
+		shortVideoMax:     shortVideoMax,
+		longVideoMin:      longVideoMin,
+
+		// Optional: the header a CDN or load balancer adds with the viewer's
+		// country, like CloudFront-Viewer-Country or CF-IPCountry
+		geoCountryHeader: os.Getenv("GEO_COUNTRY_HEADER"),
+
+		notifier:             notifier,
+		emailTemplates:       emailTemplates,
+		notifyCompletedAfter: envDuration("NOTIFY_COMPLETED_AFTER", defaultNotifyCompletedAfter),
+	}
+
+	// Optional: TRANSCODER=mediaconvert runs re-encodes as AWS Elemental
+	// MediaConvert jobs with the role MEDIACONVERT_ROLE_ARN, polled every
+	// MEDIACONVERT_POLL_INTERVAL
+	cfg.transcoder, err = cfg.newTranscoder(os.Getenv("TRANSCODER"), ffmpeg, awsCfg)
+	if err != nil {
+		log.Fatalf("Invalid transcoder config: %v", err)
+	}
+
+	switch jobQueueKind {
+	case jobQueueDatabase:
+		// Optional: how often idle workers look for a queued job
+		cfg.jobs = &databaseJobQueue{db: db, pollInterval: envDuration("JOB_POLL_INTERVAL", defaultJobPollInterval)}
+	case jobQueueSQS:
+		// Optional: JOB_QUEUE_URL_HIGH and JOB_QUEUE_URL_LOW give those
+		// priorities queues of their own instead of sharing JOB_QUEUE_URL
+		queueURLs := map[string]string{database.JobPriorityNormal: jobQueueURL}
+		for _, priority := range []string{database.JobPriorityHigh, database.JobPriorityLow} {
+			queueURLs[priority] = os.Getenv("JOB_QUEUE_URL_" + strings.ToUpper(priority))
+			if queueURLs[priority] == "" {
+				queueURLs[priority] = jobQueueURL
+			}
+		}
+		cfg.jobs = &sqsJobQueue{cfg: &cfg, client: sqsClient, queueURLs: queueURLs}
+	default:
+		cfg.jobs = newMemoryJobQueue(&cfg)
 	}
 
 	err = cfg.ensureAssetsDir()
 	if err != nil {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
+	err = cfg.ensureStagingDir()
+	if err != nil {
+		log.Fatalf("Couldn't create staging directory: %v", err)
+	}
+
+	cfg.startJobWorkers()
+	cfg.startStaleJobCheck()
 
 	mux := http.NewServeMux()
-	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
-	mux.Handle("/app/", appHandler)
+	mux.HandleFunc("GET /healthz", cfg.handlerHealthz)
+	mux.HandleFunc("GET /readyz", cfg.handlerReadyz)
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
-	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	if *worker {
+		// Workers only run jobs and answer health checks. The loops that
+		// must not run twice stay with the API server.
+		slog.Info("Running job workers", "workers", jobWorkers, "queue", jobQueueKind)
+	} else {
+		cfg.requeuePersistedJobs()
+		cfg.startTrashPurger()
+		cfg.startIngestConsumer()
+		cfg.startPosterResultConsumer()
+		cfg.startCloudFrontLogIngest()
+		cfg.startMultipartCleanup()
+		cfg.startTempJanitor()
 
-	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
-	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
-	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+		appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
+		mux.Handle("/app/", appHandler)
 
-	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+		mux.HandleFunc("GET /assets/{name}", cfg.handlerAsset)
+		mux.HandleFunc("GET /embed/{videoID}", cfg.handlerEmbed)
+		mux.HandleFunc("GET /oembed", cfg.handlerOEmbed)
+		mux.HandleFunc("GET /feeds/{file}", cfg.handlerUserFeed)
 
-	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
-	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
-	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
-	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
-	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
-	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+		routes := cfg.routes()
+		cfg.openAPISpec, err = buildOpenAPISpec(routes)
+		if err != nil {
+			log.Fatalf("Couldn't build OpenAPI document: %v", err)
+		}
+		for _, route := range routes {
+			handler := route.Handler
+			if route.Audit != "" {
+				handler = cfg.audited(route.Audit, handler)
+			}
+			mux.HandleFunc(route.Method+" "+route.Path, handler)
+		}
+	}
 
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	// Optional: let browser frontends on other origins call the API
+	cors := corsConfig{
+		AllowedOrigins:   envList("CORS_ALLOWED_ORIGINS", nil),
+		AllowedMethods:   envList("CORS_ALLOWED_METHODS", defaultCORSMethods),
+		AllowedHeaders:   envList("CORS_ALLOWED_HEADERS", defaultCORSHeaders),
+		AllowCredentials: envBool("CORS_ALLOW_CREDENTIALS", false),
+		MaxAge:           envDuration("CORS_MAX_AGE", defaultCORSMaxAge),
+	}
+	for i, method := range cors.AllowedMethods {
+		cors.AllowedMethods[i] = strings.ToUpper(method)
+	}
+	if err := cors.validate(); err != nil {
+		log.Fatalf("Invalid CORS config: %v", err)
+	}
 
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: otelhttp.NewHandler(requestIDMiddleware(hstsMiddleware(tlsCfg.HSTS, corsMiddleware(cors, languageMiddleware(routeSpanMiddleware(mux))))), "http.server"),
+		// Optional: how long clients get to send request headers, so
+		// slowloris connections are dropped before reaching a handler
+		ReadHeaderTimeout: envDuration("READ_HEADER_TIMEOUT", defaultReadHeaderTimeout),
+		IdleTimeout:       idleConnTimeout,
 	}
 
-	log.Printf("Serving on: http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+	var redirectSrv *http.Server
+	if tlsCfg.enabled() {
+		redirectSrv = configureTLS(srv, tlsCfg)
+	}
+	if redirectSrv != nil {
+		go func() {
+			slog.Info("Redirecting to HTTPS", "url", "http://localhost:"+tlsCfg.RedirectPort+"/")
+			if err := redirectSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	go func() {
+		var err error
+		if tlsCfg.enabled() {
+			slog.Info("Serving", "url", "https://localhost:"+port+"/app/")
+			err = srv.ListenAndServeTLS(tlsCfg.CertFile, tlsCfg.KeyFile)
+		} else {
+			slog.Info("Serving", "url", "http://localhost:"+port+"/app/")
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	stopCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-stopCtx.Done()
+	stop()
+
+	if redirectSrv != nil {
+		// Redirects are answered at once, there is nothing to drain
+		redirectSrv.Close()
+	}
+	cfg.shutdown(srv)
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Couldn't flush traces", "error", err)
+	}
+	if err := db.Close(); err != nil {
+		slog.Warn("Couldn't close database", "error", err)
+	}
 }
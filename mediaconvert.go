@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+const defaultMediaConvertPrefix = "mediaconvert/"
+
+// newTranscoder returns the TRANSCODER backend, which is local unless it
+// is "mediaconvert".
+func (cfg *apiConfig) newTranscoder(kind string, local *media.FFmpeg, awsCfg aws.Config) (media.Transcoder, error) {
+	switch strings.ToLower(kind) {
+	case "", "ffmpeg":
+		return local, nil
+	case "mediaconvert":
+		// Optional: MEDIACONVERT_QUEUE for a queue other than the default,
+		// MEDIACONVERT_ENDPOINT for an account specific endpoint, and
+		// MEDIACONVERT_PREFIX for where jobs stage files in the bucket
+		prefix := os.Getenv("MEDIACONVERT_PREFIX")
+		if prefix == "" {
+			prefix = defaultMediaConvertPrefix
+		}
+		return media.NewMediaConvert(media.MediaConvertConfig{
+			Endpoint:     os.Getenv("MEDIACONVERT_ENDPOINT"),
+			Region:       awsCfg.Region,
+			Role:         os.Getenv("MEDIACONVERT_ROLE_ARN"),
+			Queue:        os.Getenv("MEDIACONVERT_QUEUE"),
+			Bucket:       cfg.s3Bucket,
+			Prefix:       prefix,
+			PollInterval: envDuration("MEDIACONVERT_POLL_INTERVAL", 0),
+			Credentials:  awsCfg.Credentials,
+		}, local, local, s3ObjectStore{cfg})
+	default:
+		return nil, fmt.Errorf("unknown transcoder %q, expected ffmpeg or mediaconvert", kind)
+	}
+}
+
+// s3ObjectStore is the media.ObjectStore for the configured bucket.
+// Staged objects skip the storage class and tags uploads get, since they
+// only live for the length of a job.
+type s3ObjectStore struct {
+	cfg *apiConfig
+}
+
+func (s s3ObjectStore) Upload(ctx context.Context, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.cfg.s3Bucket),
+		Key:    aws.String(key),
+		Body:   f,
+	}
+	s.cfg.s3SSE.applyToPut(input)
+	_, err = s.cfg.s3Client.PutObject(ctx, input)
+	return err
+}
+
+func (s s3ObjectStore) Download(ctx context.Context, key, path string) error {
+	out, err := s.cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, out.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s s3ObjectStore) Delete(ctx context.Context, key string) error {
+	_, err := s.cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
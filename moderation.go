@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/moderation"
+	"github.com/google/uuid"
+)
+
+const defaultModerationFrames = 5
+
+// newClassifier builds the classifier named by MODERATION_CLASSIFIER, or
+// returns nil when moderation is disabled.
+func newClassifier(kind, endpoint string, minConfidence int, awsCfg aws.Config) (moderation.Classifier, error) {
+	switch strings.ToLower(kind) {
+	case "":
+		return nil, nil
+	case "rekognition":
+		return moderation.NewRekognition(rekognition.NewFromConfig(awsCfg), float32(minConfidence)), nil
+	case "http":
+		if endpoint == "" {
+			return nil, fmt.Errorf("MODERATION_ENDPOINT must be set for the http classifier")
+		}
+		return moderation.NewHTTPClassifier(endpoint, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown classifier %q, expected rekognition or http", kind)
+	}
+}
+
+// moderateVideo samples frames evenly across the video and classifies each
+// one, returning the combined verdict.
+func (cfg *apiConfig) moderateVideo(ctx context.Context, inputPath string) (moderation.Verdict, error) {
+	duration, err := cfg.prober.Duration(ctx, inputPath)
+	if err != nil {
+		return moderation.Verdict{}, fmt.Errorf("failed to analyze video: %w", err)
+	}
+
+	frameDir, err := os.MkdirTemp(cfg.tempDir, "tubely-moderation-*")
+	if err != nil {
+		return moderation.Verdict{}, err
+	}
+	defer os.RemoveAll(frameDir)
+
+	verdicts := make([]moderation.Verdict, 0, cfg.moderationFrames)
+	for i := 0; i < cfg.moderationFrames; i++ {
+		// Sample the middle of each of n equal segments
+		timestamp := duration * (float64(i) + 0.5) / float64(cfg.moderationFrames)
+		framePath := filepath.Join(frameDir, fmt.Sprintf("frame-%d.jpg", i))
+		if err := cfg.transcoder.Poster(ctx, inputPath, framePath, timestamp); err != nil {
+			return moderation.Verdict{}, fmt.Errorf("frame extraction failed: %w", err)
+		}
+		frame, err := os.ReadFile(framePath)
+		if err != nil {
+			return moderation.Verdict{}, err
+		}
+
+		verdict, err := cfg.classifier.Classify(ctx, frame)
+		if err != nil {
+			return moderation.Verdict{}, err
+		}
+		verdicts = append(verdicts, verdict)
+	}
+	return moderation.Merge(verdicts...), nil
+}
+
+// applyModerationVerdict sets the video's moderation fields. Flagged videos
+// are held for review; the rest are approved straight away.
+func applyModerationVerdict(video database.Video, verdict moderation.Verdict) database.Video {
+	video.ModerationLabels = strings.Join(verdict.Labels, ",")
+	video.ModerationReason = nil
+	if verdict.Flagged {
+		video.ModerationStatus = database.ModerationPending
+	} else {
+		video.ModerationStatus = database.ModerationApproved
+	}
+	return video
+}
+
+// videoVisibleTo reports whether the requester may see the video. Private
+// videos and videos held or rejected by moderation are only visible to
+// their owner and admins, or for organization videos to its members and
+// admins; everything else is reachable by anyone with its ID.
+func (cfg *apiConfig) videoVisibleTo(r *http.Request, video database.Video) bool {
+	if !videoRestricted(video) {
+		return true
+	}
+	if video.OrgID == nil {
+		return cfg.isOwnerOrAdmin(r, video.UserID)
+	}
+	if userID := cfg.requesterID(r); userID != uuid.Nil {
+		role, err := cfg.db.WithContext(r.Context()).GetOrgRole(*video.OrgID, userID)
+		if err == nil && role != "" {
+			return true
+		}
+	}
+	return cfg.isAdminRequest(r)
+}
+
+// videoRestricted reports whether only some users may see the video: it
+// is private or held by moderation.
+func videoRestricted(video database.Video) bool {
+	held := video.ModerationStatus == database.ModerationPending || video.ModerationStatus == database.ModerationRejected
+	return held || video.Visibility == database.VisibilityPrivate
+}
+
+// isOwnerOrAdmin reports whether the request carries a token of ownerID or
+// of an admin.
+func (cfg *apiConfig) isOwnerOrAdmin(r *http.Request, ownerID uuid.UUID) bool {
+	userID := cfg.requesterID(r)
+	if userID == uuid.Nil {
+		return false
+	}
+	if userID == ownerID {
+		return true
+	}
+	return cfg.isAdmin(r.Context(), userID)
+}
+
+// isAdminRequest reports whether the request carries an admin's token.
+func (cfg *apiConfig) isAdminRequest(r *http.Request) bool {
+	userID := cfg.requesterID(r)
+	return userID != uuid.Nil && cfg.isAdmin(r.Context(), userID)
+}
+
+func (cfg *apiConfig) isAdmin(ctx context.Context, userID uuid.UUID) bool {
+	user, err := cfg.db.WithContext(ctx).GetUser(userID)
+	return err == nil && user != nil && cfg.adminEmails[strings.ToLower(user.Email)]
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// defaultMultipartUploadTTL is how long a multipart upload may stay
+	// incomplete, which covers a chunked upload resumed the next day
+	defaultMultipartUploadTTL = 24 * time.Hour
+	multipartCleanupInterval  = time.Hour
+)
+
+// startMultipartCleanup aborts stale multipart uploads every
+// multipartCleanupInterval until the server shuts down.
+func (cfg *apiConfig) startMultipartCleanup() {
+	go func() {
+		ticker := time.NewTicker(multipartCleanupInterval)
+		defer ticker.Stop()
+		for {
+			cfg.abortStaleMultipartUploads(cfg.lifecycle.ctx)
+			select {
+			case <-ticker.C:
+			case <-cfg.lifecycle.drain:
+				return
+			}
+		}
+	}()
+}
+
+// abortStaleMultipartUploads aborts the tracked multipart uploads started
+// more than MULTIPART_UPLOAD_TTL ago, so parts left by abandoned chunked
+// uploads or a server that died mid-upload stop being billed. Chunked
+// uploads they backed become aborted. Uploads that fail to abort are tried
+// again next time.
+func (cfg *apiConfig) abortStaleMultipartUploads(ctx context.Context) {
+	uploads, err := cfg.db.WithContext(ctx).GetMultipartUploadsBefore(time.Now().Add(-cfg.multipartUploadTTL))
+	if err != nil {
+		slog.Error("Couldn't list stale multipart uploads", "error", err)
+		return
+	}
+	for _, upload := range uploads {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := cfg.abortMultipartUpload(ctx, upload.ObjectKey, upload.UploadID); err != nil {
+			slog.Warn("Couldn't abort stale multipart upload", "upload_id", upload.UploadID, "key", upload.ObjectKey, "error", err)
+			continue
+		}
+		if err := cfg.db.WithContext(ctx).AbortChunkedUploadByS3UploadID(upload.UploadID); err != nil {
+			slog.Warn("Couldn't mark chunked upload aborted", "upload_id", upload.UploadID, "error", err)
+		}
+		slog.Info("Aborted stale multipart upload", "upload_id", upload.UploadID, "key", upload.ObjectKey, "started_at", upload.CreatedAt)
+	}
+}
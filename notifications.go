@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultSMTPTimeout = 30 * time.Second
+	// defaultNotifyCompletedAfter is how long processing must take before
+	// its completion is worth an email
+	defaultNotifyCompletedAfter = 10 * time.Minute
+)
+
+// Notifications a user can get about their videos, also the names of their
+// templates
+const (
+	notificationProcessingFailed    = "processing_failed"
+	notificationProcessingCompleted = "processing_completed"
+)
+
+// newNotifier builds the configured notifier, or returns nil when
+// notifications are disabled.
+func newNotifier(kind, smtpAddr, from, username, password string, timeout time.Duration) (notify.Notifier, error) {
+	switch strings.ToLower(kind) {
+	case "":
+		return nil, nil
+	case "smtp":
+		if smtpAddr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR must be set for the smtp notifier")
+		}
+		return notify.NewSMTP(smtpAddr, from, username, password, timeout)
+	default:
+		return nil, fmt.Errorf("unknown notifier %q, expected smtp", kind)
+	}
+}
+
+// emailTemplate renders one notification. The data is an emailData.
+type emailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+type emailData struct {
+	VideoID    uuid.UUID
+	VideoTitle string
+	// JobKind is process_video, import_video or ingest_video
+	JobKind string
+	// Error is why processing failed
+	Error string
+	// Duration is how long processing took, from queueing to the end
+	Duration time.Duration
+}
+
+// defaultEmailTemplates are the built-in notifications by name and
+// language, each a subject line, a blank line and the body.
+var defaultEmailTemplates = map[string]map[string]string{
+	notificationProcessingFailed: {
+		"en": `Processing failed for "{{.VideoTitle}}"
+
+We couldn't process your video "{{.VideoTitle}}".
+
+Error: {{.Error}}
+
+Upload the file again to retry. If it keeps failing, contact support with video ID {{.VideoID}}.
+`,
+		"es": `No se pudo procesar "{{.VideoTitle}}"
+
+No pudimos procesar tu video "{{.VideoTitle}}".
+
+Error: {{.Error}}
+
+Vuelve a subir el archivo para intentarlo de nuevo. Si sigue fallando, contacta con soporte indicando el ID de video {{.VideoID}}.
+`,
+		"fr": `Échec du traitement de « {{.VideoTitle}} »
+
+Nous n'avons pas pu traiter votre vidéo « {{.VideoTitle}} ».
+
+Erreur : {{.Error}}
+
+Envoyez à nouveau le fichier pour réessayer. Si l'échec persiste, contactez le support avec l'identifiant de vidéo {{.VideoID}}.
+`,
+		"de": `Verarbeitung von „{{.VideoTitle}}“ fehlgeschlagen
+
+Wir konnten dein Video „{{.VideoTitle}}“ nicht verarbeiten.
+
+Fehler: {{.Error}}
+
+Lade die Datei erneut hoch, um es noch einmal zu versuchen. Wenn es weiterhin fehlschlägt, wende dich mit der Video-ID {{.VideoID}} an den Support.
+`,
+	},
+	notificationProcessingCompleted: {
+		"en": `"{{.VideoTitle}}" is ready
+
+Your video "{{.VideoTitle}}" has finished processing after {{.Duration}} and is ready to watch.
+`,
+		"es": `"{{.VideoTitle}}" está listo
+
+Tu video "{{.VideoTitle}}" terminó de procesarse tras {{.Duration}} y ya se puede ver.
+`,
+		"fr": `« {{.VideoTitle}} » est prête
+
+Le traitement de votre vidéo « {{.VideoTitle}} » s'est terminé en {{.Duration}} et elle peut être regardée.
+`,
+		"de": `„{{.VideoTitle}}“ ist fertig
+
+Dein Video „{{.VideoTitle}}“ wurde nach {{.Duration}} fertig verarbeitet und kann angesehen werden.
+`,
+	},
+}
+
+// loadEmailTemplates parses the built-in templates, replaced by files in
+// dir if it is set: <name>.<lang>.txt for one language or <name>.txt for
+// every language without its own file.
+func loadEmailTemplates(dir string) (map[string]map[string]emailTemplate, error) {
+	templates := map[string]map[string]emailTemplate{}
+	for name, byLang := range defaultEmailTemplates {
+		templates[name] = map[string]emailTemplate{}
+		var shared string
+		if dir != "" {
+			dat, err := os.ReadFile(filepath.Join(dir, name+".txt"))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			shared = string(dat)
+		}
+		for lang, text := range byLang {
+			if shared != "" {
+				text = shared
+			}
+			if dir != "" {
+				dat, err := os.ReadFile(filepath.Join(dir, name+"."+lang+".txt"))
+				if err != nil && !os.IsNotExist(err) {
+					return nil, err
+				}
+				if len(dat) > 0 {
+					text = string(dat)
+				}
+			}
+			tmpl, err := parseEmailTemplate(name+"."+lang, text)
+			if err != nil {
+				return nil, err
+			}
+			templates[name][lang] = tmpl
+		}
+	}
+	return templates, nil
+}
+
+func parseEmailTemplate(name, text string) (emailTemplate, error) {
+	subject, body, ok := strings.Cut(strings.TrimLeft(text, "\r\n"), "\n")
+	if !ok || strings.TrimSpace(subject) == "" {
+		return emailTemplate{}, fmt.Errorf("template %s: the first line must be the subject", name)
+	}
+	subjectTmpl, err := template.New(name + " subject").Parse(strings.TrimSpace(subject))
+	if err != nil {
+		return emailTemplate{}, err
+	}
+	bodyTmpl, err := template.New(name).Parse(strings.TrimLeft(body, "\r\n"))
+	if err != nil {
+		return emailTemplate{}, err
+	}
+	return emailTemplate{subject: subjectTmpl, body: bodyTmpl}, nil
+}
+
+func (t emailTemplate) render(to string, data emailData) (notify.Message, error) {
+	var subject, body strings.Builder
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return notify.Message{}, err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return notify.Message{}, err
+	}
+	return notify.Message{To: to, Subject: subject.String(), Body: body.String()}, nil
+}
+
+// notifyJobFinished emails the owner of a video processing job that failed
+// for good, or that completed after taking at least notifyCompletedAfter,
+// if their preferences allow. It sends in the background.
+func (cfg *apiConfig) notifyJobFinished(job database.Job) {
+	if cfg.notifier == nil {
+		return
+	}
+	switch job.Kind {
+	case jobKindProcessVideo, jobKindImportVideo, jobKindIngestVideo:
+	default:
+		return
+	}
+
+	data := emailData{
+		VideoID:  job.VideoID,
+		JobKind:  job.Kind,
+		Duration: time.Since(job.CreatedAt).Round(time.Second),
+	}
+	var name string
+	switch job.Status {
+	case database.JobStatusFailed, database.JobStatusDeadLettered:
+		name = notificationProcessingFailed
+		if job.Error != nil {
+			data.Error = *job.Error
+		}
+	case database.JobStatusCompleted:
+		if data.Duration < cfg.notifyCompletedAfter {
+			return
+		}
+		name = notificationProcessingCompleted
+	default:
+		return
+	}
+	go cfg.sendNotification(job.UserID, name, data)
+}
+
+func (cfg *apiConfig) sendNotification(userID uuid.UUID, name string, data emailData) {
+	logger := slog.With("user_id", userID, "video_id", data.VideoID, "notification", name)
+	prefs, err := cfg.db.GetNotificationPreferences(userID)
+	if err != nil {
+		logger.Warn("Couldn't get notification preferences", "error", err)
+		return
+	}
+	if (name == notificationProcessingFailed && !prefs.ProcessingFailed) ||
+		(name == notificationProcessingCompleted && !prefs.ProcessingCompleted) {
+		return
+	}
+	user, err := cfg.db.GetUser(userID)
+	if err != nil || user == nil {
+		logger.Warn("Couldn't get user to notify", "error", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(data.VideoID)
+	if err != nil {
+		logger.Warn("Couldn't get video to notify about", "error", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		return
+	}
+	data.VideoTitle = video.Title
+
+	tmpl, ok := cfg.emailTemplates[name][prefs.Language]
+	if !ok {
+		tmpl = cfg.emailTemplates[name][i18n.DefaultLanguage]
+	}
+	msg, err := tmpl.render(user.Email, data)
+	if err != nil {
+		logger.Error("Couldn't render notification", "error", err)
+		return
+	}
+	if err := cfg.notifier.Send(context.Background(), msg); err != nil {
+		logger.Warn("Couldn't send notification", "error", err)
+		return
+	}
+	logger.Info("Sent notification")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultKeyTemplate reproduces the original layout: videos under their
+// aspect ratio, previews and clips under their own folders.
+const defaultKeyTemplate = "{folder}/{random}.{ext}"
+
+// Renditions passed to key templates
+const (
+	// renditionStream is the faststart MP4 that clients play
+	renditionStream = "stream"
+	// renditionOriginal is the untouched upload, kept for archival
+	renditionOriginal = "original"
+	renditionPreview  = "preview"
+	// renditionSDR is the tonemapped copy of an HDR stream
+	renditionSDR  = "sdr"
+	renditionClip = "clip"
+)
+
+// keyTemplateVars documents the variables a key template may use.
+var keyTemplateVars = map[string]bool{
+	"userID":    true, // owner of the video
+	"orgID":     true, // organization of the video, or "personal"
+	"videoID":   true,
+	"aspect":    true, // category from ASPECT_CATEGORIES, or other
+	"rendition": true, // stream, original, preview, sdr or clip-<jobID>
+	"folder":    true, // aspect for streams, otherwise "originals", "previews", "sdr" or "clips"
+	"random":    true, // 43 random URL-safe characters
+	"ext":       true, // file extension without the dot
+	"yyyy":      true, // upload date, UTC
+	"mm":        true,
+	"dd":        true,
+}
+
+// objectKeyParams are the values available when rendering a key template.
+type objectKeyParams struct {
+	UserID uuid.UUID
+	// OrgID is set for organization videos
+	OrgID     *uuid.UUID
+	VideoID   uuid.UUID
+	Aspect    string
+	Rendition string
+	Folder    string
+	Ext       string
+}
+
+// keyTemplate is a parsed S3_KEY_TEMPLATE such as
+// "{userID}/{videoID}/{rendition}.{ext}".
+type keyTemplate struct {
+	raw string
+}
+
+func parseKeyTemplate(raw string) (keyTemplate, error) {
+	if raw == "" {
+		raw = defaultKeyTemplate
+	}
+	if strings.HasPrefix(raw, "/") {
+		return keyTemplate{}, fmt.Errorf("key template %q must not start with /", raw)
+	}
+
+	rest := raw
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return keyTemplate{}, fmt.Errorf("key template %q has an unmatched }", raw)
+			}
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return keyTemplate{}, fmt.Errorf("key template %q has an unmatched {", raw)
+		}
+		name := rest[open+1 : open+end]
+		if !keyTemplateVars[name] {
+			return keyTemplate{}, fmt.Errorf("key template %q uses unknown variable {%s}", raw, name)
+		}
+		rest = rest[open+end+1:]
+	}
+
+	// Without one of these, distinct objects would overwrite each other
+	if !strings.Contains(raw, "{random}") && !strings.Contains(raw, "{rendition}") {
+		return keyTemplate{}, fmt.Errorf("key template %q must include {random} or {rendition}", raw)
+	}
+	return keyTemplate{raw: raw}, nil
+}
+
+// render fills in the template. Empty values render as "unknown" so keys
+// never contain empty path segments. Organization videos are kept under
+// orgs/<orgID>/ unless the template places {orgID} itself.
+func (t keyTemplate) render(p objectKeyParams) (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate filename: %w", err)
+	}
+	now := time.Now().UTC()
+	orgID := "personal"
+	if p.OrgID != nil {
+		orgID = p.OrgID.String()
+	}
+
+	values := map[string]string{
+		"userID":    p.UserID.String(),
+		"orgID":     orgID,
+		"videoID":   p.VideoID.String(),
+		"aspect":    p.Aspect,
+		"rendition": p.Rendition,
+		"folder":    p.Folder,
+		"random":    base64.RawURLEncoding.EncodeToString(randomBytes),
+		"ext":       p.Ext,
+		"yyyy":      now.Format("2006"),
+		"mm":        now.Format("01"),
+		"dd":        now.Format("02"),
+	}
+
+	var b strings.Builder
+	if p.OrgID != nil && !strings.Contains(t.raw, "{orgID}") {
+		b.WriteString("orgs/" + orgID + "/")
+	}
+	rest := t.raw
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			b.WriteString(rest)
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		b.WriteString(rest[:open])
+		value := values[rest[open+1:open+end]]
+		if value == "" {
+			value = "unknown"
+		}
+		b.WriteString(strings.ReplaceAll(value, "/", "-"))
+		rest = rest[open+end+1:]
+	}
+
+	key := path.Clean(b.String())
+	if strings.HasPrefix(key, "..") || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("key template rendered an invalid key %q", key)
+	}
+	return key, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// oembedMaxSize is the box the player is fitted in when the consumer
+// doesn't ask for a smaller one.
+const oembedMaxSize = 640
+
+// oembedResponse is an oEmbed 1.0 video response, see https://oembed.com.
+type oembedResponse struct {
+	Type         string `json:"type"`
+	Version      string `json:"version"`
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	// The thumbnail fields are left out together when its size is unknown
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+	// HTML is an iframe of the embed player
+	HTML   string `json:"html"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// oembedURL is where consumers look up the video, as linked from its
+// embed player.
+func oembedURL(baseURL string, videoID uuid.UUID) string {
+	return baseURL + "/oembed?url=" + url.QueryEscape(baseURL+"/embed/"+videoID.String())
+}
+
+// oembedVideoID finds the video a link points at: the embed player
+// /embed/{videoID} or the API's /api/v1/videos/{videoID}, under any host
+// and prefix.
+func oembedVideoID(raw string) (uuid.UUID, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return uuid.Nil, fmt.Errorf("url %q must be an http or https link", raw)
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := len(segments) - 2; i >= 0; i-- {
+		if segments[i] == "embed" || segments[i] == "videos" {
+			if id, err := uuid.Parse(segments[i+1]); err == nil {
+				return id, nil
+			}
+		}
+	}
+	return uuid.Nil, fmt.Errorf("url %q isn't a link to a video", raw)
+}
+
+// videoAdvertised reports whether link previews may describe the video:
+// it's public, not held by moderation, and has an uploaded file. Unlisted
+// videos aren't advertised, even to those who have the link.
+func videoAdvertised(video database.Video) bool {
+	return video.Visibility == database.VisibilityPublic && !videoRestricted(video) &&
+		video.VideoURL != nil && *video.VideoURL != ""
+}
+
+// fitPlayer scales width by height down to fit in maxWidth by maxHeight,
+// keeping the aspect ratio.
+func fitPlayer(width, height, maxWidth, maxHeight int) (int, int) {
+	if width > maxWidth {
+		height, width = max(1, height*maxWidth/width), maxWidth
+	}
+	if height > maxHeight {
+		width, height = max(1, width*maxHeight/height), maxHeight
+	}
+	return width, height
+}
+
+// handlerOEmbed describes a public video for link previews in chat apps
+// and CMSes, as an oEmbed provider that only speaks JSON.
+func (cfg *apiConfig) handlerOEmbed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		respondWithError(w, http.StatusNotImplemented, "Only the json oEmbed format is supported", fmt.Errorf("format %q", format))
+		return
+	}
+	videoID, err := oembedVideoID(query.Get("url"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid oEmbed URL", err)
+		return
+	}
+	maxWidth, maxHeight := oembedMaxSize, oembedMaxSize
+	for _, limit := range []struct {
+		name  string
+		value *int
+	}{{"maxwidth", &maxWidth}, {"maxheight", &maxHeight}} {
+		if raw := query.Get(limit.name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				respondWithError(w, http.StatusBadRequest, "Invalid oEmbed size", err)
+				return
+			}
+			*limit.value = min(n, *limit.value)
+		}
+	}
+
+	video, err := cfg.db.WithContext(r.Context()).GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+	if video.ID == uuid.Nil || !videoAdvertised(video) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	width, height := 16, 9
+	if video.Width != nil && video.Height != nil && *video.Width > 0 && *video.Height > 0 {
+		width, height = *video.Width, *video.Height
+	}
+	// Scale up first so small videos fill the box too
+	width, height = fitPlayer(width*oembedMaxSize, height*oembedMaxSize, maxWidth, maxHeight)
+
+	base := cfg.baseURL(r)
+	resp := oembedResponse{
+		Type:         "video",
+		Version:      "1.0",
+		Title:        video.Title,
+		ProviderName: "Tubely",
+		ProviderURL:  base,
+		HTML: fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" title="%s" frameborder="0" allow="fullscreen; picture-in-picture" allowfullscreen></iframe>`,
+			html.EscapeString(base+"/embed/"+video.ID.String()), width, height, html.EscapeString(video.Title)),
+		Width:  width,
+		Height: height,
+	}
+	if video.ThumbnailURL != nil {
+		if tw, th, ok := cfg.assetImageSize(*video.ThumbnailURL); ok {
+			resp.ThumbnailURL, resp.ThumbnailWidth, resp.ThumbnailHeight = *video.ThumbnailURL, tw, th
+		}
+	}
+	annotateLog(w, "video_id", video.ID)
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+const openAPIVersion = "3.0.3"
+
+// binaryBody marks a route whose response is raw bytes of the given type
+// rather than JSON.
+type binaryBody string
+
+var pathParamRe = regexp.MustCompile(`\{([^}]+)\}`)
+
+// openAPIBuilder turns the route table into an OpenAPI document, deriving
+// schemas from the Go types the handlers decode and encode. Named struct
+// types become shared components.
+type openAPIBuilder struct {
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+// buildOpenAPISpec renders the document served at /api/v1/openapi.json.
+func buildOpenAPISpec(routes []apiRoute) ([]byte, error) {
+	b := &openAPIBuilder{
+		schemas: map[string]any{
+			"Error": map[string]any{
+				"type":     "object",
+				"required": []string{"error", "code"},
+				"properties": map[string]any{
+					"error":      map[string]any{"type": "string", "description": "Message in the negotiated language"},
+					"code":       map[string]any{"type": "string", "description": "Stable machine-readable code, listed in the README"},
+					"request_id": map[string]any{"type": "string"},
+				},
+			},
+		},
+		names: map[reflect.Type]string{},
+	}
+
+	paths := map[string]map[string]any{}
+	for _, route := range routes {
+		if route.Legacy {
+			continue
+		}
+		if paths[route.Path] == nil {
+			paths[route.Path] = map[string]any{}
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = b.operation(route)
+	}
+
+	return json.MarshalIndent(map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "Tubely API",
+			"version": "1",
+		},
+		"servers": []any{map[string]any{"url": "/"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}, "", "  ")
+}
+
+func (b *openAPIBuilder) operation(route apiRoute) map[string]any {
+	op := map[string]any{
+		"summary":     route.Summary,
+		"operationId": route.OperationID,
+		"tags":        []string{route.Tag},
+	}
+	if route.Auth {
+		op["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+	}
+
+	var params []any
+	for _, m := range pathParamRe.FindAllStringSubmatch(route.Path, -1) {
+		// IDs are UUIDs; other path values, like version numbers, are integers
+		schema := map[string]any{"type": "integer"}
+		if strings.HasSuffix(m[1], "ID") {
+			schema = map[string]any{"type": "string", "format": "uuid"}
+		}
+		params = append(params, map[string]any{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+	for _, q := range route.Query {
+		params = append(params, map[string]any{
+			"name":        q.Name,
+			"in":          "query",
+			"description": q.Description,
+			"schema":      map[string]any{"type": "string"},
+		})
+	}
+	if route.Idempotent {
+		params = append(params, map[string]any{
+			"name":        idempotencyKeyHeader,
+			"in":          "header",
+			"description": "Retries with the same key replay the first successful response",
+			"schema":      map[string]any{"type": "string", "maxLength": maxIdempotencyKeyLength},
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	switch {
+	case route.Request != nil:
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(route.Request))},
+			},
+		}
+	case route.Upload != "":
+		file := map[string]any{"type": "string", "format": "binary"}
+		if route.UploadMultiple {
+			file = map[string]any{"type": "array", "items": file}
+		}
+		properties := map[string]any{route.Upload: file}
+		for _, field := range route.FormFields {
+			properties[field.Name] = map[string]any{"type": "string", "description": field.Description}
+		}
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"multipart/form-data": map[string]any{"schema": map[string]any{
+					"type":       "object",
+					"required":   []string{route.Upload},
+					"properties": properties,
+				}},
+			},
+		}
+	}
+
+	responses := map[string]any{
+		"default": map[string]any{
+			"description": "Error",
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}},
+			},
+		},
+	}
+	for _, resp := range route.Responses {
+		out := map[string]any{"description": resp.Description}
+		switch body := resp.Body.(type) {
+		case nil:
+		case binaryBody:
+			out["content"] = map[string]any{
+				string(body): map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+			}
+		default:
+			out["content"] = map[string]any{
+				"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(body))},
+			}
+		}
+		responses[strconv.Itoa(resp.Status)] = out
+	}
+	op["responses"] = responses
+	return op
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// schema returns the JSON schema for t, registering named structs as
+// components and referencing them.
+func (b *openAPIBuilder) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schema(t.Elem())
+		if _, isRef := s["$ref"]; isRef {
+			// OpenAPI 3.0 ignores siblings of $ref
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + b.component(t)}
+	default:
+		return map[string]any{}
+	}
+}
+
+// component registers the named struct t and returns its component name.
+func (b *openAPIBuilder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := exportedName(t.Name())
+	if _, taken := b.schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = exportedName(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	b.names[t] = name
+	// Reserve the name before recursing so self references terminate
+	b.schemas[name] = nil
+	b.schemas[name] = b.structSchema(t)
+	return name
+}
+
+func (b *openAPIBuilder) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	b.addFields(t, properties, &required)
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// addFields collects t's JSON fields, inlining embedded structs the way
+// encoding/json does.
+func (b *openAPIBuilder) addFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			b.addFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// handlerOpenAPI serves the spec built at startup.
+func (cfg *apiConfig) handlerOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(cfg.openAPISpec)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// socialMetaTag is one <meta> tag of a link preview. Open Graph tags use
+// the property attribute and Twitter cards the name attribute.
+type socialMetaTag struct {
+	Attribute string `json:"attribute"`
+	Key       string `json:"key"`
+	Content   string `json:"content"`
+}
+
+type socialMetadataResponse struct {
+	Tags []socialMetaTag `json:"tags"`
+	// HTML is the tags ready to paste into a page's <head>
+	HTML string `json:"html"`
+}
+
+// socialMetaTags builds the Open Graph and Twitter card tags of an
+// advertised video. The video points at the stream endpoint rather than a
+// presigned URL, since unfurlers cache previews for longer than those last.
+func (cfg *apiConfig) socialMetaTags(r *http.Request, video database.Video) []socialMetaTag {
+	base := cfg.baseURL(r)
+	embedURL := base + "/embed/" + video.ID.String()
+	streamURL := base + apiV1 + "/videos/" + video.ID.String() + "/stream"
+
+	var tags []socialMetaTag
+	add := func(key, content string) {
+		attribute := "property"
+		if strings.HasPrefix(key, "twitter:") {
+			attribute = "name"
+		}
+		tags = append(tags, socialMetaTag{Attribute: attribute, Key: key, Content: content})
+	}
+	add("og:type", "video.other")
+	add("og:site_name", "Tubely")
+	add("og:title", video.Title)
+	if video.Description != "" {
+		add("og:description", video.Description)
+	}
+	add("og:url", embedURL)
+	add("og:video", streamURL)
+	if strings.HasPrefix(streamURL, "https://") {
+		add("og:video:secure_url", streamURL)
+	}
+	add("og:video:type", "video/mp4")
+	// Dimensions are only known once ffprobe has looked at the upload
+	hasSize := video.Width != nil && video.Height != nil && *video.Width > 0 && *video.Height > 0
+	if hasSize {
+		add("og:video:width", strconv.Itoa(*video.Width))
+		add("og:video:height", strconv.Itoa(*video.Height))
+	}
+	if video.ThumbnailURL != nil {
+		add("og:image", *video.ThumbnailURL)
+		if width, height, ok := cfg.assetImageSize(*video.ThumbnailURL); ok {
+			add("og:image:width", strconv.Itoa(width))
+			add("og:image:height", strconv.Itoa(height))
+		}
+	}
+
+	add("twitter:card", "player")
+	add("twitter:title", video.Title)
+	if video.Description != "" {
+		add("twitter:description", video.Description)
+	}
+	if video.ThumbnailURL != nil {
+		add("twitter:image", *video.ThumbnailURL)
+	}
+	add("twitter:player", embedURL)
+	width, height := 16, 9
+	if hasSize {
+		width, height = *video.Width, *video.Height
+	}
+	width, height = fitPlayer(width*oembedMaxSize, height*oembedMaxSize, oembedMaxSize, oembedMaxSize)
+	add("twitter:player:width", strconv.Itoa(width))
+	add("twitter:player:height", strconv.Itoa(height))
+	add("twitter:player:stream", streamURL)
+	add("twitter:player:stream:content_type", "video/mp4")
+	return tags
+}
+
+// socialMetaHTML renders tags as <meta> elements, one per line.
+func socialMetaHTML(tags []socialMetaTag) string {
+	var b strings.Builder
+	for _, tag := range tags {
+		b.WriteString(`<meta ` + tag.Attribute + `="` + html.EscapeString(tag.Key) + `" content="` + html.EscapeString(tag.Content) + "\">\n")
+	}
+	return b.String()
+}
+
+// handlerVideoSocialMetadata returns the Open Graph and Twitter card tags of
+// a public video, for sites that render their own pages around it.
+func (cfg *apiConfig) handlerVideoSocialMetadata(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+	if !videoAdvertised(video) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	tags := cfg.socialMetaTags(r, video)
+	respondWithJSON(w, http.StatusOK, socialMetadataResponse{Tags: tags, HTML: socialMetaHTML(tags)})
+}
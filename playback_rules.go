@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxPlaybackRules keeps rule checks on every stream request cheap.
+const maxPlaybackRules = 100
+
+type playbackRuleParams struct {
+	// Action is allow or deny
+	Action string `json:"action"`
+	// Kind is country or ip
+	Kind string `json:"kind"`
+	// Value is an ISO 3166-1 alpha-2 code for country rules, and an IP
+	// address or CIDR range for ip rules
+	Value string `json:"value"`
+}
+
+// parsePlaybackRule validates params and normalizes the value: country
+// codes to upper case and IP addresses to their masked CIDR range.
+func (cfg *apiConfig) parsePlaybackRule(params playbackRuleParams) (database.PlaybackRule, error) {
+	rule := database.PlaybackRule{
+		Action: strings.ToLower(strings.TrimSpace(params.Action)),
+		Kind:   strings.ToLower(strings.TrimSpace(params.Kind)),
+	}
+	if rule.Action != database.PlaybackRuleAllow && rule.Action != database.PlaybackRuleDeny {
+		return rule, fmt.Errorf("action %q must be allow or deny", params.Action)
+	}
+	value := strings.TrimSpace(params.Value)
+	switch rule.Kind {
+	case database.PlaybackRuleCountry:
+		value = strings.ToUpper(value)
+		if len(value) != 2 || strings.Trim(value, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return rule, fmt.Errorf("country %q isn't an ISO 3166-1 alpha-2 code", params.Value)
+		}
+		rule.Value = value
+	case database.PlaybackRuleIP:
+		prefix, err := parseIPRange(value)
+		if err != nil {
+			return rule, err
+		}
+		rule.Value = prefix.String()
+	default:
+		return rule, fmt.Errorf("kind %q must be country or ip", params.Kind)
+	}
+	return rule, nil
+}
+
+// parseIPRange reads a CIDR range, or a single address as the range of
+// just that address.
+func parseIPRange(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// viewerCountry is the country code the CDN or load balancer in front put
+// in GEO_COUNTRY_HEADER, or "" without one.
+func (cfg *apiConfig) viewerCountry(r *http.Request) string {
+	if cfg.geoCountryHeader == "" {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(r.Header.Get(cfg.geoCountryHeader)))
+}
+
+// playbackRuleMatches reports whether rule applies to a viewer from
+// country at addr. An unknown country matches no country rule.
+func playbackRuleMatches(rule database.PlaybackRule, country string, addr netip.Addr) bool {
+	switch rule.Kind {
+	case database.PlaybackRuleCountry:
+		return country != "" && rule.Value == country
+	case database.PlaybackRuleIP:
+		prefix, err := netip.ParsePrefix(rule.Value)
+		return err == nil && addr.IsValid() && prefix.Contains(addr)
+	}
+	return false
+}
+
+// playbackAllowed applies the video's rules to the caller. A matching deny
+// rule refuses them, and so does having allow rules none of which match.
+// Those who may manage the video, and admins, play it wherever they are.
+func (cfg *apiConfig) playbackAllowed(r *http.Request, video database.Video) (bool, error) {
+	rules, err := cfg.db.WithContext(r.Context()).ListPlaybackRules(video.ID)
+	if err != nil || len(rules) == 0 {
+		return err == nil, err
+	}
+	if userID := cfg.requesterID(r); userID != uuid.Nil {
+		canManage, err := cfg.canManageVideo(r.Context(), userID, video)
+		if err != nil {
+			return false, err
+		}
+		if canManage || cfg.isAdmin(r.Context(), userID) {
+			return true, nil
+		}
+	}
+
+	country := cfg.viewerCountry(r)
+	addr, _ := netip.ParseAddr(cfg.clientIP(r))
+	addr = addr.Unmap()
+	hasAllow, allowed := false, false
+	for _, rule := range rules {
+		matches := playbackRuleMatches(rule, country, addr)
+		if rule.Action == database.PlaybackRuleDeny && matches {
+			return false, nil
+		}
+		if rule.Action == database.PlaybackRuleAllow {
+			hasAllow = true
+			allowed = allowed || matches
+		}
+	}
+	return allowed || !hasAllow, nil
+}
+
+// checkPlaybackRules answers 403 if the video's rules refuse the caller
+// and reports whether playback may go ahead.
+func (cfg *apiConfig) checkPlaybackRules(w http.ResponseWriter, r *http.Request, video database.Video) bool {
+	allowed, err := cfg.playbackAllowed(r, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check playback rules", err)
+		return false
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "Playback isn't allowed from your location", nil)
+		return false
+	}
+	return true
+}
+
+// handlerPlaybackRulesList lists the video's playback rules.
+func (cfg *apiConfig) handlerPlaybackRulesList(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	rules, err := cfg.db.WithContext(r.Context()).ListPlaybackRules(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playback rules", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, rules)
+}
+
+// decodePlaybackRule reads and validates a rule from the request body. If
+// it's invalid the error response has already been written and ok is false.
+func (cfg *apiConfig) decodePlaybackRule(w http.ResponseWriter, r *http.Request) (rule database.PlaybackRule, ok bool) {
+	var params playbackRuleParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return rule, false
+	}
+	rule, err := cfg.parsePlaybackRule(params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playback rule", err)
+		return rule, false
+	}
+	if rule.Kind == database.PlaybackRuleCountry && cfg.geoCountryHeader == "" {
+		// Nobody's country would be known, so the rule would never match
+		respondWithError(w, http.StatusBadRequest, "Country rules need GEO_COUNTRY_HEADER", nil)
+		return rule, false
+	}
+	return rule, true
+}
+
+// handlerPlaybackRuleCreate adds a playback rule to the video.
+func (cfg *apiConfig) handlerPlaybackRuleCreate(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	rule, ok := cfg.decodePlaybackRule(w, r)
+	if !ok {
+		return
+	}
+	rules, err := cfg.db.WithContext(r.Context()).ListPlaybackRules(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playback rules", err)
+		return
+	}
+	if len(rules) >= maxPlaybackRules {
+		respondWithError(w, http.StatusBadRequest, "Too many playback rules", fmt.Errorf("videos have at most %d", maxPlaybackRules))
+		return
+	}
+
+	rule, err = cfg.db.WithContext(r.Context()).CreatePlaybackRule(video.ID, rule.Action, rule.Kind, rule.Value)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create playback rule", err)
+		return
+	}
+	requestAudit(r).Set("rule_id", rule.ID)
+	respondWithJSON(w, http.StatusCreated, rule)
+}
+
+// getPlaybackRule resolves the {ruleID} path value to one of video's
+// rules. If it isn't one the error response has already been written and
+// ok is false.
+func (cfg *apiConfig) getPlaybackRule(w http.ResponseWriter, r *http.Request, video database.Video) (database.PlaybackRule, bool) {
+	ruleID, err := uuid.Parse(r.PathValue("ruleID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playback rule ID", err)
+		return database.PlaybackRule{}, false
+	}
+	rule, err := cfg.db.WithContext(r.Context()).GetPlaybackRule(ruleID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playback rules", err)
+		return database.PlaybackRule{}, false
+	}
+	if rule.ID == uuid.Nil || rule.VideoID != video.ID {
+		respondWithError(w, http.StatusNotFound, "Playback rule not found", nil)
+		return database.PlaybackRule{}, false
+	}
+	return rule, true
+}
+
+// handlerPlaybackRuleUpdate replaces one of the video's playback rules.
+func (cfg *apiConfig) handlerPlaybackRuleUpdate(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	rule, ok := cfg.getPlaybackRule(w, r, video)
+	if !ok {
+		return
+	}
+	updated, ok := cfg.decodePlaybackRule(w, r)
+	if !ok {
+		return
+	}
+
+	rule.Action, rule.Kind, rule.Value = updated.Action, updated.Kind, updated.Value
+	if err := cfg.db.WithContext(r.Context()).UpdatePlaybackRule(rule); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update playback rule", err)
+		return
+	}
+	requestAudit(r).Set("rule_id", rule.ID)
+	respondWithJSON(w, http.StatusOK, rule)
+}
+
+// handlerPlaybackRuleDelete removes one of the video's playback rules.
+func (cfg *apiConfig) handlerPlaybackRuleDelete(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	rule, ok := cfg.getPlaybackRule(w, r, video)
+	if !ok {
+		return
+	}
+	if err := cfg.db.WithContext(r.Context()).DeletePlaybackRule(rule.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete playback rule", err)
+		return
+	}
+	requestAudit(r).Set("rule_id", rule.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestParsePlaybackRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  playbackRuleParams
+		want    string
+		wantErr bool
+	}{
+		{"country is upper cased", playbackRuleParams{"Deny", "country", " de "}, "DE", false},
+		{"address becomes a range", playbackRuleParams{"allow", "ip", "203.0.113.7"}, "203.0.113.7/32", false},
+		{"mapped address is unmapped", playbackRuleParams{"allow", "ip", "::ffff:203.0.113.7"}, "203.0.113.7/32", false},
+		{"IPv6 address", playbackRuleParams{"allow", "ip", "2001:db8::1"}, "2001:db8::1/128", false},
+		{"range is masked", playbackRuleParams{"deny", "IP", "203.0.113.7/24"}, "203.0.113.0/24", false},
+		{"unknown action", playbackRuleParams{"block", "country", "DE"}, "", true},
+		{"unknown kind", playbackRuleParams{"deny", "asn", "64496"}, "", true},
+		{"three letter country", playbackRuleParams{"deny", "country", "DEU"}, "", true},
+		{"country with digits", playbackRuleParams{"deny", "country", "D1"}, "", true},
+		{"bad address", playbackRuleParams{"deny", "ip", "203.0.113"}, "", true},
+		{"bad range", playbackRuleParams{"deny", "ip", "203.0.113.0/33"}, "", true},
+	}
+	cfg := &apiConfig{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := cfg.parsePlaybackRule(tt.params)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule.Value != tt.want {
+				t.Errorf("value is %q, want %q", rule.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaybackRuleMatches(t *testing.T) {
+	country := database.PlaybackRule{Kind: database.PlaybackRuleCountry, Value: "DE"}
+	ipRange := database.PlaybackRule{Kind: database.PlaybackRuleIP, Value: "203.0.113.0/24"}
+	tests := []struct {
+		name    string
+		rule    database.PlaybackRule
+		country string
+		addr    string
+		want    bool
+	}{
+		{"same country", country, "DE", "", true},
+		{"other country", country, "FR", "", false},
+		{"unknown country", country, "", "", false},
+		{"address in range", ipRange, "", "203.0.113.200", true},
+		{"address outside range", ipRange, "", "198.51.100.1", false},
+		{"unknown address", ipRange, "DE", "", false},
+		{"unknown kind", database.PlaybackRule{Kind: "asn", Value: "DE"}, "DE", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var addr netip.Addr
+			if tt.addr != "" {
+				addr = netip.MustParseAddr(tt.addr)
+			}
+			if got := playbackRuleMatches(tt.rule, tt.country, addr); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyPlaybackRules(t *testing.T) {
+	cfg, _, _ := newTestConfig(t)
+	source := createTestVideo(t, cfg, "talk")
+	trimmed := createTestVideo(t, cfg, "talk (trimmed)")
+	for _, rule := range []database.PlaybackRule{
+		{Action: database.PlaybackRuleAllow, Kind: database.PlaybackRuleCountry, Value: "DE"},
+		{Action: database.PlaybackRuleDeny, Kind: database.PlaybackRuleIP, Value: "203.0.113.0/24"},
+	} {
+		if _, err := cfg.db.CreatePlaybackRule(source.ID, rule.Action, rule.Kind, rule.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cfg.db.CopyPlaybackRules(source.ID, trimmed.ID); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := cfg.db.ListPlaybackRules(trimmed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, rule := range rules {
+		got[rule.Action+" "+rule.Kind+" "+rule.Value] = true
+	}
+	if len(rules) != 2 || !got["allow country DE"] || !got["deny ip 203.0.113.0/24"] {
+		t.Errorf("trim has rules %+v", rules)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Supported POSTER_MODE values
+const (
+	posterModeLocal  = "local"
+	posterModeLambda = "lambda"
+)
+
+const (
+	// posterHookMaxSkew is how far X-Tubely-Timestamp may be from now,
+	// which bounds how long a captured request can be replayed
+	posterHookMaxSkew   = 5 * time.Minute
+	maxPosterResultSize = 64 << 10
+	// posterResultRetryAfter is what a result that arrives before its
+	// upload is committed is told to wait
+	posterResultRetryAfter = 10 * time.Second
+)
+
+// errPosterResultEarly means the result is for an upload whose processing
+// hasn't finished, so the video doesn't point at the rendition yet.
+var errPosterResultEarly = errors.New("video is still processing")
+
+// posterResult is what the poster Lambda reports after handling a stream
+// rendition, over POSTER_QUEUE_URL or the poster webhook.
+type posterResult struct {
+	VideoID uuid.UUID `json:"video_id"`
+	// Bucket and Key are the stream rendition the poster was taken from
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// PosterKey is the JPEG the Lambda wrote to the same bucket
+	PosterKey string  `json:"poster_key"`
+	Timestamp float64 `json:"timestamp"`
+	// Error is set instead of PosterKey when extraction failed
+	Error string `json:"error,omitempty"`
+}
+
+// applyPosterResult makes the poster in result the video's thumbnail and
+// deletes the Lambda's copy. Results for videos that are gone, were
+// re-uploaded since or got a thumbnail in the meantime are dropped. Only
+// errors worth retrying are returned.
+func (cfg *apiConfig) applyPosterResult(ctx context.Context, result posterResult) error {
+	if result.Bucket != cfg.s3Bucket {
+		slog.Warn("Dropping poster result for another bucket", "bucket", result.Bucket, "key", result.Key)
+		return nil
+	}
+	store := s3ObjectStore{cfg}
+	dropPoster := func() {
+		if result.PosterKey == "" {
+			return
+		}
+		if err := store.Delete(ctx, result.PosterKey); err != nil {
+			slog.Warn("Couldn't delete Lambda poster", "key", result.PosterKey, "error", err)
+		}
+	}
+
+	video, err := cfg.db.WithContext(ctx).GetVideo(result.VideoID)
+	if err != nil {
+		return fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		dropPoster()
+		return nil
+	}
+	if video.VideoURL == nil || *video.VideoURL != result.Bucket+","+result.Key {
+		if video.ProcessingStatus == database.ProcessingInProgress {
+			return errPosterResultEarly
+		}
+		slog.Info("Dropping poster for a replaced upload", "video_id", video.ID, "key", result.Key)
+		dropPoster()
+		return nil
+	}
+	if result.Error != "" {
+		slog.Warn("Poster Lambda failed", "video_id", video.ID, "key", result.Key, "error", result.Error)
+		return nil
+	}
+	if video.ThumbnailURL != nil && *video.ThumbnailURL != "" {
+		dropPoster()
+		return nil
+	}
+
+	name, err := randomAssetName(".jpg")
+	if err != nil {
+		return err
+	}
+	if err := store.Download(ctx, result.PosterKey, filepath.Join(cfg.assetsRoot, name)); err != nil {
+		cfg.discardUploads(name)
+		return fmt.Errorf("couldn't download poster %s: %w", result.PosterKey, err)
+	}
+	if err := cfg.recordAsset(name, video.ID); err != nil {
+		cfg.discardUploads(name)
+		return fmt.Errorf("failed to record poster: %w", err)
+	}
+
+	thumbnailURL := cfg.getAssetURL(name)
+	video.ThumbnailURL = &thumbnailURL
+	video.ThumbnailPlaceholder = cfg.thumbnailPlaceholder(name)
+	video.ThumbnailSourceURL = nil
+	video.ThumbnailCrop = nil
+	video.PosterTimestamp = &result.Timestamp
+	if err := cfg.db.WithContext(ctx).UpdateVideo(video); err != nil {
+		cfg.discardUploads(name)
+		return fmt.Errorf("couldn't update video: %w", err)
+	}
+	dropPoster()
+	return nil
+}
+
+// startPosterResultConsumer long-polls POSTER_QUEUE_URL for poster Lambda
+// results until the server shuts down. It does nothing when no queue is
+// configured.
+func (cfg *apiConfig) startPosterResultConsumer() {
+	if cfg.posterQueueURL == "" {
+		return
+	}
+	ctx, cancel := context.WithCancel(cfg.lifecycle.ctx)
+	go func() {
+		<-cfg.lifecycle.drain
+		cancel()
+	}()
+
+	cfg.lifecycle.workers.Add(1)
+	go func() {
+		defer cfg.lifecycle.workers.Done()
+		slog.Info("Consuming poster results", "queue_url", cfg.posterQueueURL)
+		for ctx.Err() == nil {
+			out, err := cfg.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+				QueueUrl:            aws.String(cfg.posterQueueURL),
+				MaxNumberOfMessages: ingestBatchSize,
+				WaitTimeSeconds:     ingestWaitSeconds,
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("Couldn't receive poster results", "error", err)
+					select {
+					case <-time.After(ingestRetryDelay):
+					case <-ctx.Done():
+					}
+				}
+				continue
+			}
+			for _, msg := range out.Messages {
+				cfg.handlePosterResultMessage(cfg.lifecycle.ctx, msg)
+			}
+		}
+	}()
+}
+
+// handlePosterResultMessage applies one result and deletes it from the
+// queue, unless applying it failed in a way that redelivery can fix.
+func (cfg *apiConfig) handlePosterResultMessage(ctx context.Context, msg sqstypes.Message) {
+	var result posterResult
+	if err := json.Unmarshal([]byte(aws.ToString(msg.Body)), &result); err != nil {
+		slog.Warn("Dropping unreadable poster result", "message_id", aws.ToString(msg.MessageId), "error", err)
+	} else if err := cfg.applyPosterResult(ctx, result); err != nil {
+		slog.Info("Couldn't apply poster result, leaving it for redelivery", "video_id", result.VideoID, "error", err)
+		return
+	}
+
+	_, err := cfg.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(cfg.posterQueueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		slog.Warn("Couldn't delete poster result", "message_id", aws.ToString(msg.MessageId), "error", err)
+	}
+}
+
+// handlerPosterHook receives poster Lambda results pushed over HTTP. They
+// are signed like outgoing webhooks, with POSTER_WEBHOOK_SECRET.
+func (cfg *apiConfig) handlerPosterHook(w http.ResponseWriter, r *http.Request) {
+	if cfg.posterWebhookSecret == "" {
+		respondWithError(w, http.StatusNotFound, "Poster webhook is not enabled", nil)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPosterResultSize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read request", err)
+		return
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-Tubely-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)).Abs() > posterHookMaxSkew {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired timestamp", err)
+		return
+	}
+	expected := signWebhook(cfg.posterWebhookSecret, timestamp, payload)
+	if !hmac.Equal([]byte(r.Header.Get("X-Tubely-Signature")), []byte(expected)) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid signature", nil)
+		return
+	}
+
+	var result posterResult
+	if err := json.Unmarshal(payload, &result); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	err = cfg.applyPosterResult(r.Context(), result)
+	if err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(posterResultRetryAfter.Seconds())))
+	}
+	switch {
+	case errors.Is(err, errPosterResultEarly):
+		respondWithError(w, http.StatusConflict, "Video is still processing", err)
+		return
+	case err != nil:
+		respondWithError(w, http.StatusServiceUnavailable, "Couldn't apply poster", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// processVideoParams are the parameters of a process_video job. The upload
+// is staged on disk under stagingDir so a restarted server can still find
+// it.
+type processVideoParams struct {
+	StagingPath string `json:"staging_path"`
+	SHA256      string `json:"sha256"`
+	// SupersededURLs are the renditions the video pointed at before this
+	// upload, re-tagged once it completes
+	SupersededURLs []string `json:"superseded_urls"`
+	// Profile is the processing profile the upload picked. Jobs queued
+	// before profiles existed have none and use the default.
+	Profile *processingProfile `json:"profile,omitempty"`
+	// AudioLanguage picks the default audio track, see parseAudioLanguage
+	AudioLanguage string `json:"audio_language,omitempty"`
+}
+
+// processVideoCheckpoint is saved once the renditions are in S3, so a job
+// interrupted after that point only has to update the video.
+type processVideoCheckpoint struct {
+	VideoURL         *string  `json:"video_url"`
+	PreviewURL       *string  `json:"preview_url"`
+	SDRVideoURL      *string  `json:"sdr_video_url"`
+	OriginalURL      *string  `json:"original_url"`
+	ThumbnailURL     *string  `json:"thumbnail_url"`
+	PosterTimestamp  *float64 `json:"poster_timestamp"`
+	ModerationStatus string   `json:"moderation_status"`
+	ModerationLabels string   `json:"moderation_labels"`
+	database.ThumbnailPlaceholder
+	database.Dimensions
+}
+
+func newProcessVideoCheckpoint(video database.Video) processVideoCheckpoint {
+	return processVideoCheckpoint{
+		VideoURL:             video.VideoURL,
+		PreviewURL:           video.PreviewURL,
+		SDRVideoURL:          video.SDRVideoURL,
+		OriginalURL:          video.OriginalURL,
+		ThumbnailURL:         video.ThumbnailURL,
+		ThumbnailPlaceholder: video.ThumbnailPlaceholder,
+		PosterTimestamp:      video.PosterTimestamp,
+		ModerationStatus:     video.ModerationStatus,
+		ModerationLabels:     video.ModerationLabels,
+		Dimensions:           video.Dimensions,
+	}
+}
+
+func (c processVideoCheckpoint) apply(video database.Video) database.Video {
+	video.VideoURL = c.VideoURL
+	video.PreviewURL = c.PreviewURL
+	video.SDRVideoURL = c.SDRVideoURL
+	if c.OriginalURL != nil {
+		video.OriginalURL = c.OriginalURL
+		video.OriginalArchivedAt = nil
+	}
+	video.ThumbnailURL = c.ThumbnailURL
+	video.ThumbnailPlaceholder = c.ThumbnailPlaceholder
+	video.PosterTimestamp = c.PosterTimestamp
+	video.ModerationStatus = c.ModerationStatus
+	video.ModerationLabels = c.ModerationLabels
+	video.Dimensions = c.Dimensions
+	if c.ModerationStatus != "" {
+		video.ModerationReason = nil
+	}
+	return video
+}
+
+// ensureStagingDir creates the directory uploads wait in until processed.
+func (cfg *apiConfig) ensureStagingDir() error {
+	return os.MkdirAll(cfg.stagingDir, 0o755)
+}
+
+// enqueueProcessVideo records a process_video job for a staged upload of
+// the probed duration and hands it to the workers.
+func (cfg *apiConfig) enqueueProcessVideo(ctx context.Context, video database.Video, params processVideoParams, duration *float64) (database.Job, error) {
+	dat, err := json.Marshal(params)
+	if err != nil {
+		return database.Job{}, err
+	}
+	job, err := cfg.db.WithContext(ctx).CreateJob(database.CreateJobParams{
+		UserID:       video.UserID,
+		VideoID:      video.ID,
+		Kind:         jobKindProcessVideo,
+		Params:       string(dat),
+		TraceParent:  traceParent(ctx),
+		Priority:     cfg.videoJobPriority(duration),
+		InputSeconds: duration,
+	})
+	if err != nil {
+		return database.Job{}, err
+	}
+	cfg.enqueueJob(job)
+	return job, nil
+}
+
+// runProcessVideoJob processes a staged upload. A job that was interrupted
+// after uploading its renditions resumes from the saved checkpoint;
+// otherwise the pipeline runs again from the staged file. The staged file
+// is kept while the job may still run again so the retry can use it.
+func (cfg *apiConfig) runProcessVideoJob(ctx context.Context, job database.Job) (database.Job, error) {
+	var params processVideoParams
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		return job, permanent(fmt.Errorf("invalid process_video parameters: %w", err))
+	}
+
+	if err := cfg.db.WithContext(ctx).SetVideoProcessingStatus(job.VideoID, database.ProcessingInProgress); err != nil {
+		slog.Warn("Couldn't update processing status", "video_id", job.VideoID, "error", err)
+	}
+	job, err := cfg.processStagedVideo(ctx, job, params)
+	if err == nil {
+		os.Remove(params.StagingPath)
+		return job, nil
+	}
+	outcome := cfg.jobFailureOutcome(ctx, job, err)
+	if !outcome.keepsInputs() {
+		os.Remove(params.StagingPath)
+	}
+	status := database.ProcessingFailed
+	if outcome.runsAgain() {
+		status = database.ProcessingQueued
+	}
+	if err := cfg.db.WithContext(context.WithoutCancel(ctx)).SetVideoProcessingStatus(job.VideoID, status); err != nil {
+		slog.Warn("Couldn't update processing status", "video_id", job.VideoID, "error", err)
+	}
+	return job, err
+}
+
+func (cfg *apiConfig) processStagedVideo(ctx context.Context, job database.Job, params processVideoParams) (database.Job, error) {
+	video, err := cfg.db.WithContext(ctx).GetVideo(job.VideoID)
+	if err != nil {
+		return job, fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		return job, permanent(fmt.Errorf("video %s was deleted", job.VideoID))
+	}
+	before := video
+
+	if job.Checkpoint != nil {
+		var checkpoint processVideoCheckpoint
+		if err := json.Unmarshal([]byte(*job.Checkpoint), &checkpoint); err != nil {
+			return job, permanent(fmt.Errorf("invalid checkpoint: %w", err))
+		}
+		slog.Info("Resuming video processing from checkpoint",
+			"job_id", job.ID, "user_id", job.UserID, "video_id", job.VideoID)
+		video = checkpoint.apply(video)
+	} else {
+		if _, err := os.Stat(params.StagingPath); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return job, permanent(fmt.Errorf("staged upload %s is gone", filepath.Base(params.StagingPath)))
+			}
+			return job, err
+		}
+
+		profile, _ := cfg.processingProfile("")
+		if params.Profile != nil {
+			profile = *params.Profile
+		}
+
+		timer := newStageTimer()
+		video, err = cfg.processUploadedVideo(ctx, video, params.StagingPath, profile, params.AudioLanguage, timer)
+		job.StageTimings = timer.snapshot()
+		if err != nil {
+			return job, err
+		}
+
+		dat, err := json.Marshal(newProcessVideoCheckpoint(video))
+		if err != nil {
+			return job, err
+		}
+		checkpoint := string(dat)
+		job.Checkpoint = &checkpoint
+		err = withSpan(ctx, "db save checkpoint", func(context.Context) error {
+			return cfg.db.WithContext(ctx).UpdateJob(job)
+		})
+		if err != nil {
+			// Without a checkpoint a retry runs the pipeline again
+			cfg.discardNewVideoUploads(before, video)
+			return job, fmt.Errorf("couldn't save checkpoint: %w", err)
+		}
+	}
+
+	video.SHA256 = &params.SHA256
+	video.ProcessingStatus = database.ProcessingReady
+	err = withSpan(ctx, "db update video", func(context.Context) error {
+		var err error
+		video, err = cfg.db.WithContext(ctx).UpdateVideoAsNewVersion(video)
+		return err
+	})
+	if err != nil {
+		// The checkpoint still references the renditions: a retry uses them,
+		// and discarding the dead-lettered job deletes them
+		return job, fmt.Errorf("failed to update video: %w", err)
+	}
+	slog.Info("Video processed",
+		"job_id", job.ID, "user_id", video.UserID, "video_id", video.ID,
+		"stage_timings_ms", job.StageTimings)
+
+	if video.ModerationStatus == database.ModerationPending {
+		cfg.publishEvent(eventModerationPending, video.UserID, video.ID, moderationEventData{
+			Status: video.ModerationStatus,
+		})
+	}
+
+	// Only renditions no version references anymore are tagged
+	cfg.markObjectsSuperseded(ctx, params.SupersededURLs...)
+	return job, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Optional steps of the processing pipeline. Probing always runs, and so
+// does moderation when a classifier is configured, whatever the profile.
+const (
+	// profileStepFaststart remuxes the upload for streaming and embeds its
+	// chapters. Without it the untouched upload becomes the stream rendition.
+	profileStepFaststart = "faststart"
+	profileStepPoster    = "poster"
+	profileStepPreview   = "preview"
+	// profileStepOriginal also stores the untouched upload, like
+	// S3_KEEP_ORIGINALS does for every profile
+	profileStepOriginal = "original"
+	// profileStepSDR adds a tonemapped SDR rendition of HDR uploads, for
+	// players that would show them washed out
+	profileStepSDR = "sdr"
+	// profileStepLoudnorm normalizes the loudness of every audio track to
+	// LOUDNESS_TARGET_LUFS
+	profileStepLoudnorm = "loudnorm"
+	// profileStepPerTitle re-encodes every upload at the lowest quality
+	// that still reaches PER_TITLE_VMAF, found by encoding samples of it
+	profileStepPerTitle = "per-title"
+)
+
+var profileSteps = []string{profileStepFaststart, profileStepPoster, profileStepPreview, profileStepOriginal, profileStepSDR, profileStepLoudnorm, profileStepPerTitle}
+
+const defaultProcessingProfile = "web-optimized"
+
+// builtinProcessingProfiles are available unless PROCESSING_PROFILES
+// redefines them.
+var builtinProcessingProfiles = map[string][]string{
+	"archive-only":  {},
+	"web-optimized": {profileStepFaststart, profileStepPoster, profileStepPreview},
+	"full-ladder":   {profileStepFaststart, profileStepPoster, profileStepPreview, profileStepOriginal, profileStepSDR},
+}
+
+// processingProfile is a named set of pipeline steps an uploader can pick.
+// process_video jobs store the resolved profile, so changing the config
+// doesn't affect uploads already queued.
+type processingProfile struct {
+	Name  string   `json:"name"`
+	Steps []string `json:"steps"`
+}
+
+func (p processingProfile) has(step string) bool {
+	return slices.Contains(p.Steps, step)
+}
+
+// parseProcessingProfiles adds the PROCESSING_PROFILES entries, each
+// name=step+step (or name= for no optional steps), to the built-in
+// profiles.
+func parseProcessingProfiles(entries []string) (map[string]processingProfile, error) {
+	profiles := make(map[string]processingProfile, len(builtinProcessingProfiles)+len(entries))
+	for name, steps := range builtinProcessingProfiles {
+		profiles[name] = processingProfile{Name: name, Steps: steps}
+	}
+	for _, entry := range entries {
+		name, rawSteps, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("profile %q must look like name=step+step", entry)
+		}
+		steps := []string{}
+		for _, step := range strings.Split(rawSteps, "+") {
+			step = strings.TrimSpace(step)
+			if step == "" || slices.Contains(steps, step) {
+				continue
+			}
+			if !slices.Contains(profileSteps, step) {
+				return nil, fmt.Errorf("profile %q has unknown step %q, use %s", name, step, strings.Join(profileSteps, ", "))
+			}
+			steps = append(steps, step)
+		}
+		profiles[name] = processingProfile{Name: name, Steps: steps}
+	}
+	return profiles, nil
+}
+
+// processingProfile resolves the profile an upload asked for, "" meaning
+// the default one.
+func (cfg *apiConfig) processingProfile(name string) (processingProfile, bool) {
+	if name == "" {
+		name = cfg.defaultProfile
+	}
+	profile, ok := cfg.processingProfiles[name]
+	return profile, ok
+}
+
+type processingProfilesResponse struct {
+	Default  string              `json:"default"`
+	Profiles []processingProfile `json:"profiles"`
+}
+
+// handlerProcessingProfiles lists the profiles uploads can choose from.
+func (cfg *apiConfig) handlerProcessingProfiles(w http.ResponseWriter, r *http.Request) {
+	resp := processingProfilesResponse{Default: cfg.defaultProfile, Profiles: []processingProfile{}}
+	for _, profile := range cfg.processingProfiles {
+		resp.Profiles = append(resp.Profiles, profile)
+	}
+	sort.Slice(resp.Profiles, func(i, j int) bool { return resp.Profiles[i].Name < resp.Profiles[j].Name })
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// jobKindPurgeAccount deletes the files of a deleted account
+const jobKindPurgeAccount = "purge_account"
+
+// purgeCheckpointInterval is how many files are deleted between progress
+// saves.
+const purgeCheckpointInterval = 25
+
+// purgeAccountJobParams lists everything a deleted account left in
+// storage. It is collected before the records go, since nothing else
+// remembers it afterwards.
+type purgeAccountJobParams struct {
+	// ObjectURLs are the "bucket,key" renditions of every version, clips
+	// and objects waiting in the ingest prefix
+	ObjectURLs []string `json:"object_urls"`
+	// AssetNames are thumbnails and posters under ASSETS_ROOT
+	AssetNames []string `json:"asset_names"`
+	// StagingPaths are uploads still waiting for their process_video job
+	StagingPaths []string `json:"staging_paths"`
+}
+
+func (p purgeAccountJobParams) total() int {
+	return len(p.ObjectURLs) + len(p.AssetNames) + len(p.StagingPaths)
+}
+
+// purgeAccountCheckpoint records how many of the files, in params order,
+// are gone, so an interrupted purge resumes where it stopped.
+type purgeAccountCheckpoint struct {
+	Purged int `json:"purged"`
+}
+
+// jobProgress is how far a job that works through a list has got.
+type jobProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// collectAccountFiles lists the storage used by the user's videos,
+// including trashed ones and every version, and by their jobs.
+func (cfg *apiConfig) collectAccountFiles(ctx context.Context, userID uuid.UUID) (purgeAccountJobParams, error) {
+	videos, err := cfg.db.WithContext(ctx).GetVideos(userID)
+	if err != nil {
+		return purgeAccountJobParams{}, fmt.Errorf("couldn't get videos: %w", err)
+	}
+	trashed, err := cfg.db.WithContext(ctx).GetTrashedVideos(userID)
+	if err != nil {
+		return purgeAccountJobParams{}, fmt.Errorf("couldn't get trashed videos: %w", err)
+	}
+
+	params := purgeAccountJobParams{ObjectURLs: []string{}, AssetNames: []string{}, StagingPaths: []string{}}
+	seen := map[string]bool{}
+	addObjects := func(objectURLs ...string) {
+		for _, objectURL := range objectURLs {
+			if !seen[objectURL] {
+				seen[objectURL] = true
+				params.ObjectURLs = append(params.ObjectURLs, objectURL)
+			}
+		}
+	}
+	// Videos uploaded to an organization with another owner are handed
+	// over to them by DeleteAccount, files and all
+	handedOver := map[uuid.UUID]bool{}
+	for _, video := range append(videos, trashed...) {
+		if video.OrgID != nil {
+			kept, seen := handedOver[*video.OrgID]
+			if !seen {
+				org, err := cfg.db.WithContext(ctx).GetOrganization(*video.OrgID)
+				if err != nil {
+					return purgeAccountJobParams{}, fmt.Errorf("couldn't get organization: %w", err)
+				}
+				role, err := cfg.db.WithContext(ctx).GetOrgRole(org.ID, userID)
+				if err != nil {
+					return purgeAccountJobParams{}, fmt.Errorf("couldn't get organization: %w", err)
+				}
+				otherOwners := org.OwnerCount
+				if role == database.RoleOwner {
+					otherOwners--
+				}
+				kept = otherOwners > 0
+				handedOver[org.ID] = kept
+			}
+			if kept {
+				continue
+			}
+		}
+		addObjects(videoObjectURLs(video.VideoURL, video.PreviewURL, video.SDRVideoURL, video.OriginalURL)...)
+		versions, err := cfg.db.WithContext(ctx).GetVideoVersions(video.ID)
+		if err != nil {
+			return purgeAccountJobParams{}, fmt.Errorf("couldn't get versions: %w", err)
+		}
+		for _, v := range versions {
+			addObjects(videoObjectURLs(v.VideoURL, v.PreviewURL, v.SDRVideoURL, v.OriginalURL)...)
+		}
+		if video.ThumbnailURL != nil && *video.ThumbnailURL != "" {
+			params.AssetNames = append(params.AssetNames, path.Base(*video.ThumbnailURL))
+		}
+		if video.ThumbnailSourceURL != nil {
+			params.AssetNames = append(params.AssetNames, path.Base(*video.ThumbnailSourceURL))
+		}
+	}
+
+	jobs, err := cfg.db.WithContext(ctx).ListJobs(database.JobFilter{UserID: userID})
+	if err != nil {
+		return purgeAccountJobParams{}, fmt.Errorf("couldn't get jobs: %w", err)
+	}
+	for _, job := range jobs {
+		if job.ResultURL != nil && *job.ResultURL != "" {
+			addObjects(*job.ResultURL)
+		}
+		if job.Status == database.JobStatusCompleted {
+			continue
+		}
+		switch job.Kind {
+		case jobKindProcessVideo:
+			var p processVideoParams
+			if err := json.Unmarshal([]byte(job.Params), &p); err == nil && p.StagingPath != "" {
+				params.StagingPaths = append(params.StagingPaths, p.StagingPath)
+			}
+		case jobKindIngestVideo:
+			var p ingestVideoJobParams
+			if err := json.Unmarshal([]byte(job.Params), &p); err == nil && p.Key != "" {
+				addObjects(fmt.Sprintf("%s,%s", cfg.s3Bucket, p.Key))
+			}
+		}
+	}
+	return params, nil
+}
+
+// runPurgeAccountJob deletes the files of a deleted account one by one,
+// saving progress as it goes. Objects that can't be deleted are tagged
+// superseded for the bucket's lifecycle rules instead.
+func (cfg *apiConfig) runPurgeAccountJob(ctx context.Context, job database.Job) (database.Job, error) {
+	var params purgeAccountJobParams
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		return job, permanent(fmt.Errorf("invalid purge_account parameters: %w", err))
+	}
+	var checkpoint purgeAccountCheckpoint
+	if job.Checkpoint != nil {
+		if err := json.Unmarshal([]byte(*job.Checkpoint), &checkpoint); err != nil {
+			return job, permanent(fmt.Errorf("invalid checkpoint: %w", err))
+		}
+	}
+
+	var steps []func()
+	for _, objectURL := range params.ObjectURLs {
+		steps = append(steps, func() { cfg.deleteUnreferencedObjects(ctx, objectURL) })
+	}
+	for _, name := range params.AssetNames {
+		steps = append(steps, func() { cfg.deleteUnreferencedAsset(ctx, name) })
+	}
+	for _, stagingPath := range params.StagingPaths {
+		steps = append(steps, func() { removeIfExists(stagingPath) })
+	}
+
+	// Progress is saved even once ctx is done, so a resumed job skips it
+	save := func() error {
+		dat, err := json.Marshal(checkpoint)
+		if err != nil {
+			return err
+		}
+		saved := string(dat)
+		job.Checkpoint = &saved
+		return cfg.db.WithContext(context.WithoutCancel(ctx)).UpdateJob(job)
+	}
+	for checkpoint.Purged < len(steps) {
+		steps[checkpoint.Purged]()
+		if err := ctx.Err(); err != nil {
+			// The interrupted step may not have happened; the resumed job
+			// repeats it
+			save()
+			return job, err
+		}
+		checkpoint.Purged++
+		if checkpoint.Purged%purgeCheckpointInterval == 0 {
+			if err := save(); err != nil {
+				slog.Warn("Couldn't save purge progress", "job_id", job.ID, "error", err)
+			}
+		}
+	}
+	if err := save(); err != nil {
+		slog.Warn("Couldn't save purge progress", "job_id", job.ID, "error", err)
+	}
+	slog.Info("Purged deleted account", "job_id", job.ID, "user_id", job.UserID, "files", len(steps))
+	return job, nil
+}
+
+func removeIfExists(name string) {
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Couldn't remove file", "path", name, "error", err)
+	}
+}
+
+// purgeProgress reports how many of the account's files a purge job has
+// deleted so far.
+func purgeProgress(job database.Job) *jobProgress {
+	var params purgeAccountJobParams
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		return nil
+	}
+	progress := &jobProgress{Total: params.total()}
+	var checkpoint purgeAccountCheckpoint
+	if job.Checkpoint != nil && json.Unmarshal([]byte(*job.Checkpoint), &checkpoint) == nil {
+		progress.Done = checkpoint.Purged
+	}
+	return progress
+}
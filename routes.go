@@ -0,0 +1,827 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// apiV1 is the prefix of the current API version. Breaking changes ship
+// under a new prefix while the old one keeps working.
+const apiV1 = "/api/v1"
+
+// legacyAPIPrefix is where routes lived before versioning.
+const legacyAPIPrefix = "/api"
+
+// apiRoute is one endpoint: how it is served and how it is described in
+// the OpenAPI document.
+type apiRoute struct {
+	Method      string
+	Path        string
+	Handler     http.HandlerFunc
+	OperationID string
+	Summary     string
+	Tag         string
+	// Auth means the route expects an Authorization bearer token
+	Auth bool
+	// Request is a value of the JSON body type, if any
+	Request any
+	// Upload is the multipart form field carrying the file, if any
+	Upload string
+	// UploadMultiple means Upload may be repeated
+	UploadMultiple bool
+	// FormFields are other multipart fields the route reads
+	FormFields []queryParam
+	// Idempotent routes accept an Idempotency-Key header
+	Idempotent bool
+	// Audit is the action successful requests are recorded under in the
+	// audit log, if any
+	Audit     string
+	Query     []queryParam
+	Responses []routeResponse
+	// Legacy routes are unversioned aliases kept for existing clients and
+	// left out of the document
+	Legacy bool
+}
+
+type queryParam struct {
+	Name        string
+	Description string
+}
+
+type routeResponse struct {
+	Status      int
+	Description string
+	// Body is a value of the JSON response type, a binaryBody, or nil
+	Body any
+}
+
+// routes lists every endpoint under /api/v1 and /admin.
+func (cfg *apiConfig) routes() []apiRoute {
+	routes := []apiRoute{
+		{
+			Method: "POST", Path: apiV1 + "/login", Handler: cfg.handlerLogin,
+			OperationID: "login", Summary: "Log in with email and password", Tag: "auth",
+			Request:   loginParams{},
+			Responses: []routeResponse{{http.StatusOK, "Access and refresh tokens", loginResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/refresh", Handler: cfg.handlerRefresh,
+			OperationID: "refreshToken", Summary: "Exchange a refresh token for a new access token", Tag: "auth",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "New access token", refreshResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/revoke", Handler: cfg.handlerRevoke,
+			OperationID: "revokeToken", Summary: "Revoke a refresh token", Tag: "auth",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusNoContent, "Revoked", nil}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/users", Handler: cfg.handlerUsersCreate,
+			OperationID: "createUser", Summary: "Create an account", Tag: "users",
+			Audit:     "user.create",
+			Request:   createUserParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Created user", database.User{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/users/me", Handler: cfg.handlerUsersDelete,
+			OperationID: "deleteUser", Summary: "Delete your account and purge its files", Tag: "users",
+			Auth:      true,
+			Audit:     "user.delete",
+			Responses: []routeResponse{{http.StatusAccepted, "Account deleted, files purged by the returned job", jobResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/users/me/usage", Handler: cfg.handlerUsage,
+			OperationID: "getUsage", Summary: "Get the bytes served of your videos in a month", Tag: "users",
+			Auth:      true,
+			Query:     []queryParam{{"month", "YYYY-MM, defaults to the current month"}},
+			Responses: []routeResponse{{http.StatusOK, "Usage", usageResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/users/me/notifications", Handler: cfg.handlerNotificationPreferencesGet,
+			OperationID: "getNotificationPreferences", Summary: "Get which emails you receive about your videos", Tag: "users",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Notification preferences", database.NotificationPreferences{}}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/users/me/notifications", Handler: cfg.handlerNotificationPreferencesPut,
+			OperationID: "setNotificationPreferences", Summary: "Choose which emails you receive about your videos", Tag: "users",
+			Auth:      true,
+			Audit:     "user.notifications",
+			Request:   notificationPreferencesParams{},
+			Responses: []routeResponse{{http.StatusOK, "Notification preferences", database.NotificationPreferences{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/users/me/export", Handler: cfg.handlerUserExport,
+			OperationID: "exportUser", Summary: "Download an archive of all of your videos and data", Tag: "users",
+			Auth:  true,
+			Query: []queryParam{{"format", "zip (default) or manifest for presigned URLs instead"}},
+			Responses: []routeResponse{
+				{http.StatusOK, "ZIP archive, or the manifest with format=manifest", binaryBody("application/zip")},
+			},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos", Handler: cfg.handlerVideoMetaCreate,
+			OperationID: "createVideo", Summary: "Create a video draft", Tag: "videos",
+			Auth:      true,
+			Audit:     "video.create",
+			Request:   createVideoParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Created video", database.Video{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos", Handler: cfg.handlerVideosRetrieve,
+			OperationID: "listVideos", Summary: "List your videos", Tag: "videos",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Videos", []database.Video{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/trash", Handler: cfg.handlerVideosTrash,
+			OperationID: "listTrashedVideos", Summary: "List your videos in the trash", Tag: "videos",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Trashed videos", []database.Video{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/search", Handler: cfg.handlerSearch,
+			OperationID: "searchVideos", Summary: "Search videos by title, description and chapters", Tag: "videos",
+			Query: []queryParam{
+				{"q", "words to match, all of them; end one with * to match it as a prefix"},
+				{"limit", "Maximum number of results (default 20, max 100)"},
+				{"offset", "number of results to skip, next_offset of the previous page"},
+			},
+			Responses: []routeResponse{{http.StatusOK, "Ranked results", searchResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}", Handler: cfg.handlerVideoGet,
+			OperationID: "getVideo", Summary: "Get a video", Tag: "videos",
+			Responses: []routeResponse{{http.StatusOK, "Video", database.Video{}}},
+		},
+		{
+			Method: "PATCH", Path: apiV1 + "/videos/{videoID}", Handler: cfg.handlerVideoMetaUpdate,
+			OperationID: "updateVideo", Summary: "Change a video's title, description or visibility", Tag: "videos",
+			Auth:      true,
+			Audit:     "video.update",
+			Request:   updateVideoParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated video", database.Video{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/videos/{videoID}", Handler: cfg.handlerVideoMetaDelete,
+			OperationID: "deleteVideo", Summary: "Move a video to the trash", Tag: "videos",
+			Auth:      true,
+			Audit:     "video.delete",
+			Responses: []routeResponse{{http.StatusNoContent, "Moved to the trash", nil}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/restore", Handler: cfg.handlerVideoRestore,
+			OperationID: "restoreVideo", Summary: "Restore a video from the trash", Tag: "videos",
+			Auth:      true,
+			Audit:     "video.restore",
+			Responses: []routeResponse{{http.StatusOK, "Restored video", database.Video{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/thumbnail_upload/{videoID}", Handler: cfg.limitUploadRate(cfg.rejectWhileDraining(cfg.idempotent(cfg.handlerUploadThumbnail))),
+			OperationID: "uploadThumbnail", Summary: "Upload a JPEG or PNG thumbnail", Tag: "uploads",
+			Auth:       true,
+			Audit:      "video.thumbnail_upload",
+			Upload:     "thumbnail",
+			Idempotent: true,
+			Responses:  []routeResponse{{http.StatusOK, "Updated video", database.Video{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/video_upload/{videoID}", Handler: preflightContentLength(maxVideoUploadBytes, "File is too large", cfg.limitUploadRate(cfg.rejectWhileDraining(cfg.idempotent(cfg.handlerUploadVideo)))),
+			OperationID: "uploadVideo", Summary: "Upload an MP4 and queue it for processing", Tag: "uploads",
+			Auth:   true,
+			Audit:  "video.upload",
+			Upload: "video",
+			FormFields: []queryParam{
+				{"profile", "Processing profile, see listProcessingProfiles. Defaults to DEFAULT_PROCESSING_PROFILE."},
+			},
+			Query:      []queryParam{{"profile", "Same as the profile form field"}},
+			Idempotent: true,
+			Responses: []routeResponse{
+				{http.StatusAccepted, "Processing job", jobResponse{}},
+				{http.StatusOK, "Identical to an earlier upload, processed already", database.Video{}},
+			},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/import", Handler: cfg.rejectWhileDraining(cfg.idempotent(cfg.handlerImportVideo)),
+			OperationID: "importVideo", Summary: "Copy an MP4 from another S3 bucket and queue it for processing", Tag: "uploads",
+			Auth:       true,
+			Audit:      "video.import",
+			Request:    importVideoParams{},
+			Idempotent: true,
+			Responses:  []routeResponse{{http.StatusAccepted, "Import job", jobResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/upload_policy", Handler: cfg.handlerUploadPolicy,
+			OperationID: "createUploadPolicy", Summary: "Get a presigned POST for uploading the video straight to S3", Tag: "uploads",
+			Auth:      true,
+			Audit:     "video.upload_policy",
+			Responses: []routeResponse{{http.StatusOK, "Presigned POST", uploadPolicyResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/uploads/init", Handler: cfg.rejectWhileDraining(cfg.handlerChunkedUploadInit),
+			OperationID: "initChunkedUpload", Summary: "Start uploading a video in chunks", Tag: "uploads",
+			Auth:      true,
+			Audit:     "upload.init",
+			Request:   chunkedUploadParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Open upload", chunkedUploadResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/uploads/{uploadID}", Handler: cfg.handlerGetChunkedUpload,
+			OperationID: "getChunkedUpload", Summary: "Get a chunked upload and the chunks received so far", Tag: "uploads",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Upload", chunkedUploadResponse{}}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/uploads/{uploadID}/chunks/{n}", Handler: preflightContentLength(maxChunkBytes, "Chunk is too large", cfg.limitUploadRate(cfg.rejectWhileDraining(cfg.handlerChunkedUploadChunk))),
+			OperationID: "uploadChunk", Summary: "Upload chunk n of a chunked upload as the raw request body", Tag: "uploads",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Stored chunk", uploadedChunk{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/uploads/{uploadID}/complete", Handler: cfg.rejectWhileDraining(cfg.idempotent(cfg.handlerChunkedUploadComplete)),
+			OperationID: "completeChunkedUpload", Summary: "Assemble the chunks and queue the video for processing", Tag: "uploads",
+			Auth:       true,
+			Audit:      "upload.complete",
+			Idempotent: true,
+			Responses:  []routeResponse{{http.StatusAccepted, "Ingest job", jobResponse{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/uploads/{uploadID}", Handler: cfg.handlerChunkedUploadAbort,
+			OperationID: "abortChunkedUpload", Summary: "Cancel a chunked upload and discard its chunks", Tag: "uploads",
+			Auth:      true,
+			Audit:     "upload.abort",
+			Responses: []routeResponse{{http.StatusNoContent, "Aborted", nil}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/processing_profiles", Handler: cfg.handlerProcessingProfiles,
+			OperationID: "listProcessingProfiles", Summary: "List the processing profiles uploads can pick", Tag: "uploads",
+			Responses: []routeResponse{{http.StatusOK, "Profiles and the default", processingProfilesResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/video_uploads", Handler: preflightContentLength(maxBulkUploadBytes, "File is too large", cfg.limitUploadRate(cfg.rejectWhileDraining(cfg.idempotent(cfg.handlerUploadVideosBulk)))),
+			OperationID: "uploadVideos", Summary: "Upload several MP4s as new videos and queue each for processing", Tag: "uploads",
+			Auth:           true,
+			Audit:          "video.bulk_upload",
+			Upload:         "video",
+			UploadMultiple: true,
+			FormFields: []queryParam{
+				{"manifest", `JSON array of {"title", "description"}, one per video part in order. Titles default to the file name.`},
+				{"profile", "Processing profile for every video, see listProcessingProfiles"},
+			},
+			Query:      []queryParam{{"profile", "Same as the profile form field"}},
+			Idempotent: true,
+			Responses:  []routeResponse{{http.StatusAccepted, "A processing job per video, in upload order", []jobResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/trim", Handler: cfg.rejectWhileDraining(cfg.handlerTrimVideo),
+			OperationID: "trimVideo", Summary: "Create a trimmed copy of a video", Tag: "editing",
+			Auth:      true,
+			Audit:     "video.trim",
+			Request:   trimParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Trimmed video", database.Video{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/clips", Handler: cfg.rejectWhileDraining(cfg.handlerClipCreate),
+			OperationID: "createClip", Summary: "Render a short MP4, GIF or WebP clip", Tag: "editing",
+			Auth:      true,
+			Audit:     "video.clip",
+			Request:   clipParams{},
+			Responses: []routeResponse{{http.StatusAccepted, "Clip job", jobResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/poster", Handler: cfg.rejectWhileDraining(cfg.handlerPosterSet),
+			OperationID: "setPoster", Summary: "Use a frame of the video as its thumbnail", Tag: "editing",
+			Auth:      true,
+			Audit:     "video.poster",
+			Request:   posterParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated video", database.Video{}}},
+		},
+		{
+			Method: "PATCH", Path: apiV1 + "/videos/{videoID}/thumbnail/crop", Handler: cfg.handlerThumbnailCrop,
+			OperationID: "cropThumbnail", Summary: "Recrop the thumbnail to a rectangle or around a focal point", Tag: "editing",
+			Auth:      true,
+			Audit:     "video.thumbnail_crop",
+			Request:   thumbnailCropParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated video", database.Video{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}/versions", Handler: cfg.handlerVideoVersionsList,
+			OperationID: "listVideoVersions", Summary: "List every upload of a video, newest first", Tag: "videos",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Versions", []videoVersionResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/versions/{version}/activate", Handler: cfg.handlerVideoVersionActivate,
+			OperationID: "activateVideoVersion", Summary: "Make an earlier upload the video's file again", Tag: "videos",
+			Auth:      true,
+			Audit:     "video.version_activate",
+			Responses: []routeResponse{{http.StatusOK, "Updated video", database.Video{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}/stream", Handler: cfg.handlerVideoStream,
+			OperationID: "streamVideo", Summary: "Stream a rendition, honoring Range requests", Tag: "playback",
+			Query: []queryParam{{"rendition", "stream (default) or preview"}},
+			Responses: []routeResponse{
+				{http.StatusOK, "Whole rendition", binaryBody("video/mp4")},
+				{http.StatusPartialContent, "Requested byte range", binaryBody("video/mp4")},
+				{http.StatusNotModified, "Cached copy is current", nil},
+			},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}/download", Handler: cfg.handlerVideoDownload,
+			OperationID: "downloadVideo", Summary: "Redirect to a URL that saves the original-quality file", Tag: "playback",
+			Responses: []routeResponse{{http.StatusFound, "Presigned download URL in Location", nil}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/archive", Handler: cfg.handlerVideoArchive,
+			OperationID: "archiveVideos", Summary: "Download a ZIP of several of your videos", Tag: "playback",
+			Auth:      true,
+			Request:   videoArchiveParams{},
+			Responses: []routeResponse{{http.StatusOK, "ZIP streamed from S3", binaryBody("application/zip")}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/videos/{videoID}/download_settings", Handler: cfg.handlerDownloadSettingsPut,
+			OperationID: "setDownloadSettings", Summary: "Allow or deny downloads and set their filename", Tag: "videos",
+			Auth:      true,
+			Audit:     "video.download_settings",
+			Request:   downloadSettingsParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated video", database.Video{}}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/videos/{videoID}/embed_settings", Handler: cfg.handlerEmbedSettingsPut,
+			OperationID: "setEmbedSettings", Summary: "Choose the sites the embed player works on", Tag: "videos",
+			Auth:      true,
+			Audit:     "video.embed_settings",
+			Request:   embedSettingsParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated video", database.Video{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}/social_metadata", Handler: cfg.handlerVideoSocialMetadata,
+			OperationID: "getSocialMetadata", Summary: "Get a public video's Open Graph and Twitter card tags", Tag: "videos",
+			Responses: []routeResponse{{http.StatusOK, "Meta tags", socialMetadataResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}/playback_rules", Handler: cfg.handlerPlaybackRulesList,
+			OperationID: "listPlaybackRules", Summary: "List the countries and IP ranges a video may be played from", Tag: "playback",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Playback rules", []database.PlaybackRule{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/playback_rules", Handler: cfg.handlerPlaybackRuleCreate,
+			OperationID: "createPlaybackRule", Summary: "Allow or deny playback from a country or IP range", Tag: "playback",
+			Auth:      true,
+			Audit:     "video.playback_rule_create",
+			Request:   playbackRuleParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Created rule", database.PlaybackRule{}}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/videos/{videoID}/playback_rules/{ruleID}", Handler: cfg.handlerPlaybackRuleUpdate,
+			OperationID: "updatePlaybackRule", Summary: "Replace a playback rule", Tag: "playback",
+			Auth:      true,
+			Audit:     "video.playback_rule_update",
+			Request:   playbackRuleParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated rule", database.PlaybackRule{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/videos/{videoID}/playback_rules/{ruleID}", Handler: cfg.handlerPlaybackRuleDelete,
+			OperationID: "deletePlaybackRule", Summary: "Delete a playback rule", Tag: "playback",
+			Auth:      true,
+			Audit:     "video.playback_rule_delete",
+			Responses: []routeResponse{{http.StatusNoContent, "Deleted", nil}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/view", Handler: cfg.handlerVideoView,
+			OperationID: "recordView", Summary: "Report playback progress of a viewing session", Tag: "playback",
+			Request:   viewBeaconParams{},
+			Responses: []routeResponse{{http.StatusNoContent, "Recorded", nil}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}/stats", Handler: cfg.handlerVideoStats,
+			OperationID: "getVideoStats", Summary: "Get a video's views, unique viewers and completion", Tag: "playback",
+			Auth:      true,
+			Query:     []queryParam{{"since", "only count views started at or after this RFC 3339 time"}},
+			Responses: []routeResponse{{http.StatusOK, "Playback analytics", videoStatsResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}/chapters", Handler: cfg.handlerChaptersGet,
+			OperationID: "listChapters", Summary: "List a video's chapters", Tag: "chapters",
+			Responses: []routeResponse{{http.StatusOK, "Chapters", []database.Chapter{}}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/videos/{videoID}/chapters", Handler: cfg.handlerChaptersPut,
+			OperationID: "replaceChapters", Summary: "Replace a video's chapters", Tag: "chapters",
+			Auth:      true,
+			Audit:     "video.chapters_update",
+			Request:   chaptersParams{},
+			Responses: []routeResponse{{http.StatusOK, "Saved chapters", []database.Chapter{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}/like", Handler: cfg.handlerVideoLikeGet,
+			OperationID: "getVideoLike", Summary: "Check whether you like a video", Tag: "videos",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Like status", likeResponse{}}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/videos/{videoID}/like", Handler: cfg.handlerVideoLikePut,
+			OperationID: "likeVideo", Summary: "Like a video", Tag: "videos",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Like status", likeResponse{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/videos/{videoID}/like", Handler: cfg.handlerVideoLikeDelete,
+			OperationID: "unlikeVideo", Summary: "Take back your like of a video", Tag: "videos",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Like status", likeResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/comments", Handler: cfg.handlerCommentCreate,
+			OperationID: "createComment", Summary: "Comment on a video or reply to a comment", Tag: "comments",
+			Auth:      true,
+			Audit:     "comment.create",
+			Request:   commentParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Created comment", database.Comment{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/videos/{videoID}/comments", Handler: cfg.handlerCommentsList,
+			OperationID: "listComments", Summary: "Page through a video's comments or a comment's replies", Tag: "comments",
+			Query: []queryParam{
+				{"parent_id", "list the replies to this comment instead of the top-level comments"},
+				{"limit", "Maximum number of comments (default 20, max 100)"},
+				{"cursor", "next_cursor of the previous page"},
+			},
+			Responses: []routeResponse{{http.StatusOK, "Comments", commentsPage{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/videos/{videoID}/comments/{commentID}", Handler: cfg.handlerCommentDelete,
+			OperationID: "deleteComment", Summary: "Delete your comment, or any comment on your video", Tag: "comments",
+			Auth:      true,
+			Audit:     "comment.delete",
+			Responses: []routeResponse{{http.StatusNoContent, "Deleted", nil}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/playlists", Handler: cfg.handlerPlaylistCreate,
+			OperationID: "createPlaylist", Summary: "Create a playlist", Tag: "playlists",
+			Auth:      true,
+			Audit:     "playlist.create",
+			Request:   playlistParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Created playlist", playlistResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/playlists", Handler: cfg.handlerPlaylistsList,
+			OperationID: "listPlaylists", Summary: "List your playlists", Tag: "playlists",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Playlists", []database.Playlist{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/playlists/{playlistID}", Handler: cfg.handlerPlaylistGet,
+			OperationID: "getPlaylist", Summary: "Get a playlist with the videos you can see", Tag: "playlists",
+			Responses: []routeResponse{{http.StatusOK, "Playlist", playlistResponse{}}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/playlists/{playlistID}", Handler: cfg.handlerPlaylistUpdate,
+			OperationID: "updatePlaylist", Summary: "Update a playlist's title, description and visibility", Tag: "playlists",
+			Auth:      true,
+			Audit:     "playlist.update",
+			Request:   playlistParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated playlist", playlistResponse{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/playlists/{playlistID}", Handler: cfg.handlerPlaylistDelete,
+			OperationID: "deletePlaylist", Summary: "Delete a playlist, keeping its videos", Tag: "playlists",
+			Auth:      true,
+			Audit:     "playlist.delete",
+			Responses: []routeResponse{{http.StatusNoContent, "Deleted", nil}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/playlists/{playlistID}/videos", Handler: cfg.handlerPlaylistVideoAdd,
+			OperationID: "addPlaylistVideo", Summary: "Add one of your videos to a playlist", Tag: "playlists",
+			Auth:      true,
+			Audit:     "playlist.video_add",
+			Request:   playlistAddParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated playlist", playlistResponse{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/playlists/{playlistID}/videos/{videoID}", Handler: cfg.handlerPlaylistVideoRemove,
+			OperationID: "removePlaylistVideo", Summary: "Remove a video from a playlist", Tag: "playlists",
+			Auth:      true,
+			Audit:     "playlist.video_remove",
+			Responses: []routeResponse{{http.StatusNoContent, "Removed", nil}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/playlists/{playlistID}/order", Handler: cfg.handlerPlaylistReorder,
+			OperationID: "reorderPlaylist", Summary: "Put a playlist's videos in a new order", Tag: "playlists",
+			Auth:      true,
+			Audit:     "playlist.reorder",
+			Request:   playlistOrderParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated playlist", playlistResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/videos/{videoID}/transfer", Handler: cfg.handlerVideoTransferCreate,
+			OperationID: "createVideoTransfer", Summary: "Offer a video to another user or an organization", Tag: "transfers",
+			Auth:      true,
+			Audit:     "transfer.create",
+			Request:   videoTransferParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Pending transfer", videoTransferResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/transfers", Handler: cfg.handlerVideoTransfersList,
+			OperationID: "listVideoTransfers", Summary: "List your pending transfers, incoming and outgoing", Tag: "transfers",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Transfers", videoTransfersResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/transfers/{transferID}/accept", Handler: cfg.handlerVideoTransferAccept,
+			OperationID: "acceptVideoTransfer", Summary: "Accept a video offered to you or your organization", Tag: "transfers",
+			Auth:      true,
+			Audit:     "transfer.accept",
+			Responses: []routeResponse{{http.StatusOK, "Accepted transfer", videoTransferResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/transfers/{transferID}/decline", Handler: cfg.handlerVideoTransferDecline,
+			OperationID: "declineVideoTransfer", Summary: "Decline a video offered to you or your organization", Tag: "transfers",
+			Auth:      true,
+			Audit:     "transfer.decline",
+			Responses: []routeResponse{{http.StatusOK, "Declined transfer", videoTransferResponse{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/transfers/{transferID}", Handler: cfg.handlerVideoTransferCancel,
+			OperationID: "cancelVideoTransfer", Summary: "Withdraw a pending transfer", Tag: "transfers",
+			Auth:      true,
+			Audit:     "transfer.cancel",
+			Responses: []routeResponse{{http.StatusOK, "Cancelled transfer", videoTransferResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/orgs", Handler: cfg.handlerOrgCreate,
+			OperationID: "createOrg", Summary: "Create an organization that you own", Tag: "organizations",
+			Auth:      true,
+			Audit:     "org.create",
+			Request:   orgParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Created organization", orgResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/orgs", Handler: cfg.handlerOrgsList,
+			OperationID: "listOrgs", Summary: "List the organizations you are a member of", Tag: "organizations",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Organizations", []database.UserOrganization{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/orgs/{orgID}", Handler: cfg.handlerOrgGet,
+			OperationID: "getOrg", Summary: "Get an organization with its members", Tag: "organizations",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Organization", orgResponse{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/orgs/{orgID}/videos", Handler: cfg.handlerOrgVideos,
+			OperationID: "listOrgVideos", Summary: "List an organization's shared videos", Tag: "organizations",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Videos", []database.Video{}}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/orgs/{orgID}/usage", Handler: cfg.handlerOrgUsage,
+			OperationID: "getOrgUsage", Summary: "Get the bytes served of an organization's videos in a month", Tag: "organizations",
+			Auth:      true,
+			Query:     []queryParam{{"month", "YYYY-MM, defaults to the current month"}},
+			Responses: []routeResponse{{http.StatusOK, "Usage", usageResponse{}}},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/orgs/{orgID}/members", Handler: cfg.handlerOrgMemberAdd,
+			OperationID: "addOrgMember", Summary: "Add a user to an organization by email", Tag: "organizations",
+			Auth:      true,
+			Audit:     "org.member_add",
+			Request:   orgMemberParams{},
+			Responses: []routeResponse{{http.StatusCreated, "Updated organization", orgResponse{}}},
+		},
+		{
+			Method: "PUT", Path: apiV1 + "/orgs/{orgID}/members/{userID}", Handler: cfg.handlerOrgMemberUpdate,
+			OperationID: "updateOrgMember", Summary: "Change a member's role", Tag: "organizations",
+			Auth:      true,
+			Audit:     "org.member_update",
+			Request:   orgMemberParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated organization", orgResponse{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/orgs/{orgID}/members/{userID}", Handler: cfg.handlerOrgMemberRemove,
+			OperationID: "removeOrgMember", Summary: "Remove a member, or leave an organization", Tag: "organizations",
+			Auth:      true,
+			Audit:     "org.member_remove",
+			Responses: []routeResponse{{http.StatusNoContent, "Removed", nil}},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/jobs/{jobID}", Handler: cfg.handlerJobGet,
+			OperationID: "getJob", Summary: "Get a processing job", Tag: "jobs",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Job", jobResponse{}}},
+		},
+		{
+			Method: "DELETE", Path: apiV1 + "/jobs/{jobID}", Handler: cfg.handlerJobCancel,
+			OperationID: "cancelJob", Summary: "Cancel a processing or clip job", Tag: "jobs",
+			Auth:  true,
+			Audit: "job.cancel",
+			Responses: []routeResponse{
+				{http.StatusOK, "Canceled queued job", jobResponse{}},
+				{http.StatusAccepted, "Stopping running job", jobResponse{}},
+				{http.StatusConflict, "The job can't be canceled or already finished", errorResponse{}},
+			},
+		},
+		{
+			Method: "POST", Path: apiV1 + "/hooks/poster", Handler: cfg.handlerPosterHook,
+			OperationID: "posterHook", Summary: "Report a poster extracted by the poster Lambda", Tag: "meta",
+			Request: posterResult{},
+			Responses: []routeResponse{
+				{http.StatusNoContent, "Applied or dropped", nil},
+				{http.StatusConflict, "The upload is still processing, retry after Retry-After", errorResponse{}},
+				{http.StatusServiceUnavailable, "Not applied, retry after Retry-After", errorResponse{}},
+			},
+		},
+		{
+			Method: "GET", Path: apiV1 + "/openapi.json", Handler: cfg.handlerOpenAPI,
+			OperationID: "getOpenAPI", Summary: "This document", Tag: "meta",
+			Responses: []routeResponse{{http.StatusOK, "OpenAPI document", map[string]any{}}},
+		},
+
+		{
+			Method: "POST", Path: "/admin/reset", Handler: cfg.handlerReset,
+			OperationID: "adminReset", Summary: "Reset the database (dev only)", Tag: "admin",
+			Audit:     "admin.reset",
+			Responses: []routeResponse{{http.StatusOK, "Reset", binaryBody("text/plain")}},
+		},
+		{
+			Method: "GET", Path: "/admin/jobs", Handler: cfg.handlerAdminJobsList,
+			OperationID: "adminListJobs", Summary: "List jobs with their stage timings", Tag: "admin",
+			Auth: true,
+			Query: []queryParam{
+				{"video_id", "Only jobs for this video"},
+				{"kind", "Only jobs of this kind"},
+				{"status", "Only jobs in this status"},
+				{"limit", "Maximum number of jobs"},
+			},
+			Responses: []routeResponse{{http.StatusOK, "Jobs", []database.Job{}}},
+		},
+		{
+			Method: "GET", Path: "/admin/overview", Handler: cfg.handlerAdminOverview,
+			OperationID: "adminOverview", Summary: "Sum up counts, the processing queue, failure rates, top uploaders and recent errors", Tag: "admin",
+			Auth: true,
+			Query: []queryParam{
+				{"window", "Duration the failure rates and top uploaders cover, e.g. 1h (default 24h, max 2160h)"},
+				{"top", "Number of top uploaders (default 10, max 100)"},
+			},
+			Responses: []routeResponse{{http.StatusOK, "Overview", overviewResponse{}}},
+		},
+		{
+			Method: "GET", Path: "/admin/storage", Handler: cfg.handlerAdminStorage,
+			OperationID: "adminStorage", Summary: "Report the bytes stored in S3 and on local disk", Tag: "admin",
+			Auth:      true,
+			Query:     []queryParam{{"refresh", "true to list the bucket again instead of using the cached report"}},
+			Responses: []routeResponse{{http.StatusOK, "Storage usage", storageReport{}}},
+		},
+		{
+			Method: "GET", Path: "/admin/audit", Handler: cfg.handlerAdminAuditLog,
+			OperationID: "adminAuditLog", Summary: "Page through the audit log, newest first", Tag: "admin",
+			Auth: true,
+			Query: []queryParam{
+				{"actor_id", "Only requests by this user"},
+				{"video_id", "Only requests about this video"},
+				{"action", "Only this action, or with a trailing dot every action under it, e.g. admin."},
+				{"since", "RFC 3339 time of the oldest entries"},
+				{"until", "RFC 3339 time the entries must be older than"},
+				{"cursor", "next_cursor of the previous page"},
+				{"limit", "Maximum number of entries (default 50, max 500)"},
+			},
+			Responses: []routeResponse{{http.StatusOK, "Entries", auditLogPage{}}},
+		},
+		{
+			Method: "GET", Path: "/admin/webhooks/deliveries", Handler: cfg.handlerAdminWebhookDeliveries,
+			OperationID: "adminWebhookDeliveries", Summary: "Page through webhook delivery attempts, newest first", Tag: "admin",
+			Auth: true,
+			Query: []queryParam{
+				{"event_id", "Only attempts to deliver this event"},
+				{"event_type", "Only events of this type"},
+				{"url", "Only attempts to this webhook URL"},
+				{"failed", "true for failed attempts only"},
+				{"cursor", "next_cursor of the previous page"},
+				{"limit", "Maximum number of attempts (default 50, max 500)"},
+			},
+			Responses: []routeResponse{{http.StatusOK, "Delivery attempts", webhookDeliveryPage{}}},
+		},
+		{
+			Method: "GET", Path: "/admin/users/{userID}/export", Handler: cfg.handlerAdminUserExport,
+			OperationID: "adminExportUser", Summary: "Download an archive of a user's videos and data", Tag: "admin",
+			Auth:  true,
+			Audit: "admin.user_export",
+			Query: []queryParam{{"format", "zip (default) or manifest for presigned URLs instead"}},
+			Responses: []routeResponse{
+				{http.StatusOK, "ZIP archive, or the manifest with format=manifest", binaryBody("application/zip")},
+			},
+		},
+		{
+			Method: "GET", Path: "/admin/jobs/{jobID}", Handler: cfg.handlerAdminJobGet,
+			OperationID: "adminGetJob", Summary: "Get any job", Tag: "admin",
+			Auth:      true,
+			Responses: []routeResponse{{http.StatusOK, "Job", database.Job{}}},
+		},
+		{
+			Method: "POST", Path: "/admin/jobs/{jobID}/retry", Handler: cfg.handlerAdminJobRetry,
+			OperationID: "adminRetryJob", Summary: "Queue a dead-lettered job again", Tag: "admin",
+			Auth:      true,
+			Audit:     "admin.job_retry",
+			Responses: []routeResponse{{http.StatusAccepted, "Queued job", database.Job{}}},
+		},
+		{
+			Method: "POST", Path: "/admin/jobs/{jobID}/discard", Handler: cfg.handlerAdminJobDiscard,
+			OperationID: "adminDiscardJob", Summary: "Fail a dead-lettered job and delete its kept files", Tag: "admin",
+			Auth:      true,
+			Audit:     "admin.job_discard",
+			Responses: []routeResponse{{http.StatusOK, "Failed job", database.Job{}}},
+		},
+		{
+			Method: "POST", Path: "/admin/tasks/archive-originals", Handler: cfg.handlerAdminArchiveOriginals,
+			OperationID: "adminArchiveOriginals", Summary: "Move old originals to archival storage", Tag: "admin",
+			Auth:      true,
+			Audit:     "admin.archive_originals",
+			Responses: []routeResponse{{http.StatusOK, "Archive summary", archiveResult{}}},
+		},
+		{
+			Method: "POST", Path: "/admin/tasks/ingest-cloudfront-logs", Handler: cfg.handlerAdminIngestCloudFrontLogs,
+			OperationID: "adminIngestCloudFrontLogs", Summary: "Count new CloudFront logs towards egress now", Tag: "admin",
+			Auth:      true,
+			Audit:     "admin.ingest_cloudfront_logs",
+			Responses: []routeResponse{{http.StatusOK, "Ingest summary", cloudFrontLogResult{}}},
+		},
+		{
+			Method: "PUT", Path: "/admin/users/{userID}/egress-cap", Handler: cfg.handlerAdminEgressCapSet,
+			OperationID: "adminSetEgressCap", Summary: "Override a user's monthly egress cap", Tag: "admin",
+			Auth:      true,
+			Audit:     "admin.egress_cap",
+			Request:   egressCapParams{},
+			Responses: []routeResponse{{http.StatusOK, "Cap", egressCapResponse{}}},
+		},
+		{
+			Method: "PUT", Path: "/admin/orgs/{orgID}/egress-cap", Handler: cfg.handlerAdminOrgEgressCapSet,
+			OperationID: "adminSetOrgEgressCap", Summary: "Override an organization's monthly egress cap", Tag: "admin",
+			Auth:      true,
+			Audit:     "admin.org_egress_cap",
+			Request:   egressCapParams{},
+			Responses: []routeResponse{{http.StatusOK, "Cap", orgEgressCapResponse{}}},
+		},
+		{
+			Method: "PUT", Path: "/admin/users/{userID}/tier", Handler: cfg.handlerAdminUserTierSet,
+			OperationID: "adminSetUserTier", Summary: "Put a user on a duration limit tier", Tag: "admin",
+			Auth:      true,
+			Audit:     "admin.user_tier",
+			Request:   userTierParams{},
+			Responses: []routeResponse{{http.StatusOK, "Tier", userTierResponse{}}},
+		},
+		{
+			Method: "GET", Path: "/admin/moderation/queue", Handler: cfg.handlerAdminModerationQueue,
+			OperationID: "adminModerationQueue", Summary: "List videos by moderation status, oldest first", Tag: "admin",
+			Auth: true,
+			Query: []queryParam{
+				{"status", "Moderation status, defaults to pending_review"},
+				{"limit", "Maximum number of videos"},
+			},
+			Responses: []routeResponse{{http.StatusOK, "Videos", []moderationResponse{}}},
+		},
+		{
+			Method: "PUT", Path: "/admin/videos/{videoID}/moderation", Handler: cfg.handlerAdminModerationSet,
+			OperationID: "adminSetModeration", Summary: "Approve or reject a video", Tag: "admin",
+			Auth:      true,
+			Audit:     "admin.moderation",
+			Request:   moderationSetParams{},
+			Responses: []routeResponse{{http.StatusOK, "Updated video", moderationResponse{}}},
+		},
+	}
+
+	return append(routes, legacyRoutes(routes)...)
+}
+
+// legacyRoutes serves each /api/v1 route at its old unversioned path too,
+// flagged as deprecated so clients know to move.
+func legacyRoutes(routes []apiRoute) []apiRoute {
+	var legacy []apiRoute
+	for _, route := range routes {
+		path, ok := strings.CutPrefix(route.Path, apiV1)
+		if !ok || route.OperationID == "getOpenAPI" {
+			continue
+		}
+		alias := route
+		alias.Path = legacyAPIPrefix + path
+		alias.Handler = deprecatedAlias(route.Handler)
+		alias.Legacy = true
+		legacy = append(legacy, alias)
+	}
+	return legacy
+}
+
+// deprecatedAlias marks responses from unversioned paths with the
+// Deprecation header and a link to the versioned path.
+func deprecatedAlias(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		successor := apiV1 + strings.TrimPrefix(r.URL.Path, legacyAPIPrefix)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
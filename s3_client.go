@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// The SDK's defaults wait up to 30s to connect and back off up to 20s
+// between attempts, so an unreachable endpoint only fails an upload after
+// minutes. These fail fast and leave the slow retries to our own multipart
+// and job retries.
+const (
+	defaultS3MaxIdleConns    = 100
+	defaultS3DialTimeout     = 5 * time.Second
+	defaultS3TLSTimeout      = 5 * time.Second
+	defaultS3ResponseTimeout = 30 * time.Second
+	defaultS3MaxAttempts     = 3
+	defaultS3MaxBackoff      = 5 * time.Second
+)
+
+// s3ClientConfig tunes the S3 client's connection pool, timeouts and
+// retries.
+type s3ClientConfig struct {
+	maxIdleConns int
+	dialTimeout  time.Duration
+	tlsTimeout   time.Duration
+	// responseTimeout is how long S3 may take to answer once a request has
+	// been sent, which doesn't limit how long bodies take to transfer
+	responseTimeout time.Duration
+	// requestTimeout bounds each attempt including its body, 0 for none.
+	// Setting it also cuts off long uploads, downloads and streams.
+	requestTimeout time.Duration
+	retryMode      string
+	maxAttempts    int
+	maxBackoff     time.Duration
+}
+
+// newS3Client builds the S3 client from the shared AWS config, with its
+// own HTTP client and retryer so other AWS clients keep their defaults.
+func newS3Client(awsCfg aws.Config, c s3ClientConfig) (*s3.Client, error) {
+	if c.maxIdleConns < 1 {
+		return nil, fmt.Errorf("max idle connections must be at least 1")
+	}
+	if c.dialTimeout <= 0 || c.tlsTimeout <= 0 || c.responseTimeout <= 0 || c.requestTimeout < 0 {
+		return nil, fmt.Errorf("timeouts must be positive")
+	}
+	if c.maxAttempts < 1 {
+		return nil, fmt.Errorf("max attempts must be at least 1")
+	}
+	if c.maxBackoff <= 0 {
+		return nil, fmt.Errorf("max backoff must be positive")
+	}
+	mode := aws.RetryModeStandard
+	if c.retryMode != "" {
+		var err error
+		if mode, err = aws.ParseRetryMode(c.retryMode); err != nil {
+			return nil, err
+		}
+	}
+
+	httpClient := awshttp.NewBuildableClient().
+		WithDialerOptions(func(d *net.Dialer) {
+			d.Timeout = c.dialTimeout
+		}).
+		WithTransportOptions(func(t *http.Transport) {
+			t.MaxIdleConns = c.maxIdleConns
+			// Every request goes to the same bucket endpoint
+			t.MaxIdleConnsPerHost = c.maxIdleConns
+			t.TLSHandshakeTimeout = c.tlsTimeout
+			t.ResponseHeaderTimeout = c.responseTimeout
+		}).
+		WithTimeout(c.requestTimeout)
+
+	standard := func(o *retry.StandardOptions) {
+		o.MaxAttempts = c.maxAttempts
+		o.MaxBackoff = c.maxBackoff
+	}
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		o.HTTPClient = httpClient
+		o.Retryer = retry.NewStandard(standard)
+		if mode == aws.RetryModeAdaptive {
+			o.Retryer = retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+				o.StandardOptions = append(o.StandardOptions, standard)
+			})
+		}
+	}), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+func defaultS3ClientConfig() s3ClientConfig {
+	return s3ClientConfig{
+		maxIdleConns:    defaultS3MaxIdleConns,
+		dialTimeout:     defaultS3DialTimeout,
+		tlsTimeout:      defaultS3TLSTimeout,
+		responseTimeout: defaultS3ResponseTimeout,
+		maxAttempts:     defaultS3MaxAttempts,
+		maxBackoff:      defaultS3MaxBackoff,
+	}
+}
+
+func TestNewS3Client(t *testing.T) {
+	c := defaultS3ClientConfig()
+	c.maxIdleConns = 7
+	c.dialTimeout = 2 * time.Second
+	c.responseTimeout = 9 * time.Second
+	c.requestTimeout = time.Minute
+	c.maxAttempts = 4
+	client, err := newS3Client(aws.Config{Region: "us-east-1"}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := client.Options()
+	if got := opts.Retryer.MaxAttempts(); got != 4 {
+		t.Errorf("max attempts is %d, want 4", got)
+	}
+	httpClient, ok := opts.HTTPClient.(*awshttp.BuildableClient)
+	if !ok {
+		t.Fatalf("HTTP client is %T", opts.HTTPClient)
+	}
+	transport := httpClient.GetTransport()
+	if transport.MaxIdleConns != 7 || transport.MaxIdleConnsPerHost != 7 {
+		t.Errorf("idle connections are %d, %d per host, want 7", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+	if transport.ResponseHeaderTimeout != 9*time.Second {
+		t.Errorf("response timeout is %s, want 9s", transport.ResponseHeaderTimeout)
+	}
+	if got := httpClient.GetDialer().Timeout; got != 2*time.Second {
+		t.Errorf("dial timeout is %s, want 2s", got)
+	}
+	if got := httpClient.GetTimeout(); got != time.Minute {
+		t.Errorf("request timeout is %s, want 1m", got)
+	}
+}
+
+func TestNewS3ClientRetryMode(t *testing.T) {
+	for _, mode := range []string{"", "standard", "adaptive"} {
+		c := defaultS3ClientConfig()
+		c.retryMode = mode
+		client, err := newS3Client(aws.Config{}, c)
+		if err != nil {
+			t.Fatalf("retry mode %q: %v", mode, err)
+		}
+		if got := client.Options().Retryer.MaxAttempts(); got != defaultS3MaxAttempts {
+			t.Errorf("retry mode %q: max attempts is %d, want %d", mode, got, defaultS3MaxAttempts)
+		}
+	}
+}
+
+func TestNewS3ClientInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *s3ClientConfig)
+	}{
+		{"no idle connections", func(c *s3ClientConfig) { c.maxIdleConns = 0 }},
+		{"zero dial timeout", func(c *s3ClientConfig) { c.dialTimeout = 0 }},
+		{"zero TLS timeout", func(c *s3ClientConfig) { c.tlsTimeout = 0 }},
+		{"zero response timeout", func(c *s3ClientConfig) { c.responseTimeout = 0 }},
+		{"negative request timeout", func(c *s3ClientConfig) { c.requestTimeout = -time.Second }},
+		{"no attempts", func(c *s3ClientConfig) { c.maxAttempts = 0 }},
+		{"zero backoff", func(c *s3ClientConfig) { c.maxBackoff = 0 }},
+		{"unknown retry mode", func(c *s3ClientConfig) { c.retryMode = "eager" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultS3ClientConfig()
+			tt.modify(&c)
+			if _, err := newS3Client(aws.Config{}, c); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
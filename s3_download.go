@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// downloadObjectToTemp streams an object into a new temp file and returns
+// its path. The caller is responsible for removing the file.
+func (cfg *apiConfig) downloadObjectToTemp(ctx context.Context, bucket, key, pattern string) (string, error) {
+	out, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	tempFile, err := os.CreateTemp(cfg.tempDir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, out.Body); err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("failed to download object %s: %w", key, err)
+	}
+	return tempFile.Name(), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxCopyObjectSize is the largest object CopyObject can handle in one call
+const maxCopyObjectSize = 5 << 30
+
+var uploadStorageClasses = map[string]types.StorageClass{
+	"STANDARD":            types.StorageClassStandard,
+	"STANDARD_IA":         types.StorageClassStandardIa,
+	"INTELLIGENT_TIERING": types.StorageClassIntelligentTiering,
+}
+
+// parseStorageClass validates S3_STORAGE_CLASS. An empty value leaves the
+// storage class to the bucket default.
+func parseStorageClass(raw string) (types.StorageClass, error) {
+	raw = strings.ToUpper(strings.TrimSpace(raw))
+	if raw == "" {
+		return "", nil
+	}
+	class, ok := uploadStorageClasses[raw]
+	if !ok {
+		return "", fmt.Errorf("unsupported storage class %q", raw)
+	}
+	return class, nil
+}
+
+type archiveResult struct {
+	Archived int      `json:"archived"`
+	Skipped  []string `json:"skipped"`
+	Failed   []string `json:"failed"`
+}
+
+// archiveOriginals moves originals of videos older than the archive window
+// to Glacier by copying each object onto itself with a new storage class.
+// Stream and preview renditions stay in their upload storage class.
+func (cfg *apiConfig) archiveOriginals(ctx context.Context) (archiveResult, error) {
+	result := archiveResult{Skipped: []string{}, Failed: []string{}}
+
+	cutoff := time.Now().UTC().Add(-cfg.archiveAfter)
+	videos, err := cfg.db.WithContext(ctx).GetVideosWithUnarchivedOriginals(cutoff)
+	if err != nil {
+		return result, fmt.Errorf("couldn't list videos: %w", err)
+	}
+
+	for _, video := range videos {
+		bucket, key, err := splitVideoURL(*video.OriginalURL)
+		if err != nil {
+			result.Failed = append(result.Failed, video.ID.String())
+			log.Printf("Archiving original of %s: %v", video.ID, err)
+			continue
+		}
+
+		head, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			result.Failed = append(result.Failed, video.ID.String())
+			log.Printf("Archiving original of %s: failed to head %s: %v", video.ID, key, err)
+			continue
+		}
+		// Deduplicated videos share an original, which may already be archived
+		alreadyArchived := head.StorageClass == types.StorageClassGlacier
+		if !alreadyArchived && aws.ToInt64(head.ContentLength) > maxCopyObjectSize {
+			result.Skipped = append(result.Skipped, video.ID.String())
+			log.Printf("Archiving original of %s: %s is too large for CopyObject, skipping", video.ID, key)
+			continue
+		}
+
+		copyInput := &s3.CopyObjectInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(key),
+			CopySource:        aws.String(url.PathEscape(bucket + "/" + key)),
+			StorageClass:      types.StorageClassGlacier,
+			MetadataDirective: types.MetadataDirectiveCopy,
+		}
+		cfg.s3SSE.applyToCopy(copyInput)
+
+		if !alreadyArchived {
+			if _, err := cfg.s3Client.CopyObject(ctx, copyInput); err != nil {
+				result.Failed = append(result.Failed, video.ID.String())
+				log.Printf("Archiving original of %s: copy failed: %v", video.ID, err)
+				continue
+			}
+		}
+
+		now := time.Now().UTC()
+		video.OriginalArchivedAt = &now
+		if err := cfg.db.WithContext(ctx).UpdateVideo(video); err != nil {
+			result.Failed = append(result.Failed, video.ID.String())
+			log.Printf("Archiving original of %s: couldn't update video: %v", video.ID, err)
+			continue
+		}
+		result.Archived++
+	}
+
+	log.Printf("Archived %d originals (%d skipped, %d failed)", result.Archived, len(result.Skipped), len(result.Failed))
+	return result, nil
+}
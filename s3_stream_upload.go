@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// multipartWriter uploads everything written to it as a multipart upload,
+// one part every multipartPartSize bytes, so output of unknown length can
+// go to S3 without being stored on disk first. Nothing is visible in the
+// bucket until complete is called; on failure the caller must call abort.
+type multipartWriter struct {
+	cfg        *apiConfig
+	ctx        context.Context
+	key        string
+	uploadID   *string
+	abort      func()
+	buf        []byte
+	partNumber int32
+	completed  []types.CompletedPart
+	composite  hash.Hash
+	size       int64
+}
+
+func (cfg *apiConfig) newMultipartWriter(ctx context.Context, key, contentType string, tags objectTags) (*multipartWriter, error) {
+	uploadID, abort, err := cfg.startMultipartUpload(ctx, key, contentType, tags)
+	if err != nil {
+		return nil, err
+	}
+	return &multipartWriter{
+		cfg:        cfg,
+		ctx:        ctx,
+		key:        key,
+		uploadID:   uploadID,
+		abort:      abort,
+		buf:        make([]byte, 0, multipartPartSize),
+		partNumber: 1,
+		composite:  sha256.New(),
+	}, nil
+}
+
+func (w *multipartWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush uploads the buffered bytes as the next part.
+func (w *multipartWriter) flush() error {
+	partSum := sha256.Sum256(w.buf)
+	w.composite.Write(partSum[:])
+	partChecksum := base64.StdEncoding.EncodeToString(partSum[:])
+
+	etag, _, err := w.cfg.uploadPartWithRetry(w.ctx, bytes.NewReader(w.buf), w.key, w.uploadID, w.partNumber, 0, int64(len(w.buf)), partChecksum)
+	if err != nil {
+		return err
+	}
+	w.completed = append(w.completed, types.CompletedPart{
+		ETag:           etag,
+		PartNumber:     aws.Int32(w.partNumber),
+		ChecksumSHA256: aws.String(partChecksum),
+	})
+	w.size += int64(len(w.buf))
+	w.partNumber++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// complete uploads the final part and completes the upload, returning what
+// HeadObject should report for the new object.
+func (w *multipartWriter) complete() (uploadedObject, error) {
+	if len(w.buf) > 0 || len(w.completed) == 0 {
+		if err := w.flush(); err != nil {
+			return uploadedObject{}, err
+		}
+	}
+	if err := w.cfg.completeMultipartUpload(w.ctx, w.key, w.uploadID, w.completed); err != nil {
+		return uploadedObject{}, err
+	}
+	return uploadedObject{
+		Key:            w.key,
+		Size:           w.size,
+		ChecksumSHA256: fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(w.composite.Sum(nil)), len(w.completed)),
+	}, nil
+}
+
+// publishStream uploads whatever write produces to key, verifies it and
+// returns the "bucket,key" reference stored in the database. The upload is
+// aborted if write fails, so a partial object never appears.
+func (cfg *apiConfig) publishStream(ctx context.Context, key, contentType string, tags objectTags, write func(w io.Writer) error) (string, error) {
+	upload, err := cfg.newMultipartWriter(ctx, key, contentType, tags)
+	if err != nil {
+		return "", err
+	}
+	if err := write(upload); err != nil {
+		upload.abort()
+		return "", err
+	}
+	uploaded, err := upload.complete()
+	if err != nil {
+		upload.abort()
+		return "", err
+	}
+
+	if err := cfg.verifyUploadedObject(ctx, uploaded); err != nil {
+		cfg.deleteObject(key)
+		return "", err
+	}
+	return fmt.Sprintf("%s,%s", cfg.s3Bucket, key), nil
+}
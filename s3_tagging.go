@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Tag keys applied to every uploaded object, for lifecycle rules and cost
+// allocation reports
+const (
+	tagUserID      = "user-id"
+	tagOrgID       = "org-id"
+	tagVideoID     = "video-id"
+	tagContentType = "content-type"
+	tagRendition   = "rendition"
+	// tagState is set to stateSuperseded once nothing references the object
+	tagState        = "state"
+	stateSuperseded = "superseded"
+)
+
+// objectTags are S3 object tags as key/value pairs.
+type objectTags map[string]string
+
+// encode formats the tags as the URL query string PutObject expects.
+func (t objectTags) encode() string {
+	values := url.Values{}
+	for k, v := range t {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+func (t objectTags) tagSet() []types.Tag {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	set := make([]types.Tag, 0, len(t))
+	for _, k := range keys {
+		set = append(set, types.Tag{Key: aws.String(k), Value: aws.String(t[k])})
+	}
+	return set
+}
+
+// tags returns the tags for an object rendered from these key parameters.
+func (p objectKeyParams) tags(contentType string) objectTags {
+	tags := objectTags{
+		tagUserID:      p.UserID.String(),
+		tagVideoID:     p.VideoID.String(),
+		tagContentType: contentType,
+		tagRendition:   p.Rendition,
+	}
+	if p.OrgID != nil {
+		tags[tagOrgID] = p.OrgID.String()
+	}
+	return tags
+}
+
+// markObjectsSuperseded re-tags objects that a video no longer references
+// (because they were replaced or the video was deleted) with
+// state=superseded, keeping their existing tags so lifecycle rules scoped by
+// user or video still match. Objects still shared with another video after
+// deduplication are left alone. Call it after the database change. Failures
+// are logged, not returned.
+func (cfg *apiConfig) markObjectsSuperseded(ctx context.Context, objectURLs ...string) {
+	for _, objectURL := range objectURLs {
+		if objectURL == "" {
+			continue
+		}
+		refs, err := cfg.db.WithContext(ctx).CountObjectReferences(objectURL)
+		if err != nil {
+			log.Printf("Couldn't count references to %s: %v", objectURL, err)
+			continue
+		}
+		if refs > 0 {
+			continue
+		}
+
+		bucket, key, err := splitVideoURL(objectURL)
+		if err != nil {
+			log.Printf("Couldn't mark object superseded: %v", err)
+			continue
+		}
+
+		existing, err := cfg.s3Client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			log.Printf("Couldn't read tags of %s: %v", key, err)
+			continue
+		}
+
+		tags := objectTags{}
+		for _, tag := range existing.TagSet {
+			tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		tags[tagState] = stateSuperseded
+
+		_, err = cfg.s3Client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+			Bucket:  aws.String(bucket),
+			Key:     aws.String(key),
+			Tagging: &types.Tagging{TagSet: tags.tagSet()},
+		})
+		if err != nil {
+			log.Printf("Couldn't tag %s as superseded: %v", key, err)
+		}
+	}
+}
+
+// videoObjectURLs returns every "bucket,key" reference a video holds.
+func videoObjectURLs(refs ...*string) []string {
+	var urls []string
+	for _, u := range refs {
+		if u != nil && *u != "" {
+			urls = append(urls, *u)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// S3 requires every part except the last to be at least 5MB
+	multipartPartSize   = 16 << 20
+	multipartMaxRetries = 3
+	multipartRetryDelay = 500 * time.Millisecond
+)
+
+// uploadedObject describes what S3 should report for an object we just wrote.
+type uploadedObject struct {
+	Key  string
+	Size int64
+	// ChecksumSHA256 is the value HeadObject returns: the base64 digest of
+	// the whole file for PutObject, or the composite "<digest>-<parts>"
+	// checksum for multipart uploads.
+	ChecksumSHA256 string
+}
+
+// hashingReader passes a file section through SHA-256 and counts its bytes
+// on the way to S3, so the checksum and size come from the same read as the
+// upload rather than a separate pass over the file. Seeking back to the
+// start, as the SDK does before a retry, starts the count over.
+type hashingReader struct {
+	section *io.SectionReader
+	tee     io.Reader
+	hash    hash.Hash
+	n       int64
+	// skipped is set while the position isn't where hashing left off
+	skipped bool
+}
+
+func newHashingReader(section *io.SectionReader) *hashingReader {
+	r := &hashingReader{section: section}
+	r.reset()
+	return r
+}
+
+func (r *hashingReader) reset() {
+	r.hash = sha256.New()
+	r.tee = io.TeeReader(r.section, r.hash)
+	r.n = 0
+	r.skipped = false
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.tee.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *hashingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.section.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	if pos == 0 {
+		r.reset()
+	} else {
+		r.skipped = pos != r.n
+	}
+	return pos, nil
+}
+
+// sum is the checksum of everything read since the last rewind, and how
+// many bytes that was.
+func (r *hashingReader) sum() ([]byte, int64, error) {
+	if r.skipped {
+		return nil, 0, errors.New("upload body was read out of order")
+	}
+	return r.hash.Sum(nil), r.n, nil
+}
+
+// uploadFileToS3 uploads f with a single PutObject and falls back to a
+// multipart upload with per-part retries if that fails mid-transfer. The
+// SDK sends the SHA-256 checksum as a trailer, which S3 checks and stores,
+// while hashingReader computes the same checksum for verifying the object
+// afterwards. Over plain HTTP, e.g. a local MinIO, trailers aren't
+// available and the SDK reads the file once more to send it up front.
+func (cfg *apiConfig) uploadFileToS3(ctx context.Context, f *os.File, key, contentType string, tags objectTags) (uploadedObject, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return uploadedObject{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	body := newHashingReader(io.NewSectionReader(f, 0, info.Size()))
+	putInput := &s3.PutObjectInput{
+		Bucket:            aws.String(cfg.s3Bucket),
+		Key:               aws.String(key),
+		Body:              body,
+		ContentLength:     aws.Int64(info.Size()),
+		ContentType:       aws.String(contentType),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		StorageClass:      cfg.s3StorageClass,
+		Tagging:           aws.String(tags.encode()),
+	}
+	cfg.s3SSE.applyToPut(putInput)
+
+	_, putErr := cfg.s3Client.PutObject(ctx, putInput)
+	if putErr == nil {
+		checksum, size, err := body.sum()
+		if err != nil {
+			return uploadedObject{}, fmt.Errorf("failed to checksum %s: %w", key, err)
+		}
+		slog.Info("Uploaded object using single PutObject", "key", key)
+		return uploadedObject{
+			Key:            key,
+			Size:           size,
+			ChecksumSHA256: base64.StdEncoding.EncodeToString(checksum),
+		}, nil
+	}
+	slog.Warn("PutObject failed, falling back to multipart upload", "key", key, "error", putErr)
+
+	composite, err := cfg.multipartUploadFile(ctx, f, info.Size(), key, contentType, tags)
+	if err != nil {
+		return uploadedObject{}, fmt.Errorf("multipart upload failed after PutObject error (%v): %w", putErr, err)
+	}
+	slog.Info("Uploaded object using multipart fallback", "key", key)
+	return uploadedObject{Key: key, Size: info.Size(), ChecksumSHA256: composite}, nil
+}
+
+// publishFile uploads and verifies f at key and returns the "bucket,key"
+// reference stored in the database.
+func (cfg *apiConfig) publishFile(ctx context.Context, f *os.File, key, contentType string, tags objectTags) (string, error) {
+	uploaded, err := cfg.uploadFileToS3(ctx, f, key, contentType, tags)
+	if err != nil {
+		return "", err
+	}
+
+	// Make sure the object landed intact before the DB points at it
+	if err := cfg.verifyUploadedObject(ctx, uploaded); err != nil {
+		cfg.deleteObject(key)
+		return "", err
+	}
+
+	return fmt.Sprintf("%s,%s", cfg.s3Bucket, key), nil
+}
+
+// verifyUploadedObject issues a HeadObject and checks the stored size and
+// checksum against what was uploaded, so a truncated or missing object is
+// caught before anything references it.
+func (cfg *apiConfig) verifyUploadedObject(ctx context.Context, obj uploadedObject) error {
+	head, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(cfg.s3Bucket),
+		Key:          aws.String(obj.Key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to head object %s: %w", obj.Key, err)
+	}
+	if size := aws.ToInt64(head.ContentLength); size != obj.Size {
+		return fmt.Errorf("object %s has size %d, expected %d", obj.Key, size, obj.Size)
+	}
+	if got := aws.ToString(head.ChecksumSHA256); got != obj.ChecksumSHA256 {
+		return fmt.Errorf("object %s has checksum %q, expected %q", obj.Key, got, obj.ChecksumSHA256)
+	}
+	return nil
+}
+
+// deleteObject removes key from the bucket, logging rather than returning
+// failures since it is only used for cleanup. If the delete fails the
+// object is tagged superseded instead, leaving it to the lifecycle rules.
+func (cfg *apiConfig) deleteObject(key string) {
+	_, err := cfg.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		slog.Warn("Failed to delete object, marking it superseded", "key", key, "error", err)
+		cfg.markObjectsSuperseded(context.Background(), fmt.Sprintf("%s,%s", cfg.s3Bucket, key))
+	}
+}
+
+// multipartUploadFile uploads f in parts, retrying each part independently,
+// and returns the composite SHA-256 checksum S3 will report for the object.
+// Each part is hashed as it is sent. The upload is aborted if any part
+// exhausts its retries.
+func (cfg *apiConfig) multipartUploadFile(ctx context.Context, f *os.File, size int64, key, contentType string, tags objectTags) (string, error) {
+	uploadID, abort, err := cfg.startMultipartUpload(ctx, key, contentType, tags)
+	if err != nil {
+		return "", err
+	}
+
+	var completed []types.CompletedPart
+	composite := sha256.New()
+	partNumber := int32(1)
+	for offset := int64(0); offset < size || partNumber == 1; offset += multipartPartSize {
+		length := min(multipartPartSize, size-offset)
+
+		etag, partChecksum, err := cfg.uploadPartWithRetry(ctx, f, key, uploadID, partNumber, offset, length, "")
+		if err != nil {
+			abort()
+			return "", err
+		}
+		partSum, err := base64.StdEncoding.DecodeString(partChecksum)
+		if err != nil {
+			abort()
+			return "", fmt.Errorf("failed to decode checksum of part %d: %w", partNumber, err)
+		}
+		composite.Write(partSum)
+		completed = append(completed, types.CompletedPart{
+			ETag:           etag,
+			PartNumber:     aws.Int32(partNumber),
+			ChecksumSHA256: aws.String(partChecksum),
+		})
+		partNumber++
+	}
+
+	if err := cfg.completeMultipartUpload(ctx, key, uploadID, completed); err != nil {
+		abort()
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(composite.Sum(nil)), len(completed)), nil
+}
+
+// startMultipartUpload creates a multipart upload for key and returns its
+// ID along with a func that aborts it. The upload is tracked until it is
+// completed or aborted, so abortStaleMultipartUploads can abort it if the
+// server dies first.
+func (cfg *apiConfig) startMultipartUpload(ctx context.Context, key, contentType string, tags objectTags) (*string, func(), error) {
+	createInput := &s3.CreateMultipartUploadInput{
+		Bucket:            aws.String(cfg.s3Bucket),
+		Key:               aws.String(key),
+		ContentType:       aws.String(contentType),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		StorageClass:      cfg.s3StorageClass,
+		Tagging:           aws.String(tags.encode()),
+	}
+	cfg.s3SSE.applyToMultipart(createInput)
+
+	created, err := cfg.s3Client.CreateMultipartUpload(ctx, createInput)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	uploadID := created.UploadId
+	if err := cfg.db.WithContext(ctx).CreateMultipartUpload(aws.ToString(uploadID), key); err != nil {
+		slog.Warn("Couldn't track multipart upload", "upload_id", aws.ToString(uploadID), "key", key, "error", err)
+	}
+
+	abort := func() {
+		if err := cfg.abortMultipartUpload(context.WithoutCancel(ctx), key, aws.ToString(uploadID)); err != nil {
+			slog.Warn("Failed to abort multipart upload", "upload_id", aws.ToString(uploadID), "key", key, "error", err)
+		}
+	}
+	return uploadID, abort, nil
+}
+
+// abortMultipartUpload discards the upload's parts and stops tracking it.
+// Aborting an upload S3 no longer has succeeds.
+func (cfg *apiConfig) abortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := cfg.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(cfg.s3Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	var noSuchUpload *types.NoSuchUpload
+	if err != nil && !errors.As(err, &noSuchUpload) {
+		return err
+	}
+	cfg.untrackMultipartUpload(uploadID)
+	return nil
+}
+
+func (cfg *apiConfig) untrackMultipartUpload(uploadID string) {
+	if err := cfg.db.DeleteMultipartUpload(uploadID); err != nil {
+		slog.Warn("Couldn't stop tracking multipart upload", "upload_id", uploadID, "error", err)
+	}
+}
+
+func (cfg *apiConfig) completeMultipartUpload(ctx context.Context, key string, uploadID *string, parts []types.CompletedPart) error {
+	_, err := cfg.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(cfg.s3Bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	cfg.untrackMultipartUpload(aws.ToString(uploadID))
+	return nil
+}
+
+// uploadPartWithRetry uploads length bytes of src from offset as one part.
+// Without a checksum the part is hashed as it is sent, and the checksum S3
+// needs to complete the upload is returned.
+func (cfg *apiConfig) uploadPartWithRetry(ctx context.Context, src io.ReaderAt, key string, uploadID *string, partNumber int32, offset, length int64, checksum string) (*string, string, error) {
+	var lastErr error
+	for attempt := 1; attempt <= multipartMaxRetries; attempt++ {
+		body := newHashingReader(io.NewSectionReader(src, offset, length))
+		input := &s3.UploadPartInput{
+			Bucket:        aws.String(cfg.s3Bucket),
+			Key:           aws.String(key),
+			UploadId:      uploadID,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          body,
+			ContentLength: aws.Int64(length),
+		}
+		if checksum != "" {
+			input.ChecksumSHA256 = aws.String(checksum)
+		} else {
+			input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+		}
+		out, err := cfg.s3Client.UploadPart(ctx, input)
+		if err == nil && checksum == "" {
+			var sum []byte
+			var size int64
+			sum, size, err = body.sum()
+			if err == nil && size != length {
+				err = fmt.Errorf("read %d bytes, expected %d", size, length)
+			}
+			if err == nil {
+				return out.ETag, base64.StdEncoding.EncodeToString(sum), nil
+			}
+		}
+		if err == nil {
+			return out.ETag, checksum, nil
+		}
+		lastErr = err
+		slog.Warn("Upload of part failed", "key", key, "part", partNumber, "attempt", attempt, "max_attempts", multipartMaxRetries, "error", err)
+		if attempt == multipartMaxRetries {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-time.After(multipartRetryDelay * time.Duration(1<<(attempt-1))):
+		}
+	}
+	return nil, "", fmt.Errorf("part %d failed after %d attempts: %w", partNumber, multipartMaxRetries, lastErr)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHashingReader(t *testing.T) {
+	const data = "0123456789abcdefghij"
+	want := sha256.Sum256([]byte(data))
+
+	tests := []struct {
+		name string
+		// read drives the reader like the SDK would before the final
+		// full read from wherever it leaves the position
+		read    func(r *hashingReader) error
+		wantErr bool
+	}{
+		{
+			name: "single read",
+			read: func(r *hashingReader) error { return nil },
+		},
+		{
+			name: "rewind after a partial read",
+			read: func(r *hashingReader) error {
+				if _, err := io.CopyN(io.Discard, r, 7); err != nil {
+					return err
+				}
+				_, err := r.Seek(0, io.SeekStart)
+				return err
+			},
+		},
+		{
+			name: "rewind after a full read",
+			read: func(r *hashingReader) error {
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					return err
+				}
+				_, err := r.Seek(0, io.SeekStart)
+				return err
+			},
+		},
+		{
+			name: "length from the end, then rewind",
+			read: func(r *hashingReader) error {
+				if _, err := r.Seek(0, io.SeekEnd); err != nil {
+					return err
+				}
+				_, err := r.Seek(0, io.SeekStart)
+				return err
+			},
+		},
+		{
+			name: "position checks don't move it",
+			read: func(r *hashingReader) error {
+				_, err := r.Seek(0, io.SeekCurrent)
+				return err
+			},
+		},
+		{
+			name: "skipping ahead",
+			read: func(r *hashingReader) error {
+				_, err := r.Seek(5, io.SeekStart)
+				return err
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newHashingReader(io.NewSectionReader(strings.NewReader(data), 0, int64(len(data))))
+			if err := tt.read(r); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				t.Fatal(err)
+			}
+
+			sum, n, err := r.sum()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sum, want[:]) {
+				t.Errorf("sum is %x, want %x", sum, want)
+			}
+			if n != int64(len(data)) {
+				t.Errorf("counted %d bytes, want %d", n, len(data))
+			}
+		})
+	}
+}
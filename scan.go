@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/scanner"
+)
+
+// defaultScanTimeout bounds a single malware scan
+const defaultScanTimeout = 2 * time.Minute
+
+// newScanner builds the configured malware scanner, or returns nil when
+// scanning is disabled.
+func newScanner(clamdAddress string, timeout time.Duration) (scanner.Scanner, error) {
+	if clamdAddress == "" {
+		return nil, nil
+	}
+	return scanner.NewClamAV(clamdAddress, timeout)
+}
+
+// scanUpload runs the configured scanner over src before it is persisted.
+// Infected files are rejected with 422 and the signature is logged. It
+// returns false once it has responded to the request.
+func (cfg *apiConfig) scanUpload(ctx context.Context, w http.ResponseWriter, src io.Reader, name string) bool {
+	if cfg.scanner == nil {
+		return true
+	}
+
+	result, err := cfg.scanner.Scan(ctx, src)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't scan file", err)
+		return false
+	}
+	if result.Infected {
+		log.Printf("Rejected infected upload %s: %s", name, result.Signature)
+		respondWithError(w, http.StatusUnprocessableEntity, "File failed malware scan",
+			fmt.Errorf("signature %s", result.Signature))
+		return false
+	}
+	return true
+}
+
+// scanUploadedFile scans the file at path, see scanUpload.
+func (cfg *apiConfig) scanUploadedFile(ctx context.Context, w http.ResponseWriter, path, name string) bool {
+	if cfg.scanner == nil {
+		return true
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't scan file", err)
+		return false
+	}
+	defer f.Close()
+	return cfg.scanUpload(ctx, w, f, name)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const defaultShutdownGracePeriod = 30 * time.Second
+
+// lifecycle coordinates background work with server shutdown. Processing
+// runs under ctx, which is only cancelled once the grace period is over, so
+// in-flight uploads and jobs get the chance to finish.
+type lifecycle struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	draining atomic.Bool
+	// drain is closed when shutdown starts so workers stop taking jobs
+	drain   chan struct{}
+	workers sync.WaitGroup
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel, drain: make(chan struct{})}
+}
+
+// beginDrain stops new uploads and job pickup.
+func (l *lifecycle) beginDrain() {
+	if l.draining.CompareAndSwap(false, true) {
+		close(l.drain)
+	}
+}
+
+// waitForWorkers blocks until every job worker has exited or ctx is done,
+// reporting whether they all exited.
+func (l *lifecycle) waitForWorkers(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		l.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// rejectWhileDraining wraps handlers that start new uploads or processing
+// so they answer 503 once shutdown has begun.
+func (cfg *apiConfig) rejectWhileDraining(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.lifecycle.draining.Load() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(cfg.shutdownGrace.Seconds())))
+			respondWithError(w, http.StatusServiceUnavailable, "Server is shutting down", nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// shutdown drains the server: it stops accepting requests and new jobs,
+// waits up to the grace period for in-flight requests and jobs, then
+// cancels whatever is still running. Interrupted jobs are put back in the
+// queued state so the next start picks them up.
+func (cfg *apiConfig) shutdown(srv *http.Server) {
+	slog.Info("Shutting down, waiting for in-flight work", "grace_period", cfg.shutdownGrace)
+	cfg.lifecycle.beginDrain()
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownGrace)
+	defer cancel()
+
+	if err := srv.Shutdown(graceCtx); err != nil {
+		slog.Warn("In-flight requests didn't finish in time", "error", err)
+	}
+	if !cfg.lifecycle.waitForWorkers(graceCtx) {
+		slog.Warn("Jobs didn't finish in time, interrupting them")
+	}
+
+	// Cancelling the work context stops ffmpeg and S3 transfers; give the
+	// workers a moment to record their jobs as queued again
+	cfg.lifecycle.cancel()
+	forceCtx, forceCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer forceCancel()
+	cfg.lifecycle.waitForWorkers(forceCtx)
+	srv.Close()
+	slog.Info("Shutdown complete")
+}
+
+// requeuePersistedJobs hands jobs left over by a previous run to the
+// workers, oldest first. Jobs still marked running were cut off by a crash
+// and are queued again; process_video jobs resume from their checkpoint.
+// With a shared queue running jobs may belong to live workers, so they are
+// left to the stale job check.
+func (cfg *apiConfig) requeuePersistedJobs() {
+	if !cfg.jobs.shared() {
+		running, err := cfg.db.ListJobs(database.JobFilter{Status: database.JobStatusRunning})
+		if err != nil {
+			slog.Error("Couldn't list running jobs", "error", err)
+			return
+		}
+		for _, job := range running {
+			job.Status = database.JobStatusQueued
+			if err := cfg.db.UpdateJob(job); err != nil {
+				slog.Error("Couldn't requeue interrupted job", "job_id", job.ID, "error", err)
+			}
+		}
+	}
+
+	jobs, err := cfg.db.ListJobs(database.JobFilter{Status: database.JobStatusQueued})
+	if err != nil {
+		slog.Error("Couldn't list queued jobs", "error", err)
+		return
+	}
+	slices.Reverse(jobs)
+	for _, job := range jobs {
+		cfg.enqueueJob(job)
+	}
+	if len(jobs) > 0 {
+		slog.Info("Requeued jobs from a previous run", "jobs", len(jobs))
+	}
+}
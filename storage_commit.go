@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// commitVideoUpdate saves video after new files were uploaded for it: an
+// asset under assetsRoot (or "") and "bucket,key" objects no row referenced
+// before. If the update fails they are discarded, so storage never holds
+// files the database doesn't know about.
+func (cfg *apiConfig) commitVideoUpdate(video database.Video, assetName string, objectURLs ...string) error {
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		cfg.discardUploads(assetName, objectURLs...)
+		return err
+	}
+	return nil
+}
+
+// commitVideoVersion is commitVideoUpdate for a new upload of the video's
+// file, which is recorded as its next version.
+func (cfg *apiConfig) commitVideoVersion(video database.Video, objectURLs ...string) (database.Video, error) {
+	video, err := cfg.db.UpdateVideoAsNewVersion(video)
+	if err != nil {
+		cfg.discardUploads("", objectURLs...)
+		return database.Video{}, err
+	}
+	return video, nil
+}
+
+// discardUploads removes files uploaded for a change that was not
+// committed: the asset named assetName and the "bucket,key" objects.
+func (cfg *apiConfig) discardUploads(assetName string, objectURLs ...string) {
+	if assetName != "" {
+		if err := os.Remove(filepath.Join(cfg.assetsRoot, assetName)); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove asset", "asset", assetName, "error", err)
+		}
+		if err := cfg.db.DeleteAsset(assetName); err != nil {
+			slog.Warn("Failed to forget asset", "asset", assetName, "error", err)
+		}
+	}
+	for _, objectURL := range objectURLs {
+		if objectURL == "" {
+			continue
+		}
+		if _, key, err := splitVideoURL(objectURL); err == nil {
+			cfg.deleteObject(key)
+		}
+	}
+}
+
+// discardNewVideoUploads removes what after references that before didn't,
+// for when after could not be saved.
+func (cfg *apiConfig) discardNewVideoUploads(before, after database.Video) {
+	assetName, objectURLs := newVideoUploads(before, after)
+	cfg.discardUploads(assetName, objectURLs...)
+}
+
+// newVideoUploads returns what after references that before didn't: the
+// thumbnail asset, if it changed, and the renditions.
+func newVideoUploads(before, after database.Video) (assetName string, objectURLs []string) {
+	if after.ThumbnailURL != nil && (before.ThumbnailURL == nil || *before.ThumbnailURL != *after.ThumbnailURL) {
+		assetName = path.Base(*after.ThumbnailURL)
+	}
+	previous := map[string]bool{}
+	for _, u := range videoObjectURLs(before.VideoURL, before.PreviewURL, before.SDRVideoURL, before.OriginalURL) {
+		previous[u] = true
+	}
+	for _, u := range videoObjectURLs(after.VideoURL, after.PreviewURL, after.SDRVideoURL, after.OriginalURL) {
+		if !previous[u] {
+			objectURLs = append(objectURLs, u)
+		}
+	}
+	return assetName, objectURLs
+}
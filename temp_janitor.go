@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	// defaultTempMaxAge is how old a temp file must be before the janitor
+	// takes it for a leftover, well past the longest a request or job
+	// holds one
+	defaultTempMaxAge     = 24 * time.Hour
+	tempJanitorInterval   = time.Hour
+	stagedUploadPattern   = "upload-*.mp4"
+	stagedArtifactPattern = stagedUploadPattern + ".*"
+)
+
+// tempFilePatterns match what the server creates directly in TEMP_DIR:
+// its own tubely-* files and directories, and the multipart-* files
+// net/http spools large form uploads to.
+var tempFilePatterns = []string{"tubely-*", "multipart-*"}
+
+// janitorStats counts what the temp janitor removed since the server
+// started.
+type janitorStats struct {
+	Runs           int        `json:"runs"`
+	LastRunAt      *time.Time `json:"last_run_at"`
+	FilesRemoved   int        `json:"files_removed"`
+	BytesReclaimed int64      `json:"bytes_reclaimed"`
+	// LastRun is what the latest sweep removed
+	LastRun janitorSweep `json:"last_run"`
+}
+
+type janitorSweep struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+type tempJanitor struct {
+	mu    sync.Mutex
+	stats janitorStats
+}
+
+func (j *tempJanitor) record(sweep janitorSweep) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().UTC()
+	j.stats.Runs++
+	j.stats.LastRunAt = &now
+	j.stats.FilesRemoved += sweep.Files
+	j.stats.BytesReclaimed += sweep.Bytes
+	j.stats.LastRun = sweep
+}
+
+func (j *tempJanitor) snapshot() janitorStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stats
+}
+
+// startTempJanitor sweeps the temp and staging directories at startup and
+// every tempJanitorInterval after, until the server shuts down.
+func (cfg *apiConfig) startTempJanitor() {
+	go func() {
+		ticker := time.NewTicker(tempJanitorInterval)
+		defer ticker.Stop()
+		for {
+			cfg.sweepTempFiles()
+			select {
+			case <-ticker.C:
+			case <-cfg.lifecycle.drain:
+				return
+			}
+		}
+	}()
+}
+
+// sweepTempFiles removes what crashes leave behind once it is older than
+// TEMP_MAX_AGE: temp files and directories in TEMP_DIR, staged uploads in
+// STAGING_DIR that no unfinished process_video job needs anymore, and the
+// .processing, .preview and other files derived from staged uploads that
+// aren't being processed right now.
+func (cfg *apiConfig) sweepTempFiles() {
+	cutoff := time.Now().Add(-cfg.tempMaxAge)
+	var sweep janitorSweep
+
+	for _, pattern := range tempFilePatterns {
+		matches, err := filepath.Glob(filepath.Join(cfg.tempDir, pattern))
+		if err != nil {
+			slog.Warn("Couldn't list temp files", "pattern", pattern, "error", err)
+			continue
+		}
+		for _, path := range matches {
+			// STAGING_DIR defaults to a tubely-staging directory in TEMP_DIR
+			if filepath.Clean(path) == filepath.Clean(cfg.stagingDir) {
+				continue
+			}
+			sweep.add(removeIfStale(path, cutoff))
+		}
+	}
+
+	staged, processing, err := cfg.stagedUploadsInUse()
+	if err != nil {
+		slog.Warn("Couldn't list staged uploads in use", "error", err)
+	} else {
+		uploads, err := filepath.Glob(filepath.Join(cfg.stagingDir, stagedUploadPattern))
+		if err != nil {
+			slog.Warn("Couldn't list staged uploads", "error", err)
+		}
+		for _, path := range uploads {
+			if !staged[filepath.Base(path)] {
+				sweep.add(removeIfStale(path, cutoff))
+			}
+		}
+		artifacts, err := filepath.Glob(filepath.Join(cfg.stagingDir, stagedArtifactPattern))
+		if err != nil {
+			slog.Warn("Couldn't list staging artifacts", "error", err)
+		}
+		for _, path := range artifacts {
+			upload, _, _ := strings.Cut(filepath.Base(path), ".mp4.")
+			if !processing[upload+".mp4"] {
+				sweep.add(removeIfStale(path, cutoff))
+			}
+		}
+	}
+
+	cfg.tempJanitor.record(sweep)
+	if sweep.Files > 0 {
+		slog.Info("Removed stale temp files", "files", sweep.Files, "bytes", sweep.Bytes)
+	}
+}
+
+func (s *janitorSweep) add(files int, bytes int64) {
+	s.Files += files
+	s.Bytes += bytes
+}
+
+// stagedUploadsInUse returns the names of the staged uploads that
+// unfinished or dead-lettered process_video jobs still need, and of those
+// whose job is running, which may be writing files derived from them.
+func (cfg *apiConfig) stagedUploadsInUse() (staged, processing map[string]bool, err error) {
+	staged = map[string]bool{}
+	processing = map[string]bool{}
+	for _, status := range []string{database.JobStatusQueued, database.JobStatusRunning, database.JobStatusDeadLettered} {
+		jobs, err := cfg.db.ListJobs(database.JobFilter{Kind: jobKindProcessVideo, Status: status})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, job := range jobs {
+			var params processVideoParams
+			if err := json.Unmarshal([]byte(job.Params), &params); err != nil || params.StagingPath == "" {
+				continue
+			}
+			name := filepath.Base(params.StagingPath)
+			staged[name] = true
+			if status == database.JobStatusRunning {
+				processing[name] = true
+			}
+		}
+	}
+	return staged, processing, nil
+}
+
+// removeIfStale removes path, a file or a directory with everything in
+// it, if it was last modified before cutoff. It returns the files removed
+// and their size.
+func removeIfStale(path string, cutoff time.Time) (int, int64) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.ModTime().Before(cutoff) {
+		return 0, 0
+	}
+	usage, err := dirUsage(path)
+	if err != nil {
+		slog.Warn("Couldn't measure stale temp file", "path", path, "error", err)
+		return 0, 0
+	}
+	if err := os.RemoveAll(path); err != nil {
+		slog.Warn("Couldn't remove stale temp file", "path", path, "error", err)
+		return 0, 0
+	}
+	return int(usage.Objects), usage.Bytes
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/buckket/go-blurhash"
+)
+
+const (
+	// placeholderSampleSize bounds the longer side of the copy the
+	// placeholder is computed from; a BlurHash keeps no more detail anyway
+	placeholderSampleSize = 64
+	// BlurHash components along the longer and the shorter side
+	blurHashComponentsLong  = 4
+	blurHashComponentsShort = 3
+)
+
+// thumbnailPlaceholder computes the placeholder of the asset named
+// assetName. Failing to is not worth failing the upload for, so it logs and
+// returns no placeholder instead.
+func (cfg *apiConfig) thumbnailPlaceholder(assetName string) database.ThumbnailPlaceholder {
+	placeholder, err := computeThumbnailPlaceholder(filepath.Join(cfg.assetsRoot, assetName))
+	if err != nil {
+		slog.Warn("Couldn't compute thumbnail placeholder", "asset", assetName, "error", err)
+		return database.ThumbnailPlaceholder{}
+	}
+	return placeholder
+}
+
+func computeThumbnailPlaceholder(path string) (database.ThumbnailPlaceholder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return database.ThumbnailPlaceholder{}, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return database.ThumbnailPlaceholder{}, fmt.Errorf("couldn't decode image: %w", err)
+	}
+	sample, color := downsample(img, placeholderSampleSize)
+
+	x, y := blurHashComponentsLong, blurHashComponentsShort
+	if sample.Bounds().Dy() > sample.Bounds().Dx() {
+		x, y = y, x
+	}
+	hash, err := blurhash.Encode(x, y, sample)
+	if err != nil {
+		return database.ThumbnailPlaceholder{}, fmt.Errorf("couldn't encode BlurHash: %w", err)
+	}
+	return database.ThumbnailPlaceholder{BlurHash: &hash, Color: &color}, nil
+}
+
+// downsample box-filters img so its longer side is at most size pixels and
+// returns the copy along with the average color of the image as #rrggbb.
+func downsample(img image.Image, size int) (*image.RGBA, string) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := max(1, (max(w, h)+size-1)/size)
+	out := image.NewRGBA(image.Rect(0, 0, max(1, w/scale), max(1, h/scale)))
+
+	var total [3]uint64
+	var pixels uint64
+	for oy := 0; oy < out.Rect.Dy(); oy++ {
+		for ox := 0; ox < out.Rect.Dx(); ox++ {
+			var sum [4]uint64
+			var n uint64
+			for y := b.Min.Y + oy*scale; y < b.Min.Y+(oy+1)*scale && y < b.Max.Y; y++ {
+				for x := b.Min.X + ox*scale; x < b.Min.X+(ox+1)*scale && x < b.Max.X; x++ {
+					r, g, bl, a := img.At(x, y).RGBA()
+					sum[0] += uint64(r)
+					sum[1] += uint64(g)
+					sum[2] += uint64(bl)
+					sum[3] += uint64(a)
+					n++
+				}
+			}
+			i := out.PixOffset(ox, oy)
+			for c := range sum {
+				out.Pix[i+c] = uint8(sum[c] / n >> 8)
+			}
+			for c := range total {
+				total[c] += sum[c]
+			}
+			pixels += n
+		}
+	}
+	color := fmt.Sprintf("#%02x%02x%02x",
+		total[0]/pixels>>8, total[1]/pixels>>8, total[2]/pixels>>8)
+	return out, color
+}
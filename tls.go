@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const defaultAutocertCacheDir = "autocert-cache"
+
+// tlsConfig is how the server terminates TLS itself. With neither a
+// certificate nor autocert domains it serves plain HTTP, for running
+// behind a proxy that terminates TLS.
+type tlsConfig struct {
+	CertFile string
+	KeyFile  string
+	// AutocertDomains get certificates from Let's Encrypt, cached in
+	// AutocertCacheDir
+	AutocertDomains  []string
+	AutocertEmail    string
+	AutocertCacheDir string
+	// RedirectPort, if set, serves plain HTTP that redirects to HTTPS and
+	// answers autocert's HTTP-01 challenges
+	RedirectPort string
+	// HTTP2 is negotiated over TLS unless disabled
+	HTTP2 bool
+	HSTS  hstsPolicy
+}
+
+func (c tlsConfig) enabled() bool {
+	return c.CertFile != "" || len(c.AutocertDomains) > 0
+}
+
+func (c tlsConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.CertFile != "" && len(c.AutocertDomains) > 0 {
+		return errors.New("set either TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS, not both")
+	}
+	if !c.enabled() && (c.RedirectPort != "" || c.HSTS.MaxAge > 0) {
+		return errors.New("HTTP_REDIRECT_PORT and HSTS_MAX_AGE need TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+	}
+	if c.HSTS.MaxAge < 0 {
+		return errors.New("HSTS_MAX_AGE can't be negative")
+	}
+	return nil
+}
+
+// hstsPolicy is the Strict-Transport-Security header sent over TLS. A zero
+// MaxAge sends none.
+type hstsPolicy struct {
+	MaxAge            time.Duration
+	IncludeSubdomains bool
+	Preload           bool
+}
+
+func (p hstsPolicy) header() string {
+	value := "max-age=" + strconv.Itoa(int(p.MaxAge.Seconds()))
+	if p.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if p.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// hstsMiddleware tells browsers to keep to HTTPS for the policy's max age.
+// Per RFC 6797 the header is only sent on secure responses.
+func hstsMiddleware(policy hstsPolicy, next http.Handler) http.Handler {
+	if policy.MaxAge <= 0 {
+		return next
+	}
+	header := policy.header()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", header)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// configureTLS sets srv up to serve TLS as configured and returns the
+// plain HTTP server for RedirectPort, or nil. srv is then started with
+// ListenAndServeTLS(c.CertFile, c.KeyFile), where autocert leaves both
+// empty.
+func configureTLS(srv *http.Server, c tlsConfig) *http.Server {
+	var acmeHandler func(http.Handler) http.Handler
+	if len(c.AutocertDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.AutocertDomains...),
+			Cache:      autocert.DirCache(c.AutocertCacheDir),
+			Email:      c.AutocertEmail,
+		}
+		// Also answers tls-alpn-01 challenges, so the redirect port is
+		// only needed for http-01
+		srv.TLSConfig = m.TLSConfig()
+		acmeHandler = m.HTTPHandler
+	} else {
+		srv.TLSConfig = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+	if !c.HTTP2 {
+		srv.TLSConfig.NextProtos = slices.DeleteFunc(srv.TLSConfig.NextProtos, func(proto string) bool {
+			return proto == "h2"
+		})
+		// A non-nil empty map keeps net/http from enabling HTTP/2
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+
+	if c.RedirectPort == "" {
+		return nil
+	}
+	var handler http.Handler = httpsRedirect(srv.Addr)
+	if acmeHandler != nil {
+		handler = acmeHandler(handler)
+	}
+	return &http.Server{
+		Addr:              ":" + c.RedirectPort,
+		Handler:           handler,
+		ReadHeaderTimeout: srv.ReadHeaderTimeout,
+		IdleTimeout:       srv.IdleTimeout,
+	}
+}
+
+// httpsRedirect permanently redirects every request to the same URL over
+// HTTPS on the port of tlsAddr.
+func httpsRedirect(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			http.Error(w, "Host header required", http.StatusBadRequest)
+			return
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+			// An IPv6 literal that had its port split off
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, fmt.Sprintf("https://%s%s", host, r.URL.RequestURI()), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
+)
+
+// transcodeLimiter caps how many ffmpeg processes run at once. Callers past
+// the limit wait their turn instead of forking another process.
+type transcodeLimiter struct {
+	sem     *semaphore.Weighted
+	limit   int
+	running atomic.Int64
+	waiting atomic.Int64
+}
+
+// transcodeStats is a snapshot of the limiter for the health endpoints.
+type transcodeStats struct {
+	Limit   int   `json:"limit"`
+	Running int64 `json:"running"`
+	Waiting int64 `json:"waiting"`
+}
+
+func newTranscodeLimiter(limit int) *transcodeLimiter {
+	return &transcodeLimiter{sem: semaphore.NewWeighted(int64(limit)), limit: limit}
+}
+
+// transcodes gates every ffmpeg run; main sizes it from
+// MAX_CONCURRENT_TRANSCODES.
+var transcodes = newTranscodeLimiter(runtime.NumCPU())
+
+// acquire blocks until a slot is free or ctx is done. The returned func
+// releases the slot.
+func (l *transcodeLimiter) acquire(ctx context.Context) (func(), error) {
+	l.waiting.Add(1)
+	start := time.Now()
+	err := l.sem.Acquire(ctx, 1)
+	l.waiting.Add(-1)
+	if err != nil {
+		return nil, err
+	}
+	if waited := time.Since(start); waited > time.Millisecond {
+		trace.SpanFromContext(ctx).AddEvent("waited for transcode slot",
+			trace.WithAttributes(attribute.Int64("wait_ms", waited.Milliseconds())))
+	}
+
+	l.running.Add(1)
+	return func() {
+		l.running.Add(-1)
+		l.sem.Release(1)
+	}, nil
+}
+
+func (l *transcodeLimiter) stats() transcodeStats {
+	return transcodeStats{Limit: l.limit, Running: l.running.Load(), Waiting: l.waiting.Load()}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	// idleConnTimeout is how long a keep-alive connection may sit unused
+	idleConnTimeout          = 2 * time.Minute
+	defaultUploadTimeout     = time.Hour
+	defaultUploadIdleTimeout = 30 * time.Second
+	// defaultUploadMinRate is in bytes per second
+	defaultUploadMinRate = 16 << 10
+	// uploadRateWindow is how long an upload is measured before it is held
+	// to the minimum rate, and how often after that
+	uploadRateWindow = 30 * time.Second
+)
+
+// errUploadTooSlow is returned by the body of an upload that broke its
+// deadline, stalled or fell below the minimum rate.
+var errUploadTooSlow = errors.New("upload too slow")
+
+// uploadLimits bound how long a client may take to send an upload. A zero
+// field disables that limit.
+type uploadLimits struct {
+	// Timeout is the deadline for the whole body
+	Timeout time.Duration
+	// IdleTimeout is the longest a read may wait for more bytes
+	IdleTimeout time.Duration
+	// MinRate is the bytes per second the client must keep up over each
+	// uploadRateWindow
+	MinRate int64
+}
+
+// limitUploadRate holds the upload route's request body to cfg.uploadLimits,
+// so a stalled or slowloris client gets its connection's reads cut off
+// instead of keeping the handler, and the temp files it has written,
+// around indefinitely. Reads past a limit fail with errUploadTooSlow.
+func (cfg *apiConfig) limitUploadRate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limits := cfg.uploadLimits
+		if limits == (uploadLimits{}) {
+			next(w, r)
+			return
+		}
+		now := time.Now()
+		body := &deadlineBody{
+			body:        r.Body,
+			w:           w,
+			rc:          http.NewResponseController(w),
+			limits:      limits,
+			windowStart: now,
+		}
+		if limits.Timeout > 0 {
+			body.deadline = now.Add(limits.Timeout)
+		}
+		r.Body = body
+		next(w, r)
+		if body.err != nil {
+			// The expired deadline stays, so the server doesn't wait on
+			// the rest of the body before dropping the connection
+			return
+		}
+		// Leave the connection as it was for the next request on it
+		body.rc.SetReadDeadline(time.Time{})
+	}
+}
+
+type deadlineBody struct {
+	body     io.ReadCloser
+	w        http.ResponseWriter
+	rc       *http.ResponseController
+	limits   uploadLimits
+	deadline time.Time
+	read     int64
+	err      error
+	// windowStart and windowRead are when the current rate window began
+	// and how much had been read by then
+	windowStart time.Time
+	windowRead  int64
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	now := time.Now()
+	// The socket deadline is what ends a read that is stuck waiting,
+	// where the checks below never get to run
+	readDeadline := b.deadline
+	if b.limits.IdleTimeout > 0 {
+		idle := now.Add(b.limits.IdleTimeout)
+		if readDeadline.IsZero() || idle.Before(readDeadline) {
+			readDeadline = idle
+		}
+	}
+	if !readDeadline.IsZero() {
+		// ErrNotSupported leaves only the checks below
+		b.rc.SetReadDeadline(readDeadline)
+	}
+
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	now = time.Now()
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		b.err = fmt.Errorf("%w: no data for %s after %d bytes", errUploadTooSlow, b.limits.IdleTimeout, b.read)
+	case err != nil:
+		return n, err
+	case !b.deadline.IsZero() && now.After(b.deadline):
+		b.err = fmt.Errorf("%w: not done after %s", errUploadTooSlow, b.limits.Timeout)
+	case b.limits.MinRate > 0 && now.Sub(b.windowStart) >= uploadRateWindow:
+		elapsed := now.Sub(b.windowStart)
+		if rate := float64(b.read-b.windowRead) / elapsed.Seconds(); rate < float64(b.limits.MinRate) {
+			b.err = fmt.Errorf("%w: %.0f bytes/s over %s, need %d", errUploadTooSlow, rate, elapsed.Round(time.Second), b.limits.MinRate)
+		}
+		b.windowStart, b.windowRead = now, b.read
+	}
+	if b.err != nil {
+		b.w.Header().Set("Connection", "close")
+		b.rc.SetReadDeadline(now)
+		return n, b.err
+	}
+	return n, nil
+}
+
+func (b *deadlineBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// preflightContentLength rejects a request whose declared Content-Length
+// is over limit with 413 and msg before any of the body is read, rather
+// than after reading up to the limit. Bodies without a length are left to
+// the handler's own http.MaxBytesReader.
+func preflightContentLength(limit int64, msg string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			// The client may still be sending the body it declared
+			w.Header().Set("Connection", "close")
+			respondWithErrorDetails(w, http.StatusRequestEntityTooLarge, msg,
+				fmt.Errorf("Content-Length %d is over %d", r.ContentLength, limit),
+				map[string]any{"max_bytes": limit, "content_length": r.ContentLength},
+			)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// getOwnedVideo resolves the {videoID} path value, authenticates the caller
+// and checks they may manage the video, see canManageVideo. If any step fails the error response has
+// already been written and ok is false.
+func (cfg *apiConfig) getOwnedVideo(w http.ResponseWriter, r *http.Request) (video database.Video, userID uuid.UUID, ok bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, uuid.Nil, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, uuid.Nil, false
+	}
+	userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid JWT", err)
+		return database.Video{}, uuid.Nil, false
+	}
+
+	video, err = cfg.db.WithContext(r.Context()).GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return database.Video{}, uuid.Nil, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, uuid.Nil, false
+	}
+	canManage, err := cfg.canManageVideo(r.Context(), userID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return database.Video{}, uuid.Nil, false
+	}
+	if !canManage {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized access", nil)
+		return database.Video{}, uuid.Nil, false
+	}
+
+	return video, userID, true
+}
+
+// canManageVideo reports whether userID may upload to, edit and delete the
+// video: its owner, or for organization videos any owner or uploader of the
+// organization, whoever created the video.
+func (cfg *apiConfig) canManageVideo(ctx context.Context, userID uuid.UUID, video database.Video) (bool, error) {
+	if video.OrgID == nil {
+		return video.UserID == userID, nil
+	}
+	role, err := cfg.db.WithContext(ctx).GetOrgRole(*video.OrgID, userID)
+	if err != nil {
+		return false, err
+	}
+	return role == database.RoleOwner || role == database.RoleUploader, nil
+}
+
+// requesterID returns the caller's user ID, or uuid.Nil if they didn't send
+// a valid token. For routes that also serve anonymous callers.
+func (cfg *apiConfig) requesterID(r *http.Request) uuid.UUID {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil
+	}
+	return userID
+}
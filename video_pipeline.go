@@ -0,0 +1,642 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/moderation"
+	"golang.org/x/sync/errgroup"
+)
+
+// Names of the processing stages recorded in a job's stage timings
+const (
+	stageProbe = "probe"
+	// stageAspect is the probe for the layout and dynamic range, which runs
+	// alongside stageProbe
+	stageAspect = "aspect"
+	stageRemux  = "remux"
+	// stageNormalize replaces stageRemux for uploads that are re-encoded
+	stageNormalize = "normalize"
+	stagePoster    = "poster"
+	stagePreview   = "preview"
+	// stageTonemap renders the SDR rendition of HDR uploads
+	stageTonemap = "tonemap"
+	// stageAnalyze picks the quality of per-title encodes before they start
+	stageAnalyze = "analyze"
+	// stageLoudness follows the remux when the profile normalizes loudness
+	stageLoudness = "loudnorm"
+	stageUpload   = "upload"
+	// stageModerate only runs when a classifier is configured
+	stageModerate = "moderate"
+)
+
+// stageTimer collects per-stage durations from concurrently running stages.
+type stageTimer struct {
+	mu      sync.Mutex
+	timings database.StageTimings
+}
+
+func newStageTimer() *stageTimer {
+	return &stageTimer{timings: database.StageTimings{}}
+}
+
+// track runs fn and records its wall-clock duration under stage, whether or
+// not it succeeds.
+func (t *stageTimer) track(stage string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start).Milliseconds()
+
+	t.mu.Lock()
+	t.timings[stage] += elapsed
+	t.mu.Unlock()
+	return err
+}
+
+func (t *stageTimer) snapshot() database.StageTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(database.StageTimings, len(t.timings))
+	for k, v := range t.timings {
+		out[k] = v
+	}
+	return out
+}
+
+// awaitStage blocks until the stage that closes done has finished, or
+// another stage failed and cancelled ctx.
+func awaitStage(ctx context.Context, done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// processUploadedVideo runs the processing stages for a freshly uploaded
+// file and returns the video with its new URLs set (the caller persists it).
+// Stage durations are recorded on timer; stages the profile leaves out
+// don't appear.
+//
+// The stages form a dependency graph rather than a sequence: each runs in
+// its own goroutine as soon as the stages it needs have closed their
+// channel, and ffmpeg runs still wait for MAX_CONCURRENT_TRANSCODES slots,
+// so a job uses as much of the CPU budget as it can get. Probing, poster
+// extraction, preview rendering and moderation only read the upload and
+// start right away. The first failing stage cancels the rest through the
+// group context.
+//
+// The remux waits for a probe that decides whether it has to re-encode:
+// uploads over the resolution or bit rate limits, rotated ones with
+// BAKE_ROTATION and every upload of a profile with the per-title step,
+// whose quality is then chosen by a sample analysis. With streamingRemux
+// it also waits for the aspect probe, since its output goes straight to
+// the S3 key the aspect ratio picks. HDR uploads whose profile has the sdr
+// step get a tonemapped SDR rendition once the probe has found them to be
+// HDR. Every audio track is kept, and with audioLanguage the first track in
+// that language becomes the default of the remuxed renditions. The
+// loudnorm step normalizes them after the remux, and the SDR rendition is
+// then tonemapped from the result. Once everything is rendered the
+// renditions are uploaded concurrently.
+func (cfg *apiConfig) processUploadedVideo(ctx context.Context, video database.Video, inputPath string, profile processingProfile, audioLanguage string, timer *stageTimer) (database.Video, error) {
+	var (
+		aspect        string
+		dimensions    database.Dimensions
+		processedPath string
+		videoURL      string
+		posterName    string
+		posterAt      float64
+		previewURL    string
+		sdrURL        string
+		verdict       moderation.Verdict
+	)
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	// The remux can only start once it's known whether it has to re-encode,
+	// at what quality, and which audio track it makes the default. Nothing
+	// else waits for that, so the stages that only read the upload start
+	// right away.
+	var (
+		normalize    bool
+		defaultAudio int
+		limits       = cfg.videoLimits
+	)
+	decided := make(chan struct{})
+	g.Go(func() error {
+		err := timer.track(stageProbe, func() error {
+			var err error
+			normalize, err = cfg.needsNormalizing(gctx, inputPath)
+			if err != nil {
+				return err
+			}
+			defaultAudio, err = cfg.defaultAudioTrack(gctx, inputPath, audioLanguage)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to analyze video: %w", err)
+		}
+		if profile.has(profileStepPerTitle) {
+			normalize = true
+			var (
+				crf  int
+				vmaf float64
+			)
+			err := timer.track(stageAnalyze, func() error {
+				var err error
+				crf, vmaf, err = cfg.transcoder.ChooseQuality(gctx, inputPath, limits, cfg.qualityTarget)
+				return err
+			})
+			switch {
+			case err != nil && gctx.Err() != nil:
+				return gctx.Err()
+			case err != nil:
+				// The upload is still worth encoding at the default quality
+				slog.WarnContext(ctx, "Per-title analysis failed, using the default quality", "error", err)
+			default:
+				slog.InfoContext(ctx, "Per-title analysis chose a quality", "crf", crf, "vmaf", vmaf)
+				limits.CRF = crf
+			}
+		}
+		close(decided)
+		return nil
+	})
+
+	probed := make(chan struct{})
+	var hdr bool
+	g.Go(func() error {
+		return timer.track(stageAspect, func() error {
+			probe, err := cfg.probeAspect(gctx, inputPath)
+			if err != nil {
+				return fmt.Errorf("failed to analyze video: %w", err)
+			}
+			aspect, dimensions = probe.Category, probe.dimensions()
+			hdr = probe.DynamicRange != media.DynamicRangeSDR
+			close(probed)
+			return nil
+		})
+	})
+
+	// Whether there is a remux, and whether it streams, is only known once
+	// decided is closed
+	loudnorm := profile.has(profileStepLoudnorm)
+	var remux, streamed bool
+	remuxed := make(chan struct{})
+	g.Go(func() error {
+		if err := awaitStage(gctx, decided); err != nil {
+			return err
+		}
+		// Uploads over the limits are re-encoded whatever the profile says,
+		// and loudness normalization needs a file of its own to work on
+		remux = profile.has(profileStepFaststart) || normalize || loudnorm
+		// A packager needs the whole file in hand
+		_, passthrough := cfg.packager.(media.Passthrough)
+		streamed = remux && cfg.streamingRemux && !normalize && !loudnorm && passthrough
+		if !remux {
+			return nil
+		}
+		stage := stageRemux
+		if normalize {
+			stage = stageNormalize
+		}
+		err := timer.track(stage, func() error {
+			if normalize {
+				return cfg.normalizeWithChapters(gctx, video, inputPath, limits, defaultAudio, &processedPath)
+			}
+			if !streamed {
+				return cfg.remuxWithChapters(gctx, video, inputPath, defaultAudio, &processedPath)
+			}
+			if err := awaitStage(gctx, probed); err != nil {
+				return err
+			}
+			var err error
+			videoURL, err = cfg.streamRemuxWithChapters(gctx, video, inputPath, aspect, defaultAudio)
+			return err
+		})
+		if err != nil || !loudnorm {
+			return err
+		}
+		err = timer.track(stageLoudness, func() error {
+			return cfg.normalizeLoudness(gctx, &processedPath)
+		})
+		if err != nil {
+			return err
+		}
+		close(remuxed)
+		return nil
+	})
+
+	// Only generate a poster if the owner hasn't uploaded a thumbnail. With
+	// POSTER_MODE=lambda the Lambda takes it from the stream rendition once
+	// that is uploaded.
+	if profile.has(profileStepPoster) && cfg.posterMode != posterModeLambda && (video.ThumbnailURL == nil || *video.ThumbnailURL == "") {
+		g.Go(func() error {
+			return timer.track(stagePoster, func() error {
+				var err error
+				posterName, posterAt, err = cfg.generatePoster(gctx, inputPath)
+				return err
+			})
+		})
+	}
+
+	previewPath := inputPath + ".preview"
+	if profile.has(profileStepPreview) {
+		defer os.Remove(previewPath)
+		g.Go(func() error {
+			return timer.track(stagePreview, func() error {
+				if err := cfg.transcoder.Preview(gctx, inputPath, previewPath); err != nil {
+					return fmt.Errorf("preview generation failed: %w", err)
+				}
+				return nil
+			})
+		})
+	}
+
+	sdrPath := inputPath + ".sdr"
+	if profile.has(profileStepSDR) {
+		defer os.Remove(sdrPath)
+		g.Go(func() error {
+			if err := awaitStage(gctx, probed); err != nil {
+				return err
+			}
+			if !hdr {
+				return nil
+			}
+			// The SDR rendition gets the normalized audio too
+			after := decided
+			if loudnorm {
+				after = remuxed
+			}
+			if err := awaitStage(gctx, after); err != nil {
+				return err
+			}
+			source := inputPath
+			if loudnorm {
+				source = processedPath
+			}
+			return timer.track(stageTonemap, func() error {
+				if err := cfg.transcoder.Tonemap(gctx, source, sdrPath, defaultAudio); err != nil {
+					return fmt.Errorf("tonemapping failed: %w", err)
+				}
+				return nil
+			})
+		})
+	}
+
+	if cfg.classifier != nil {
+		g.Go(func() error {
+			return timer.track(stageModerate, func() error {
+				var err error
+				verdict, err = cfg.moderateVideo(gctx, inputPath)
+				if err != nil {
+					return fmt.Errorf("moderation failed: %w", err)
+				}
+				return nil
+			})
+		})
+	}
+
+	err := g.Wait()
+	if processedPath != "" {
+		defer os.Remove(processedPath)
+	}
+	if err != nil {
+		cfg.discardUploads(posterName, videoURL)
+		return video, err
+	}
+	if normalize {
+		// The stream rendition is smaller than the upload now
+		probe, err := cfg.probeAspect(ctx, processedPath)
+		if err != nil {
+			return video, fmt.Errorf("failed to analyze normalized video: %w", err)
+		}
+		dimensions = probe.dimensions()
+	}
+	if remux {
+		// The untouched upload keeps its own default track
+		dimensions.AudioTracks = withDefaultAudio(dimensions.AudioTracks, defaultAudio)
+	}
+
+	// Upload the renditions now that the aspect ratio for their keys is
+	// known, side by side since they're separate objects
+	var originalURL string
+	err = timer.track(stageUpload, func() error {
+		ug, uctx := errgroup.WithContext(ctx)
+		if profile.has(profileStepPreview) {
+			ug.Go(func() error {
+				var err error
+				previewURL, err = cfg.publishPreview(uctx, previewPath, video, aspect)
+				if err != nil {
+					return fmt.Errorf("failed to upload preview to S3: %w", err)
+				}
+				return nil
+			})
+		}
+
+		if hdr && profile.has(profileStepSDR) {
+			ug.Go(func() error {
+				var err error
+				sdrURL, err = cfg.publishSDR(uctx, sdrPath, video, aspect)
+				if err != nil {
+					return fmt.Errorf("failed to upload SDR rendition to S3: %w", err)
+				}
+				return nil
+			})
+		}
+
+		// Without the remux the stream rendition is the untouched upload
+		// already
+		if remux && (cfg.keepOriginals || profile.has(profileStepOriginal)) {
+			ug.Go(func() error {
+				var err error
+				originalURL, err = cfg.publishOriginal(uctx, inputPath, video, aspect)
+				if err != nil {
+					return fmt.Errorf("failed to upload original to S3: %w", err)
+				}
+				return nil
+			})
+		}
+
+		if !streamed {
+			ug.Go(func() error {
+				streamPath := inputPath
+				if remux {
+					streamPath = processedPath
+				}
+				packagedPath, err := cfg.packager.Package(uctx, video.ID.String(), streamPath)
+				if err != nil {
+					return fmt.Errorf("failed to package video: %w", err)
+				}
+				if packagedPath != streamPath {
+					defer os.Remove(packagedPath)
+				}
+				processedFile, err := os.Open(packagedPath)
+				if err != nil {
+					return fmt.Errorf("failed to open processed video: %w", err)
+				}
+				defer processedFile.Close()
+
+				videoURL, err = cfg.publishVideoFile(uctx, processedFile, video, aspect)
+				if err != nil {
+					return fmt.Errorf("failed to upload to S3: %w", err)
+				}
+				return nil
+			})
+		}
+		return ug.Wait()
+	})
+	if err != nil {
+		cfg.discardUploads(posterName, previewURL, sdrURL, originalURL, videoURL)
+		return video, err
+	}
+
+	video.VideoURL = &videoURL
+	video.Dimensions = dimensions
+	video.PreviewURL = nil
+	if previewURL != "" {
+		video.PreviewURL = &previewURL
+	}
+	video.SDRVideoURL = nil
+	if sdrURL != "" {
+		video.SDRVideoURL = &sdrURL
+	}
+	if originalURL != "" {
+		video.OriginalURL = &originalURL
+		video.OriginalArchivedAt = nil
+	}
+	if cfg.classifier != nil {
+		video = applyModerationVerdict(video, verdict)
+	}
+	if posterName != "" {
+		if err := cfg.recordAsset(posterName, video.ID); err != nil {
+			cfg.discardUploads(posterName, previewURL, sdrURL, originalURL, videoURL)
+			return video, fmt.Errorf("failed to record poster: %w", err)
+		}
+		thumbnailURL := cfg.getAssetURL(posterName)
+		video.ThumbnailURL = &thumbnailURL
+		video.ThumbnailPlaceholder = cfg.thumbnailPlaceholder(posterName)
+		video.ThumbnailSourceURL = nil
+		video.ThumbnailCrop = nil
+		video.PosterTimestamp = &posterAt
+	}
+	return video, nil
+}
+
+// generatePoster writes an auto-generated thumbnail for the video at
+// input, a file or URL, to ASSETS_ROOT and returns its name and the time it
+// was taken from. The frame is picked by the transcoder's FindPoster unless
+// POSTER_SCENE_SELECTION is off or finds nothing, in which case the fixed
+// posterTimestamp is used.
+func (cfg *apiConfig) generatePoster(ctx context.Context, input string) (string, float64, error) {
+	timestamp := posterTimestamp
+	if cfg.posterSceneSelection {
+		found, ok, err := cfg.transcoder.FindPoster(ctx, input)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return "", 0, ctx.Err()
+		case err != nil:
+			slog.Warn("Poster frame selection failed, using the fixed offset", "error", err)
+		case ok:
+			timestamp = found
+		}
+	}
+
+	name, err := randomAssetName(".jpg")
+	if err != nil {
+		return "", 0, err
+	}
+	if err := cfg.transcoder.Poster(ctx, input, filepath.Join(cfg.assetsRoot, name), timestamp); err != nil {
+		return "", 0, fmt.Errorf("poster extraction failed: %w", err)
+	}
+	return name, timestamp, nil
+}
+
+// remuxWithChapters runs the faststart remux, embedding any chapters, and
+// stores the output path in processedPath.
+func (cfg *apiConfig) remuxWithChapters(ctx context.Context, video database.Video, inputPath string, defaultAudio int, processedPath *string) error {
+	metadataPath, err := cfg.prepareChapterMetadata(ctx, video, inputPath)
+	if err != nil {
+		return err
+	}
+	if metadataPath != "" {
+		defer os.Remove(metadataPath)
+	}
+
+	*processedPath, err = cfg.processVideoForFastStart(ctx, inputPath, metadataPath, defaultAudio)
+	if err != nil {
+		return fmt.Errorf("faststart remux failed: %w", err)
+	}
+	return nil
+}
+
+// needsNormalizing reports whether the upload at inputPath has to be
+// re-encoded: because it is over the configured resolution or bit rate, or
+// with BAKE_ROTATION because it only plays upright through its rotation
+// metadata.
+func (cfg *apiConfig) needsNormalizing(ctx context.Context, inputPath string) (bool, error) {
+	if cfg.bakeRotation {
+		rotation, err := cfg.prober.Rotation(ctx, inputPath)
+		if err != nil {
+			return false, err
+		}
+		if rotation != 0 {
+			return true, nil
+		}
+	}
+	limits := cfg.videoLimits
+	if limits.MaxResolution > 0 {
+		width, height, err := cfg.prober.Size(ctx, inputPath)
+		if err != nil {
+			return false, err
+		}
+		if min(width, height) > limits.MaxResolution {
+			return true, nil
+		}
+	}
+	if limits.MaxBitrate > 0 {
+		bitrate, err := cfg.prober.Bitrate(ctx, inputPath)
+		if err != nil {
+			return false, err
+		}
+		if bitrate > limits.MaxBitrate {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// normalizeWithChapters is remuxWithChapters re-encoding the video upright
+// and within limits.
+func (cfg *apiConfig) normalizeWithChapters(ctx context.Context, video database.Video, inputPath string, limits media.Limits, defaultAudio int, processedPath *string) error {
+	metadataPath, err := cfg.prepareChapterMetadata(ctx, video, inputPath)
+	if err != nil {
+		return err
+	}
+	if metadataPath != "" {
+		defer os.Remove(metadataPath)
+	}
+
+	outputPath := inputPath + ".processing"
+	if err := cfg.transcoder.Normalize(ctx, inputPath, metadataPath, outputPath, limits, defaultAudio); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("normalizing re-encode failed: %w", err)
+	}
+	*processedPath = outputPath
+	return nil
+}
+
+// normalizeLoudness brings the audio of the processed file at
+// processedPath to LOUDNESS_TARGET_LUFS, replacing the file.
+func (cfg *apiConfig) normalizeLoudness(ctx context.Context, processedPath *string) error {
+	outputPath := *processedPath + ".loudnorm"
+	if err := cfg.transcoder.NormalizeLoudness(ctx, *processedPath, outputPath, cfg.loudnessTarget); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("loudness normalization failed: %w", err)
+	}
+	os.Remove(*processedPath)
+	*processedPath = outputPath
+	return nil
+}
+
+// streamRemuxWithChapters remuxes into a fragmented MP4 that is uploaded
+// while ffmpeg writes it, and returns its "bucket,key" reference.
+func (cfg *apiConfig) streamRemuxWithChapters(ctx context.Context, video database.Video, inputPath, aspect string, defaultAudio int) (string, error) {
+	metadataPath, err := cfg.prepareChapterMetadata(ctx, video, inputPath)
+	if err != nil {
+		return "", err
+	}
+	if metadataPath != "" {
+		defer os.Remove(metadataPath)
+	}
+
+	videoURL, err := cfg.publishVideoStream(ctx, video, aspect, func(w io.Writer) error {
+		return cfg.transcoder.StreamFastStart(ctx, inputPath, metadataPath, defaultAudio, w)
+	})
+	if err != nil {
+		return "", fmt.Errorf("streaming remux to S3 failed: %w", err)
+	}
+	return videoURL, nil
+}
+
+// publishPreview uploads the rendered preview clip and returns its
+// "bucket,key" reference.
+func (cfg *apiConfig) publishPreview(ctx context.Context, previewPath string, video database.Video, aspect string) (string, error) {
+	previewFile, err := os.Open(previewPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open preview: %w", err)
+	}
+	defer previewFile.Close()
+
+	keyParams := previewKeyParams(video, aspect)
+	key, err := cfg.keyTemplate.render(keyParams)
+	if err != nil {
+		return "", err
+	}
+	return cfg.publishFile(ctx, previewFile, key, "video/mp4", keyParams.tags("video/mp4"))
+}
+
+// publishSDR uploads the tonemapped rendition of an HDR video and returns
+// its "bucket,key" reference.
+func (cfg *apiConfig) publishSDR(ctx context.Context, sdrPath string, video database.Video, aspect string) (string, error) {
+	sdrFile, err := os.Open(sdrPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open SDR rendition: %w", err)
+	}
+	defer sdrFile.Close()
+
+	keyParams := sdrKeyParams(video, aspect)
+	key, err := cfg.keyTemplate.render(keyParams)
+	if err != nil {
+		return "", err
+	}
+	return cfg.publishFile(ctx, sdrFile, key, "video/mp4", keyParams.tags("video/mp4"))
+}
+
+// publishOriginal uploads the untouched upload as the original rendition so
+// it can later be archived.
+func (cfg *apiConfig) publishOriginal(ctx context.Context, inputPath string, video database.Video, aspect string) (string, error) {
+	originalFile, err := os.Open(inputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open original: %w", err)
+	}
+	defer originalFile.Close()
+
+	keyParams := originalKeyParams(video, aspect)
+	key, err := cfg.keyTemplate.render(keyParams)
+	if err != nil {
+		return "", err
+	}
+	return cfg.publishFile(ctx, originalFile, key, "video/mp4", keyParams.tags("video/mp4"))
+}
+
+// prepareChapterMetadata writes the video's chapters to an ffmetadata file
+// next to inputPath, returning "" when there are none to embed.
+func (cfg *apiConfig) prepareChapterMetadata(ctx context.Context, video database.Video, inputPath string) (string, error) {
+	chapters, err := cfg.db.WithContext(ctx).GetChapters(video.ID)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get chapters: %w", err)
+	}
+	if len(chapters) == 0 {
+		return "", nil
+	}
+
+	duration, err := cfg.prober.Duration(ctx, inputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to analyze video: %w", err)
+	}
+
+	metadataPath := inputPath + ".chapters"
+	if err := writeChapterMetadata(metadataPath, chapters, duration); err != nil {
+		return "", fmt.Errorf("failed to write chapter metadata: %w", err)
+	}
+	return metadataPath, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Event types delivered to webhooks
+const (
+	eventModerationPending  = "video.moderation.pending"
+	eventModerationApproved = "video.moderation.approved"
+	eventModerationRejected = "video.moderation.rejected"
+	eventVideoTransferred   = "video.transferred"
+)
+
+const (
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 3
+	webhookRetryDelay  = time.Second
+	// webhookHistoryRetention is how long delivery attempts are kept
+	webhookHistoryRetention = 30 * 24 * time.Hour
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// event is the JSON payload posted to every configured webhook. UserID is
+// the owner of the video the event is about.
+type event struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	VideoID   uuid.UUID `json:"video_id"`
+	Data      any       `json:"data,omitempty"`
+}
+
+// webhookEndpoint is a URL events are posted to. Payloads are signed with
+// Secret unless it is empty.
+type webhookEndpoint struct {
+	URL    string
+	Secret string
+}
+
+// parseWebhookEndpoints splits the comma separated WEBHOOK_URLS value. Each
+// entry is a URL, optionally followed by a space and its own secret;
+// defaultSecret signs for those without one.
+func parseWebhookEndpoints(raw, defaultSecret string) []webhookEndpoint {
+	var endpoints []webhookEndpoint
+	for _, entry := range strings.Split(raw, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		endpoint := webhookEndpoint{URL: fields[0], Secret: defaultSecret}
+		if len(fields) > 1 {
+			endpoint.Secret = fields[1]
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// signWebhook returns the X-Tubely-Signature value for payload sent at
+// timestamp: the hex HMAC-SHA256 of "<timestamp>.<payload>".
+func signWebhook(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// publishEvent delivers evt to every webhook in the background. Delivery is
+// best effort: failures are retried a few times and then logged. Shutdown
+// waits for deliveries like it does for jobs.
+func (cfg *apiConfig) publishEvent(eventType string, userID, videoID uuid.UUID, data any) {
+	if len(cfg.webhooks) == 0 {
+		return
+	}
+
+	evt := event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		UserID:    userID,
+		VideoID:   videoID,
+		Data:      data,
+	}
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		slog.Error("Couldn't encode event", "event_type", eventType, "error", err)
+		return
+	}
+
+	for _, endpoint := range cfg.webhooks {
+		cfg.lifecycle.workers.Add(1)
+		go func() {
+			defer cfg.lifecycle.workers.Done()
+			cfg.deliverWebhook(cfg.lifecycle.ctx, endpoint, evt, payload)
+		}()
+	}
+}
+
+// deliverWebhook posts the event until it is accepted or out of attempts,
+// recording each attempt. Retries stop once ctx is done.
+func (cfg *apiConfig) deliverWebhook(ctx context.Context, endpoint webhookEndpoint, evt event, payload []byte) {
+	var lastErr error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		start := time.Now()
+		statusCode, err := postWebhook(ctx, endpoint, evt, payload)
+		lastErr = err
+		delivery := database.CreateWebhookDeliveryParams{
+			EventID:    evt.ID,
+			EventType:  evt.Type,
+			URL:        endpoint.URL,
+			Attempt:    attempt,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if statusCode != 0 {
+			delivery.StatusCode = &statusCode
+		}
+		if err != nil {
+			msg := err.Error()
+			delivery.Error = &msg
+		}
+		if err := cfg.db.WithContext(context.WithoutCancel(ctx)).CreateWebhookDelivery(delivery); err != nil {
+			slog.Warn("Couldn't record webhook delivery", "event_id", evt.ID, "error", err)
+		}
+		if lastErr == nil || ctx.Err() != nil {
+			break
+		}
+		if attempt < webhookMaxAttempts {
+			select {
+			case <-time.After(webhookRetryDelay * time.Duration(1<<(attempt-1))):
+			case <-ctx.Done():
+			}
+		}
+	}
+	if lastErr != nil {
+		slog.Warn("Webhook delivery failed", "url", endpoint.URL, "event_id", evt.ID, "event_type", evt.Type, "error", lastErr)
+	}
+}
+
+// pruneWebhookDeliveries forgets delivery attempts older than
+// webhookHistoryRetention.
+func (cfg *apiConfig) pruneWebhookDeliveries(ctx context.Context) {
+	if err := cfg.db.WithContext(ctx).DeleteWebhookDeliveriesBefore(time.Now().Add(-webhookHistoryRetention)); err != nil {
+		slog.Warn("Couldn't prune webhook deliveries", "error", err)
+	}
+}
+
+// postWebhook makes one delivery attempt, returning the response status if
+// there was one. Every attempt is signed with a fresh timestamp.
+func postWebhook(ctx context.Context, endpoint webhookEndpoint, evt event, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tubely-Event", evt.Type)
+	req.Header.Set("X-Tubely-Event-ID", evt.ID.String())
+	if endpoint.Secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set("X-Tubely-Timestamp", strconv.FormatInt(timestamp, 10))
+		req.Header.Set("X-Tubely-Signature", signWebhook(endpoint.Secret, timestamp, payload))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}